@@ -0,0 +1,33 @@
+// Copyright 2018 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package api
+
+import (
+	"net/http"
+
+	"github.com/tsuru/tsuru/autocert"
+	"github.com/tsuru/tsuru/errors"
+)
+
+// title: acme challenge
+// path: /.well-known/acme-challenge/{token}
+// method: GET
+// produce: text/plain
+// responses:
+//   200: OK
+//   404: Not found
+func acmeChallenge(w http.ResponseWriter, r *http.Request) error {
+	token := r.URL.Query().Get(":token")
+	response, err := autocert.ChallengeResponse(token)
+	if err != nil {
+		if err == autocert.ErrChallengeNotFound {
+			return &errors.HTTP{Code: http.StatusNotFound, Message: err.Error()}
+		}
+		return err
+	}
+	w.Header().Set("Content-Type", "text/plain")
+	_, err = w.Write([]byte(response))
+	return err
+}
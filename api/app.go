@@ -10,16 +10,21 @@ import (
 	"io/ioutil"
 	"net/http"
 	"net/url"
+	"regexp"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/ajg/form"
 	"github.com/globalsign/mgo/bson"
+	"github.com/golang/protobuf/proto"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
 	"github.com/tsuru/tsuru/api/context"
 	"github.com/tsuru/tsuru/app"
 	"github.com/tsuru/tsuru/app/bind"
 	"github.com/tsuru/tsuru/auth"
+	"github.com/tsuru/tsuru/autocert"
 	"github.com/tsuru/tsuru/db"
 	"github.com/tsuru/tsuru/errors"
 	"github.com/tsuru/tsuru/event"
@@ -373,6 +378,13 @@ func createApp(w http.ResponseWriter, r *http.Request, t auth.Token) (err error)
 					Message: "Quota exceeded",
 				}
 			}
+			switch e.Err.(type) {
+			case *app.TeamQuotaExceededError, *pool.CapacityExceededError:
+				return &errors.HTTP{
+					Code:    http.StatusForbidden,
+					Message: e.Err.Error(),
+				}
+			}
 		}
 		if err == appTypes.ErrInvalidPlatform {
 			return &errors.HTTP{Code: http.StatusBadRequest, Message: err.Error()}
@@ -612,6 +624,203 @@ func removeUnits(w http.ResponseWriter, r *http.Request, t auth.Token) (err erro
 	return a.RemoveUnits(n, processName, writer)
 }
 
+// title: set units autoscale
+// path: /apps/{app}/units/autoscale
+// method: PUT
+// consume: application/x-www-form-urlencoded
+// responses:
+//   200: Ok
+//   400: Invalid data
+//   401: Unauthorized
+//   404: App not found
+func setUnitsAutoScale(w http.ResponseWriter, r *http.Request, t auth.Token) (err error) {
+	err = r.ParseForm()
+	if err != nil {
+		return &errors.HTTP{Code: http.StatusBadRequest, Message: err.Error()}
+	}
+	var spec provision.AutoScaleSpec
+	dec := form.NewDecoder(nil)
+	dec.IgnoreCase(true)
+	dec.IgnoreUnknownKeys(true)
+	err = dec.DecodeValues(&spec, r.Form)
+	if err != nil {
+		return &errors.HTTP{Code: http.StatusBadRequest, Message: err.Error()}
+	}
+	appName := r.URL.Query().Get(":app")
+	a, err := getAppFromContext(appName, r)
+	if err != nil {
+		return err
+	}
+	allowed := permission.Check(t, permission.PermAppUpdateUnitAutoscale,
+		contextsForApp(&a)...,
+	)
+	if !allowed {
+		return permission.ErrUnauthorized
+	}
+	evt, err := event.New(&event.Opts{
+		Target:     appTarget(appName),
+		Kind:       permission.PermAppUpdateUnitAutoscale,
+		Owner:      t,
+		CustomData: event.FormToCustomData(r.Form),
+		Allowed:    event.Allowed(permission.PermAppReadEvents, contextsForApp(&a)...),
+	})
+	if err != nil {
+		return err
+	}
+	defer func() { evt.Done(err) }()
+	return a.SetAutoScale(spec)
+}
+
+// title: remove units autoscale
+// path: /apps/{app}/units/autoscale
+// method: DELETE
+// responses:
+//   200: Ok
+//   401: Unauthorized
+//   404: App or autoscale not found
+func removeUnitsAutoScale(w http.ResponseWriter, r *http.Request, t auth.Token) (err error) {
+	processName := r.FormValue("process")
+	appName := r.URL.Query().Get(":app")
+	a, err := getAppFromContext(appName, r)
+	if err != nil {
+		return err
+	}
+	allowed := permission.Check(t, permission.PermAppUpdateUnitAutoscale,
+		contextsForApp(&a)...,
+	)
+	if !allowed {
+		return permission.ErrUnauthorized
+	}
+	evt, err := event.New(&event.Opts{
+		Target:     appTarget(appName),
+		Kind:       permission.PermAppUpdateUnitAutoscale,
+		Owner:      t,
+		CustomData: event.FormToCustomData(r.Form),
+		Allowed:    event.Allowed(permission.PermAppReadEvents, contextsForApp(&a)...),
+	})
+	if err != nil {
+		return err
+	}
+	defer func() { evt.Done(err) }()
+	err = a.RemoveAutoScale(processName)
+	if err == app.ErrAutoScaleNotFound {
+		return &errors.HTTP{Code: http.StatusNotFound, Message: err.Error()}
+	}
+	return err
+}
+
+// title: list cron jobs
+// path: /apps/{app}/cron
+// method: GET
+// produce: application/json
+// responses:
+//   200: OK
+//   204: No content
+//   401: Unauthorized
+//   404: App not found
+func listCronJobs(w http.ResponseWriter, r *http.Request, t auth.Token) error {
+	appName := r.URL.Query().Get(":app")
+	a, err := getAppFromContext(appName, r)
+	if err != nil {
+		return err
+	}
+	allowed := permission.Check(t, permission.PermAppRead,
+		contextsForApp(&a)...,
+	)
+	if !allowed {
+		return permission.ErrUnauthorized
+	}
+	jobs, err := a.GetCronJobs()
+	if err != nil {
+		return err
+	}
+	if len(jobs) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	}
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(jobs)
+}
+
+// title: set cron job
+// path: /apps/{app}/cron
+// method: PUT
+// consume: application/x-www-form-urlencoded
+// responses:
+//   200: Ok
+//   400: Invalid data
+//   401: Unauthorized
+//   404: App not found
+func setCronJob(w http.ResponseWriter, r *http.Request, t auth.Token) (err error) {
+	job := provision.CronJob{
+		Name:              r.FormValue("name"),
+		Schedule:          r.FormValue("schedule"),
+		Command:           r.FormValue("command"),
+		ConcurrencyPolicy: r.FormValue("concurrency_policy"),
+	}
+	appName := r.URL.Query().Get(":app")
+	a, err := getAppFromContext(appName, r)
+	if err != nil {
+		return err
+	}
+	allowed := permission.Check(t, permission.PermAppUpdateCronSet,
+		contextsForApp(&a)...,
+	)
+	if !allowed {
+		return permission.ErrUnauthorized
+	}
+	evt, err := event.New(&event.Opts{
+		Target:     appTarget(appName),
+		Kind:       permission.PermAppUpdateCronSet,
+		Owner:      t,
+		CustomData: event.FormToCustomData(r.Form),
+		Allowed:    event.Allowed(permission.PermAppReadEvents, contextsForApp(&a)...),
+	})
+	if err != nil {
+		return err
+	}
+	defer func() { evt.Done(err) }()
+	return a.SetCronJob(job)
+}
+
+// title: remove cron job
+// path: /apps/{app}/cron/{name}
+// method: DELETE
+// responses:
+//   200: Ok
+//   401: Unauthorized
+//   404: App or cron job not found
+func removeCronJob(w http.ResponseWriter, r *http.Request, t auth.Token) (err error) {
+	appName := r.URL.Query().Get(":app")
+	jobName := r.URL.Query().Get(":name")
+	a, err := getAppFromContext(appName, r)
+	if err != nil {
+		return err
+	}
+	allowed := permission.Check(t, permission.PermAppUpdateCronRemove,
+		contextsForApp(&a)...,
+	)
+	if !allowed {
+		return permission.ErrUnauthorized
+	}
+	evt, err := event.New(&event.Opts{
+		Target:     appTarget(appName),
+		Kind:       permission.PermAppUpdateCronRemove,
+		Owner:      t,
+		CustomData: event.FormToCustomData(r.Form),
+		Allowed:    event.Allowed(permission.PermAppReadEvents, contextsForApp(&a)...),
+	})
+	if err != nil {
+		return err
+	}
+	defer func() { evt.Done(err) }()
+	err = a.RemoveCronJob(jobName)
+	if err == app.ErrCronJobNotFound {
+		return &errors.HTTP{Code: http.StatusNotFound, Message: err.Error()}
+	}
+	return err
+}
+
 // title: set unit status
 // path: /apps/{app}/units/{unit}
 // method: POST
@@ -1049,6 +1258,7 @@ func setCName(w http.ResponseWriter, r *http.Request, t auth.Token) (err error)
 	}
 	defer func() { evt.Done(err) }()
 	if err = a.AddCName(cnames...); err == nil {
+		autocert.Trigger()
 		return nil
 	}
 	if err.Error() == "Invalid cname" {
@@ -1129,7 +1339,39 @@ func appLog(w http.ResponseWriter, r *http.Request, t auth.Token) error {
 	unit := r.URL.Query().Get("unit")
 	follow := r.URL.Query().Get("follow")
 	appName := r.URL.Query().Get(":app")
-	filterLog := app.Applog{Source: source, Unit: unit}
+	args := appTypes.ListLogArgs{
+		Source: source,
+		Unit:   unit,
+		Limit:  lines,
+		Query:  r.URL.Query().Get("query"),
+		Before: r.URL.Query().Get("cursor"),
+	}
+	var queryRegexp *regexp.Regexp
+	if args.Query != "" {
+		queryRegexp, err = regexp.Compile(args.Query)
+		if err != nil {
+			msg := `Parameter "query" must be a valid regular expression.`
+			return &errors.HTTP{Code: http.StatusBadRequest, Message: msg}
+		}
+	}
+	if since := r.URL.Query().Get("since"); since != "" {
+		args.Since, err = time.Parse(time.RFC3339, since)
+		if err != nil {
+			msg := `Parameter "since" must be a date in RFC 3339 format.`
+			return &errors.HTTP{Code: http.StatusBadRequest, Message: msg}
+		}
+	}
+	if until := r.URL.Query().Get("until"); until != "" {
+		args.Until, err = time.Parse(time.RFC3339, until)
+		if err != nil {
+			msg := `Parameter "until" must be a date in RFC 3339 format.`
+			return &errors.HTTP{Code: http.StatusBadRequest, Message: msg}
+		}
+	}
+	if follow == "1" && (!args.Until.IsZero() || args.Before != "") {
+		msg := `Parameter "follow" cannot be used with "until" or "cursor".`
+		return &errors.HTTP{Code: http.StatusBadRequest, Message: msg}
+	}
 	a, err := getAppFromContext(appName, r)
 	if err != nil {
 		return err
@@ -1140,8 +1382,11 @@ func appLog(w http.ResponseWriter, r *http.Request, t auth.Token) error {
 	if !allowed {
 		return permission.ErrUnauthorized
 	}
-	logs, err := a.LastLogs(lines, filterLog)
+	logs, err := a.SearchLogs(args)
 	if err != nil {
+		if err == appTypes.ErrInvalidLogCursor {
+			return &errors.HTTP{Code: http.StatusBadRequest, Message: err.Error()}
+		}
 		return err
 	}
 	encoder := json.NewEncoder(w)
@@ -1158,7 +1403,7 @@ func appLog(w http.ResponseWriter, r *http.Request, t auth.Token) error {
 	} else {
 		closeChan = make(chan bool)
 	}
-	l, err := app.NewLogListener(&a, filterLog)
+	l, err := servicemanager.AppLog.Watch(a.Name, source, unit)
 	if err != nil {
 		return err
 	}
@@ -1169,7 +1414,7 @@ func appLog(w http.ResponseWriter, r *http.Request, t auth.Token) error {
 	}()
 	logChan := l.ListenChan()
 	for {
-		var logMsg app.Applog
+		var logMsg appTypes.Applog
 		var chOpen bool
 		select {
 		case <-closeChan:
@@ -1179,7 +1424,10 @@ func appLog(w http.ResponseWriter, r *http.Request, t auth.Token) error {
 		if !chOpen {
 			return nil
 		}
-		err := encoder.Encode([]app.Applog{logMsg})
+		if queryRegexp != nil && !queryRegexp.MatchString(logMsg.Message) {
+			continue
+		}
+		err := encoder.Encode([]appTypes.Applog{logMsg})
 		if err != nil {
 			break
 		}
@@ -1776,6 +2024,100 @@ func appMetricEnvs(w http.ResponseWriter, r *http.Request, t auth.Token) error {
 	return json.NewEncoder(w).Encode(metricMap)
 }
 
+// title: app units metrics
+// path: /apps/{app}/metrics
+// method: GET
+// produce: application/json, text/plain
+// responses:
+//   200: Ok
+//   400: Provisioner does not support metrics
+//   401: Unauthorized
+//   404: App not found
+func appMetrics(w http.ResponseWriter, r *http.Request, t auth.Token) error {
+	a, err := getAppFromContext(r.URL.Query().Get(":app"), r)
+	if err != nil {
+		return err
+	}
+	allowed := permission.Check(t, permission.PermAppReadMetric,
+		contextsForApp(&a)...,
+	)
+	if !allowed {
+		return permission.ErrUnauthorized
+	}
+	metrics, err := a.UnitsMetrics()
+	if err != nil {
+		if _, ok := err.(provision.ProvisionerNotSupported); ok {
+			return &errors.HTTP{Code: http.StatusBadRequest, Message: err.Error()}
+		}
+		return err
+	}
+	if r.URL.Query().Get("format") == "prometheus" || strings.Contains(r.Header.Get("Accept"), "text/plain") {
+		format := expfmt.Negotiate(r.Header)
+		w.Header().Set("Content-Type", string(format))
+		return writePrometheusMetrics(expfmt.NewEncoder(w, format), a.Name, metrics)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(metrics)
+}
+
+func writePrometheusMetrics(enc expfmt.Encoder, appName string, metrics []provision.UnitMetric) error {
+	families := []struct {
+		name        string
+		help        string
+		kind        dto.MetricType
+		value       func(provision.UnitMetric) float64
+		withErrored bool
+	}{
+		{"tsuru_app_unit_cpu_percent", "CPU usage of the unit in percent of one core.", dto.MetricType_GAUGE,
+			func(m provision.UnitMetric) float64 { return m.CPU }, false},
+		{"tsuru_app_unit_memory_bytes", "Memory used by the unit in bytes.", dto.MetricType_GAUGE,
+			func(m provision.UnitMetric) float64 { return float64(m.Memory) }, false},
+		{"tsuru_app_unit_network_receive_bytes_total", "Bytes received by the unit.", dto.MetricType_COUNTER,
+			func(m provision.UnitMetric) float64 { return float64(m.NetworkRx) }, false},
+		{"tsuru_app_unit_network_transmit_bytes_total", "Bytes transmitted by the unit.", dto.MetricType_COUNTER,
+			func(m provision.UnitMetric) float64 { return float64(m.NetworkTx) }, false},
+		{"tsuru_app_unit_restarts_total", "Number of restarts of the unit.", dto.MetricType_COUNTER,
+			func(m provision.UnitMetric) float64 { return float64(m.Restarts) }, false},
+		{"tsuru_app_unit_metrics_error", "Whether the metrics of the unit couldn't be collected.", dto.MetricType_GAUGE,
+			func(m provision.UnitMetric) float64 {
+				if m.Error != "" {
+					return 1
+				}
+				return 0
+			}, true},
+	}
+	for _, f := range families {
+		family := &dto.MetricFamily{
+			Name: proto.String(f.name),
+			Help: proto.String(f.help),
+			Type: f.kind.Enum(),
+		}
+		for _, m := range metrics {
+			if m.Error != "" && !f.withErrored {
+				continue
+			}
+			metric := &dto.Metric{
+				Label: []*dto.LabelPair{
+					{Name: proto.String("app"), Value: proto.String(appName)},
+					{Name: proto.String("process"), Value: proto.String(m.Process)},
+					{Name: proto.String("unit"), Value: proto.String(m.ID)},
+				},
+			}
+			if f.kind == dto.MetricType_COUNTER {
+				metric.Counter = &dto.Counter{Value: proto.Float64(f.value(m))}
+			} else {
+				metric.Gauge = &dto.Gauge{Value: proto.Float64(f.value(m))}
+			}
+			family.Metric = append(family.Metric, metric)
+		}
+		err := enc.Encode(family)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // title: rebuild routes
 // path: /apps/{app}/routes
 // method: POST
@@ -1915,6 +2257,7 @@ func unsetCertificate(w http.ResponseWriter, r *http.Request, t auth.Token) (err
 // path: /apps/{app}/certificate
 // method: GET
 // consume: application/x-www-form-urlencoded
+// produce: application/json
 // responses:
 //   200: Ok
 //   401: Unauthorized
@@ -1935,9 +2278,37 @@ func listCertificates(w http.ResponseWriter, r *http.Request, t auth.Token) erro
 	if err != nil {
 		return err
 	}
+	if details, _ := strconv.ParseBool(r.URL.Query().Get("details")); details {
+		return json.NewEncoder(w).Encode(certificatesDetails(&a, result))
+	}
 	return json.NewEncoder(w).Encode(&result)
 }
 
+type certificateDetails struct {
+	Certificate string    `json:"certificate"`
+	DNSNames    []string  `json:"dnsnames,omitempty"`
+	NotAfter    time.Time `json:"notafter"`
+	Expired     bool      `json:"expired"`
+}
+
+func certificatesDetails(a *app.App, certs map[string]map[string]string) map[string]map[string]certificateDetails {
+	now := time.Now()
+	result := make(map[string]map[string]certificateDetails, len(certs))
+	for routerName, routerCerts := range certs {
+		result[routerName] = make(map[string]certificateDetails, len(routerCerts))
+		for name, data := range routerCerts {
+			details := certificateDetails{Certificate: data}
+			if info, ok := a.GetCertificateInfo(name); ok && data != "" {
+				details.DNSNames = info.DNSNames
+				details.NotAfter = info.NotAfter
+				details.Expired = info.Expired(now)
+			}
+			result[routerName][name] = details
+		}
+	}
+	return result
+}
+
 func contextsForApp(a *app.App) []permission.PermissionContext {
 	return append(permission.Contexts(permission.CtxTeam, a.Teams),
 		permission.Context(permission.CtxApp, a.Name),
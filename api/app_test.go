@@ -25,6 +25,7 @@ import (
 	"github.com/tsuru/config"
 	"github.com/tsuru/tsuru/app"
 	"github.com/tsuru/tsuru/app/bind"
+	"github.com/tsuru/tsuru/app/image"
 	"github.com/tsuru/tsuru/auth"
 	"github.com/tsuru/tsuru/db"
 	"github.com/tsuru/tsuru/errors"
@@ -2147,6 +2148,240 @@ func (s *S) TestRemoveUnitsReturns400IfNumberIsInvalid(c *check.C) {
 	}
 }
 
+func (s *S) createAutoScaleApp(c *check.C) *app.App {
+	a := app.App{Name: "armorandsword", Platform: "zend", TeamOwner: s.team.Name}
+	err := app.CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	err = image.SaveImageCustomData("tsuru/app-armorandsword:v1", map[string]interface{}{
+		"processes": map[string]interface{}{"web": "run web", "worker": "run worker"},
+	})
+	c.Assert(err, check.IsNil)
+	err = image.AppendAppImageName(a.Name, "tsuru/app-armorandsword:v1")
+	c.Assert(err, check.IsNil)
+	return &a
+}
+
+func (s *S) TestSetUnitsAutoScale(c *check.C) {
+	a := s.createAutoScaleApp(c)
+	body := strings.NewReader("process=worker&minUnits=1&maxUnits=5&targetCPU=70")
+	request, err := http.NewRequest("PUT", "/apps/armorandsword/units/autoscale", body)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Authorization", "b "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	s.testServer.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	dbApp, err := app.GetByName(a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(dbApp.AutoScale, check.DeepEquals, []provision.AutoScaleSpec{
+		{Process: "worker", MinUnits: 1, MaxUnits: 5, TargetCPU: 70},
+	})
+	c.Assert(eventtest.EventDesc{
+		Target: appTarget(a.Name),
+		Owner:  s.token.GetUserName(),
+		Kind:   "app.update.unit.autoscale",
+		StartCustomData: []map[string]interface{}{
+			{"name": "process", "value": "worker"},
+			{"name": "minUnits", "value": "1"},
+			{"name": "maxUnits", "value": "5"},
+			{"name": "targetCPU", "value": "70"},
+		},
+	}, eventtest.HasEvent)
+}
+
+func (s *S) TestSetUnitsAutoScaleInvalid(c *check.C) {
+	s.createAutoScaleApp(c)
+	body := strings.NewReader("process=worker&minUnits=3&maxUnits=2&targetCPU=70")
+	request, err := http.NewRequest("PUT", "/apps/armorandsword/units/autoscale", body)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Authorization", "b "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	s.testServer.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusBadRequest)
+	c.Assert(recorder.Body.String(), check.Equals, app.ErrInvalidAutoScaleUnits.Error()+"\n")
+}
+
+func (s *S) TestSetUnitsAutoScaleWithoutPermission(c *check.C) {
+	s.createAutoScaleApp(c)
+	token := userWithPermission(c, permission.Permission{
+		Scheme:  permission.PermAppUpdateUnitAutoscale,
+		Context: permission.Context(permission.CtxApp, "-invalid-"),
+	})
+	body := strings.NewReader("process=worker&minUnits=1&maxUnits=5&targetCPU=70")
+	request, err := http.NewRequest("PUT", "/apps/armorandsword/units/autoscale", body)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Authorization", "b "+token.GetValue())
+	recorder := httptest.NewRecorder()
+	s.testServer.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusForbidden)
+}
+
+func (s *S) TestRemoveUnitsAutoScale(c *check.C) {
+	a := s.createAutoScaleApp(c)
+	err := a.SetAutoScale(provision.AutoScaleSpec{Process: "worker", MinUnits: 1, MaxUnits: 5, TargetCPU: 70})
+	c.Assert(err, check.IsNil)
+	request, err := http.NewRequest("DELETE", "/apps/armorandsword/units/autoscale?process=worker", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "b "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	s.testServer.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	dbApp, err := app.GetByName(a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(dbApp.AutoScale, check.IsNil)
+	c.Assert(eventtest.EventDesc{
+		Target: appTarget(a.Name),
+		Owner:  s.token.GetUserName(),
+		Kind:   "app.update.unit.autoscale",
+		StartCustomData: []map[string]interface{}{
+			{"name": "process", "value": "worker"},
+		},
+	}, eventtest.HasEvent)
+}
+
+func (s *S) TestRemoveUnitsAutoScaleNotFound(c *check.C) {
+	s.createAutoScaleApp(c)
+	request, err := http.NewRequest("DELETE", "/apps/armorandsword/units/autoscale?process=worker", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "b "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	s.testServer.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusNotFound)
+	c.Assert(recorder.Body.String(), check.Equals, app.ErrAutoScaleNotFound.Error()+"\n")
+}
+
+func (s *S) TestListCronJobs(c *check.C) {
+	a := app.App{Name: "cron-app", Platform: "zend", TeamOwner: s.team.Name}
+	err := app.CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	err = a.SetCronJob(provision.CronJob{Name: "report", Schedule: "0 * * * *", Command: "./report"})
+	c.Assert(err, check.IsNil)
+	request, err := http.NewRequest("GET", "/apps/cron-app/cron", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "b "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	s.testServer.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	c.Assert(recorder.Header().Get("Content-Type"), check.Equals, "application/json")
+	var jobs []provision.CronJob
+	err = json.Unmarshal(recorder.Body.Bytes(), &jobs)
+	c.Assert(err, check.IsNil)
+	c.Assert(jobs, check.DeepEquals, []provision.CronJob{
+		{Name: "report", Schedule: "0 * * * *", Command: "./report", ConcurrencyPolicy: "forbid"},
+	})
+}
+
+func (s *S) TestListCronJobsEmpty(c *check.C) {
+	a := app.App{Name: "cron-app", Platform: "zend", TeamOwner: s.team.Name}
+	err := app.CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	request, err := http.NewRequest("GET", "/apps/cron-app/cron", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "b "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	s.testServer.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusNoContent)
+}
+
+func (s *S) TestSetCronJob(c *check.C) {
+	a := app.App{Name: "cron-app", Platform: "zend", TeamOwner: s.team.Name}
+	err := app.CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	body := strings.NewReader("name=report&schedule=*/10+*+*+*+*&command=./report&concurrency_policy=allow")
+	request, err := http.NewRequest("PUT", "/apps/cron-app/cron", body)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Authorization", "b "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	s.testServer.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	dbApp, err := app.GetByName(a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(dbApp.CronJobs, check.DeepEquals, []provision.CronJob{
+		{Name: "report", Schedule: "*/10 * * * *", Command: "./report", ConcurrencyPolicy: "allow"},
+	})
+	c.Assert(eventtest.EventDesc{
+		Target: appTarget(a.Name),
+		Owner:  s.token.GetUserName(),
+		Kind:   "app.update.cron.set",
+		StartCustomData: []map[string]interface{}{
+			{"name": "name", "value": "report"},
+			{"name": "schedule", "value": "*/10 * * * *"},
+			{"name": "command", "value": "./report"},
+		},
+	}, eventtest.HasEvent)
+}
+
+func (s *S) TestSetCronJobInvalid(c *check.C) {
+	a := app.App{Name: "cron-app", Platform: "zend", TeamOwner: s.team.Name}
+	err := app.CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	body := strings.NewReader("name=report&schedule=never&command=./report")
+	request, err := http.NewRequest("PUT", "/apps/cron-app/cron", body)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Authorization", "b "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	s.testServer.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusBadRequest)
+	c.Assert(recorder.Body.String(), check.Equals, `invalid schedule "never": expected 5 fields, got 1`+"\n")
+}
+
+func (s *S) TestSetCronJobWithoutPermission(c *check.C) {
+	a := app.App{Name: "cron-app", Platform: "zend", TeamOwner: s.team.Name}
+	err := app.CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	token := userWithPermission(c, permission.Permission{
+		Scheme:  permission.PermAppUpdateCronSet,
+		Context: permission.Context(permission.CtxApp, "-invalid-"),
+	})
+	body := strings.NewReader("name=report&schedule=@daily&command=./report")
+	request, err := http.NewRequest("PUT", "/apps/cron-app/cron", body)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Authorization", "b "+token.GetValue())
+	recorder := httptest.NewRecorder()
+	s.testServer.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusForbidden)
+}
+
+func (s *S) TestRemoveCronJob(c *check.C) {
+	a := app.App{Name: "cron-app", Platform: "zend", TeamOwner: s.team.Name}
+	err := app.CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	err = a.SetCronJob(provision.CronJob{Name: "report", Schedule: "0 * * * *", Command: "./report"})
+	c.Assert(err, check.IsNil)
+	request, err := http.NewRequest("DELETE", "/apps/cron-app/cron/report", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "b "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	s.testServer.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	dbApp, err := app.GetByName(a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(dbApp.CronJobs, check.IsNil)
+	c.Assert(eventtest.EventDesc{
+		Target: appTarget(a.Name),
+		Owner:  s.token.GetUserName(),
+		Kind:   "app.update.cron.remove",
+	}, eventtest.HasEvent)
+}
+
+func (s *S) TestRemoveCronJobNotFound(c *check.C) {
+	a := app.App{Name: "cron-app", Platform: "zend", TeamOwner: s.team.Name}
+	err := app.CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	request, err := http.NewRequest("DELETE", "/apps/cron-app/cron/report", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "b "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	s.testServer.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusNotFound)
+	c.Assert(recorder.Body.String(), check.Equals, app.ErrCronJobNotFound.Error()+"\n")
+}
+
 func (s *S) TestSetUnitStatus(c *check.C) {
 	a := app.App{Name: "telegram", Platform: "zend", TeamOwner: s.team.Name}
 	err := app.CreateApp(&a, s.user)
@@ -3893,6 +4128,89 @@ func (s *S) TestAppLogReturnsBadRequestIfNumberOfLinesIsNotAnInteger(c *check.C)
 	c.Assert(e.Message, check.Equals, `Parameter "lines" must be an integer.`)
 }
 
+func (s *S) TestAppLogReturnsBadRequestForInvalidSearchParameters(c *check.C) {
+	tests := []struct {
+		query   string
+		message string
+	}{
+		{"query=a(b", `Parameter "query" must be a valid regular expression.`},
+		{"since=yesterday", `Parameter "since" must be a date in RFC 3339 format.`},
+		{"until=2018-01-02", `Parameter "until" must be a date in RFC 3339 format.`},
+		{"until=2018-01-02T10:00:00Z&follow=1", `Parameter "follow" cannot be used with "until" or "cursor".`},
+		{"cursor=abc&follow=1", `Parameter "follow" cannot be used with "until" or "cursor".`},
+	}
+	for _, tt := range tests {
+		url := "/apps/something/log/?:app=doesntmatter&lines=10&" + tt.query
+		request, err := http.NewRequest("GET", url, nil)
+		c.Assert(err, check.IsNil)
+		recorder := httptest.NewRecorder()
+		err = appLog(recorder, request, s.token)
+		c.Assert(err, check.NotNil)
+		e, ok := err.(*errors.HTTP)
+		c.Assert(ok, check.Equals, true)
+		c.Assert(e.Code, check.Equals, http.StatusBadRequest)
+		c.Assert(e.Message, check.Equals, tt.message)
+	}
+}
+
+func (s *S) TestAppLogSearch(c *check.C) {
+	a := app.App{Name: "lost", Platform: "zend", TeamOwner: s.team.Name}
+	err := app.CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	for i := 0; i < 5; i++ {
+		err = a.Log(fmt.Sprintf("request %d failed", i), "web", "unit1")
+		c.Assert(err, check.IsNil)
+		err = a.Log(fmt.Sprintf("request %d ok", i), "web", "unit1")
+		c.Assert(err, check.IsNil)
+	}
+	token := userWithPermission(c, permission.Permission{
+		Scheme:  permission.PermAppReadLog,
+		Context: permission.Context(permission.CtxTeam, s.team.Name),
+	})
+	since := time.Now().Add(-time.Hour).UTC().Format(time.RFC3339)
+	url := fmt.Sprintf("/apps/%s/log/?:app=%s&lines=2&query=fail&since=%s", a.Name, a.Name, since)
+	request, err := http.NewRequest("GET", url, nil)
+	c.Assert(err, check.IsNil)
+	recorder := httptest.NewRecorder()
+	err = appLog(recorder, request, token)
+	c.Assert(err, check.IsNil)
+	var logs []appTypes.Applog
+	err = json.Unmarshal(recorder.Body.Bytes(), &logs)
+	c.Assert(err, check.IsNil)
+	c.Assert(logs, check.HasLen, 2)
+	c.Assert(logs[0].Message, check.Equals, "request 3 failed")
+	c.Assert(logs[1].Message, check.Equals, "request 4 failed")
+	c.Assert(logs[0].Cursor, check.Not(check.Equals), "")
+	url = fmt.Sprintf("/apps/%s/log/?:app=%s&lines=2&query=fail&cursor=%s", a.Name, a.Name, logs[0].Cursor)
+	request, err = http.NewRequest("GET", url, nil)
+	c.Assert(err, check.IsNil)
+	recorder = httptest.NewRecorder()
+	err = appLog(recorder, request, token)
+	c.Assert(err, check.IsNil)
+	logs = nil
+	err = json.Unmarshal(recorder.Body.Bytes(), &logs)
+	c.Assert(err, check.IsNil)
+	c.Assert(logs, check.HasLen, 2)
+	c.Assert(logs[0].Message, check.Equals, "request 1 failed")
+	c.Assert(logs[1].Message, check.Equals, "request 2 failed")
+}
+
+func (s *S) TestAppLogSearchInvalidCursor(c *check.C) {
+	a := app.App{Name: "lost", Platform: "zend", TeamOwner: s.team.Name}
+	err := app.CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	url := fmt.Sprintf("/apps/%s/log/?:app=%s&lines=2&cursor=xyz", a.Name, a.Name)
+	request, err := http.NewRequest("GET", url, nil)
+	c.Assert(err, check.IsNil)
+	recorder := httptest.NewRecorder()
+	err = appLog(recorder, request, s.token)
+	c.Assert(err, check.NotNil)
+	e, ok := err.(*errors.HTTP)
+	c.Assert(ok, check.Equals, true)
+	c.Assert(e.Code, check.Equals, http.StatusBadRequest)
+	c.Assert(e.Message, check.Equals, appTypes.ErrInvalidLogCursor.Error())
+}
+
 type closeableRecorder struct {
 	*httptest.ResponseRecorder
 	ch chan bool
@@ -3923,13 +4241,13 @@ func (s *S) TestAppLogFollow(c *check.C) {
 		splitted := strings.Split(strings.TrimSpace(recorder.Body.String()), "\n")
 		c.Assert(splitted, check.HasLen, 2)
 		c.Assert(splitted[0], check.Equals, "[]")
-		logs := []app.Applog{}
+		logs := []appTypes.Applog{}
 		logErr = json.Unmarshal([]byte(splitted[1]), &logs)
 		c.Assert(logErr, check.IsNil)
 		c.Assert(logs, check.HasLen, 1)
 		c.Assert(logs[0].Message, check.Equals, "x")
 	}()
-	var listener *app.LogListener
+	var listener appTypes.LogWatcher
 	timeout := time.After(5 * time.Second)
 	for listener == nil {
 		select {
@@ -3970,13 +4288,13 @@ func (s *S) TestAppLogFollowWithFilter(c *check.C) {
 		splitted := strings.Split(strings.TrimSpace(recorder.Body.String()), "\n")
 		c.Assert(splitted, check.HasLen, 2)
 		c.Assert(splitted[0], check.Equals, "[]")
-		logs := []app.Applog{}
+		logs := []appTypes.Applog{}
 		logErr = json.Unmarshal([]byte(splitted[1]), &logs)
 		c.Assert(logErr, check.IsNil)
 		c.Assert(logs, check.HasLen, 1)
 		c.Assert(logs[0].Message, check.Equals, "y")
 	}()
-	var listener *app.LogListener
+	var listener appTypes.LogWatcher
 	timeout := time.After(5 * time.Second)
 	for listener == nil {
 		select {
@@ -4033,7 +4351,7 @@ func (s *S) TestAppLogSelectByLines(c *check.C) {
 	err = appLog(recorder, request, token)
 	c.Assert(err, check.IsNil)
 	c.Assert(recorder.Code, check.Equals, http.StatusOK)
-	logs := []app.Applog{}
+	logs := []appTypes.Applog{}
 	err = json.Unmarshal(recorder.Body.Bytes(), &logs)
 	c.Assert(err, check.IsNil)
 	c.Assert(logs, check.HasLen, 10)
@@ -4057,7 +4375,7 @@ func (s *S) TestAppLogSelectBySource(c *check.C) {
 	err = appLog(recorder, request, token)
 	c.Assert(err, check.IsNil)
 	c.Assert(recorder.Code, check.Equals, http.StatusOK)
-	logs := []app.Applog{}
+	logs := []appTypes.Applog{}
 	err = json.Unmarshal(recorder.Body.Bytes(), &logs)
 	c.Assert(err, check.IsNil)
 	c.Assert(logs, check.HasLen, 1)
@@ -4083,7 +4401,7 @@ func (s *S) TestAppLogSelectByUnit(c *check.C) {
 	err = appLog(recorder, request, token)
 	c.Assert(err, check.IsNil)
 	c.Assert(recorder.Code, check.Equals, http.StatusOK)
-	logs := []app.Applog{}
+	logs := []appTypes.Applog{}
 	err = json.Unmarshal(recorder.Body.Bytes(), &logs)
 	c.Assert(err, check.IsNil)
 	c.Assert(logs, check.HasLen, 1)
@@ -4099,7 +4417,7 @@ func (s *S) TestAppLogSelectByLinesShouldReturnTheLastestEntries(c *check.C) {
 	now := time.Now()
 	coll := s.logConn.Logs(a.Name)
 	for i := 0; i < 15; i++ {
-		l := app.Applog{
+		l := appTypes.Applog{
 			Date:    now.Add(time.Duration(i) * time.Hour),
 			Message: strconv.Itoa(i),
 			Source:  "source",
@@ -4119,7 +4437,7 @@ func (s *S) TestAppLogSelectByLinesShouldReturnTheLastestEntries(c *check.C) {
 	err = appLog(recorder, request, token)
 	c.Assert(err, check.IsNil)
 	c.Assert(recorder.Code, check.Equals, http.StatusOK)
-	var logs []app.Applog
+	var logs []appTypes.Applog
 	err = json.Unmarshal(recorder.Body.Bytes(), &logs)
 	c.Assert(err, check.IsNil)
 	c.Assert(logs, check.HasLen, 3)
@@ -4153,7 +4471,7 @@ func (s *S) TestAppLogShouldReturnLogByApp(c *check.C) {
 	err = appLog(recorder, request, token)
 	c.Assert(err, check.IsNil)
 	c.Assert(recorder.Code, check.Equals, http.StatusOK)
-	logs := []app.Applog{}
+	logs := []appTypes.Applog{}
 	err = json.Unmarshal(recorder.Body.Bytes(), &logs)
 	c.Assert(err, check.IsNil)
 	var logged bool
@@ -5238,7 +5556,7 @@ func (s *S) TestSleepHandlerReturns403IfTheUserDoesNotHaveAccessToTheApp(c *chec
 	c.Assert(e.Code, check.Equals, http.StatusForbidden)
 }
 
-type LogList []app.Applog
+type LogList []appTypes.Applog
 
 func (l LogList) Len() int           { return len(l) }
 func (l LogList) Swap(i, j int)      { l[i], l[j] = l[j], l[i] }
@@ -5288,7 +5606,7 @@ func (s *S) TestAddLog(c *check.C) {
 		"mysource",
 		"mysource",
 	}
-	logs, err := a.LastLogs(5, app.Applog{})
+	logs, err := a.LastLogs(5, appTypes.Applog{})
 	c.Assert(err, check.IsNil)
 	got := make([]string, len(logs))
 	gotSource := make([]string, len(logs))
@@ -5828,6 +6146,106 @@ func (s *S) TestMetricEnvsWhenAppDoesNotExist(c *check.C) {
 	c.Assert(recorder.Body.String(), check.Matches, "^App .* not found.\n$")
 }
 
+func (s *S) createMetricsApp(c *check.C) *app.App {
+	a := app.App{Name: "myappx", Platform: "zend", TeamOwner: s.team.Name}
+	err := app.CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	err = a.AddUnits(2, "web", nil)
+	c.Assert(err, check.IsNil)
+	units := s.provisioner.GetUnits(&a)
+	err = s.provisioner.SetUnitMetric(&a, provision.UnitMetric{
+		ID:        units[0].ID,
+		Process:   "web",
+		CPU:       12.5,
+		Memory:    1024,
+		NetworkRx: 10,
+		NetworkTx: 20,
+		Restarts:  1,
+	})
+	c.Assert(err, check.IsNil)
+	return &a
+}
+
+func (s *S) TestAppMetrics(c *check.C) {
+	a := s.createMetricsApp(c)
+	units := s.provisioner.GetUnits(a)
+	request, err := http.NewRequest("GET", "/apps/myappx/metrics", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	s.testServer.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	c.Assert(recorder.Header().Get("Content-Type"), check.Equals, "application/json")
+	var metrics []provision.UnitMetric
+	err = json.NewDecoder(recorder.Body).Decode(&metrics)
+	c.Assert(err, check.IsNil)
+	c.Assert(metrics, check.DeepEquals, []provision.UnitMetric{
+		{ID: units[0].ID, Process: "web", CPU: 12.5, Memory: 1024, NetworkRx: 10, NetworkTx: 20, Restarts: 1},
+		{ID: units[1].ID, Process: "web"},
+	})
+}
+
+func (s *S) TestAppMetricsPrometheusFormat(c *check.C) {
+	a := s.createMetricsApp(c)
+	units := s.provisioner.GetUnits(a)
+	request, err := http.NewRequest("GET", "/apps/myappx/metrics?format=prometheus", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	s.testServer.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	c.Assert(recorder.Header().Get("Content-Type"), check.Equals, "text/plain; version=0.0.4")
+	body := recorder.Body.String()
+	c.Assert(body, check.Matches, `(?s).*# TYPE tsuru_app_unit_cpu_percent gauge\n.*`)
+	c.Assert(body, check.Matches, `(?s).*# TYPE tsuru_app_unit_restarts_total counter\n.*`)
+	c.Assert(body, check.Matches, `(?s).*tsuru_app_unit_memory_bytes\{app="myappx",process="web",unit="`+units[0].ID+`"\} 1024\n.*`)
+	c.Assert(body, check.Matches, `(?s).*tsuru_app_unit_network_receive_bytes_total\{app="myappx",process="web",unit="`+units[1].ID+`"\} 0\n.*`)
+}
+
+func (s *S) TestAppMetricsPrometheusFormatUnitError(c *check.C) {
+	a := s.createMetricsApp(c)
+	units := s.provisioner.GetUnits(a)
+	err := s.provisioner.SetUnitMetric(a, provision.UnitMetric{ID: units[1].ID, Process: "web", Error: "node not found"})
+	c.Assert(err, check.IsNil)
+	request, err := http.NewRequest("GET", "/apps/myappx/metrics?format=prometheus", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	s.testServer.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	body := recorder.Body.String()
+	c.Assert(body, check.Matches, `(?s).*tsuru_app_unit_metrics_error\{app="myappx",process="web",unit="`+units[0].ID+`"\} 0\n.*`)
+	c.Assert(body, check.Matches, `(?s).*tsuru_app_unit_metrics_error\{app="myappx",process="web",unit="`+units[1].ID+`"\} 1\n.*`)
+	c.Assert(body, check.Not(check.Matches), `(?s).*tsuru_app_unit_memory_bytes\{app="myappx",process="web",unit="`+units[1].ID+`"\}.*`)
+}
+
+func (s *S) TestAppMetricsPrometheusAcceptHeader(c *check.C) {
+	s.createMetricsApp(c)
+	request, err := http.NewRequest("GET", "/apps/myappx/metrics", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	request.Header.Set("Accept", "text/plain")
+	recorder := httptest.NewRecorder()
+	s.testServer.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	c.Assert(recorder.Header().Get("Content-Type"), check.Equals, "text/plain; version=0.0.4")
+	c.Assert(recorder.Body.String(), check.Matches, `(?s).*tsuru_app_unit_cpu_percent\{app="myappx",process="web",unit=".*"\} 12.5\n.*`)
+}
+
+func (s *S) TestAppMetricsWhenUserDoesNotHaveAccess(c *check.C) {
+	s.createMetricsApp(c)
+	token := userWithPermission(c, permission.Permission{
+		Scheme:  permission.PermAppReadMetric,
+		Context: permission.Context(permission.CtxApp, "-invalid-"),
+	})
+	request, err := http.NewRequest("GET", "/apps/myappx/metrics", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+token.GetValue())
+	recorder := httptest.NewRecorder()
+	s.testServer.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusForbidden)
+}
+
 func (s *S) TestRebuildRoutes(c *check.C) {
 	a := app.App{Name: "myappx", Platform: "zend", TeamOwner: s.team.Name, Router: "fake"}
 	err := app.CreateApp(&a, s.user)
@@ -6032,3 +6450,27 @@ func (s *S) TestListCertificates(c *check.C) {
 		},
 	})
 }
+
+func (s *S) TestListCertificatesDetails(c *check.C) {
+	a := app.App{Name: "myapp", TeamOwner: s.team.Name, CName: []string{"app.io"}, Router: "fake-tls"}
+	err := app.CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	err = a.SetCertificate("app.io", testCert, testKey)
+	c.Assert(err, check.IsNil)
+	request, err := http.NewRequest("GET", "/apps/myapp/certificate?details=true", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	s.testServer.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	var certs map[string]map[string]certificateDetails
+	err = json.Unmarshal(recorder.Body.Bytes(), &certs)
+	c.Assert(err, check.IsNil)
+	c.Assert(certs, check.HasLen, 1)
+	c.Assert(certs["fake-tls"]["myapp.faketlsrouter.com"], check.DeepEquals, certificateDetails{})
+	details := certs["fake-tls"]["app.io"]
+	c.Assert(details.Certificate, check.Equals, testCert)
+	c.Assert(details.DNSNames, check.DeepEquals, []string{"app.io"})
+	c.Assert(details.NotAfter.Equal(time.Date(2027, 1, 10, 20, 33, 11, 0, time.UTC)), check.Equals, true)
+	c.Assert(details.Expired, check.Equals, false)
+}
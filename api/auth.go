@@ -17,6 +17,7 @@ import (
 	"github.com/tsuru/tsuru/auth"
 	"github.com/tsuru/tsuru/errors"
 	"github.com/tsuru/tsuru/event"
+	"github.com/tsuru/tsuru/event/webhook"
 	"github.com/tsuru/tsuru/log"
 	"github.com/tsuru/tsuru/permission"
 	"github.com/tsuru/tsuru/provision/pool"
@@ -236,10 +237,12 @@ func resetPassword(w http.ResponseWriter, r *http.Request) (err error) {
 
 var teamRenameFns = []func(oldName, newName string) error{
 	app.RenameTeam,
+	app.RenameTeamQuota,
 	service.RenameServiceTeam,
 	service.RenameServiceInstanceTeam,
 	volume.RenameTeam,
 	pool.RenamePoolTeam,
+	webhook.RenameTeam,
 }
 
 // title: team update
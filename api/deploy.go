@@ -80,6 +80,21 @@ func deploy(w http.ResponseWriter, r *http.Request, t auth.Token) (err error) {
 	if origin == "" && commit != "" {
 		origin = "git"
 	}
+	if canary := r.FormValue("canary"); canary != "" {
+		opts.Canary, _ = strconv.ParseBool(canary)
+	}
+	if opts.Canary {
+		opts.CanaryWeight, err = strconv.Atoi(r.FormValue("canary-weight"))
+		if err != nil || opts.CanaryWeight <= 0 || opts.CanaryWeight >= 100 {
+			return &tsuruErrors.HTTP{Code: http.StatusBadRequest, Message: app.ErrInvalidCanaryWeight.Error()}
+		}
+	}
+	if blueGreen := r.FormValue("bluegreen"); blueGreen != "" {
+		opts.BlueGreen, _ = strconv.ParseBool(blueGreen)
+	}
+	if opts.BlueGreen && opts.Canary {
+		return &tsuruErrors.HTTP{Code: http.StatusBadRequest, Message: app.ErrBlueGreenWithCanary.Error()}
+	}
 	opts.App = instance
 	opts.Commit = commit
 	opts.User = userName
@@ -92,6 +107,9 @@ func deploy(w http.ResponseWriter, r *http.Request, t auth.Token) (err error) {
 			return &tsuruErrors.HTTP{Code: http.StatusForbidden, Message: "User does not have permission to do this action in this app"}
 		}
 	}
+	if instance.Canary != nil {
+		return &tsuruErrors.HTTP{Code: http.StatusConflict, Message: app.ErrCanaryRunning.Error()}
+	}
 	var imageID string
 	evt, err := event.New(&event.Opts{
 		Target:        appTarget(appName),
@@ -105,18 +123,49 @@ func deploy(w http.ResponseWriter, r *http.Request, t auth.Token) (err error) {
 	if err != nil {
 		return err
 	}
-	defer func() { evt.DoneCustomData(err, map[string]string{"image": imageID}) }()
+	defer func() { doneDeploy(evt, err, deployEndData(opts, imageID)) }()
 	opts.Event = evt
 	writer := tsuruIo.NewKeepAliveWriter(w, 30*time.Second, "please wait...")
 	defer writer.Stop()
 	opts.OutputStream = writer
 	imageID, err = app.Deploy(opts)
-	if err == nil {
+	if err == nil || err == app.ErrDeployQueued {
 		fmt.Fprintln(w, "\nOK")
+		return nil
 	}
 	return err
 }
 
+// doneDeploy marks the deploy event as done, unless the deploy was queued
+// waiting for approval, which leaves the event running until it's approved.
+func doneDeploy(evt *event.Event, err error, customData interface{}) {
+	if evt.ApprovalInfo.Pending {
+		return
+	}
+	evt.DoneCustomData(err, customData)
+}
+
+// runApprovedDeploy runs a deploy queued waiting for approval after it's
+// approved, its output being available in the event log.
+func runApprovedDeploy(opts app.DeployOptions) {
+	if opts.File != nil {
+		defer opts.File.Close()
+	}
+	imageID, err := app.Deploy(opts)
+	opts.Event.DoneCustomData(err, deployEndData(opts, imageID))
+}
+
+func deployEndData(opts app.DeployOptions, imageID string) map[string]string {
+	data := map[string]string{"image": imageID}
+	if status := opts.CanaryStatus(); status != "" {
+		data["canary"] = status
+	}
+	if (opts.BlueGreen || opts.Rollback) && opts.App != nil && opts.App.BlueGreen != nil {
+		data["shadowImage"] = opts.App.BlueGreen.ShadowImage
+	}
+	return data
+}
+
 func permSchemeForDeploy(opts app.DeployOptions) *permission.PermissionScheme {
 	switch opts.GetKind() {
 	case app.DeployGit:
@@ -131,6 +180,10 @@ func permSchemeForDeploy(opts app.DeployOptions) *permission.PermissionScheme {
 		return permission.PermAppDeployArchiveUrl
 	case app.DeployRollback:
 		return permission.PermAppDeployRollback
+	case app.DeployCanaryPromote, app.DeployCanaryAbort:
+		return permission.PermAppDeployCanary
+	case app.DeployBlueGreen:
+		return permission.PermAppDeployBluegreen
 	default:
 		return permission.PermAppDeploy
 	}
@@ -232,10 +285,10 @@ func deployRollback(w http.ResponseWriter, r *http.Request, t auth.Token) error
 	if err != nil {
 		return err
 	}
-	defer func() { evt.DoneCustomData(err, map[string]string{"image": imageID}) }()
+	defer func() { doneDeploy(evt, err, map[string]string{"image": imageID}) }()
 	opts.Event = evt
 	imageID, err = app.Deploy(opts)
-	if err != nil {
+	if err != nil && err != app.ErrDeployQueued {
 		writer.Encode(tsuruIo.SimpleJsonMessage{Error: err.Error()})
 	}
 	return nil
@@ -352,10 +405,10 @@ func deployRebuild(w http.ResponseWriter, r *http.Request, t auth.Token) error {
 	if err != nil {
 		return err
 	}
-	defer func() { evt.DoneCustomData(err, map[string]string{"image": imageID}) }()
+	defer func() { doneDeploy(evt, err, map[string]string{"image": imageID}) }()
 	opts.Event = evt
 	imageID, err = app.Deploy(opts)
-	if err != nil {
+	if err != nil && err != app.ErrDeployQueued {
 		writer.Encode(tsuruIo.SimpleJsonMessage{Error: err.Error()})
 	}
 	return nil
@@ -429,3 +482,106 @@ func deployRollbackUpdate(w http.ResponseWriter, r *http.Request, t auth.Token)
 	}
 	return err
 }
+
+// title: deploy approval update
+// path: /apps/{appname}/deploy/approval
+// method: PUT
+// consume: application/x-www-form-urlencoded
+// responses:
+//   200: Deploy approval updated
+//   400: Invalid data
+//   403: Forbidden
+//   404: App not found
+func deployApprovalUpdate(w http.ResponseWriter, r *http.Request, t auth.Token) (err error) {
+	appName := r.URL.Query().Get(":appname")
+	instance, err := app.GetByName(appName)
+	if err != nil {
+		return &tsuruErrors.HTTP{Code: http.StatusNotFound, Message: fmt.Sprintf("App %s not found.", appName)}
+	}
+	if !permission.Check(t, permission.PermAppAdminDeployApproval, contextsForApp(instance)...) {
+		return &tsuruErrors.HTTP{
+			Code:    http.StatusForbidden,
+			Message: "User does not have permission to do this action in this app",
+		}
+	}
+	required, err := strconv.ParseBool(r.FormValue("required"))
+	if err != nil {
+		return &tsuruErrors.HTTP{
+			Code:    http.StatusBadRequest,
+			Message: fmt.Sprintf("Cannot set 'required' status to: '%s', instead of 'true' or 'false'", r.FormValue("required")),
+		}
+	}
+	evt, err := event.New(&event.Opts{
+		Target:     appTarget(appName),
+		Kind:       permission.PermAppAdminDeployApproval,
+		Owner:      t,
+		CustomData: event.FormToCustomData(r.Form),
+		Allowed:    event.Allowed(permission.PermAppReadEvents, contextsForApp(instance)...),
+	})
+	if err != nil {
+		return err
+	}
+	defer func() { evt.Done(err) }()
+	return instance.SetDeployApproval(required)
+}
+
+// title: finish canary deploy
+// path: /apps/{appname}/deploy/canary/{action}
+// method: POST
+// consume: application/x-www-form-urlencoded
+// produce: application/x-json-stream
+// responses:
+//   200: OK
+//   403: Forbidden
+//   404: Not found
+//   409: No canary running
+func deployCanaryFinish(w http.ResponseWriter, r *http.Request, t auth.Token) error {
+	appName := r.URL.Query().Get(":appname")
+	opts := app.DeployOptions{User: t.GetUserName()}
+	switch action := r.URL.Query().Get(":action"); action {
+	case "promote":
+		opts.Promote = true
+	case "abort":
+		opts.Abort = true
+	default:
+		return &tsuruErrors.HTTP{Code: http.StatusNotFound, Message: fmt.Sprintf("Unknown canary action %q.", action)}
+	}
+	instance, err := app.GetByName(appName)
+	if err != nil {
+		return &tsuruErrors.HTTP{Code: http.StatusNotFound, Message: fmt.Sprintf("App %s not found.", appName)}
+	}
+	opts.App = instance
+	opts.GetKind()
+	canFinish := permission.Check(t, permSchemeForDeploy(opts), contextsForApp(instance)...)
+	if !canFinish {
+		return &tsuruErrors.HTTP{Code: http.StatusForbidden, Message: permission.ErrUnauthorized.Error()}
+	}
+	if instance.Canary == nil {
+		return &tsuruErrors.HTTP{Code: http.StatusConflict, Message: app.ErrNoCanaryRunning.Error()}
+	}
+	w.Header().Set("Content-Type", "application/x-json-stream")
+	keepAliveWriter := tsuruIo.NewKeepAliveWriter(w, 30*time.Second, "")
+	defer keepAliveWriter.Stop()
+	writer := &tsuruIo.SimpleJsonMessageEncoderWriter{Encoder: json.NewEncoder(keepAliveWriter)}
+	opts.OutputStream = writer
+	var imageID string
+	evt, err := event.New(&event.Opts{
+		Target:        appTarget(appName),
+		Kind:          permission.PermAppDeploy,
+		Owner:         t,
+		CustomData:    opts,
+		Allowed:       event.Allowed(permission.PermAppReadEvents, contextsForApp(instance)...),
+		AllowedCancel: event.Allowed(permission.PermAppUpdateEvents, contextsForApp(instance)...),
+		Cancelable:    true,
+	})
+	if err != nil {
+		return err
+	}
+	defer func() { doneDeploy(evt, err, deployEndData(opts, imageID)) }()
+	opts.Event = evt
+	imageID, err = app.Deploy(opts)
+	if err != nil && err != app.ErrDeployQueued {
+		writer.Encode(tsuruIo.SimpleJsonMessage{Error: err.Error()})
+	}
+	return nil
+}
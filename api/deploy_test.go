@@ -1562,3 +1562,459 @@ func (s *DeploySuite) TestRollbackUpdateErrNoPerms(c *check.C) {
 	c.Assert(recorder.Body.String(), check.Equals, "User does not have permission to do this action in this app\n")
 	c.Assert(recorder.Code, check.Equals, http.StatusForbidden)
 }
+
+func (s *DeploySuite) TestDeployApprovalUpdate(c *check.C) {
+	a := app.App{Name: "otherapp", TeamOwner: s.team.Name}
+	err := app.CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	v := url.Values{}
+	v.Set("required", "true")
+	u := fmt.Sprintf("/apps/%s/deploy/approval", a.Name)
+	request, err := http.NewRequest(http.MethodPut, u, strings.NewReader(v.Encode()))
+	c.Assert(err, check.IsNil)
+	_, token := permissiontest.CustomUserWithPermission(c, nativeScheme, "myadmin", permission.Permission{
+		Scheme:  permission.PermAppAdminDeployApproval,
+		Context: permission.Context(permission.CtxGlobal, ""),
+	})
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Authorization", "bearer "+token.GetValue())
+	server := RunServer(true)
+	recorder := httptest.NewRecorder()
+	server.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	dbApp, err := app.GetByName(a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(dbApp.DeployApproval, check.Equals, true)
+	c.Assert(eventtest.EventDesc{
+		Target: appTarget(a.Name),
+		Owner:  token.GetUserName(),
+		Kind:   "app.admin.deploy-approval",
+		StartCustomData: []map[string]interface{}{
+			{"name": ":appname", "value": a.Name},
+			{"name": "required", "value": "true"},
+		},
+	}, eventtest.HasEvent)
+}
+
+func (s *DeploySuite) TestDeployApprovalUpdateInvalidValue(c *check.C) {
+	a := app.App{Name: "otherapp", TeamOwner: s.team.Name}
+	err := app.CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	u := fmt.Sprintf("/apps/%s/deploy/approval", a.Name)
+	request, err := http.NewRequest(http.MethodPut, u, strings.NewReader("required=maybe"))
+	c.Assert(err, check.IsNil)
+	_, token := permissiontest.CustomUserWithPermission(c, nativeScheme, "myadmin", permission.Permission{
+		Scheme:  permission.PermAppAdminDeployApproval,
+		Context: permission.Context(permission.CtxGlobal, ""),
+	})
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Authorization", "bearer "+token.GetValue())
+	server := RunServer(true)
+	recorder := httptest.NewRecorder()
+	server.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusBadRequest)
+	c.Assert(recorder.Body.String(), check.Equals, "Cannot set 'required' status to: 'maybe', instead of 'true' or 'false'\n")
+}
+
+func (s *DeploySuite) TestDeployApprovalUpdateWithoutPermission(c *check.C) {
+	a := app.App{Name: "otherapp", TeamOwner: s.team.Name}
+	err := app.CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	u := fmt.Sprintf("/apps/%s/deploy/approval", a.Name)
+	request, err := http.NewRequest(http.MethodPut, u, strings.NewReader("required=false"))
+	c.Assert(err, check.IsNil)
+	_, token := permissiontest.CustomUserWithPermission(c, nativeScheme, "deployer", permission.Permission{
+		Scheme:  permission.PermAppDeploy,
+		Context: permission.Context(permission.CtxGlobal, ""),
+	})
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Authorization", "bearer "+token.GetValue())
+	server := RunServer(true)
+	recorder := httptest.NewRecorder()
+	server.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusForbidden)
+	c.Assert(recorder.Body.String(), check.Equals, "User does not have permission to do this action in this app\n")
+}
+
+func (s *DeploySuite) TestDeployCanary(c *check.C) {
+	a := app.App{Name: "otherapp", Platform: "python", TeamOwner: s.team.Name}
+	err := app.CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	s.builder.OnBuild = func(p provision.BuilderDeploy, app provision.App, evt *event.Event, opts *builder.BuildOpts) (string, error) {
+		return "app-image-canary", nil
+	}
+	v := url.Values{}
+	v.Set("image", "some-image")
+	v.Set("canary", "true")
+	v.Set("canary-weight", "20")
+	u := fmt.Sprintf("/apps/%s/deploy", a.Name)
+	request, err := http.NewRequest("POST", u, strings.NewReader(v.Encode()))
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	server := RunServer(true)
+	server.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	c.Assert(recorder.Body.String(), check.Equals, "Canary deploy called\nOK\n")
+	canaryImg, weight := s.provisioner.Canary(&a)
+	c.Assert(canaryImg, check.Equals, "app-image-canary")
+	c.Assert(weight, check.Equals, 20)
+	c.Assert(eventtest.EventDesc{
+		Target: appTarget(a.Name),
+		Owner:  s.token.GetUserName(),
+		Kind:   "app.deploy",
+		StartCustomData: map[string]interface{}{
+			"app.name":     a.Name,
+			"kind":         "image",
+			"image":        "some-image",
+			"canary":       true,
+			"canaryweight": 20,
+		},
+		EndCustomData: map[string]interface{}{
+			"image":  "app-image-canary",
+			"canary": "running",
+		},
+	}, eventtest.HasEvent)
+}
+
+func (s *DeploySuite) TestDeployCanaryInvalidWeight(c *check.C) {
+	a := app.App{Name: "otherapp", Platform: "python", TeamOwner: s.team.Name}
+	err := app.CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	v := url.Values{}
+	v.Set("image", "some-image")
+	v.Set("canary", "true")
+	v.Set("canary-weight", "100")
+	u := fmt.Sprintf("/apps/%s/deploy", a.Name)
+	request, err := http.NewRequest("POST", u, strings.NewReader(v.Encode()))
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	server := RunServer(true)
+	server.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusBadRequest)
+	c.Assert(recorder.Body.String(), check.Equals, app.ErrInvalidCanaryWeight.Error()+"\n")
+}
+
+func (s *DeploySuite) TestDeployWithCanaryRunning(c *check.C) {
+	a := app.App{Name: "otherapp", Platform: "python", TeamOwner: s.team.Name}
+	err := app.CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	err = s.conn.Apps().Update(bson.M{"name": a.Name}, bson.M{"$set": bson.M{"canary": app.AppCanary{Image: "app-image-canary", Weight: 10}}})
+	c.Assert(err, check.IsNil)
+	v := url.Values{}
+	v.Set("image", "some-image")
+	u := fmt.Sprintf("/apps/%s/deploy", a.Name)
+	request, err := http.NewRequest("POST", u, strings.NewReader(v.Encode()))
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	server := RunServer(true)
+	server.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusConflict)
+	c.Assert(recorder.Body.String(), check.Equals, app.ErrCanaryRunning.Error()+"\n")
+}
+
+func (s *DeploySuite) TestDeployCanaryPromote(c *check.C) {
+	a := app.App{Name: "otherapp", Platform: "python", TeamOwner: s.team.Name}
+	err := app.CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	err = s.conn.Apps().Update(bson.M{"name": a.Name}, bson.M{"$set": bson.M{"canary": app.AppCanary{Image: "app-image-canary", Weight: 10}}})
+	c.Assert(err, check.IsNil)
+	u := fmt.Sprintf("/apps/%s/deploy/canary/promote", a.Name)
+	request, err := http.NewRequest("POST", u, nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	server := RunServer(true)
+	server.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	c.Assert(recorder.Header().Get("Content-Type"), check.Equals, "application/x-json-stream")
+	c.Assert(recorder.Body.String(), check.Equals, "{\"Message\":\"Promote canary called\"}\n")
+	dbApp, err := app.GetByName(a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(dbApp.Canary, check.IsNil)
+	c.Assert(eventtest.EventDesc{
+		Target: appTarget(a.Name),
+		Owner:  s.token.GetUserName(),
+		Kind:   "app.deploy",
+		StartCustomData: map[string]interface{}{
+			"app.name": a.Name,
+			"kind":     "canary-promote",
+			"promote":  true,
+		},
+		EndCustomData: map[string]interface{}{
+			"image":  "app-image-canary",
+			"canary": "promoted",
+		},
+	}, eventtest.HasEvent)
+}
+
+func (s *DeploySuite) TestDeployCanaryPromoteFailure(c *check.C) {
+	a := app.App{Name: "otherapp", Platform: "python", TeamOwner: s.team.Name}
+	err := app.CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	err = s.conn.Apps().Update(bson.M{"name": a.Name}, bson.M{"$set": bson.M{"canary": app.AppCanary{Image: "app-image-canary", Weight: 10}}})
+	c.Assert(err, check.IsNil)
+	s.provisioner.PrepareFailure("PromoteCanary", fmt.Errorf("promote failed"))
+	u := fmt.Sprintf("/apps/%s/deploy/canary/promote", a.Name)
+	request, err := http.NewRequest("POST", u, nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	server := RunServer(true)
+	server.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	c.Assert(recorder.Body.String(), check.Matches, `(?s).*promote failed.*`)
+	dbApp, err := app.GetByName(a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(dbApp.Canary, check.NotNil)
+	c.Assert(eventtest.EventDesc{
+		Target: appTarget(a.Name),
+		Owner:  s.token.GetUserName(),
+		Kind:   "app.deploy",
+		StartCustomData: map[string]interface{}{
+			"app.name": a.Name,
+			"kind":     "canary-promote",
+			"promote":  true,
+		},
+		ErrorMatches: `.*promote failed.*`,
+	}, eventtest.HasEvent)
+}
+
+func (s *DeploySuite) TestDeployCanaryAbort(c *check.C) {
+	a := app.App{Name: "otherapp", Platform: "python", TeamOwner: s.team.Name}
+	err := app.CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	err = s.conn.Apps().Update(bson.M{"name": a.Name}, bson.M{"$set": bson.M{"canary": app.AppCanary{Image: "app-image-canary", Weight: 10}}})
+	c.Assert(err, check.IsNil)
+	u := fmt.Sprintf("/apps/%s/deploy/canary/abort", a.Name)
+	request, err := http.NewRequest("POST", u, nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	server := RunServer(true)
+	server.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	c.Assert(recorder.Body.String(), check.Equals, "{\"Message\":\"Abort canary called\"}\n")
+	dbApp, err := app.GetByName(a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(dbApp.Canary, check.IsNil)
+	c.Assert(eventtest.EventDesc{
+		Target: appTarget(a.Name),
+		Owner:  s.token.GetUserName(),
+		Kind:   "app.deploy",
+		StartCustomData: map[string]interface{}{
+			"app.name": a.Name,
+			"kind":     "canary-abort",
+			"abort":    true,
+		},
+		EndCustomData: map[string]interface{}{
+			"canary": "aborted",
+		},
+	}, eventtest.HasEvent)
+}
+
+func (s *DeploySuite) TestDeployCanaryAbortWithoutCanary(c *check.C) {
+	a := app.App{Name: "otherapp", Platform: "python", TeamOwner: s.team.Name}
+	err := app.CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	u := fmt.Sprintf("/apps/%s/deploy/canary/abort", a.Name)
+	request, err := http.NewRequest("POST", u, nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	server := RunServer(true)
+	server.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusConflict)
+	c.Assert(recorder.Body.String(), check.Equals, app.ErrNoCanaryRunning.Error()+"\n")
+}
+
+func (s *DeploySuite) TestDeployCanaryUnknownAction(c *check.C) {
+	a := app.App{Name: "otherapp", Platform: "python", TeamOwner: s.team.Name}
+	err := app.CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	u := fmt.Sprintf("/apps/%s/deploy/canary/rollback", a.Name)
+	request, err := http.NewRequest("POST", u, nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	server := RunServer(true)
+	server.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusNotFound)
+	c.Assert(recorder.Body.String(), check.Equals, "Unknown canary action \"rollback\".\n")
+}
+
+func (s *DeploySuite) TestDeployCanaryPromoteWithoutPermission(c *check.C) {
+	a := app.App{Name: "otherapp", Platform: "python", TeamOwner: s.team.Name}
+	err := app.CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	_, token := permissiontest.CustomUserWithPermission(c, nativeScheme, "myuser", permission.Permission{
+		Scheme:  permission.PermAppDeployRollback,
+		Context: permission.Context(permission.CtxApp, a.Name),
+	})
+	u := fmt.Sprintf("/apps/%s/deploy/canary/promote", a.Name)
+	request, err := http.NewRequest("POST", u, nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+token.GetValue())
+	recorder := httptest.NewRecorder()
+	server := RunServer(true)
+	server.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusForbidden)
+}
+
+func (s *DeploySuite) TestDeployBlueGreen(c *check.C) {
+	a := app.App{Name: "otherapp", Platform: "python", TeamOwner: s.team.Name}
+	err := app.CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	err = s.provisioner.AddUnits(&a, 1, "web", nil)
+	c.Assert(err, check.IsNil)
+	err = s.conn.Apps().Update(bson.M{"name": a.Name}, bson.M{"$set": bson.M{"deploys": 1}})
+	c.Assert(err, check.IsNil)
+	s.builder.OnBuild = func(p provision.BuilderDeploy, app provision.App, evt *event.Event, opts *builder.BuildOpts) (string, error) {
+		return "app-image-green", nil
+	}
+	v := url.Values{}
+	v.Set("image", "some-image")
+	v.Set("bluegreen", "true")
+	u := fmt.Sprintf("/apps/%s/deploy", a.Name)
+	request, err := http.NewRequest("POST", u, strings.NewReader(v.Encode()))
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	server := RunServer(true)
+	server.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	c.Assert(recorder.Body.String(), check.Matches, `(?s)Shadow deploy called.*Switch shadow called\nOK\n`)
+	shadowUnits, _ := s.provisioner.Shadow(&a)
+	c.Assert(shadowUnits, check.HasLen, 1)
+	c.Assert(eventtest.EventDesc{
+		Target: appTarget(a.Name),
+		Owner:  s.token.GetUserName(),
+		Kind:   "app.deploy",
+		StartCustomData: map[string]interface{}{
+			"app.name":  a.Name,
+			"kind":      "bluegreen",
+			"image":     "some-image",
+			"bluegreen": true,
+		},
+		EndCustomData: map[string]interface{}{
+			"image":       "app-image-green",
+			"shadowImage": "",
+		},
+	}, eventtest.HasEvent)
+}
+
+func (s *DeploySuite) TestDeployBlueGreenWithCanary(c *check.C) {
+	a := app.App{Name: "otherapp", Platform: "python", TeamOwner: s.team.Name}
+	err := app.CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	v := url.Values{}
+	v.Set("image", "some-image")
+	v.Set("bluegreen", "true")
+	v.Set("canary", "true")
+	v.Set("canary-weight", "20")
+	u := fmt.Sprintf("/apps/%s/deploy", a.Name)
+	request, err := http.NewRequest("POST", u, strings.NewReader(v.Encode()))
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	server := RunServer(true)
+	server.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusBadRequest)
+	c.Assert(recorder.Body.String(), check.Equals, app.ErrBlueGreenWithCanary.Error()+"\n")
+}
+
+func (s *DeploySuite) TestDeployBlueGreenWithoutPermission(c *check.C) {
+	a := app.App{Name: "otherapp", Platform: "python", TeamOwner: s.team.Name}
+	err := app.CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	_, token := permissiontest.CustomUserWithPermission(c, nativeScheme, "myuser", permission.Permission{
+		Scheme:  permission.PermAppDeployImage,
+		Context: permission.Context(permission.CtxApp, a.Name),
+	})
+	v := url.Values{}
+	v.Set("image", "some-image")
+	v.Set("bluegreen", "true")
+	u := fmt.Sprintf("/apps/%s/deploy", a.Name)
+	request, err := http.NewRequest("POST", u, strings.NewReader(v.Encode()))
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Authorization", "bearer "+token.GetValue())
+	recorder := httptest.NewRecorder()
+	server := RunServer(true)
+	server.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusForbidden)
+}
+
+func (s *DeploySuite) TestDeployQueuedWaitingApproval(c *check.C) {
+	var builderCalled bool
+	s.builder.OnBuild = func(p provision.BuilderDeploy, app provision.App, evt *event.Event, opts *builder.BuildOpts) (string, error) {
+		builderCalled = true
+		return "tsuruteam/app-otherapp:mytag", nil
+	}
+	a := app.App{Name: "otherapp", Platform: "python", TeamOwner: s.team.Name, DeployApproval: true}
+	err := app.CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	url := fmt.Sprintf("/apps/%s/deploy?origin=app-deploy", a.Name)
+	request, err := http.NewRequest("POST", url, strings.NewReader("image=127.0.0.1:5000/tsuru/otherapp"))
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	server := RunServer(true)
+	server.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	c.Assert(recorder.Body.String(), check.Matches, `(?s).*queued waiting for approval.*OK\n`)
+	evts, err := event.List(&event.Filter{PendingOnly: true})
+	c.Assert(err, check.IsNil)
+	c.Assert(evts, check.HasLen, 1)
+	c.Assert(evts[0].Running, check.Equals, true)
+	c.Assert(builderCalled, check.Equals, false)
+	locker, err := event.New(&event.Opts{
+		Target:  appTarget(a.Name),
+		Kind:    permission.PermAppUpdateEnvSet,
+		Owner:   s.token,
+		Allowed: event.Allowed(permission.PermAppReadEvents),
+	})
+	c.Assert(err, check.IsNil)
+	err = locker.Done(nil)
+	c.Assert(err, check.IsNil)
+	_, token := permissiontest.CustomUserWithPermission(c, nativeScheme, "approver", permission.Permission{
+		Scheme:  permission.PermAppApproveDeploy,
+		Context: permission.Context(permission.CtxTeam, s.team.Name),
+	})
+	u := fmt.Sprintf("/events/%s/approve", evts[0].UniqueID.Hex())
+	request, err = http.NewRequest("POST", u, strings.NewReader("reason=looks good"))
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Authorization", "bearer "+token.GetValue())
+	recorder = httptest.NewRecorder()
+	server.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusNoContent)
+	timeout := time.After(5 * time.Second)
+	for {
+		evt, err := event.GetByID(evts[0].UniqueID)
+		c.Assert(err, check.IsNil)
+		if !evt.Running {
+			c.Assert(evt.Error, check.Equals, "")
+			c.Assert(evt.ApprovalInfo.Approved, check.Equals, true)
+			c.Assert(evt.ApprovalInfo.Owner, check.Equals, token.GetUserName())
+			c.Assert(evt.Log, check.Matches, `(?s).*queued waiting for approval.*Deploy approved by approver.*`)
+			break
+		}
+		select {
+		case <-timeout:
+			c.Fatal("timeout waiting for approved deploy")
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+	dbApp, err := app.GetByName(a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(dbApp.Deploys, check.Equals, uint(1))
+}
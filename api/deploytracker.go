@@ -0,0 +1,46 @@
+// Copyright 2018 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package api
+
+import (
+	"context"
+	"sync"
+)
+
+// deployTracker keeps track of the deploys running after the request that
+// started them is finished, like the ones resumed after being approved, so
+// that shutdown waits for them instead of leaving their events and app locks
+// behind until they expire.
+type deployTracker struct {
+	wg sync.WaitGroup
+}
+
+func (t *deployTracker) run(deploy func()) {
+	t.wg.Add(1)
+	go func() {
+		defer t.wg.Done()
+		deploy()
+	}()
+}
+
+func (t *deployTracker) String() string {
+	return "background deploys"
+}
+
+func (t *deployTracker) Shutdown(ctx context.Context) error {
+	finished := make(chan struct{})
+	go func() {
+		t.wg.Wait()
+		close(finished)
+	}()
+	select {
+	case <-finished:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+var backgroundDeploys deployTracker
@@ -0,0 +1,34 @@
+// Copyright 2018 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package api
+
+import (
+	"context"
+	"time"
+
+	"gopkg.in/check.v1"
+)
+
+func (s *S) TestDeployTrackerShutdown(c *check.C) {
+	var tracker deployTracker
+	release := make(chan struct{})
+	done := make(chan struct{})
+	tracker.run(func() {
+		<-release
+		close(done)
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	err := tracker.Shutdown(ctx)
+	c.Assert(err, check.Equals, context.DeadlineExceeded)
+	close(release)
+	err = tracker.Shutdown(context.Background())
+	c.Assert(err, check.IsNil)
+	select {
+	case <-done:
+	default:
+		c.Fatal("shutdown returned before the deploy finished")
+	}
+}
@@ -5,6 +5,7 @@
 package api
 
 import (
+	"compress/gzip"
 	"encoding/json"
 	"fmt"
 	"net/http"
@@ -12,6 +13,7 @@ import (
 
 	"github.com/ajg/form"
 	"github.com/globalsign/mgo/bson"
+	"github.com/tsuru/tsuru/app"
 	"github.com/tsuru/tsuru/auth"
 	"github.com/tsuru/tsuru/errors"
 	"github.com/tsuru/tsuru/event"
@@ -26,9 +28,26 @@ import (
 //   200: OK
 //   204: No content
 func eventList(w http.ResponseWriter, r *http.Request, t auth.Token) error {
+	filter, err := eventFilterFromForm(r, t)
+	if err != nil {
+		return err
+	}
+	events, err := event.List(filter)
+	if err != nil {
+		return err
+	}
+	if len(events) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	}
+	w.Header().Add("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(events)
+}
+
+func eventFilterFromForm(r *http.Request, t auth.Token) (*event.Filter, error) {
 	err := r.ParseForm()
 	if err != nil {
-		return &errors.HTTP{Code: http.StatusBadRequest, Message: fmt.Sprintf("unable to parse event filters: %s", err)}
+		return nil, &errors.HTTP{Code: http.StatusBadRequest, Message: fmt.Sprintf("unable to parse event filters: %s", err)}
 	}
 	var filter *event.Filter
 	dec := form.NewDecoder(nil)
@@ -36,24 +55,43 @@ func eventList(w http.ResponseWriter, r *http.Request, t auth.Token) error {
 	dec.IgnoreCase(true)
 	err = dec.DecodeValues(&filter, r.Form)
 	if err != nil {
-		return &errors.HTTP{Code: http.StatusBadRequest, Message: fmt.Sprintf("unable to parse event filters: %s", err)}
+		return nil, &errors.HTTP{Code: http.StatusBadRequest, Message: fmt.Sprintf("unable to parse event filters: %s", err)}
 	}
 	filter.LoadKindNames(r.Form)
 	filter.PruneUserValues()
 	filter.Permissions, err = t.Permissions()
 	if err != nil {
-		return err
+		return nil, err
 	}
-	events, err := event.List(filter)
+	return filter, nil
+}
+
+// title: event export
+// path: /events/export
+// method: GET
+// produce: application/gzip
+// responses:
+//   200: OK
+//   400: Invalid filter
+//   401: Unauthorized
+func eventExport(w http.ResponseWriter, r *http.Request, t auth.Token) error {
+	if !permission.Check(t, permission.PermEventArchiveExport) {
+		return permission.ErrUnauthorized
+	}
+	filter, err := eventFilterFromForm(r, t)
 	if err != nil {
 		return err
 	}
-	if len(events) == 0 {
-		w.WriteHeader(http.StatusNoContent)
-		return nil
+	filter.Permissions = nil
+	filter.IncludeRemoved = true
+	w.Header().Set("Content-Type", "application/gzip")
+	w.Header().Set("Content-Disposition", `attachment; filename="events.jsonl.gz"`)
+	gz := gzip.NewWriter(w)
+	_, err = event.Export(gz, filter)
+	if err != nil {
+		return err
 	}
-	w.Header().Add("Content-Type", "application/json")
-	return json.NewEncoder(w).Encode(events)
+	return gz.Close()
 }
 
 // title: kind list
@@ -150,6 +188,61 @@ func eventCancel(w http.ResponseWriter, r *http.Request, t auth.Token) error {
 	return nil
 }
 
+// title: event approve
+// path: /events/{uuid}/approve
+// method: POST
+// consume: application/x-www-form-urlencoded
+// responses:
+//   204: Approved
+//   400: Invalid uuid or event not pending approval
+//   401: Unauthorized
+//   403: Approval by the event owner
+//   404: Not found
+//   409: Target locked by another event
+func eventApprove(w http.ResponseWriter, r *http.Request, t auth.Token) error {
+	uuid := r.URL.Query().Get(":uuid")
+	if !bson.IsObjectIdHex(uuid) {
+		msg := fmt.Sprintf("uuid parameter is not ObjectId: %s", uuid)
+		return &errors.HTTP{Code: http.StatusBadRequest, Message: msg}
+	}
+	objID := bson.ObjectIdHex(uuid)
+	e, err := event.GetByID(objID)
+	if err != nil {
+		return &errors.HTTP{Code: http.StatusNotFound, Message: err.Error()}
+	}
+	if !e.ApprovalInfo.Pending {
+		return &errors.HTTP{Code: http.StatusBadRequest, Message: event.ErrNotPendingApproval.Error()}
+	}
+	scheme, err := permission.SafeGet(e.AllowedApprove.Scheme)
+	if err != nil {
+		return err
+	}
+	allowed := permission.Check(t, scheme, e.AllowedApprove.Contexts...)
+	if !allowed {
+		return permission.ErrUnauthorized
+	}
+	opts, err := app.ApproveDeploy(e, r.FormValue("reason"), t.GetUserName())
+	if err != nil {
+		switch err {
+		case event.ErrNotPendingApproval:
+			return &errors.HTTP{Code: http.StatusBadRequest, Message: err.Error()}
+		case event.ErrApprovalByOwner:
+			return &errors.HTTP{Code: http.StatusForbidden, Message: err.Error()}
+		case event.ErrEventNotFound:
+			return &errors.HTTP{Code: http.StatusNotFound, Message: err.Error()}
+		}
+		if _, ok := err.(event.ErrEventLocked); ok {
+			return &errors.HTTP{Code: http.StatusConflict, Message: err.Error()}
+		}
+		return err
+	}
+	backgroundDeploys.run(func() {
+		runApprovedDeploy(*opts)
+	})
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
 // title: event block list
 // path: /events/blocks
 // method: GET
@@ -189,7 +282,7 @@ func eventBlockList(w http.ResponseWriter, r *http.Request, t auth.Token) error
 // consume: application/x-www-form-urlencoded
 // responses:
 //   200: OK
-//   400: Invalid data or empty reason
+//   400: Invalid data, schedule or empty reason
 //   401: Unauthorized
 func eventBlockAdd(w http.ResponseWriter, r *http.Request, t auth.Token) (err error) {
 	if !permission.Check(t, permission.PermEventBlockAdd) {
@@ -207,6 +300,11 @@ func eventBlockAdd(w http.ResponseWriter, r *http.Request, t auth.Token) (err er
 	if block.Reason == "" {
 		return &errors.HTTP{Code: http.StatusBadRequest, Message: "reason is required"}
 	}
+	block.Window.LoadWeekdays(r.Form)
+	err = block.Validate()
+	if err != nil {
+		return &errors.HTTP{Code: http.StatusBadRequest, Message: err.Error()}
+	}
 	evt, err := event.New(&event.Opts{
 		Target:     event.Target{Type: event.TargetTypeEventBlock},
 		Kind:       permission.PermEventBlockAdd,
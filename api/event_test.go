@@ -5,11 +5,16 @@
 package api
 
 import (
+	"compress/gzip"
 	"encoding/json"
 	"fmt"
+	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"strings"
+	"sync"
+	"time"
 
 	"golang.org/x/crypto/bcrypt"
 
@@ -20,6 +25,7 @@ import (
 	"github.com/tsuru/tsuru/auth"
 	"github.com/tsuru/tsuru/db"
 	"github.com/tsuru/tsuru/db/dbtest"
+	"github.com/tsuru/tsuru/errors"
 	"github.com/tsuru/tsuru/event"
 	"github.com/tsuru/tsuru/event/eventtest"
 	"github.com/tsuru/tsuru/permission"
@@ -266,6 +272,122 @@ func (s *EventSuite) TestKindListNoContent(c *check.C) {
 	c.Assert(recorder.Code, check.Equals, http.StatusNoContent)
 }
 
+func (s *EventSuite) TestEventStream(c *check.C) {
+	request, err := http.NewRequest("GET", "/events/stream?target.type=app&target.value=stream-app", nil)
+	c.Assert(err, check.IsNil)
+	recorder := &closeableRecorder{httptest.NewRecorder(), make(chan bool)}
+	wg := sync.WaitGroup{}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		streamErr := eventStream(recorder, request, s.token)
+		c.Assert(streamErr, check.IsNil)
+	}()
+	timeout := time.After(5 * time.Second)
+	for {
+		eventTracker.Lock()
+		n := len(eventTracker.conn)
+		eventTracker.Unlock()
+		if n > 0 {
+			break
+		}
+		select {
+		case <-timeout:
+			c.Fatal("timeout after 5 seconds")
+		case <-time.After(50 * time.Millisecond):
+		}
+	}
+	hidden, err := event.New(&event.Opts{
+		Target:  event.Target{Type: event.TargetTypeApp, Value: "stream-app"},
+		Kind:    permission.PermAppDeploy,
+		Owner:   s.token,
+		Allowed: event.Allowed(permission.PermAppReadEvents, permission.Context(permission.CtxTeam, "otherteam")),
+	})
+	c.Assert(err, check.IsNil)
+	err = hidden.Done(nil)
+	c.Assert(err, check.IsNil)
+	evt, err := event.New(&event.Opts{
+		Target:  event.Target{Type: event.TargetTypeApp, Value: "stream-app"},
+		Kind:    permission.PermAppDeploy,
+		Owner:   s.token,
+		Allowed: event.Allowed(permission.PermAppReadEvents, permission.Context(permission.CtxTeam, s.team.Name)),
+	})
+	c.Assert(err, check.IsNil)
+	err = evt.Done(nil)
+	c.Assert(err, check.IsNil)
+	time.Sleep(500 * time.Millisecond)
+	close(recorder.ch)
+	wg.Wait()
+	c.Assert(recorder.Header().Get("Content-Type"), check.Equals, "text/event-stream")
+	body := recorder.Body.String()
+	c.Assert(strings.HasPrefix(body, ": connected\n\n"), check.Equals, true)
+	blocks := strings.Split(strings.TrimSpace(strings.TrimPrefix(body, ": connected\n\n")), "\n\n")
+	c.Assert(blocks, check.HasLen, 2)
+	for i, msgType := range []event.StreamMessageType{event.StreamMessageTypeStart, event.StreamMessageTypeDone} {
+		lines := strings.Split(blocks[i], "\n")
+		c.Assert(lines, check.HasLen, 2)
+		c.Assert(lines[0], check.Equals, "event: "+string(msgType))
+		var msg event.StreamMessage
+		err = json.Unmarshal([]byte(strings.TrimPrefix(lines[1], "data: ")), &msg)
+		c.Assert(err, check.IsNil)
+		c.Assert(msg.Type, check.Equals, msgType)
+		c.Assert(msg.Event.UniqueID, check.Equals, evt.UniqueID)
+	}
+	eventTracker.Lock()
+	defer eventTracker.Unlock()
+	c.Assert(eventTracker.conn, check.HasLen, 0)
+}
+
+func (s *EventSuite) TestEventStreamInvalidFilter(c *check.C) {
+	request, err := http.NewRequest("GET", "/events/stream?since=yesterday", nil)
+	c.Assert(err, check.IsNil)
+	recorder := httptest.NewRecorder()
+	err = eventStream(recorder, request, s.token)
+	c.Assert(err, check.FitsTypeOf, &errors.HTTP{})
+	c.Assert(err.(*errors.HTTP).Code, check.Equals, http.StatusBadRequest)
+}
+
+func (s *EventSuite) TestEventExport(c *check.C) {
+	_, err := s.insertEvents("app", nil, c)
+	c.Assert(err, check.IsNil)
+	_, err = s.insertEvents("node", nil, c)
+	c.Assert(err, check.IsNil)
+	token := userWithPermission(c, permission.Permission{
+		Scheme:  permission.PermEventArchiveExport,
+		Context: permission.Context(permission.CtxGlobal, ""),
+	})
+	request, err := http.NewRequest("GET", "/events/export?target.type=app", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+token.GetValue())
+	recorder := httptest.NewRecorder()
+	server := RunServer(true)
+	server.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	c.Assert(recorder.Header().Get("Content-Type"), check.Equals, "application/gzip")
+	gz, err := gzip.NewReader(recorder.Body)
+	c.Assert(err, check.IsNil)
+	data, err := ioutil.ReadAll(gz)
+	c.Assert(err, check.IsNil)
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	c.Assert(lines, check.HasLen, 10)
+	for _, line := range lines {
+		var evt map[string]interface{}
+		err = json.Unmarshal([]byte(line), &evt)
+		c.Assert(err, check.IsNil)
+		c.Assert(evt["target"].(map[string]interface{})["type"], check.Equals, "app")
+	}
+}
+
+func (s *EventSuite) TestEventExportWithoutPermission(c *check.C) {
+	request, err := http.NewRequest("GET", "/events/export", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	server := RunServer(true)
+	server.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusForbidden)
+}
+
 func (s *EventSuite) TestEventInfoInvalidObjectID(c *check.C) {
 	u := fmt.Sprintf("/events/%s", "123")
 	request, err := http.NewRequest("GET", u, nil)
@@ -466,6 +588,109 @@ func (s *EventSuite) TestEventCancelWithoutPermission(c *check.C) {
 	c.Assert(recorder.Code, check.Equals, http.StatusForbidden)
 }
 
+func (s *EventSuite) queueApproval(c *check.C, evt *event.Event) {
+	err := evt.QueueApproval(event.Allowed(permission.PermAppApproveDeploy, permission.Context(permission.CtxTeam, s.team.Name)), time.Hour)
+	c.Assert(err, check.IsNil)
+}
+
+func (s *EventSuite) TestEventApproveLocked(c *check.C) {
+	events, err := s.insertEvents("app", nil, c)
+	c.Assert(err, check.IsNil)
+	s.queueApproval(c, events[0])
+	locker, err := event.New(&event.Opts{
+		Target:  event.Target{Type: event.TargetTypeApp, Value: "app-0"},
+		Owner:   s.token,
+		Kind:    permission.PermAppUpdateEnvSet,
+		Allowed: event.Allowed(permission.PermAppReadEvents),
+	})
+	c.Assert(err, check.IsNil)
+	defer locker.Done(nil)
+	_, token := permissiontest.CustomUserWithPermission(c, nativeScheme, "approver", permission.Permission{
+		Scheme:  permission.PermAppApproveDeploy,
+		Context: permission.Context(permission.CtxTeam, s.team.Name),
+	})
+	u := fmt.Sprintf("/events/%s/approve", events[0].UniqueID.Hex())
+	request, err := http.NewRequest("POST", u, nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+token.GetValue())
+	recorder := httptest.NewRecorder()
+	server := RunServer(true)
+	server.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusConflict)
+	evt, err := event.GetByID(events[0].UniqueID)
+	c.Assert(err, check.IsNil)
+	c.Assert(evt.ApprovalInfo.Pending, check.Equals, true)
+}
+
+func (s *EventSuite) TestEventApproveByOwner(c *check.C) {
+	events, err := s.insertEvents("app", nil, c)
+	c.Assert(err, check.IsNil)
+	s.queueApproval(c, events[0])
+	u := fmt.Sprintf("/events/%s/approve", events[0].UniqueID.Hex())
+	request, err := http.NewRequest("POST", u, nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	server := RunServer(true)
+	server.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusForbidden)
+	c.Assert(recorder.Body.String(), check.Equals, "event must be approved by someone other than its owner\n")
+}
+
+func (s *EventSuite) TestEventApproveWithoutPermission(c *check.C) {
+	events, err := s.insertEvents("app", nil, c)
+	c.Assert(err, check.IsNil)
+	s.queueApproval(c, events[0])
+	_, token := permissiontest.CustomUserWithPermission(c, nativeScheme, "deployer", permission.Permission{
+		Scheme:  permission.PermAppDeploy,
+		Context: permission.Context(permission.CtxTeam, s.team.Name),
+	})
+	u := fmt.Sprintf("/events/%s/approve", events[0].UniqueID.Hex())
+	request, err := http.NewRequest("POST", u, nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+token.GetValue())
+	recorder := httptest.NewRecorder()
+	server := RunServer(true)
+	server.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusForbidden)
+	evt, err := event.GetByID(events[0].UniqueID)
+	c.Assert(err, check.IsNil)
+	c.Assert(evt.ApprovalInfo.Pending, check.Equals, true)
+}
+
+func (s *EventSuite) TestEventApproveNotPending(c *check.C) {
+	events, err := s.insertEvents("app", nil, c)
+	c.Assert(err, check.IsNil)
+	u := fmt.Sprintf("/events/%s/approve", events[0].UniqueID.Hex())
+	request, err := http.NewRequest("POST", u, nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	server := RunServer(true)
+	server.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusBadRequest)
+	c.Assert(recorder.Body.String(), check.Equals, "event is not pending approval\n")
+}
+
+func (s *EventSuite) TestEventListPendingOnly(c *check.C) {
+	events, err := s.insertEvents("app", nil, c)
+	c.Assert(err, check.IsNil)
+	s.queueApproval(c, events[2])
+	request, err := http.NewRequest("GET", "/events?pendingonly=true", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	server := RunServer(true)
+	server.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	var result []event.Event
+	err = json.Unmarshal(recorder.Body.Bytes(), &result)
+	c.Assert(err, check.IsNil)
+	c.Assert(result, check.HasLen, 1)
+	c.Assert(result[0].UniqueID, check.Equals, events[2].UniqueID)
+	c.Assert(result[0].ApprovalInfo.Pending, check.Equals, true)
+}
+
 func (s *EventSuite) TestEventBlockListAllBlocks(c *check.C) {
 	_, token := permissiontest.CustomUserWithPermission(c, nativeScheme, "myuser", permission.Permission{
 		Scheme:  permission.PermEventBlockRead,
@@ -598,6 +823,66 @@ func (s *EventSuite) TestEventBlockAddWithoutReason(c *check.C) {
 	c.Assert(len(blocks), check.Equals, 0)
 }
 
+func (s *EventSuite) TestEventBlockAddWithWindow(c *check.C) {
+	_, token := permissiontest.CustomUserWithPermission(c, nativeScheme, "myuser", permission.Permission{
+		Scheme:  permission.PermEventBlockAdd,
+		Context: permission.PermissionContext{CtxType: permission.CtxGlobal},
+	})
+	endTime := time.Now().Add(24 * time.Hour).UTC().Truncate(time.Second)
+	values := url.Values{
+		"kindname":        {"app.deploy"},
+		"pool":            {"prod"},
+		"endtime":         {endTime.Format(time.RFC3339)},
+		"window.weekdays": {"Friday", "saturday"},
+		"window.start":    {"16:00"},
+		"window.timezone": {"America/Sao_Paulo"},
+		"reason":          {"no deploys on weekends"},
+	}
+	request, err := http.NewRequest("POST", "/events/blocks", strings.NewReader(values.Encode()))
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+token.GetValue())
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	recorder := httptest.NewRecorder()
+	server := RunServer(true)
+	server.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	blocks, err := event.ListBlocks(nil)
+	c.Assert(err, check.IsNil)
+	c.Assert(len(blocks), check.Equals, 1)
+	c.Assert(blocks[0].Active, check.Equals, true)
+	c.Assert(blocks[0].Pool, check.Equals, "prod")
+	c.Assert(blocks[0].EndTime.Equal(endTime), check.Equals, true)
+	c.Assert(blocks[0].Window, check.DeepEquals, event.BlockWindow{
+		Weekdays: []string{"friday", "saturday"},
+		Start:    "16:00",
+		Timezone: "America/Sao_Paulo",
+	})
+}
+
+func (s *EventSuite) TestEventBlockAddInvalidWindow(c *check.C) {
+	_, token := permissiontest.CustomUserWithPermission(c, nativeScheme, "myuser", permission.Permission{
+		Scheme:  permission.PermEventBlockAdd,
+		Context: permission.PermissionContext{CtxType: permission.CtxGlobal},
+	})
+	values := url.Values{
+		"kindname":        {"app.deploy"},
+		"window.weekdays": {"someday"},
+		"reason":          {"block reason"},
+	}
+	request, err := http.NewRequest("POST", "/events/blocks", strings.NewReader(values.Encode()))
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+token.GetValue())
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	recorder := httptest.NewRecorder()
+	server := RunServer(true)
+	server.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusBadRequest)
+	c.Assert(recorder.Body.String(), check.Equals, "invalid weekday \"someday\" in block window\n")
+	blocks, err := event.ListBlocks(nil)
+	c.Assert(err, check.IsNil)
+	c.Assert(len(blocks), check.Equals, 0)
+}
+
 func (s *EventSuite) TestEventBlockRemove(c *check.C) {
 	_, token := permissiontest.CustomUserWithPermission(c, nativeScheme, "myuser", permission.Permission{
 		Scheme:  permission.PermEventBlockRemove,
@@ -0,0 +1,129 @@
+// Copyright 2018 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/tsuru/tsuru/auth"
+	"github.com/tsuru/tsuru/event"
+)
+
+var eventStreamKeepAlive = 30 * time.Second
+
+type eventStreamTracker struct {
+	sync.Mutex
+	conn map[*event.StreamListener]struct{}
+}
+
+func (t *eventStreamTracker) add(l *event.StreamListener) {
+	t.Lock()
+	defer t.Unlock()
+	if t.conn == nil {
+		t.conn = make(map[*event.StreamListener]struct{})
+	}
+	t.conn[l] = struct{}{}
+}
+
+func (t *eventStreamTracker) remove(l *event.StreamListener) {
+	t.Lock()
+	defer t.Unlock()
+	delete(t.conn, l)
+}
+
+func (t *eventStreamTracker) String() string {
+	return "event stream connections"
+}
+
+func (t *eventStreamTracker) Shutdown(ctx context.Context) error {
+	t.Lock()
+	defer t.Unlock()
+	for l := range t.conn {
+		l.Close()
+	}
+	return nil
+}
+
+var eventTracker eventStreamTracker
+
+// title: event stream
+// path: /events/stream
+// method: GET
+// produce: text/event-stream
+// responses:
+//   200: OK
+//   400: Invalid filter
+func eventStream(w http.ResponseWriter, r *http.Request, t auth.Token) error {
+	filter, err := eventFilterFromForm(r, t)
+	if err != nil {
+		return err
+	}
+	l, err := event.NewStreamListener(filter)
+	if err != nil {
+		return err
+	}
+	eventTracker.add(l)
+	defer func() {
+		eventTracker.remove(l)
+		l.Close()
+	}()
+	var closeChan <-chan bool
+	if notifier, ok := w.(http.CloseNotifier); ok {
+		closeChan = notifier.CloseNotify()
+	} else {
+		closeChan = make(chan bool)
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	_, err = w.Write([]byte(": connected\n\n"))
+	if err != nil {
+		return nil
+	}
+	keepAlive := time.NewTicker(eventStreamKeepAlive)
+	defer keepAlive.Stop()
+	msgChan := l.ListenChan()
+	for {
+		var data []byte
+		select {
+		case <-closeChan:
+			return nil
+		case <-keepAlive.C:
+			data = []byte(": keep-alive\n\n")
+		case msg, ok := <-msgChan:
+			if !ok {
+				return nil
+			}
+			data, err = encodeStreamMessage(msg)
+			if err != nil {
+				return err
+			}
+		}
+		_, err = w.Write(data)
+		if err != nil {
+			return nil
+		}
+	}
+}
+
+// encodeStreamMessage formats msg as a server-sent event named after the
+// message type.
+func encodeStreamMessage(msg event.StreamMessage) ([]byte, error) {
+	payload, err := json.Marshal(msg)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	buf.WriteString("event: " + string(msg.Type) + "\n")
+	buf.WriteString("data: ")
+	buf.Write(payload)
+	buf.WriteString("\n\n")
+	return buf.Bytes(), nil
+}
@@ -10,6 +10,7 @@ import (
 	"context"
 
 	"github.com/tsuru/tsuru/app"
+	appTypes "github.com/tsuru/tsuru/types/app"
 	"gopkg.in/check.v1"
 )
 
@@ -23,7 +24,7 @@ func (s *S) TestLogStreamTrackerAddRemove(c *check.C) {
 }
 
 func (s *S) TestLogStreamTrackerShutdown(c *check.C) {
-	l, err := app.NewLogListener(&app.App{Name: "myapp"}, app.Applog{})
+	l, err := app.NewLogListener(&app.App{Name: "myapp"}, appTypes.Applog{})
 	c.Assert(err, check.IsNil)
 	logTracker.add(l)
 	logTracker.Shutdown(context.Background())
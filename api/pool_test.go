@@ -18,6 +18,8 @@ import (
 	"github.com/tsuru/tsuru/event/eventtest"
 	"github.com/tsuru/tsuru/permission"
 	"github.com/tsuru/tsuru/provision/pool"
+	"github.com/tsuru/tsuru/quota"
+	appTypes "github.com/tsuru/tsuru/types/app"
 	authTypes "github.com/tsuru/tsuru/types/auth"
 	"gopkg.in/check.v1"
 )
@@ -442,6 +444,36 @@ func (s *S) TestPoolListHandler(c *check.C) {
 	c.Assert(pools, check.DeepEquals, expected)
 }
 
+func (s *S) TestPoolListHandlerReportsCapacity(c *check.C) {
+	opts := pool.AddPoolOptions{Name: "pool1", Public: true, MaxMemory: 4096, Overcommit: 2}
+	err := pool.AddPool(opts)
+	c.Assert(err, check.IsNil)
+	err = s.conn.Apps().Insert(app.App{Name: "myapp", Pool: "pool1", Plan: appTypes.Plan{Memory: 1024, CpuShare: 100}, Quota: quota.Quota{Limit: -1, InUse: 3}})
+	c.Assert(err, check.IsNil)
+	token := userWithPermission(c)
+	req, err := http.NewRequest(http.MethodGet, "/pools", nil)
+	c.Assert(err, check.IsNil)
+	rec := httptest.NewRecorder()
+	err = poolList(rec, req, token)
+	c.Assert(err, check.IsNil)
+	var pools []struct {
+		Name     string
+		Capacity pool.Capacity
+		Usage    pool.CapacityUsage
+	}
+	err = json.NewDecoder(rec.Body).Decode(&pools)
+	c.Assert(err, check.IsNil)
+	c.Assert(pools, check.HasLen, 2)
+	c.Assert(pools[1].Name, check.Equals, "pool1")
+	c.Assert(pools[1].Capacity, check.DeepEquals, pool.Capacity{MaxMemory: 4096, Overcommit: 2})
+	c.Assert(pools[1].Usage, check.DeepEquals, pool.CapacityUsage{
+		UsedMemory:      3072,
+		UsedCPU:         300,
+		AvailableMemory: 5120,
+		AvailableCPU:    -1,
+	})
+}
+
 func (s *S) TestPoolListEmptyHandler(c *check.C) {
 	_, err := s.conn.Pools().RemoveAll(nil)
 	c.Assert(err, check.IsNil)
@@ -581,6 +613,32 @@ func (s *S) TestPoolUpdateToPublicHandler(c *check.C) {
 	}, eventtest.HasEvent)
 }
 
+func (s *S) TestPoolUpdateCapacityHandler(c *check.C) {
+	opts := pool.AddPoolOptions{Name: "pool1"}
+	err := pool.AddPool(opts)
+	c.Assert(err, check.IsNil)
+	b := bytes.NewBufferString("maxMemory=2048&maxCPU=200&overcommit=1.5")
+	req, err := http.NewRequest(http.MethodPut, "/pools/pool1", b)
+	c.Assert(err, check.IsNil)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	rec := httptest.NewRecorder()
+	s.testServer.ServeHTTP(rec, req)
+	c.Assert(rec.Code, check.Equals, http.StatusOK)
+	p, err := pool.GetPoolByName("pool1")
+	c.Assert(err, check.IsNil)
+	c.Assert(p.Capacity, check.DeepEquals, pool.Capacity{MaxMemory: 2048, MaxCPU: 200, Overcommit: 1.5})
+	b = bytes.NewBufferString("overcommit=0.5")
+	req, err = http.NewRequest(http.MethodPut, "/pools/pool1", b)
+	c.Assert(err, check.IsNil)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	rec = httptest.NewRecorder()
+	s.testServer.ServeHTTP(rec, req)
+	c.Assert(rec.Code, check.Equals, http.StatusBadRequest)
+	c.Assert(rec.Body.String(), check.Equals, pool.ErrInvalidOvercommit.Error()+"\n")
+}
+
 func (s *S) TestPoolUpdateToDefaultPoolHandler(c *check.C) {
 	pool.RemovePool("test1")
 	opts := pool.AddPoolOptions{Name: "pool1"}
@@ -16,6 +16,7 @@ import (
 	"github.com/tsuru/tsuru/errors"
 	"github.com/tsuru/tsuru/event"
 	"github.com/tsuru/tsuru/permission"
+	"github.com/tsuru/tsuru/servicemanager"
 )
 
 // title: user quota
@@ -153,3 +154,95 @@ func changeAppQuota(w http.ResponseWriter, r *http.Request, t auth.Token) (err e
 	}
 	return app.ChangeQuota(&a, limit)
 }
+
+// title: team quota
+// path: /teams/{name}/quota
+// method: GET
+// produce: application/json
+// responses:
+//   200: OK
+//   401: Unauthorized
+//   404: Team not found
+func getTeamQuota(w http.ResponseWriter, r *http.Request, t auth.Token) error {
+	teamName := r.URL.Query().Get(":name")
+	allowed := permission.Check(t, permission.PermTeamRead, permission.Context(permission.CtxTeam, teamName))
+	if !allowed {
+		return permission.ErrUnauthorized
+	}
+	_, err := servicemanager.Team.FindByName(teamName)
+	if err == authTypes.ErrTeamNotFound {
+		return &errors.HTTP{
+			Code:    http.StatusNotFound,
+			Message: err.Error(),
+		}
+	}
+	if err != nil {
+		return err
+	}
+	q, err := app.GetTeamQuota(teamName)
+	if err != nil {
+		return err
+	}
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(q)
+}
+
+// title: update team quota
+// path: /teams/{name}/quota
+// method: PUT
+// consume: application/x-www-form-urlencoded
+// responses:
+//   200: Quota updated
+//   400: Invalid data
+//   401: Unauthorized
+//   404: Team not found
+func changeTeamQuota(w http.ResponseWriter, r *http.Request, t auth.Token) (err error) {
+	r.ParseForm()
+	teamName := r.URL.Query().Get(":name")
+	allowed := permission.Check(t, permission.PermTeamUpdateQuota, permission.Context(permission.CtxTeam, teamName))
+	if !allowed {
+		return permission.ErrUnauthorized
+	}
+	_, err = servicemanager.Team.FindByName(teamName)
+	if err == authTypes.ErrTeamNotFound {
+		return &errors.HTTP{
+			Code:    http.StatusNotFound,
+			Message: err.Error(),
+		}
+	} else if err != nil {
+		return err
+	}
+	evt, err := event.New(&event.Opts{
+		Target:     teamTarget(teamName),
+		Kind:       permission.PermTeamUpdateQuota,
+		Owner:      t,
+		CustomData: event.FormToCustomData(r.Form),
+		Allowed:    event.Allowed(permission.PermTeamReadEvents, permission.Context(permission.CtxTeam, teamName)),
+	})
+	if err != nil {
+		return err
+	}
+	defer func() { evt.Done(err) }()
+	q, err := app.GetTeamQuota(teamName)
+	if err != nil {
+		return err
+	}
+	for field, limit := range map[string]*int{
+		"apps":   &q.Apps.Limit,
+		"units":  &q.Units.Limit,
+		"memory": &q.Memory.Limit,
+	} {
+		value := r.FormValue(field)
+		if value == "" {
+			continue
+		}
+		*limit, err = strconv.Atoi(value)
+		if err != nil {
+			return &errors.HTTP{
+				Code:    http.StatusBadRequest,
+				Message: "Invalid " + field + " limit",
+			}
+		}
+	}
+	return app.ChangeTeamQuota(q)
+}
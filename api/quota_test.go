@@ -26,6 +26,7 @@ import (
 	"github.com/tsuru/tsuru/permission/permissiontest"
 	"github.com/tsuru/tsuru/quota"
 	"github.com/tsuru/tsuru/repository/repositorytest"
+	"github.com/tsuru/tsuru/servicemanager"
 	_ "github.com/tsuru/tsuru/storage/mongodb"
 	"gopkg.in/check.v1"
 )
@@ -402,3 +403,153 @@ func (s *QuotaSuite) TestChangeAppQuotaAppNotFound(c *check.C) {
 	c.Assert(recorder.Code, check.Equals, http.StatusNotFound)
 	c.Assert(recorder.Body.String(), check.Equals, app.ErrAppNotFound.Error()+"\n")
 }
+
+func (s *QuotaSuite) mockTeam() {
+	servicemanager.Team = &authTypes.MockTeamService{
+		OnFindByName: func(name string) (*authTypes.Team, error) {
+			if name == s.team.Name {
+				return s.team, nil
+			}
+			return nil, authTypes.ErrTeamNotFound
+		},
+	}
+}
+
+func (s *QuotaSuite) TestGetTeamQuota(c *check.C) {
+	s.mockTeam()
+	err := app.ChangeTeamQuota(&app.TeamQuota{
+		Team:   s.team.Name,
+		Apps:   quota.Quota{Limit: 4},
+		Units:  quota.Unlimited,
+		Memory: quota.Unlimited,
+	})
+	c.Assert(err, check.IsNil)
+	token := userWithPermission(c, permission.Permission{
+		Scheme:  permission.PermTeamRead,
+		Context: permission.Context(permission.CtxTeam, s.team.Name),
+	})
+	request, _ := http.NewRequest("GET", "/teams/superteam/quota", nil)
+	request.Header.Set("Authorization", "bearer "+token.GetValue())
+	recorder := httptest.NewRecorder()
+	s.testServer.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	c.Assert(recorder.Header().Get("Content-Type"), check.Equals, "application/json")
+	var q app.TeamQuota
+	err = json.NewDecoder(recorder.Body).Decode(&q)
+	c.Assert(err, check.IsNil)
+	c.Assert(q, check.DeepEquals, app.TeamQuota{
+		Team:   s.team.Name,
+		Apps:   quota.Quota{Limit: 4},
+		Units:  quota.Unlimited,
+		Memory: quota.Unlimited,
+	})
+}
+
+func (s *QuotaSuite) TestGetTeamQuotaRequiresPermission(c *check.C) {
+	s.mockTeam()
+	token := userWithPermission(c, permission.Permission{
+		Scheme:  permission.PermTeamRead,
+		Context: permission.Context(permission.CtxTeam, "otherteam"),
+	})
+	request, _ := http.NewRequest("GET", "/teams/superteam/quota", nil)
+	request.Header.Set("Authorization", "bearer "+token.GetValue())
+	recorder := httptest.NewRecorder()
+	s.testServer.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusForbidden)
+}
+
+func (s *QuotaSuite) TestGetTeamQuotaTeamNotFound(c *check.C) {
+	s.mockTeam()
+	token := userWithPermission(c, permission.Permission{
+		Scheme:  permission.PermTeamRead,
+		Context: permission.Context(permission.CtxGlobal, ""),
+	})
+	request, _ := http.NewRequest("GET", "/teams/unknown/quota", nil)
+	request.Header.Set("Authorization", "bearer "+token.GetValue())
+	recorder := httptest.NewRecorder()
+	s.testServer.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusNotFound)
+	c.Assert(recorder.Body.String(), check.Equals, authTypes.ErrTeamNotFound.Error()+"\n")
+}
+
+func (s *QuotaSuite) TestChangeTeamQuota(c *check.C) {
+	s.mockTeam()
+	token := userWithPermission(c, permission.Permission{
+		Scheme:  permission.PermTeamUpdateQuota,
+		Context: permission.Context(permission.CtxTeam, s.team.Name),
+	})
+	body := bytes.NewBufferString("apps=10&memory=1073741824")
+	request, _ := http.NewRequest("PUT", "/teams/superteam/quota", body)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Authorization", "bearer "+token.GetValue())
+	recorder := httptest.NewRecorder()
+	s.testServer.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	q, err := app.GetTeamQuota(s.team.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(q.Apps.Limit, check.Equals, 10)
+	c.Assert(q.Units.Limit, check.Equals, -1)
+	c.Assert(q.Memory.Limit, check.Equals, 1073741824)
+	c.Assert(eventtest.EventDesc{
+		Target: event.Target{Type: event.TargetTypeTeam, Value: s.team.Name},
+		Owner:  token.GetUserName(),
+		Kind:   "team.update.quota",
+		StartCustomData: []map[string]interface{}{
+			{"name": ":name", "value": s.team.Name},
+			{"name": "apps", "value": "10"},
+			{"name": "memory", "value": "1073741824"},
+		},
+	}, eventtest.HasEvent)
+}
+
+func (s *QuotaSuite) TestChangeTeamQuotaInvalidLimitValue(c *check.C) {
+	s.mockTeam()
+	token := userWithPermission(c, permission.Permission{
+		Scheme:  permission.PermTeamUpdateQuota,
+		Context: permission.Context(permission.CtxTeam, s.team.Name),
+	})
+	body := bytes.NewBufferString("units=four")
+	request, _ := http.NewRequest("PUT", "/teams/superteam/quota", body)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Authorization", "bearer "+token.GetValue())
+	recorder := httptest.NewRecorder()
+	s.testServer.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusBadRequest)
+	c.Assert(recorder.Body.String(), check.Equals, "Invalid units limit\n")
+}
+
+func (s *QuotaSuite) TestChangeTeamQuotaLesserThanUsage(c *check.C) {
+	s.mockTeam()
+	conn, err := db.Conn()
+	c.Assert(err, check.IsNil)
+	defer conn.Close()
+	err = conn.Apps().Insert(app.App{Name: "shangrila", TeamOwner: s.team.Name, Quota: quota.Quota{Limit: -1, InUse: 3}})
+	c.Assert(err, check.IsNil)
+	token := userWithPermission(c, permission.Permission{
+		Scheme:  permission.PermTeamUpdateQuota,
+		Context: permission.Context(permission.CtxTeam, s.team.Name),
+	})
+	body := bytes.NewBufferString("units=2")
+	request, _ := http.NewRequest("PUT", "/teams/superteam/quota", body)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Authorization", "bearer "+token.GetValue())
+	recorder := httptest.NewRecorder()
+	s.testServer.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusBadRequest)
+	c.Assert(recorder.Body.String(), check.Equals, "new units limit is lesser than the current allocated value\n")
+}
+
+func (s *QuotaSuite) TestChangeTeamQuotaRequiresPermission(c *check.C) {
+	s.mockTeam()
+	token := userWithPermission(c, permission.Permission{
+		Scheme:  permission.PermTeamRead,
+		Context: permission.Context(permission.CtxTeam, s.team.Name),
+	})
+	body := bytes.NewBufferString("apps=10")
+	request, _ := http.NewRequest("PUT", "/teams/superteam/quota", body)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Authorization", "bearer "+token.GetValue())
+	recorder := httptest.NewRecorder()
+	s.testServer.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusForbidden)
+}
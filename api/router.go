@@ -9,6 +9,7 @@ import (
 	"net/http"
 
 	"github.com/ajg/form"
+	"github.com/tsuru/tsuru/app"
 	"github.com/tsuru/tsuru/auth"
 	"github.com/tsuru/tsuru/errors"
 	"github.com/tsuru/tsuru/event"
@@ -277,3 +278,109 @@ func listAppRouters(w http.ResponseWriter, r *http.Request, t auth.Token) error
 	}
 	return json.NewEncoder(w).Encode(routers)
 }
+
+// title: list app process routes
+// path: /apps/{app}/process-routes
+// method: GET
+// produce: application/json
+// responses:
+//   200: OK
+//   204: No content
+//   401: Unauthorized
+//   404: App not found
+func listAppProcessRoutes(w http.ResponseWriter, r *http.Request, t auth.Token) error {
+	a, err := getAppFromContext(r.URL.Query().Get(":app"), r)
+	if err != nil {
+		return err
+	}
+	canRead := permission.Check(t, permission.PermAppReadRouter,
+		contextsForApp(&a)...,
+	)
+	if !canRead {
+		return permission.ErrUnauthorized
+	}
+	routes := a.GetProcessRoutes()
+	if len(routes) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	}
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(routes)
+}
+
+// title: set app process route
+// path: /apps/{app}/process-routes
+// method: PUT
+// consume: application/x-www-form-urlencoded
+// responses:
+//   200: OK
+//   400: Invalid data
+//   401: Unauthorized
+//   404: App not found
+func setAppProcessRoute(w http.ResponseWriter, r *http.Request, t auth.Token) (err error) {
+	route := appTypes.ProcessRoute{
+		Path:    r.FormValue("path"),
+		Process: r.FormValue("process"),
+	}
+	appName := r.URL.Query().Get(":app")
+	a, err := getAppFromContext(appName, r)
+	if err != nil {
+		return err
+	}
+	allowed := permission.Check(t, permission.PermAppUpdateRouterUpdate,
+		contextsForApp(&a)...,
+	)
+	if !allowed {
+		return permission.ErrUnauthorized
+	}
+	evt, err := event.New(&event.Opts{
+		Target:     appTarget(appName),
+		Kind:       permission.PermAppUpdateRouterUpdate,
+		Owner:      t,
+		CustomData: event.FormToCustomData(r.Form),
+		Allowed:    event.Allowed(permission.PermAppReadEvents, contextsForApp(&a)...),
+	})
+	if err != nil {
+		return err
+	}
+	defer func() { evt.Done(err) }()
+	return a.SetProcessRoute(route)
+}
+
+// title: remove app process route
+// path: /apps/{app}/process-routes
+// method: DELETE
+// responses:
+//   200: OK
+//   401: Unauthorized
+//   404: App or process route not found
+func removeAppProcessRoute(w http.ResponseWriter, r *http.Request, t auth.Token) (err error) {
+	path := r.FormValue("path")
+	appName := r.URL.Query().Get(":app")
+	a, err := getAppFromContext(appName, r)
+	if err != nil {
+		return err
+	}
+	allowed := permission.Check(t, permission.PermAppUpdateRouterUpdate,
+		contextsForApp(&a)...,
+	)
+	if !allowed {
+		return permission.ErrUnauthorized
+	}
+	evt, err := event.New(&event.Opts{
+		Target:     appTarget(appName),
+		Kind:       permission.PermAppUpdateRouterUpdate,
+		Owner:      t,
+		CustomData: event.FormToCustomData(r.Form),
+		Allowed:    event.Allowed(permission.PermAppReadEvents, contextsForApp(&a)...),
+	})
+	if err != nil {
+		return err
+	}
+	defer func() { evt.Done(err) }()
+	err = a.RemoveProcessRoute(path)
+	if err == app.ErrProcessRouteNotFound {
+		return &errors.HTTP{Code: http.StatusNotFound, Message: err.Error()}
+	}
+	return err
+}
@@ -10,8 +10,10 @@ import (
 	"net/http/httptest"
 	"strings"
 
+	"github.com/globalsign/mgo/bson"
 	"github.com/tsuru/config"
 	"github.com/tsuru/tsuru/app"
+	"github.com/tsuru/tsuru/event/eventtest"
 	"github.com/tsuru/tsuru/permission"
 	"github.com/tsuru/tsuru/provision/pool"
 	"github.com/tsuru/tsuru/router"
@@ -360,3 +362,122 @@ func (s *S) TestRemoveAppRouterNotFound(c *check.C) {
 	s.testServer.ServeHTTP(recorder, request)
 	c.Assert(recorder.Code, check.Equals, http.StatusNotFound)
 }
+
+func (s *S) TestListAppProcessRoutes(c *check.C) {
+	token := userWithPermission(c, permission.Permission{
+		Scheme:  permission.PermAppReadRouter,
+		Context: permission.Context(permission.CtxTeam, "tsuruteam"),
+	})
+	myapp := app.App{Name: "myapp", Platform: "go", TeamOwner: s.team.Name}
+	err := app.CreateApp(&myapp, s.user)
+	c.Assert(err, check.IsNil)
+	routes := []appTypes.ProcessRoute{{Path: "/api", Process: "api"}}
+	err = s.conn.Apps().Update(bson.M{"name": myapp.Name}, bson.M{"$set": bson.M{"processroutes": routes}})
+	c.Assert(err, check.IsNil)
+	recorder := httptest.NewRecorder()
+	request, err := http.NewRequest("GET", "/1.7/apps/myapp/process-routes", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+token.GetValue())
+	s.testServer.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	var result []appTypes.ProcessRoute
+	err = json.Unmarshal(recorder.Body.Bytes(), &result)
+	c.Assert(err, check.IsNil)
+	c.Assert(result, check.DeepEquals, routes)
+}
+
+func (s *S) TestListAppProcessRoutesEmpty(c *check.C) {
+	myapp := app.App{Name: "myapp", Platform: "go", TeamOwner: s.team.Name}
+	err := app.CreateApp(&myapp, s.user)
+	c.Assert(err, check.IsNil)
+	recorder := httptest.NewRecorder()
+	request, err := http.NewRequest("GET", "/1.7/apps/myapp/process-routes", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	s.testServer.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusNoContent)
+}
+
+func (s *S) TestSetAppProcessRoute(c *check.C) {
+	config.Set("routers:fake-path:type", "fake-path")
+	defer config.Unset("routers:fake-path")
+	token := userWithPermission(c, permission.Permission{
+		Scheme:  permission.PermAppUpdateRouterUpdate,
+		Context: permission.Context(permission.CtxTeam, "tsuruteam"),
+	})
+	myapp := app.App{Name: "myapp", Platform: "go", TeamOwner: s.team.Name}
+	err := app.CreateApp(&myapp, s.user)
+	c.Assert(err, check.IsNil)
+	err = myapp.AddRouter(appTypes.AppRouter{Name: "fake-path"})
+	c.Assert(err, check.IsNil)
+	recorder := httptest.NewRecorder()
+	body := strings.NewReader(`path=/api&process=api`)
+	request, err := http.NewRequest("PUT", "/1.7/apps/myapp/process-routes", body)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Authorization", "bearer "+token.GetValue())
+	s.testServer.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	dbApp, err := app.GetByName(myapp.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(dbApp.ProcessRoutes, check.DeepEquals, []appTypes.ProcessRoute{{Path: "/api", Process: "api"}})
+	c.Assert(eventtest.EventDesc{
+		Target: appTarget(myapp.Name),
+		Owner:  token.GetUserName(),
+		Kind:   "app.update.router.update",
+		StartCustomData: []map[string]interface{}{
+			{"name": "path", "value": "/api"},
+			{"name": "process", "value": "api"},
+		},
+	}, eventtest.HasEvent)
+}
+
+func (s *S) TestSetAppProcessRouteInvalid(c *check.C) {
+	myapp := app.App{Name: "myapp", Platform: "go", TeamOwner: s.team.Name}
+	err := app.CreateApp(&myapp, s.user)
+	c.Assert(err, check.IsNil)
+	recorder := httptest.NewRecorder()
+	body := strings.NewReader(`path=/api&process=api`)
+	request, err := http.NewRequest("PUT", "/1.7/apps/myapp/process-routes", body)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	s.testServer.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusBadRequest)
+	c.Assert(recorder.Body.String(), check.Equals, "none of the routers of the app support routing paths to processes\n")
+}
+
+func (s *S) TestRemoveAppProcessRoute(c *check.C) {
+	token := userWithPermission(c, permission.Permission{
+		Scheme:  permission.PermAppUpdateRouterUpdate,
+		Context: permission.Context(permission.CtxTeam, "tsuruteam"),
+	})
+	myapp := app.App{Name: "myapp", Platform: "go", TeamOwner: s.team.Name}
+	err := app.CreateApp(&myapp, s.user)
+	c.Assert(err, check.IsNil)
+	err = s.conn.Apps().Update(bson.M{"name": myapp.Name}, bson.M{"$set": bson.M{
+		"processroutes": []appTypes.ProcessRoute{{Path: "/api", Process: "api"}},
+	}})
+	c.Assert(err, check.IsNil)
+	recorder := httptest.NewRecorder()
+	request, err := http.NewRequest("DELETE", "/1.7/apps/myapp/process-routes?path=/api", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+token.GetValue())
+	s.testServer.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	dbApp, err := app.GetByName(myapp.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(dbApp.ProcessRoutes, check.HasLen, 0)
+}
+
+func (s *S) TestRemoveAppProcessRouteNotFound(c *check.C) {
+	myapp := app.App{Name: "myapp", Platform: "go", TeamOwner: s.team.Name}
+	err := app.CreateApp(&myapp, s.user)
+	c.Assert(err, check.IsNil)
+	recorder := httptest.NewRecorder()
+	request, err := http.NewRequest("DELETE", "/1.7/apps/myapp/process-routes?path=/api", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	s.testServer.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusNotFound)
+}
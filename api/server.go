@@ -28,9 +28,14 @@ import (
 	_ "github.com/tsuru/tsuru/auth/native"
 	_ "github.com/tsuru/tsuru/auth/oauth"
 	_ "github.com/tsuru/tsuru/auth/saml"
+	"github.com/tsuru/tsuru/autocert"
 	"github.com/tsuru/tsuru/autoscale"
+	"github.com/tsuru/tsuru/certexpiry"
+	"github.com/tsuru/tsuru/cronjob"
 	"github.com/tsuru/tsuru/db"
 	"github.com/tsuru/tsuru/event"
+	"github.com/tsuru/tsuru/event/retention"
+	"github.com/tsuru/tsuru/event/webhook"
 	"github.com/tsuru/tsuru/hc"
 	"github.com/tsuru/tsuru/healer"
 	"github.com/tsuru/tsuru/log"
@@ -102,6 +107,10 @@ func setupServices() error {
 		return err
 	}
 	servicemanager.Platform, err = app.PlatformService()
+	if err != nil {
+		return err
+	}
+	servicemanager.AppLog, err = app.AppLogService()
 	return err
 }
 
@@ -132,6 +141,7 @@ func RunServer(dry bool) http.Handler {
 		m.Add("1.0", "Get", "/", Handler(index))
 	}
 	m.Add("1.0", "Get", "/info", Handler(info))
+	m.Add("1.7", "Get", "/.well-known/acme-challenge/{token}", Handler(acmeChallenge))
 
 	m.Add("1.0", "Get", "/services/instances", AuthorizationRequiredHandler(serviceInstances))
 	m.Add("1.0", "Get", "/services/{service}/instances/{instance}", AuthorizationRequiredHandler(serviceInstance))
@@ -180,6 +190,11 @@ func RunServer(dry bool) http.Handler {
 	m.Add("1.0", "Delete", "/apps/{app}/lock", forceDeleteLockHandler)
 	m.Add("1.0", "Put", "/apps/{app}/units", AuthorizationRequiredHandler(addUnits))
 	m.Add("1.0", "Delete", "/apps/{app}/units", AuthorizationRequiredHandler(removeUnits))
+	m.Add("1.7", "Put", "/apps/{app}/units/autoscale", AuthorizationRequiredHandler(setUnitsAutoScale))
+	m.Add("1.7", "Delete", "/apps/{app}/units/autoscale", AuthorizationRequiredHandler(removeUnitsAutoScale))
+	m.Add("1.7", "Get", "/apps/{app}/cron", AuthorizationRequiredHandler(listCronJobs))
+	m.Add("1.7", "Put", "/apps/{app}/cron", AuthorizationRequiredHandler(setCronJob))
+	m.Add("1.7", "Delete", "/apps/{app}/cron/{name}", AuthorizationRequiredHandler(removeCronJob))
 	registerUnitHandler := AuthorizationRequiredHandler(registerUnit)
 	m.Add("1.0", "Post", "/apps/{app}/units/register", registerUnitHandler)
 	setUnitStatusHandler := AuthorizationRequiredHandler(setUnitStatus)
@@ -191,8 +206,11 @@ func RunServer(dry bool) http.Handler {
 	m.Add("1.0", "Post", "/apps/{app}/log", logPostHandler)
 	m.Add("1.0", "Post", "/apps/{appname}/deploy/rollback", AuthorizationRequiredHandler(deployRollback))
 	m.Add("1.4", "Put", "/apps/{appname}/deploy/rollback/update", AuthorizationRequiredHandler(deployRollbackUpdate))
+	m.Add("1.7", "Put", "/apps/{appname}/deploy/approval", AuthorizationRequiredHandler(deployApprovalUpdate))
 	m.Add("1.3", "Post", "/apps/{appname}/deploy/rebuild", AuthorizationRequiredHandler(deployRebuild))
+	m.Add("1.7", "Post", "/apps/{appname}/deploy/canary/{action}", AuthorizationRequiredHandler(deployCanaryFinish))
 	m.Add("1.0", "Get", "/apps/{app}/metric/envs", AuthorizationRequiredHandler(appMetricEnvs))
+	m.Add("1.7", "Get", "/apps/{app}/metrics", AuthorizationRequiredHandler(appMetrics))
 	m.Add("1.0", "Post", "/apps/{app}/routes", AuthorizationRequiredHandler(appRebuildRoutes))
 	m.Add("1.2", "Get", "/apps/{app}/certificate", AuthorizationRequiredHandler(listCertificates))
 	m.Add("1.2", "Put", "/apps/{app}/certificate", AuthorizationRequiredHandler(setCertificate))
@@ -202,6 +220,9 @@ func RunServer(dry bool) http.Handler {
 	m.Add("1.5", "Put", "/apps/{app}/routers/{router}", AuthorizationRequiredHandler(updateAppRouter))
 	m.Add("1.5", "Delete", "/apps/{app}/routers/{router}", AuthorizationRequiredHandler(removeAppRouter))
 	m.Add("1.5", "Get", "/apps/{app}/routers", AuthorizationRequiredHandler(listAppRouters))
+	m.Add("1.7", "Get", "/apps/{app}/process-routes", AuthorizationRequiredHandler(listAppProcessRoutes))
+	m.Add("1.7", "Put", "/apps/{app}/process-routes", AuthorizationRequiredHandler(setAppProcessRoute))
+	m.Add("1.7", "Delete", "/apps/{app}/process-routes", AuthorizationRequiredHandler(removeAppProcessRoute))
 
 	m.Add("1.0", "Post", "/node/status", AuthorizationRequiredHandler(setNodeStatus))
 
@@ -213,8 +234,18 @@ func RunServer(dry bool) http.Handler {
 	m.Add("1.3", "Post", "/events/blocks", AuthorizationRequiredHandler(eventBlockAdd))
 	m.Add("1.3", "Delete", "/events/blocks/{uuid}", AuthorizationRequiredHandler(eventBlockRemove))
 	m.Add("1.1", "Get", "/events/kinds", AuthorizationRequiredHandler(kindList))
+	m.Add("1.7", "Get", "/events/stream", AuthorizationRequiredHandler(eventStream))
+	m.Add("1.7", "Get", "/events/export", AuthorizationRequiredHandler(eventExport))
+	m.Add("1.7", "Get", "/events/webhooks", AuthorizationRequiredHandler(webhookList))
+	m.Add("1.7", "Post", "/events/webhooks", AuthorizationRequiredHandler(webhookCreate))
+	m.Add("1.7", "Get", "/events/webhooks/{name}", AuthorizationRequiredHandler(webhookInfo))
+	m.Add("1.7", "Put", "/events/webhooks/{name}", AuthorizationRequiredHandler(webhookUpdate))
+	m.Add("1.7", "Delete", "/events/webhooks/{name}", AuthorizationRequiredHandler(webhookDelete))
+	m.Add("1.7", "Post", "/events/webhooks/{name}/test", AuthorizationRequiredHandler(webhookTest))
+	m.Add("1.7", "Get", "/events/webhooks/{name}/deliveries", AuthorizationRequiredHandler(webhookDeliveries))
 	m.Add("1.1", "Get", "/events/{uuid}", AuthorizationRequiredHandler(eventInfo))
 	m.Add("1.1", "Post", "/events/{uuid}/cancel", AuthorizationRequiredHandler(eventCancel))
+	m.Add("1.7", "Post", "/events/{uuid}/approve", AuthorizationRequiredHandler(eventApprove))
 
 	m.Add("1.0", "Get", "/platforms", AuthorizationRequiredHandler(platformList))
 	m.Add("1.0", "Post", "/platforms", AuthorizationRequiredHandler(platformAdd))
@@ -263,6 +294,8 @@ func RunServer(dry bool) http.Handler {
 	m.Add("1.0", "Delete", "/teams/{name}", AuthorizationRequiredHandler(removeTeam))
 	m.Add("1.4", "Post", "/teams/{name}", AuthorizationRequiredHandler(updateTeam))
 	m.Add("1.4", "Get", "/teams/{name}", AuthorizationRequiredHandler(teamInfo))
+	m.Add("1.7", "Get", "/teams/{name}/quota", AuthorizationRequiredHandler(getTeamQuota))
+	m.Add("1.7", "Put", "/teams/{name}/quota", AuthorizationRequiredHandler(changeTeamQuota))
 
 	m.Add("1.0", "Post", "/swap", AuthorizationRequiredHandler(swap))
 
@@ -470,6 +503,18 @@ func appFinder(appName string) (rebuild.RebuildApp, error) {
 	return a, err
 }
 
+func rebuildAppsLister() ([]rebuild.RebuildApp, error) {
+	apps, err := app.List(nil)
+	if err != nil {
+		return nil, err
+	}
+	rebuildApps := make([]rebuild.RebuildApp, len(apps))
+	for i := range apps {
+		rebuildApps[i] = &apps[i]
+	}
+	return rebuildApps, nil
+}
+
 func bindAppsLister() ([]bind.App, error) {
 	apps, err := app.List(nil)
 	if err != nil {
@@ -503,6 +548,8 @@ func startServer(handler http.Handler) error {
 	}()
 
 	shutdown.Register(&logTracker)
+	shutdown.Register(&eventTracker)
+	shutdown.Register(&backgroundDeploys)
 	var startupMessage string
 	err = router.Initialize()
 	if err != nil {
@@ -525,6 +572,12 @@ func startServer(handler http.Handler) error {
 				fmt.Printf(": %s", startupMessage)
 			}
 		}
+		if syncRouter, ok := r.(router.SyncRouter); ok {
+			err = syncRouter.StartSync()
+			if err != nil {
+				return err
+			}
+		}
 		fmt.Println()
 	}
 	defaultRouter, _ := router.Default()
@@ -564,10 +617,42 @@ func startServer(handler http.Handler) error {
 	if err != nil {
 		return err
 	}
+	err = autoscale.InitializeUnits()
+	if err != nil {
+		return err
+	}
+	err = cronjob.Initialize()
+	if err != nil {
+		return err
+	}
+	err = autocert.Initialize()
+	if err != nil {
+		return errors.Wrap(err, "unable to initialize acme certificates")
+	}
+	err = certexpiry.Initialize()
+	if err != nil {
+		return err
+	}
+	err = rebuild.InitializeAuditor(rebuildAppsLister)
+	if err != nil {
+		return err
+	}
 	err = event.Initialize()
 	if err != nil {
 		return errors.Wrap(err, "unable to load events throttling config")
 	}
+	err = webhook.Initialize()
+	if err != nil {
+		return err
+	}
+	err = app.InitializeDeployApproval()
+	if err != nil {
+		return err
+	}
+	err = retention.Initialize()
+	if err != nil {
+		return err
+	}
 	err = gc.Initialize()
 	if err != nil {
 		return errors.Wrap(err, "unable to initialize old image gc")
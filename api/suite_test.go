@@ -108,6 +108,7 @@ func (s *S) SetUpTest(c *check.C) {
 	config.Set("routers:fake-tls:type", "fake-tls")
 	routertest.FakeRouter.Reset()
 	routertest.TLSRouter.Reset()
+	routertest.PathRouter.Reset()
 	repositorytest.Reset()
 	var err error
 	s.conn, err = db.Conn()
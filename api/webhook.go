@@ -0,0 +1,259 @@
+// Copyright 2018 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/ajg/form"
+	"github.com/tsuru/tsuru/auth"
+	"github.com/tsuru/tsuru/errors"
+	"github.com/tsuru/tsuru/event"
+	"github.com/tsuru/tsuru/event/webhook"
+	"github.com/tsuru/tsuru/permission"
+)
+
+func webhookFromForm(r *http.Request) (*webhook.Webhook, error) {
+	err := r.ParseForm()
+	if err != nil {
+		return nil, &errors.HTTP{Code: http.StatusBadRequest, Message: err.Error()}
+	}
+	dec := form.NewDecoder(nil)
+	dec.IgnoreUnknownKeys(true)
+	dec.IgnoreCase(true)
+	var w webhook.Webhook
+	err = dec.DecodeValues(&w, r.Form)
+	if err != nil {
+		return nil, &errors.HTTP{Code: http.StatusBadRequest, Message: fmt.Sprintf("unable to parse webhook: %s", err)}
+	}
+	err = dec.DecodeValues(&w.EventFilter, r.Form)
+	if err != nil {
+		return nil, &errors.HTTP{Code: http.StatusBadRequest, Message: fmt.Sprintf("unable to parse webhook filter: %s", err)}
+	}
+	w.EventFilter.LoadKindNames(r.Form)
+	return &w, nil
+}
+
+func loadWebhook(name string, t auth.Token, perm *permission.PermissionScheme) (*webhook.Webhook, error) {
+	w, err := webhook.Get(name)
+	if err != nil {
+		if err == webhook.ErrWebhookNotFound {
+			return nil, &errors.HTTP{Code: http.StatusNotFound, Message: err.Error()}
+		}
+		return nil, err
+	}
+	if !permission.Check(t, perm, permission.Context(permission.CtxTeam, w.TeamOwner)) {
+		return nil, permission.ErrUnauthorized
+	}
+	return w, nil
+}
+
+// title: webhook list
+// path: /events/webhooks
+// method: GET
+// produce: application/json
+// responses:
+//   200: List webhooks
+//   204: No content
+func webhookList(w http.ResponseWriter, r *http.Request, t auth.Token) error {
+	contexts := permission.ContextsForPermission(t, permission.PermWebhookRead)
+	if len(contexts) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	}
+	var teams []string
+	for _, ctx := range contexts {
+		if ctx.CtxType == permission.CtxGlobal {
+			teams = nil
+			break
+		}
+		teams = append(teams, ctx.Value)
+	}
+	hooks, err := webhook.List(teams)
+	if err != nil {
+		return err
+	}
+	if len(hooks) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	}
+	for i := range hooks {
+		hooks[i].Secret = ""
+	}
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(hooks)
+}
+
+// title: webhook info
+// path: /events/webhooks/{name}
+// method: GET
+// produce: application/json
+// responses:
+//   200: Show webhook
+//   401: Unauthorized
+//   404: Webhook not found
+func webhookInfo(w http.ResponseWriter, r *http.Request, t auth.Token) error {
+	hook, err := loadWebhook(r.URL.Query().Get(":name"), t, permission.PermWebhookRead)
+	if err != nil {
+		return err
+	}
+	hook.Secret = ""
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(hook)
+}
+
+// title: webhook create
+// path: /events/webhooks
+// method: POST
+// consume: application/x-www-form-urlencoded
+// produce: application/json
+// responses:
+//   201: Webhook created
+//   400: Invalid data
+//   401: Unauthorized
+//   409: Webhook already exists
+func webhookCreate(w http.ResponseWriter, r *http.Request, t auth.Token) (err error) {
+	hook, err := webhookFromForm(r)
+	if err != nil {
+		return err
+	}
+	teamCtx := permission.Context(permission.CtxTeam, hook.TeamOwner)
+	if !permission.Check(t, permission.PermWebhookCreate, teamCtx) {
+		return permission.ErrUnauthorized
+	}
+	evt, err := event.New(&event.Opts{
+		Target:     event.Target{Type: event.TargetTypeWebhook, Value: hook.Name},
+		Kind:       permission.PermWebhookCreate,
+		Owner:      t,
+		CustomData: event.FormToCustomData(r.Form),
+		Allowed:    event.Allowed(permission.PermWebhookReadEvents, teamCtx),
+	})
+	if err != nil {
+		return err
+	}
+	defer func() { evt.Done(err) }()
+	err = webhook.Create(hook)
+	if err == webhook.ErrWebhookAlreadyExists {
+		return &errors.HTTP{Code: http.StatusConflict, Message: err.Error()}
+	}
+	if err != nil {
+		return err
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	return json.NewEncoder(w).Encode(hook)
+}
+
+// title: webhook update
+// path: /events/webhooks/{name}
+// method: PUT
+// consume: application/x-www-form-urlencoded
+// responses:
+//   200: Webhook updated
+//   400: Invalid data
+//   401: Unauthorized
+//   404: Webhook not found
+func webhookUpdate(w http.ResponseWriter, r *http.Request, t auth.Token) (err error) {
+	hook, err := webhookFromForm(r)
+	if err != nil {
+		return err
+	}
+	hook.Name = r.URL.Query().Get(":name")
+	old, err := loadWebhook(hook.Name, t, permission.PermWebhookUpdate)
+	if err != nil {
+		return err
+	}
+	if hook.TeamOwner == "" {
+		hook.TeamOwner = old.TeamOwner
+	}
+	teamCtx := permission.Context(permission.CtxTeam, hook.TeamOwner)
+	if !permission.Check(t, permission.PermWebhookUpdate, teamCtx) {
+		return permission.ErrUnauthorized
+	}
+	evt, err := event.New(&event.Opts{
+		Target:     event.Target{Type: event.TargetTypeWebhook, Value: hook.Name},
+		Kind:       permission.PermWebhookUpdate,
+		Owner:      t,
+		CustomData: event.FormToCustomData(r.Form),
+		Allowed: event.Allowed(permission.PermWebhookReadEvents,
+			permission.Context(permission.CtxTeam, old.TeamOwner), teamCtx),
+	})
+	if err != nil {
+		return err
+	}
+	defer func() { evt.Done(err) }()
+	return webhook.Update(hook)
+}
+
+// title: webhook delete
+// path: /events/webhooks/{name}
+// method: DELETE
+// responses:
+//   200: Webhook deleted
+//   401: Unauthorized
+//   404: Webhook not found
+func webhookDelete(w http.ResponseWriter, r *http.Request, t auth.Token) (err error) {
+	hook, err := loadWebhook(r.URL.Query().Get(":name"), t, permission.PermWebhookDelete)
+	if err != nil {
+		return err
+	}
+	evt, err := event.New(&event.Opts{
+		Target:  event.Target{Type: event.TargetTypeWebhook, Value: hook.Name},
+		Kind:    permission.PermWebhookDelete,
+		Owner:   t,
+		Allowed: event.Allowed(permission.PermWebhookReadEvents, permission.Context(permission.CtxTeam, hook.TeamOwner)),
+	})
+	if err != nil {
+		return err
+	}
+	defer func() { evt.Done(err) }()
+	return webhook.Delete(hook.Name)
+}
+
+// title: webhook test
+// path: /events/webhooks/{name}/test
+// method: POST
+// produce: application/json
+// responses:
+//   200: Test delivery result
+//   401: Unauthorized
+//   404: Webhook not found
+func webhookTest(w http.ResponseWriter, r *http.Request, t auth.Token) error {
+	hook, err := loadWebhook(r.URL.Query().Get(":name"), t, permission.PermWebhookUpdate)
+	if err != nil {
+		return err
+	}
+	delivery := webhook.SendTest(hook)
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(delivery)
+}
+
+// title: webhook deliveries
+// path: /events/webhooks/{name}/deliveries
+// method: GET
+// produce: application/json
+// responses:
+//   200: List of recent deliveries
+//   204: No content
+//   401: Unauthorized
+//   404: Webhook not found
+func webhookDeliveries(w http.ResponseWriter, r *http.Request, t auth.Token) error {
+	hook, err := loadWebhook(r.URL.Query().Get(":name"), t, permission.PermWebhookRead)
+	if err != nil {
+		return err
+	}
+	deliveries, err := webhook.ListDeliveries(hook.Name)
+	if err != nil {
+		return err
+	}
+	if len(deliveries) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	}
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(deliveries)
+}
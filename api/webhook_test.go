@@ -0,0 +1,184 @@
+// Copyright 2018 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	"github.com/tsuru/tsuru/event"
+	"github.com/tsuru/tsuru/event/eventtest"
+	"github.com/tsuru/tsuru/event/webhook"
+	"github.com/tsuru/tsuru/permission"
+	"gopkg.in/check.v1"
+)
+
+func (s *S) TestWebhookCreate(c *check.C) {
+	body := strings.NewReader(`name=deploys&teamowner=tsuruteam&url=https://hooks.example.com/x&target.type=app&kindname=app.deploy&successonly=true&limit=10`)
+	request, err := http.NewRequest("POST", "/1.7/events/webhooks", body)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("authorization", "bearer "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	s.testServer.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusCreated)
+	var created webhook.Webhook
+	err = json.Unmarshal(recorder.Body.Bytes(), &created)
+	c.Assert(err, check.IsNil)
+	c.Assert(created.Secret, check.Not(check.Equals), "")
+	hook, err := webhook.Get("deploys")
+	c.Assert(err, check.IsNil)
+	c.Assert(hook, check.DeepEquals, &webhook.Webhook{
+		Name:      "deploys",
+		TeamOwner: "tsuruteam",
+		URL:       "https://hooks.example.com/x",
+		Secret:    created.Secret,
+		EventFilter: event.Filter{
+			Target:      event.Target{Type: event.TargetTypeApp},
+			KindNames:   []string{"app.deploy"},
+			SuccessOnly: true,
+		},
+	})
+	c.Assert(eventtest.EventDesc{
+		Target: event.Target{Type: event.TargetTypeWebhook, Value: "deploys"},
+		Owner:  s.token.GetUserName(),
+		Kind:   "webhook.create",
+		StartCustomData: []map[string]interface{}{
+			{"name": "name", "value": "deploys"},
+			{"name": "teamowner", "value": "tsuruteam"},
+		},
+	}, eventtest.HasEvent)
+	request, err = http.NewRequest("POST", "/1.7/events/webhooks", strings.NewReader(`name=deploys&teamowner=tsuruteam&url=https://hooks.example.com/x`))
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("authorization", "bearer "+s.token.GetValue())
+	recorder = httptest.NewRecorder()
+	s.testServer.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusConflict)
+}
+
+func (s *S) TestWebhookCreateInvalid(c *check.C) {
+	body := strings.NewReader(`name=deploys&teamowner=tsuruteam&url=invalid`)
+	request, err := http.NewRequest("POST", "/1.7/events/webhooks", body)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("authorization", "bearer "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	s.testServer.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusBadRequest)
+	c.Assert(recorder.Body.String(), check.Matches, `invalid webhook url "invalid".*\n`)
+}
+
+func (s *S) TestWebhookCreateUnauthorized(c *check.C) {
+	token := userWithPermission(c, permission.Permission{
+		Scheme:  permission.PermWebhookCreate,
+		Context: permission.Context(permission.CtxTeam, "otherteam"),
+	})
+	body := strings.NewReader(`name=deploys&teamowner=tsuruteam&url=https://hooks.example.com/x`)
+	request, err := http.NewRequest("POST", "/1.7/events/webhooks", body)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("authorization", "bearer "+token.GetValue())
+	recorder := httptest.NewRecorder()
+	s.testServer.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusForbidden)
+}
+
+func (s *S) TestWebhookList(c *check.C) {
+	err := webhook.Create(&webhook.Webhook{Name: "hook1", TeamOwner: "tsuruteam", URL: "http://a.com"})
+	c.Assert(err, check.IsNil)
+	err = webhook.Create(&webhook.Webhook{Name: "hook2", TeamOwner: "otherteam", URL: "http://b.com"})
+	c.Assert(err, check.IsNil)
+	token := userWithPermission(c, permission.Permission{
+		Scheme:  permission.PermWebhookRead,
+		Context: permission.Context(permission.CtxTeam, "otherteam"),
+	})
+	request, err := http.NewRequest("GET", "/1.7/events/webhooks", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("authorization", "bearer "+token.GetValue())
+	recorder := httptest.NewRecorder()
+	s.testServer.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	var hooks []webhook.Webhook
+	err = json.Unmarshal(recorder.Body.Bytes(), &hooks)
+	c.Assert(err, check.IsNil)
+	c.Assert(hooks, check.HasLen, 1)
+	c.Assert(hooks[0].Name, check.Equals, "hook2")
+	c.Assert(hooks[0].Secret, check.Equals, "")
+}
+
+func (s *S) TestWebhookUpdate(c *check.C) {
+	err := webhook.Create(&webhook.Webhook{Name: "hook1", TeamOwner: "tsuruteam", URL: "http://a.com", Secret: "abc"})
+	c.Assert(err, check.IsNil)
+	body := strings.NewReader(`url=http://b.com&description=new+url&erroronly=true`)
+	request, err := http.NewRequest("PUT", "/1.7/events/webhooks/hook1", body)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("authorization", "bearer "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	s.testServer.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	hook, err := webhook.Get("hook1")
+	c.Assert(err, check.IsNil)
+	c.Assert(hook, check.DeepEquals, &webhook.Webhook{
+		Name:        "hook1",
+		TeamOwner:   "tsuruteam",
+		URL:         "http://b.com",
+		Description: "new url",
+		Secret:      "abc",
+		EventFilter: event.Filter{ErrorOnly: true},
+	})
+}
+
+func (s *S) TestWebhookDelete(c *check.C) {
+	err := webhook.Create(&webhook.Webhook{Name: "hook1", TeamOwner: "tsuruteam", URL: "http://a.com"})
+	c.Assert(err, check.IsNil)
+	request, err := http.NewRequest("DELETE", "/1.7/events/webhooks/hook1", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("authorization", "bearer "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	s.testServer.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	_, err = webhook.Get("hook1")
+	c.Assert(err, check.Equals, webhook.ErrWebhookNotFound)
+	recorder = httptest.NewRecorder()
+	s.testServer.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusNotFound)
+}
+
+func (s *S) TestWebhookTestAndDeliveries(c *check.C) {
+	var received []*http.Request
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = append(received, r)
+	}))
+	defer srv.Close()
+	err := webhook.Create(&webhook.Webhook{Name: "hook1", TeamOwner: "tsuruteam", URL: srv.URL})
+	c.Assert(err, check.IsNil)
+	request, err := http.NewRequest("POST", "/1.7/events/webhooks/hook1/test", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("authorization", "bearer "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	s.testServer.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	var result webhook.Delivery
+	err = json.Unmarshal(recorder.Body.Bytes(), &result)
+	c.Assert(err, check.IsNil)
+	c.Assert(result.StatusCode, check.Equals, http.StatusOK)
+	c.Assert(result.EventKind, check.Equals, webhook.TestEventKind)
+	c.Assert(received, check.HasLen, 1)
+	request, err = http.NewRequest("GET", "/1.7/events/webhooks/hook1/deliveries", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("authorization", "bearer "+s.token.GetValue())
+	recorder = httptest.NewRecorder()
+	s.testServer.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	var deliveries []webhook.Delivery
+	err = json.Unmarshal(recorder.Body.Bytes(), &deliveries)
+	c.Assert(err, check.IsNil)
+	c.Assert(deliveries, check.HasLen, 1)
+	c.Assert(deliveries[0].DeliveryID, check.Equals, result.DeliveryID)
+}
@@ -70,6 +70,33 @@ var reserveUserApp = action.Action{
 	MinParams: 2,
 }
 
+// reserveTeamApp reserves an app in the quota of the team owning the app in
+// Forward and releases it in Backward.
+var reserveTeamApp = action.Action{
+	Name: "reserve-team-app",
+	Forward: func(ctx action.FWContext) (action.Result, error) {
+		var app *App
+		switch ctx.Params[0].(type) {
+		case *App:
+			app = ctx.Params[0].(*App)
+		default:
+			return nil, errors.New("First parameter must be *App.")
+		}
+		if err := reserveTeamQuota(app.TeamOwner, teamQuotaUsage{Apps: 1}); err != nil {
+			return nil, err
+		}
+		return app.TeamOwner, nil
+	},
+	Backward: func(ctx action.BWContext) {
+		team := ctx.FWResult.(string)
+		err := releaseTeamQuota(team, teamQuotaUsage{Apps: 1})
+		if err != nil {
+			log.Errorf("Failed to rollback reserveTeamApp: %s", err)
+		}
+	},
+	MinParams: 1,
+}
+
 // insertApp is an action that inserts an app in the database in Forward and
 // removes it in the Backward.
 //
@@ -280,6 +307,10 @@ var addRouterBackend = action.Action{
 			if err != nil {
 				return nil, err
 			}
+			err = router.SetAccessControlFromOpts(r, app.Name, appRouter.Opts)
+			if err != nil {
+				return nil, err
+			}
 		}
 		return app, nil
 	},
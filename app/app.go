@@ -148,6 +148,13 @@ type App struct {
 	Tags           []string
 	Error          string
 	Routers        []appTypes.AppRouter
+	Canary         *AppCanary                `bson:",omitempty"`
+	BlueGreen      *AppBlueGreen             `bson:",omitempty"`
+	AutoScale      []provision.AutoScaleSpec `bson:",omitempty"`
+	CronJobs       []provision.CronJob       `bson:",omitempty"`
+	Certificates   []CertificateInfo         `bson:",omitempty"`
+	ProcessRoutes  []appTypes.ProcessRoute   `bson:",omitempty"`
+	DeployApproval bool                      `bson:",omitempty"`
 
 	quota.Quota
 	builder     builder.Builder
@@ -250,22 +257,30 @@ func (app *App) MarshalJSON() ([]byte, error) {
 	result["lock"] = app.Lock
 	result["tags"] = app.Tags
 	result["routers"] = routers
+	if app.Canary != nil {
+		result["canary"] = app.Canary
+	}
+	if app.BlueGreen != nil {
+		result["bluegreen"] = app.BlueGreen
+	}
+	if len(app.AutoScale) > 0 {
+		result["autoscale"] = app.AutoScale
+	}
+	if len(app.Certificates) > 0 {
+		result["certificates"] = app.Certificates
+	}
+	if len(app.ProcessRoutes) > 0 {
+		result["processroutes"] = app.ProcessRoutes
+	}
+	if app.DeployApproval {
+		result["deployApproval"] = app.DeployApproval
+	}
 	if len(errMsgs) > 0 {
 		result["error"] = strings.Join(errMsgs, "\n")
 	}
 	return json.Marshal(&result)
 }
 
-// Applog represents a log entry.
-type Applog struct {
-	MongoID bson.ObjectId `bson:"_id,omitempty" json:"-"`
-	Date    time.Time
-	Message string
-	Source  string
-	AppName string
-	Unit    string
-}
-
 type ErrAppNotLocked struct {
 	App string
 }
@@ -418,6 +433,7 @@ func CreateApp(app *App, user *auth.User) error {
 	}
 	actions := []*action.Action{
 		&reserveUserApp,
+		&reserveTeamApp,
 		&insertApp,
 		&createAppToken,
 		&exportEnvironmentsAction,
@@ -527,6 +543,21 @@ func (app *App) Update(updateData App, w io.Writer) (err error) {
 	if err != nil {
 		return err
 	}
+	dbApp, err := GetByName(app.Name)
+	if err != nil {
+		return err
+	}
+	units := dbApp.Quota.InUse
+	finishTeamQuota, err := app.reserveTeamQuotaForUpdate(&oldApp, units)
+	if err != nil {
+		return err
+	}
+	defer func() { finishTeamQuota(err) }()
+	finishPoolCapacity, err := app.reservePoolCapacityForUpdate(&oldApp, units)
+	if err != nil {
+		return err
+	}
+	defer func() { finishPoolCapacity(err) }()
 	actions := []*action.Action{
 		&saveApp,
 	}
@@ -541,6 +572,91 @@ func (app *App) Update(updateData App, w io.Writer) (err error) {
 	return action.NewPipeline(actions...).Execute(app, &oldApp, w)
 }
 
+// reserveTeamQuotaForUpdate reserves in the team owning the app the resources
+// required by the changes in plan and team owner made to the app. The
+// returned function must be called with the result of the update, releasing
+// either the resources used in the old team owner or the reserved ones.
+func (app *App) reserveTeamQuotaForUpdate(oldApp *App, units int) (func(error), error) {
+	newUsage := unitsTeamQuotaUsage(app, units)
+	if app.TeamOwner == oldApp.TeamOwner {
+		newUsage.Memory -= units * int(oldApp.Plan.Memory)
+		newUsage.Units = 0
+		if newUsage.Memory == 0 {
+			return func(error) {}, nil
+		}
+	} else {
+		newUsage.Apps = 1
+	}
+	err := reserveTeamQuota(app.TeamOwner, newUsage)
+	if err != nil {
+		return nil, err
+	}
+	return func(err error) {
+		team, usage := app.TeamOwner, newUsage
+		if err == nil {
+			if app.TeamOwner == oldApp.TeamOwner {
+				return
+			}
+			team, usage = oldApp.TeamOwner, unitsTeamQuotaUsage(oldApp, units)
+			usage.Apps = 1
+		}
+		if releaseErr := releaseTeamQuota(team, usage); releaseErr != nil {
+			log.Errorf("unable to release quota of team %s: %s", team, releaseErr)
+		}
+	}, nil
+}
+
+// reservePoolCapacityForUpdate reserves in the pool of the app the resources
+// required by the changes in plan and pool made to the app. The returned
+// function must be called with the result of the update, releasing either the
+// resources used in the old pool or the reserved ones.
+func (app *App) reservePoolCapacityForUpdate(oldApp *App, units int) (func(error), error) {
+	plan := app.Plan
+	samePool := app.GetPool() == oldApp.GetPool()
+	if samePool {
+		plan.Memory -= oldApp.Plan.Memory
+		plan.CpuShare -= oldApp.Plan.CpuShare
+		if plan.Memory == 0 && plan.CpuShare == 0 {
+			return func(error) {}, nil
+		}
+	}
+	err := reservePoolCapacity(app.GetPool(), units, plan)
+	if err != nil {
+		return nil, err
+	}
+	return func(err error) {
+		poolName := app.GetPool()
+		if err == nil {
+			if samePool {
+				return
+			}
+			poolName, plan = oldApp.GetPool(), oldApp.Plan
+		}
+		if releaseErr := releasePoolCapacity(poolName, units, plan); releaseErr != nil {
+			log.Errorf("unable to release capacity of pool %s: %s", poolName, releaseErr)
+		}
+	}, nil
+}
+
+// reservePoolCapacity reserves in the pool the resources required by the
+// given number of units using the plan. Pool existence is validated
+// elsewhere, an unknown pool has no capacity to enforce.
+func reservePoolCapacity(poolName string, units int, plan appTypes.Plan) error {
+	if poolName == "" || units == 0 {
+		return nil
+	}
+	return pool.ReserveCapacity(poolName, int64(units)*plan.Memory, int64(units)*int64(plan.CpuShare))
+}
+
+// releasePoolCapacity releases from the pool the resources used by the given
+// number of units using the plan.
+func releasePoolCapacity(poolName string, units int, plan appTypes.Plan) error {
+	if poolName == "" || units == 0 {
+		return nil
+	}
+	return pool.ReleaseCapacity(poolName, int64(units)*plan.Memory, int64(units)*int64(plan.CpuShare))
+}
+
 func processTags(tags []string) []string {
 	if tags == nil {
 		return nil
@@ -641,6 +757,12 @@ func Delete(app *App, evt *event.Event, requestID string) error {
 	if err != nil {
 		return err
 	}
+	if app.BlueGreen != nil {
+		err = app.removeBlueGreen(prov, evt)
+		if err != nil {
+			logErr("Unable to remove blue/green shadow units", err)
+		}
+	}
 	err = prov.Destroy(app)
 	if err != nil {
 		logErr("Unable to destroy app in provisioner", err)
@@ -710,21 +832,30 @@ func Delete(app *App, evt *event.Event, requestID string) error {
 	if err != nil {
 		logErr("Unable to release app quota", err)
 	}
-	logConn, err := db.LogConn()
-	if err == nil {
-		defer logConn.Close()
-		err = logConn.Logs(appName).DropCollection()
+	err = appLogService().Remove(appName)
+	if err != nil {
+		logErr("Unable to remove logs", err)
 	}
+	// units not released by the provisioner while destroying the app are
+	// released from the team quota and pool capacity along with the app quota,
+	// so that they're never released twice.
+	err = app.SetQuotaInUse(0)
 	if err != nil {
-		logErr("Unable to remove logs collection", err)
+		logErr("Unable to release units quota", err)
 	}
 	conn, err := db.Conn()
+	var removedApp App
 	if err == nil {
 		defer conn.Close()
-		err = conn.Apps().Remove(bson.M{"name": appName})
+		_, err = conn.Apps().Find(bson.M{"name": appName}).Apply(mgo.Change{Remove: true}, &removedApp)
 	}
 	if err != nil {
 		logErr("Unable to remove app from db", err)
+	} else {
+		err = releaseTeamQuota(removedApp.TeamOwner, teamQuotaUsage{Apps: 1})
+		if err != nil {
+			logErr("Unable to release team quota", err)
+		}
 	}
 	err = event.MarkAsRemoved(event.Target{Type: event.TargetTypeApp, Value: appName})
 	if err != nil {
@@ -893,6 +1024,12 @@ func UpdateNodeStatus(nodeData provision.NodeStatusData) ([]UpdateUnitsResult, e
 		if err != nil && !isNotFound {
 			return nil, err
 		}
+		if !isNotFound {
+			err = storeUnitMetrics(unitData)
+			if err != nil {
+				log.Errorf("[update node status] unable to store metrics for unit %q: %s", unitData.ID, err)
+			}
+		}
 		result[i] = UpdateUnitsResult{ID: unitData.ID, Found: !isNotFound}
 	}
 	return result, nil
@@ -1105,7 +1242,29 @@ func (app *App) validatePool() error {
 	if err != nil {
 		return err
 	}
-	return pool.ValidateRouters(app.GetRouters())
+	err = pool.ValidateRouters(app.GetRouters())
+	if err != nil {
+		return err
+	}
+	for _, appRouter := range app.GetRouters() {
+		err = validateRouterOpts(appRouter)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func validateRouterOpts(appRouter appTypes.AppRouter) error {
+	r, err := router.Get(appRouter.Name)
+	if err != nil {
+		return err
+	}
+	err = router.ValidateOpts(r, appRouter.Opts)
+	if err != nil {
+		return &tsuruErrors.ValidationError{Message: err.Error()}
+	}
+	return nil
 }
 
 func (app *App) validateTeamOwner(p *pool.Pool) error {
@@ -1364,11 +1523,27 @@ func (app *App) SetQuotaInUse(inUse int) error {
 		return err
 	}
 	defer conn.Close()
-	err = conn.Apps().Update(bson.M{"name": app.Name}, bson.M{"$set": bson.M{"quota.inuse": inUse}})
+	var oldApp App
+	_, err = conn.Apps().Find(bson.M{"name": app.Name}).Apply(mgo.Change{
+		Update: bson.M{"$set": bson.M{"quota.inuse": inUse}},
+	}, &oldApp)
 	if err == mgo.ErrNotFound {
 		return ErrAppNotFound
 	}
-	return err
+	if err != nil {
+		return err
+	}
+	// units were already added by the provisioner, so the team usage is
+	// only updated to match them, without enforcing its limits.
+	released := oldApp.Quota.InUse - inUse
+	if released == 0 {
+		return nil
+	}
+	err = releasePoolCapacity(oldApp.GetPool(), released, oldApp.Plan)
+	if err != nil {
+		return err
+	}
+	return releaseTeamQuota(oldApp.TeamOwner, unitsTeamQuotaUsage(&oldApp, released))
 }
 
 // GetCname returns the cnames of the app.
@@ -1587,38 +1762,27 @@ func (app *App) RemoveInstance(removeArgs bind.RemoveInstanceArgs) error {
 // Log adds a log message to the app. Specifying a good source is good so the
 // user can filter where the message come from.
 func (app *App) Log(message, source, unit string) error {
-	messages := strings.Split(message, "\n")
-	logs := make([]interface{}, 0, len(messages))
-	for _, msg := range messages {
-		if msg != "" {
-			l := Applog{
-				Date:    time.Now().In(time.UTC),
-				Message: msg,
-				Source:  source,
-				AppName: app.Name,
-				Unit:    unit,
-			}
-			logs = append(logs, l)
-		}
-	}
-	if len(logs) > 0 {
-		conn, err := db.LogConn()
-		if err != nil {
-			return err
-		}
-		defer conn.Close()
-		return conn.Logs(app.Name).Insert(logs...)
-	}
-	return nil
+	return appLogService().Add(app.Name, message, source, unit)
 }
 
 // LastLogs returns a list of the last `lines` log of the app, matching the
 // fields in the log instance received as an example.
-func (app *App) LastLogs(lines int, filterLog Applog) ([]Applog, error) {
+func (app *App) LastLogs(lines int, filterLog appTypes.Applog) ([]appTypes.Applog, error) {
 	return app.lastLogs(lines, filterLog, false)
 }
 
-func (app *App) lastLogs(lines int, filterLog Applog, invertFilter bool) ([]Applog, error) {
+func (app *App) lastLogs(lines int, filterLog appTypes.Applog, invertFilter bool) ([]appTypes.Applog, error) {
+	return app.SearchLogs(appTypes.ListLogArgs{
+		Source:       filterLog.Source,
+		Unit:         filterLog.Unit,
+		Limit:        lines,
+		InvertFilter: invertFilter,
+	})
+}
+
+// SearchLogs returns the log entries of the app matching args, the AppName
+// in args is ignored.
+func (app *App) SearchLogs(args appTypes.ListLogArgs) ([]appTypes.Applog, error) {
 	prov, err := app.getProvisioner()
 	if err != nil {
 		return nil, err
@@ -1635,33 +1799,8 @@ func (app *App) lastLogs(lines int, filterLog Applog, invertFilter bool) ([]Appl
 			return nil, errors.New(doc)
 		}
 	}
-	conn, err := db.LogConn()
-	if err != nil {
-		return nil, err
-	}
-	defer conn.Close()
-	logs := []Applog{}
-	q := bson.M{}
-	if filterLog.Source != "" {
-		q["source"] = filterLog.Source
-	}
-	if filterLog.Unit != "" {
-		q["unit"] = filterLog.Unit
-	}
-	if invertFilter {
-		for k, v := range q {
-			q[k] = bson.M{"$ne": v}
-		}
-	}
-	err = conn.Logs(app.Name).Find(q).Sort("-$natural").Limit(lines).All(&logs)
-	if err != nil {
-		return nil, err
-	}
-	l := len(logs)
-	for i := 0; i < l/2; i++ {
-		logs[i], logs[l-1-i] = logs[l-1-i], logs[i]
-	}
-	return logs, nil
+	args.AppName = app.Name
+	return appLogService().List(args)
 }
 
 type Filter struct {
@@ -1674,6 +1813,8 @@ type Filter struct {
 	Pools       []string
 	Statuses    []string
 	Locked      bool
+	AutoScale   bool
+	CronJobs    bool
 	Tags        []string
 	Extra       map[string][]string
 }
@@ -1720,6 +1861,12 @@ func (f *Filter) Query() bson.M {
 	if f.Locked {
 		query["lock.locked"] = true
 	}
+	if f.AutoScale {
+		query["autoscale"] = bson.M{"$exists": true}
+	}
+	if f.CronJobs {
+		query["cronjobs"] = bson.M{"$exists": true}
+	}
 	if len(f.Pools) > 0 {
 		query["pool"] = bson.M{"$in": f.Pools}
 	}
@@ -1985,6 +2132,10 @@ func (app *App) RegisterUnit(unitId string, customData map[string]interface{}) e
 }
 
 func (app *App) AddRouter(appRouter appTypes.AppRouter) error {
+	err := validateRouterOpts(appRouter)
+	if err != nil {
+		return err
+	}
 	defer rebuild.RoutesRebuildOrEnqueue(app.Name)
 	r, err := router.Get(appRouter.Name)
 	if err != nil {
@@ -1998,10 +2149,13 @@ func (app *App) AddRouter(appRouter appTypes.AppRouter) error {
 	if err != nil {
 		return err
 	}
-	routers := append(app.GetRouters(), appRouter)
-	err = app.updateRoutersDB(routers)
+	err = router.SetAccessControlFromOpts(r, app.Name, appRouter.Opts)
+	if err == nil {
+		routers := append(app.GetRouters(), appRouter)
+		err = app.updateRoutersDB(routers)
+	}
 	if err != nil {
-		rollbackErr := r.RemoveBackend(appRouter.Name)
+		rollbackErr := r.RemoveBackend(app.Name)
 		if rollbackErr != nil {
 			log.Errorf("unable to remove router backend rolling back add router: %v", rollbackErr)
 		}
@@ -2026,17 +2180,27 @@ func (app *App) UpdateRouter(appRouter appTypes.AppRouter) error {
 	if err != nil {
 		return err
 	}
-	optsRouter, ok := r.(router.OptsRouter)
-	if !ok {
+	optsRouter, isOptsRouter := r.(router.OptsRouter)
+	_, isAccessControlRouter := r.(router.AccessControlRouter)
+	if !isOptsRouter && !isAccessControlRouter {
 		return errors.Errorf("updating is not supported by router %q", appRouter.Name)
 	}
+	err = validateRouterOpts(appRouter)
+	if err != nil {
+		return err
+	}
 	oldOpts := existing.Opts
 	existing.Opts = appRouter.Opts
 	err = app.updateRoutersDB(routers)
 	if err != nil {
 		return err
 	}
-	err = optsRouter.UpdateBackendOpts(app, appRouter.Opts)
+	if isOptsRouter {
+		err = optsRouter.UpdateBackendOpts(app, appRouter.Opts)
+	}
+	if err == nil {
+		err = router.SetAccessControlFromOpts(r, app.Name, appRouter.Opts)
+	}
 	if err != nil {
 		existing.Opts = oldOpts
 		rollbackErr := app.updateRoutersDB(routers)
@@ -2155,6 +2319,24 @@ func (app *App) MetricEnvs() (map[string]string, error) {
 	return envs, nil
 }
 
+// UnitsMetrics returns the current resource usage of the units of the app,
+// as reported by its provisioner.
+func (app *App) UnitsMetrics() ([]provision.UnitMetric, error) {
+	prov, err := app.getProvisioner()
+	if err != nil {
+		return nil, err
+	}
+	metricsProv, ok := prov.(provision.MetricsProvisioner)
+	if !ok {
+		return nil, provision.ProvisionerNotSupported{Prov: prov, Action: "reporting unit metrics"}
+	}
+	metrics, err := metricsProv.UnitsMetrics(app)
+	if metrics == nil {
+		metrics = []provision.UnitMetric{}
+	}
+	return metrics, err
+}
+
 func (app *App) Shell(opts provision.ShellOptions) error {
 	opts.App = app
 	prov, err := app.getProvisioner()
@@ -2204,7 +2386,7 @@ func (app *App) SetCertificate(name, certificate, key string) error {
 	if !addedAny {
 		return errors.New("no router with tls support")
 	}
-	return nil
+	return app.saveCertificateInfo(newCertificateInfo(name, x509Cert))
 }
 
 func (app *App) RemoveCertificate(name string) error {
@@ -2231,7 +2413,7 @@ func (app *App) RemoveCertificate(name string) error {
 	if !removedAny {
 		return errors.New("no router with tls support")
 	}
-	return nil
+	return app.removeCertificateInfo(name)
 }
 
 func (app *App) validateNameForCert(name string) error {
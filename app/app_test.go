@@ -688,6 +688,47 @@ func (s *S) TestAddUnitsQuotaExceeded(c *check.C) {
 	c.Assert(units, check.HasLen, 0)
 }
 
+func (s *S) TestAddUnitsPoolCapacityExceeded(c *check.C) {
+	app := App{Name: "warpaint", Platform: "python", TeamOwner: s.team.Name}
+	err := CreateApp(&app, s.user)
+	c.Assert(err, check.IsNil)
+	maxMemory := int64(3072)
+	err = pool.PoolUpdate(s.Pool, pool.UpdatePoolOptions{MaxMemory: &maxMemory})
+	c.Assert(err, check.IsNil)
+	err = app.AddUnits(2, "web", nil)
+	c.Assert(err, check.IsNil)
+	err = app.AddUnits(2, "web", nil)
+	c.Assert(err, check.NotNil)
+	e, ok := err.(*pool.CapacityExceededError)
+	c.Assert(ok, check.Equals, true)
+	c.Assert(e.Pool, check.Equals, s.Pool)
+	c.Assert(e.Resource, check.Equals, "memory")
+	c.Assert(e.Available, check.Equals, uint(1024))
+	c.Assert(e.Requested, check.Equals, uint(2048))
+	c.Assert(s.provisioner.GetUnits(&app), check.HasLen, 2)
+}
+
+func (s *S) TestPoolCapacityReservedByUnits(c *check.C) {
+	maxCPU := int64(150)
+	err := pool.PoolUpdate(s.Pool, pool.UpdatePoolOptions{MaxCPU: &maxCPU})
+	c.Assert(err, check.IsNil)
+	app := App{Name: "warpaint", Platform: "python", TeamOwner: s.team.Name}
+	err = CreateApp(&app, s.user)
+	c.Assert(err, check.IsNil)
+	err = app.AddUnits(1, "web", nil)
+	c.Assert(err, check.IsNil)
+	err = app.AddUnits(1, "web", nil)
+	c.Assert(err, check.ErrorMatches, `Pool "pool1" capacity exceeded for cpu. Available: 50. Requested: 100.`)
+	err = app.RemoveUnits(1, "web", nil)
+	c.Assert(err, check.IsNil)
+	p, err := pool.GetPoolByName(s.Pool)
+	c.Assert(err, check.IsNil)
+	usage, err := p.CapacityUsage()
+	c.Assert(err, check.IsNil)
+	c.Assert(usage.UsedCPU, check.Equals, int64(0))
+	c.Assert(usage.AvailableCPU, check.Equals, int64(150))
+}
+
 func (s *S) TestAddUnitsMultiple(c *check.C) {
 	app := App{
 		Name: "warpaint", Platform: "ruby",
@@ -2237,7 +2278,7 @@ func (s *S) TestLog(c *check.C) {
 	}()
 	err = a.Log("last log msg", "tsuru", "outermachine")
 	c.Assert(err, check.IsNil)
-	var logs []Applog
+	var logs []appTypes.Applog
 	err = s.logConn.Logs(a.Name).Find(nil).All(&logs)
 	c.Assert(err, check.IsNil)
 	c.Assert(logs, check.HasLen, 1)
@@ -2256,7 +2297,7 @@ func (s *S) TestLogShouldAddOneRecordByLine(c *check.C) {
 	}()
 	err = a.Log("last log msg\nfirst log", "source", "machine")
 	c.Assert(err, check.IsNil)
-	var logs []Applog
+	var logs []appTypes.Applog
 	err = s.logConn.Logs(a.Name).Find(nil).Sort("$natural").All(&logs)
 	c.Assert(err, check.IsNil)
 	c.Assert(logs, check.HasLen, 2)
@@ -2279,7 +2320,7 @@ func (s *S) TestLogShouldNotLogBlankLines(c *check.C) {
 
 func (s *S) TestLogWithListeners(c *check.C) {
 	var logs struct {
-		l []Applog
+		l []appTypes.Applog
 		sync.Mutex
 	}
 	a := App{
@@ -2288,7 +2329,7 @@ func (s *S) TestLogWithListeners(c *check.C) {
 	}
 	err := CreateApp(&a, s.user)
 	c.Assert(err, check.IsNil)
-	l, err := NewLogListener(&a, Applog{})
+	l, err := NewLogListener(&a, appTypes.Applog{})
 	c.Assert(err, check.IsNil)
 	defer l.Close()
 	go func() {
@@ -2347,7 +2388,7 @@ func (s *S) TestLastLogs(c *check.C) {
 		time.Sleep(1e6) // let the time flow
 	}
 	app.Log("app3 log from circus", "circus", "rdaneel")
-	logs, err := app.LastLogs(10, Applog{Source: "tsuru"})
+	logs, err := app.LastLogs(10, appTypes.Applog{Source: "tsuru"})
 	c.Assert(err, check.IsNil)
 	c.Assert(logs, check.HasLen, 10)
 	for i := 5; i < 15; i++ {
@@ -2370,7 +2411,7 @@ func (s *S) TestLastLogsUnitFilter(c *check.C) {
 	}
 	app.Log("app3 log from circus", "circus", "rdaneel")
 	app.Log("app3 log from tsuru", "tsuru", "seldon")
-	logs, err := app.LastLogs(10, Applog{Source: "tsuru", Unit: "rdaneel"})
+	logs, err := app.LastLogs(10, appTypes.Applog{Source: "tsuru", Unit: "rdaneel"})
 	c.Assert(err, check.IsNil)
 	c.Assert(logs, check.HasLen, 10)
 	for i := 5; i < 15; i++ {
@@ -2379,6 +2420,35 @@ func (s *S) TestLastLogsUnitFilter(c *check.C) {
 	}
 }
 
+func (s *S) TestSearchLogs(c *check.C) {
+	app := App{
+		Name:      "app3",
+		Platform:  "vougan",
+		TeamOwner: s.team.Name,
+	}
+	err := CreateApp(&app, s.user)
+	c.Assert(err, check.IsNil)
+	for i := 0; i < 10; i++ {
+		app.Log(fmt.Sprintf("request %d failed", i), "tsuru", "rdaneel")
+		app.Log(fmt.Sprintf("request %d ok", i), "tsuru", "rdaneel")
+	}
+	logs, err := app.SearchLogs(appTypes.ListLogArgs{Query: "fail", Limit: 3, Since: time.Now().Add(-time.Hour)})
+	c.Assert(err, check.IsNil)
+	c.Assert(logs, check.HasLen, 3)
+	c.Check(logs[0].Message, check.Equals, "request 7 failed")
+	c.Check(logs[2].Message, check.Equals, "request 9 failed")
+	logs, err = app.SearchLogs(appTypes.ListLogArgs{Query: "fail", Limit: 3, Before: logs[0].Cursor})
+	c.Assert(err, check.IsNil)
+	c.Assert(logs, check.HasLen, 3)
+	c.Check(logs[0].Message, check.Equals, "request 4 failed")
+	c.Check(logs[2].Message, check.Equals, "request 6 failed")
+	logs, err = app.SearchLogs(appTypes.ListLogArgs{Limit: 3, Until: time.Now().Add(-time.Hour)})
+	c.Assert(err, check.IsNil)
+	c.Assert(logs, check.HasLen, 0)
+	_, err = app.SearchLogs(appTypes.ListLogArgs{Limit: 3, Before: "xyz"})
+	c.Assert(err, check.Equals, appTypes.ErrInvalidLogCursor)
+}
+
 func (s *S) TestLastLogsEmpty(c *check.C) {
 	app := App{
 		Name:      "app33",
@@ -2387,9 +2457,9 @@ func (s *S) TestLastLogsEmpty(c *check.C) {
 	}
 	err := CreateApp(&app, s.user)
 	c.Assert(err, check.IsNil)
-	logs, err := app.LastLogs(10, Applog{Source: "tsuru"})
+	logs, err := app.LastLogs(10, appTypes.Applog{Source: "tsuru"})
 	c.Assert(err, check.IsNil)
-	c.Assert(logs, check.DeepEquals, []Applog{})
+	c.Assert(logs, check.DeepEquals, []appTypes.Applog{})
 }
 
 type logDisabledFakeProvisioner struct {
@@ -2415,7 +2485,7 @@ func (s *S) TestLastLogsDisabled(c *check.C) {
 	}
 	err := s.conn.Apps().Insert(app)
 	c.Assert(err, check.IsNil)
-	_, err = app.LastLogs(10, Applog{})
+	_, err = app.LastLogs(10, appTypes.Applog{})
 	c.Assert(err, check.ErrorMatches, "my doc msg")
 }
 
@@ -2626,10 +2696,10 @@ func (s *S) TestRun(c *check.C) {
 	expected += " ls -lh"
 	cmds := s.provisioner.GetCmds(expected, &app)
 	c.Assert(cmds, check.HasLen, 1)
-	var logs []Applog
+	var logs []appTypes.Applog
 	timeout := time.After(5 * time.Second)
 	for {
-		logs, err = app.LastLogs(10, Applog{})
+		logs, err = app.LastLogs(10, appTypes.Applog{})
 		c.Assert(err, check.IsNil)
 		if len(logs) > 1 {
 			break
@@ -4789,6 +4859,81 @@ func (s *S) TestUpdateRouterNotFound(c *check.C) {
 	c.Assert(err, check.DeepEquals, &router.ErrRouterNotFound{Name: "fake-opts"})
 }
 
+func (s *S) TestUpdateRouterAccessControl(c *check.C) {
+	config.Set("routers:fake-access-control:type", "fake-access-control")
+	defer config.Unset("routers:fake-access-control:type")
+	app := App{Name: "myapp", Platform: "go", TeamOwner: s.team.Name}
+	err := CreateApp(&app, s.user)
+	c.Assert(err, check.IsNil)
+	err = app.AddRouter(appTypes.AppRouter{
+		Name: "fake-access-control",
+		Opts: map[string]string{"rate-limit": "10"},
+	})
+	c.Assert(err, check.IsNil)
+	c.Assert(routertest.AccessControlRouter.Rules["myapp"], check.DeepEquals, router.AccessControl{RateLimit: 10})
+	err = app.UpdateRouter(appTypes.AppRouter{Name: "fake-access-control", Opts: map[string]string{
+		"allow-cidrs": "10.0.0.0/8, 192.168.0.0/16",
+	}})
+	c.Assert(err, check.IsNil)
+	c.Assert(routertest.AccessControlRouter.Rules["myapp"], check.DeepEquals, router.AccessControl{
+		Allow: []string{"10.0.0.0/8", "192.168.0.0/16"},
+	})
+}
+
+func (s *S) TestUpdateRouterInvalidAccessControl(c *check.C) {
+	config.Set("routers:fake-access-control:type", "fake-access-control")
+	defer config.Unset("routers:fake-access-control:type")
+	app := App{Name: "myapp", Platform: "go", TeamOwner: s.team.Name}
+	err := CreateApp(&app, s.user)
+	c.Assert(err, check.IsNil)
+	err = app.AddRouter(appTypes.AppRouter{
+		Name: "fake-access-control",
+		Opts: map[string]string{"rate-limit": "10"},
+	})
+	c.Assert(err, check.IsNil)
+	err = app.UpdateRouter(appTypes.AppRouter{Name: "fake-access-control", Opts: map[string]string{
+		"deny-cidrs": "10.0.0.300/8",
+	}})
+	c.Assert(err, check.FitsTypeOf, &errors.ValidationError{})
+	c.Assert(err, check.ErrorMatches, `invalid option "deny-cidrs" for router "fake-access-control": invalid network "10.0.0.300/8"`)
+	routers := app.GetRouters()
+	c.Assert(routers, check.DeepEquals, []appTypes.AppRouter{
+		{Name: "fake"},
+		{Name: "fake-access-control", Opts: map[string]string{"rate-limit": "10"}},
+	})
+	c.Assert(routertest.AccessControlRouter.Rules["myapp"], check.DeepEquals, router.AccessControl{RateLimit: 10})
+}
+
+func (s *S) TestAppAddRouterAccessControlFailureRemovesBackend(c *check.C) {
+	config.Set("routers:fake-access-control:type", "fake-access-control")
+	defer config.Unset("routers:fake-access-control:type")
+	app := App{Name: "myapp", Platform: "go", TeamOwner: s.team.Name}
+	err := CreateApp(&app, s.user)
+	c.Assert(err, check.IsNil)
+	routertest.AccessControlRouter.FailForIp("access-control:myapp")
+	err = app.AddRouter(appTypes.AppRouter{
+		Name: "fake-access-control",
+		Opts: map[string]string{"rate-limit": "10"},
+	})
+	c.Assert(err, check.Equals, routertest.ErrForcedFailure)
+	c.Assert(routertest.AccessControlRouter.HasBackend("myapp"), check.Equals, false)
+	routers := app.GetRouters()
+	c.Assert(routers, check.DeepEquals, []appTypes.AppRouter{{Name: "fake"}})
+}
+
+func (s *S) TestAppAddRouterAccessControlNotSupported(c *check.C) {
+	app := App{Name: "myapp", Platform: "go", TeamOwner: s.team.Name}
+	err := CreateApp(&app, s.user)
+	c.Assert(err, check.IsNil)
+	err = app.AddRouter(appTypes.AppRouter{
+		Name: "fake-tls",
+		Opts: map[string]string{"rate-limit": "10"},
+	})
+	c.Assert(err, check.ErrorMatches, `invalid option "rate-limit" for router "fake-tls": access control is not supported`)
+	routers := app.GetRouters()
+	c.Assert(routers, check.DeepEquals, []appTypes.AppRouter{{Name: "fake"}})
+}
+
 func (s *S) TestAppAddRouter(c *check.C) {
 	app := App{Name: "myapp", Platform: "go", TeamOwner: s.team.Name}
 	err := CreateApp(&app, s.user)
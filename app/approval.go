@@ -0,0 +1,217 @@
+// Copyright 2018 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package app
+
+import (
+	"io"
+	"io/ioutil"
+	"time"
+
+	"github.com/globalsign/mgo"
+	"github.com/globalsign/mgo/bson"
+	"github.com/pkg/errors"
+	"github.com/tsuru/config"
+	"github.com/tsuru/tsuru/db"
+	"github.com/tsuru/tsuru/event"
+	"github.com/tsuru/tsuru/log"
+	"github.com/tsuru/tsuru/permission"
+	"github.com/tsuru/tsuru/provision/pool"
+)
+
+const defaultDeployApprovalTimeout = time.Hour
+
+// ErrDeployQueued is returned by Deploy when the deploy was queued waiting
+// for approval, its event being left running.
+var ErrDeployQueued = errors.New("deploy queued waiting for approval")
+
+// SetDeployApproval sets whether deploys to the app must be approved before
+// running.
+func (app *App) SetDeployApproval(required bool) error {
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	err = conn.Apps().Update(
+		bson.M{"name": app.Name},
+		bson.M{"$set": bson.M{"deployapproval": required}},
+	)
+	if err != nil {
+		return err
+	}
+	app.DeployApproval = required
+	return nil
+}
+
+// DeployApprovalRequired reports whether deploys to the app must be approved
+// before running, either because of the app or of its pool.
+func (app *App) DeployApprovalRequired() (bool, error) {
+	if app.DeployApproval {
+		return true, nil
+	}
+	if app.Pool == "" {
+		return false, nil
+	}
+	p, err := pool.GetPoolByName(app.Pool)
+	if err == pool.ErrPoolNotFound {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return p.DeployApproval, nil
+}
+
+func deployApprovalTimeout() time.Duration {
+	if seconds, _ := config.GetInt("deploy:approval-timeout"); seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	return defaultDeployApprovalTimeout
+}
+
+// queueDeployApproval queues deploys requiring approval, returning
+// ErrDeployQueued. Their events release the lock of the app until a user
+// allowed to approve them does it, starting them with ApproveDeploy, and
+// uploaded files are stored until then. Aborting a canary is never queued,
+// as it restores the running version.
+func queueDeployApproval(opts *DeployOptions) error {
+	evt := opts.Event
+	if evt.ApprovalInfo.Approved {
+		evt.Logf("---- Deploy approved by %s ----", evt.ApprovalInfo.Owner)
+		return nil
+	}
+	if opts.GetKind() == DeployCanaryAbort {
+		return nil
+	}
+	required, err := opts.App.DeployApprovalRequired()
+	if err != nil || !required {
+		return err
+	}
+	if opts.File != nil {
+		err = storeDeployUpload(evt, opts.File)
+		if err != nil {
+			return err
+		}
+	}
+	timeout := deployApprovalTimeout()
+	evt.Logf("---- Deploy %s queued waiting for approval, it expires in %s ----", evt.UniqueID.Hex(), timeout)
+	err = evt.QueueApproval(event.Allowed(permission.PermAppApproveDeploy, append(
+		permission.Contexts(permission.CtxTeam, opts.App.Teams),
+		permission.Context(permission.CtxApp, opts.App.Name),
+		permission.Context(permission.CtxPool, opts.App.Pool),
+	)...), timeout)
+	if err != nil {
+		removeDeployUpload(evt)
+		return err
+	}
+	return ErrDeployQueued
+}
+
+// ApproveDeploy approves the deploy pending approval on behalf of owner,
+// returning the options to run it. The event holds the lock of the app again
+// and must be marked as done by the caller after running the deploy.
+func ApproveDeploy(evt *event.Event, reason, owner string) (*DeployOptions, error) {
+	if evt.Target.Type != event.TargetTypeApp || evt.Kind.Name != permission.PermAppDeploy.FullName() {
+		return nil, event.ErrNotPendingApproval
+	}
+	err := evt.Approve(reason, owner)
+	if err != nil {
+		return nil, err
+	}
+	opts, err := approvedDeployOptions(evt)
+	if err != nil {
+		evt.Done(err)
+		return nil, err
+	}
+	return opts, nil
+}
+
+func approvedDeployOptions(evt *event.Event) (*DeployOptions, error) {
+	var opts DeployOptions
+	err := evt.StartData(&opts)
+	if err != nil {
+		return nil, err
+	}
+	opts.App, err = GetByName(evt.Target.Value)
+	if err != nil {
+		return nil, err
+	}
+	opts.Event = evt
+	opts.OutputStream = ioutil.Discard
+	if opts.Kind == DeployUpload || opts.Kind == DeployUploadBuild {
+		opts.File, err = openDeployUpload(evt)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return &opts, nil
+}
+
+// InitializeDeployApproval registers the removal of the files uploaded in
+// deploys queued waiting for approval once their events are done, either
+// after running or because they expired or were canceled.
+func InitializeDeployApproval() error {
+	event.AddDoneListener(func(evt *event.Event) {
+		if evt.Kind.Name == permission.PermAppDeploy.FullName() && !evt.ApprovalInfo.StartTime.IsZero() {
+			go removeDeployUpload(evt)
+		}
+	})
+	return nil
+}
+
+type deployUpload struct {
+	*mgo.GridFile
+	conn *db.Storage
+}
+
+func (u *deployUpload) Close() error {
+	defer u.conn.Close()
+	return u.GridFile.Close()
+}
+
+func storeDeployUpload(evt *event.Event, file io.Reader) error {
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	upload, err := conn.DeployUploads().Create(evt.UniqueID.Hex())
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(upload, file)
+	if err != nil {
+		upload.Abort()
+		upload.Close()
+		return errors.Wrap(err, "unable to store uploaded file")
+	}
+	return upload.Close()
+}
+
+func openDeployUpload(evt *event.Event) (io.ReadCloser, error) {
+	conn, err := db.Conn()
+	if err != nil {
+		return nil, err
+	}
+	upload, err := conn.DeployUploads().Open(evt.UniqueID.Hex())
+	if err != nil {
+		conn.Close()
+		return nil, errors.Wrap(err, "unable to open uploaded file")
+	}
+	return &deployUpload{GridFile: upload, conn: conn}, nil
+}
+
+func removeDeployUpload(evt *event.Event) {
+	conn, err := db.Conn()
+	if err != nil {
+		log.Errorf("unable to remove file uploaded in deploy %s: %s", evt.UniqueID.Hex(), err)
+		return
+	}
+	defer conn.Close()
+	err = conn.DeployUploads().Remove(evt.UniqueID.Hex())
+	if err != nil {
+		log.Errorf("unable to remove file uploaded in deploy %s: %s", evt.UniqueID.Hex(), err)
+	}
+}
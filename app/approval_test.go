@@ -0,0 +1,168 @@
+// Copyright 2018 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package app
+
+import (
+	"bytes"
+	"io/ioutil"
+	"strings"
+	"time"
+
+	"github.com/globalsign/mgo/bson"
+	"github.com/tsuru/config"
+	"github.com/tsuru/tsuru/event"
+	"github.com/tsuru/tsuru/permission"
+	"github.com/tsuru/tsuru/provision/pool"
+	"gopkg.in/check.v1"
+)
+
+func (s *S) TestSetDeployApproval(c *check.C) {
+	a := App{Name: "myapp", TeamOwner: s.team.Name}
+	err := CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	err = a.SetDeployApproval(true)
+	c.Assert(err, check.IsNil)
+	c.Assert(a.DeployApproval, check.Equals, true)
+	dbApp, err := GetByName(a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(dbApp.DeployApproval, check.Equals, true)
+	err = a.SetDeployApproval(false)
+	c.Assert(err, check.IsNil)
+	dbApp, err = GetByName(a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(dbApp.DeployApproval, check.Equals, false)
+}
+
+func (s *S) TestDeployApprovalRequired(c *check.C) {
+	a := App{Name: "myapp", Pool: s.Pool}
+	required, err := a.DeployApprovalRequired()
+	c.Assert(err, check.IsNil)
+	c.Assert(required, check.Equals, false)
+	a.DeployApproval = true
+	required, err = a.DeployApprovalRequired()
+	c.Assert(err, check.IsNil)
+	c.Assert(required, check.Equals, true)
+	a.DeployApproval = false
+	approval := true
+	err = pool.PoolUpdate(s.Pool, pool.UpdatePoolOptions{DeployApproval: &approval})
+	c.Assert(err, check.IsNil)
+	required, err = a.DeployApprovalRequired()
+	c.Assert(err, check.IsNil)
+	c.Assert(required, check.Equals, true)
+	a.Pool = "removed-pool"
+	required, err = a.DeployApprovalRequired()
+	c.Assert(err, check.IsNil)
+	c.Assert(required, check.Equals, false)
+}
+
+func (s *S) TestDeployQueuedWaitingApproval(c *check.C) {
+	a := App{Name: "myapp", Platform: "zend", TeamOwner: s.team.Name, DeployApproval: true}
+	err := CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	opts := DeployOptions{
+		App:          &a,
+		Image:        "myimage",
+		OutputStream: &bytes.Buffer{},
+	}
+	opts.GetKind()
+	evt := s.newDeployEventWithData(c, &a, opts)
+	opts.Event = evt
+	_, err = Deploy(opts)
+	c.Assert(err, check.Equals, ErrDeployQueued)
+	pending, err := event.GetByID(evt.UniqueID)
+	c.Assert(err, check.IsNil)
+	c.Assert(pending.Running, check.Equals, true)
+	c.Assert(pending.ApprovalInfo.Pending, check.Equals, true)
+	c.Assert(pending.AllowedApprove, check.DeepEquals, event.Allowed(permission.PermAppApproveDeploy,
+		permission.Context(permission.CtxTeam, s.team.Name),
+		permission.Context(permission.CtxApp, a.Name),
+		permission.Context(permission.CtxPool, a.Pool),
+	))
+	approved, err := ApproveDeploy(pending, "looks good", "approver@example.com")
+	c.Assert(err, check.IsNil)
+	c.Assert(approved.App.Name, check.Equals, a.Name)
+	c.Assert(approved.Image, check.Equals, "myimage")
+	c.Assert(approved.Event, check.Equals, pending)
+	_, err = Deploy(*approved)
+	c.Assert(err, check.IsNil)
+	err = pending.Done(nil)
+	c.Assert(err, check.IsNil)
+	data, err := GetDeploy(evt.UniqueID.Hex())
+	c.Assert(err, check.IsNil)
+	c.Assert(data.Approver, check.Equals, "approver@example.com")
+	c.Assert(data.Log, check.Matches, `(?s).*queued waiting for approval.*Deploy approved by approver@example.com.*`)
+	var dbApp App
+	err = s.conn.Apps().Find(bson.M{"name": a.Name}).One(&dbApp)
+	c.Assert(err, check.IsNil)
+	c.Assert(dbApp.Deploys, check.Equals, uint(1))
+}
+
+func (s *S) TestDeployQueuedStoresUpload(c *check.C) {
+	a := App{Name: "myapp", Platform: "zend", TeamOwner: s.team.Name, DeployApproval: true}
+	err := CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	opts := DeployOptions{
+		App:          &a,
+		File:         ioutil.NopCloser(strings.NewReader("my file")),
+		FileSize:     7,
+		OutputStream: &bytes.Buffer{},
+	}
+	opts.GetKind()
+	evt := s.newDeployEventWithData(c, &a, opts)
+	opts.Event = evt
+	_, err = Deploy(opts)
+	c.Assert(err, check.Equals, ErrDeployQueued)
+	approved, err := ApproveDeploy(evt, "", "approver@example.com")
+	c.Assert(err, check.IsNil)
+	c.Assert(approved.Kind, check.Equals, DeployUpload)
+	c.Assert(approved.FileSize, check.Equals, int64(7))
+	content, err := ioutil.ReadAll(approved.File)
+	c.Assert(err, check.IsNil)
+	c.Assert(string(content), check.Equals, "my file")
+	err = approved.File.Close()
+	c.Assert(err, check.IsNil)
+	removeDeployUpload(evt)
+	_, err = openDeployUpload(evt)
+	c.Assert(err, check.NotNil)
+	err = evt.Done(nil)
+	c.Assert(err, check.IsNil)
+}
+
+func (s *S) TestApproveDeployNotDeploy(c *check.C) {
+	evt, err := event.New(&event.Opts{
+		Target:   event.Target{Type: event.TargetTypeApp, Value: "myapp"},
+		Kind:     permission.PermAppUpdateEnvSet,
+		RawOwner: event.Owner{Type: event.OwnerTypeUser, Name: s.user.Email},
+		Allowed:  event.Allowed(permission.PermApp),
+	})
+	c.Assert(err, check.IsNil)
+	defer evt.Done(nil)
+	_, err = ApproveDeploy(evt, "", "approver@example.com")
+	c.Assert(err, check.Equals, event.ErrNotPendingApproval)
+}
+
+func (s *S) TestDeployApprovalExpired(c *check.C) {
+	config.Set("deploy:approval-timeout", 1)
+	defer config.Unset("deploy:approval-timeout")
+	a := App{Name: "myapp", Platform: "zend", TeamOwner: s.team.Name, DeployApproval: true}
+	err := CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	evt := s.newDeployEvent(c, &a)
+	_, err = Deploy(DeployOptions{
+		App:          &a,
+		Image:        "myimage",
+		OutputStream: &bytes.Buffer{},
+		Event:        evt,
+	})
+	c.Assert(err, check.Equals, ErrDeployQueued)
+	c.Assert(evt.ApprovalInfo.ExpireTime.Sub(evt.ApprovalInfo.StartTime), check.Equals, time.Second)
+}
+
+func (s *S) TestDeployCanaryAbortSkipsApproval(c *check.C) {
+	a := App{DeployApproval: true}
+	opts := DeployOptions{App: &a, Abort: true, Event: &event.Event{}}
+	err := queueDeployApproval(&opts)
+	c.Assert(err, check.IsNil)
+}
@@ -0,0 +1,197 @@
+// Copyright 2018 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package app
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/globalsign/mgo/bson"
+	"github.com/pkg/errors"
+	"github.com/tsuru/tsuru/app/image"
+	"github.com/tsuru/tsuru/db"
+	tsuruErrors "github.com/tsuru/tsuru/errors"
+	"github.com/tsuru/tsuru/provision"
+)
+
+var (
+	ErrInvalidAutoScaleUnits  = &tsuruErrors.ValidationError{Message: "autoscale min units must be greater than zero and not greater than max units"}
+	ErrInvalidAutoScaleTarget = &tsuruErrors.ValidationError{Message: "autoscale requires a cpu or requests target"}
+	ErrAutoScaleNotFound      = errors.New("autoscale not found for process")
+)
+
+// UnitMetrics holds the last metrics reported by a unit through the node
+// status endpoint.
+type UnitMetrics struct {
+	UnitID    string `bson:"_id"`
+	CPU       float64
+	Requests  float64
+	UpdatedAt time.Time
+}
+
+// GetAutoScale returns the autoscale spec of the given process, if any.
+func (app *App) GetAutoScale(process string) (provision.AutoScaleSpec, bool) {
+	for _, spec := range app.AutoScale {
+		if spec.Process == process {
+			return spec, true
+		}
+	}
+	return provision.AutoScaleSpec{}, false
+}
+
+// SetAutoScale enables or updates the autoscaling of the units of a process.
+// The process may be omitted for apps with a single process.
+func (app *App) SetAutoScale(spec provision.AutoScaleSpec) error {
+	if spec.MinUnits == 0 || spec.MaxUnits < spec.MinUnits {
+		return ErrInvalidAutoScaleUnits
+	}
+	if spec.TargetCPU == 0 && spec.TargetRequests == 0 {
+		return ErrInvalidAutoScaleTarget
+	}
+	process, err := app.autoScaleProcess(spec.Process)
+	if err != nil {
+		return err
+	}
+	spec.Process = process
+	prov, err := app.getProvisioner()
+	if err != nil {
+		return err
+	}
+	if autoScaleProv, ok := prov.(provision.AutoScaleProvisioner); ok {
+		err = autoScaleProv.SetAutoScale(app, spec)
+		if err != nil {
+			return err
+		}
+	}
+	specs := []provision.AutoScaleSpec{spec}
+	for _, s := range app.AutoScale {
+		if s.Process != spec.Process {
+			specs = append(specs, s)
+		}
+	}
+	sort.Slice(specs, func(i, j int) bool {
+		return specs[i].Process < specs[j].Process
+	})
+	return app.setAutoScale(specs)
+}
+
+// RemoveAutoScale disables the autoscaling of the units of a process, the
+// number of units running is kept unchanged.
+func (app *App) RemoveAutoScale(process string) error {
+	if _, ok := app.GetAutoScale(process); !ok {
+		return ErrAutoScaleNotFound
+	}
+	prov, err := app.getProvisioner()
+	if err != nil {
+		return err
+	}
+	if autoScaleProv, ok := prov.(provision.AutoScaleProvisioner); ok {
+		err = autoScaleProv.RemoveAutoScale(app, process)
+		if err != nil {
+			return err
+		}
+	}
+	var specs []provision.AutoScaleSpec
+	for _, s := range app.AutoScale {
+		if s.Process != process {
+			specs = append(specs, s)
+		}
+	}
+	return app.setAutoScale(specs)
+}
+
+func (app *App) autoScaleProcess(process string) (string, error) {
+	imageName, err := image.AppCurrentImageName(app.Name)
+	if err != nil {
+		if err == image.ErrNoImagesAvailable {
+			return "", &tsuruErrors.ValidationError{Message: "autoscale requires the app to be deployed first"}
+		}
+		return "", err
+	}
+	imgData, err := image.GetImageMetaData(imageName)
+	if err != nil {
+		return "", err
+	}
+	if process == "" {
+		if len(imgData.Processes) != 1 {
+			return "", &tsuruErrors.ValidationError{Message: "process must be specified for apps with multiple processes"}
+		}
+		for name := range imgData.Processes {
+			process = name
+		}
+		return process, nil
+	}
+	if _, ok := imgData.Processes[process]; !ok {
+		return "", &tsuruErrors.ValidationError{Message: fmt.Sprintf("process %q not found in app", process)}
+	}
+	return process, nil
+}
+
+func (app *App) setAutoScale(specs []provision.AutoScaleSpec) error {
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	update := bson.M{"$set": bson.M{"autoscale": specs}}
+	if len(specs) == 0 {
+		update = bson.M{"$unset": bson.M{"autoscale": ""}}
+	}
+	err = conn.Apps().Update(bson.M{"name": app.Name}, update)
+	if err != nil {
+		return err
+	}
+	app.AutoScale = specs
+	return nil
+}
+
+// UnitsMetrics returns the metrics reported by the given units after the
+// given time, indexed by unit ID.
+func UnitsMetrics(units []provision.Unit, since time.Time) (map[string]UnitMetrics, error) {
+	ids := make([]string, len(units))
+	for i, u := range units {
+		ids[i] = u.ID
+	}
+	conn, err := db.Conn()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	var metrics []UnitMetrics
+	err = conn.UnitMetrics().Find(bson.M{
+		"_id":       bson.M{"$in": ids},
+		"updatedat": bson.M{"$gt": since},
+	}).All(&metrics)
+	if err != nil {
+		return nil, err
+	}
+	result := make(map[string]UnitMetrics, len(metrics))
+	for _, m := range metrics {
+		result[m.UnitID] = m
+	}
+	return result, nil
+}
+
+// storeUnitMetrics saves the metrics reported by a unit. Units reporting no
+// usage at all are ignored, as they're either idle or running an agent unable
+// to collect metrics, the autoscaler considering units without metrics idle.
+func storeUnitMetrics(unitData provision.UnitStatusData) error {
+	if unitData.CPU == 0 && unitData.Requests == 0 {
+		return nil
+	}
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	_, err = conn.UnitMetrics().UpsertId(unitData.ID, UnitMetrics{
+		UnitID:    unitData.ID,
+		CPU:       unitData.CPU,
+		Requests:  unitData.Requests,
+		UpdatedAt: time.Now().UTC(),
+	})
+	return err
+}
@@ -0,0 +1,146 @@
+// Copyright 2018 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package app
+
+import (
+	"time"
+
+	"github.com/tsuru/tsuru/app/image"
+	"github.com/tsuru/tsuru/provision"
+	"gopkg.in/check.v1"
+)
+
+func (s *S) createAutoScaleApp(c *check.C, processes ...string) *App {
+	a := App{Name: "scale-app", Platform: "python", TeamOwner: s.team.Name}
+	err := CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	procs := map[string]interface{}{}
+	for _, p := range processes {
+		procs[p] = "run " + p
+	}
+	err = image.SaveImageCustomData("registry.somewhere/tsuru/app-scale-app:v1", map[string]interface{}{
+		"processes": procs,
+	})
+	c.Assert(err, check.IsNil)
+	err = image.AppendAppImageName(a.Name, "registry.somewhere/tsuru/app-scale-app:v1")
+	c.Assert(err, check.IsNil)
+	return &a
+}
+
+func (s *S) TestSetAutoScale(c *check.C) {
+	a := s.createAutoScaleApp(c, "web", "worker")
+	err := a.SetAutoScale(provision.AutoScaleSpec{Process: "worker", MinUnits: 1, MaxUnits: 5, TargetCPU: 70})
+	c.Assert(err, check.IsNil)
+	err = a.SetAutoScale(provision.AutoScaleSpec{Process: "web", MinUnits: 2, MaxUnits: 10, TargetRequests: 100})
+	c.Assert(err, check.IsNil)
+	err = a.SetAutoScale(provision.AutoScaleSpec{Process: "worker", MinUnits: 1, MaxUnits: 3, TargetCPU: 50})
+	c.Assert(err, check.IsNil)
+	expected := []provision.AutoScaleSpec{
+		{Process: "web", MinUnits: 2, MaxUnits: 10, TargetRequests: 100},
+		{Process: "worker", MinUnits: 1, MaxUnits: 3, TargetCPU: 50},
+	}
+	c.Assert(a.AutoScale, check.DeepEquals, expected)
+	dbApp, err := GetByName(a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(dbApp.AutoScale, check.DeepEquals, expected)
+}
+
+func (s *S) TestSetAutoScaleSingleProcess(c *check.C) {
+	a := s.createAutoScaleApp(c, "web")
+	err := a.SetAutoScale(provision.AutoScaleSpec{MinUnits: 1, MaxUnits: 5, TargetCPU: 70})
+	c.Assert(err, check.IsNil)
+	c.Assert(a.AutoScale, check.DeepEquals, []provision.AutoScaleSpec{
+		{Process: "web", MinUnits: 1, MaxUnits: 5, TargetCPU: 70},
+	})
+}
+
+func (s *S) TestSetAutoScaleInvalid(c *check.C) {
+	a := s.createAutoScaleApp(c, "web", "worker")
+	tests := []struct {
+		spec provision.AutoScaleSpec
+		err  string
+	}{
+		{provision.AutoScaleSpec{Process: "web", MaxUnits: 5, TargetCPU: 70}, ErrInvalidAutoScaleUnits.Error()},
+		{provision.AutoScaleSpec{Process: "web", MinUnits: 3, MaxUnits: 2, TargetCPU: 70}, ErrInvalidAutoScaleUnits.Error()},
+		{provision.AutoScaleSpec{Process: "web", MinUnits: 1, MaxUnits: 2}, ErrInvalidAutoScaleTarget.Error()},
+		{provision.AutoScaleSpec{MinUnits: 1, MaxUnits: 2, TargetCPU: 70}, "process must be specified for apps with multiple processes"},
+		{provision.AutoScaleSpec{Process: "other", MinUnits: 1, MaxUnits: 2, TargetCPU: 70}, `process "other" not found in app`},
+	}
+	for _, tt := range tests {
+		err := a.SetAutoScale(tt.spec)
+		c.Assert(err, check.ErrorMatches, tt.err)
+	}
+	dbApp, err := GetByName(a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(dbApp.AutoScale, check.IsNil)
+}
+
+func (s *S) TestSetAutoScaleWithoutDeploys(c *check.C) {
+	a := App{Name: "scale-app", Platform: "python", TeamOwner: s.team.Name}
+	err := CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	err = a.SetAutoScale(provision.AutoScaleSpec{Process: "web", MinUnits: 1, MaxUnits: 5, TargetCPU: 70})
+	c.Assert(err, check.ErrorMatches, "autoscale requires the app to be deployed first")
+}
+
+func (s *S) TestRemoveAutoScale(c *check.C) {
+	a := s.createAutoScaleApp(c, "web", "worker")
+	err := a.SetAutoScale(provision.AutoScaleSpec{Process: "web", MinUnits: 1, MaxUnits: 5, TargetCPU: 70})
+	c.Assert(err, check.IsNil)
+	err = a.SetAutoScale(provision.AutoScaleSpec{Process: "worker", MinUnits: 1, MaxUnits: 5, TargetCPU: 70})
+	c.Assert(err, check.IsNil)
+	err = a.RemoveAutoScale("web")
+	c.Assert(err, check.IsNil)
+	c.Assert(a.AutoScale, check.DeepEquals, []provision.AutoScaleSpec{
+		{Process: "worker", MinUnits: 1, MaxUnits: 5, TargetCPU: 70},
+	})
+	err = a.RemoveAutoScale("worker")
+	c.Assert(err, check.IsNil)
+	dbApp, err := GetByName(a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(dbApp.AutoScale, check.IsNil)
+	err = a.RemoveAutoScale("worker")
+	c.Assert(err, check.Equals, ErrAutoScaleNotFound)
+}
+
+func (s *S) TestListFilteringByAutoScale(c *check.C) {
+	a := s.createAutoScaleApp(c, "web")
+	a2 := App{Name: "other-app", Platform: "python", TeamOwner: s.team.Name}
+	err := CreateApp(&a2, s.user)
+	c.Assert(err, check.IsNil)
+	err = a.SetAutoScale(provision.AutoScaleSpec{Process: "web", MinUnits: 1, MaxUnits: 5, TargetCPU: 70})
+	c.Assert(err, check.IsNil)
+	apps, err := List(&Filter{AutoScale: true})
+	c.Assert(err, check.IsNil)
+	c.Assert(apps, check.HasLen, 1)
+	c.Assert(apps[0].Name, check.Equals, a.Name)
+}
+
+func (s *S) TestUpdateNodeStatusStoresUnitMetrics(c *check.C) {
+	a := App{Name: "lapname", Platform: "python", TeamOwner: s.team.Name}
+	err := CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	err = s.provisioner.AddNode(provision.AddNodeOptions{
+		Address: "addr1",
+	})
+	c.Assert(err, check.IsNil)
+	units, err := s.provisioner.AddUnitsToNode(&a, 3, "web", nil, "addr1")
+	c.Assert(err, check.IsNil)
+	unitStates := []provision.UnitStatusData{
+		{ID: units[0].ID, Status: provision.StatusStarted, CPU: 42.5, Requests: 10},
+		{ID: units[1].ID, Status: provision.StatusStarted},
+		{ID: units[2].ID + "-not-found", Status: provision.StatusStarted, CPU: 10},
+	}
+	_, err = UpdateNodeStatus(provision.NodeStatusData{Addrs: []string{"addr1"}, Units: unitStates})
+	c.Assert(err, check.IsNil)
+	metrics, err := UnitsMetrics(units, time.Now().UTC().Add(-time.Minute))
+	c.Assert(err, check.IsNil)
+	c.Assert(metrics, check.HasLen, 1)
+	c.Assert(metrics[units[0].ID].CPU, check.Equals, 42.5)
+	c.Assert(metrics[units[0].ID].Requests, check.Equals, 10.0)
+	metrics, err = UnitsMetrics(units, time.Now().UTC().Add(time.Minute))
+	c.Assert(err, check.IsNil)
+	c.Assert(metrics, check.HasLen, 0)
+}
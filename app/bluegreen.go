@@ -0,0 +1,219 @@
+// Copyright 2018 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package app
+
+import (
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/globalsign/mgo/bson"
+	"github.com/pkg/errors"
+	"github.com/tsuru/tsuru/app/image"
+	"github.com/tsuru/tsuru/db"
+	"github.com/tsuru/tsuru/event"
+	"github.com/tsuru/tsuru/log"
+	"github.com/tsuru/tsuru/provision"
+	"github.com/tsuru/tsuru/router"
+)
+
+var (
+	ErrBlueGreenWithoutDeploys = errors.New("blue/green deploys require the app to be deployed first")
+	ErrBlueGreenWithCanary     = errors.New("blue/green deploys cannot be canary deploys")
+)
+
+// AppBlueGreen stores information about the units kept running after a
+// blue/green deploy, which allow rolling back to their image without starting
+// new units.
+type AppBlueGreen struct {
+	ShadowImage string
+	Date        time.Time
+}
+
+func blueGreenDeploy(prov provision.Provisioner, opts *DeployOptions, evt *event.Event) (string, error) {
+	bgDeployer, ok := prov.(provision.BlueGreenDeployer)
+	if !ok {
+		return "", provision.ProvisionerNotSupported{Prov: prov, Action: fmt.Sprintf("%s deploy", DeployBlueGreen)}
+	}
+	deployer, ok := prov.(provision.BuilderDeploy)
+	if !ok {
+		return "", provision.ProvisionerNotSupported{Prov: prov, Action: fmt.Sprintf("%s deploy", DeployBlueGreen)}
+	}
+	imageID, err := builderDeploy(deployer, opts, evt)
+	if err != nil {
+		return "", err
+	}
+	oldImage, err := image.AppCurrentImageName(opts.App.Name)
+	if err != nil && err != image.ErrNoImagesAvailable {
+		return "", err
+	}
+	imageID, err = bgDeployer.DeployShadow(opts.App, imageID, evt)
+	if err == nil {
+		err = opts.App.switchToShadow(bgDeployer, imageID, evt)
+	}
+	if err != nil {
+		// Previous shadow units, if any, were replaced by the failed ones, so
+		// there's nothing left to roll back to.
+		if rmErr := opts.App.removeBlueGreen(prov, evt); rmErr != nil {
+			log.Errorf("[blue-green] unable to remove shadow units for app %q: %v", opts.App.Name, rmErr)
+		}
+		return "", err
+	}
+	err = opts.App.setBlueGreen(&AppBlueGreen{
+		ShadowImage: oldImage,
+		Date:        time.Now().UTC(),
+	})
+	if err != nil {
+		return "", err
+	}
+	return imageID, nil
+}
+
+// blueGreenRollback switches the routes back to the units kept running by the
+// last blue/green deploy, which become the shadow units in turn.
+func blueGreenRollback(prov provision.Provisioner, opts *DeployOptions, evt *event.Event) (string, error) {
+	bgDeployer, ok := prov.(provision.BlueGreenDeployer)
+	if !ok {
+		return "", provision.ProvisionerNotSupported{Prov: prov, Action: fmt.Sprintf("%s deploy", opts.Kind)}
+	}
+	imgMetaData, err := image.GetImageMetaData(opts.Image)
+	if err != nil {
+		return "", err
+	}
+	if imgMetaData.DisableRollback {
+		return "", errors.Errorf("Can't Rollback image %s, reason: %s", opts.Image, imgMetaData.Reason)
+	}
+	currentImage, err := image.AppCurrentImageName(opts.App.Name)
+	if err != nil {
+		return "", err
+	}
+	fmt.Fprintf(evt, "\n---- Rolling back to running units with image %s ----\n", opts.Image)
+	err = opts.App.switchToShadow(bgDeployer, opts.Image, evt)
+	if err != nil {
+		return "", err
+	}
+	err = opts.App.setBlueGreen(&AppBlueGreen{
+		ShadowImage: currentImage,
+		Date:        time.Now().UTC(),
+	})
+	if err != nil {
+		return "", err
+	}
+	return opts.Image, nil
+}
+
+// switchToShadow points the routes of the app to the shadow units, replacing
+// the routes of the current units, which are only kept running by the
+// provisioner. Every switched router is reverted if any step fails.
+func (app *App) switchToShadow(bgDeployer provision.BlueGreenDeployer, imageID string, evt *event.Event) (err error) {
+	addrs, err := bgDeployer.ShadowRoutableAddresses(app)
+	if err != nil {
+		return err
+	}
+	routes := make([]*url.URL, len(addrs))
+	for i := range addrs {
+		routes[i] = &addrs[i]
+	}
+	type switchedRouter struct {
+		router    router.Router
+		oldRoutes []*url.URL
+	}
+	var switched []switchedRouter
+	defer func() {
+		if err == nil {
+			return
+		}
+		for _, s := range switched {
+			rollbackErr := replaceRoutes(s.router, app.Name, routes, s.oldRoutes)
+			if rollbackErr != nil {
+				log.Errorf("[blue-green] unable to revert routes switch for app %q in router %q: %v", app.Name, s.router.GetName(), rollbackErr)
+			}
+		}
+	}()
+	fmt.Fprintf(evt, "\n---- Switching routes to shadow units ----\n")
+	for _, appRouter := range app.GetRouters() {
+		var r router.Router
+		r, err = router.Get(appRouter.Name)
+		if err != nil {
+			return err
+		}
+		var oldRoutes []*url.URL
+		oldRoutes, err = r.Routes(app.Name)
+		if err != nil {
+			return err
+		}
+		switched = append(switched, switchedRouter{router: r, oldRoutes: oldRoutes})
+		err = replaceRoutes(r, app.Name, oldRoutes, routes)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(evt, " ---> Switched routes in router %q\n", r.GetName())
+	}
+	return bgDeployer.SwitchShadow(app, imageID, evt)
+}
+
+// replaceRoutes adds the routes in to the backend, removing the ones in from
+// that are not in to only after that, so the backend is never left without
+// routes.
+func replaceRoutes(r router.Router, name string, from, to []*url.URL) error {
+	err := r.AddRoutes(name, to)
+	if err != nil {
+		return err
+	}
+	keep := make(map[string]struct{}, len(to))
+	for _, route := range to {
+		keep[route.Host] = struct{}{}
+	}
+	var toRemove []*url.URL
+	for _, route := range from {
+		if _, ok := keep[route.Host]; !ok {
+			toRemove = append(toRemove, route)
+		}
+	}
+	return r.RemoveRoutes(name, toRemove)
+}
+
+// removeBlueGreen destroys the shadow units of the app.
+func (app *App) removeBlueGreen(prov provision.Provisioner, evt *event.Event) error {
+	if bgDeployer, ok := prov.(provision.BlueGreenDeployer); ok {
+		err := bgDeployer.RemoveShadow(app, evt)
+		if err != nil {
+			return err
+		}
+	}
+	return app.setBlueGreen(nil)
+}
+
+// removeBlueGreenAfterDeploy discards the units kept running by a previous
+// blue/green deploy, which are outdated after any other kind of deploy.
+// Errors are only reported, as the deploy itself already succeeded.
+func removeBlueGreenAfterDeploy(app *App, evt *event.Event) {
+	prov, err := app.getProvisioner()
+	if err == nil {
+		err = app.removeBlueGreen(prov, evt)
+	}
+	if err != nil {
+		log.Errorf("[blue-green] unable to remove shadow units for app %q: %v", app.Name, err)
+		fmt.Fprintf(evt, "\n**** WARNING: unable to remove units kept by the last blue/green deploy: %v ****\n", err)
+	}
+}
+
+func (app *App) setBlueGreen(blueGreen *AppBlueGreen) error {
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	update := bson.M{"$set": bson.M{"bluegreen": blueGreen}}
+	if blueGreen == nil {
+		update = bson.M{"$unset": bson.M{"bluegreen": ""}}
+	}
+	err = conn.Apps().Update(bson.M{"name": app.Name}, update)
+	if err != nil {
+		return err
+	}
+	app.BlueGreen = blueGreen
+	return nil
+}
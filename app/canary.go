@@ -0,0 +1,178 @@
+// Copyright 2018 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package app
+
+import (
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/globalsign/mgo/bson"
+	"github.com/pkg/errors"
+	"github.com/tsuru/tsuru/app/image"
+	"github.com/tsuru/tsuru/db"
+	"github.com/tsuru/tsuru/event"
+	"github.com/tsuru/tsuru/log"
+	"github.com/tsuru/tsuru/provision"
+	"github.com/tsuru/tsuru/router"
+)
+
+var (
+	ErrCanaryRunning       = errors.New("there is a canary deploy running for this app, promote or abort it first")
+	ErrNoCanaryRunning     = errors.New("there is no canary deploy running for this app")
+	ErrInvalidCanaryWeight = errors.New("canary weight must be between 1 and 99")
+)
+
+// AppCanary stores information about a canary deploy running for an app.
+type AppCanary struct {
+	Image  string
+	Weight int
+	Date   time.Time
+}
+
+func canaryDeploy(prov provision.Provisioner, opts *DeployOptions, evt *event.Event) (string, error) {
+	canaryDeployer, ok := prov.(provision.CanaryDeployer)
+	if !ok || opts.Kind == DeployRollback {
+		return "", provision.ProvisionerNotSupported{Prov: prov, Action: fmt.Sprintf("%s canary deploy", opts.Kind)}
+	}
+	deployer, ok := prov.(provision.BuilderDeploy)
+	if !ok {
+		return "", provision.ProvisionerNotSupported{Prov: prov, Action: fmt.Sprintf("%s canary deploy", opts.Kind)}
+	}
+	imageID, err := builderDeploy(deployer, opts, evt)
+	if err != nil {
+		return "", err
+	}
+	return canaryDeployer.DeployCanary(opts.App, imageID, provision.CanaryOptions{Weight: opts.CanaryWeight}, evt)
+}
+
+func finishCanaryDeploy(prov provision.Provisioner, opts *DeployOptions, evt *event.Event) (string, error) {
+	canaryDeployer, ok := prov.(provision.CanaryDeployer)
+	if !ok {
+		return "", provision.ProvisionerNotSupported{Prov: prov, Action: fmt.Sprintf("%s deploy", opts.Kind)}
+	}
+	if opts.Promote {
+		return canaryDeployer.PromoteCanary(opts.App, opts.App.Canary.Image, evt)
+	}
+	err := canaryDeployer.AbortCanary(opts.App, opts.App.Canary.Image, evt)
+	if err != nil {
+		return "", err
+	}
+	imageID, err := image.AppCurrentImageName(opts.App.Name)
+	if err == image.ErrNoImagesAvailable {
+		return "", nil
+	}
+	return imageID, err
+}
+
+// updateCanaryState stores the canary deploy state in the app after the
+// provisioner finished its part of the deploy, also updating the traffic
+// split in routers supporting weighted routes. Router errors are only
+// reported, as the units are already running at this point.
+func updateCanaryState(opts *DeployOptions, imageID string) error {
+	if opts.Canary {
+		err := opts.App.setCanary(&AppCanary{
+			Image:  imageID,
+			Weight: opts.CanaryWeight,
+			Date:   time.Now().UTC(),
+		})
+		if err != nil {
+			return err
+		}
+		err = opts.App.setCanaryRoutesWeight()
+		if err != nil {
+			log.Errorf("[canary] unable to set routes weight for app %q: %v", opts.App.Name, err)
+			fmt.Fprintf(opts.Event, "\n**** WARNING: unable to split traffic by weight: %v ****\n", err)
+		}
+		return nil
+	}
+	if !opts.isCanaryFollowUp() {
+		return nil
+	}
+	err := opts.App.removeCanaryRoutesWeight()
+	if err != nil {
+		log.Errorf("[canary] unable to remove routes weight for app %q: %v", opts.App.Name, err)
+	}
+	return opts.App.setCanary(nil)
+}
+
+func (app *App) setCanary(canary *AppCanary) error {
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	update := bson.M{"$set": bson.M{"canary": canary}}
+	if canary == nil {
+		update = bson.M{"$unset": bson.M{"canary": ""}}
+	}
+	err = conn.Apps().Update(bson.M{"name": app.Name}, update)
+	if err != nil {
+		return err
+	}
+	app.Canary = canary
+	return nil
+}
+
+func (app *App) weightedRouters() ([]router.WeightedRouter, error) {
+	var routers []router.WeightedRouter
+	for _, appRouter := range app.GetRouters() {
+		r, err := router.Get(appRouter.Name)
+		if err != nil {
+			return nil, err
+		}
+		if wr, ok := r.(router.WeightedRouter); ok {
+			routers = append(routers, wr)
+		}
+	}
+	return routers, nil
+}
+
+func (app *App) setCanaryRoutesWeight() error {
+	routers, err := app.weightedRouters()
+	if err != nil || len(routers) == 0 {
+		return err
+	}
+	prov, err := app.getProvisioner()
+	if err != nil {
+		return err
+	}
+	canaryDeployer, ok := prov.(provision.CanaryDeployer)
+	if !ok {
+		return nil
+	}
+	addrs, err := canaryDeployer.CanaryRoutableAddresses(app, app.Canary.Image)
+	if err != nil {
+		return err
+	}
+	if len(addrs) == 0 {
+		return nil
+	}
+	routes := make([]*url.URL, len(addrs))
+	for i := range addrs {
+		routes[i] = &addrs[i]
+	}
+	for _, r := range routers {
+		err = r.SetRoutesWeight(app.Name, routes, app.Canary.Weight)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (app *App) removeCanaryRoutesWeight() error {
+	routers, err := app.weightedRouters()
+	if err != nil {
+		return err
+	}
+	for _, r := range routers {
+		err = r.RemoveRoutesWeight(app.Name)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
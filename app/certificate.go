@@ -0,0 +1,219 @@
+// Copyright 2018 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package app
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"time"
+
+	"github.com/globalsign/mgo"
+	"github.com/globalsign/mgo/bson"
+	"github.com/pkg/errors"
+	"github.com/tsuru/tsuru/db"
+	"github.com/tsuru/tsuru/router"
+)
+
+// CertificateInfo holds information about a certificate set on the app
+// routers, parsed when the certificate is added.
+type CertificateInfo struct {
+	Name          string    `json:"name"`
+	DNSNames      []string  `json:"dnsnames"`
+	NotAfter      time.Time `json:"notafter"`
+	LastWarningAt time.Time `json:"-"`
+}
+
+func newCertificateInfo(name string, cert *x509.Certificate) CertificateInfo {
+	dnsNames := cert.DNSNames
+	if len(dnsNames) == 0 && cert.Subject.CommonName != "" {
+		dnsNames = []string{cert.Subject.CommonName}
+	}
+	return CertificateInfo{
+		Name:     name,
+		DNSNames: dnsNames,
+		NotAfter: cert.NotAfter.UTC(),
+	}
+}
+
+// ParseCertificateInfo returns the information of the first certificate in
+// the PEM encoded data.
+func ParseCertificateInfo(name, data string) (CertificateInfo, error) {
+	block, _ := pem.Decode([]byte(data))
+	if block == nil || block.Type != "CERTIFICATE" {
+		return CertificateInfo{}, errors.New("invalid certificate")
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return CertificateInfo{}, err
+	}
+	return newCertificateInfo(name, cert), nil
+}
+
+// Expired returns whether the certificate is expired at t.
+func (c *CertificateInfo) Expired(t time.Time) bool {
+	return !t.Before(c.NotAfter)
+}
+
+// GetCertificateNames returns the names of the certificates set on the app
+// routers.
+func (app *App) GetCertificateNames() []string {
+	var names []string
+	for _, cert := range app.Certificates {
+		names = append(names, cert.Name)
+	}
+	return names
+}
+
+func (app *App) saveCertificateInfo(info CertificateInfo) error {
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	err = conn.Apps().Update(bson.M{"name": app.Name}, bson.M{"$pull": bson.M{"certificates": bson.M{"name": info.Name}}})
+	if err != nil {
+		return err
+	}
+	err = conn.Apps().Update(bson.M{"name": app.Name}, bson.M{"$push": bson.M{"certificates": info}})
+	if err != nil {
+		return err
+	}
+	app.removeCertificateInfoFromList(info.Name)
+	app.Certificates = append(app.Certificates, info)
+	return nil
+}
+
+func (app *App) removeCertificateInfo(name string) error {
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	err = conn.Apps().Update(bson.M{"name": app.Name}, bson.M{"$pull": bson.M{"certificates": bson.M{"name": name}}})
+	if err != nil {
+		return err
+	}
+	app.removeCertificateInfoFromList(name)
+	return nil
+}
+
+func (app *App) removeCertificateInfoFromList(name string) {
+	for i := range app.Certificates {
+		if app.Certificates[i].Name == name {
+			app.Certificates = append(app.Certificates[:i], app.Certificates[i+1:]...)
+			return
+		}
+	}
+}
+
+// GetCertificateInfo returns the stored information of the certificate with
+// the given name.
+func (app *App) GetCertificateInfo(name string) (CertificateInfo, bool) {
+	for _, cert := range app.Certificates {
+		if cert.Name == name {
+			return cert, true
+		}
+	}
+	return CertificateInfo{}, false
+}
+
+// LoadCertificatesInfo stores the information of the certificates set on the
+// app routers that have no information stored yet, like the ones added
+// before tsuru started storing it.
+func (app *App) LoadCertificatesInfo() error {
+	addrs, err := app.GetAddresses()
+	if err != nil {
+		return err
+	}
+	names := append(addrs, app.CName...)
+	for _, appRouter := range app.GetRouters() {
+		r, err := router.Get(appRouter.Name)
+		if err != nil {
+			return err
+		}
+		tlsRouter, ok := r.(router.TLSRouter)
+		if !ok {
+			continue
+		}
+		for _, n := range names {
+			if _, ok := app.GetCertificateInfo(n); ok {
+				continue
+			}
+			data, err := tlsRouter.GetCertificate(app, n)
+			if err == router.ErrCertificateNotFound || data == "" {
+				continue
+			}
+			if err != nil {
+				return errors.Wrapf(err, "error in router %q", appRouter.Name)
+			}
+			info, err := ParseCertificateInfo(n, data)
+			if err != nil {
+				return errors.Wrapf(err, "unable to parse certificate %q", n)
+			}
+			err = app.addCertificateInfo(info)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// addCertificateInfo stores info unless there's already information stored
+// for a certificate with the same name.
+func (app *App) addCertificateInfo(info CertificateInfo) error {
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	err = conn.Apps().Update(
+		bson.M{"name": app.Name, "certificates.name": bson.M{"$ne": info.Name}},
+		bson.M{"$push": bson.M{"certificates": info}},
+	)
+	if err != nil && err != mgo.ErrNotFound {
+		return err
+	}
+	if err == nil {
+		app.Certificates = append(app.Certificates, info)
+	}
+	return nil
+}
+
+// ClaimCertificateWarning records t as the time of the last warning sent
+// about the expiration of the certificate with the given name, as long as
+// the stored time is still previous. It returns false when the stored time
+// was changed in the meantime, i.e. another tsuru instance already claimed
+// the warning.
+func (app *App) ClaimCertificateWarning(name string, previous, t time.Time) (bool, error) {
+	conn, err := db.Conn()
+	if err != nil {
+		return false, err
+	}
+	defer conn.Close()
+	var lastWarningAt interface{} = previous
+	if previous.IsZero() {
+		lastWarningAt = bson.M{"$in": []interface{}{previous, nil}}
+	}
+	err = conn.Apps().Update(
+		bson.M{
+			"name":         app.Name,
+			"certificates": bson.M{"$elemMatch": bson.M{"name": name, "lastwarningat": lastWarningAt}},
+		},
+		bson.M{"$set": bson.M{"certificates.$.lastwarningat": t}},
+	)
+	if err == mgo.ErrNotFound {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	for i := range app.Certificates {
+		if app.Certificates[i].Name == name {
+			app.Certificates[i].LastWarningAt = t
+		}
+	}
+	return true, nil
+}
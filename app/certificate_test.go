@@ -0,0 +1,145 @@
+// Copyright 2018 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package app
+
+import (
+	"io/ioutil"
+	"time"
+
+	"github.com/globalsign/mgo/bson"
+	"github.com/tsuru/tsuru/router/routertest"
+	appTypes "github.com/tsuru/tsuru/types/app"
+	"gopkg.in/check.v1"
+)
+
+var testCertificateNotAfter = time.Date(2027, 1, 10, 20, 33, 11, 0, time.UTC)
+
+func (s *S) createAppWithCertificate(c *check.C) *App {
+	cert, err := ioutil.ReadFile("testdata/certificate.crt")
+	c.Assert(err, check.IsNil)
+	key, err := ioutil.ReadFile("testdata/private.key")
+	c.Assert(err, check.IsNil)
+	a := App{Name: "my-test-app", TeamOwner: s.team.Name, Routers: []appTypes.AppRouter{{Name: "fake-tls"}}, CName: []string{"app.io"}}
+	err = CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	err = a.SetCertificate("app.io", string(cert), string(key))
+	c.Assert(err, check.IsNil)
+	return &a
+}
+
+func (s *S) TestSetCertificateStoresInfo(c *check.C) {
+	a := s.createAppWithCertificate(c)
+	expected := []CertificateInfo{
+		{Name: "app.io", DNSNames: []string{"app.io"}, NotAfter: testCertificateNotAfter},
+	}
+	c.Assert(a.Certificates, check.DeepEquals, expected)
+	dbApp, err := GetByName(a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(dbApp.Certificates, check.HasLen, 1)
+	c.Assert(dbApp.Certificates[0].Name, check.Equals, "app.io")
+	c.Assert(dbApp.Certificates[0].DNSNames, check.DeepEquals, []string{"app.io"})
+	c.Assert(dbApp.Certificates[0].NotAfter.Equal(testCertificateNotAfter), check.Equals, true)
+}
+
+func (s *S) TestSetCertificateReplacesInfo(c *check.C) {
+	a := s.createAppWithCertificate(c)
+	claimed, err := a.ClaimCertificateWarning("app.io", time.Time{}, time.Now())
+	c.Assert(err, check.IsNil)
+	c.Assert(claimed, check.Equals, true)
+	err = a.SetCertificate("app.io", routertest.TLSRouter.Certs["app.io"], routertest.TLSRouter.Keys["app.io"])
+	c.Assert(err, check.IsNil)
+	dbApp, err := GetByName(a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(dbApp.Certificates, check.HasLen, 1)
+	c.Assert(dbApp.Certificates[0].LastWarningAt.IsZero(), check.Equals, true)
+}
+
+func (s *S) TestRemoveCertificateRemovesInfo(c *check.C) {
+	a := s.createAppWithCertificate(c)
+	err := a.RemoveCertificate("app.io")
+	c.Assert(err, check.IsNil)
+	c.Assert(a.Certificates, check.HasLen, 0)
+	dbApp, err := GetByName(a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(dbApp.Certificates, check.HasLen, 0)
+}
+
+func (s *S) TestClaimCertificateWarning(c *check.C) {
+	a := s.createAppWithCertificate(c)
+	now := time.Date(2026, 12, 20, 10, 0, 0, 0, time.UTC)
+	claimed, err := a.ClaimCertificateWarning("app.io", time.Time{}, now)
+	c.Assert(err, check.IsNil)
+	c.Assert(claimed, check.Equals, true)
+	c.Assert(a.Certificates[0].LastWarningAt, check.DeepEquals, now)
+	dbApp, err := GetByName(a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(dbApp.Certificates[0].LastWarningAt.Equal(now), check.Equals, true)
+}
+
+func (s *S) TestClaimCertificateWarningAlreadyClaimed(c *check.C) {
+	a := s.createAppWithCertificate(c)
+	now := time.Date(2026, 12, 20, 10, 0, 0, 0, time.UTC)
+	claimed, err := a.ClaimCertificateWarning("app.io", time.Time{}, now)
+	c.Assert(err, check.IsNil)
+	c.Assert(claimed, check.Equals, true)
+	claimed, err = a.ClaimCertificateWarning("app.io", time.Time{}, now.Add(time.Minute))
+	c.Assert(err, check.IsNil)
+	c.Assert(claimed, check.Equals, false)
+	dbApp, err := GetByName(a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(dbApp.Certificates[0].LastWarningAt.Equal(now), check.Equals, true)
+}
+
+func (s *S) TestLoadCertificatesInfo(c *check.C) {
+	a := s.createAppWithCertificate(c)
+	err := s.conn.Apps().Update(bson.M{"name": a.Name}, bson.M{"$unset": bson.M{"certificates": ""}})
+	c.Assert(err, check.IsNil)
+	dbApp, err := GetByName(a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(dbApp.Certificates, check.HasLen, 0)
+	err = dbApp.LoadCertificatesInfo()
+	c.Assert(err, check.IsNil)
+	c.Assert(dbApp.Certificates, check.HasLen, 1)
+	dbApp, err = GetByName(a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(dbApp.Certificates, check.HasLen, 1)
+	c.Assert(dbApp.Certificates[0].Name, check.Equals, "app.io")
+	c.Assert(dbApp.Certificates[0].DNSNames, check.DeepEquals, []string{"app.io"})
+	c.Assert(dbApp.Certificates[0].NotAfter.Equal(testCertificateNotAfter), check.Equals, true)
+}
+
+func (s *S) TestLoadCertificatesInfoKeepsExisting(c *check.C) {
+	a := s.createAppWithCertificate(c)
+	now := time.Date(2026, 12, 20, 10, 0, 0, 0, time.UTC)
+	_, err := a.ClaimCertificateWarning("app.io", time.Time{}, now)
+	c.Assert(err, check.IsNil)
+	stale := *a
+	stale.Certificates = nil
+	err = stale.LoadCertificatesInfo()
+	c.Assert(err, check.IsNil)
+	dbApp, err := GetByName(a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(dbApp.Certificates, check.HasLen, 1)
+	c.Assert(dbApp.Certificates[0].LastWarningAt.Equal(now), check.Equals, true)
+}
+
+func (s *S) TestParseCertificateInfo(c *check.C) {
+	cert, err := ioutil.ReadFile("testdata/certificate.crt")
+	c.Assert(err, check.IsNil)
+	info, err := ParseCertificateInfo("app.io", string(cert))
+	c.Assert(err, check.IsNil)
+	c.Assert(info, check.DeepEquals, CertificateInfo{
+		Name:     "app.io",
+		DNSNames: []string{"app.io"},
+		NotAfter: testCertificateNotAfter,
+	})
+	c.Assert(info.Expired(testCertificateNotAfter.Add(-time.Second)), check.Equals, false)
+	c.Assert(info.Expired(testCertificateNotAfter), check.Equals, true)
+}
+
+func (s *S) TestParseCertificateInfoInvalid(c *check.C) {
+	_, err := ParseCertificateInfo("app.io", "not a certificate")
+	c.Assert(err, check.ErrorMatches, "invalid certificate")
+}
@@ -0,0 +1,137 @@
+// Copyright 2018 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package app
+
+import (
+	"regexp"
+	"sort"
+
+	"github.com/globalsign/mgo/bson"
+	"github.com/pkg/errors"
+	"github.com/tsuru/tsuru/app/image"
+	"github.com/tsuru/tsuru/cron"
+	"github.com/tsuru/tsuru/db"
+	tsuruErrors "github.com/tsuru/tsuru/errors"
+	"github.com/tsuru/tsuru/provision"
+)
+
+var (
+	ErrCronJobNotFound = errors.New("cron job not found")
+
+	cronJobNameRegexp = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{0,39}$`)
+)
+
+// ValidateCronJob checks the fields of the job, setting the default
+// concurrency policy if it's empty.
+func ValidateCronJob(job *provision.CronJob) error {
+	if !cronJobNameRegexp.MatchString(job.Name) {
+		return &tsuruErrors.ValidationError{Message: "invalid cron job name, it must contain up to 40 lowercase letters, numbers or dashes, starting with a letter or number"}
+	}
+	if job.Command == "" {
+		return &tsuruErrors.ValidationError{Message: "cron job command is required"}
+	}
+	if _, err := cron.Parse(job.Schedule); err != nil {
+		return &tsuruErrors.ValidationError{Message: err.Error()}
+	}
+	switch job.ConcurrencyPolicy {
+	case "":
+		job.ConcurrencyPolicy = provision.CronConcurrencyForbid
+	case provision.CronConcurrencyForbid, provision.CronConcurrencyAllow:
+	default:
+		return &tsuruErrors.ValidationError{Message: "cron job concurrency policy must be either forbid or allow"}
+	}
+	return nil
+}
+
+// GetCronJobs returns the cron jobs of the app, sorted by name. Jobs declared
+// in the tsuru.yaml of the current image are overridden by jobs with the same
+// name added through the API.
+func (app *App) GetCronJobs() ([]provision.CronJob, error) {
+	var imageJobs []provision.CronJob
+	imageName, err := image.AppCurrentImageName(app.Name)
+	if err != nil && err != image.ErrNoImagesAvailable {
+		return nil, err
+	}
+	if err == nil {
+		yamlData, err := image.GetImageTsuruYamlData(imageName)
+		if err != nil {
+			return nil, err
+		}
+		imageJobs = yamlData.Cron
+	}
+	return app.MergeCronJobs(imageJobs), nil
+}
+
+// MergeCronJobs returns imageJobs, declared in the tsuru.yaml of an image of
+// the app, merged with the jobs added through the API like GetCronJobs does.
+func (app *App) MergeCronJobs(imageJobs []provision.CronJob) []provision.CronJob {
+	jobs := map[string]provision.CronJob{}
+	for _, job := range imageJobs {
+		jobs[job.Name] = job
+	}
+	for _, job := range app.CronJobs {
+		jobs[job.Name] = job
+	}
+	result := make([]provision.CronJob, 0, len(jobs))
+	for _, job := range jobs {
+		result = append(result, job)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Name < result[j].Name
+	})
+	return result
+}
+
+// SetCronJob adds a cron job to the app, replacing the job with the same
+// name, if any.
+func (app *App) SetCronJob(job provision.CronJob) error {
+	err := ValidateCronJob(&job)
+	if err != nil {
+		return err
+	}
+	jobs := []provision.CronJob{job}
+	for _, j := range app.CronJobs {
+		if j.Name != job.Name {
+			jobs = append(jobs, j)
+		}
+	}
+	sort.Slice(jobs, func(i, j int) bool {
+		return jobs[i].Name < jobs[j].Name
+	})
+	return app.setCronJobs(jobs)
+}
+
+// RemoveCronJob removes a cron job added through the API. Jobs declared in
+// tsuru.yaml can only be removed by a new deploy.
+func (app *App) RemoveCronJob(name string) error {
+	var jobs []provision.CronJob
+	for _, j := range app.CronJobs {
+		if j.Name != name {
+			jobs = append(jobs, j)
+		}
+	}
+	if len(jobs) == len(app.CronJobs) {
+		return ErrCronJobNotFound
+	}
+	return app.setCronJobs(jobs)
+}
+
+func (app *App) setCronJobs(jobs []provision.CronJob) error {
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	update := bson.M{"$set": bson.M{"cronjobs": jobs}}
+	if len(jobs) == 0 {
+		update = bson.M{"$unset": bson.M{"cronjobs": ""}}
+	}
+	err = conn.Apps().Update(bson.M{"name": app.Name}, update)
+	if err != nil {
+		return err
+	}
+	app.CronJobs = jobs
+	return nil
+}
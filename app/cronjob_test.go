@@ -0,0 +1,95 @@
+// Copyright 2018 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package app
+
+import (
+	"github.com/tsuru/tsuru/app/image"
+	"github.com/tsuru/tsuru/provision"
+	"gopkg.in/check.v1"
+)
+
+func (s *S) TestSetCronJob(c *check.C) {
+	a := App{Name: "cron-app", Platform: "python", TeamOwner: s.team.Name}
+	err := CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	err = a.SetCronJob(provision.CronJob{Name: "report", Schedule: "0 * * * *", Command: "./report"})
+	c.Assert(err, check.IsNil)
+	err = a.SetCronJob(provision.CronJob{Name: "cleanup", Schedule: "@daily", Command: "./cleanup", ConcurrencyPolicy: "allow"})
+	c.Assert(err, check.IsNil)
+	err = a.SetCronJob(provision.CronJob{Name: "report", Schedule: "*/30 * * * *", Command: "./report --full"})
+	c.Assert(err, check.IsNil)
+	expected := []provision.CronJob{
+		{Name: "cleanup", Schedule: "@daily", Command: "./cleanup", ConcurrencyPolicy: "allow"},
+		{Name: "report", Schedule: "*/30 * * * *", Command: "./report --full", ConcurrencyPolicy: "forbid"},
+	}
+	c.Assert(a.CronJobs, check.DeepEquals, expected)
+	dbApp, err := GetByName(a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(dbApp.CronJobs, check.DeepEquals, expected)
+}
+
+func (s *S) TestSetCronJobInvalid(c *check.C) {
+	a := App{Name: "cron-app", Platform: "python", TeamOwner: s.team.Name}
+	err := CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	tests := []struct {
+		job provision.CronJob
+		err string
+	}{
+		{provision.CronJob{Name: "My Job", Schedule: "* * * * *", Command: "ls"}, "invalid cron job name.*"},
+		{provision.CronJob{Name: "job", Schedule: "* * * * *"}, "cron job command is required"},
+		{provision.CronJob{Name: "job", Schedule: "* * *", Command: "ls"}, `invalid schedule "\* \* \*": expected 5 fields, got 3`},
+		{provision.CronJob{Name: "job", Schedule: "* * * * *", Command: "ls", ConcurrencyPolicy: "replace"}, "cron job concurrency policy must be either forbid or allow"},
+	}
+	for _, tt := range tests {
+		err = a.SetCronJob(tt.job)
+		c.Assert(err, check.ErrorMatches, tt.err)
+	}
+	dbApp, err := GetByName(a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(dbApp.CronJobs, check.IsNil)
+}
+
+func (s *S) TestRemoveCronJob(c *check.C) {
+	a := App{Name: "cron-app", Platform: "python", TeamOwner: s.team.Name}
+	err := CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	err = a.SetCronJob(provision.CronJob{Name: "report", Schedule: "0 * * * *", Command: "./report"})
+	c.Assert(err, check.IsNil)
+	err = a.RemoveCronJob("other")
+	c.Assert(err, check.Equals, ErrCronJobNotFound)
+	err = a.RemoveCronJob("report")
+	c.Assert(err, check.IsNil)
+	c.Assert(a.CronJobs, check.IsNil)
+	dbApp, err := GetByName(a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(dbApp.CronJobs, check.IsNil)
+}
+
+func (s *S) TestGetCronJobs(c *check.C) {
+	a := App{Name: "cron-app", Platform: "python", TeamOwner: s.team.Name}
+	err := CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	jobs, err := a.GetCronJobs()
+	c.Assert(err, check.IsNil)
+	c.Assert(jobs, check.HasLen, 0)
+	err = image.SaveImageCustomData("registry.somewhere/tsuru/app-cron-app:v1", map[string]interface{}{
+		"cron": []provision.CronJob{
+			{Name: "report", Schedule: "0 * * * *", Command: "./report"},
+			{Name: "sync", Schedule: "*/5 * * * *", Command: "./sync"},
+		},
+	})
+	c.Assert(err, check.IsNil)
+	err = image.AppendAppImageName(a.Name, "registry.somewhere/tsuru/app-cron-app:v1")
+	c.Assert(err, check.IsNil)
+	err = a.SetCronJob(provision.CronJob{Name: "report", Schedule: "30 * * * *", Command: "./report --api"})
+	c.Assert(err, check.IsNil)
+	jobs, err = a.GetCronJobs()
+	c.Assert(err, check.IsNil)
+	c.Assert(jobs, check.DeepEquals, []provision.CronJob{
+		{Name: "report", Schedule: "30 * * * *", Command: "./report --api", ConcurrencyPolicy: "forbid"},
+		{Name: "sync", Schedule: "*/5 * * * *", Command: "./sync"},
+	})
+}
@@ -24,19 +24,29 @@ import (
 	"github.com/tsuru/tsuru/provision"
 	"github.com/tsuru/tsuru/router/rebuild"
 	"github.com/tsuru/tsuru/set"
+	appTypes "github.com/tsuru/tsuru/types/app"
 )
 
 type DeployKind string
 
 const (
-	DeployArchiveURL   DeployKind = "archive-url"
-	DeployGit          DeployKind = "git"
-	DeployImage        DeployKind = "image"
-	DeployBuildedImage DeployKind = "imagebuild"
-	DeployRollback     DeployKind = "rollback"
-	DeployUpload       DeployKind = "upload"
-	DeployUploadBuild  DeployKind = "uploadbuild"
-	DeployRebuild      DeployKind = "rebuild"
+	DeployArchiveURL    DeployKind = "archive-url"
+	DeployGit           DeployKind = "git"
+	DeployImage         DeployKind = "image"
+	DeployBuildedImage  DeployKind = "imagebuild"
+	DeployRollback      DeployKind = "rollback"
+	DeployUpload        DeployKind = "upload"
+	DeployUploadBuild   DeployKind = "uploadbuild"
+	DeployRebuild       DeployKind = "rebuild"
+	DeployCanaryPromote DeployKind = "canary-promote"
+	DeployCanaryAbort   DeployKind = "canary-abort"
+	DeployBlueGreen     DeployKind = "bluegreen"
+)
+
+const (
+	CanaryStatusRunning  = "running"
+	CanaryStatusPromoted = "promoted"
+	CanaryStatusAborted  = "aborted"
 )
 
 var reImageVersion = regexp.MustCompile("v[0-9]+$")
@@ -56,6 +66,8 @@ type DeployData struct {
 	RemoveDate  time.Time `bson:",omitempty"`
 	Diff        string
 	Message     string
+	Canary      string
+	Approver    string
 }
 
 func findValidImages(apps ...App) (set.Set, error) {
@@ -123,6 +135,9 @@ func eventToDeployData(evt *event.Event, validImages set.Set, full bool) *Deploy
 		Error:     evt.Error,
 		User:      evt.Owner.Name,
 	}
+	if evt.ApprovalInfo.Approved {
+		data.Approver = evt.ApprovalInfo.Owner
+	}
 	var startOpts DeployOptions
 	err := evt.StartData(&startOpts)
 	if err == nil {
@@ -142,6 +157,7 @@ func eventToDeployData(evt *event.Event, validImages set.Set, full bool) *Deploy
 	err = evt.EndData(&endData)
 	if err == nil {
 		data.Image = endData["image"]
+		data.Canary = endData["canary"]
 		if validImages != nil {
 			data.CanRollback = validImages.Includes(data.Image)
 			if reImageVersion.MatchString(data.Image) {
@@ -169,6 +185,11 @@ type DeployOptions struct {
 	Event        *event.Event `bson:"-"`
 	Kind         DeployKind
 	Message      string
+	Canary       bool
+	CanaryWeight int
+	Promote      bool
+	Abort        bool
+	BlueGreen    bool
 }
 
 func (o *DeployOptions) GetOrigin() string {
@@ -188,6 +209,15 @@ func (o *DeployOptions) GetKind() (kind DeployKind) {
 	if o.Rollback {
 		return DeployRollback
 	}
+	if o.Promote {
+		return DeployCanaryPromote
+	}
+	if o.Abort {
+		return DeployCanaryAbort
+	}
+	if o.BlueGreen {
+		return DeployBlueGreen
+	}
 	if o.Image != "" {
 		return DeployImage
 	}
@@ -203,6 +233,38 @@ func (o *DeployOptions) GetKind() (kind DeployKind) {
 	return DeployArchiveURL
 }
 
+// CanaryStatus returns the state of the canary deploy after a successful
+// deploy with these options, or an empty string if it's not a canary related
+// deploy.
+func (o *DeployOptions) CanaryStatus() string {
+	if o.Promote {
+		return CanaryStatusPromoted
+	}
+	if o.Abort {
+		return CanaryStatusAborted
+	}
+	if o.Canary {
+		return CanaryStatusRunning
+	}
+	return ""
+}
+
+func (o *DeployOptions) isCanaryFollowUp() bool {
+	return o.Promote || o.Abort
+}
+
+// isBlueGreenRollback reports whether the deploy is a rollback to the image
+// of the units kept running by the last blue/green deploy.
+func (o *DeployOptions) isBlueGreenRollback() bool {
+	return o.Rollback && o.App.BlueGreen != nil && o.App.BlueGreen.ShadowImage == o.Image
+}
+
+// isImageDeploy reports whether the deploy uses an existing image, not
+// requiring the app to have a platform.
+func (o *DeployOptions) isImageDeploy() bool {
+	return o.Kind == DeployImage || o.Kind == DeployRollback || (o.Kind == DeployBlueGreen && o.Image != "")
+}
+
 func Build(opts DeployOptions) (string, error) {
 	if opts.Event == nil {
 		return "", errors.Errorf("missing event in build opts")
@@ -231,7 +293,7 @@ func Build(opts DeployOptions) (string, error) {
 
 type errorWithLog struct {
 	err  error
-	logs []Applog
+	logs []appTypes.Applog
 }
 
 func (e *errorWithLog) Cause() error {
@@ -261,6 +323,24 @@ func Deploy(opts DeployOptions) (string, error) {
 	if opts.Event == nil {
 		return "", errors.Errorf("missing event in deploy opts")
 	}
+	if opts.isCanaryFollowUp() {
+		if opts.App.Canary == nil {
+			return "", ErrNoCanaryRunning
+		}
+	} else if opts.App.Canary != nil {
+		return "", ErrCanaryRunning
+	}
+	if opts.Canary && (opts.CanaryWeight <= 0 || opts.CanaryWeight >= 100) {
+		return "", ErrInvalidCanaryWeight
+	}
+	if opts.BlueGreen {
+		if opts.Canary {
+			return "", ErrBlueGreenWithCanary
+		}
+		if opts.App.Deploys == 0 {
+			return "", ErrBlueGreenWithoutDeploys
+		}
+	}
 	if opts.Rollback && !regexp.MustCompile(":v[0-9]+$").MatchString(opts.Image) {
 		imageName, err := image.GetAppImageBySuffix(opts.App.Name, opts.Image)
 		if err != nil {
@@ -268,27 +348,41 @@ func Deploy(opts DeployOptions) (string, error) {
 		}
 		opts.Image = imageName
 	}
+	keepShadow := opts.BlueGreen || opts.isBlueGreenRollback()
 	logWriter := LogWriter{App: opts.App}
 	logWriter.Async()
 	defer logWriter.Close()
 	opts.Event.SetLogWriter(io.MultiWriter(&tsuruIo.NoErrorWriter{Writer: opts.OutputStream}, &logWriter))
+	err := queueDeployApproval(&opts)
+	if err != nil {
+		return "", err
+	}
 	imageID, err := deployToProvisioner(&opts, opts.Event)
 	rebuild.RoutesRebuildOrEnqueue(opts.App.Name)
+	if err == nil {
+		err = updateCanaryState(&opts, imageID)
+	}
 	if err != nil {
-		var logLines []Applog
+		var logLines []appTypes.Applog
 		if provision.IsStartupError(err) {
-			logLines, _ = opts.App.lastLogs(10, Applog{
+			logLines, _ = opts.App.lastLogs(10, appTypes.Applog{
 				Source: "tsuru",
 			}, true)
 		}
 		err = &errorWithLog{err: err, logs: logLines}
 		return "", err
 	}
+	if opts.App.BlueGreen != nil && !keepShadow {
+		removeBlueGreenAfterDeploy(opts.App, opts.Event)
+	}
+	if opts.isCanaryFollowUp() {
+		return imageID, nil
+	}
 	err = incrementDeploy(opts.App)
 	if err != nil {
 		log.Errorf("WARNING: couldn't increment deploy count, deploy opts: %#v", opts)
 	}
-	if opts.Kind == DeployImage || opts.Kind == DeployRollback {
+	if opts.isImageDeploy() {
 		if !opts.App.UpdatePlatform {
 			opts.App.SetUpdatePlatform(true)
 		}
@@ -314,9 +408,21 @@ func deployToProvisioner(opts *DeployOptions, evt *event.Event) (string, error)
 	if opts.Kind == "" {
 		opts.GetKind()
 	}
-	if (opts.App.GetPlatform() == "") && ((opts.Kind != DeployImage) && (opts.Kind != DeployRollback)) {
+	if opts.isCanaryFollowUp() {
+		return finishCanaryDeploy(prov, opts, evt)
+	}
+	if (opts.App.GetPlatform() == "") && !opts.isImageDeploy() {
 		return "", errors.Errorf("can't deploy app without platform, if it's not an image or rollback")
 	}
+	if opts.Canary {
+		return canaryDeploy(prov, opts, evt)
+	}
+	if opts.BlueGreen {
+		return blueGreenDeploy(prov, opts, evt)
+	}
+	if opts.isBlueGreenRollback() {
+		return blueGreenRollback(prov, opts, evt)
+	}
 
 	if opts.Kind != DeployRollback {
 		if deployer, ok := prov.(provision.BuilderDeploy); ok {
@@ -14,6 +14,7 @@ import (
 	"time"
 
 	"github.com/globalsign/mgo/bson"
+	"github.com/tsuru/config"
 	"github.com/tsuru/tsuru/app/image"
 	"github.com/tsuru/tsuru/auth"
 	"github.com/tsuru/tsuru/builder"
@@ -21,6 +22,7 @@ import (
 	"github.com/tsuru/tsuru/event"
 	"github.com/tsuru/tsuru/permission"
 	"github.com/tsuru/tsuru/provision"
+	"github.com/tsuru/tsuru/router/routertest"
 	authTypes "github.com/tsuru/tsuru/types/auth"
 	"gopkg.in/check.v1"
 )
@@ -949,6 +951,18 @@ func (s *S) TestDeployKind(c *check.C) {
 			DeployOptions{Commit: "abcef48439"},
 			DeployGit,
 		},
+		{
+			DeployOptions{Promote: true},
+			DeployCanaryPromote,
+		},
+		{
+			DeployOptions{Abort: true},
+			DeployCanaryAbort,
+		},
+		{
+			DeployOptions{Image: "quay.io/tsuru/python", BlueGreen: true},
+			DeployBlueGreen,
+		},
 		{
 			DeployOptions{},
 			DeployArchiveURL,
@@ -1088,3 +1102,348 @@ func (s *S) TestRollbackUpdateInvalidApp(c *check.C) {
 	c.Assert(err, check.NotNil)
 	c.Assert(err.Error(), check.Equals, "Image v1 not found in app \"otherapp\"")
 }
+
+func (s *S) newDeployEvent(c *check.C, a *App) *event.Event {
+	evt, err := event.New(&event.Opts{
+		Target:   event.Target{Type: "app", Value: a.Name},
+		Kind:     permission.PermAppDeploy,
+		RawOwner: event.Owner{Type: event.OwnerTypeUser, Name: s.user.Email},
+		Allowed:  event.Allowed(permission.PermApp),
+	})
+	c.Assert(err, check.IsNil)
+	return evt
+}
+
+func (s *S) newDeployEventWithData(c *check.C, a *App, opts DeployOptions) *event.Event {
+	evt, err := event.New(&event.Opts{
+		Target:     event.Target{Type: "app", Value: a.Name},
+		Kind:       permission.PermAppDeploy,
+		RawOwner:   event.Owner{Type: event.OwnerTypeUser, Name: s.user.Email},
+		CustomData: opts,
+		Allowed:    event.Allowed(permission.PermApp),
+	})
+	c.Assert(err, check.IsNil)
+	return evt
+}
+
+func (s *S) mockBuild(img string) {
+	s.builder.OnBuild = func(p provision.BuilderDeploy, a provision.App, evt *event.Event, opts *builder.BuildOpts) (string, error) {
+		return img, nil
+	}
+}
+
+func (s *S) TestDeployCanary(c *check.C) {
+	config.Set("routers:fake-weighted:type", "fake-weighted")
+	defer config.Unset("routers:fake-weighted:type")
+	routertest.WeightedRouter.Reset()
+	a := App{Name: "some-app", Platform: "django", TeamOwner: s.team.Name, Router: "fake-weighted"}
+	err := CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	err = s.provisioner.AddUnits(&a, 4, "web", nil)
+	c.Assert(err, check.IsNil)
+	s.mockBuild("registry.somewhere/tsuru/app-some-app:v2")
+	writer := &bytes.Buffer{}
+	imgID, err := Deploy(DeployOptions{
+		App:          &a,
+		Image:        "myimage",
+		OutputStream: writer,
+		Event:        s.newDeployEvent(c, &a),
+		Canary:       true,
+		CanaryWeight: 25,
+	})
+	c.Assert(err, check.IsNil)
+	c.Assert(imgID, check.Equals, "registry.somewhere/tsuru/app-some-app:v2")
+	c.Assert(writer.String(), check.Equals, "Canary deploy called")
+	canaryImg, weight := s.provisioner.Canary(&a)
+	c.Assert(canaryImg, check.Equals, imgID)
+	c.Assert(weight, check.Equals, 25)
+	dbApp, err := GetByName(a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(dbApp.Canary, check.NotNil)
+	c.Assert(dbApp.Canary.Image, check.Equals, imgID)
+	c.Assert(dbApp.Canary.Weight, check.Equals, 25)
+	c.Assert(dbApp.Deploys, check.Equals, uint(1))
+	units, err := s.provisioner.Units(&a)
+	c.Assert(err, check.IsNil)
+	c.Assert(routertest.WeightedRouter.Weights[a.Name], check.DeepEquals, routertest.RoutesWeight{
+		Routes: []string{units[0].Address.Host},
+		Weight: 25,
+	})
+}
+
+func (s *S) TestDeployCanaryInvalidWeight(c *check.C) {
+	a := App{Name: "some-app", Platform: "django", TeamOwner: s.team.Name}
+	err := CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	_, err = Deploy(DeployOptions{
+		App:          &a,
+		Image:        "myimage",
+		OutputStream: &bytes.Buffer{},
+		Event:        s.newDeployEvent(c, &a),
+		Canary:       true,
+		CanaryWeight: 100,
+	})
+	c.Assert(err, check.Equals, ErrInvalidCanaryWeight)
+}
+
+func (s *S) TestDeployWithCanaryRunning(c *check.C) {
+	a := App{Name: "some-app", Platform: "django", TeamOwner: s.team.Name}
+	err := CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	err = a.setCanary(&AppCanary{Image: "myimage", Weight: 10})
+	c.Assert(err, check.IsNil)
+	_, err = Deploy(DeployOptions{
+		App:          &a,
+		Image:        "otherimage",
+		OutputStream: &bytes.Buffer{},
+		Event:        s.newDeployEvent(c, &a),
+	})
+	c.Assert(err, check.Equals, ErrCanaryRunning)
+}
+
+func (s *S) TestDeployCanaryPromote(c *check.C) {
+	config.Set("routers:fake-weighted:type", "fake-weighted")
+	defer config.Unset("routers:fake-weighted:type")
+	routertest.WeightedRouter.Reset()
+	a := App{Name: "some-app", Platform: "django", TeamOwner: s.team.Name, Router: "fake-weighted"}
+	err := CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	err = s.provisioner.AddUnits(&a, 2, "web", nil)
+	c.Assert(err, check.IsNil)
+	s.mockBuild("registry.somewhere/tsuru/app-some-app:v2")
+	_, err = Deploy(DeployOptions{
+		App:          &a,
+		Image:        "myimage",
+		OutputStream: &bytes.Buffer{},
+		Event:        s.newDeployEvent(c, &a),
+		Canary:       true,
+		CanaryWeight: 50,
+	})
+	c.Assert(err, check.IsNil)
+	c.Assert(routertest.WeightedRouter.Weights[a.Name].Weight, check.Equals, 50)
+	writer := &bytes.Buffer{}
+	imgID, err := Deploy(DeployOptions{
+		App:          &a,
+		OutputStream: writer,
+		Event:        s.newDeployEvent(c, &a),
+		Promote:      true,
+	})
+	c.Assert(err, check.IsNil)
+	c.Assert(imgID, check.Equals, "registry.somewhere/tsuru/app-some-app:v2")
+	c.Assert(writer.String(), check.Equals, "Promote canary called")
+	canaryImg, _ := s.provisioner.Canary(&a)
+	c.Assert(canaryImg, check.Equals, "")
+	dbApp, err := GetByName(a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(dbApp.Canary, check.IsNil)
+	c.Assert(dbApp.Deploys, check.Equals, uint(1))
+	_, ok := routertest.WeightedRouter.Weights[a.Name]
+	c.Assert(ok, check.Equals, false)
+}
+
+func (s *S) TestDeployCanaryAbort(c *check.C) {
+	a := App{Name: "some-app", Platform: "django", TeamOwner: s.team.Name}
+	err := CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	s.mockBuild("registry.somewhere/tsuru/app-some-app:v2")
+	_, err = Deploy(DeployOptions{
+		App:          &a,
+		Image:        "myimage",
+		OutputStream: &bytes.Buffer{},
+		Event:        s.newDeployEvent(c, &a),
+		Canary:       true,
+		CanaryWeight: 30,
+	})
+	c.Assert(err, check.IsNil)
+	writer := &bytes.Buffer{}
+	_, err = Deploy(DeployOptions{
+		App:          &a,
+		OutputStream: writer,
+		Event:        s.newDeployEvent(c, &a),
+		Abort:        true,
+	})
+	c.Assert(err, check.IsNil)
+	c.Assert(writer.String(), check.Equals, "Abort canary called")
+	canaryImg, _ := s.provisioner.Canary(&a)
+	c.Assert(canaryImg, check.Equals, "")
+	dbApp, err := GetByName(a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(dbApp.Canary, check.IsNil)
+}
+
+func (s *S) TestDeployCanaryPromoteWithoutCanary(c *check.C) {
+	a := App{Name: "some-app", Platform: "django", TeamOwner: s.team.Name}
+	err := CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	_, err = Deploy(DeployOptions{
+		App:          &a,
+		OutputStream: &bytes.Buffer{},
+		Event:        s.newDeployEvent(c, &a),
+		Promote:      true,
+	})
+	c.Assert(err, check.Equals, ErrNoCanaryRunning)
+}
+
+func (s *S) TestDeployOptionsCanaryStatus(c *check.C) {
+	c.Assert((&DeployOptions{}).CanaryStatus(), check.Equals, "")
+	c.Assert((&DeployOptions{Canary: true}).CanaryStatus(), check.Equals, CanaryStatusRunning)
+	c.Assert((&DeployOptions{Promote: true}).CanaryStatus(), check.Equals, CanaryStatusPromoted)
+	c.Assert((&DeployOptions{Abort: true}).CanaryStatus(), check.Equals, CanaryStatusAborted)
+}
+
+func (s *S) createBlueGreenApp(c *check.C) *App {
+	a := App{Name: "some-app", Platform: "django", TeamOwner: s.team.Name}
+	err := CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	err = s.provisioner.AddUnits(&a, 2, "web", nil)
+	c.Assert(err, check.IsNil)
+	_, err = s.provisioner.Deploy(&a, "registry.somewhere/tsuru/app-some-app:v1", s.newDeployEvent(c, &a))
+	c.Assert(err, check.IsNil)
+	err = image.AppendAppImageName(a.Name, "registry.somewhere/tsuru/app-some-app:v1")
+	c.Assert(err, check.IsNil)
+	err = incrementDeploy(&a)
+	c.Assert(err, check.IsNil)
+	return &a
+}
+
+func (s *S) TestDeployBlueGreen(c *check.C) {
+	a := s.createBlueGreenApp(c)
+	oldUnits, err := s.provisioner.Units(a)
+	c.Assert(err, check.IsNil)
+	s.mockBuild("registry.somewhere/tsuru/app-some-app:v2")
+	writer := &bytes.Buffer{}
+	imgID, err := Deploy(DeployOptions{
+		App:          a,
+		Image:        "myimage",
+		OutputStream: writer,
+		Event:        s.newDeployEvent(c, a),
+		BlueGreen:    true,
+	})
+	c.Assert(err, check.IsNil)
+	c.Assert(imgID, check.Equals, "registry.somewhere/tsuru/app-some-app:v2")
+	c.Assert(writer.String(), check.Matches, `(?s)Shadow deploy called.*Switched routes in router "fake".*Switch shadow called`)
+	units, err := s.provisioner.Units(a)
+	c.Assert(err, check.IsNil)
+	c.Assert(units, check.HasLen, 2)
+	shadowUnits, shadowImage := s.provisioner.Shadow(a)
+	c.Assert(shadowUnits, check.DeepEquals, oldUnits)
+	c.Assert(shadowImage, check.Equals, "registry.somewhere/tsuru/app-some-app:v1")
+	for i := range units {
+		c.Assert(routertest.FakeRouter.HasRoute(a.Name, units[i].Address.String()), check.Equals, true)
+		c.Assert(routertest.FakeRouter.HasRoute(a.Name, oldUnits[i].Address.String()), check.Equals, false)
+	}
+	c.Assert(routertest.FakeRouter.HasBackend(a.Name+"-shadow"), check.Equals, false)
+	dbApp, err := GetByName(a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(dbApp.BlueGreen, check.NotNil)
+	c.Assert(dbApp.BlueGreen.ShadowImage, check.Equals, "registry.somewhere/tsuru/app-some-app:v1")
+	c.Assert(dbApp.Deploys, check.Equals, uint(2))
+}
+
+func (s *S) TestDeployBlueGreenSwitchFailure(c *check.C) {
+	a := s.createBlueGreenApp(c)
+	oldUnits, err := s.provisioner.Units(a)
+	c.Assert(err, check.IsNil)
+	s.mockBuild("registry.somewhere/tsuru/app-some-app:v2")
+	s.provisioner.PrepareFailure("SwitchShadow", errors.New("switch failed"))
+	_, err = Deploy(DeployOptions{
+		App:          a,
+		Image:        "myimage",
+		OutputStream: &bytes.Buffer{},
+		Event:        s.newDeployEvent(c, a),
+		BlueGreen:    true,
+	})
+	c.Assert(err, check.ErrorMatches, `(?s).*switch failed.*`)
+	units, err := s.provisioner.Units(a)
+	c.Assert(err, check.IsNil)
+	c.Assert(units, check.DeepEquals, oldUnits)
+	shadowUnits, _ := s.provisioner.Shadow(a)
+	c.Assert(shadowUnits, check.HasLen, 0)
+	for _, u := range oldUnits {
+		c.Assert(routertest.FakeRouter.HasRoute(a.Name, u.Address.String()), check.Equals, true)
+	}
+	routes, err := routertest.FakeRouter.Routes(a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(routes, check.HasLen, len(oldUnits))
+	dbApp, err := GetByName(a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(dbApp.BlueGreen, check.IsNil)
+}
+
+func (s *S) TestDeployBlueGreenWithoutDeploys(c *check.C) {
+	a := App{Name: "some-app", Platform: "django", TeamOwner: s.team.Name}
+	err := CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	_, err = Deploy(DeployOptions{
+		App:          &a,
+		Image:        "myimage",
+		OutputStream: &bytes.Buffer{},
+		Event:        s.newDeployEvent(c, &a),
+		BlueGreen:    true,
+	})
+	c.Assert(err, check.Equals, ErrBlueGreenWithoutDeploys)
+}
+
+func (s *S) TestDeployBlueGreenRollback(c *check.C) {
+	a := s.createBlueGreenApp(c)
+	oldUnits, err := s.provisioner.Units(a)
+	c.Assert(err, check.IsNil)
+	s.mockBuild("registry.somewhere/tsuru/app-some-app:v2")
+	_, err = Deploy(DeployOptions{
+		App:          a,
+		Image:        "myimage",
+		OutputStream: &bytes.Buffer{},
+		Event:        s.newDeployEvent(c, a),
+		BlueGreen:    true,
+	})
+	c.Assert(err, check.IsNil)
+	err = image.AppendAppImageName(a.Name, "registry.somewhere/tsuru/app-some-app:v2")
+	c.Assert(err, check.IsNil)
+	writer := &bytes.Buffer{}
+	imgID, err := Deploy(DeployOptions{
+		App:          a,
+		Image:        "registry.somewhere/tsuru/app-some-app:v1",
+		Rollback:     true,
+		OutputStream: writer,
+		Event:        s.newDeployEvent(c, a),
+	})
+	c.Assert(err, check.IsNil)
+	c.Assert(imgID, check.Equals, "registry.somewhere/tsuru/app-some-app:v1")
+	c.Assert(writer.String(), check.Matches, `(?s).*Rolling back to running units.*Switch shadow called`)
+	units, err := s.provisioner.Units(a)
+	c.Assert(err, check.IsNil)
+	c.Assert(units, check.DeepEquals, oldUnits)
+	for _, u := range oldUnits {
+		c.Assert(routertest.FakeRouter.HasRoute(a.Name, u.Address.String()), check.Equals, true)
+	}
+	dbApp, err := GetByName(a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(dbApp.BlueGreen, check.NotNil)
+	c.Assert(dbApp.BlueGreen.ShadowImage, check.Equals, "registry.somewhere/tsuru/app-some-app:v2")
+}
+
+func (s *S) TestDeployRemovesBlueGreenShadow(c *check.C) {
+	a := s.createBlueGreenApp(c)
+	s.mockBuild("registry.somewhere/tsuru/app-some-app:v2")
+	_, err := Deploy(DeployOptions{
+		App:          a,
+		Image:        "myimage",
+		OutputStream: &bytes.Buffer{},
+		Event:        s.newDeployEvent(c, a),
+		BlueGreen:    true,
+	})
+	c.Assert(err, check.IsNil)
+	s.mockBuild("registry.somewhere/tsuru/app-some-app:v3")
+	_, err = Deploy(DeployOptions{
+		App:          a,
+		Image:        "otherimage",
+		OutputStream: &bytes.Buffer{},
+		Event:        s.newDeployEvent(c, a),
+	})
+	c.Assert(err, check.IsNil)
+	shadowUnits, _ := s.provisioner.Shadow(a)
+	c.Assert(shadowUnits, check.HasLen, 0)
+	dbApp, err := GetByName(a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(dbApp.BlueGreen, check.IsNil)
+}
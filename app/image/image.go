@@ -157,20 +157,26 @@ func GetImageMetaData(imageName string) (ImageMetadata, error) {
 }
 
 func GetImageWebProcessName(imageName string) (string, error) {
-	processName := "web"
 	data, err := GetImageMetaData(imageName)
 	if err != nil {
-		return processName, err
+		return "web", err
 	}
-	if len(data.Processes) == 0 {
-		return "", nil
+	return WebProcessName(data.Processes), nil
+}
+
+// WebProcessName returns the name of the web process among processes: the
+// only process, when there's just one, or "web".
+func WebProcessName(processes map[string][]string) string {
+	if len(processes) == 0 {
+		return ""
 	}
-	if len(data.Processes) == 1 {
-		for name := range data.Processes {
+	processName := "web"
+	if len(processes) == 1 {
+		for name := range processes {
 			processName = name
 		}
 	}
-	return processName, nil
+	return processName
 }
 
 func AllAppProcesses(appName string) ([]string, error) {
@@ -280,6 +280,12 @@ func (s *S) TestGetImageWebProcessName(c *check.C) {
 	c.Check(web5, check.Equals, "")
 }
 
+func (s *S) TestWebProcessName(c *check.C) {
+	c.Assert(WebProcessName(map[string][]string{"web": {"python myapp.py"}, "worker": {"someworker"}}), check.Equals, "web")
+	c.Assert(WebProcessName(map[string][]string{"api": {"python myapi.py"}}), check.Equals, "api")
+	c.Assert(WebProcessName(nil), check.Equals, "")
+}
+
 func (s *S) TestSavePortInImageCustomData(c *check.C) {
 	img1 := "tsuru/app-myapp:v1"
 	customData1 := map[string]interface{}{
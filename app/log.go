@@ -16,9 +16,12 @@ import (
 	"github.com/globalsign/mgo/bson"
 	"github.com/pkg/errors"
 	"github.com/prometheus/client_golang/prometheus"
+	"github.com/tsuru/config"
 	"github.com/tsuru/tsuru/api/shutdown"
 	"github.com/tsuru/tsuru/db"
 	"github.com/tsuru/tsuru/log"
+	"github.com/tsuru/tsuru/servicemanager"
+	appTypes "github.com/tsuru/tsuru/types/app"
 )
 
 var (
@@ -88,8 +91,47 @@ func init() {
 	prometheus.MustRegister(logsMongoLatency)
 }
 
+var defaultAppLogService = &mongodbLogService{}
+
+// AppLogService returns the service storing app logs, as configured in
+// log:app-log-service. The entries are also sent to the sinks configured in
+// log:app-log-forward, if any.
+func AppLogService() (appTypes.AppLogService, error) {
+	backend, _ := config.GetString("log:app-log-service")
+	var svc appTypes.AppLogService
+	switch backend {
+	case "", "mongodb":
+		svc = &mongodbLogService{}
+	case "file":
+		var err error
+		svc, err = newFileLogService()
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, errors.Errorf("invalid app log service %q", backend)
+	}
+	svc, err := newForwardLogService(svc)
+	if err != nil {
+		return nil, err
+	}
+	if s, ok := svc.(shutdown.Shutdownable); ok {
+		shutdown.Register(s)
+	}
+	return svc, nil
+}
+
+// appLogService returns the service set up in servicemanager, commands not
+// running the API server write logs directly to mongodb.
+func appLogService() appTypes.AppLogService {
+	if servicemanager.AppLog != nil {
+		return servicemanager.AppLog
+	}
+	return defaultAppLogService
+}
+
 type LogListener struct {
-	c       <-chan Applog
+	c       <-chan appTypes.Applog
 	logConn *db.LogStorage
 	quit    chan struct{}
 }
@@ -105,22 +147,22 @@ func isSessionClosed(r interface{}) bool {
 	return fmt.Sprintf("%v", r) == "Session already closed"
 }
 
-func NewLogListener(a *App, filterLog Applog) (*LogListener, error) {
+func NewLogListener(a *App, filterLog appTypes.Applog) (*LogListener, error) {
 	conn, err := db.LogConn()
 	if err != nil {
 		return nil, err
 	}
-	c := make(chan Applog, 10)
+	c := make(chan appTypes.Applog, 10)
 	quit := make(chan struct{})
 	coll := conn.Logs(a.Name)
-	var lastLog Applog
+	var lastLog appTypes.Applog
 	err = coll.Find(nil).Sort("-_id").Limit(1).One(&lastLog)
 	if err == mgo.ErrNotFound {
 		// Tail cursors do not work correctly if the collection is empty (the
 		// Next() call wouldn't block). So if the collection is empty we insert
 		// the very first log line in it. This is quite rare in the real world
 		// though so the impact of this extra log message is really small.
-		err = a.Log("Logs initialization", "tsuru", "")
+		err = addMongoLogs(a.Name, "Logs initialization", "tsuru", "")
 		if err != nil {
 			return nil, err
 		}
@@ -156,7 +198,7 @@ func NewLogListener(a *App, filterLog Applog) (*LogListener, error) {
 			}
 		}()
 		for {
-			var applog Applog
+			var applog appTypes.Applog
 			for iter.Next(&applog) {
 				lastId = applog.MongoID
 				select {
@@ -185,7 +227,7 @@ func NewLogListener(a *App, filterLog Applog) (*LogListener, error) {
 	return &l, nil
 }
 
-func (l *LogListener) ListenChan() <-chan Applog {
+func (l *LogListener) ListenChan() <-chan appTypes.Applog {
 	return l.c
 }
 
@@ -206,23 +248,30 @@ type LogDispatcher struct {
 }
 
 type msgWithTS struct {
-	msg        *Applog
+	msg        *appTypes.Applog
 	arriveTime time.Time
 }
 
 func NewlogDispatcher(chanSize int) *LogDispatcher {
+	d := newLogDispatcher(chanSize)
+	shutdown.Register(d)
+	return d
+}
+
+// newLogDispatcher starts a dispatcher without registering it to be shut
+// down with the API server, leaving that to the caller.
+func newLogDispatcher(chanSize int) *LogDispatcher {
 	d := &LogDispatcher{
 		dispatchers:    make(map[string]*appLogDispatcher),
 		msgCh:          make(chan *msgWithTS, chanSize),
 		doneProcessing: make(chan struct{}),
 	}
 	go d.runWriter()
-	shutdown.Register(d)
 	logsQueueSize.Set(float64(chanSize))
 	return d
 }
 
-func (d *LogDispatcher) getMessageDispatcher(msg *Applog) *appLogDispatcher {
+func (d *LogDispatcher) getMessageDispatcher(msg *appTypes.Applog) *appLogDispatcher {
 	appName := msg.AppName
 	d.mu.RLock()
 	appD, ok := d.dispatchers[appName]
@@ -253,7 +302,7 @@ func (d *LogDispatcher) runWriter() {
 	}
 }
 
-func (d *LogDispatcher) Send(msg *Applog) error {
+func (d *LogDispatcher) Send(msg *appTypes.Applog) error {
 	if atomic.LoadInt32(&d.shuttingDown) == 1 {
 		return errors.New("log dispatcher is shutting down")
 	}
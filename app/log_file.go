@@ -0,0 +1,584 @@
+// Copyright 2018 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package app
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/tsuru/config"
+	"github.com/tsuru/tsuru/log"
+	appTypes "github.com/tsuru/tsuru/types/app"
+	"github.com/tsuru/tsuru/validation"
+)
+
+const (
+	defaultLogFileDirectory = "/var/lib/tsuru/app-logs"
+	defaultLogFileMaxSize   = 100 * 1024 * 1024
+	defaultLogFileMaxFiles  = 5
+	logFileChunkSize        = 64 * 1024
+	logFileLockName         = ".lock"
+)
+
+var fileLogPollInterval = time.Second
+
+var _ appTypes.AppLogService = &fileLogService{}
+
+// fileLogService stores the logs of each app as JSON lines in a file named
+// after the app. The file is rotated once it reaches maxSize bytes, keeping
+// at most maxFiles rotated files, named with a numeric suffix, the most
+// recent one being <app>.log.1.
+//
+// Only one tsuru API instance may use the directory at a time, which is
+// enforced by an exclusive lock on a file in the directory.
+type fileLogService struct {
+	dir      string
+	maxSize  int64
+	maxFiles int
+	lock     *os.File
+	mu       sync.Mutex
+	files    map[string]*appLogFile
+}
+
+// appLogFile is the current log file of an app. Its mutex serializes writes
+// and rotations of the files of the app.
+type appLogFile struct {
+	mu   sync.Mutex
+	file *os.File
+	size int64
+}
+
+func newFileLogService() (*fileLogService, error) {
+	dir, _ := config.GetString("log:app-log-file:directory")
+	if dir == "" {
+		dir = defaultLogFileDirectory
+	}
+	maxSize, _ := config.GetInt("log:app-log-file:max-size")
+	if maxSize <= 0 {
+		maxSize = defaultLogFileMaxSize
+	}
+	maxFiles, _ := config.GetInt("log:app-log-file:max-files")
+	if maxFiles <= 0 {
+		maxFiles = defaultLogFileMaxFiles
+	}
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to create app log directory")
+	}
+	lock, err := os.OpenFile(filepath.Join(dir, logFileLockName), os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to create app log lock file")
+	}
+	err = syscall.Flock(int(lock.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+	if err != nil {
+		lock.Close()
+		return nil, errors.Wrapf(err, "unable to lock app log directory %q, is it in use by another tsuru instance?", dir)
+	}
+	return &fileLogService{
+		dir:      dir,
+		maxSize:  int64(maxSize),
+		maxFiles: maxFiles,
+		lock:     lock,
+		files:    make(map[string]*appLogFile),
+	}, nil
+}
+
+func checkLogAppName(appName string) error {
+	if !validation.ValidateName(appName) {
+		return errors.Errorf("invalid app name %q", appName)
+	}
+	return nil
+}
+
+func (s *fileLogService) path(appName string, index int) string {
+	name := appName + ".log"
+	if index > 0 {
+		name = fmt.Sprintf("%s.%d", name, index)
+	}
+	return filepath.Join(s.dir, name)
+}
+
+func (s *fileLogService) Enqueue(entry *appTypes.Applog) error {
+	return s.write(entry.AppName, []appTypes.Applog{*entry})
+}
+
+func (s *fileLogService) Add(appName, message, source, unit string) error {
+	var entries []appTypes.Applog
+	for _, msg := range strings.Split(message, "\n") {
+		if msg != "" {
+			entries = append(entries, appTypes.Applog{
+				Date:    time.Now().In(time.UTC),
+				Message: msg,
+				Source:  source,
+				AppName: appName,
+				Unit:    unit,
+			})
+		}
+	}
+	if len(entries) == 0 {
+		return nil
+	}
+	return s.write(appName, entries)
+}
+
+// appFile returns the current log file of the app, which is opened lazily
+// by openFile.
+func (s *fileLogService) appFile(appName string) *appLogFile {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f := s.files[appName]
+	if f == nil {
+		f = &appLogFile{}
+		s.files[appName] = f
+	}
+	return f
+}
+
+func (s *fileLogService) write(appName string, entries []appTypes.Applog) error {
+	if err := checkLogAppName(appName); err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	for _, entry := range entries {
+		entry.Cursor = ""
+		data, err := json.Marshal(entry)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		buf.Write(data)
+		buf.WriteByte('\n')
+	}
+	f := s.appFile(appName)
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	err := s.openFile(appName, f, int64(buf.Len()))
+	if err != nil {
+		return err
+	}
+	n, err := f.file.Write(buf.Bytes())
+	f.size += int64(n)
+	return errors.WithStack(err)
+}
+
+// openFile opens the current log file of the app, rotating it first if
+// writing size bytes would make it larger than maxSize. It must be called
+// with f.mu locked.
+func (s *fileLogService) openFile(appName string, f *appLogFile, size int64) error {
+	if f.file != nil && f.size > 0 && f.size+size > s.maxSize {
+		f.file.Close()
+		f.file = nil
+		err := s.rotate(appName)
+		if err != nil {
+			return err
+		}
+	}
+	if f.file != nil {
+		return nil
+	}
+	file, err := os.OpenFile(s.path(appName, 0), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return errors.WithStack(err)
+	}
+	f.file = file
+	f.size = info.Size()
+	return nil
+}
+
+func (s *fileLogService) rotate(appName string) error {
+	err := os.Remove(s.path(appName, s.maxFiles))
+	if err != nil && !os.IsNotExist(err) {
+		return errors.WithStack(err)
+	}
+	for i := s.maxFiles - 1; i >= 0; i-- {
+		err = os.Rename(s.path(appName, i), s.path(appName, i+1))
+		if err != nil && !os.IsNotExist(err) {
+			return errors.WithStack(err)
+		}
+	}
+	return nil
+}
+
+// logMatcher returns a function reporting whether an entry matches the
+// filters in args. Limit and Before are not taken into account.
+func logMatcher(args appTypes.ListLogArgs) (func(*appTypes.Applog) bool, error) {
+	var re *regexp.Regexp
+	if args.Query != "" {
+		var err error
+		re, err = regexp.Compile(args.Query)
+		if err != nil {
+			return nil, errors.Wrap(err, "invalid log query")
+		}
+	}
+	return func(entry *appTypes.Applog) bool {
+		var match bool
+		if args.InvertFilter {
+			match = (args.Source == "" || entry.Source != args.Source) && (args.Unit == "" || entry.Unit != args.Unit)
+		} else {
+			match = (args.Source == "" || entry.Source == args.Source) && (args.Unit == "" || entry.Unit == args.Unit)
+		}
+		if !match {
+			return false
+		}
+		if !args.Since.IsZero() && entry.Date.Before(args.Since) {
+			return false
+		}
+		if !args.Until.IsZero() && !entry.Date.Before(args.Until) {
+			return false
+		}
+		return re == nil || re.MatchString(entry.Message)
+	}, nil
+}
+
+// fileLogCursor identifies an entry by the inode of the file holding it and
+// the offset of its line in the file. The inode is kept when files are
+// rotated, so cursors remain valid until the file is removed.
+type fileLogCursor struct {
+	inode  uint64
+	offset int64
+}
+
+func (c fileLogCursor) String() string {
+	return fmt.Sprintf("%d:%d", c.inode, c.offset)
+}
+
+func parseFileLogCursor(cursor string) (fileLogCursor, error) {
+	parts := strings.SplitN(cursor, ":", 2)
+	if len(parts) != 2 {
+		return fileLogCursor{}, appTypes.ErrInvalidLogCursor
+	}
+	inode, err := strconv.ParseUint(parts[0], 10, 64)
+	if err != nil {
+		return fileLogCursor{}, appTypes.ErrInvalidLogCursor
+	}
+	offset, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil || offset < 0 {
+		return fileLogCursor{}, appTypes.ErrInvalidLogCursor
+	}
+	return fileLogCursor{inode: inode, offset: offset}, nil
+}
+
+// List reads the files backwards, from the newest to the oldest entry, until
+// Limit entries are found. Entries before a cursor are looked up starting at
+// the file the cursor points to, wherever it was rotated to.
+func (s *fileLogService) List(args appTypes.ListLogArgs) ([]appTypes.Applog, error) {
+	if err := checkLogAppName(args.AppName); err != nil {
+		return nil, err
+	}
+	match, err := logMatcher(args)
+	if err != nil {
+		return nil, err
+	}
+	var before *fileLogCursor
+	if args.Before != "" {
+		cursor, err := parseFileLogCursor(args.Before)
+		if err != nil {
+			return nil, err
+		}
+		before = &cursor
+	}
+	logs := []appTypes.Applog{}
+	full := func() bool {
+		return args.Limit > 0 && len(logs) >= args.Limit
+	}
+	for i := 0; i <= s.maxFiles && !full(); i++ {
+		end := int64(-1)
+		if before != nil {
+			if inode, statErr := fileInode(s.path(args.AppName, i)); statErr != nil || inode != before.inode {
+				continue
+			}
+			end = before.offset
+			before = nil
+		}
+		err = readLinesBackwards(s.path(args.AppName, i), end, func(line []byte, cursor fileLogCursor) bool {
+			var entry appTypes.Applog
+			if json.Unmarshal(line, &entry) != nil {
+				return true
+			}
+			if match(&entry) {
+				entry.Cursor = cursor.String()
+				logs = append(logs, entry)
+			}
+			return !full()
+		})
+		if err != nil {
+			if os.IsNotExist(errors.Cause(err)) {
+				break
+			}
+			return nil, err
+		}
+	}
+	l := len(logs)
+	for i := 0; i < l/2; i++ {
+		logs[i], logs[l-1-i] = logs[l-1-i], logs[i]
+	}
+	return logs, nil
+}
+
+func fileInode(path string) (uint64, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0, err
+	}
+	return inodeOf(info), nil
+}
+
+func inodeOf(info os.FileInfo) uint64 {
+	if st, ok := info.Sys().(*syscall.Stat_t); ok {
+		return uint64(st.Ino)
+	}
+	return 0
+}
+
+// readLinesBackwards calls fn with each non empty line of the file, along
+// with its cursor, from the last to the first one, reading the file in
+// chunks from its end. Only lines starting before end are read, a negative
+// end reads the whole file. It stops when fn returns false. The line passed
+// to fn is only valid until fn returns.
+func readLinesBackwards(path string, end int64, fn func(line []byte, cursor fileLogCursor) bool) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	inode := inodeOf(info)
+	offset := info.Size()
+	if end >= 0 && end < offset {
+		offset = end
+	}
+	buf := make([]byte, logFileChunkSize)
+	var rest []byte
+	for offset > 0 {
+		n := int64(len(buf))
+		if offset < n {
+			n = offset
+		}
+		offset -= n
+		_, err = f.ReadAt(buf[:n], offset)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		data := append(buf[:n:n], rest...)
+		lineEnd := len(data)
+		for {
+			i := bytes.LastIndexByte(data[:lineEnd], '\n')
+			if i < 0 {
+				break
+			}
+			if line := data[i+1 : lineEnd]; len(line) > 0 && !fn(line, fileLogCursor{inode: inode, offset: offset + int64(i+1)}) {
+				return nil
+			}
+			lineEnd = i
+		}
+		rest = append([]byte(nil), data[:lineEnd]...)
+	}
+	if len(rest) > 0 {
+		fn(rest, fileLogCursor{inode: inode})
+	}
+	return nil
+}
+
+func (s *fileLogService) Watch(appName, source, unit string) (appTypes.LogWatcher, error) {
+	match, err := logMatcher(appTypes.ListLogArgs{Source: source, Unit: unit})
+	if err != nil {
+		return nil, err
+	}
+	if err = checkLogAppName(appName); err != nil {
+		return nil, err
+	}
+	path := s.path(appName, 0)
+	f := s.appFile(appName)
+	f.mu.Lock()
+	err = s.openFile(appName, f, 0)
+	f.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	_, err = file.Seek(0, io.SeekEnd)
+	if err != nil {
+		file.Close()
+		return nil, errors.WithStack(err)
+	}
+	w := &fileLogWatcher{
+		path:   path,
+		match:  match,
+		file:   file,
+		reader: bufio.NewReader(file),
+		c:      make(chan appTypes.Applog, 10),
+		quit:   make(chan struct{}),
+	}
+	go w.run()
+	return w, nil
+}
+
+func (s *fileLogService) Remove(appName string) error {
+	if err := checkLogAppName(appName); err != nil {
+		return err
+	}
+	f := s.appFile(appName)
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.file != nil {
+		f.file.Close()
+		f.file = nil
+	}
+	for i := 0; i <= s.maxFiles; i++ {
+		err := os.Remove(s.path(appName, i))
+		if err != nil && !os.IsNotExist(err) {
+			return errors.WithStack(err)
+		}
+	}
+	return nil
+}
+
+// Shutdown closes the log files and releases the lock on the log directory.
+func (s *fileLogService) Shutdown(ctx context.Context) error {
+	s.mu.Lock()
+	files := s.files
+	s.files = make(map[string]*appLogFile)
+	s.mu.Unlock()
+	for _, f := range files {
+		f.mu.Lock()
+		if f.file != nil {
+			f.file.Close()
+			f.file = nil
+		}
+		f.mu.Unlock()
+	}
+	return s.lock.Close()
+}
+
+// fileLogWatcher polls the log file of an app for new lines, following the
+// file when it's rotated. Lines may be missed if the file is rotated more
+// than once between two polls.
+type fileLogWatcher struct {
+	path      string
+	match     func(*appTypes.Applog) bool
+	file      *os.File
+	reader    *bufio.Reader
+	partial   []byte
+	c         chan appTypes.Applog
+	quit      chan struct{}
+	closeOnce sync.Once
+}
+
+func (w *fileLogWatcher) ListenChan() <-chan appTypes.Applog {
+	return w.c
+}
+
+func (w *fileLogWatcher) Close() {
+	w.closeOnce.Do(func() {
+		close(w.quit)
+	})
+}
+
+func (w *fileLogWatcher) run() {
+	defer close(w.c)
+	defer func() {
+		w.file.Close()
+	}()
+	ticker := time.NewTicker(fileLogPollInterval)
+	defer ticker.Stop()
+	for {
+		if !w.readLines() {
+			return
+		}
+		rotated, err := w.rotated()
+		if err == nil && rotated {
+			// Lines written right before the rotation are still in the
+			// old file.
+			if !w.readLines() {
+				return
+			}
+			err = w.reopen()
+		}
+		if err != nil {
+			log.Errorf("error following app log file %q: %v", w.path, err)
+			return
+		}
+		select {
+		case <-ticker.C:
+		case <-w.quit:
+			return
+		}
+	}
+}
+
+// readLines sends the complete lines available in the file, it returns false
+// if the watcher was closed.
+func (w *fileLogWatcher) readLines() bool {
+	for {
+		line, err := w.reader.ReadBytes('\n')
+		if err != nil {
+			w.partial = append(w.partial, line...)
+			return true
+		}
+		if len(w.partial) > 0 {
+			line = append(w.partial, line...)
+			w.partial = nil
+		}
+		var entry appTypes.Applog
+		if json.Unmarshal(line, &entry) != nil || !w.match(&entry) {
+			continue
+		}
+		select {
+		case w.c <- entry:
+		case <-w.quit:
+			return false
+		}
+	}
+}
+
+func (w *fileLogWatcher) rotated() (bool, error) {
+	current, err := os.Stat(w.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	opened, err := w.file.Stat()
+	if err != nil {
+		return false, err
+	}
+	return !os.SameFile(current, opened), nil
+}
+
+func (w *fileLogWatcher) reopen() error {
+	file, err := os.Open(w.path)
+	if err != nil {
+		return err
+	}
+	w.file.Close()
+	w.file = file
+	w.reader = bufio.NewReader(file)
+	w.partial = nil
+	return nil
+}
@@ -0,0 +1,290 @@
+// Copyright 2018 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package app
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/tsuru/config"
+	appTypes "github.com/tsuru/tsuru/types/app"
+	"gopkg.in/check.v1"
+)
+
+type LogServiceSuite struct {
+	dir string
+}
+
+var _ = check.Suite(&LogServiceSuite{})
+
+func (s *LogServiceSuite) SetUpTest(c *check.C) {
+	s.dir = c.MkDir()
+	config.Set("log:app-log-file:directory", s.dir)
+	fileLogPollInterval = 10 * time.Millisecond
+}
+
+func (s *LogServiceSuite) TearDownTest(c *check.C) {
+	config.Unset("log:app-log-file")
+	fileLogPollInterval = time.Second
+}
+
+func (s *LogServiceSuite) TestFileLogServiceAddList(c *check.C) {
+	svc, err := newFileLogService()
+	c.Assert(err, check.IsNil)
+	err = svc.Add("myapp", "msg1\nmsg2", "web", "unit1")
+	c.Assert(err, check.IsNil)
+	err = svc.Enqueue(&appTypes.Applog{AppName: "myapp", Message: "msg3", Source: "worker", Unit: "unit2", Date: time.Now()})
+	c.Assert(err, check.IsNil)
+	err = svc.Add("otherapp", "other", "web", "unit1")
+	c.Assert(err, check.IsNil)
+	logs, err := svc.List(appTypes.ListLogArgs{AppName: "myapp", Limit: 10})
+	c.Assert(err, check.IsNil)
+	c.Assert(logs, check.HasLen, 3)
+	c.Assert(logs[0].Message, check.Equals, "msg1")
+	c.Assert(logs[1].Message, check.Equals, "msg2")
+	c.Assert(logs[2].Message, check.Equals, "msg3")
+	logs, err = svc.List(appTypes.ListLogArgs{AppName: "myapp", Limit: 2})
+	c.Assert(err, check.IsNil)
+	c.Assert(logs, check.HasLen, 2)
+	c.Assert(logs[0].Message, check.Equals, "msg2")
+	logs, err = svc.List(appTypes.ListLogArgs{AppName: "myapp", Source: "web", Limit: 10})
+	c.Assert(err, check.IsNil)
+	c.Assert(logs, check.HasLen, 2)
+	logs, err = svc.List(appTypes.ListLogArgs{AppName: "myapp", Source: "web", InvertFilter: true, Limit: 10})
+	c.Assert(err, check.IsNil)
+	c.Assert(logs, check.HasLen, 1)
+	c.Assert(logs[0].Message, check.Equals, "msg3")
+	logs, err = svc.List(appTypes.ListLogArgs{AppName: "unknown", Limit: 10})
+	c.Assert(err, check.IsNil)
+	c.Assert(logs, check.DeepEquals, []appTypes.Applog{})
+}
+
+func (s *LogServiceSuite) TestFileLogServiceListSearch(c *check.C) {
+	svc, err := newFileLogService()
+	c.Assert(err, check.IsNil)
+	baseTime := time.Date(2018, 3, 1, 10, 0, 0, 0, time.UTC)
+	for i := 0; i < 6; i++ {
+		err = svc.Enqueue(&appTypes.Applog{
+			AppName: "myapp",
+			Message: fmt.Sprintf("request %d failed", i),
+			Source:  "web",
+			Date:    baseTime.Add(time.Duration(i) * time.Minute),
+		})
+		c.Assert(err, check.IsNil)
+	}
+	err = svc.Enqueue(&appTypes.Applog{AppName: "myapp", Message: "ok", Source: "web", Date: baseTime.Add(time.Minute)})
+	c.Assert(err, check.IsNil)
+	logs, err := svc.List(appTypes.ListLogArgs{
+		AppName: "myapp",
+		Since:   baseTime.Add(time.Minute),
+		Until:   baseTime.Add(5 * time.Minute),
+		Query:   "fail",
+		Limit:   2,
+	})
+	c.Assert(err, check.IsNil)
+	c.Assert(logs, check.HasLen, 2)
+	c.Assert(logs[0].Message, check.Equals, "request 3 failed")
+	c.Assert(logs[1].Message, check.Equals, "request 4 failed")
+	logs, err = svc.List(appTypes.ListLogArgs{
+		AppName: "myapp",
+		Since:   baseTime.Add(time.Minute),
+		Query:   "fail",
+		Limit:   2,
+		Before:  logs[0].Cursor,
+	})
+	c.Assert(err, check.IsNil)
+	c.Assert(logs, check.HasLen, 2)
+	c.Assert(logs[0].Message, check.Equals, "request 1 failed")
+	c.Assert(logs[1].Message, check.Equals, "request 2 failed")
+	_, err = svc.List(appTypes.ListLogArgs{AppName: "myapp", Before: "xyz"})
+	c.Assert(err, check.Equals, appTypes.ErrInvalidLogCursor)
+	_, err = svc.List(appTypes.ListLogArgs{AppName: "myapp", Query: "a(b"})
+	c.Assert(err, check.ErrorMatches, "invalid log query.*")
+}
+
+func (s *LogServiceSuite) TestFileLogServiceListCursorSameDate(c *check.C) {
+	config.Set("log:app-log-file:max-size", 300)
+	config.Set("log:app-log-file:max-files", 5)
+	svc, err := newFileLogService()
+	c.Assert(err, check.IsNil)
+	defer svc.Shutdown(context.Background())
+	date := time.Date(2018, 3, 1, 10, 0, 0, 0, time.UTC)
+	for i := 0; i < 6; i++ {
+		err = svc.Enqueue(&appTypes.Applog{AppName: "myapp", Message: fmt.Sprintf("msg%d", i), Source: "web", Date: date})
+		c.Assert(err, check.IsNil)
+	}
+	logs, err := svc.List(appTypes.ListLogArgs{AppName: "myapp", Limit: 2})
+	c.Assert(err, check.IsNil)
+	c.Assert(logs, check.HasLen, 2)
+	c.Assert(logs[0].Message, check.Equals, "msg4")
+	cursor := logs[0].Cursor
+	for i := 6; i < 9; i++ {
+		err = svc.Enqueue(&appTypes.Applog{AppName: "myapp", Message: fmt.Sprintf("msg%d", i), Source: "web", Date: date})
+		c.Assert(err, check.IsNil)
+	}
+	files, err := filepath.Glob(filepath.Join(s.dir, "myapp.log.*"))
+	c.Assert(err, check.IsNil)
+	c.Assert(len(files) > 0, check.Equals, true)
+	var messages []string
+	for cursor != "" {
+		logs, err = svc.List(appTypes.ListLogArgs{AppName: "myapp", Limit: 1, Before: cursor})
+		c.Assert(err, check.IsNil)
+		cursor = ""
+		if len(logs) > 0 {
+			messages = append(messages, logs[0].Message)
+			cursor = logs[0].Cursor
+		}
+	}
+	c.Assert(messages, check.DeepEquals, []string{"msg3", "msg2", "msg1", "msg0"})
+}
+
+func (s *LogServiceSuite) TestFileLogServiceRotate(c *check.C) {
+	config.Set("log:app-log-file:max-size", 100)
+	config.Set("log:app-log-file:max-files", 2)
+	svc, err := newFileLogService()
+	c.Assert(err, check.IsNil)
+	for _, msg := range []string{"msg1", "msg2", "msg3", "msg4"} {
+		err = svc.Add("myapp", msg, "web", "unit1")
+		c.Assert(err, check.IsNil)
+	}
+	files, err := filepath.Glob(filepath.Join(s.dir, "myapp.log*"))
+	c.Assert(err, check.IsNil)
+	c.Assert(files, check.DeepEquals, []string{
+		filepath.Join(s.dir, "myapp.log"),
+		filepath.Join(s.dir, "myapp.log.1"),
+		filepath.Join(s.dir, "myapp.log.2"),
+	})
+	logs, err := svc.List(appTypes.ListLogArgs{AppName: "myapp", Limit: 10})
+	c.Assert(err, check.IsNil)
+	c.Assert(logs, check.HasLen, 3)
+	c.Assert(logs[0].Message, check.Equals, "msg2")
+	c.Assert(logs[2].Message, check.Equals, "msg4")
+}
+
+func (s *LogServiceSuite) TestFileLogServiceWatch(c *check.C) {
+	config.Set("log:app-log-file:max-size", 100)
+	svc, err := newFileLogService()
+	c.Assert(err, check.IsNil)
+	err = svc.Add("myapp", "old", "web", "unit1")
+	c.Assert(err, check.IsNil)
+	w, err := svc.Watch("myapp", "web", "")
+	c.Assert(err, check.IsNil)
+	defer w.Close()
+	err = svc.Add("myapp", "ignored", "worker", "unit1")
+	c.Assert(err, check.IsNil)
+	// Each entry is larger than half of max-size, so every write after the
+	// first one rotates the file.
+	for _, msg := range []string{"msg1", "msg2", "msg3"} {
+		err = svc.Add("myapp", msg, "web", "unit1")
+		c.Assert(err, check.IsNil)
+		select {
+		case entry := <-w.ListenChan():
+			c.Assert(entry.Message, check.Equals, msg)
+		case <-time.After(5 * time.Second):
+			c.Fatalf("timed out waiting for %q", msg)
+		}
+	}
+	w.Close()
+	select {
+	case _, ok := <-w.ListenChan():
+		c.Assert(ok, check.Equals, false)
+	case <-time.After(5 * time.Second):
+		c.Fatal("timed out waiting for channel to close")
+	}
+}
+
+func (s *LogServiceSuite) TestFileLogServiceRemove(c *check.C) {
+	config.Set("log:app-log-file:max-size", 100)
+	svc, err := newFileLogService()
+	c.Assert(err, check.IsNil)
+	for _, msg := range []string{"msg1", "msg2"} {
+		err = svc.Add("myapp", msg, "web", "unit1")
+		c.Assert(err, check.IsNil)
+	}
+	err = svc.Remove("myapp")
+	c.Assert(err, check.IsNil)
+	_, err = os.Stat(filepath.Join(s.dir, "myapp.log"))
+	c.Assert(os.IsNotExist(err), check.Equals, true)
+	_, err = os.Stat(filepath.Join(s.dir, "myapp.log.1"))
+	c.Assert(os.IsNotExist(err), check.Equals, true)
+	logs, err := svc.List(appTypes.ListLogArgs{AppName: "myapp", Limit: 10})
+	c.Assert(err, check.IsNil)
+	c.Assert(logs, check.HasLen, 0)
+}
+
+func (s *LogServiceSuite) TestFileLogServiceListLargeFile(c *check.C) {
+	svc, err := newFileLogService()
+	c.Assert(err, check.IsNil)
+	defer svc.Shutdown(context.Background())
+	baseTime := time.Date(2018, 3, 1, 10, 0, 0, 0, time.UTC)
+	total := 3 * logFileChunkSize / 100
+	for i := 0; i < total; i++ {
+		err = svc.Enqueue(&appTypes.Applog{
+			AppName: "myapp",
+			Message: fmt.Sprintf("message %d", i),
+			Source:  "web",
+			Date:    baseTime.Add(time.Duration(i) * time.Millisecond),
+		})
+		c.Assert(err, check.IsNil)
+	}
+	logs, err := svc.List(appTypes.ListLogArgs{AppName: "myapp", Limit: 3})
+	c.Assert(err, check.IsNil)
+	c.Assert(logs, check.HasLen, 3)
+	for i, entry := range logs {
+		c.Assert(entry.Message, check.Equals, fmt.Sprintf("message %d", total-3+i))
+	}
+	logs, err = svc.List(appTypes.ListLogArgs{AppName: "myapp"})
+	c.Assert(err, check.IsNil)
+	c.Assert(logs, check.HasLen, total)
+	for i, entry := range logs {
+		c.Assert(entry.Message, check.Equals, fmt.Sprintf("message %d", i))
+	}
+}
+
+func (s *LogServiceSuite) TestFileLogServiceInvalidAppName(c *check.C) {
+	svc, err := newFileLogService()
+	c.Assert(err, check.IsNil)
+	defer svc.Shutdown(context.Background())
+	err = svc.Add("../myapp", "msg", "web", "unit1")
+	c.Assert(err, check.ErrorMatches, `invalid app name "../myapp"`)
+	_, err = svc.List(appTypes.ListLogArgs{AppName: "../myapp"})
+	c.Assert(err, check.ErrorMatches, `invalid app name "../myapp"`)
+	_, err = svc.Watch("../myapp", "", "")
+	c.Assert(err, check.ErrorMatches, `invalid app name "../myapp"`)
+	err = svc.Remove("../myapp")
+	c.Assert(err, check.ErrorMatches, `invalid app name "../myapp"`)
+	_, err = os.Stat(filepath.Join(filepath.Dir(s.dir), "myapp.log"))
+	c.Assert(os.IsNotExist(err), check.Equals, true)
+}
+
+func (s *LogServiceSuite) TestFileLogServiceSingleInstance(c *check.C) {
+	svc, err := newFileLogService()
+	c.Assert(err, check.IsNil)
+	_, err = newFileLogService()
+	c.Assert(err, check.ErrorMatches, `unable to lock app log directory .*, is it in use by another tsuru instance\?.*`)
+	err = svc.Shutdown(context.Background())
+	c.Assert(err, check.IsNil)
+	svc, err = newFileLogService()
+	c.Assert(err, check.IsNil)
+	svc.Shutdown(context.Background())
+}
+
+func (s *LogServiceSuite) TestAppLogServiceInvalid(c *check.C) {
+	config.Set("log:app-log-service", "invalid")
+	defer config.Unset("log:app-log-service")
+	_, err := AppLogService()
+	c.Assert(err, check.ErrorMatches, `invalid app log service "invalid"`)
+}
+
+func (s *LogServiceSuite) TestAppLogServiceFile(c *check.C) {
+	config.Set("log:app-log-service", "file")
+	defer config.Unset("log:app-log-service")
+	svc, err := AppLogService()
+	c.Assert(err, check.IsNil)
+	c.Assert(svc, check.FitsTypeOf, &fileLogService{})
+}
@@ -0,0 +1,170 @@
+// Copyright 2018 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package app
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/syslog"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/tsuru/config"
+	"github.com/tsuru/tsuru/api/shutdown"
+	"github.com/tsuru/tsuru/log"
+	tsuruNet "github.com/tsuru/tsuru/net"
+	appTypes "github.com/tsuru/tsuru/types/app"
+)
+
+var forwardMaxWaitTime = time.Second
+
+// forwardLogService stores the entries in the wrapped service and also sends
+// them asynchronously to a syslog server or an HTTP endpoint. Entries are
+// dropped if a sink is not able to keep up with the volume of logs.
+type forwardLogService struct {
+	appTypes.AppLogService
+	sinks []*logSink
+}
+
+type logSink struct {
+	name string
+	post func([]appTypes.Applog) error
+	*bulkProcessor
+}
+
+func (s *logSink) flush(msgs []interface{}, lastMessage *msgWithTS) bool {
+	entries := make([]appTypes.Applog, len(msgs))
+	for i, msg := range msgs {
+		entries[i] = *msg.(*appTypes.Applog)
+	}
+	err := s.post(entries)
+	if err != nil {
+		log.Errorf("[log forwarder] unable to send logs to %s: %s", s.name, err)
+		return false
+	}
+	return true
+}
+
+func newForwardLogService(base appTypes.AppLogService) (appTypes.AppLogService, error) {
+	var sinks []*logSink
+	if addr, _ := config.GetString("log:app-log-forward:syslog"); addr != "" {
+		send, err := syslogSender(addr)
+		if err != nil {
+			return nil, err
+		}
+		sinks = append(sinks, &logSink{name: addr, post: send})
+	}
+	if addr, _ := config.GetString("log:app-log-forward:http"); addr != "" {
+		sinks = append(sinks, &logSink{name: addr, post: httpSender(addr)})
+	}
+	if len(sinks) == 0 {
+		return base, nil
+	}
+	for _, sink := range sinks {
+		sink.bulkProcessor = initBulkProcessor(forwardMaxWaitTime, bulkMaxNumberMsgs)
+		sink.flushable = sink
+		go sink.run()
+	}
+	return &forwardLogService{AppLogService: base, sinks: sinks}, nil
+}
+
+// syslogSender parses addresses in the form <network>://<host>:<port>, where
+// network is either udp or tcp.
+func syslogSender(addr string) (func([]appTypes.Applog) error, error) {
+	u, err := url.Parse(addr)
+	if err != nil || (u.Scheme != "udp" && u.Scheme != "tcp") || u.Host == "" {
+		return nil, errors.Errorf("invalid syslog address %q, expected udp://host:port or tcp://host:port", addr)
+	}
+	var writer *syslog.Writer
+	return func(entries []appTypes.Applog) error {
+		if writer == nil {
+			var err error
+			writer, err = syslog.Dial(u.Scheme, u.Host, syslog.LOG_INFO|syslog.LOG_USER, "tsuru")
+			if err != nil {
+				return err
+			}
+		}
+		for _, entry := range entries {
+			err := writer.Info(fmt.Sprintf("%s %s[%s]: %s", entry.AppName, entry.Source, entry.Unit, entry.Message))
+			if err != nil {
+				writer.Close()
+				writer = nil
+				return err
+			}
+		}
+		return nil
+	}, nil
+}
+
+// httpSender posts the entries as a JSON array.
+func httpSender(addr string) func([]appTypes.Applog) error {
+	return func(entries []appTypes.Applog) error {
+		data, err := json.Marshal(entries)
+		if err != nil {
+			return err
+		}
+		rsp, err := tsuruNet.Dial5Full60ClientNoKeepAlive.Post(addr, "application/json", bytes.NewReader(data))
+		if err != nil {
+			return err
+		}
+		rsp.Body.Close()
+		if rsp.StatusCode < 200 || rsp.StatusCode >= 300 {
+			return errors.Errorf("invalid status code %d", rsp.StatusCode)
+		}
+		return nil
+	}
+}
+
+func (s *forwardLogService) forward(entry *appTypes.Applog) {
+	for _, sink := range s.sinks {
+		sink.send(&msgWithTS{msg: entry, arriveTime: time.Now()})
+	}
+}
+
+func (s *forwardLogService) Enqueue(entry *appTypes.Applog) error {
+	err := s.AppLogService.Enqueue(entry)
+	if err != nil {
+		return err
+	}
+	s.forward(entry)
+	return nil
+}
+
+func (s *forwardLogService) Add(appName, message, source, unit string) error {
+	err := s.AppLogService.Add(appName, message, source, unit)
+	if err != nil {
+		return err
+	}
+	for _, msg := range strings.Split(message, "\n") {
+		if msg != "" {
+			s.forward(&appTypes.Applog{
+				Date:    time.Now().In(time.UTC),
+				Message: msg,
+				Source:  source,
+				AppName: appName,
+				Unit:    unit,
+			})
+		}
+	}
+	return nil
+}
+
+func (s *forwardLogService) String() string {
+	return "app log forwarder"
+}
+
+func (s *forwardLogService) Shutdown(ctx context.Context) error {
+	for _, sink := range s.sinks {
+		sink.stopWait()
+	}
+	if base, ok := s.AppLogService.(shutdown.Shutdownable); ok {
+		return base.Shutdown(ctx)
+	}
+	return nil
+}
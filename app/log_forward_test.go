@@ -0,0 +1,73 @@
+// Copyright 2018 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"time"
+
+	"github.com/tsuru/config"
+	appTypes "github.com/tsuru/tsuru/types/app"
+	"gopkg.in/check.v1"
+)
+
+func (s *LogServiceSuite) TestForwardLogServiceNoSinks(c *check.C) {
+	base, err := newFileLogService()
+	c.Assert(err, check.IsNil)
+	svc, err := newForwardLogService(base)
+	c.Assert(err, check.IsNil)
+	c.Assert(svc, check.Equals, base)
+}
+
+func (s *LogServiceSuite) TestForwardLogServiceInvalidSyslog(c *check.C) {
+	config.Set("log:app-log-forward:syslog", "localhost:514")
+	defer config.Unset("log:app-log-forward")
+	base, err := newFileLogService()
+	c.Assert(err, check.IsNil)
+	_, err = newForwardLogService(base)
+	c.Assert(err, check.ErrorMatches, `invalid syslog address "localhost:514".*`)
+}
+
+func (s *LogServiceSuite) TestForwardLogServiceHTTP(c *check.C) {
+	var mu sync.Mutex
+	var received []appTypes.Applog
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c.Check(r.Method, check.Equals, http.MethodPost)
+		c.Check(r.Header.Get("Content-Type"), check.Equals, "application/json")
+		var entries []appTypes.Applog
+		err := json.NewDecoder(r.Body).Decode(&entries)
+		c.Check(err, check.IsNil)
+		mu.Lock()
+		received = append(received, entries...)
+		mu.Unlock()
+	}))
+	defer srv.Close()
+	config.Set("log:app-log-forward:http", srv.URL)
+	defer config.Unset("log:app-log-forward")
+	forwardMaxWaitTime = 10 * time.Millisecond
+	defer func() { forwardMaxWaitTime = time.Second }()
+	base, err := newFileLogService()
+	c.Assert(err, check.IsNil)
+	svc, err := newForwardLogService(base)
+	c.Assert(err, check.IsNil)
+	err = svc.Add("myapp", "msg1\nmsg2", "web", "unit1")
+	c.Assert(err, check.IsNil)
+	err = svc.Enqueue(&appTypes.Applog{AppName: "myapp", Message: "msg3", Source: "web", Unit: "unit1", Date: time.Now()})
+	c.Assert(err, check.IsNil)
+	err = svc.(*forwardLogService).Shutdown(context.Background())
+	c.Assert(err, check.IsNil)
+	mu.Lock()
+	defer mu.Unlock()
+	c.Assert(received, check.HasLen, 3)
+	c.Assert(received[0].Message, check.Equals, "msg1")
+	c.Assert(received[2].Message, check.Equals, "msg3")
+	logs, err := svc.List(appTypes.ListLogArgs{AppName: "myapp", Limit: 10})
+	c.Assert(err, check.IsNil)
+	c.Assert(logs, check.HasLen, 3)
+}
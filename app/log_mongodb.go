@@ -0,0 +1,177 @@
+// Copyright 2018 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package app
+
+import (
+	"context"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/globalsign/mgo/bson"
+	"github.com/pkg/errors"
+	"github.com/tsuru/config"
+	"github.com/tsuru/tsuru/db"
+	appTypes "github.com/tsuru/tsuru/types/app"
+)
+
+var _ appTypes.AppLogService = &mongodbLogService{}
+
+// mongodbLogService stores the logs of each app in a capped collection.
+// Entries sent through Enqueue are inserted in bulk by a LogDispatcher.
+type mongodbLogService struct {
+	mu         sync.Mutex
+	dispatcher *LogDispatcher
+}
+
+func (s *mongodbLogService) Enqueue(entry *appTypes.Applog) error {
+	s.mu.Lock()
+	if s.dispatcher == nil {
+		queueSize, _ := config.GetInt("server:app-log-buffer-size")
+		if queueSize == 0 {
+			queueSize = 500000
+		}
+		s.dispatcher = newLogDispatcher(queueSize)
+	}
+	dispatcher := s.dispatcher
+	s.mu.Unlock()
+	return dispatcher.Send(entry)
+}
+
+func (s *mongodbLogService) Add(appName, message, source, unit string) error {
+	return addMongoLogs(appName, message, source, unit)
+}
+
+func addMongoLogs(appName, message, source, unit string) error {
+	messages := strings.Split(message, "\n")
+	logs := make([]interface{}, 0, len(messages))
+	for _, msg := range messages {
+		if msg != "" {
+			l := appTypes.Applog{
+				Date:    time.Now().In(time.UTC),
+				Message: msg,
+				Source:  source,
+				AppName: appName,
+				Unit:    unit,
+			}
+			logs = append(logs, l)
+		}
+	}
+	if len(logs) > 0 {
+		conn, err := db.LogConn()
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+		return conn.Logs(appName).Insert(logs...)
+	}
+	return nil
+}
+
+// List returns the most recent entries matching args. The query is matched
+// by tsuru, with Go regular expressions, while iterating over the entries
+// returned by MongoDB, so it's never run by the database. Entries are sorted
+// by date when a time range is given, using the date index, and by _id
+// otherwise. The cursor of the entries is their _id.
+func (s *mongodbLogService) List(args appTypes.ListLogArgs) ([]appTypes.Applog, error) {
+	q := bson.M{}
+	if args.Source != "" {
+		q["source"] = args.Source
+	}
+	if args.Unit != "" {
+		q["unit"] = args.Unit
+	}
+	if args.InvertFilter {
+		for k, v := range q {
+			q[k] = bson.M{"$ne": v}
+		}
+	}
+	dateQuery := bson.M{}
+	if !args.Since.IsZero() {
+		dateQuery["$gte"] = args.Since
+	}
+	if !args.Until.IsZero() {
+		dateQuery["$lt"] = args.Until
+	}
+	sort := "-_id"
+	if len(dateQuery) > 0 {
+		q["date"] = dateQuery
+		sort = "-date"
+	}
+	var re *regexp.Regexp
+	if args.Query != "" {
+		var err error
+		re, err = regexp.Compile(args.Query)
+		if err != nil {
+			return nil, errors.Wrap(err, "invalid log query")
+		}
+	}
+	if args.Before != "" {
+		if !bson.IsObjectIdHex(args.Before) {
+			return nil, appTypes.ErrInvalidLogCursor
+		}
+		q["_id"] = bson.M{"$lt": bson.ObjectIdHex(args.Before)}
+		sort = "-_id"
+	}
+	conn, err := db.LogConn()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	query := conn.Logs(args.AppName).Find(q).Sort(sort)
+	if re == nil && args.Limit > 0 {
+		query = query.Limit(args.Limit)
+	}
+	iter := query.Iter()
+	logs := []appTypes.Applog{}
+	for args.Limit <= 0 || len(logs) < args.Limit {
+		var entry appTypes.Applog
+		if !iter.Next(&entry) {
+			break
+		}
+		if re == nil || re.MatchString(entry.Message) {
+			logs = append(logs, entry)
+		}
+	}
+	err = iter.Close()
+	if err != nil {
+		return nil, err
+	}
+	l := len(logs)
+	for i := 0; i < l/2; i++ {
+		logs[i], logs[l-1-i] = logs[l-1-i], logs[i]
+	}
+	for i := range logs {
+		logs[i].Cursor = logs[i].MongoID.Hex()
+	}
+	return logs, nil
+}
+
+func (s *mongodbLogService) Watch(appName, source, unit string) (appTypes.LogWatcher, error) {
+	return NewLogListener(&App{Name: appName}, appTypes.Applog{Source: source, Unit: unit})
+}
+
+// Shutdown flushes the entries pending in the dispatcher. A new dispatcher is
+// started if more entries are enqueued afterwards.
+func (s *mongodbLogService) Shutdown(ctx context.Context) error {
+	s.mu.Lock()
+	dispatcher := s.dispatcher
+	s.dispatcher = nil
+	s.mu.Unlock()
+	if dispatcher == nil {
+		return nil
+	}
+	return dispatcher.Shutdown(ctx)
+}
+
+func (s *mongodbLogService) Remove(appName string) error {
+	conn, err := db.LogConn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	return conn.Logs(appName).DropCollection()
+}
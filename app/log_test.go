@@ -13,6 +13,7 @@ import (
 	dto "github.com/prometheus/client_model/go"
 	"github.com/tsuru/config"
 	"github.com/tsuru/tsuru/db"
+	appTypes "github.com/tsuru/tsuru/types/app"
 	"gopkg.in/check.v1"
 )
 
@@ -25,13 +26,15 @@ func insertLogs(appName string, logs []interface{}) error {
 	return conn.Logs(appName).Insert(logs...)
 }
 
-func compareLogs(c *check.C, logs1 []Applog, logs2 []Applog) {
+func compareLogs(c *check.C, logs1 []appTypes.Applog, logs2 []appTypes.Applog) {
 	for i := range logs1 {
 		logs1[i].MongoID = ""
+		logs1[i].Cursor = ""
 		logs1[i].Date = logs1[i].Date.UTC()
 	}
 	for i := range logs2 {
 		logs2[i].MongoID = ""
+		logs2[i].Cursor = ""
 		logs2[i].Date = logs2[i].Date.UTC()
 	}
 	c.Assert(logs1, check.DeepEquals, logs2)
@@ -39,16 +42,16 @@ func compareLogs(c *check.C, logs1 []Applog, logs2 []Applog) {
 
 func (s *S) TestNewLogListener(c *check.C) {
 	app := App{Name: "myapp"}
-	l, err := NewLogListener(&app, Applog{})
+	l, err := NewLogListener(&app, appTypes.Applog{})
 	c.Assert(err, check.IsNil)
 	defer l.Close()
 	c.Assert(l.quit, check.NotNil)
 	c.Assert(l.c, check.NotNil)
-	err = insertLogs("myapp", []interface{}{Applog{Message: "123"}})
+	err = insertLogs("myapp", []interface{}{appTypes.Applog{Message: "123"}})
 	c.Assert(err, check.IsNil)
 	logMsg := <-l.c
 	c.Assert(logMsg.Message, check.Equals, "123")
-	err = insertLogs("myapp", []interface{}{Applog{Message: "456"}})
+	err = insertLogs("myapp", []interface{}{appTypes.Applog{Message: "456"}})
 	c.Assert(err, check.IsNil)
 	logMsg = <-l.c
 	c.Assert(logMsg.Message, check.Equals, "456")
@@ -56,17 +59,17 @@ func (s *S) TestNewLogListener(c *check.C) {
 
 func (s *S) TestNewLogListenerFiltered(c *check.C) {
 	app := App{Name: "myapp"}
-	l, err := NewLogListener(&app, Applog{Source: "web", Unit: "u1"})
+	l, err := NewLogListener(&app, appTypes.Applog{Source: "web", Unit: "u1"})
 	c.Assert(err, check.IsNil)
 	defer l.Close()
 	c.Assert(l.quit, check.NotNil)
 	c.Assert(l.c, check.NotNil)
 	err = insertLogs("myapp", []interface{}{
-		Applog{Message: "1", Source: "web", Unit: "u1"},
-		Applog{Message: "2", Source: "worker", Unit: "u1"},
-		Applog{Message: "3", Source: "web", Unit: "u1"},
-		Applog{Message: "4", Source: "web", Unit: "u2"},
-		Applog{Message: "5", Source: "web", Unit: "u1"},
+		appTypes.Applog{Message: "1", Source: "web", Unit: "u1"},
+		appTypes.Applog{Message: "2", Source: "worker", Unit: "u1"},
+		appTypes.Applog{Message: "3", Source: "web", Unit: "u1"},
+		appTypes.Applog{Message: "4", Source: "web", Unit: "u2"},
+		appTypes.Applog{Message: "5", Source: "web", Unit: "u1"},
 	})
 	c.Assert(err, check.IsNil)
 	logMsg := <-l.c
@@ -79,7 +82,7 @@ func (s *S) TestNewLogListenerFiltered(c *check.C) {
 
 func (s *S) TestNewLogListenerClosingChannel(c *check.C) {
 	app := App{Name: "myapp"}
-	l, err := NewLogListener(&app, Applog{})
+	l, err := NewLogListener(&app, appTypes.Applog{})
 	c.Assert(err, check.IsNil)
 	c.Assert(l.quit, check.NotNil)
 	c.Assert(l.c, check.NotNil)
@@ -90,7 +93,7 @@ func (s *S) TestNewLogListenerClosingChannel(c *check.C) {
 
 func (s *S) TestLogListenerClose(c *check.C) {
 	app := App{Name: "myapp"}
-	l, err := NewLogListener(&app, Applog{})
+	l, err := NewLogListener(&app, appTypes.Applog{})
 	c.Assert(err, check.IsNil)
 	l.Close()
 	_, ok := <-l.c
@@ -102,7 +105,7 @@ func (s *S) TestLogListenerDoubleClose(c *check.C) {
 		c.Assert(recover(), check.IsNil)
 	}()
 	app := App{Name: "yourapp"}
-	l, err := NewLogListener(&app, Applog{})
+	l, err := NewLogListener(&app, appTypes.Applog{})
 	c.Assert(err, check.IsNil)
 	l.Close()
 	l.Close()
@@ -110,11 +113,11 @@ func (s *S) TestLogListenerDoubleClose(c *check.C) {
 
 func (s *S) TestNotify(c *check.C) {
 	var logs struct {
-		l []Applog
+		l []appTypes.Applog
 		sync.Mutex
 	}
 	app := App{Name: "fade"}
-	l, err := NewLogListener(&app, Applog{})
+	l, err := NewLogListener(&app, appTypes.Applog{})
 	c.Assert(err, check.IsNil)
 	defer l.Close()
 	go func() {
@@ -126,8 +129,8 @@ func (s *S) TestNotify(c *check.C) {
 	}()
 	t := time.Date(2014, 7, 10, 15, 0, 0, 0, time.UTC)
 	ms := []interface{}{
-		Applog{Date: t, Message: "Something went wrong. Check it out:", Source: "tsuru", Unit: "some"},
-		Applog{Date: t, Message: "This program has performed an illegal operation.", Source: "tsuru", Unit: "some"},
+		appTypes.Applog{Date: t, Message: "Something went wrong. Check it out:", Source: "tsuru", Unit: "some"},
+		appTypes.Applog{Date: t, Message: "This program has performed an illegal operation.", Source: "tsuru", Unit: "some"},
 	}
 	insertLogs(app.Name, ms)
 	done := make(chan bool, 1)
@@ -156,16 +159,16 @@ func (s *S) TestNotify(c *check.C) {
 	}
 	logs.Lock()
 	defer logs.Unlock()
-	compareLogs(c, logs.l, []Applog{ms[0].(Applog), ms[1].(Applog)})
+	compareLogs(c, logs.l, []appTypes.Applog{ms[0].(appTypes.Applog), ms[1].(appTypes.Applog)})
 }
 
 func (s *S) TestNotifyFiltered(c *check.C) {
 	var logs struct {
-		l []Applog
+		l []appTypes.Applog
 		sync.Mutex
 	}
 	app := App{Name: "fade"}
-	l, err := NewLogListener(&app, Applog{Source: "tsuru", Unit: "unit1"})
+	l, err := NewLogListener(&app, appTypes.Applog{Source: "tsuru", Unit: "unit1"})
 	c.Assert(err, check.IsNil)
 	defer l.Close()
 	go func() {
@@ -177,9 +180,9 @@ func (s *S) TestNotifyFiltered(c *check.C) {
 	}()
 	t := time.Date(2014, 7, 10, 15, 0, 0, 0, time.UTC)
 	ms := []interface{}{
-		Applog{Date: t, Message: "Something went wrong. Check it out:", Source: "tsuru", Unit: "unit1"},
-		Applog{Date: t, Message: "This program has performed an illegal operation.", Source: "other", Unit: "unit1"},
-		Applog{Date: t, Message: "Last one.", Source: "tsuru", Unit: "unit2"},
+		appTypes.Applog{Date: t, Message: "Something went wrong. Check it out:", Source: "tsuru", Unit: "unit1"},
+		appTypes.Applog{Date: t, Message: "This program has performed an illegal operation.", Source: "other", Unit: "unit1"},
+		appTypes.Applog{Date: t, Message: "Last one.", Source: "tsuru", Unit: "unit2"},
 	}
 	insertLogs(app.Name, ms)
 	done := make(chan bool, 1)
@@ -208,7 +211,7 @@ func (s *S) TestNotifyFiltered(c *check.C) {
 	}
 	logs.Lock()
 	defer logs.Unlock()
-	compareLogs(c, logs.l, []Applog{
+	compareLogs(c, logs.l, []appTypes.Applog{
 		{Date: t, Message: "Something went wrong. Check it out:", Source: "tsuru", Unit: "unit1"},
 	})
 }
@@ -218,11 +221,11 @@ func (s *S) TestNotifySendOnClosedChannel(c *check.C) {
 		c.Assert(recover(), check.IsNil)
 	}()
 	app := App{Name: "fade"}
-	l, err := NewLogListener(&app, Applog{})
+	l, err := NewLogListener(&app, appTypes.Applog{})
 	c.Assert(err, check.IsNil)
 	l.Close()
 	ms := []interface{}{
-		Applog{Date: time.Now(), Message: "Something went wrong. Check it out:", Source: "tsuru"},
+		appTypes.Applog{Date: time.Now(), Message: "Something went wrong. Check it out:", Source: "tsuru"},
 	}
 	insertLogs(app.Name, ms)
 }
@@ -232,21 +235,21 @@ func (s *S) TestLogDispatcherSend(c *check.C) {
 	app := App{Name: "myapp1", Platform: "zend", TeamOwner: s.team.Name}
 	err := CreateApp(&app, s.user)
 	c.Assert(err, check.IsNil)
-	listener, err := NewLogListener(&app, Applog{})
+	listener, err := NewLogListener(&app, appTypes.Applog{})
 	c.Assert(err, check.IsNil)
 	defer listener.Close()
 	dispatcher := NewlogDispatcher(2000000)
 	baseTime, err := time.Parse(time.RFC3339, "2015-06-16T15:00:00.000Z")
 	c.Assert(err, check.IsNil)
 	baseTime = baseTime.Local()
-	logMsg := Applog{
+	logMsg := appTypes.Applog{
 		Date: baseTime, Message: "msg1", Source: "web", AppName: "myapp1", Unit: "unit1",
 	}
 	dispatcher.Send(&logMsg)
 	dispatcher.Shutdown(context.Background())
-	logs, err := app.LastLogs(1, Applog{})
+	logs, err := app.LastLogs(1, appTypes.Applog{})
 	c.Assert(err, check.IsNil)
-	compareLogs(c, logs, []Applog{logMsg})
+	compareLogs(c, logs, []appTypes.Applog{logMsg})
 	err = dispatcher.Send(&logMsg)
 	c.Assert(err, check.ErrorMatches, `log dispatcher is shutting down`)
 	var dtoMetric dto.Metric
@@ -255,7 +258,7 @@ func (s *S) TestLogDispatcherSend(c *check.C) {
 	ch := listener.ListenChan()
 	recvMsg := <-ch
 	recvMsg.Date = baseTime
-	compareLogs(c, []Applog{recvMsg}, []Applog{logMsg})
+	compareLogs(c, []appTypes.Applog{recvMsg}, []appTypes.Applog{logMsg})
 }
 
 func (s *S) TestLogDispatcherSendConcurrent(c *check.C) {
@@ -269,7 +272,7 @@ func (s *S) TestLogDispatcherSendConcurrent(c *check.C) {
 	baseTime, err := time.Parse(time.RFC3339, "2015-06-16T15:00:00.000Z")
 	c.Assert(err, check.IsNil)
 	baseTime = baseTime.Local()
-	logMsg := []Applog{
+	logMsg := []appTypes.Applog{
 		{Date: baseTime, Message: "msg1", Source: "web", AppName: "myapp1", Unit: "unit1"},
 		{Date: baseTime, Message: "msg2", Source: "web", AppName: "myapp2", Unit: "unit1"},
 	}
@@ -284,10 +287,10 @@ func (s *S) TestLogDispatcherSendConcurrent(c *check.C) {
 	}
 	wg.Wait()
 	dispatcher.Shutdown(context.Background())
-	logs, err := app1.LastLogs(nConcurrent/2, Applog{})
+	logs, err := app1.LastLogs(nConcurrent/2, appTypes.Applog{})
 	c.Assert(err, check.IsNil)
 	c.Assert(logs, check.HasLen, nConcurrent/2)
-	logs, err = app2.LastLogs(nConcurrent/2, Applog{})
+	logs, err = app2.LastLogs(nConcurrent/2, appTypes.Applog{})
 	c.Assert(err, check.IsNil)
 	c.Assert(logs, check.HasLen, nConcurrent/2)
 }
@@ -304,7 +307,7 @@ func (s *S) TestLogDispatcherShutdownConcurrent(c *check.C) {
 	baseTime, err := time.Parse(time.RFC3339, "2015-06-16T15:00:00.000Z")
 	c.Assert(err, check.IsNil)
 	baseTime = baseTime.Local()
-	logMsg := []Applog{
+	logMsg := []appTypes.Applog{
 		{Date: baseTime, Message: "msg1", Source: "web", AppName: "myapp1", Unit: "unit1"},
 		{Date: baseTime, Message: "msg2", Source: "web", AppName: "myapp2", Unit: "unit1"},
 	}
@@ -328,7 +331,7 @@ func (s *S) TestLogDispatcherSendDBFailure(c *check.C) {
 	baseTime, err := time.Parse(time.RFC3339, "2015-06-16T15:00:00.000Z")
 	c.Assert(err, check.IsNil)
 	baseTime = baseTime.Local()
-	logMsg := Applog{
+	logMsg := appTypes.Applog{
 		Date: baseTime, Message: "msg1", Source: "web", AppName: "myapp1", Unit: "unit1",
 	}
 	oldDbURL, err := config.Get("database:url")
@@ -351,7 +354,7 @@ func (s *S) TestLogDispatcherSendDBFailure(c *check.C) {
 	timeout := time.After(10 * time.Second)
 loop:
 	for {
-		logs, logsErr := app.LastLogs(10, Applog{})
+		logs, logsErr := app.LastLogs(10, appTypes.Applog{})
 		c.Assert(logsErr, check.IsNil)
 		if len(logs) == 10 {
 			break
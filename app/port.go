@@ -0,0 +1,59 @@
+// Copyright 2018 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package app
+
+import (
+	"net/url"
+
+	"github.com/pkg/errors"
+	"github.com/tsuru/tsuru/app/image"
+	"github.com/tsuru/tsuru/provision"
+)
+
+// GetPorts returns the extra ports declared in the tsuru.yaml of the current
+// image of the app, with the default process and protocol filled.
+func (app *App) GetPorts() ([]provision.AppPort, error) {
+	imageName, err := image.AppCurrentImageName(app.Name)
+	if err != nil {
+		if err == image.ErrNoImagesAvailable {
+			return nil, nil
+		}
+		return nil, err
+	}
+	yamlData, err := image.GetImageTsuruYamlData(imageName)
+	if err != nil {
+		return nil, err
+	}
+	if len(yamlData.Ports) == 0 {
+		return nil, nil
+	}
+	webProcessName, err := image.GetImageWebProcessName(imageName)
+	if err != nil {
+		return nil, err
+	}
+	ports := make([]provision.AppPort, len(yamlData.Ports))
+	for i, p := range yamlData.Ports {
+		if p.Process == "" {
+			p.Process = webProcessName
+		}
+		p.Protocol = p.GetProtocol()
+		ports[i] = p
+	}
+	return ports, nil
+}
+
+// PortRoutableAddresses returns the addresses used to access the given port
+// in the units of the app.
+func (app *App) PortRoutableAddresses(port provision.AppPort) ([]url.URL, error) {
+	prov, err := app.getProvisioner()
+	if err != nil {
+		return nil, err
+	}
+	routableProv, ok := prov.(provision.PortRoutableProvisioner)
+	if !ok {
+		return nil, errors.Errorf("provisioner %q does not support routing to extra ports", prov.GetName())
+	}
+	return routableProv.PortRoutableAddresses(app, port)
+}
@@ -0,0 +1,54 @@
+// Copyright 2018 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package app
+
+import (
+	"net/url"
+
+	"github.com/tsuru/tsuru/app/image"
+	"github.com/tsuru/tsuru/provision"
+	"github.com/tsuru/tsuru/provision/provisiontest"
+	"gopkg.in/check.v1"
+)
+
+func (s *S) TestGetPorts(c *check.C) {
+	a := App{Name: "ports-app", Platform: "python", TeamOwner: s.team.Name}
+	err := CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	ports, err := a.GetPorts()
+	c.Assert(err, check.IsNil)
+	c.Assert(ports, check.IsNil)
+	err = image.SaveImageCustomData("registry.somewhere/tsuru/app-ports-app:v1", map[string]interface{}{
+		"processes": map[string]interface{}{"web": "./web", "api": "./api"},
+		"ports": []provision.AppPort{
+			{Name: "mqtt", Port: 1883},
+			{Name: "api", Port: 9000, Protocol: "grpc", Process: "api"},
+		},
+	})
+	c.Assert(err, check.IsNil)
+	err = image.AppendAppImageName(a.Name, "registry.somewhere/tsuru/app-ports-app:v1")
+	c.Assert(err, check.IsNil)
+	ports, err = a.GetPorts()
+	c.Assert(err, check.IsNil)
+	c.Assert(ports, check.DeepEquals, []provision.AppPort{
+		{Name: "mqtt", Port: 1883, Protocol: "tcp", Process: "web"},
+		{Name: "api", Port: 9000, Protocol: "grpc", Process: "api"},
+	})
+}
+
+func (s *S) TestPortRoutableAddresses(c *check.C) {
+	a := App{Name: "ports-app", Platform: "python", TeamOwner: s.team.Name}
+	err := CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	err = provisiontest.ProvisionerInstance.AddUnits(&a, 1, "api", nil)
+	c.Assert(err, check.IsNil)
+	units, err := a.Units()
+	c.Assert(err, check.IsNil)
+	addrs, err := a.PortRoutableAddresses(provision.AppPort{Name: "api", Port: 9000, Protocol: "grpc", Process: "api"})
+	c.Assert(err, check.IsNil)
+	c.Assert(addrs, check.DeepEquals, []url.URL{
+		{Scheme: "grpc", Host: units[0].Address.Hostname() + ":9000"},
+	})
+}
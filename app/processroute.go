@@ -0,0 +1,157 @@
+// Copyright 2018 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package app
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+
+	"github.com/globalsign/mgo"
+	"github.com/globalsign/mgo/bson"
+	"github.com/pkg/errors"
+	"github.com/tsuru/tsuru/app/image"
+	"github.com/tsuru/tsuru/db"
+	tsuruErrors "github.com/tsuru/tsuru/errors"
+	"github.com/tsuru/tsuru/provision"
+	"github.com/tsuru/tsuru/router"
+	"github.com/tsuru/tsuru/router/rebuild"
+	appTypes "github.com/tsuru/tsuru/types/app"
+)
+
+var (
+	ErrProcessRouteNotFound = errors.New("process route not found")
+
+	processRoutePathRegexp = regexp.MustCompile(`^(/[a-zA-Z0-9._~-]+)+$`)
+)
+
+// GetProcessRoutes returns the paths routed to processes other than the web
+// process of the app.
+func (app *App) GetProcessRoutes() []appTypes.ProcessRoute {
+	return app.ProcessRoutes
+}
+
+// ProcessRoutableAddresses returns the addresses used to access the units of
+// the given process of the app.
+func (app *App) ProcessRoutableAddresses(process string) ([]url.URL, error) {
+	prov, err := app.getProvisioner()
+	if err != nil {
+		return nil, err
+	}
+	routableProv, ok := prov.(provision.ProcessRoutableProvisioner)
+	if !ok {
+		return nil, errors.Errorf("provisioner %q does not support routing to processes", prov.GetName())
+	}
+	return routableProv.ProcessRoutableAddresses(app, process)
+}
+
+// SetProcessRoute routes the requests whose path starts with route.Path to
+// the units of route.Process, replacing any route with the same path.
+func (app *App) SetProcessRoute(route appTypes.ProcessRoute) error {
+	err := app.validateProcessRoute(route)
+	if err != nil {
+		return err
+	}
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	err = conn.Apps().Update(bson.M{"name": app.Name}, bson.M{"$pull": bson.M{"processroutes": bson.M{"path": route.Path}}})
+	if err != nil {
+		return err
+	}
+	err = conn.Apps().Update(bson.M{"name": app.Name}, bson.M{"$push": bson.M{"processroutes": route}})
+	if err != nil {
+		return err
+	}
+	app.removeProcessRouteFromList(route.Path)
+	app.ProcessRoutes = append(app.ProcessRoutes, route)
+	rebuild.RoutesRebuildOrEnqueue(app.Name)
+	return nil
+}
+
+// RemoveProcessRoute stops routing the requests whose path starts with path
+// to another process, sending them to the web process again.
+func (app *App) RemoveProcessRoute(path string) error {
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	err = conn.Apps().Update(
+		bson.M{"name": app.Name, "processroutes.path": path},
+		bson.M{"$pull": bson.M{"processroutes": bson.M{"path": path}}},
+	)
+	if err != nil {
+		if err == mgo.ErrNotFound {
+			return ErrProcessRouteNotFound
+		}
+		return err
+	}
+	app.removeProcessRouteFromList(path)
+	rebuild.RoutesRebuildOrEnqueue(app.Name)
+	return nil
+}
+
+func (app *App) removeProcessRouteFromList(path string) {
+	for i, route := range app.ProcessRoutes {
+		if route.Path == path {
+			app.ProcessRoutes = append(app.ProcessRoutes[:i], app.ProcessRoutes[i+1:]...)
+			return
+		}
+	}
+}
+
+func (app *App) validateProcessRoute(route appTypes.ProcessRoute) error {
+	if !processRoutePathRegexp.MatchString(route.Path) {
+		return &tsuruErrors.ValidationError{
+			Message: fmt.Sprintf("invalid path %q, it must start with / and have only letters, numbers and the characters . _ ~ -", route.Path),
+		}
+	}
+	if route.Process == "" {
+		return &tsuruErrors.ValidationError{Message: "process is required"}
+	}
+	prov, err := app.getProvisioner()
+	if err != nil {
+		return err
+	}
+	if _, ok := prov.(provision.ProcessRoutableProvisioner); !ok {
+		return &tsuruErrors.ValidationError{
+			Message: fmt.Sprintf("provisioner %q does not support routing to processes", prov.GetName()),
+		}
+	}
+	if !app.hasPathRouter() {
+		return &tsuruErrors.ValidationError{Message: "none of the routers of the app support routing paths to processes"}
+	}
+	imageName, err := image.AppCurrentImageName(app.Name)
+	if err != nil {
+		if err == image.ErrNoImagesAvailable {
+			return nil
+		}
+		return err
+	}
+	imgData, err := image.GetImageMetaData(imageName)
+	if err != nil {
+		return err
+	}
+	if _, ok := imgData.Processes[route.Process]; !ok {
+		return &tsuruErrors.ValidationError{Message: fmt.Sprintf("process %q not found in app", route.Process)}
+	}
+	return nil
+}
+
+func (app *App) hasPathRouter() bool {
+	for _, appRouter := range app.GetRouters() {
+		r, err := router.Get(appRouter.Name)
+		if err != nil {
+			continue
+		}
+		if _, ok := r.(router.PathRouter); ok {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,101 @@
+// Copyright 2018 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package app
+
+import (
+	"github.com/tsuru/config"
+	"github.com/tsuru/tsuru/app/image"
+	tsuruErrors "github.com/tsuru/tsuru/errors"
+	"github.com/tsuru/tsuru/provision/provisiontest"
+	"github.com/tsuru/tsuru/router/routertest"
+	appTypes "github.com/tsuru/tsuru/types/app"
+	"gopkg.in/check.v1"
+)
+
+func (s *S) createProcessRouteApp(c *check.C, routerName string) *App {
+	a := App{Name: "paths-app", Platform: "python", TeamOwner: s.team.Name, Router: routerName}
+	err := CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	err = image.SaveImageCustomData("registry.somewhere/tsuru/app-paths-app:v1", map[string]interface{}{
+		"processes": map[string]interface{}{"web": "./web", "api": "./api"},
+	})
+	c.Assert(err, check.IsNil)
+	err = image.AppendAppImageName(a.Name, "registry.somewhere/tsuru/app-paths-app:v1")
+	c.Assert(err, check.IsNil)
+	return &a
+}
+
+func (s *S) TestSetProcessRoute(c *check.C) {
+	config.Set("routers:fake-path:type", "fake-path")
+	defer config.Unset("routers:fake-path")
+	a := s.createProcessRouteApp(c, "fake-path")
+	err := provisiontest.ProvisionerInstance.AddUnits(a, 1, "api", nil)
+	c.Assert(err, check.IsNil)
+	err = a.SetProcessRoute(appTypes.ProcessRoute{Path: "/api", Process: "web"})
+	c.Assert(err, check.IsNil)
+	err = a.SetProcessRoute(appTypes.ProcessRoute{Path: "/api", Process: "api"})
+	c.Assert(err, check.IsNil)
+	expected := []appTypes.ProcessRoute{{Path: "/api", Process: "api"}}
+	c.Assert(a.GetProcessRoutes(), check.DeepEquals, expected)
+	dbApp, err := GetByName(a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(dbApp.ProcessRoutes, check.DeepEquals, expected)
+	addrs, err := a.ProcessRoutableAddresses("api")
+	c.Assert(err, check.IsNil)
+	c.Assert(addrs, check.HasLen, 1)
+	c.Assert(routertest.PathRouter.Paths[a.Name], check.DeepEquals, map[string][]string{
+		"/api": {addrs[0].Host},
+	})
+}
+
+func (s *S) TestSetProcessRouteInvalid(c *check.C) {
+	config.Set("routers:fake-path:type", "fake-path")
+	defer config.Unset("routers:fake-path")
+	a := s.createProcessRouteApp(c, "fake-path")
+	tests := []struct {
+		route appTypes.ProcessRoute
+		err   string
+	}{
+		{appTypes.ProcessRoute{Path: "/", Process: "api"}, `invalid path "/".*`},
+		{appTypes.ProcessRoute{Path: "api", Process: "api"}, `invalid path "api".*`},
+		{appTypes.ProcessRoute{Path: "/api/", Process: "api"}, `invalid path "/api/".*`},
+		{appTypes.ProcessRoute{Path: "/api;", Process: "api"}, `invalid path "/api;".*`},
+		{appTypes.ProcessRoute{Path: "/api"}, "process is required"},
+		{appTypes.ProcessRoute{Path: "/api", Process: "worker"}, `process "worker" not found in app`},
+	}
+	for _, tt := range tests {
+		err := a.SetProcessRoute(tt.route)
+		c.Assert(err, check.FitsTypeOf, &tsuruErrors.ValidationError{})
+		c.Assert(err, check.ErrorMatches, tt.err)
+	}
+	dbApp, err := GetByName(a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(dbApp.ProcessRoutes, check.IsNil)
+}
+
+func (s *S) TestSetProcessRouteRouterNotSupported(c *check.C) {
+	a := s.createProcessRouteApp(c, "fake")
+	err := a.SetProcessRoute(appTypes.ProcessRoute{Path: "/api", Process: "api"})
+	c.Assert(err, check.FitsTypeOf, &tsuruErrors.ValidationError{})
+	c.Assert(err, check.ErrorMatches, "none of the routers of the app support routing paths to processes")
+}
+
+func (s *S) TestRemoveProcessRoute(c *check.C) {
+	config.Set("routers:fake-path:type", "fake-path")
+	defer config.Unset("routers:fake-path")
+	a := s.createProcessRouteApp(c, "fake-path")
+	err := a.SetProcessRoute(appTypes.ProcessRoute{Path: "/api", Process: "api"})
+	c.Assert(err, check.IsNil)
+	c.Assert(routertest.PathRouter.Paths[a.Name], check.HasLen, 1)
+	err = a.RemoveProcessRoute("/api")
+	c.Assert(err, check.IsNil)
+	c.Assert(a.GetProcessRoutes(), check.HasLen, 0)
+	dbApp, err := GetByName(a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(dbApp.ProcessRoutes, check.HasLen, 0)
+	c.Assert(routertest.PathRouter.Paths[a.Name], check.HasLen, 0)
+	err = a.RemoveProcessRoute("/api")
+	c.Assert(err, check.Equals, ErrProcessRouteNotFound)
+}
@@ -12,11 +12,30 @@ import (
 	"github.com/tsuru/tsuru/quota"
 )
 
-func reserveUnits(app *App, quantity int) error {
-	app, err := checkAppLimit(app.Name, quantity)
+func reserveUnits(app *App, quantity int) (err error) {
+	app, err = checkAppLimit(app.Name, quantity)
 	if err != nil {
 		return err
 	}
+	teamUsage := unitsTeamQuotaUsage(app, quantity)
+	err = reserveTeamQuota(app.TeamOwner, teamUsage)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			releaseTeamQuota(app.TeamOwner, teamUsage)
+		}
+	}()
+	err = reservePoolCapacity(app.GetPool(), quantity, app.Plan)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			releasePoolCapacity(app.GetPool(), quantity, app.Plan)
+		}
+	}()
 	conn, err := db.Conn()
 	if err != nil {
 		return err
@@ -77,7 +96,18 @@ func releaseUnits(app *App, quantity int) error {
 			bson.M{"$inc": bson.M{"quota.inuse": -1 * quantity}},
 		)
 	}
-	return err
+	if err != nil {
+		return err
+	}
+	err = releasePoolCapacity(app.GetPool(), quantity, app.Plan)
+	if err != nil {
+		return err
+	}
+	return releaseTeamQuota(app.TeamOwner, unitsTeamQuotaUsage(app, quantity))
+}
+
+func unitsTeamQuotaUsage(app *App, units int) teamQuotaUsage {
+	return teamQuotaUsage{Units: units, Memory: units * int(app.Plan.Memory)}
 }
 
 func checkAppUsage(name string, quantity int) (*App, error) {
@@ -127,11 +127,15 @@ func (s *S) SetUpTest(c *check.C) {
 	routertest.HCRouter.Reset()
 	routertest.TLSRouter.Reset()
 	routertest.OptsRouter.Reset()
+	routertest.AccessControlRouter.Reset()
+	routertest.PathRouter.Reset()
 	queue.ResetQueue()
 	routertest.FakeRouter.Reset()
 	routertest.HCRouter.Reset()
 	routertest.TLSRouter.Reset()
 	routertest.OptsRouter.Reset()
+	routertest.AccessControlRouter.Reset()
+	routertest.PathRouter.Reset()
 	pool.ResetCache()
 	err := rebuild.RegisterTask(func(appName string) (rebuild.RebuildApp, error) {
 		a, err := GetByName(appName)
@@ -0,0 +1,294 @@
+// Copyright 2018 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package app
+
+import (
+	"fmt"
+
+	"github.com/globalsign/mgo"
+	"github.com/globalsign/mgo/bson"
+	"github.com/tsuru/config"
+	"github.com/tsuru/tsuru/db"
+	tsuruErrors "github.com/tsuru/tsuru/errors"
+	"github.com/tsuru/tsuru/quota"
+)
+
+// TeamQuota represents the limits on the resources used by all apps owned by
+// a team. Limits are either set through ChangeTeamQuota or taken from the
+// quota:apps-per-team, quota:units-per-team and quota:memory-per-team
+// settings. Memory is accounted as the memory of the app plan times the
+// number of units of the app.
+//
+// Usage is reserved in the team document whenever apps are created or gain
+// units, and released when they are removed, so concurrent requests can't
+// take the team over its limits.
+type TeamQuota struct {
+	Team   string      `json:"team"`
+	Apps   quota.Quota `json:"apps"`
+	Units  quota.Quota `json:"units"`
+	Memory quota.Quota `json:"memory"`
+}
+
+// TeamQuotaExceededError is returned when an operation would make a team go
+// over one of its limits.
+type TeamQuotaExceededError struct {
+	quota.QuotaExceededError
+	Team     string
+	Resource string
+}
+
+func (err *TeamQuotaExceededError) Error() string {
+	return fmt.Sprintf("Team %q quota exceeded for %s. Available: %d. Requested: %d.", err.Team, err.Resource, err.Available, err.Requested)
+}
+
+// teamQuotaDoc is the document stored for each team. Limits not explicitly
+// set are nil and fall back to the config defaults, InUse is nil until the
+// usage of the team is first calculated from its apps.
+type teamQuotaDoc struct {
+	Team   string          `bson:"_id"`
+	Apps   *int            `bson:",omitempty"`
+	Units  *int            `bson:",omitempty"`
+	Memory *int            `bson:",omitempty"`
+	InUse  *teamQuotaUsage `bson:",omitempty"`
+}
+
+type teamQuotaUsage struct {
+	Apps, Units, Memory int
+}
+
+func (u teamQuotaUsage) inc(sign int) bson.M {
+	return bson.M{
+		"inuse.apps":   sign * u.Apps,
+		"inuse.units":  sign * u.Units,
+		"inuse.memory": sign * u.Memory,
+	}
+}
+
+func defaultTeamQuotaLimit(key string) int {
+	limit, err := config.GetInt(key)
+	if err != nil || limit < 0 {
+		return -1
+	}
+	return limit
+}
+
+func teamQuotaLimit(limit *int, key string) int {
+	if limit == nil {
+		return defaultTeamQuotaLimit(key)
+	}
+	return *limit
+}
+
+func (d *teamQuotaDoc) limits() teamQuotaUsage {
+	return teamQuotaUsage{
+		Apps:   teamQuotaLimit(d.Apps, "quota:apps-per-team"),
+		Units:  teamQuotaLimit(d.Units, "quota:units-per-team"),
+		Memory: teamQuotaLimit(d.Memory, "quota:memory-per-team"),
+	}
+}
+
+func getTeamQuotaUsage(conn *db.Storage, team string) (teamQuotaUsage, error) {
+	var apps []App
+	err := conn.Apps().Find(bson.M{"teamowner": team}).Select(bson.M{"quota": 1, "plan": 1}).All(&apps)
+	if err != nil {
+		return teamQuotaUsage{}, err
+	}
+	usage := teamQuotaUsage{Apps: len(apps)}
+	for _, a := range apps {
+		usage.Units += a.Quota.InUse
+		usage.Memory += int(a.Plan.Memory) * a.Quota.InUse
+	}
+	return usage, nil
+}
+
+// loadTeamQuota returns the quota document of the team, initializing its
+// usage from the apps owned by the team when it's not tracked yet.
+func loadTeamQuota(conn *db.Storage, team string) (*teamQuotaDoc, error) {
+	var doc teamQuotaDoc
+	err := conn.TeamQuotas().FindId(team).One(&doc)
+	if err == nil && doc.InUse != nil {
+		return &doc, nil
+	}
+	if err != nil && err != mgo.ErrNotFound {
+		return nil, err
+	}
+	usage, err := getTeamQuotaUsage(conn, team)
+	if err != nil {
+		return nil, err
+	}
+	_, err = conn.TeamQuotas().Upsert(
+		bson.M{"_id": team, "inuse": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"inuse": usage}},
+	)
+	if err != nil && !mgo.IsDup(err) {
+		return nil, err
+	}
+	doc = teamQuotaDoc{}
+	err = conn.TeamQuotas().FindId(team).One(&doc)
+	if err != nil {
+		return nil, err
+	}
+	return &doc, nil
+}
+
+// GetTeamQuota returns the limits and the current usage of the given team.
+func GetTeamQuota(team string) (*TeamQuota, error) {
+	conn, err := db.Conn()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	doc, err := loadTeamQuota(conn, team)
+	if err != nil {
+		return nil, err
+	}
+	limits := doc.limits()
+	return &TeamQuota{
+		Team:   team,
+		Apps:   quota.Quota{Limit: limits.Apps, InUse: doc.InUse.Apps},
+		Units:  quota.Quota{Limit: limits.Units, InUse: doc.InUse.Units},
+		Memory: quota.Quota{Limit: limits.Memory, InUse: doc.InUse.Memory},
+	}, nil
+}
+
+// ChangeTeamQuota redefines the limits of the team. Each new limit must be
+// bigger than or equal to the current usage, or smaller than 0, meaning that
+// the resource is unlimited for the team. Only limits differing from the
+// current ones are stored, the others keep following the config defaults.
+func ChangeTeamQuota(q *TeamQuota) error {
+	current, err := GetTeamQuota(q.Team)
+	if err != nil {
+		return err
+	}
+	update := bson.M{}
+	for _, item := range []struct {
+		resource string
+		current  *quota.Quota
+		newLimit int
+	}{
+		{"apps", &current.Apps, q.Apps.Limit},
+		{"units", &current.Units, q.Units.Limit},
+		{"memory", &current.Memory, q.Memory.Limit},
+	} {
+		if item.newLimit < 0 {
+			item.newLimit = -1
+		} else if item.newLimit < item.current.InUse {
+			return &tsuruErrors.ValidationError{
+				Message: fmt.Sprintf("new %s limit is lesser than the current allocated value", item.resource),
+			}
+		}
+		if item.newLimit != item.current.Limit {
+			update[item.resource] = item.newLimit
+			item.current.Limit = item.newLimit
+		}
+	}
+	if len(update) > 0 {
+		conn, err := db.Conn()
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+		err = conn.TeamQuotas().UpdateId(q.Team, bson.M{"$set": update})
+		if err != nil {
+			return err
+		}
+	}
+	*q = *current
+	return nil
+}
+
+// RenameTeamQuota moves the limits and usage of a team being renamed.
+func RenameTeamQuota(oldName, newName string) error {
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	var doc bson.M
+	err = conn.TeamQuotas().FindId(oldName).One(&doc)
+	if err == mgo.ErrNotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	doc["_id"] = newName
+	_, err = conn.TeamQuotas().UpsertId(newName, doc)
+	if err != nil {
+		return err
+	}
+	return conn.TeamQuotas().RemoveId(oldName)
+}
+
+// reserveTeamQuota atomically reserves the given amount of apps, units and
+// memory in the team, returning a TeamQuotaExceededError when the team can't
+// accommodate them. Negative amounts are released without any check.
+func reserveTeamQuota(team string, requested teamQuotaUsage) error {
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	for {
+		doc, err := loadTeamQuota(conn, team)
+		if err != nil {
+			return err
+		}
+		limits := doc.limits()
+		query := bson.M{"_id": team}
+		for _, item := range []struct {
+			resource  string
+			limit     int
+			inUse     int
+			requested int
+		}{
+			{"apps", limits.Apps, doc.InUse.Apps, requested.Apps},
+			{"units", limits.Units, doc.InUse.Units, requested.Units},
+			{"memory", limits.Memory, doc.InUse.Memory, requested.Memory},
+		} {
+			if item.requested <= 0 || item.limit < 0 {
+				continue
+			}
+			if item.inUse+item.requested > item.limit {
+				available := item.limit - item.inUse
+				if available < 0 {
+					available = 0
+				}
+				return &TeamQuotaExceededError{
+					QuotaExceededError: quota.QuotaExceededError{
+						Available: uint(available),
+						Requested: uint(item.requested),
+					},
+					Team:     team,
+					Resource: item.resource,
+				}
+			}
+			query["inuse."+item.resource] = bson.M{"$lte": item.limit - item.requested}
+		}
+		err = conn.TeamQuotas().Update(query, bson.M{"$inc": requested.inc(1)})
+		if err != mgo.ErrNotFound {
+			return err
+		}
+	}
+}
+
+// releaseTeamQuota releases the given amount of apps, units and memory from
+// the team. Teams whose usage isn't tracked yet are left untouched, their
+// usage is calculated from the remaining apps when needed.
+func releaseTeamQuota(team string, released teamQuotaUsage) error {
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	err = conn.TeamQuotas().Update(
+		bson.M{"_id": team, "inuse": bson.M{"$exists": true}},
+		bson.M{"$inc": released.inc(-1)},
+	)
+	if err == mgo.ErrNotFound {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,265 @@
+// Copyright 2018 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package app
+
+import (
+	"bytes"
+	"sync"
+
+	"github.com/globalsign/mgo/bson"
+	"github.com/tsuru/config"
+	"github.com/tsuru/tsuru/event"
+	"github.com/tsuru/tsuru/permission"
+	"github.com/tsuru/tsuru/provision/pool"
+	"github.com/tsuru/tsuru/quota"
+	appTypes "github.com/tsuru/tsuru/types/app"
+	"gopkg.in/check.v1"
+)
+
+func (s *S) TestGetTeamQuotaDefault(c *check.C) {
+	q, err := GetTeamQuota(s.team.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(q, check.DeepEquals, &TeamQuota{
+		Team:   s.team.Name,
+		Apps:   quota.Unlimited,
+		Units:  quota.Unlimited,
+		Memory: quota.Unlimited,
+	})
+	config.Set("quota:apps-per-team", 3)
+	defer config.Unset("quota:apps-per-team")
+	q, err = GetTeamQuota(s.team.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(q.Apps, check.DeepEquals, quota.Quota{Limit: 3, InUse: 0})
+}
+
+func (s *S) TestGetTeamQuotaUsage(c *check.C) {
+	a1 := App{Name: "app1", Platform: "python", TeamOwner: s.team.Name}
+	err := CreateApp(&a1, s.user)
+	c.Assert(err, check.IsNil)
+	a2 := App{Name: "app2", Platform: "python", TeamOwner: s.team.Name}
+	err = CreateApp(&a2, s.user)
+	c.Assert(err, check.IsNil)
+	err = a1.AddUnits(2, "web", nil)
+	c.Assert(err, check.IsNil)
+	err = a2.AddUnits(1, "web", nil)
+	c.Assert(err, check.IsNil)
+	q, err := GetTeamQuota(s.team.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(q.Apps.InUse, check.Equals, 2)
+	c.Assert(q.Units.InUse, check.Equals, 3)
+	c.Assert(q.Memory.InUse, check.Equals, 3*1024)
+}
+
+func (s *S) TestChangeTeamQuota(c *check.C) {
+	a := App{Name: "app1", Platform: "python", TeamOwner: s.team.Name}
+	err := CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	err = ChangeTeamQuota(&TeamQuota{
+		Team:   s.team.Name,
+		Apps:   quota.Quota{Limit: 5},
+		Units:  quota.Quota{Limit: -10},
+		Memory: quota.Quota{Limit: 4096},
+	})
+	c.Assert(err, check.IsNil)
+	q, err := GetTeamQuota(s.team.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(q, check.DeepEquals, &TeamQuota{
+		Team:   s.team.Name,
+		Apps:   quota.Quota{Limit: 5, InUse: 1},
+		Units:  quota.Unlimited,
+		Memory: quota.Quota{Limit: 4096},
+	})
+	err = ChangeTeamQuota(&TeamQuota{Team: s.team.Name, Units: quota.Quota{Limit: -1}, Memory: quota.Quota{Limit: -1}})
+	c.Assert(err, check.ErrorMatches, "new apps limit is lesser than the current allocated value")
+}
+
+func (s *S) TestChangeTeamQuotaKeepsDefaults(c *check.C) {
+	config.Set("quota:units-per-team", 10)
+	defer config.Unset("quota:units-per-team")
+	q, err := GetTeamQuota(s.team.Name)
+	c.Assert(err, check.IsNil)
+	q.Apps.Limit = 5
+	err = ChangeTeamQuota(q)
+	c.Assert(err, check.IsNil)
+	var doc bson.M
+	err = s.conn.TeamQuotas().FindId(s.team.Name).One(&doc)
+	c.Assert(err, check.IsNil)
+	c.Assert(doc["apps"], check.Equals, 5)
+	_, ok := doc["units"]
+	c.Assert(ok, check.Equals, false)
+	_, ok = doc["memory"]
+	c.Assert(ok, check.Equals, false)
+	config.Set("quota:units-per-team", 20)
+	q, err = GetTeamQuota(s.team.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(q.Units.Limit, check.Equals, 20)
+}
+
+func (s *S) TestReserveTeamQuotaConcurrent(c *check.C) {
+	err := ChangeTeamQuota(&TeamQuota{Team: s.team.Name, Apps: quota.Quota{Limit: 5}, Units: quota.Unlimited, Memory: quota.Unlimited})
+	c.Assert(err, check.IsNil)
+	var wg sync.WaitGroup
+	errs := make(chan error, 20)
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- reserveTeamQuota(s.team.Name, teamQuotaUsage{Apps: 1})
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	var reserved int
+	for err := range errs {
+		if err == nil {
+			reserved++
+			continue
+		}
+		c.Assert(err, check.FitsTypeOf, &TeamQuotaExceededError{})
+	}
+	c.Assert(reserved, check.Equals, 5)
+	q, err := GetTeamQuota(s.team.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(q.Apps.InUse, check.Equals, 5)
+}
+
+func (s *S) TestDeleteReleasesTeamQuota(c *check.C) {
+	a := App{Name: "app1", Platform: "python", TeamOwner: s.team.Name}
+	err := CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	err = a.AddUnits(2, "web", nil)
+	c.Assert(err, check.IsNil)
+	q, err := GetTeamQuota(s.team.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(q.Apps.InUse, check.Equals, 1)
+	c.Assert(q.Units.InUse, check.Equals, 2)
+	evt, err := event.New(&event.Opts{
+		Target:   event.Target{Type: "app", Value: a.Name},
+		Kind:     permission.PermAppDelete,
+		RawOwner: event.Owner{Type: event.OwnerTypeUser, Name: s.user.Email},
+		Allowed:  event.Allowed(permission.PermApp),
+	})
+	c.Assert(err, check.IsNil)
+	err = Delete(&a, evt, "")
+	c.Assert(err, check.IsNil)
+	q, err = GetTeamQuota(s.team.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(q.Apps.InUse, check.Equals, 0)
+	c.Assert(q.Units.InUse, check.Equals, 0)
+	c.Assert(q.Memory.InUse, check.Equals, 0)
+	p, err := pool.GetPoolByName(a.Pool)
+	c.Assert(err, check.IsNil)
+	usage, err := p.CapacityUsage()
+	c.Assert(err, check.IsNil)
+	c.Assert(usage.UsedMemory, check.Equals, int64(0))
+	c.Assert(usage.UsedCPU, check.Equals, int64(0))
+}
+
+func (s *S) TestDeleteUnitsReleasedByProvisioner(c *check.C) {
+	a := App{Name: "app1", Platform: "python", TeamOwner: s.team.Name}
+	err := CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	err = a.AddUnits(2, "web", nil)
+	c.Assert(err, check.IsNil)
+	p, err := pool.GetPoolByName(a.Pool)
+	c.Assert(err, check.IsNil)
+	usage, err := p.CapacityUsage()
+	c.Assert(err, check.IsNil)
+	c.Assert(usage.UsedMemory, check.Equals, 2*a.Plan.Memory)
+	err = a.SetQuotaInUse(0)
+	c.Assert(err, check.IsNil)
+	evt, err := event.New(&event.Opts{
+		Target:   event.Target{Type: "app", Value: a.Name},
+		Kind:     permission.PermAppDelete,
+		RawOwner: event.Owner{Type: event.OwnerTypeUser, Name: s.user.Email},
+		Allowed:  event.Allowed(permission.PermApp),
+	})
+	c.Assert(err, check.IsNil)
+	err = Delete(&a, evt, "")
+	c.Assert(err, check.IsNil)
+	q, err := GetTeamQuota(s.team.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(q.Apps.InUse, check.Equals, 0)
+	c.Assert(q.Units.InUse, check.Equals, 0)
+	c.Assert(q.Memory.InUse, check.Equals, 0)
+	p, err = pool.GetPoolByName(a.Pool)
+	c.Assert(err, check.IsNil)
+	usage, err = p.CapacityUsage()
+	c.Assert(err, check.IsNil)
+	c.Assert(usage.UsedMemory, check.Equals, int64(0))
+	c.Assert(usage.UsedCPU, check.Equals, int64(0))
+}
+
+func (s *S) TestRenameTeamQuota(c *check.C) {
+	err := ChangeTeamQuota(&TeamQuota{Team: s.team.Name, Apps: quota.Quota{Limit: 5}, Units: quota.Unlimited, Memory: quota.Unlimited})
+	c.Assert(err, check.IsNil)
+	err = RenameTeamQuota(s.team.Name, "newteam")
+	c.Assert(err, check.IsNil)
+	q, err := GetTeamQuota("newteam")
+	c.Assert(err, check.IsNil)
+	c.Assert(q.Apps.Limit, check.Equals, 5)
+	q, err = GetTeamQuota(s.team.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(q.Apps.Limit, check.Equals, -1)
+}
+
+func (s *S) TestCreateAppTeamQuotaExceeded(c *check.C) {
+	err := ChangeTeamQuota(&TeamQuota{Team: s.team.Name, Apps: quota.Quota{Limit: 1}, Units: quota.Unlimited, Memory: quota.Unlimited})
+	c.Assert(err, check.IsNil)
+	a1 := App{Name: "app1", Platform: "python", TeamOwner: s.team.Name}
+	err = CreateApp(&a1, s.user)
+	c.Assert(err, check.IsNil)
+	a2 := App{Name: "app2", Platform: "python", TeamOwner: s.team.Name}
+	err = CreateApp(&a2, s.user)
+	c.Assert(err, check.NotNil)
+	e, ok := err.(*AppCreationError)
+	c.Assert(ok, check.Equals, true)
+	qErr, ok := e.Err.(*TeamQuotaExceededError)
+	c.Assert(ok, check.Equals, true)
+	c.Assert(qErr.Resource, check.Equals, "apps")
+	c.Assert(qErr.Available, check.Equals, uint(0))
+	c.Assert(qErr.Requested, check.Equals, uint(1))
+	_, err = GetByName(a2.Name)
+	c.Assert(err, check.Equals, ErrAppNotFound)
+}
+
+func (s *S) TestAddUnitsTeamQuotaExceeded(c *check.C) {
+	a := App{Name: "app1", Platform: "python", TeamOwner: s.team.Name}
+	err := CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	err = ChangeTeamQuota(&TeamQuota{Team: s.team.Name, Apps: quota.Unlimited, Units: quota.Quota{Limit: 3}, Memory: quota.Unlimited})
+	c.Assert(err, check.IsNil)
+	err = a.AddUnits(2, "web", nil)
+	c.Assert(err, check.IsNil)
+	err = a.AddUnits(2, "web", nil)
+	c.Assert(err, check.ErrorMatches, `Team "tsuruteam" quota exceeded for units. Available: 1. Requested: 2.`)
+	c.Assert(s.provisioner.GetUnits(&a), check.HasLen, 2)
+	err = ChangeTeamQuota(&TeamQuota{Team: s.team.Name, Apps: quota.Unlimited, Units: quota.Unlimited, Memory: quota.Quota{Limit: 3072}})
+	c.Assert(err, check.IsNil)
+	err = a.AddUnits(2, "web", nil)
+	c.Assert(err, check.ErrorMatches, `Team "tsuruteam" quota exceeded for memory. Available: 1024. Requested: 2048.`)
+	err = a.AddUnits(1, "web", nil)
+	c.Assert(err, check.IsNil)
+}
+
+func (s *S) TestUpdatePlanTeamQuotaExceeded(c *check.C) {
+	plan := appTypes.Plan{Name: "big", CpuShare: 100, Memory: 4096}
+	s.mockService.Plan.OnFindByName = func(name string) (*appTypes.Plan, error) {
+		c.Assert(name, check.Equals, plan.Name)
+		return &plan, nil
+	}
+	a := App{Name: "app1", Platform: "python", TeamOwner: s.team.Name}
+	err := CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	err = a.AddUnits(2, "web", nil)
+	c.Assert(err, check.IsNil)
+	err = ChangeTeamQuota(&TeamQuota{Team: s.team.Name, Apps: quota.Unlimited, Units: quota.Unlimited, Memory: quota.Quota{Limit: 4096}})
+	c.Assert(err, check.IsNil)
+	err = a.Update(App{Plan: appTypes.Plan{Name: "big"}}, new(bytes.Buffer))
+	c.Assert(err, check.ErrorMatches, `Team "tsuruteam" quota exceeded for memory. Available: 2048. Requested: 6144.`)
+	dbApp, err := GetByName(a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(dbApp.Plan.Name, check.Equals, s.defaultPlan.Name)
+}
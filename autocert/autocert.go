@@ -0,0 +1,608 @@
+// Copyright 2018 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package autocert obtains and renews certificates for the cnames of apps
+// using the ACME protocol, as defined in RFC 8555. The http-01 challenges are
+// answered by the tsuru API, routers of the app supporting paths route
+// /.well-known/acme-challenge/ to it while the challenge is pending, other
+// routers must forward requests to this path on any host to the tsuru API.
+package autocert
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/globalsign/mgo"
+	"github.com/globalsign/mgo/bson"
+	"github.com/pkg/errors"
+	"github.com/tsuru/config"
+	"github.com/tsuru/tsuru/api/shutdown"
+	"github.com/tsuru/tsuru/app"
+	"github.com/tsuru/tsuru/db"
+	"github.com/tsuru/tsuru/event"
+	"github.com/tsuru/tsuru/log"
+	"github.com/tsuru/tsuru/permission"
+	"github.com/tsuru/tsuru/router"
+	"golang.org/x/crypto/acme"
+)
+
+const (
+	EventKind = "acme-certificate"
+
+	defaultRenewBefore = 30 * 24 * time.Hour
+	defaultRunInterval = time.Hour
+	obtainTimeout      = 5 * time.Minute
+
+	challengePath = "/.well-known/acme-challenge/"
+)
+
+var (
+	ErrChallengeNotFound = errors.New("challenge not found")
+
+	managerMu sync.Mutex
+	manager   *Manager
+)
+
+// Certificate holds the state of the certificate obtained for a cname.
+type Certificate struct {
+	CName     string `bson:"_id"`
+	App       string
+	ExpiresAt time.Time
+	Error     string
+	UpdatedAt time.Time
+}
+
+// Manager periodically looks for app cnames without a certificate, or with
+// a certificate about to expire, and requests new ones from the ACME server
+// configured in acme:directory-url.
+type Manager struct {
+	directoryURL string
+	email        string
+	challengeURL *url.URL
+	renewBefore  time.Duration
+	interval     time.Duration
+	trigger      chan struct{}
+	done         chan bool
+	running      bool
+	clientMu     sync.Mutex
+	client       *acme.Client
+}
+
+// Enabled returns whether an ACME server is configured.
+func Enabled() bool {
+	directoryURL, _ := config.GetString("acme:directory-url")
+	return directoryURL != ""
+}
+
+func newManager() (*Manager, error) {
+	directoryURL, err := config.GetString("acme:directory-url")
+	if err != nil {
+		return nil, err
+	}
+	email, _ := config.GetString("acme:email")
+	challengeURL, _ := config.GetString("acme:challenge-url")
+	if challengeURL == "" {
+		challengeURL, _ = config.GetString("host")
+	}
+	var parsedChallengeURL *url.URL
+	if challengeURL != "" {
+		parsedChallengeURL, err = url.Parse(challengeURL)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid acme challenge url %q", challengeURL)
+		}
+	}
+	renewBefore := defaultRenewBefore
+	if seconds, _ := config.GetInt("acme:renew-before"); seconds > 0 {
+		renewBefore = time.Duration(seconds) * time.Second
+	}
+	interval := defaultRunInterval
+	if seconds, _ := config.GetInt("acme:run-interval"); seconds > 0 {
+		interval = time.Duration(seconds) * time.Second
+	}
+	return &Manager{
+		directoryURL: directoryURL,
+		email:        email,
+		challengeURL: parsedChallengeURL,
+		renewBefore:  renewBefore,
+		interval:     interval,
+		trigger:      make(chan struct{}, 1),
+		done:         make(chan bool),
+	}, nil
+}
+
+// Initialize starts the manager when an ACME server is configured.
+func Initialize() error {
+	if !Enabled() {
+		return nil
+	}
+	m, err := newManager()
+	if err != nil {
+		return err
+	}
+	shutdown.Register(m)
+	m.running = true
+	managerMu.Lock()
+	manager = m
+	managerMu.Unlock()
+	go m.run()
+	return nil
+}
+
+// Trigger wakes the manager up, so new cnames get their certificates without
+// waiting for the next run.
+func Trigger() {
+	managerMu.Lock()
+	m := manager
+	managerMu.Unlock()
+	if m == nil {
+		return
+	}
+	select {
+	case m.trigger <- struct{}{}:
+	default:
+	}
+}
+
+func (m *Manager) run() {
+	for {
+		err := m.runOnce(time.Now())
+		if err != nil {
+			logError(err.Error())
+		}
+		select {
+		case <-m.done:
+			return
+		case <-m.trigger:
+		case <-time.After(m.interval):
+		}
+	}
+}
+
+func (m *Manager) Shutdown(ctx context.Context) error {
+	if !m.running {
+		return nil
+	}
+	m.running = false
+	managerMu.Lock()
+	manager = nil
+	managerMu.Unlock()
+	select {
+	case m.done <- true:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (m *Manager) String() string {
+	return "acme certificates manager"
+}
+
+// runOnce requests certificates for every cname that needs one.
+func (m *Manager) runOnce(now time.Time) (retErr error) {
+	defer func() {
+		if rec := recover(); rec != nil {
+			retErr = errors.Errorf("recovered panic, we can never stop! panic: %v", rec)
+		}
+	}()
+	apps, err := app.List(nil)
+	if err != nil {
+		return errors.Wrap(err, "error listing apps")
+	}
+	certs, err := listCertificates()
+	if err != nil {
+		return errors.Wrap(err, "error listing certificates")
+	}
+	inUse := map[string]struct{}{}
+	for i := range apps {
+		a := &apps[i]
+		for _, cname := range a.CName {
+			inUse[cname] = struct{}{}
+			if m.needsCertificate(certs[cname], a.Name, now) {
+				m.obtainCertificate(a, cname)
+			}
+		}
+	}
+	for cname := range certs {
+		if _, ok := inUse[cname]; !ok {
+			err = removeCertificate(cname)
+			if err != nil {
+				logError("unable to remove certificate for %q: %s", cname, err)
+			}
+		}
+	}
+	return nil
+}
+
+func (m *Manager) needsCertificate(cert *Certificate, appName string, now time.Time) bool {
+	if cert == nil || cert.App != appName {
+		return true
+	}
+	if cert.Error != "" {
+		return now.Sub(cert.UpdatedAt) >= m.interval
+	}
+	return cert.ExpiresAt.Sub(now) < m.renewBefore
+}
+
+func (m *Manager) obtainCertificate(a *app.App, cname string) {
+	evt, err := event.NewInternal(&event.Opts{
+		Target: event.Target{Type: event.TargetTypeCertificate, Value: cname},
+		ExtraTargets: []event.ExtraTarget{
+			{Target: event.Target{Type: event.TargetTypeApp, Value: a.Name}},
+		},
+		InternalKind: EventKind,
+		Allowed: event.Allowed(permission.PermAppReadEvents, append(permission.Contexts(permission.CtxTeam, a.Teams),
+			permission.Context(permission.CtxApp, a.Name),
+			permission.Context(permission.CtxPool, a.Pool),
+		)...),
+	})
+	if err != nil {
+		if _, ok := err.(event.ErrEventLocked); ok {
+			logDebug("skipping certificate for %q, already being requested", cname)
+		} else {
+			logError("error creating event for certificate of %q: %s", cname, err)
+		}
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), obtainTimeout)
+	defer cancel()
+	cert := Certificate{CName: cname, App: a.Name, UpdatedAt: time.Now().UTC()}
+	cert.ExpiresAt, err = m.obtain(ctx, evt, a, cname)
+	if err != nil {
+		cert.Error = err.Error()
+	}
+	if saveErr := saveCertificate(&cert); saveErr != nil {
+		logError("unable to save certificate state for %q: %s", cname, saveErr)
+	}
+	evt.Done(err)
+}
+
+// obtain requests a certificate for cname and adds it to the routers of the
+// app, returning the expiration date of the new certificate.
+func (m *Manager) obtain(ctx context.Context, w io.Writer, a *app.App, cname string) (time.Time, error) {
+	client, err := m.acmeClient(ctx)
+	if err != nil {
+		return time.Time{}, err
+	}
+	fmt.Fprintf(w, "requesting certificate for %q\n", cname)
+	order, err := client.AuthorizeOrder(ctx, acme.DomainIDs(cname))
+	if err != nil {
+		return time.Time{}, errors.Wrapf(err, "unable to create order for %q", cname)
+	}
+	for _, authzURL := range order.AuthzURLs {
+		err = m.authorize(ctx, w, client, a, authzURL)
+		if err != nil {
+			return time.Time{}, errors.Wrapf(err, "unable to authorize %q", cname)
+		}
+	}
+	// The location of the order is only returned when it's created.
+	orderURL := order.URI
+	order, err = client.WaitOrder(ctx, orderURL)
+	if err != nil {
+		return time.Time{}, errors.Wrapf(err, "unable to authorize %q", cname)
+	}
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return time.Time{}, err
+	}
+	csr, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject:  pkix.Name{CommonName: cname},
+		DNSNames: []string{cname},
+	}, key)
+	if err != nil {
+		return time.Time{}, err
+	}
+	der, err := createOrderCert(ctx, client, orderURL, order.FinalizeURL, csr)
+	if err != nil {
+		return time.Time{}, errors.Wrapf(err, "unable to create certificate for %q", cname)
+	}
+	leaf, err := x509.ParseCertificate(der[0])
+	if err != nil {
+		return time.Time{}, err
+	}
+	var certPEM []byte
+	for _, b := range der {
+		certPEM = append(certPEM, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: b})...)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return time.Time{}, err
+	}
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	err = a.SetCertificate(cname, string(certPEM), string(keyPEM))
+	if err != nil {
+		return time.Time{}, errors.Wrapf(err, "unable to set certificate for %q", cname)
+	}
+	fmt.Fprintf(w, "certificate for %q added, expires at %s\n", cname, leaf.NotAfter.Format(time.RFC3339))
+	return leaf.NotAfter, nil
+}
+
+// createOrderCert finalizes the order and returns the certificate chain.
+// Servers finalizing orders asynchronously, like pebble, answer without the
+// location of the order, failing the wait in CreateOrderCert, so the order is
+// polled again using its known location.
+func createOrderCert(ctx context.Context, client *acme.Client, orderURL, finalizeURL string, csr []byte) ([][]byte, error) {
+	der, _, err := client.CreateOrderCert(ctx, finalizeURL, csr, true)
+	if err == nil {
+		return der, nil
+	}
+	finalized, waitErr := client.WaitOrder(ctx, orderURL)
+	if waitErr != nil || finalized.Status != acme.StatusValid || finalized.CertURL == "" {
+		return nil, err
+	}
+	return client.FetchCert(ctx, finalized.CertURL, true)
+}
+
+// authorize proves the control over the domain of a pending authorization to
+// the ACME server, answering its http-01 challenge.
+func (m *Manager) authorize(ctx context.Context, w io.Writer, client *acme.Client, a *app.App, authzURL string) error {
+	authz, err := client.GetAuthorization(ctx, authzURL)
+	if err != nil {
+		return err
+	}
+	switch authz.Status {
+	case acme.StatusValid:
+		return nil
+	case acme.StatusPending:
+	default:
+		return errors.Errorf("authorization %q is %s", authz.URI, authz.Status)
+	}
+	var chal *acme.Challenge
+	for _, c := range authz.Challenges {
+		if c.Type == "http-01" {
+			chal = c
+			break
+		}
+	}
+	if chal == nil {
+		return errors.New("no http-01 challenge offered")
+	}
+	response, err := client.HTTP01ChallengeResponse(chal.Token)
+	if err != nil {
+		return err
+	}
+	err = saveChallenge(chal.Token, response)
+	if err != nil {
+		return err
+	}
+	defer removeChallenge(chal.Token)
+	removeRoutes, err := m.addChallengeRoutes(w, a)
+	if err != nil {
+		return err
+	}
+	defer removeRoutes()
+	_, err = client.Accept(ctx, chal)
+	if err != nil {
+		return err
+	}
+	_, err = client.WaitAuthorization(ctx, authz.URI)
+	return err
+}
+
+// addChallengeRoutes routes the challenge path to the tsuru API in the
+// routers of the app supporting paths, returning a function removing the
+// routes.
+func (m *Manager) addChallengeRoutes(w io.Writer, a *app.App) (func(), error) {
+	var added []router.PathRouter
+	remove := func() {
+		for _, r := range added {
+			err := removeChallengeRoute(r, a.Name, m.challengeURL)
+			if err != nil {
+				logError("unable to remove challenge route from %q: %s", a.Name, err)
+			}
+		}
+	}
+	for _, appRouter := range a.GetRouters() {
+		r, err := router.Get(appRouter.Name)
+		if err != nil {
+			remove()
+			return nil, err
+		}
+		pathRouter, ok := r.(router.PathRouter)
+		if !ok || m.challengeURL == nil {
+			fmt.Fprintf(w, "router %q must forward %s to the tsuru API\n", appRouter.Name, challengePath)
+			continue
+		}
+		err = pathRouter.AddPathRoutes(a.Name, challengePath, []*url.URL{m.challengeURL})
+		if err != nil {
+			remove()
+			return nil, errors.Wrapf(err, "unable to route %s in router %q", challengePath, appRouter.Name)
+		}
+		added = append(added, pathRouter)
+	}
+	return remove, nil
+}
+
+func removeChallengeRoute(r router.PathRouter, appName string, challengeURL *url.URL) error {
+	err := r.RemovePathRoutes(appName, challengePath, []*url.URL{challengeURL})
+	if err != nil {
+		return err
+	}
+	paths, err := r.PathRoutes(appName)
+	if err != nil {
+		return err
+	}
+	if len(paths[challengePath]) == 0 {
+		return r.RemovePath(appName, challengePath)
+	}
+	return nil
+}
+
+// acmeClient returns a client registered in the ACME server, using the
+// account key stored in the database, which is created on first use.
+func (m *Manager) acmeClient(ctx context.Context) (*acme.Client, error) {
+	m.clientMu.Lock()
+	defer m.clientMu.Unlock()
+	if m.client != nil {
+		return m.client, nil
+	}
+	key, err := accountKey(m.directoryURL)
+	if err != nil {
+		return nil, err
+	}
+	client := &acme.Client{Key: key, DirectoryURL: m.directoryURL}
+	var contact []string
+	if m.email != "" {
+		contact = []string{"mailto:" + m.email}
+	}
+	_, err = client.Register(ctx, &acme.Account{Contact: contact}, acme.AcceptTOS)
+	if err == acme.ErrAccountAlreadyExists {
+		err = nil
+	}
+	if ae, ok := err.(*acme.Error); ok && ae.StatusCode == http.StatusConflict {
+		err = nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to register acme account")
+	}
+	m.client = client
+	return client, nil
+}
+
+type account struct {
+	DirectoryURL string `bson:"_id"`
+	Key          []byte
+}
+
+func accountKey(directoryURL string) (*ecdsa.PrivateKey, error) {
+	conn, err := db.Conn()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	var acc account
+	err = conn.ACMEAccounts().FindId(directoryURL).One(&acc)
+	if err == mgo.ErrNotFound {
+		key, genErr := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if genErr != nil {
+			return nil, genErr
+		}
+		acc.DirectoryURL = directoryURL
+		acc.Key, err = x509.MarshalECPrivateKey(key)
+		if err != nil {
+			return nil, err
+		}
+		err = conn.ACMEAccounts().Insert(acc)
+		if err == nil {
+			return key, nil
+		}
+		if mgo.IsDup(err) {
+			err = conn.ACMEAccounts().FindId(directoryURL).One(&acc)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return x509.ParseECPrivateKey(acc.Key)
+}
+
+type challenge struct {
+	Token     string `bson:"_id"`
+	Response  string
+	CreatedAt time.Time
+}
+
+func saveChallenge(token, response string) error {
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	return conn.ACMEChallenges().Insert(challenge{Token: token, Response: response, CreatedAt: time.Now().UTC()})
+}
+
+func removeChallenge(token string) error {
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	return conn.ACMEChallenges().RemoveId(token)
+}
+
+// ChallengeResponse returns the response to the http-01 challenge identified
+// by token.
+func ChallengeResponse(token string) (string, error) {
+	conn, err := db.Conn()
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+	var chal challenge
+	err = conn.ACMEChallenges().FindId(token).One(&chal)
+	if err != nil {
+		if err == mgo.ErrNotFound {
+			return "", ErrChallengeNotFound
+		}
+		return "", err
+	}
+	return chal.Response, nil
+}
+
+func listCertificates() (map[string]*Certificate, error) {
+	conn, err := db.Conn()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	var certs []Certificate
+	err = conn.ACMECertificates().Find(nil).All(&certs)
+	if err != nil {
+		return nil, err
+	}
+	result := make(map[string]*Certificate, len(certs))
+	for i := range certs {
+		result[certs[i].CName] = &certs[i]
+	}
+	return result, nil
+}
+
+func saveCertificate(cert *Certificate) error {
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if cert.Error != "" {
+		// Keeps the expiration date of the current certificate, if any.
+		_, err = conn.ACMECertificates().UpsertId(cert.CName, bson.M{"$set": bson.M{
+			"app":       cert.App,
+			"error":     cert.Error,
+			"updatedat": cert.UpdatedAt,
+		}})
+		return err
+	}
+	_, err = conn.ACMECertificates().UpsertId(cert.CName, cert)
+	return err
+}
+
+func removeCertificate(cname string) error {
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	return conn.ACMECertificates().RemoveId(cname)
+}
+
+func logError(msg string, params ...interface{}) {
+	msg = fmt.Sprintf("[acme] %s", msg)
+	log.Errorf(msg, params...)
+}
+
+func logDebug(msg string, params ...interface{}) {
+	msg = fmt.Sprintf("[acme] %s", msg)
+	log.Debugf(msg, params...)
+}
@@ -0,0 +1,273 @@
+// Copyright 2018 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package autoscale
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/tsuru/config"
+	"github.com/tsuru/tsuru/api/shutdown"
+	"github.com/tsuru/tsuru/app"
+	"github.com/tsuru/tsuru/event"
+	"github.com/tsuru/tsuru/log"
+	"github.com/tsuru/tsuru/permission"
+	"github.com/tsuru/tsuru/provision"
+	"github.com/tsuru/tsuru/provision/pool"
+)
+
+const UnitEventKind = "autoscale-units"
+
+// UnitConfig scales the units of app processes according to their autoscale
+// specs. Apps running on provisioners implementing
+// provision.AutoScaleProvisioner are skipped, as their units are already
+// scaled by the provisioner itself.
+type UnitConfig struct {
+	RunInterval   time.Duration
+	MetricsMaxAge time.Duration
+	done          chan bool
+	writer        io.Writer
+	running       bool
+}
+
+type UnitScaleResult struct {
+	Process string
+	From    uint
+	To      uint
+	Reason  string
+}
+
+// InitializeUnits starts scaling units periodically when enabled by the
+// autoscale:units:enabled config.
+func InitializeUnits() error {
+	if enabled, _ := config.GetBool("autoscale:units:enabled"); !enabled {
+		return nil
+	}
+	conf := newUnitConfig()
+	shutdown.Register(conf)
+	conf.running = true
+	go conf.run()
+	return nil
+}
+
+func RunUnitsOnce(w io.Writer) error {
+	conf := newUnitConfig()
+	conf.writer = w
+	err := conf.runScaler()
+	if err != nil {
+		conf.logError(err.Error())
+	}
+	return err
+}
+
+func newUnitConfig() *UnitConfig {
+	runInterval, _ := config.GetInt("autoscale:units:run-interval")
+	metricsMaxAge, _ := config.GetInt("autoscale:units:metrics-max-age")
+	c := &UnitConfig{
+		RunInterval:   time.Duration(runInterval) * time.Second,
+		MetricsMaxAge: time.Duration(metricsMaxAge) * time.Second,
+		done:          make(chan bool),
+	}
+	if c.RunInterval == 0 {
+		c.RunInterval = time.Minute
+	}
+	if c.MetricsMaxAge == 0 {
+		c.MetricsMaxAge = 2 * time.Minute
+	}
+	return c
+}
+
+func (a *UnitConfig) run() error {
+	for {
+		err := a.runScaler()
+		if err != nil {
+			a.logError(err.Error())
+			err = errors.Wrap(err, "[unit autoscale]")
+		}
+		select {
+		case <-a.done:
+			return err
+		case <-time.After(a.RunInterval):
+		}
+	}
+}
+
+func (a *UnitConfig) logError(msg string, params ...interface{}) {
+	msg = fmt.Sprintf("[unit autoscale] %s", msg)
+	log.Errorf(msg, params...)
+}
+
+func (a *UnitConfig) logDebug(msg string, params ...interface{}) {
+	msg = fmt.Sprintf("[unit autoscale] %s", msg)
+	log.Debugf(msg, params...)
+}
+
+func (a *UnitConfig) Shutdown(ctx context.Context) error {
+	if !a.running {
+		return nil
+	}
+	a.done <- true
+	a.running = false
+	return nil
+}
+
+func (a *UnitConfig) String() string {
+	return "unit auto scale"
+}
+
+func (a *UnitConfig) runScaler() (retErr error) {
+	defer func() {
+		if r := recover(); r != nil {
+			retErr = errors.Errorf("recovered panic, we can never stop! panic: %v", r)
+		}
+	}()
+	apps, err := app.List(&app.Filter{AutoScale: true})
+	if err != nil {
+		return errors.Wrap(err, "error listing apps")
+	}
+	for i := range apps {
+		a.scaleApp(&apps[i])
+	}
+	return nil
+}
+
+func (a *UnitConfig) scaleApp(scaleApp *app.App) {
+	prov, err := pool.GetProvisionerForPool(scaleApp.Pool)
+	if err != nil {
+		a.logError("unable to get provisioner for app %q: %s", scaleApp.Name, err)
+		return
+	}
+	if _, ok := prov.(provision.AutoScaleProvisioner); ok {
+		return
+	}
+	results, err := a.unitsToScale(scaleApp)
+	if err != nil {
+		a.logError("unable to calculate units for app %q: %s", scaleApp.Name, err)
+		return
+	}
+	if len(results) == 0 {
+		return
+	}
+	evt, err := event.NewInternal(&event.Opts{
+		Target:       event.Target{Type: event.TargetTypeApp, Value: scaleApp.Name},
+		InternalKind: UnitEventKind,
+		Allowed: event.Allowed(permission.PermAppReadEvents, append(permission.Contexts(permission.CtxTeam, scaleApp.Teams),
+			permission.Context(permission.CtxApp, scaleApp.Name),
+			permission.Context(permission.CtxPool, scaleApp.Pool),
+		)...),
+	})
+	if err != nil {
+		if _, ok := err.(event.ErrEventLocked); ok {
+			a.logDebug("skipping already running for: %s", scaleApp.Name)
+		} else {
+			a.logError("error creating scale event %s: %s", scaleApp.Name, err.Error())
+		}
+		return
+	}
+	evt.SetLogWriter(a.writer)
+	var retErr error
+	defer func() {
+		if retErr != nil {
+			evt.Logf(retErr.Error())
+		}
+		evt.DoneCustomData(retErr, results)
+	}()
+	for _, result := range results {
+		evt.Logf("scaling process %q from %d to %d units: %s", result.Process, result.From, result.To, result.Reason)
+		if result.To > result.From {
+			err = scaleApp.AddUnits(result.To-result.From, result.Process, evt)
+		} else {
+			err = scaleApp.RemoveUnits(result.From-result.To, result.Process, evt)
+		}
+		if err != nil {
+			retErr = errors.Wrapf(err, "error scaling process %q", result.Process)
+			return
+		}
+	}
+}
+
+func (a *UnitConfig) unitsToScale(scaleApp *app.App) ([]UnitScaleResult, error) {
+	units, err := scaleApp.Units()
+	if err != nil {
+		return nil, err
+	}
+	metrics, err := app.UnitsMetrics(units, time.Now().UTC().Add(-a.MetricsMaxAge))
+	if err != nil {
+		return nil, err
+	}
+	processUnits := map[string][]provision.Unit{}
+	for _, u := range units {
+		processUnits[u.ProcessName] = append(processUnits[u.ProcessName], u)
+	}
+	var results []UnitScaleResult
+	for _, spec := range scaleApp.AutoScale {
+		result, ok := desiredUnits(spec, processUnits[spec.Process], metrics)
+		if ok {
+			results = append(results, result)
+		}
+	}
+	return results, nil
+}
+
+// desiredUnits calculates the number of units needed for the average usage
+// of the units of a process to reach the targets in spec. Units without
+// recent metrics are considered idle, as units with no usage don't store
+// them, and processes with no metrics at all or with stopped or sleeping units
+// are never scaled.
+func desiredUnits(spec provision.AutoScaleSpec, units []provision.Unit, metrics map[string]app.UnitMetrics) (UnitScaleResult, bool) {
+	result := UnitScaleResult{Process: spec.Process, From: uint(len(units))}
+	if len(units) == 0 {
+		return result, false
+	}
+	var cpu, requests float64
+	var reported int
+	for _, u := range units {
+		if u.Status == provision.StatusStopped || u.Status == provision.StatusAsleep {
+			return result, false
+		}
+		if m, ok := metrics[u.ID]; ok {
+			cpu += m.CPU
+			requests += m.Requests
+			reported++
+		}
+	}
+	result.To = result.From
+	if reported > 0 {
+		var fromCPU, fromRequests uint
+		avgCPU := cpu / float64(result.From)
+		avgRequests := requests / float64(result.From)
+		if spec.TargetCPU > 0 {
+			fromCPU = unitsForTarget(avgCPU, result.From, spec.TargetCPU)
+			result.Reason = fmt.Sprintf("average cpu %.2f%%, target %d%%", avgCPU, spec.TargetCPU)
+		}
+		if spec.TargetRequests > 0 {
+			fromRequests = unitsForTarget(avgRequests, result.From, spec.TargetRequests)
+			if fromRequests > fromCPU {
+				result.Reason = fmt.Sprintf("average requests %.2f/s, target %d/s", avgRequests, spec.TargetRequests)
+			}
+		}
+		result.To = fromCPU
+		if fromRequests > fromCPU {
+			result.To = fromRequests
+		}
+	}
+	if result.To < spec.MinUnits {
+		result.To = spec.MinUnits
+		result.Reason = fmt.Sprintf("min units is %d", spec.MinUnits)
+	}
+	if result.To > spec.MaxUnits {
+		result.To = spec.MaxUnits
+		result.Reason = fmt.Sprintf("max units is %d", spec.MaxUnits)
+	}
+	return result, result.To != result.From
+}
+
+func unitsForTarget(average float64, current, target uint) uint {
+	return uint(math.Ceil(average * float64(current) / float64(target)))
+}
@@ -0,0 +1,183 @@
+// Copyright 2018 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package autoscale
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/globalsign/mgo/bson"
+	"github.com/tsuru/tsuru/app"
+	"github.com/tsuru/tsuru/event"
+	"github.com/tsuru/tsuru/event/eventtest"
+	"github.com/tsuru/tsuru/provision"
+	"github.com/tsuru/tsuru/quota"
+	"gopkg.in/check.v1"
+)
+
+func (s *S) setAppAutoScale(c *check.C, spec provision.AutoScaleSpec) {
+	err := s.conn.Apps().Update(bson.M{"name": s.appInstance.GetName()}, bson.M{"$set": bson.M{
+		"autoscale": []provision.AutoScaleSpec{spec},
+		"quota":     quota.Unlimited,
+	}})
+	c.Assert(err, check.IsNil)
+}
+
+func (s *S) reportUnitsMetrics(c *check.C, cpu, requests float64) {
+	units, err := s.p.Units(s.appInstance)
+	c.Assert(err, check.IsNil)
+	for _, u := range units {
+		err = s.conn.UnitMetrics().Insert(app.UnitMetrics{
+			UnitID:    u.ID,
+			CPU:       cpu,
+			Requests:  requests,
+			UpdatedAt: time.Now().UTC(),
+		})
+		c.Assert(err, check.IsNil)
+	}
+}
+
+func (s *S) TestUnitConfigRunScaleUp(c *check.C) {
+	err := s.p.AddUnits(s.appInstance, 2, "web", nil)
+	c.Assert(err, check.IsNil)
+	s.setAppAutoScale(c, provision.AutoScaleSpec{Process: "web", MinUnits: 1, MaxUnits: 10, TargetCPU: 50})
+	s.reportUnitsMetrics(c, 90, 0)
+	err = RunUnitsOnce(nil)
+	c.Assert(err, check.IsNil)
+	units, err := s.p.Units(s.appInstance)
+	c.Assert(err, check.IsNil)
+	c.Assert(units, check.HasLen, 4)
+	c.Assert(eventtest.EventDesc{
+		Target: event.Target{Type: event.TargetTypeApp, Value: s.appInstance.GetName()},
+		Kind:   UnitEventKind,
+		EndCustomData: []map[string]interface{}{
+			{"process": "web", "from": 2, "to": 4},
+		},
+		LogMatches: `scaling process "web" from 2 to 4 units: average cpu 90.00%, target 50%`,
+	}, eventtest.HasEvent)
+}
+
+func (s *S) TestUnitConfigRunScaleDown(c *check.C) {
+	err := s.p.AddUnits(s.appInstance, 4, "web", nil)
+	c.Assert(err, check.IsNil)
+	s.setAppAutoScale(c, provision.AutoScaleSpec{Process: "web", MinUnits: 2, MaxUnits: 10, TargetRequests: 100})
+	s.reportUnitsMetrics(c, 5, 10)
+	err = RunUnitsOnce(nil)
+	c.Assert(err, check.IsNil)
+	units, err := s.p.Units(s.appInstance)
+	c.Assert(err, check.IsNil)
+	c.Assert(units, check.HasLen, 2)
+	c.Assert(eventtest.EventDesc{
+		Target: event.Target{Type: event.TargetTypeApp, Value: s.appInstance.GetName()},
+		Kind:   UnitEventKind,
+		EndCustomData: []map[string]interface{}{
+			{"process": "web", "from": 4, "to": 2, "reason": "min units is 2"},
+		},
+	}, eventtest.HasEvent)
+}
+
+func (s *S) TestUnitConfigRunNothingToDo(c *check.C) {
+	err := s.p.AddUnits(s.appInstance, 2, "web", nil)
+	c.Assert(err, check.IsNil)
+	s.setAppAutoScale(c, provision.AutoScaleSpec{Process: "web", MinUnits: 1, MaxUnits: 10, TargetCPU: 50})
+	s.reportUnitsMetrics(c, 45, 0)
+	err = RunUnitsOnce(nil)
+	c.Assert(err, check.IsNil)
+	units, err := s.p.Units(s.appInstance)
+	c.Assert(err, check.IsNil)
+	c.Assert(units, check.HasLen, 2)
+	c.Assert(eventtest.EventDesc{IsEmpty: true}, eventtest.HasEvent)
+}
+
+func (s *S) TestUnitConfigRunIgnoresOldMetrics(c *check.C) {
+	err := s.p.AddUnits(s.appInstance, 2, "web", nil)
+	c.Assert(err, check.IsNil)
+	s.setAppAutoScale(c, provision.AutoScaleSpec{Process: "web", MinUnits: 1, MaxUnits: 10, TargetCPU: 50})
+	s.reportUnitsMetrics(c, 90, 0)
+	err = s.conn.UnitMetrics().Update(nil, bson.M{"$set": bson.M{"updatedat": time.Now().UTC().Add(-time.Hour)}})
+	c.Assert(err, check.IsNil)
+	err = RunUnitsOnce(nil)
+	c.Assert(err, check.IsNil)
+	units, err := s.p.Units(s.appInstance)
+	c.Assert(err, check.IsNil)
+	c.Assert(units, check.HasLen, 2)
+}
+
+func (s *S) TestDesiredUnits(c *check.C) {
+	units := []provision.Unit{
+		{ID: "u1", ProcessName: "web", Status: provision.StatusStarted},
+		{ID: "u2", ProcessName: "web", Status: provision.StatusStarted},
+	}
+	metrics := map[string]app.UnitMetrics{
+		"u1": {UnitID: "u1", CPU: 80, Requests: 300},
+		"u2": {UnitID: "u2", CPU: 60, Requests: 100},
+	}
+	var idleUnits []provision.Unit
+	for i := 0; i < 10; i++ {
+		idleUnits = append(idleUnits, provision.Unit{ID: fmt.Sprintf("u%d", i), ProcessName: "web", Status: provision.StatusStarted})
+	}
+	tests := []struct {
+		spec     provision.AutoScaleSpec
+		units    []provision.Unit
+		metrics  map[string]app.UnitMetrics
+		expected UnitScaleResult
+		ok       bool
+	}{
+		{
+			spec:     provision.AutoScaleSpec{Process: "web", MinUnits: 1, MaxUnits: 10, TargetCPU: 50},
+			units:    units,
+			metrics:  metrics,
+			expected: UnitScaleResult{Process: "web", From: 2, To: 3, Reason: "average cpu 70.00%, target 50%"},
+			ok:       true,
+		},
+		{
+			spec:     provision.AutoScaleSpec{Process: "web", MinUnits: 1, MaxUnits: 10, TargetCPU: 50, TargetRequests: 50},
+			units:    units,
+			metrics:  metrics,
+			expected: UnitScaleResult{Process: "web", From: 2, To: 8, Reason: "average requests 200.00/s, target 50/s"},
+			ok:       true,
+		},
+		{
+			spec:     provision.AutoScaleSpec{Process: "web", MinUnits: 1, MaxUnits: 5, TargetRequests: 50},
+			units:    units,
+			metrics:  metrics,
+			expected: UnitScaleResult{Process: "web", From: 2, To: 5, Reason: "max units is 5"},
+			ok:       true,
+		},
+		{
+			spec:     provision.AutoScaleSpec{Process: "web", MinUnits: 3, MaxUnits: 5, TargetCPU: 50},
+			units:    units,
+			metrics:  nil,
+			expected: UnitScaleResult{Process: "web", From: 2, To: 3, Reason: "min units is 3"},
+			ok:       true,
+		},
+		{
+			spec:     provision.AutoScaleSpec{Process: "web", MinUnits: 1, MaxUnits: 5, TargetCPU: 50},
+			units:    units,
+			metrics:  nil,
+			expected: UnitScaleResult{Process: "web", From: 2, To: 2},
+			ok:       false,
+		},
+		{
+			spec:     provision.AutoScaleSpec{Process: "web", MinUnits: 1, MaxUnits: 20, TargetCPU: 50},
+			units:    idleUnits,
+			metrics:  map[string]app.UnitMetrics{"u0": {UnitID: "u0", CPU: 80}},
+			expected: UnitScaleResult{Process: "web", From: 10, To: 2, Reason: "average cpu 8.00%, target 50%"},
+			ok:       true,
+		},
+		{
+			spec:     provision.AutoScaleSpec{Process: "web", MinUnits: 3, MaxUnits: 5, TargetCPU: 50},
+			units:    []provision.Unit{{ID: "u1", ProcessName: "web", Status: provision.StatusStopped}},
+			metrics:  metrics,
+			expected: UnitScaleResult{Process: "web", From: 1},
+			ok:       false,
+		},
+	}
+	for i, tt := range tests {
+		result, ok := desiredUnits(tt.spec, tt.units, tt.metrics)
+		c.Assert(ok, check.Equals, tt.ok, check.Commentf("test %d", i))
+		c.Assert(result, check.DeepEquals, tt.expected, check.Commentf("test %d", i))
+	}
+}
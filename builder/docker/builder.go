@@ -136,6 +136,10 @@ func imageBuild(client provision.BuilderDockerClient, app provision.App, opts *b
 	if err != nil {
 		return "", err
 	}
+	err = provision.ValidatePorts(yaml.Ports, image.WebProcessName(procfile))
+	if err != nil {
+		return "", err
+	}
 	containerID, err = runBuildHooks(client, app, imageID, evt, yaml)
 	defer removeContainer(client, containerID)
 	if err != nil {
@@ -211,10 +215,17 @@ func tsuruYamlToCustomData(yaml *provision.TsuruYamlData) map[string]interface{}
 		return nil
 	}
 
-	return map[string]interface{}{
+	customData := map[string]interface{}{
 		"healthcheck": yaml.Healthcheck,
 		"hooks":       yaml.Hooks,
 	}
+	if len(yaml.Cron) > 0 {
+		customData["cron"] = yaml.Cron
+	}
+	if len(yaml.Ports) > 0 {
+		customData["ports"] = yaml.Ports
+	}
+	return customData
 }
 
 func runBuildHooks(client provision.BuilderDockerClient, app provision.App, imageID string, evt *event.Event, tsuruYamlData *provision.TsuruYamlData) (string, error) {
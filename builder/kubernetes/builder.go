@@ -76,6 +76,12 @@ func imageBuild(client provision.BuilderKubeClient, a provision.App, imageID str
 	for k, v := range procfile {
 		fmt.Fprintf(evt, " ---> Process %q found with commands: %q\n", k, v)
 	}
+	if tsuruYaml != nil {
+		err = provision.ValidatePorts(tsuruYaml.Ports, image.WebProcessName(procfile))
+		if err != nil {
+			return "", err
+		}
+	}
 	imageData := image.ImageMetadata{
 		Name:       newImage,
 		Processes:  procfile,
@@ -95,8 +101,15 @@ func tsuruYamlToCustomData(yaml *provision.TsuruYamlData) map[string]interface{}
 	if yaml == nil {
 		return nil
 	}
-	return map[string]interface{}{
+	customData := map[string]interface{}{
 		"healthcheck": yaml.Healthcheck,
 		"hooks":       yaml.Hooks,
 	}
+	if len(yaml.Cron) > 0 {
+		customData["cron"] = yaml.Cron
+	}
+	if len(yaml.Ports) > 0 {
+		customData["ports"] = yaml.Ports
+	}
+	return customData
 }
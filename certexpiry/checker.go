@@ -0,0 +1,205 @@
+// Copyright 2018 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package certexpiry periodically checks the certificates set on app routers,
+// creating events for certificates about to expire or already expired.
+package certexpiry
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/tsuru/config"
+	"github.com/tsuru/tsuru/api/shutdown"
+	"github.com/tsuru/tsuru/app"
+	"github.com/tsuru/tsuru/event"
+	"github.com/tsuru/tsuru/log"
+	"github.com/tsuru/tsuru/permission"
+)
+
+const (
+	EventKindExpiring = "certificate-expiring"
+	EventKindExpired  = "certificate-expired"
+
+	defaultWarnBefore    = 30 * 24 * time.Hour
+	defaultWarnInterval  = 24 * time.Hour
+	defaultCheckInterval = time.Hour
+)
+
+type Checker struct {
+	warnBefore    time.Duration
+	warnInterval  time.Duration
+	checkInterval time.Duration
+	done          chan bool
+	running       bool
+	backfilled    bool
+}
+
+func newChecker() *Checker {
+	return &Checker{
+		warnBefore:    configDuration("certificates:expiration-warning", defaultWarnBefore),
+		warnInterval:  configDuration("certificates:warning-interval", defaultWarnInterval),
+		checkInterval: configDuration("certificates:check-interval", defaultCheckInterval),
+		done:          make(chan bool),
+	}
+}
+
+func configDuration(key string, defaultValue time.Duration) time.Duration {
+	seconds, _ := config.GetInt(key)
+	if seconds <= 0 {
+		return defaultValue
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+func Initialize() error {
+	c := newChecker()
+	shutdown.Register(c)
+	c.running = true
+	go c.run()
+	return nil
+}
+
+func (c *Checker) run() {
+	for {
+		err := c.runOnce(time.Now().UTC())
+		if err != nil {
+			logError(err.Error())
+		}
+		select {
+		case <-c.done:
+			return
+		case <-time.After(c.checkInterval):
+		}
+	}
+}
+
+func (c *Checker) Shutdown(ctx context.Context) error {
+	if !c.running {
+		return nil
+	}
+	c.running = false
+	select {
+	case c.done <- true:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (c *Checker) String() string {
+	return "certificates expiration checker"
+}
+
+// runOnce creates events for the certificates expiring within the warning
+// period, at most once per warning interval for each certificate. On the
+// first run it also stores the information of certificates added before
+// tsuru started storing it.
+func (c *Checker) runOnce(now time.Time) (retErr error) {
+	defer func() {
+		if rec := recover(); rec != nil {
+			retErr = errors.Errorf("recovered panic, we can never stop! panic: %v", rec)
+		}
+	}()
+	apps, err := app.List(nil)
+	if err != nil {
+		return errors.Wrap(err, "error listing apps")
+	}
+	if !c.backfilled {
+		c.backfill(apps)
+	}
+	for i := range apps {
+		a := &apps[i]
+		for _, cert := range a.Certificates {
+			if !c.shouldWarn(&cert, now) {
+				continue
+			}
+			claimed, err := a.ClaimCertificateWarning(cert.Name, cert.LastWarningAt, now)
+			if err != nil {
+				logError("unable to store warning for certificate %q of app %q: %s", cert.Name, a.Name, err)
+				continue
+			}
+			if !claimed {
+				logDebug("skipping warning for certificate %q, already sent by another instance", cert.Name)
+				continue
+			}
+			err = warn(a, cert, now)
+			if err != nil {
+				logError("unable to create event for certificate %q of app %q: %s", cert.Name, a.Name, err)
+				_, err = a.ClaimCertificateWarning(cert.Name, now, cert.LastWarningAt)
+				if err != nil {
+					logError("unable to restore warning for certificate %q of app %q: %s", cert.Name, a.Name, err)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func (c *Checker) backfill(apps []app.App) {
+	failed := false
+	for i := range apps {
+		err := apps[i].LoadCertificatesInfo()
+		if err != nil {
+			logError("unable to load certificates of app %q: %s", apps[i].Name, err)
+			failed = true
+		}
+	}
+	c.backfilled = !failed
+}
+
+func (c *Checker) shouldWarn(cert *app.CertificateInfo, now time.Time) bool {
+	if cert.NotAfter.Sub(now) > c.warnBefore {
+		return false
+	}
+	return now.Sub(cert.LastWarningAt) >= c.warnInterval
+}
+
+func warn(a *app.App, cert app.CertificateInfo, now time.Time) error {
+	kind := EventKindExpiring
+	if cert.Expired(now) {
+		kind = EventKindExpired
+	}
+	evt, err := event.NewInternal(&event.Opts{
+		Target: event.Target{Type: event.TargetTypeCertificate, Value: cert.Name},
+		ExtraTargets: []event.ExtraTarget{
+			{Target: event.Target{Type: event.TargetTypeApp, Value: a.Name}},
+		},
+		InternalKind: kind,
+		CustomData: map[string]interface{}{
+			"name":     cert.Name,
+			"dnsnames": cert.DNSNames,
+			"notafter": cert.NotAfter,
+		},
+		Allowed: event.Allowed(permission.PermAppReadEvents, append(permission.Contexts(permission.CtxTeam, a.Teams),
+			permission.Context(permission.CtxApp, a.Name),
+			permission.Context(permission.CtxPool, a.Pool),
+		)...),
+	})
+	if err != nil {
+		if _, ok := err.(event.ErrEventLocked); ok {
+			logDebug("skipping warning for certificate %q, event locked", cert.Name)
+			return nil
+		}
+		return err
+	}
+	if kind == EventKindExpired {
+		fmt.Fprintf(evt, "certificate %q of app %q expired at %s\n", cert.Name, a.Name, cert.NotAfter.Format(time.RFC3339))
+	} else {
+		fmt.Fprintf(evt, "certificate %q of app %q expires at %s\n", cert.Name, a.Name, cert.NotAfter.Format(time.RFC3339))
+	}
+	return evt.Done(nil)
+}
+
+func logError(msg string, params ...interface{}) {
+	msg = fmt.Sprintf("[certificate expiration] %s", msg)
+	log.Errorf(msg, params...)
+}
+
+func logDebug(msg string, params ...interface{}) {
+	msg = fmt.Sprintf("[certificate expiration] %s", msg)
+	log.Debugf(msg, params...)
+}
@@ -0,0 +1,161 @@
+// Copyright 2018 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package certexpiry
+
+import (
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/tsuru/config"
+	"github.com/tsuru/tsuru/app"
+	"github.com/tsuru/tsuru/db"
+	"github.com/tsuru/tsuru/db/dbtest"
+	"github.com/tsuru/tsuru/event"
+	"github.com/tsuru/tsuru/event/eventtest"
+	"github.com/tsuru/tsuru/router/routertest"
+	_ "github.com/tsuru/tsuru/storage/mongodb"
+	appTypes "github.com/tsuru/tsuru/types/app"
+	"gopkg.in/check.v1"
+)
+
+func Test(t *testing.T) { check.TestingT(t) }
+
+var _ = check.Suite(&S{})
+
+type S struct {
+	conn     *db.Storage
+	notAfter time.Time
+}
+
+func (s *S) SetUpSuite(c *check.C) {
+	config.Set("log:disable-syslog", true)
+	config.Set("database:url", "127.0.0.1:27017?maxPoolSize=100")
+	config.Set("database:name", "certexpiry_tests_s")
+}
+
+func (s *S) SetUpTest(c *check.C) {
+	var err error
+	s.conn, err = db.Conn()
+	c.Assert(err, check.IsNil)
+	dbtest.ClearAllCollections(s.conn.Apps().Database)
+	s.notAfter = time.Date(2018, 6, 1, 12, 0, 0, 0, time.UTC)
+	err = s.conn.Apps().Insert(&app.App{
+		Name:  "myapp",
+		Pool:  "pool1",
+		CName: []string{"myapp.io"},
+		Certificates: []app.CertificateInfo{
+			{Name: "myapp.io", DNSNames: []string{"myapp.io"}, NotAfter: s.notAfter},
+		},
+	})
+	c.Assert(err, check.IsNil)
+}
+
+func (s *S) TearDownTest(c *check.C) {
+	s.conn.Close()
+}
+
+func (s *S) TearDownSuite(c *check.C) {
+	conn, err := db.Conn()
+	c.Assert(err, check.IsNil)
+	defer conn.Close()
+	dbtest.ClearAllCollections(conn.Apps().Database)
+}
+
+func (s *S) runOnce(c *check.C, t time.Time) {
+	err := newChecker().runOnce(t)
+	c.Assert(err, check.IsNil)
+}
+
+func (s *S) countEvents(c *check.C) int {
+	evts, err := event.List(&event.Filter{Target: event.Target{Type: event.TargetTypeCertificate, Value: "myapp.io"}})
+	c.Assert(err, check.IsNil)
+	return len(evts)
+}
+
+func (s *S) TestRunOnceNotExpiring(c *check.C) {
+	s.runOnce(c, s.notAfter.Add(-31*24*time.Hour))
+	c.Assert(s.countEvents(c), check.Equals, 0)
+}
+
+func (s *S) TestRunOnceExpiring(c *check.C) {
+	now := s.notAfter.Add(-10 * 24 * time.Hour)
+	s.runOnce(c, now)
+	c.Assert(eventtest.EventDesc{
+		Target:       event.Target{Type: event.TargetTypeCertificate, Value: "myapp.io"},
+		ExtraTargets: []event.ExtraTarget{{Target: event.Target{Type: event.TargetTypeApp, Value: "myapp"}}},
+		Kind:         EventKindExpiring,
+		StartCustomData: map[string]interface{}{
+			"name":     "myapp.io",
+			"dnsnames": []interface{}{"myapp.io"},
+			"notafter": s.notAfter,
+		},
+		LogMatches: `certificate "myapp.io" of app "myapp" expires at 2018-06-01T12:00:00Z`,
+	}, eventtest.HasEvent)
+	a, err := app.GetByName("myapp")
+	c.Assert(err, check.IsNil)
+	c.Assert(a.Certificates[0].LastWarningAt.Equal(now), check.Equals, true)
+}
+
+func (s *S) TestRunOnceExpired(c *check.C) {
+	s.runOnce(c, s.notAfter.Add(time.Hour))
+	c.Assert(eventtest.EventDesc{
+		Target:     event.Target{Type: event.TargetTypeCertificate, Value: "myapp.io"},
+		Kind:       EventKindExpired,
+		LogMatches: `certificate "myapp.io" of app "myapp" expired at 2018-06-01T12:00:00Z`,
+	}, eventtest.HasEvent)
+}
+
+func (s *S) TestRunOnceWarningInterval(c *check.C) {
+	now := s.notAfter.Add(-10 * 24 * time.Hour)
+	s.runOnce(c, now)
+	s.runOnce(c, now.Add(time.Hour))
+	c.Assert(s.countEvents(c), check.Equals, 1)
+	s.runOnce(c, now.Add(24*time.Hour))
+	c.Assert(s.countEvents(c), check.Equals, 2)
+}
+
+func (s *S) TestRunOnceCustomConfig(c *check.C) {
+	config.Set("certificates:expiration-warning", 3600)
+	config.Set("certificates:warning-interval", 60)
+	defer config.Unset("certificates")
+	now := s.notAfter.Add(-2 * time.Hour)
+	s.runOnce(c, now)
+	c.Assert(s.countEvents(c), check.Equals, 0)
+	now = s.notAfter.Add(-30 * time.Minute)
+	s.runOnce(c, now)
+	s.runOnce(c, now.Add(time.Minute))
+	c.Assert(s.countEvents(c), check.Equals, 2)
+}
+
+func (s *S) TestRunOnceBackfillsCertificates(c *check.C) {
+	config.Set("routers:fake-tls:type", "fake-tls")
+	defer config.Unset("routers")
+	defer routertest.TLSRouter.Reset()
+	cert, err := ioutil.ReadFile("../app/testdata/certificate.crt")
+	c.Assert(err, check.IsNil)
+	a := app.App{
+		Name:    "oldapp",
+		Pool:    "pool1",
+		CName:   []string{"app.io"},
+		Routers: []appTypes.AppRouter{{Name: "fake-tls"}},
+	}
+	err = s.conn.Apps().Insert(&a)
+	c.Assert(err, check.IsNil)
+	err = routertest.TLSRouter.AddBackend(&a)
+	c.Assert(err, check.IsNil)
+	routertest.TLSRouter.Certs["app.io"] = string(cert)
+	notAfter := time.Date(2027, 1, 10, 20, 33, 11, 0, time.UTC)
+	s.runOnce(c, notAfter.Add(-10*24*time.Hour))
+	dbApp, err := app.GetByName("oldapp")
+	c.Assert(err, check.IsNil)
+	c.Assert(dbApp.Certificates, check.HasLen, 1)
+	c.Assert(dbApp.Certificates[0].Name, check.Equals, "app.io")
+	c.Assert(dbApp.Certificates[0].NotAfter.Equal(notAfter), check.Equals, true)
+	c.Assert(eventtest.EventDesc{
+		Target: event.Target{Type: event.TargetTypeCertificate, Value: "app.io"},
+		Kind:   EventKindExpiring,
+	}, eventtest.HasEvent)
+}
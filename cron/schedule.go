@@ -0,0 +1,178 @@
+// Copyright 2018 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package cron parses cron schedule expressions.
+package cron
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Schedule is a parsed cron expression, with the standard five fields:
+// minute, hour, day of month, month and day of week. Schedules are always
+// evaluated in UTC.
+type Schedule struct {
+	minute bitset
+	hour   bitset
+	dom    bitset
+	month  bitset
+	dow    bitset
+	// anyDay is set when either the day of month or the day of week is a
+	// wildcard, in which case both fields must match. Otherwise a day
+	// matches if any of them matches.
+	anyDay bool
+}
+
+type bitset uint64
+
+func (b bitset) has(i int) bool {
+	return b&(1<<uint(i)) != 0
+}
+
+type field struct {
+	name     string
+	min, max int
+}
+
+var (
+	minuteField = field{name: "minute", min: 0, max: 59}
+	hourField   = field{name: "hour", min: 0, max: 23}
+	domField    = field{name: "day of month", min: 1, max: 31}
+	monthField  = field{name: "month", min: 1, max: 12}
+	dowField    = field{name: "day of week", min: 0, max: 7}
+)
+
+var descriptors = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// Parse parses a cron expression. Each field accepts a wildcard, a number, a
+// range (1-5), a step (*/15 or 0-30/10) or a comma separated list of those.
+// Days of week go from 0 to 7, both meaning Sunday. The descriptors
+// @yearly, @annually, @monthly, @weekly, @daily, @midnight and @hourly are
+// also accepted.
+func Parse(spec string) (*Schedule, error) {
+	spec = strings.TrimSpace(spec)
+	if expr, ok := descriptors[spec]; ok {
+		spec = expr
+	}
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return nil, errors.Errorf("invalid schedule %q: expected 5 fields, got %d", spec, len(fields))
+	}
+	var s Schedule
+	var err error
+	dests := []*bitset{&s.minute, &s.hour, &s.dom, &s.month, &s.dow}
+	for i, f := range []field{minuteField, hourField, domField, monthField, dowField} {
+		*dests[i], err = f.parse(fields[i])
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid schedule %q", spec)
+		}
+	}
+	if s.dow.has(7) {
+		s.dow |= 1
+	}
+	s.anyDay = strings.HasPrefix(fields[2], "*") || strings.HasPrefix(fields[4], "*")
+	return &s, nil
+}
+
+func (f field) parse(expr string) (bitset, error) {
+	var bits bitset
+	for _, part := range strings.Split(expr, ",") {
+		rangeExpr, step := part, 1
+		if i := strings.Index(part, "/"); i >= 0 {
+			var err error
+			rangeExpr = part[:i]
+			step, err = strconv.Atoi(part[i+1:])
+			if err != nil || step <= 0 {
+				return 0, errors.Errorf("invalid step in %s field: %q", f.name, part)
+			}
+		}
+		start, end := f.min, f.max
+		if rangeExpr != "*" {
+			bounds := strings.SplitN(rangeExpr, "-", 2)
+			var err error
+			start, err = f.value(bounds[0])
+			if err != nil {
+				return 0, err
+			}
+			end = start
+			if len(bounds) == 2 {
+				end, err = f.value(bounds[1])
+				if err != nil {
+					return 0, err
+				}
+			} else if step > 1 {
+				end = f.max
+			}
+			if end < start {
+				return 0, errors.Errorf("invalid range in %s field: %q", f.name, part)
+			}
+		}
+		for i := start; i <= end; i += step {
+			bits |= 1 << uint(i)
+		}
+	}
+	return bits, nil
+}
+
+func (f field) value(expr string) (int, error) {
+	v, err := strconv.Atoi(expr)
+	if err != nil || v < f.min || v > f.max {
+		return 0, errors.Errorf("invalid value in %s field: %q, expected a number between %d and %d", f.name, expr, f.min, f.max)
+	}
+	return v, nil
+}
+
+// Matches returns whether the schedule fires in the minute of t.
+func (s *Schedule) Matches(t time.Time) bool {
+	t = t.UTC()
+	return s.minute.has(t.Minute()) && s.hour.has(t.Hour()) && s.month.has(int(t.Month())) && s.matchDay(t)
+}
+
+func (s *Schedule) matchDay(t time.Time) bool {
+	dom := s.dom.has(t.Day())
+	dow := s.dow.has(int(t.Weekday()))
+	if s.anyDay {
+		return dom && dow
+	}
+	return dom || dow
+}
+
+// Next returns the first time after t in which the schedule fires, or the
+// zero time if it doesn't fire in the next five years.
+func (s *Schedule) Next(t time.Time) time.Time {
+	t = t.UTC().Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(5, 0, 0)
+	for t.Before(limit) {
+		if !s.month.has(int(t.Month())) {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, time.UTC)
+			continue
+		}
+		if !s.matchDay(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, time.UTC)
+			continue
+		}
+		if !s.hour.has(t.Hour()) {
+			t = t.Truncate(time.Hour).Add(time.Hour)
+			continue
+		}
+		if !s.minute.has(t.Minute()) {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+	return time.Time{}
+}
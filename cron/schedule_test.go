@@ -0,0 +1,90 @@
+// Copyright 2018 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package cron
+
+import (
+	"testing"
+	"time"
+
+	"gopkg.in/check.v1"
+)
+
+type S struct{}
+
+var _ = check.Suite(&S{})
+
+func Test(t *testing.T) { check.TestingT(t) }
+
+func (s *S) TestParseInvalid(c *check.C) {
+	tests := []struct {
+		spec string
+		err  string
+	}{
+		{"* * * *", `invalid schedule "\* \* \* \*": expected 5 fields, got 4`},
+		{"60 * * * *", `invalid schedule "60 \* \* \* \*": invalid value in minute field: "60", expected a number between 0 and 59`},
+		{"* * 0 * *", `invalid schedule .*: invalid value in day of month field: "0".*`},
+		{"* * * 13 *", `invalid schedule .*: invalid value in month field: "13".*`},
+		{"* * * * 8", `invalid schedule .*: invalid value in day of week field: "8".*`},
+		{"*/0 * * * *", `invalid schedule .*: invalid step in minute field: "\*/0"`},
+		{"10-5 * * * *", `invalid schedule .*: invalid range in minute field: "10-5"`},
+		{"a * * * *", `invalid schedule .*: invalid value in minute field: "a".*`},
+		{"@often", `invalid schedule "@often": expected 5 fields, got 1`},
+	}
+	for _, tt := range tests {
+		_, err := Parse(tt.spec)
+		c.Check(err, check.ErrorMatches, tt.err, check.Commentf("spec: %q", tt.spec))
+	}
+}
+
+func (s *S) TestScheduleMatches(c *check.C) {
+	tests := []struct {
+		spec    string
+		time    string
+		matches bool
+	}{
+		{"* * * * *", "2018-03-01T10:07:30Z", true},
+		{"*/15 * * * *", "2018-03-01T10:30:00Z", true},
+		{"*/15 * * * *", "2018-03-01T10:31:00Z", false},
+		{"5/20 * * * *", "2018-03-01T10:45:00Z", true},
+		{"0 9-17 * * 1-5", "2018-03-01T12:00:00Z", true},
+		{"0 9-17 * * 1-5", "2018-03-03T12:00:00Z", false},
+		{"0 0 * * 7", "2018-03-04T00:00:00Z", true},
+		{"0 0 1,15 * *", "2018-03-15T00:00:00Z", true},
+		{"0 0 1 * 1", "2018-03-05T00:00:00Z", true},
+		{"0 0 1 * 1", "2018-03-06T00:00:00Z", false},
+		{"@daily", "2018-03-06T00:00:00Z", true},
+		{"@hourly", "2018-03-06T10:01:00Z", false},
+		{"30 12 * * *", "2018-03-06T09:30:00-03:00", true},
+	}
+	for _, tt := range tests {
+		sched, err := Parse(tt.spec)
+		c.Assert(err, check.IsNil)
+		t, err := time.Parse(time.RFC3339, tt.time)
+		c.Assert(err, check.IsNil)
+		c.Check(sched.Matches(t), check.Equals, tt.matches, check.Commentf("spec: %q, time: %s", tt.spec, tt.time))
+	}
+}
+
+func (s *S) TestScheduleNext(c *check.C) {
+	tests := []struct {
+		spec string
+		from string
+		next string
+	}{
+		{"* * * * *", "2018-03-01T10:07:30Z", "2018-03-01T10:08:00Z"},
+		{"*/15 * * * *", "2018-03-01T10:30:00Z", "2018-03-01T10:45:00Z"},
+		{"0 9 * * 1", "2018-03-01T10:00:00Z", "2018-03-05T09:00:00Z"},
+		{"0 0 29 2 *", "2018-03-01T00:00:00Z", "2020-02-29T00:00:00Z"},
+		{"@yearly", "2018-03-01T00:00:00Z", "2019-01-01T00:00:00Z"},
+		{"0 0 31 2 *", "2018-03-01T00:00:00Z", "0001-01-01T00:00:00Z"},
+	}
+	for _, tt := range tests {
+		sched, err := Parse(tt.spec)
+		c.Assert(err, check.IsNil)
+		from, err := time.Parse(time.RFC3339, tt.from)
+		c.Assert(err, check.IsNil)
+		c.Check(sched.Next(from).Format(time.RFC3339), check.Equals, tt.next, check.Commentf("spec: %q", tt.spec))
+	}
+}
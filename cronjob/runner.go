@@ -0,0 +1,247 @@
+// Copyright 2018 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package cronjob runs the cron jobs of apps in isolated units.
+package cronjob
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/globalsign/mgo"
+	"github.com/globalsign/mgo/bson"
+	"github.com/pkg/errors"
+	"github.com/tsuru/tsuru/api/shutdown"
+	"github.com/tsuru/tsuru/app"
+	"github.com/tsuru/tsuru/app/image"
+	"github.com/tsuru/tsuru/cron"
+	"github.com/tsuru/tsuru/db"
+	"github.com/tsuru/tsuru/event"
+	"github.com/tsuru/tsuru/log"
+	"github.com/tsuru/tsuru/permission"
+	"github.com/tsuru/tsuru/provision"
+)
+
+const EventKind = "cron-job"
+
+// Runner checks the cron jobs of every app at the start of each minute. A
+// job is started by only one of the tsuru API instances, the one able to
+// record the scheduled time first. Only apps declaring jobs through the API
+// or in the tsuru.yaml of their current image are loaded, with the jobs of
+// each image being read once and kept while it's the current image of an app.
+type Runner struct {
+	done      chan bool
+	running   bool
+	jobs      sync.WaitGroup
+	imageJobs map[string][]provision.CronJob
+}
+
+type runData struct {
+	Job         provision.CronJob
+	ScheduledAt time.Time
+}
+
+func Initialize() error {
+	r := &Runner{done: make(chan bool)}
+	shutdown.Register(r)
+	r.running = true
+	go r.run()
+	return nil
+}
+
+func (r *Runner) run() {
+	for {
+		now := time.Now().UTC()
+		select {
+		case <-r.done:
+			return
+		case <-time.After(now.Truncate(time.Minute).Add(time.Minute).Sub(now)):
+		}
+		err := r.runOnce(time.Now())
+		if err != nil {
+			logError(err.Error())
+		}
+	}
+}
+
+func (r *Runner) Shutdown(ctx context.Context) error {
+	if !r.running {
+		return nil
+	}
+	r.done <- true
+	r.running = false
+	finished := make(chan struct{})
+	go func() {
+		r.jobs.Wait()
+		close(finished)
+	}()
+	select {
+	case <-finished:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (r *Runner) String() string {
+	return "app cron jobs"
+}
+
+// runOnce starts the jobs scheduled to the minute of t, without waiting for
+// them to finish.
+func (r *Runner) runOnce(t time.Time) (retErr error) {
+	defer func() {
+		if rec := recover(); rec != nil {
+			retErr = errors.Errorf("recovered panic, we can never stop! panic: %v", rec)
+		}
+	}()
+	t = t.UTC().Truncate(time.Minute)
+	currentImages, err := r.loadImageJobs()
+	if err != nil {
+		return errors.Wrap(err, "error listing app images")
+	}
+	apps, err := app.List(&app.Filter{CronJobs: true})
+	if err != nil {
+		return errors.Wrap(err, "error listing apps")
+	}
+	filter := &app.Filter{}
+	for appName := range currentImages {
+		filter.ExtraIn("name", appName)
+	}
+	if filter.Extra != nil {
+		var imageApps []app.App
+		imageApps, err = app.List(filter)
+		if err != nil {
+			return errors.Wrap(err, "error listing apps")
+		}
+		for _, a := range imageApps {
+			if len(a.CronJobs) == 0 {
+				apps = append(apps, a)
+			}
+		}
+	}
+	for i := range apps {
+		a := &apps[i]
+		jobs := a.MergeCronJobs(r.imageJobs[currentImages[a.Name]])
+		for _, job := range jobs {
+			if !r.isDue(a, &job, t) {
+				continue
+			}
+			r.jobs.Add(1)
+			go func(job provision.CronJob) {
+				defer r.jobs.Done()
+				runJob(a, job, t)
+			}(job)
+		}
+	}
+	return nil
+}
+
+// loadImageJobs refreshes the jobs declared in the current image of each app,
+// reading the metadata of images not seen before, and returns the current
+// images declaring jobs by app name.
+func (r *Runner) loadImageJobs() (map[string]string, error) {
+	appImages, err := image.ListAllAppImages()
+	if err != nil {
+		return nil, err
+	}
+	imageJobs := make(map[string][]provision.CronJob)
+	currentImages := make(map[string]string)
+	for appName, imgs := range appImages {
+		if len(imgs.DeployImages) == 0 {
+			continue
+		}
+		imageName := imgs.DeployImages[len(imgs.DeployImages)-1]
+		jobs, ok := r.imageJobs[imageName]
+		if !ok {
+			yamlData, err := image.GetImageTsuruYamlData(imageName)
+			if err != nil {
+				logError("unable to get cron jobs for app %q: %s", appName, err)
+				continue
+			}
+			jobs = yamlData.Cron
+		}
+		imageJobs[imageName] = jobs
+		if len(jobs) > 0 {
+			currentImages[appName] = imageName
+		}
+	}
+	r.imageJobs = imageJobs
+	return currentImages, nil
+}
+
+func (r *Runner) isDue(a *app.App, job *provision.CronJob, t time.Time) bool {
+	err := app.ValidateCronJob(job)
+	if err != nil {
+		logError("invalid cron job %q for app %q: %s", job.Name, a.Name, err)
+		return false
+	}
+	sched, err := cron.Parse(job.Schedule)
+	if err != nil || !sched.Matches(t) {
+		return false
+	}
+	claimed, err := claim(a.Name, job.Name, t)
+	if err != nil {
+		logError("unable to schedule cron job %q for app %q: %s", job.Name, a.Name, err)
+		return false
+	}
+	return claimed
+}
+
+// claim records t as the last scheduled time of the job, returning false if
+// the job was already scheduled to t or a later time.
+func claim(appName, jobName string, t time.Time) (bool, error) {
+	conn, err := db.Conn()
+	if err != nil {
+		return false, err
+	}
+	defer conn.Close()
+	_, err = conn.CronJobSchedules().Upsert(bson.M{
+		"_id":         appName + "/" + jobName,
+		"scheduledat": bson.M{"$lt": t},
+	}, bson.M{"$set": bson.M{"scheduledat": t}})
+	if mgo.IsDup(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func runJob(a *app.App, job provision.CronJob, t time.Time) {
+	evt, err := event.NewInternal(&event.Opts{
+		Target: event.Target{Type: event.TargetTypeCronJob, Value: a.Name + "/" + job.Name},
+		ExtraTargets: []event.ExtraTarget{
+			{Target: event.Target{Type: event.TargetTypeApp, Value: a.Name}},
+		},
+		InternalKind: EventKind,
+		CustomData:   runData{Job: job, ScheduledAt: t},
+		DisableLock:  job.ConcurrencyPolicy == provision.CronConcurrencyAllow,
+		Allowed: event.Allowed(permission.PermAppReadEvents, append(permission.Contexts(permission.CtxTeam, a.Teams),
+			permission.Context(permission.CtxApp, a.Name),
+			permission.Context(permission.CtxPool, a.Pool),
+		)...),
+	})
+	if err != nil {
+		if _, ok := err.(event.ErrEventLocked); ok {
+			logDebug("skipping cron job %q for app %q, previous run still running", job.Name, a.Name)
+		} else {
+			logError("error creating event for cron job %q for app %q: %s", job.Name, a.Name, err)
+		}
+		return
+	}
+	evt.Logf("running cron job %q scheduled to %s", job.Name, t.Format(time.RFC3339))
+	err = a.Run(job.Command, evt, provision.RunArgs{Isolated: true})
+	evt.Done(err)
+}
+
+func logError(msg string, params ...interface{}) {
+	msg = fmt.Sprintf("[cron jobs] %s", msg)
+	log.Errorf(msg, params...)
+}
+
+func logDebug(msg string, params ...interface{}) {
+	msg = fmt.Sprintf("[cron jobs] %s", msg)
+	log.Debugf(msg, params...)
+}
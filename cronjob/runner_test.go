@@ -0,0 +1,192 @@
+// Copyright 2018 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package cronjob
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/tsuru/config"
+	"github.com/tsuru/tsuru/app"
+	"github.com/tsuru/tsuru/app/image"
+	"github.com/tsuru/tsuru/db"
+	"github.com/tsuru/tsuru/db/dbtest"
+	"github.com/tsuru/tsuru/event"
+	"github.com/tsuru/tsuru/event/eventtest"
+	"github.com/tsuru/tsuru/permission"
+	"github.com/tsuru/tsuru/provision"
+	"github.com/tsuru/tsuru/provision/pool"
+	"github.com/tsuru/tsuru/provision/provisiontest"
+	"github.com/tsuru/tsuru/router/routertest"
+	_ "github.com/tsuru/tsuru/storage/mongodb"
+	"gopkg.in/check.v1"
+)
+
+func Test(t *testing.T) { check.TestingT(t) }
+
+var _ = check.Suite(&S{})
+
+type S struct {
+	conn        *db.Storage
+	p           *provisiontest.FakeProvisioner
+	appInstance *provisiontest.FakeApp
+}
+
+func (s *S) SetUpSuite(c *check.C) {
+	config.Set("log:disable-syslog", true)
+	config.Set("database:url", "127.0.0.1:27017?maxPoolSize=100")
+	config.Set("database:name", "cronjob_tests_s")
+}
+
+func (s *S) SetUpTest(c *check.C) {
+	routertest.FakeRouter.Reset()
+	var err error
+	s.conn, err = db.Conn()
+	c.Assert(err, check.IsNil)
+	dbtest.ClearAllCollections(s.conn.Apps().Database)
+	provisiontest.ProvisionerInstance.Reset()
+	s.p = provisiontest.ProvisionerInstance
+	err = pool.AddPool(pool.AddPoolOptions{Name: "pool1", Provisioner: "fake"})
+	c.Assert(err, check.IsNil)
+	s.appInstance = provisiontest.NewFakeApp("myapp", "python", 0)
+	s.appInstance.Pool = "pool1"
+	s.p.Provision(s.appInstance)
+	err = s.conn.Apps().Insert(&app.App{
+		Name: s.appInstance.GetName(),
+		Pool: "pool1",
+		CronJobs: []provision.CronJob{
+			{Name: "every-minute", Schedule: "* * * * *", Command: "./every"},
+			{Name: "hourly", Schedule: "0 * * * *", Command: "./hourly", ConcurrencyPolicy: "allow"},
+		},
+	})
+	c.Assert(err, check.IsNil)
+}
+
+func (s *S) TearDownTest(c *check.C) {
+	app.GetAppRouterUpdater().Shutdown(context.Background())
+	s.conn.Close()
+}
+
+func (s *S) TearDownSuite(c *check.C) {
+	conn, err := db.Conn()
+	c.Assert(err, check.IsNil)
+	defer conn.Close()
+	dbtest.ClearAllCollections(conn.Apps().Database)
+}
+
+func (s *S) runOnce(c *check.C, t time.Time) {
+	r := &Runner{}
+	err := r.runOnce(t)
+	c.Assert(err, check.IsNil)
+	r.jobs.Wait()
+}
+
+func (s *S) TestRunOnce(c *check.C) {
+	s.p.PrepareOutput([]byte("done"))
+	s.runOnce(c, time.Date(2018, 3, 1, 10, 5, 20, 0, time.UTC))
+	cmds := s.p.GetCmds("", s.appInstance)
+	c.Assert(cmds, check.HasLen, 1)
+	c.Assert(cmds[0].Cmd, check.Matches, `.*; \./every$`)
+	c.Assert(eventtest.EventDesc{
+		Target:       event.Target{Type: event.TargetTypeCronJob, Value: "myapp/every-minute"},
+		ExtraTargets: []event.ExtraTarget{{Target: event.Target{Type: event.TargetTypeApp, Value: "myapp"}}},
+		Kind:         EventKind,
+		StartCustomData: map[string]interface{}{
+			"job.name":               "every-minute",
+			"job.schedule":           "* * * * *",
+			"job.command":            "./every",
+			"job.concurrency_policy": "forbid",
+			"scheduledat":            time.Date(2018, 3, 1, 10, 5, 0, 0, time.UTC),
+		},
+		LogMatches: `(?s)running cron job "every-minute" scheduled to 2018-03-01T10:05:00Z.*done`,
+	}, eventtest.HasEvent)
+}
+
+func (s *S) TestRunOnceMultipleJobs(c *check.C) {
+	s.p.PrepareOutput([]byte("done"))
+	s.p.PrepareOutput([]byte("done"))
+	s.runOnce(c, time.Date(2018, 3, 1, 10, 0, 0, 0, time.UTC))
+	cmds := s.p.GetCmds("", s.appInstance)
+	c.Assert(cmds, check.HasLen, 2)
+}
+
+func (s *S) TestRunOnceAlreadyScheduled(c *check.C) {
+	s.p.PrepareOutput([]byte("done"))
+	s.runOnce(c, time.Date(2018, 3, 1, 10, 5, 0, 0, time.UTC))
+	s.runOnce(c, time.Date(2018, 3, 1, 10, 5, 30, 0, time.UTC))
+	c.Assert(s.p.GetCmds("", s.appInstance), check.HasLen, 1)
+	s.p.PrepareOutput([]byte("done"))
+	s.runOnce(c, time.Date(2018, 3, 1, 10, 6, 0, 0, time.UTC))
+	c.Assert(s.p.GetCmds("", s.appInstance), check.HasLen, 2)
+}
+
+func (s *S) TestRunOnceFailure(c *check.C) {
+	s.p.PrepareFailure("ExecuteCommandIsolated", errors.New("exit status 1"))
+	s.runOnce(c, time.Date(2018, 3, 1, 10, 5, 0, 0, time.UTC))
+	c.Assert(eventtest.EventDesc{
+		Target:       event.Target{Type: event.TargetTypeCronJob, Value: "myapp/every-minute"},
+		Kind:         EventKind,
+		ErrorMatches: `exit status 1`,
+	}, eventtest.HasEvent)
+}
+
+func (s *S) TestRunOnceForbidConcurrentRuns(c *check.C) {
+	evt, err := event.NewInternal(&event.Opts{
+		Target:       event.Target{Type: event.TargetTypeCronJob, Value: "myapp/every-minute"},
+		InternalKind: EventKind,
+		Allowed:      event.Allowed(permission.PermAppReadEvents),
+	})
+	c.Assert(err, check.IsNil)
+	defer evt.Done(nil)
+	s.runOnce(c, time.Date(2018, 3, 1, 10, 5, 0, 0, time.UTC))
+	c.Assert(s.p.GetCmds("", s.appInstance), check.HasLen, 0)
+}
+
+func (s *S) TestRunOnceAllowConcurrentRuns(c *check.C) {
+	evt, err := event.NewInternal(&event.Opts{
+		Target:       event.Target{Type: event.TargetTypeCronJob, Value: "myapp/hourly"},
+		InternalKind: EventKind,
+		Allowed:      event.Allowed(permission.PermAppReadEvents),
+	})
+	c.Assert(err, check.IsNil)
+	defer evt.Done(nil)
+	s.p.PrepareOutput([]byte("done"))
+	s.p.PrepareOutput([]byte("done"))
+	s.runOnce(c, time.Date(2018, 3, 1, 10, 0, 0, 0, time.UTC))
+	cmds := s.p.GetCmds("", s.appInstance)
+	c.Assert(cmds, check.HasLen, 2)
+}
+
+func (s *S) TestRunOnceImageJobs(c *check.C) {
+	yamlApp := provisiontest.NewFakeApp("yamlapp", "python", 0)
+	yamlApp.Pool = "pool1"
+	s.p.Provision(yamlApp)
+	err := s.conn.Apps().Insert(&app.App{Name: yamlApp.GetName(), Pool: "pool1"})
+	c.Assert(err, check.IsNil)
+	imageName := "tsuru/app-yamlapp:v1"
+	err = image.SaveImageCustomData(imageName, map[string]interface{}{
+		"cron": []provision.CronJob{
+			{Name: "report", Schedule: "* * * * *", Command: "./report"},
+		},
+	})
+	c.Assert(err, check.IsNil)
+	err = image.AppendAppImageName(yamlApp.GetName(), imageName)
+	c.Assert(err, check.IsNil)
+	s.p.PrepareOutput([]byte("done"))
+	s.p.PrepareOutput([]byte("done"))
+	r := &Runner{}
+	err = r.runOnce(time.Date(2018, 3, 1, 10, 5, 0, 0, time.UTC))
+	c.Assert(err, check.IsNil)
+	r.jobs.Wait()
+	cmds := s.p.GetCmds("", yamlApp)
+	c.Assert(cmds, check.HasLen, 1)
+	c.Assert(cmds[0].Cmd, check.Matches, `.*; \./report$`)
+	c.Assert(s.p.GetCmds("", s.appInstance), check.HasLen, 1)
+	c.Assert(r.imageJobs, check.DeepEquals, map[string][]provision.CronJob{
+		imageName: {{Name: "report", Schedule: "* * * * *", Command: "./report"}},
+	})
+}
@@ -13,6 +13,7 @@ package db
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/globalsign/mgo"
 	"github.com/tsuru/config"
@@ -170,6 +171,7 @@ func (s *LogStorage) Logs(appName string) *storage.Collection {
 	}
 	c := s.Collection("logs_" + appName)
 	c.Create(&logCappedInfo)
+	c.EnsureIndex(mgo.Index{Key: []string{"date"}})
 	return c
 }
 
@@ -251,3 +253,108 @@ func (s *Storage) VolumeBinds() *storage.Collection {
 	c := s.Collection("volume_binds")
 	return c
 }
+
+// UnitMetrics returns the collection storing the last metrics reported by
+// each unit. Entries not updated for an hour are removed by MongoDB.
+func (s *Storage) UnitMetrics() *storage.Collection {
+	updatedIndex := mgo.Index{Key: []string{"updatedat"}, ExpireAfter: time.Hour}
+	c := s.Collection("unit_metrics")
+	c.EnsureIndex(updatedIndex)
+	return c
+}
+
+// CronJobSchedules returns the collection storing the last time each app
+// cron job was scheduled to run.
+func (s *Storage) CronJobSchedules() *storage.Collection {
+	return s.Collection("cron_job_schedules")
+}
+
+// ACMEAccounts returns the collection storing the keys of the accounts
+// registered in ACME servers.
+func (s *Storage) ACMEAccounts() *storage.Collection {
+	return s.Collection("acme_accounts")
+}
+
+// ACMECertificates returns the collection storing the state of the
+// certificates obtained through ACME for app cnames.
+func (s *Storage) ACMECertificates() *storage.Collection {
+	return s.Collection("acme_certificates")
+}
+
+// ACMEChallenges returns the collection storing the responses to pending
+// ACME http-01 challenges.
+func (s *Storage) ACMEChallenges() *storage.Collection {
+	return s.Collection("acme_challenges")
+}
+
+// TeamQuotas returns the collection storing the resource limits of teams.
+func (s *Storage) TeamQuotas() *storage.Collection {
+	return s.Collection("team_quotas")
+}
+
+// Webhooks returns the collection storing the webhooks registered by teams to
+// be notified of events.
+func (s *Storage) Webhooks() *storage.Collection {
+	return s.Collection("webhooks")
+}
+
+// WebhookDeliveries returns the collection storing the attempts to deliver
+// events to webhooks. Entries older than a week are removed by MongoDB.
+func (s *Storage) WebhookDeliveries() *storage.Collection {
+	webhookIndex := mgo.Index{Key: []string{"webhook", "-time"}}
+	timeIndex := mgo.Index{Key: []string{"time"}, ExpireAfter: 7 * 24 * time.Hour}
+	c := s.Collection("webhook_deliveries")
+	c.EnsureIndex(webhookIndex)
+	c.EnsureIndex(timeIndex)
+	return c
+}
+
+// WebhookPendingDeliveries returns the collection storing the deliveries to
+// webhooks not yet finished, shared by every tsuru API instance. Entries
+// older than a day are removed by MongoDB.
+func (s *Storage) WebhookPendingDeliveries() *storage.Collection {
+	nextAttemptIndex := mgo.Index{Key: []string{"nextattempt"}}
+	webhookIndex := mgo.Index{Key: []string{"webhook"}}
+	createdIndex := mgo.Index{Key: []string{"created"}, ExpireAfter: 24 * time.Hour}
+	c := s.Collection("webhook_pending_deliveries")
+	c.EnsureIndex(nextAttemptIndex)
+	c.EnsureIndex(webhookIndex)
+	c.EnsureIndex(createdIndex)
+	return c
+}
+
+// EventArchives returns the collection storing the id of the directory where
+// expired events are archived, checked by every tsuru API instance.
+func (s *Storage) EventArchives() *storage.Collection {
+	return s.Collection("event_archives")
+}
+
+// DeployUploads returns the GridFS storing the files uploaded in deploys
+// waiting for approval, named after their events.
+func (s *Storage) DeployUploads() *mgo.GridFS {
+	return s.Collection("deploy_uploads").Database.GridFS("deploy_uploads")
+}
+
+var eventsStreamCappedInfo = mgo.CollectionInfo{
+	Capped:   true,
+	MaxBytes: 50 * 1024 * 1024,
+	MaxDocs:  50000,
+}
+
+// EventsStreamSubscribers returns the collection storing the targets of the
+// events streamed by each API instance, so that instances only publish the
+// events someone listens to. Entries not renewed are removed by MongoDB.
+func (s *Storage) EventsStreamSubscribers() *storage.Collection {
+	updatedIndex := mgo.Index{Key: []string{"updated"}, ExpireAfter: 5 * time.Minute}
+	c := s.Collection("events_stream_subscribers")
+	c.EnsureIndex(updatedIndex)
+	return c
+}
+
+// EventsStream returns the capped collection used to broadcast event
+// notifications to the API instances streaming events.
+func (s *Storage) EventsStream() *storage.Collection {
+	c := s.Collection("events_stream")
+	c.Create(&eventsStreamCappedInfo)
+	return c
+}
@@ -185,3 +185,84 @@ func (s *S) TestInstallHosts(c *check.C) {
 	hostsc := strg.Collection("install_hosts")
 	c.Assert(hosts, check.DeepEquals, hostsc)
 }
+
+func (s *S) TestUnitMetrics(c *check.C) {
+	strg, err := Conn()
+	c.Assert(err, check.IsNil)
+	defer strg.Close()
+	metrics := strg.UnitMetrics()
+	metricsc := strg.Collection("unit_metrics")
+	c.Assert(metrics, check.DeepEquals, metricsc)
+}
+
+func (s *S) TestCronJobSchedules(c *check.C) {
+	strg, err := Conn()
+	c.Assert(err, check.IsNil)
+	defer strg.Close()
+	schedules := strg.CronJobSchedules()
+	schedulesc := strg.Collection("cron_job_schedules")
+	c.Assert(schedules, check.DeepEquals, schedulesc)
+}
+
+func (s *S) TestACMEAccounts(c *check.C) {
+	strg, err := Conn()
+	c.Assert(err, check.IsNil)
+	defer strg.Close()
+	accounts := strg.ACMEAccounts()
+	accountsc := strg.Collection("acme_accounts")
+	c.Assert(accounts, check.DeepEquals, accountsc)
+}
+
+func (s *S) TestACMECertificates(c *check.C) {
+	strg, err := Conn()
+	c.Assert(err, check.IsNil)
+	defer strg.Close()
+	certificates := strg.ACMECertificates()
+	certificatesc := strg.Collection("acme_certificates")
+	c.Assert(certificates, check.DeepEquals, certificatesc)
+}
+
+func (s *S) TestACMEChallenges(c *check.C) {
+	strg, err := Conn()
+	c.Assert(err, check.IsNil)
+	defer strg.Close()
+	challenges := strg.ACMEChallenges()
+	challengesc := strg.Collection("acme_challenges")
+	c.Assert(challenges, check.DeepEquals, challengesc)
+}
+
+func (s *S) TestTeamQuotas(c *check.C) {
+	strg, err := Conn()
+	c.Assert(err, check.IsNil)
+	defer strg.Close()
+	quotas := strg.TeamQuotas()
+	quotasc := strg.Collection("team_quotas")
+	c.Assert(quotas, check.DeepEquals, quotasc)
+}
+
+func (s *S) TestWebhooks(c *check.C) {
+	strg, err := Conn()
+	c.Assert(err, check.IsNil)
+	defer strg.Close()
+	webhooks := strg.Webhooks()
+	webhooksc := strg.Collection("webhooks")
+	c.Assert(webhooks, check.DeepEquals, webhooksc)
+}
+
+func (s *S) TestWebhookDeliveries(c *check.C) {
+	strg, err := Conn()
+	c.Assert(err, check.IsNil)
+	defer strg.Close()
+	deliveries := strg.WebhookDeliveries()
+	deliveriesc := strg.Collection("webhook_deliveries")
+	c.Assert(deliveries, check.DeepEquals, deliveriesc)
+}
+
+func (s *S) TestEventsStream(c *check.C) {
+	strg, err := Conn()
+	c.Assert(err, check.IsNil)
+	defer strg.Close()
+	stream := strg.EventsStream()
+	streamc := strg.Collection("events_stream")
+	c.Assert(stream, check.DeepEquals, streamc)
+}
@@ -0,0 +1,243 @@
+// Copyright 2018 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package event
+
+import (
+	"time"
+
+	"github.com/globalsign/mgo"
+	"github.com/globalsign/mgo/bson"
+	"github.com/pkg/errors"
+	"github.com/tsuru/tsuru/db"
+	"github.com/tsuru/tsuru/db/storage"
+	"github.com/tsuru/tsuru/log"
+)
+
+var (
+	ErrNotPendingApproval = errors.New("event is not pending approval")
+	ErrApprovalByOwner    = errors.New("event must be approved by someone other than its owner")
+	ErrApprovalExpired    = errors.New("event approval expired")
+	ErrApprovalCanceled   = errors.New("event canceled while pending approval")
+)
+
+// approvalInfo describes the approval of an event. Lock reports whether the
+// event released the lock of its target while pending, taking it back when
+// approved.
+type approvalInfo struct {
+	Pending    bool
+	Approved   bool
+	Lock       bool
+	Owner      string
+	Reason     string
+	StartTime  time.Time
+	ExpireTime time.Time
+	AckTime    time.Time
+}
+
+// QueueApproval puts the running event in the pending approval state, until
+// a user with the allowed permission approves it, it expires after timeout
+// or it is canceled. The event releases the lock of its target while
+// pending, being stored by its unique id, and must not be marked as done by
+// the caller: Approve resumes it and expiration or cancellation finish it.
+func (e *Event) QueueApproval(allowed AllowedPermission, timeout time.Duration) error {
+	if !e.Running || e.ApprovalInfo.Pending {
+		return ErrNotPendingApproval
+	}
+	if allowed.Scheme == "" && len(allowed.Contexts) == 0 {
+		return ErrNoAllowed
+	}
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	coll := conn.Events()
+	var current eventData
+	err = coll.FindId(e.ID).One(&current)
+	if err != nil {
+		return err
+	}
+	now := time.Now().UTC()
+	data := e.eventData
+	data.OtherCustomData = current.OtherCustomData
+	data.CancelInfo = current.CancelInfo
+	data.ApprovalInfo = approvalInfo{
+		Pending:    true,
+		Lock:       len(e.ID.ObjId) == 0,
+		StartTime:  now,
+		ExpireTime: now.Add(timeout),
+	}
+	data.AllowedApprove = allowed
+	if e.logBuffer != nil {
+		data.Log = e.logBuffer.String()
+	}
+	if !data.ApprovalInfo.Lock {
+		err = coll.UpdateId(e.ID, data)
+		if err != nil {
+			return err
+		}
+		updater.remove(e.ID)
+		eventCurrent.WithLabelValues(e.Kind.Name).Dec()
+		e.eventData = data
+		return nil
+	}
+	data.ID = eventID{ObjId: e.UniqueID}
+	err = coll.Insert(data)
+	if err != nil {
+		return err
+	}
+	updater.remove(e.ID)
+	eventCurrent.WithLabelValues(e.Kind.Name).Dec()
+	err = coll.RemoveId(e.ID)
+	if err != nil && err != mgo.ErrNotFound {
+		log.Errorf("[events] unable to release lock of event %s pending approval: %s", e.UniqueID.Hex(), err)
+	}
+	e.eventData = data
+	return nil
+}
+
+// Approve approves the event pending approval on behalf of owner, who must
+// not be the owner of the event, taking back the lock of its target. It
+// returns ErrEventLocked, keeping the event pending, when another event holds
+// the lock.
+func (e *Event) Approve(reason, owner string) error {
+	if !e.Running || !e.ApprovalInfo.Pending {
+		return ErrNotPendingApproval
+	}
+	if e.Owner.Name == owner {
+		return ErrApprovalByOwner
+	}
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	coll := conn.Events()
+	now := time.Now().UTC()
+	data := e.eventData
+	data.ApprovalInfo.Pending = false
+	data.ApprovalInfo.Approved = true
+	data.ApprovalInfo.Owner = owner
+	data.ApprovalInfo.Reason = reason
+	data.ApprovalInfo.AckTime = now
+	data.LockUpdateTime = now
+	if data.ApprovalInfo.Lock {
+		data.ID = eventID{Target: e.Target}
+		err = lockApproved(coll, &data)
+		if err != nil {
+			return err
+		}
+		err = coll.Remove(bson.M{"_id": e.ID, "approvalinfo.pending": true})
+	} else {
+		err = coll.Update(bson.M{"_id": e.ID, "approvalinfo.pending": true}, data)
+	}
+	if err != nil {
+		if data.ApprovalInfo.Lock {
+			coll.RemoveId(data.ID)
+		}
+		if err == mgo.ErrNotFound {
+			if _, errID := GetByID(e.UniqueID); errID == ErrEventNotFound {
+				return ErrEventNotFound
+			}
+			return ErrNotPendingApproval
+		}
+		return err
+	}
+	e.eventData = data
+	e.restoreLog()
+	updater.add(e.ID)
+	eventCurrent.WithLabelValues(e.Kind.Name).Inc()
+	return nil
+}
+
+// lockApproved stores the approved event with the lock of its target,
+// failing with ErrEventLocked when another event holds it.
+func lockApproved(coll *storage.Collection, data *eventData) error {
+	err := coll.Insert(data)
+	if mgo.IsDup(err) && checkIsExpired(coll, data.ID) {
+		err = coll.Insert(data)
+	}
+	if mgo.IsDup(err) {
+		var existing Event
+		err = coll.FindId(data.ID).One(&existing.eventData)
+		if err == nil {
+			return ErrEventLocked{event: &existing}
+		}
+	}
+	if err != nil {
+		return err
+	}
+	evt := Event{eventData: *data}
+	err = checkLocked(&evt, false)
+	if err != nil {
+		coll.RemoveId(data.ID)
+	}
+	return err
+}
+
+// finishPendingApproval leaves the pending approval state, marking the event
+// as done with reason. Concurrent approvals, cancellations and expirations
+// are decided by the first one leaving the pending state.
+func (e *Event) finishPendingApproval(reason error, update bson.M) error {
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	set := bson.M{
+		"approvalinfo.pending": false,
+		"approvalinfo.acktime": time.Now().UTC(),
+	}
+	for k, v := range update {
+		set[k] = v
+	}
+	_, err = conn.Events().Find(bson.M{"_id": e.ID, "approvalinfo.pending": true}).Apply(mgo.Change{
+		Update:    bson.M{"$set": set},
+		ReturnNew: true,
+	}, &e.eventData)
+	if err == mgo.ErrNotFound {
+		return ErrNotPendingApproval
+	}
+	if err != nil {
+		return err
+	}
+	e.restoreLog()
+	eventCurrent.WithLabelValues(e.Kind.Name).Inc()
+	return e.Done(reason)
+}
+
+// restoreLog fills the log buffer of an event loaded from the database with
+// the log stored so far, which is replaced by the buffer when it is done.
+func (e *Event) restoreLog() {
+	e.logBuffer = nil
+	e.Init()
+	e.logBuffer.WriteString(e.Log)
+}
+
+// expireApprovals marks the events pending approval for longer than their
+// timeouts as done with ErrApprovalExpired.
+func expireApprovals(now time.Time) error {
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	var allData []eventData
+	err = conn.Events().Find(bson.M{
+		"approvalinfo.pending":    true,
+		"approvalinfo.expiretime": bson.M{"$lt": now},
+	}).All(&allData)
+	conn.Close()
+	if err != nil {
+		return err
+	}
+	for _, data := range allData {
+		evt := Event{eventData: data}
+		err = evt.finishPendingApproval(ErrApprovalExpired, nil)
+		if err != nil && err != ErrNotPendingApproval {
+			log.Errorf("[events] [approval expiration] error expiring event %s: %v", evt.UniqueID.Hex(), err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,191 @@
+// Copyright 2018 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package event
+
+import (
+	"time"
+
+	"github.com/globalsign/mgo/bson"
+	"github.com/tsuru/tsuru/db"
+	"github.com/tsuru/tsuru/permission"
+	"gopkg.in/check.v1"
+)
+
+func (s *S) newApprovalEvent(c *check.C, timeout time.Duration) *Event {
+	evt, err := New(&Opts{
+		Target:        Target{Type: "app", Value: "myapp"},
+		Kind:          permission.PermAppDeploy,
+		Owner:         s.token,
+		Cancelable:    true,
+		Allowed:       Allowed(permission.PermAppReadEvents),
+		AllowedCancel: Allowed(permission.PermAppUpdateEvents),
+	})
+	c.Assert(err, check.IsNil)
+	evt.Logf("waiting")
+	err = evt.QueueApproval(Allowed(permission.PermAppApproveDeploy, permission.Context(permission.CtxApp, "myapp")), timeout)
+	c.Assert(err, check.IsNil)
+	return evt
+}
+
+func (s *S) TestQueueApproval(c *check.C) {
+	evt := s.newApprovalEvent(c, time.Minute)
+	c.Assert(evt.ApprovalInfo.Pending, check.Equals, true)
+	c.Assert(evt.ApprovalInfo.Lock, check.Equals, true)
+	evts, err := List(&Filter{PendingOnly: true})
+	c.Assert(err, check.IsNil)
+	c.Assert(evts, check.HasLen, 1)
+	c.Assert(evts[0].UniqueID, check.Equals, evt.UniqueID)
+	c.Assert(evts[0].Running, check.Equals, true)
+	c.Assert(evts[0].Log, check.Equals, "waiting\n")
+	c.Assert(evts[0].ApprovalInfo.Pending, check.Equals, true)
+	c.Assert(evts[0].ApprovalInfo.StartTime.IsZero(), check.Equals, false)
+	c.Assert(evts[0].ApprovalInfo.ExpireTime.Sub(evts[0].ApprovalInfo.StartTime), check.Equals, time.Minute)
+	c.Assert(evts[0].AllowedApprove, check.DeepEquals, Allowed(permission.PermAppApproveDeploy, permission.Context(permission.CtxApp, "myapp")))
+	other, err := New(&Opts{
+		Target:  Target{Type: "app", Value: "myapp"},
+		Kind:    permission.PermAppUpdateEnvSet,
+		Owner:   s.token,
+		Allowed: Allowed(permission.PermAppReadEvents),
+	})
+	c.Assert(err, check.IsNil)
+	err = other.Done(nil)
+	c.Assert(err, check.IsNil)
+}
+
+func (s *S) TestQueueApprovalNotRunning(c *check.C) {
+	evt, err := New(&Opts{
+		Target:  Target{Type: "app", Value: "myapp"},
+		Kind:    permission.PermAppDeploy,
+		Owner:   s.token,
+		Allowed: Allowed(permission.PermAppReadEvents),
+	})
+	c.Assert(err, check.IsNil)
+	err = evt.Done(nil)
+	c.Assert(err, check.IsNil)
+	err = evt.QueueApproval(Allowed(permission.PermAppApproveDeploy), time.Minute)
+	c.Assert(err, check.Equals, ErrNotPendingApproval)
+}
+
+func (s *S) TestApprove(c *check.C) {
+	evt := s.newApprovalEvent(c, time.Minute)
+	other, err := GetByID(evt.UniqueID)
+	c.Assert(err, check.IsNil)
+	err = other.Approve("", "me@me.com")
+	c.Assert(err, check.Equals, ErrApprovalByOwner)
+	err = other.Approve("reviewed", "admin@admin.com")
+	c.Assert(err, check.IsNil)
+	c.Assert(other.ApprovalInfo.Approved, check.Equals, true)
+	c.Assert(other.ApprovalInfo.Pending, check.Equals, false)
+	c.Assert(other.ApprovalInfo.Owner, check.Equals, "admin@admin.com")
+	c.Assert(other.ApprovalInfo.Reason, check.Equals, "reviewed")
+	c.Assert(other.ApprovalInfo.AckTime.IsZero(), check.Equals, false)
+	_, err = New(&Opts{
+		Target:  Target{Type: "app", Value: "myapp"},
+		Kind:    permission.PermAppUpdateEnvSet,
+		Owner:   s.token,
+		Allowed: Allowed(permission.PermAppReadEvents),
+	})
+	c.Assert(err, check.FitsTypeOf, ErrEventLocked{})
+	evt.ApprovalInfo.Pending = true
+	err = evt.Approve("again", "other@admin.com")
+	c.Assert(err, check.FitsTypeOf, ErrEventLocked{})
+	other.Logf("deploying")
+	err = other.Done(nil)
+	c.Assert(err, check.IsNil)
+	evts, err := All()
+	c.Assert(err, check.IsNil)
+	c.Assert(evts, check.HasLen, 1)
+	c.Assert(evts[0].Running, check.Equals, false)
+	c.Assert(evts[0].Log, check.Equals, "waiting\ndeploying\n")
+	c.Assert(evts[0].ApprovalInfo.Approved, check.Equals, true)
+	c.Assert(evts[0].ApprovalInfo.Owner, check.Equals, "admin@admin.com")
+}
+
+func (s *S) TestApproveLocked(c *check.C) {
+	evt := s.newApprovalEvent(c, time.Minute)
+	locker, err := New(&Opts{
+		Target:  Target{Type: "app", Value: "myapp"},
+		Kind:    permission.PermAppUpdateEnvSet,
+		Owner:   s.token,
+		Allowed: Allowed(permission.PermAppReadEvents),
+	})
+	c.Assert(err, check.IsNil)
+	err = evt.Approve("", "admin@admin.com")
+	c.Assert(err, check.FitsTypeOf, ErrEventLocked{})
+	dbEvt, err := GetByID(evt.UniqueID)
+	c.Assert(err, check.IsNil)
+	c.Assert(dbEvt.ApprovalInfo.Pending, check.Equals, true)
+	err = locker.Done(nil)
+	c.Assert(err, check.IsNil)
+	err = evt.Approve("", "admin@admin.com")
+	c.Assert(err, check.IsNil)
+	err = evt.Done(nil)
+	c.Assert(err, check.IsNil)
+}
+
+func (s *S) TestApproveNotPending(c *check.C) {
+	evt, err := New(&Opts{
+		Target:  Target{Type: "app", Value: "myapp"},
+		Kind:    permission.PermAppDeploy,
+		Owner:   s.token,
+		Allowed: Allowed(permission.PermAppReadEvents),
+	})
+	c.Assert(err, check.IsNil)
+	err = evt.Approve("", "admin@admin.com")
+	c.Assert(err, check.Equals, ErrNotPendingApproval)
+}
+
+func (s *S) TestApprovalCanceled(c *check.C) {
+	evt := s.newApprovalEvent(c, time.Minute)
+	other, err := GetByID(evt.UniqueID)
+	c.Assert(err, check.IsNil)
+	err = other.TryCancel("not today", "admin@admin.com")
+	c.Assert(err, check.IsNil)
+	dbEvt, err := GetByID(evt.UniqueID)
+	c.Assert(err, check.IsNil)
+	c.Assert(dbEvt.Running, check.Equals, false)
+	c.Assert(dbEvt.Error, check.Equals, ErrApprovalCanceled.Error())
+	c.Assert(dbEvt.Log, check.Equals, "waiting\n")
+	c.Assert(dbEvt.ApprovalInfo.Pending, check.Equals, false)
+	c.Assert(dbEvt.CancelInfo.Canceled, check.Equals, true)
+	c.Assert(dbEvt.CancelInfo.Owner, check.Equals, "admin@admin.com")
+	err = evt.Approve("", "admin@admin.com")
+	c.Assert(err, check.Equals, ErrNotPendingApproval)
+}
+
+func (s *S) TestExpireApprovals(c *check.C) {
+	evt := s.newApprovalEvent(c, time.Minute)
+	err := expireApprovals(time.Now().UTC())
+	c.Assert(err, check.IsNil)
+	dbEvt, err := GetByID(evt.UniqueID)
+	c.Assert(err, check.IsNil)
+	c.Assert(dbEvt.Running, check.Equals, true)
+	c.Assert(dbEvt.ApprovalInfo.Pending, check.Equals, true)
+	err = expireApprovals(time.Now().UTC().Add(2 * time.Minute))
+	c.Assert(err, check.IsNil)
+	dbEvt, err = GetByID(evt.UniqueID)
+	c.Assert(err, check.IsNil)
+	c.Assert(dbEvt.Running, check.Equals, false)
+	c.Assert(dbEvt.Error, check.Equals, ErrApprovalExpired.Error())
+	c.Assert(dbEvt.ApprovalInfo.Pending, check.Equals, false)
+	err = evt.Approve("", "admin@admin.com")
+	c.Assert(err, check.Equals, ErrNotPendingApproval)
+}
+
+func (s *S) TestCleanerKeepsPendingApprovals(c *check.C) {
+	evt := s.newApprovalEvent(c, time.Hour)
+	conn, err := db.Conn()
+	c.Assert(err, check.IsNil)
+	defer conn.Close()
+	err = conn.Events().UpdateId(evt.ID, bson.M{"$set": bson.M{"lockupdatetime": time.Now().UTC().Add(-time.Hour)}})
+	c.Assert(err, check.IsNil)
+	cleaner := eventCleaner{}
+	err = cleaner.tryCleaning()
+	c.Assert(err, check.IsNil)
+	dbEvt, err := GetByID(evt.UniqueID)
+	c.Assert(err, check.IsNil)
+	c.Assert(dbEvt.Running, check.Equals, true)
+	c.Assert(dbEvt.ApprovalInfo.Pending, check.Equals, true)
+}
@@ -12,9 +12,15 @@ import (
 	"github.com/globalsign/mgo"
 	"github.com/globalsign/mgo/bson"
 	"github.com/tsuru/tsuru/db"
+	"github.com/tsuru/tsuru/log"
+	"github.com/tsuru/tsuru/permission"
 )
 
-const blockListLimit = 25
+const (
+	EventKindBlockExpired = "event-block-expired"
+
+	blockListLimit = 25
+)
 
 type ErrActiveEventBlockNotFound struct {
 	id string
@@ -38,17 +44,165 @@ func (e ErrEventBlocked) Error() string {
 	)
 }
 
+// Block prevents events matching it from running. Blocks may be scheduled to
+// start and end at given times and restricted to recurring windows, e.g. no
+// deploys to pool prod on fridays after 16:00. Pool and Team match events on
+// resources of the pool or team, like apps, besides the pool or team itself.
 type Block struct {
 	ID        bson.ObjectId `bson:"_id,omitempty"`
 	StartTime time.Time
 	EndTime   time.Time `bson:"endtime,omitempty"`
 	KindName  string
 	OwnerName string
-	Target    Target `bson:"target,omitempty"`
+	Target    Target      `bson:"target,omitempty"`
+	Pool      string      `bson:",omitempty"`
+	Team      string      `bson:",omitempty"`
+	Window    BlockWindow `bson:",omitempty"`
 	Reason    string
 	Active    bool
 }
 
+// BlockWindow restricts a block to the period between Start and End, in the
+// HH:MM format, on the given weekdays, or every day if none is given. A window
+// ending before its start spans midnight and belongs to the day it starts.
+// Times are in the Timezone location, defaulting to UTC.
+type BlockWindow struct {
+	Weekdays []string `form:"-" bson:",omitempty"`
+	Start    string   `bson:",omitempty"`
+	End      string   `bson:",omitempty"`
+	Timezone string   `bson:",omitempty"`
+}
+
+func (w *BlockWindow) IsZero() bool {
+	return len(w.Weekdays) == 0 && w.Start == "" && w.End == "" && w.Timezone == ""
+}
+
+func (w *BlockWindow) LoadWeekdays(form map[string][]string) {
+	for k, values := range form {
+		if strings.ToLower(k) != "window.weekdays" {
+			continue
+		}
+		for _, val := range values {
+			if val != "" {
+				w.Weekdays = append(w.Weekdays, strings.ToLower(val))
+			}
+		}
+	}
+}
+
+func (w *BlockWindow) validate() error {
+	if w.IsZero() {
+		return nil
+	}
+	for _, day := range w.Weekdays {
+		if _, ok := parseWeekday(day); !ok {
+			return ErrValidation(fmt.Sprintf("invalid weekday %q in block window", day))
+		}
+	}
+	start, ok := parseClock(w.Start, 0)
+	if !ok {
+		return ErrValidation(fmt.Sprintf("invalid start %q in block window, it must be in the HH:MM format", w.Start))
+	}
+	end, ok := parseClock(w.End, 24*60)
+	if !ok {
+		return ErrValidation(fmt.Sprintf("invalid end %q in block window, it must be in the HH:MM format", w.End))
+	}
+	if start == end {
+		return ErrValidation("block window start and end must be different")
+	}
+	_, err := time.LoadLocation(w.Timezone)
+	if err != nil {
+		return ErrValidation(fmt.Sprintf("invalid timezone %q in block window", w.Timezone))
+	}
+	return nil
+}
+
+// Contains reports whether t is inside one of the periods of the window.
+func (w *BlockWindow) Contains(t time.Time) bool {
+	if w.IsZero() {
+		return true
+	}
+	loc, err := time.LoadLocation(w.Timezone)
+	if err != nil {
+		return false
+	}
+	start, _ := parseClock(w.Start, 0)
+	end, _ := parseClock(w.End, 24*60)
+	t = t.In(loc)
+	minute := t.Hour()*60 + t.Minute()
+	day := t.Weekday()
+	if start < end {
+		if minute < start || minute >= end {
+			return false
+		}
+	} else {
+		if minute < start && minute >= end {
+			return false
+		}
+		if minute < end {
+			day = (day + 6) % 7
+		}
+	}
+	if len(w.Weekdays) == 0 {
+		return true
+	}
+	for _, name := range w.Weekdays {
+		if d, _ := parseWeekday(name); d == day {
+			return true
+		}
+	}
+	return false
+}
+
+func parseWeekday(name string) (time.Weekday, bool) {
+	for d := time.Sunday; d <= time.Saturday; d++ {
+		if strings.EqualFold(d.String(), name) {
+			return d, true
+		}
+	}
+	return 0, false
+}
+
+// parseClock returns the minutes since midnight of a HH:MM value, using
+// defaultValue for empty values. 24:00 is accepted as the end of the day.
+func parseClock(value string, defaultValue int) (int, bool) {
+	if value == "" {
+		return defaultValue, true
+	}
+	var hour, minute int
+	n, err := fmt.Sscanf(value, "%d:%d", &hour, &minute)
+	if err != nil || n != 2 || len(value) != 5 {
+		return 0, false
+	}
+	if hour < 0 || minute < 0 || minute > 59 || hour > 24 || (hour == 24 && minute != 0) {
+		return 0, false
+	}
+	return hour*60 + minute, true
+}
+
+// Validate checks the schedule of the block.
+func (b *Block) Validate() error {
+	start := b.StartTime
+	if start.IsZero() {
+		start = time.Now()
+	}
+	if !b.EndTime.IsZero() && !b.EndTime.After(start) {
+		return ErrValidation("block end time must be after its start time")
+	}
+	return b.Window.validate()
+}
+
+// ActiveAt reports whether the block is in effect at time t.
+func (b *Block) ActiveAt(t time.Time) bool {
+	if !b.Active || t.Before(b.StartTime) {
+		return false
+	}
+	if !b.EndTime.IsZero() && !t.Before(b.EndTime) {
+		return false
+	}
+	return b.Window.Contains(t)
+}
+
 func (b *Block) Blocks(e *Event) bool {
 	if !(strings.HasPrefix(e.Kind.Name, b.KindName) || b.KindName == "") {
 		return false
@@ -59,9 +213,34 @@ func (b *Block) Blocks(e *Event) bool {
 	if !(e.Target == b.Target || b.Target == Target{} || (b.Target.Type == e.Target.Type && b.Target.Value == "")) {
 		return false
 	}
+	if b.Pool != "" && !e.relatedTo(Target{Type: TargetTypePool, Value: b.Pool}, permission.Context(permission.CtxPool, b.Pool)) {
+		return false
+	}
+	if b.Team != "" && !e.relatedTo(Target{Type: TargetTypeTeam, Value: b.Team}, permission.Context(permission.CtxTeam, b.Team)) {
+		return false
+	}
 	return true
 }
 
+// relatedTo reports whether the event targets the resource or is allowed in
+// its context.
+func (e *Event) relatedTo(target Target, context permission.PermissionContext) bool {
+	if e.Target == target {
+		return true
+	}
+	for _, et := range e.ExtraTargets {
+		if et.Target == target {
+			return true
+		}
+	}
+	for _, ctx := range e.Allowed.Contexts {
+		if ctx == context {
+			return true
+		}
+	}
+	return false
+}
+
 func (b *Block) String() string {
 	kind := b.KindName
 	if kind == "" {
@@ -75,10 +254,46 @@ func (b *Block) String() string {
 	if b.Target.Type != "" {
 		target = b.Target.String()
 	}
+	if b.Pool != "" {
+		target += fmt.Sprintf(" in pool %s", b.Pool)
+	}
+	if b.Team != "" {
+		target += fmt.Sprintf(" of team %s", b.Team)
+	}
+	if !b.Window.IsZero() {
+		target += fmt.Sprintf(" (%s)", &b.Window)
+	}
 	return fmt.Sprintf("block %s by %s on %s: %s", kind, owner, target, b.Reason)
 }
 
+func (w *BlockWindow) String() string {
+	days := "every day"
+	if len(w.Weekdays) > 0 {
+		days = "on " + strings.Join(w.Weekdays, ", ")
+	}
+	start, end, tz := w.Start, w.End, w.Timezone
+	if start == "" {
+		start = "00:00"
+	}
+	if end == "" {
+		end = "24:00"
+	}
+	if tz == "" {
+		tz = "UTC"
+	}
+	return fmt.Sprintf("%s from %s to %s %s", days, start, end, tz)
+}
+
+// AddBlock activates the block, starting it immediately unless a start time
+// is set.
 func AddBlock(b *Block) error {
+	if b.StartTime.IsZero() {
+		b.StartTime = time.Now()
+	}
+	err := b.Validate()
+	if err != nil {
+		return err
+	}
 	conn, err := db.Conn()
 	if err != nil {
 		return err
@@ -86,7 +301,6 @@ func AddBlock(b *Block) error {
 	defer conn.Close()
 	b.Active = true
 	b.ID = bson.NewObjectId()
-	b.StartTime = time.Now()
 	return conn.EventBlocks().Insert(b)
 }
 
@@ -130,14 +344,60 @@ func checkIsBlocked(evt *Event) error {
 	if evt.Target.Type == TargetTypeEventBlock {
 		return nil
 	}
-	blocks, err := listBlocks(bson.M{"active": true})
+	conn, err := db.Conn()
 	if err != nil {
 		return err
 	}
+	defer conn.Close()
+	var blocks []Block
+	err = conn.EventBlocks().Find(bson.M{"active": true}).Sort("-starttime").All(&blocks)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
 	for _, b := range blocks {
-		if b.Blocks(evt) {
+		if b.ActiveAt(now) && b.Blocks(evt) {
 			return ErrEventBlocked{event: evt, block: &b}
 		}
 	}
 	return nil
 }
+
+// expireBlocks deactivates the blocks past their end time, creating an event
+// for each one.
+func expireBlocks(now time.Time) error {
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	var blocks []Block
+	err = conn.EventBlocks().Find(bson.M{"active": true, "endtime": bson.M{"$lte": now}}).All(&blocks)
+	if err != nil {
+		return err
+	}
+	for _, b := range blocks {
+		err = conn.EventBlocks().Update(bson.M{"_id": b.ID, "active": true}, bson.M{"$set": bson.M{"active": false}})
+		if err == mgo.ErrNotFound {
+			// removed or expired by another tsuru API instance
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		b.Active = false
+		evt, err := NewInternal(&Opts{
+			Target:       Target{Type: TargetTypeEventBlock, Value: b.ID.Hex()},
+			InternalKind: EventKindBlockExpired,
+			CustomData:   b,
+			Allowed:      Allowed(permission.PermEventBlockReadEvents),
+		})
+		if err != nil {
+			log.Errorf("[events] [block expiration] error creating event for expired block %s: %s", b.ID.Hex(), err)
+			continue
+		}
+		evt.Logf("%s expired at %s", b.String(), b.EndTime.Format(time.RFC3339))
+		evt.Done(nil)
+	}
+	return nil
+}
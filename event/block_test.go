@@ -6,9 +6,13 @@ package event
 
 import (
 	"reflect"
+	"regexp"
+	"strings"
 	"time"
 
 	"github.com/globalsign/mgo/bson"
+	"github.com/tsuru/tsuru/db"
+	"github.com/tsuru/tsuru/permission"
 	check "gopkg.in/check.v1"
 )
 
@@ -117,3 +121,156 @@ func (s *S) TestCheckIsBlocked(c *check.C) {
 		}
 	}
 }
+
+func (s *S) TestAddBlockInvalidSchedule(c *check.C) {
+	now := time.Now()
+	tt := []struct {
+		block *Block
+		err   string
+	}{
+		{&Block{EndTime: now.Add(-time.Hour)}, "block end time must be after its start time"},
+		{&Block{StartTime: now.Add(time.Hour), EndTime: now}, "block end time must be after its start time"},
+		{&Block{Window: BlockWindow{Weekdays: []string{"funday"}}}, `invalid weekday "funday" in block window`},
+		{&Block{Window: BlockWindow{Start: "4pm"}}, `invalid start "4pm" in block window, it must be in the HH:MM format`},
+		{&Block{Window: BlockWindow{End: "24:30"}}, `invalid end "24:30" in block window, it must be in the HH:MM format`},
+		{&Block{Window: BlockWindow{Start: "10:00", End: "10:00"}}, "block window start and end must be different"},
+		{&Block{Window: BlockWindow{Timezone: "Mars/Olympus"}}, `invalid timezone "Mars/Olympus" in block window`},
+	}
+	for i, t := range tt {
+		err := AddBlock(t.block)
+		c.Assert(err, check.ErrorMatches, regexp.QuoteMeta(t.err), check.Commentf("test %d", i))
+	}
+	blocks, err := listBlocks(nil)
+	c.Assert(err, check.IsNil)
+	c.Assert(blocks, check.HasLen, 0)
+}
+
+func (s *S) TestBlockWindowContains(c *check.C) {
+	// 2018-06-15 is a friday
+	at := func(day, hour, minute int) time.Time {
+		return time.Date(2018, 6, day, hour, minute, 0, 0, time.UTC)
+	}
+	tt := []struct {
+		window   BlockWindow
+		t        time.Time
+		expected bool
+	}{
+		{BlockWindow{}, at(15, 10, 0), true},
+		{BlockWindow{Weekdays: []string{"friday"}}, at(15, 10, 0), true},
+		{BlockWindow{Weekdays: []string{"Friday"}}, at(14, 10, 0), false},
+		{BlockWindow{Weekdays: []string{"friday"}, Start: "16:00"}, at(15, 15, 59), false},
+		{BlockWindow{Weekdays: []string{"friday"}, Start: "16:00"}, at(15, 16, 0), true},
+		{BlockWindow{Weekdays: []string{"friday"}, Start: "16:00"}, at(15, 23, 59), true},
+		{BlockWindow{Weekdays: []string{"friday"}, Start: "16:00"}, at(16, 0, 0), false},
+		{BlockWindow{Start: "09:00", End: "18:00"}, at(15, 18, 0), false},
+		{BlockWindow{Weekdays: []string{"friday"}, Start: "22:00", End: "06:00"}, at(15, 23, 0), true},
+		{BlockWindow{Weekdays: []string{"friday"}, Start: "22:00", End: "06:00"}, at(16, 5, 59), true},
+		{BlockWindow{Weekdays: []string{"friday"}, Start: "22:00", End: "06:00"}, at(16, 6, 0), false},
+		{BlockWindow{Weekdays: []string{"friday"}, Start: "22:00", End: "06:00"}, at(15, 5, 0), false},
+		{BlockWindow{Start: "16:00", Timezone: "America/Sao_Paulo"}, at(15, 18, 59), false},
+		{BlockWindow{Start: "16:00", Timezone: "America/Sao_Paulo"}, at(15, 19, 0), true},
+	}
+	for i, t := range tt {
+		c.Assert(t.window.Contains(t.t), check.Equals, t.expected, check.Commentf("test %d: %s at %s", i, &t.window, t.t))
+	}
+}
+
+func (s *S) TestCheckIsBlockedScheduled(c *check.C) {
+	now := time.Now()
+	future := &Block{KindName: "app.deploy", StartTime: now.Add(time.Hour), Reason: "future"}
+	err := AddBlock(future)
+	c.Assert(err, check.IsNil)
+	evt := &Event{eventData: eventData{Kind: Kind{Name: "app.deploy"}}}
+	c.Assert(checkIsBlocked(evt), check.IsNil)
+	ended := &Block{KindName: "app.deploy", StartTime: now.Add(-time.Hour), EndTime: now.Add(time.Second), Reason: "ended"}
+	err = AddBlock(ended)
+	c.Assert(err, check.IsNil)
+	conn, err := db.Conn()
+	c.Assert(err, check.IsNil)
+	defer conn.Close()
+	err = conn.EventBlocks().UpdateId(ended.ID, bson.M{"$set": bson.M{"endtime": now.Add(-time.Minute)}})
+	c.Assert(err, check.IsNil)
+	c.Assert(checkIsBlocked(evt), check.IsNil)
+	current := &Block{KindName: "app.deploy", StartTime: now.Add(-time.Minute), EndTime: now.Add(time.Hour), Reason: "current"}
+	err = AddBlock(current)
+	c.Assert(err, check.IsNil)
+	errBlock := checkIsBlocked(evt)
+	c.Assert(errBlock, check.FitsTypeOf, ErrEventBlocked{})
+	c.Assert(errBlock.(ErrEventBlocked).block.ID, check.Equals, current.ID)
+}
+
+func (s *S) TestCheckIsBlockedWindow(c *check.C) {
+	now := time.Now().UTC()
+	outside := now.Add(2 * time.Hour).Format("15:04")
+	block := &Block{KindName: "app.deploy", Window: BlockWindow{Start: outside, End: now.Add(3 * time.Hour).Format("15:04")}, Reason: "window"}
+	err := AddBlock(block)
+	c.Assert(err, check.IsNil)
+	evt := &Event{eventData: eventData{Kind: Kind{Name: "app.deploy"}}}
+	c.Assert(checkIsBlocked(evt), check.IsNil)
+	block = &Block{KindName: "app.deploy", Window: BlockWindow{Weekdays: []string{strings.ToLower(now.Weekday().String())}}, Reason: "window"}
+	err = AddBlock(block)
+	c.Assert(err, check.IsNil)
+	c.Assert(checkIsBlocked(evt), check.FitsTypeOf, ErrEventBlocked{})
+}
+
+func (s *S) TestBlockBlocksPoolAndTeam(c *check.C) {
+	poolBlock := &Block{KindName: "app.deploy", Pool: "prod"}
+	teamBlock := &Block{Team: "myteam"}
+	tt := []struct {
+		event *Event
+		pool  bool
+		team  bool
+	}{
+		{&Event{eventData: eventData{Kind: Kind{Name: "app.deploy"}, Target: Target{Type: TargetTypeApp, Value: "myapp"}}}, false, false},
+		{&Event{eventData: eventData{Kind: Kind{Name: "app.deploy"}, Target: Target{Type: TargetTypeApp, Value: "myapp"}, Allowed: Allowed(permission.PermAppReadEvents,
+			permission.Context(permission.CtxApp, "myapp"), permission.Context(permission.CtxTeam, "myteam"), permission.Context(permission.CtxPool, "prod"))}}, true, true},
+		{&Event{eventData: eventData{Kind: Kind{Name: "app.deploy"}, Target: Target{Type: TargetTypeApp, Value: "myapp"}, Allowed: Allowed(permission.PermAppReadEvents,
+			permission.Context(permission.CtxTeam, "otherteam"), permission.Context(permission.CtxPool, "dev"))}}, false, false},
+		{&Event{eventData: eventData{Kind: Kind{Name: "pool.update"}, Target: Target{Type: TargetTypePool, Value: "prod"}}}, false, false},
+		{&Event{eventData: eventData{Kind: Kind{Name: "app.deploy"}, Target: Target{Type: TargetTypePool, Value: "prod"}}}, true, false},
+		{&Event{eventData: eventData{Kind: Kind{Name: "team.update"}, Target: Target{Type: TargetTypeTeam, Value: "myteam"}}}, false, true},
+		{&Event{eventData: eventData{Kind: Kind{Name: "app.update"}, Target: Target{Type: TargetTypeApp, Value: "myapp"},
+			ExtraTargets: []ExtraTarget{{Target: Target{Type: TargetTypeTeam, Value: "myteam"}}}}}, false, true},
+	}
+	for i, t := range tt {
+		c.Assert(poolBlock.Blocks(t.event), check.Equals, t.pool, check.Commentf("test %d", i))
+		c.Assert(teamBlock.Blocks(t.event), check.Equals, t.team, check.Commentf("test %d", i))
+	}
+}
+
+func (s *S) TestExpireBlocks(c *check.C) {
+	now := time.Now()
+	expiring := &Block{KindName: "app.deploy", EndTime: now.Add(time.Minute), Reason: "maintenance"}
+	err := AddBlock(expiring)
+	c.Assert(err, check.IsNil)
+	lasting := &Block{KindName: "app.create", EndTime: now.Add(time.Hour), Reason: "maintenance"}
+	err = AddBlock(lasting)
+	c.Assert(err, check.IsNil)
+	permanent := &Block{KindName: "app.update", Reason: "maintenance"}
+	err = AddBlock(permanent)
+	c.Assert(err, check.IsNil)
+	err = expireBlocks(now.Add(2 * time.Minute))
+	c.Assert(err, check.IsNil)
+	active := true
+	blocks, err := ListBlocks(&active)
+	c.Assert(err, check.IsNil)
+	c.Assert(blocks, check.HasLen, 2)
+	for _, b := range blocks {
+		c.Assert(b.ID, check.Not(check.Equals), expiring.ID)
+	}
+	evts, err := List(&Filter{KindNames: []string{EventKindBlockExpired}})
+	c.Assert(err, check.IsNil)
+	c.Assert(evts, check.HasLen, 1)
+	c.Assert(evts[0].Target, check.Equals, Target{Type: TargetTypeEventBlock, Value: expiring.ID.Hex()})
+	c.Assert(evts[0].Running, check.Equals, false)
+	var data Block
+	err = evts[0].StartData(&data)
+	c.Assert(err, check.IsNil)
+	c.Assert(data.ID, check.Equals, expiring.ID)
+	c.Assert(data.Active, check.Equals, false)
+	err = expireBlocks(now.Add(2 * time.Minute))
+	c.Assert(err, check.IsNil)
+	evts, err = List(&Filter{KindNames: []string{EventKindBlockExpired}})
+	c.Assert(err, check.IsNil)
+	c.Assert(evts, check.HasLen, 1)
+}
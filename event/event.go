@@ -12,6 +12,7 @@ import (
 	"net/url"
 	"reflect"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/globalsign/mgo"
@@ -60,6 +61,8 @@ const (
 
 var (
 	throttlingInfo  = map[string]ThrottlingSpec{}
+	doneListenersMu sync.RWMutex
+	doneListeners   []func(*Event)
 	errInvalidQuery = errors.New("invalid query")
 
 	ErrNotCancelable          = errors.New("event is not cancelable")
@@ -102,6 +105,9 @@ var (
 	TargetTypeEventBlock      = TargetType("event-block")
 	TargetTypeCluster         = TargetType("cluster")
 	TargetTypeVolume          = TargetType("volume")
+	TargetTypeCronJob         = TargetType("cron-job")
+	TargetTypeCertificate     = TargetType("certificate")
+	TargetTypeWebhook         = TargetType("webhook")
 )
 
 const (
@@ -205,6 +211,8 @@ type eventData struct {
 	Running         bool
 	Allowed         AllowedPermission
 	AllowedCancel   AllowedPermission
+	ApprovalInfo    approvalInfo      `bson:",omitempty"`
+	AllowedApprove  AllowedPermission `bson:",omitempty"`
 }
 
 type cancelInfo struct {
@@ -415,6 +423,8 @@ type Filter struct {
 	Running        *bool
 	IncludeRemoved bool
 	ErrorOnly      bool
+	SuccessOnly    bool
+	PendingOnly    bool
 	Raw            bson.M
 	AllowedTargets []TargetFilter
 	Permissions    []permission.Permission
@@ -446,6 +456,80 @@ func (f *Filter) LoadKindNames(form map[string][]string) {
 	}
 }
 
+// Matches reports whether the event e is selected by the target, kind, owner,
+// result and permissions fields of the filter. Other fields are ignored.
+func (f *Filter) Matches(e *Event) bool {
+	if f.Permissions != nil && !f.allows(e) {
+		return false
+	}
+	if f.Target.Type != "" || f.Target.Value != "" {
+		targets := []Target{e.Target}
+		for _, et := range e.ExtraTargets {
+			targets = append(targets, et.Target)
+		}
+		var found bool
+		for _, t := range targets {
+			if (f.Target.Type == "" || f.Target.Type == t.Type) &&
+				(f.Target.Value == "" || f.Target.Value == t.Value) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if f.KindType != "" && f.KindType != e.Kind.Type {
+		return false
+	}
+	if len(f.KindNames) > 0 {
+		var found bool
+		for _, name := range f.KindNames {
+			if name == e.Kind.Name {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if f.OwnerType != "" && f.OwnerType != e.Owner.Type {
+		return false
+	}
+	if f.OwnerName != "" && f.OwnerName != e.Owner.Name {
+		return false
+	}
+	if f.ErrorOnly && e.Error == "" {
+		return false
+	}
+	if f.SuccessOnly && e.Error != "" {
+		return false
+	}
+	if f.PendingOnly && !e.ApprovalInfo.Pending {
+		return false
+	}
+	return true
+}
+
+// allows mirrors the permissions part of the query built by toQuery.
+func (f *Filter) allows(e *Event) bool {
+	for _, p := range f.Permissions {
+		if !strings.HasPrefix(e.Allowed.Scheme, p.Scheme.FullName()) {
+			continue
+		}
+		if p.Context.CtxType == permission.CtxGlobal {
+			return true
+		}
+		for _, ctx := range e.Allowed.Contexts {
+			if ctx == p.Context {
+				return true
+			}
+		}
+	}
+	return false
+}
+
 func (f *Filter) toQuery() (bson.M, error) {
 	query := bson.M{}
 	permMap := map[string][]permission.PermissionContext{}
@@ -541,6 +625,12 @@ func (f *Filter) toQuery() (bson.M, error) {
 	if f.ErrorOnly {
 		query["error"] = bson.M{"$ne": ""}
 	}
+	if f.SuccessOnly {
+		query["error"] = ""
+	}
+	if f.PendingOnly {
+		query["approvalinfo.pending"] = true
+	}
 	if f.Raw != nil {
 		for k, v := range f.Raw {
 			query[k] = v
@@ -663,6 +753,38 @@ func List(filter *Filter) ([]Event, error) {
 	return evts, nil
 }
 
+// Export writes the events matching filter to w as JSON lines, in the format
+// they are stored in the database, oldest first. The limit, skip and sort
+// fields of the filter are ignored. It returns the number of events written.
+func Export(w io.Writer, filter *Filter) (int, error) {
+	query, err := filter.toQuery()
+	if err != nil {
+		if err == errInvalidQuery {
+			return 0, nil
+		}
+		return 0, err
+	}
+	conn, err := db.Conn()
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+	iter := conn.Events().Find(query).Sort("starttime").Iter()
+	encoder := json.NewEncoder(w)
+	var n int
+	var doc bson.M
+	for iter.Next(&doc) {
+		err = encoder.Encode(doc)
+		if err != nil {
+			iter.Close()
+			return n, err
+		}
+		n++
+		doc = nil
+	}
+	return n, iter.Close()
+}
+
 func MarkAsRemoved(target Target) error {
 	conn, err := db.Conn()
 	if err != nil {
@@ -897,6 +1019,7 @@ func newEvt(opts *Opts) (evt *Event, err error) {
 				return nil, err
 			}
 			updater.add(id)
+			evt.publish(StreamMessageTypeStart)
 			return evt, nil
 		}
 		if mgo.IsDup(err) {
@@ -1023,6 +1146,7 @@ func (e *Event) Logf(format string, params ...interface{}) {
 	if e.logBuffer != nil {
 		fmt.Fprintf(e.logBuffer, format, params...)
 	}
+	e.publishLog(fmt.Sprintf(format, params...))
 }
 
 func (e *Event) Write(data []byte) (int, error) {
@@ -1032,6 +1156,7 @@ func (e *Event) Write(data []byte) (int, error) {
 	if e.logBuffer != nil {
 		e.logBuffer.Write(data)
 	}
+	e.publishLog(string(data))
 	return len(data), nil
 }
 
@@ -1061,10 +1186,27 @@ func (e *Event) CancelableContext(ctx context.Context) (context.Context, context
 	return ctx, cancel
 }
 
+// TryCancel asks the running event to be canceled. Events pending approval
+// are canceled right away, as nothing is running them.
 func (e *Event) TryCancel(reason, owner string) error {
 	if !e.Cancelable || !e.Running {
 		return ErrNotCancelable
 	}
+	if e.ApprovalInfo.Pending {
+		now := time.Now().UTC()
+		err := e.finishPendingApproval(ErrApprovalCanceled, bson.M{"cancelinfo": cancelInfo{
+			Owner:     owner,
+			Reason:    reason,
+			StartTime: now,
+			AckTime:   now,
+			Asked:     true,
+			Canceled:  true,
+		}})
+		if err == ErrNotPendingApproval {
+			return ErrNotCancelable
+		}
+		return err
+	}
 	conn, err := db.Conn()
 	if err != nil {
 		return err
@@ -1155,7 +1297,11 @@ func (e *Event) done(evtErr error, customData interface{}, abort bool) (err erro
 	defer conn.Close()
 	coll := conn.Events()
 	if abort {
-		return coll.RemoveId(e.ID)
+		err = coll.RemoveId(e.ID)
+		if err == nil {
+			e.publish(StreamMessageTypeAbort)
+		}
+		return err
 	}
 	if evtErr != nil {
 		e.Error = evtErr.Error()
@@ -1175,13 +1321,37 @@ func (e *Event) done(evtErr error, customData interface{}, abort bool) (err erro
 	err = coll.FindId(e.ID).One(&dbEvt.eventData)
 	if err == nil {
 		e.OtherCustomData = dbEvt.OtherCustomData
+		e.ApprovalInfo = dbEvt.ApprovalInfo
 	}
+	e.ApprovalInfo.Pending = false
 	if len(e.ID.ObjId) != 0 {
-		return coll.UpdateId(e.ID, e.eventData)
+		err = coll.UpdateId(e.ID, e.eventData)
+	} else {
+		defer coll.RemoveId(e.ID)
+		e.ID = eventID{ObjId: e.UniqueID}
+		err = coll.Insert(e.eventData)
+	}
+	if err == nil {
+		e.publish(StreamMessageTypeDone)
+		notifyDone(e)
+	}
+	return err
+}
+
+// AddDoneListener registers a function to be called with each event after it
+// is marked as done. Listeners are called synchronously and must not block.
+func AddDoneListener(fn func(*Event)) {
+	doneListenersMu.Lock()
+	defer doneListenersMu.Unlock()
+	doneListeners = append(doneListeners, fn)
+}
+
+func notifyDone(e *Event) {
+	doneListenersMu.RLock()
+	defer doneListenersMu.RUnlock()
+	for _, fn := range doneListeners {
+		fn(e)
 	}
-	defer coll.RemoveId(e.ID)
-	e.ID = eventID{ObjId: e.UniqueID}
-	return coll.Insert(e.eventData)
 }
 
 func (e *Event) Init() {
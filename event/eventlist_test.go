@@ -5,6 +5,8 @@
 package event_test
 
 import (
+	"bytes"
+	"encoding/json"
 	"errors"
 	"time"
 
@@ -112,6 +114,7 @@ func (s *S) TestListFilterMany(c *check.C) {
 	checkFilters(&event.Filter{Running: boolPtr(false), Sort: "_id"}, allEvts[len(allEvts)-3:len(allEvts)-1])
 	checkFilters(&event.Filter{Running: boolPtr(true), Sort: "_id"}, allEvts[:len(allEvts)-3])
 	checkFilters(&event.Filter{ErrorOnly: true, Sort: "_id"}, allEvts[len(allEvts)-3])
+	checkFilters(&event.Filter{SuccessOnly: true, Running: boolPtr(false), Sort: "_id"}, allEvts[len(allEvts)-2])
 	checkFilters(&event.Filter{Target: event.Target{Type: "app"}, Sort: "_id"}, []*event.Event{allEvts[0], allEvts[1]})
 	checkFilters(&event.Filter{Target: event.Target{Type: "app", Value: "myapp"}}, allEvts[0])
 	checkFilters(&event.Filter{Target: event.Target{Type: "app", Value: "xapp1"}}, allEvts[0])
@@ -165,6 +168,58 @@ func (s *S) TestListFilterMany(c *check.C) {
 	}, Sort: "_id"}, allEvts[:0])
 }
 
+func (s *S) TestFilterMatches(c *check.C) {
+	var done []*event.Event
+	event.AddDoneListener(func(evt *event.Event) {
+		done = append(done, evt)
+	})
+	evt, err := event.New(&event.Opts{
+		Target: event.Target{Type: "app", Value: "myapp"},
+		ExtraTargets: []event.ExtraTarget{
+			{Target: event.Target{Type: "pool", Value: "pool1"}},
+		},
+		Kind:    permission.PermAppDeploy,
+		Owner:   s.token,
+		Allowed: event.Allowed(permission.PermAppReadEvents),
+	})
+	c.Assert(err, check.IsNil)
+	err = evt.Done(errors.New("deploy failed"))
+	c.Assert(err, check.IsNil)
+	c.Assert(done, check.HasLen, 1)
+	c.Assert(done[0].UniqueID, check.Equals, evt.UniqueID)
+	tests := []struct {
+		filter  event.Filter
+		matches bool
+	}{
+		{event.Filter{}, true},
+		{event.Filter{Target: event.Target{Type: "app"}}, true},
+		{event.Filter{Target: event.Target{Type: "app", Value: "myapp"}}, true},
+		{event.Filter{Target: event.Target{Type: "pool", Value: "pool1"}}, true},
+		{event.Filter{Target: event.Target{Type: "app", Value: "pool1"}}, false},
+		{event.Filter{Target: event.Target{Type: "node"}}, false},
+		{event.Filter{KindType: event.KindTypePermission, KindNames: []string{"app.update", "app.deploy"}}, true},
+		{event.Filter{KindType: event.KindTypeInternal}, false},
+		{event.Filter{KindNames: []string{"app.update"}}, false},
+		{event.Filter{OwnerType: event.OwnerTypeUser, OwnerName: s.token.GetUserName()}, true},
+		{event.Filter{OwnerName: "other@me.com"}, false},
+		{event.Filter{ErrorOnly: true}, true},
+		{event.Filter{SuccessOnly: true}, false},
+		{event.Filter{Permissions: []permission.Permission{
+			{Scheme: permission.PermAppRead, Context: permission.Context(permission.CtxGlobal, "")},
+		}}, true},
+		{event.Filter{Permissions: []permission.Permission{
+			{Scheme: permission.PermPoolRead, Context: permission.Context(permission.CtxGlobal, "")},
+		}}, false},
+		{event.Filter{Permissions: []permission.Permission{
+			{Scheme: permission.PermAppRead, Context: permission.Context(permission.CtxApp, "myapp")},
+		}}, false},
+		{event.Filter{Permissions: []permission.Permission{}}, false},
+	}
+	for i, tt := range tests {
+		c.Assert(tt.filter.Matches(evt), check.Equals, tt.matches, check.Commentf("test %d", i))
+	}
+}
+
 func (s *S) TestGetByID(c *check.C) {
 	evt, err := event.New(&event.Opts{
 		Target:  event.Target{Type: "app", Value: "myapp"},
@@ -223,3 +278,31 @@ func (s *S) TestGetKinds(c *check.C) {
 	}
 	c.Assert(kinds, check.DeepEquals, expected)
 }
+
+func (s *S) TestExport(c *check.C) {
+	for _, name := range []string{"app1", "app2"} {
+		evt, err := event.New(&event.Opts{
+			Target:  event.Target{Type: "app", Value: name},
+			Kind:    permission.PermAppDeploy,
+			Owner:   s.token,
+			Allowed: event.Allowed(permission.PermAppReadEvents),
+		})
+		c.Assert(err, check.IsNil)
+		err = evt.Done(nil)
+		c.Assert(err, check.IsNil)
+	}
+	var buf bytes.Buffer
+	n, err := event.Export(&buf, &event.Filter{Target: event.Target{Type: "app", Value: "app2"}})
+	c.Assert(err, check.IsNil)
+	c.Assert(n, check.Equals, 1)
+	var exported map[string]interface{}
+	err = json.Unmarshal(buf.Bytes(), &exported)
+	c.Assert(err, check.IsNil)
+	c.Assert(exported["target"], check.DeepEquals, map[string]interface{}{"type": "app", "value": "app2"})
+	c.Assert(exported["kind"], check.DeepEquals, map[string]interface{}{"type": "permission", "name": "app.deploy"})
+	buf.Reset()
+	n, err = event.Export(&buf, &event.Filter{})
+	c.Assert(err, check.IsNil)
+	c.Assert(n, check.Equals, 2)
+	c.Assert(bytes.Count(buf.Bytes(), []byte("\n")), check.Equals, 2)
+}
@@ -0,0 +1,393 @@
+// Copyright 2018 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package retention periodically removes events older than the retention
+// configured for their kinds, archiving them to compressed JSON lines files
+// before removal. The archive directory must be shared by every tsuru API
+// instance, as any of them may run the removal.
+package retention
+
+import (
+	"compress/gzip"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/globalsign/mgo"
+	"github.com/globalsign/mgo/bson"
+	"github.com/pkg/errors"
+	"github.com/tsuru/config"
+	"github.com/tsuru/tsuru/api/shutdown"
+	internalConfig "github.com/tsuru/tsuru/config"
+	"github.com/tsuru/tsuru/db"
+	"github.com/tsuru/tsuru/event"
+	"github.com/tsuru/tsuru/log"
+	"github.com/tsuru/tsuru/permission"
+)
+
+const (
+	EventKindRetention = "event-retention"
+
+	defaultInterval = time.Hour
+	eventsPerFile   = 5000
+	archiveFileMode = 0640
+	archiveIDFile   = ".tsuru-archive-id"
+	archiveIDKey    = "archive-dir"
+)
+
+var errArchiveDirNotSet = errors.New("event:retention:archive-dir must be set when event retention policies are configured")
+
+// Policy is the number of days events of a kind are kept. A policy without
+// kind name applies to all the kinds without a policy and a policy with zero
+// days keeps events forever.
+type Policy struct {
+	KindName string `json:"kind-name"`
+	Days     int    `json:"days"`
+}
+
+type Archiver struct {
+	policies   []Policy
+	archiveDir string
+	interval   time.Duration
+	done       chan bool
+	running    bool
+}
+
+func newArchiver(policies []Policy) *Archiver {
+	interval := defaultInterval
+	if seconds, _ := config.GetInt("event:retention:interval"); seconds > 0 {
+		interval = time.Duration(seconds) * time.Second
+	}
+	archiveDir, _ := config.GetString("event:retention:archive-dir")
+	return &Archiver{
+		policies:   policies,
+		archiveDir: archiveDir,
+		interval:   interval,
+		done:       make(chan bool),
+	}
+}
+
+func loadPolicies() ([]Policy, error) {
+	var policies []Policy
+	err := internalConfig.UnmarshalConfig("event:retention:policies", &policies)
+	if err != nil {
+		if _, isNotFound := errors.Cause(err).(config.ErrKeyNotFound); isNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+	for _, p := range policies {
+		if p.Days < 0 {
+			return nil, errors.Errorf("invalid retention of %d days for kind %q", p.Days, p.KindName)
+		}
+	}
+	return policies, nil
+}
+
+// Initialize starts the archiver if any retention policy is configured,
+// failing when the archive directory is not set or is not a directory.
+func Initialize() error {
+	policies, err := loadPolicies()
+	if err != nil {
+		return errors.Wrap(err, "unable to load event retention policies")
+	}
+	if len(policies) == 0 {
+		return nil
+	}
+	a := newArchiver(policies)
+	if a.archiveDir == "" {
+		return errArchiveDirNotSet
+	}
+	info, err := os.Stat(a.archiveDir)
+	if err != nil {
+		return errors.Wrap(err, "invalid event:retention:archive-dir")
+	}
+	if !info.IsDir() {
+		return errors.Errorf("invalid event:retention:archive-dir: %q is not a directory", a.archiveDir)
+	}
+	shutdown.Register(a)
+	a.running = true
+	go a.run()
+	return nil
+}
+
+func (a *Archiver) run() {
+	for {
+		select {
+		case <-a.done:
+			return
+		case <-time.After(a.interval):
+		}
+		err := a.runOnce(time.Now().UTC())
+		if err != nil {
+			log.Errorf("[event retention] %s", err)
+		}
+	}
+}
+
+func (a *Archiver) Shutdown(ctx context.Context) error {
+	if !a.running {
+		return nil
+	}
+	a.running = false
+	select {
+	case a.done <- true:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (a *Archiver) String() string {
+	return "event retention archiver"
+}
+
+// queries returns the query selecting the expired events of each policy, by
+// kind name, using an empty kind name for the default policy.
+func (a *Archiver) queries(now time.Time) map[string]bson.M {
+	days := make(map[string]int)
+	for _, p := range a.policies {
+		days[p.KindName] = p.Days
+	}
+	var kinds []string
+	for kind := range days {
+		if kind != "" {
+			kinds = append(kinds, kind)
+		}
+	}
+	sort.Strings(kinds)
+	queries := make(map[string]bson.M)
+	for kind, d := range days {
+		if d == 0 {
+			continue
+		}
+		query := bson.M{
+			"running":   false,
+			"starttime": bson.M{"$lt": now.AddDate(0, 0, -d)},
+		}
+		if kind != "" {
+			query["kind.name"] = kind
+		} else if len(kinds) > 0 {
+			query["kind.name"] = bson.M{"$nin": kinds}
+		}
+		queries[kind] = query
+	}
+	return queries
+}
+
+// runOnce archives and removes the expired events, holding a lock so that
+// a single tsuru API instance runs it at a time.
+func (a *Archiver) runOnce(now time.Time) (retErr error) {
+	defer func() {
+		if rec := recover(); rec != nil {
+			retErr = errors.Errorf("recovered panic, we can never stop! panic: %v", rec)
+		}
+	}()
+	evt, err := event.NewInternal(&event.Opts{
+		Target:       event.Target{Type: event.TargetTypeGlobal, Value: EventKindRetention},
+		InternalKind: EventKindRetention,
+		Allowed:      event.Allowed(permission.PermEventArchiveReadEvents),
+	})
+	if err != nil {
+		if _, ok := err.(event.ErrEventLocked); ok {
+			log.Debugf("[event retention] skipping run, event locked")
+			return nil
+		}
+		return errors.Wrap(err, "error creating event retention event")
+	}
+	var removed []map[string]interface{}
+	defer func() {
+		if len(removed) == 0 && retErr == nil {
+			evt.Abort()
+			return
+		}
+		evt.DoneCustomData(retErr, removed)
+	}()
+	err = a.checkArchiveDir()
+	if err != nil {
+		return err
+	}
+	seq := 0
+	for kind, query := range a.queries(now) {
+		var count int
+		for {
+			var n int
+			n, err = a.expireBatch(query, now, &seq)
+			count += n
+			if err != nil || n < eventsPerFile {
+				break
+			}
+		}
+		if count > 0 {
+			kindName := kind
+			if kindName == "" {
+				kindName = "*"
+			}
+			fmt.Fprintf(evt, "removed %d events of kind %s\n", count, kindName)
+			removed = append(removed, map[string]interface{}{"kind": kindName, "removed": count})
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkArchiveDir makes sure the archive directory is the one used by the
+// other tsuru API instances, comparing the id stored in it with the one
+// stored in the database. The first run stores a new id in both.
+func (a *Archiver) checkArchiveDir() error {
+	if a.archiveDir == "" {
+		return errArchiveDirNotSet
+	}
+	idPath := filepath.Join(a.archiveDir, archiveIDFile)
+	data, err := ioutil.ReadFile(idPath)
+	if err != nil && !os.IsNotExist(err) {
+		return errors.Wrap(err, "unable to read archive id")
+	}
+	dirID := string(data)
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	var stored struct {
+		ID    string `bson:"_id"`
+		Value string
+	}
+	err = conn.EventArchives().FindId(archiveIDKey).One(&stored)
+	if err == mgo.ErrNotFound {
+		if dirID == "" {
+			dirID, err = newArchiveID()
+			if err != nil {
+				return err
+			}
+			err = ioutil.WriteFile(idPath, []byte(dirID), archiveFileMode)
+			if err != nil {
+				return errors.Wrap(err, "unable to write archive id")
+			}
+		}
+		stored.ID, stored.Value = archiveIDKey, dirID
+		err = conn.EventArchives().Insert(stored)
+		if mgo.IsDup(err) {
+			err = conn.EventArchives().FindId(archiveIDKey).One(&stored)
+		}
+	}
+	if err != nil {
+		return err
+	}
+	if stored.Value != dirID {
+		return errors.Errorf("archive dir %q is not the one used by other tsuru API instances, it must be a volume shared by all of them", a.archiveDir)
+	}
+	return nil
+}
+
+func newArchiveID() (string, error) {
+	data := make([]byte, 16)
+	_, err := rand.Read(data)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(data), nil
+}
+
+// expireBatch archives and removes up to eventsPerFile expired events,
+// returning the number of events removed.
+func (a *Archiver) expireBatch(query bson.M, now time.Time, seq *int) (int, error) {
+	conn, err := db.Conn()
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+	coll := conn.Events()
+	iter := coll.Find(query).Sort("starttime").Limit(eventsPerFile).Iter()
+	*seq++
+	name := fmt.Sprintf("events-%s-%d.jsonl.gz", now.Format("20060102T150405Z"), *seq)
+	archive, err := createArchiveFile(filepath.Join(a.archiveDir, name))
+	if err != nil {
+		iter.Close()
+		return 0, err
+	}
+	var ids []interface{}
+	var doc bson.M
+	for iter.Next(&doc) {
+		err = archive.encoder.Encode(doc)
+		if err != nil {
+			iter.Close()
+			archive.discard()
+			return 0, err
+		}
+		ids = append(ids, doc["_id"])
+		doc = nil
+	}
+	err = iter.Close()
+	if err != nil {
+		archive.discard()
+		return 0, err
+	}
+	if len(ids) == 0 {
+		archive.discard()
+		return 0, nil
+	}
+	err = archive.commit()
+	if err != nil {
+		return 0, errors.Wrap(err, "unable to write events archive")
+	}
+	info, err := coll.RemoveAll(bson.M{"_id": bson.M{"$in": ids}})
+	if err != nil {
+		return 0, err
+	}
+	return info.Removed, nil
+}
+
+// archiveFile is a compressed JSON lines file written to a temporary path and
+// renamed when committed, so that incomplete archives are never left behind.
+type archiveFile struct {
+	path    string
+	file    *os.File
+	gz      *gzip.Writer
+	encoder *json.Encoder
+}
+
+func createArchiveFile(path string) (*archiveFile, error) {
+	file, err := os.OpenFile(path+".tmp", os.O_WRONLY|os.O_CREATE|os.O_TRUNC, archiveFileMode)
+	if err != nil {
+		return nil, err
+	}
+	gz := gzip.NewWriter(file)
+	return &archiveFile{
+		path:    path,
+		file:    file,
+		gz:      gz,
+		encoder: json.NewEncoder(gz),
+	}, nil
+}
+
+func (f *archiveFile) commit() error {
+	err := f.gz.Close()
+	if err == nil {
+		err = f.file.Sync()
+	}
+	closeErr := f.file.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(f.file.Name())
+		return err
+	}
+	return os.Rename(f.file.Name(), f.path)
+}
+
+func (f *archiveFile) discard() {
+	f.file.Close()
+	os.Remove(f.file.Name())
+}
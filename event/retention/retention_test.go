@@ -0,0 +1,217 @@
+// Copyright 2018 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package retention
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/globalsign/mgo/bson"
+	"github.com/tsuru/config"
+	"github.com/tsuru/tsuru/db"
+	"github.com/tsuru/tsuru/event"
+	"github.com/tsuru/tsuru/permission"
+	"gopkg.in/check.v1"
+)
+
+func (s *S) newEvent(c *check.C, kind, target string, age time.Duration, done bool) *event.Event {
+	evt, err := event.NewInternal(&event.Opts{
+		Target:       event.Target{Type: event.TargetTypeApp, Value: target},
+		InternalKind: kind,
+		Allowed:      event.Allowed(permission.PermAppReadEvents),
+	})
+	c.Assert(err, check.IsNil)
+	if done {
+		err = evt.Done(nil)
+		c.Assert(err, check.IsNil)
+	}
+	conn, err := db.Conn()
+	c.Assert(err, check.IsNil)
+	defer conn.Close()
+	err = conn.Events().Update(bson.M{"uniqueid": evt.UniqueID}, bson.M{"$set": bson.M{"starttime": time.Now().UTC().Add(-age)}})
+	c.Assert(err, check.IsNil)
+	return evt
+}
+
+func readArchives(c *check.C, dir string) []string {
+	files, err := filepath.Glob(filepath.Join(dir, "*.jsonl*"))
+	c.Assert(err, check.IsNil)
+	var ids []string
+	for _, name := range files {
+		c.Assert(filepath.Ext(name), check.Equals, ".gz")
+		f, err := os.Open(name)
+		c.Assert(err, check.IsNil)
+		gz, err := gzip.NewReader(f)
+		c.Assert(err, check.IsNil)
+		scanner := bufio.NewScanner(gz)
+		for scanner.Scan() {
+			var doc map[string]interface{}
+			err = json.Unmarshal(scanner.Bytes(), &doc)
+			c.Assert(err, check.IsNil)
+			ids = append(ids, doc["uniqueid"].(string))
+		}
+		c.Assert(scanner.Err(), check.IsNil)
+		f.Close()
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+func (s *S) TestLoadPolicies(c *check.C) {
+	policies, err := loadPolicies()
+	c.Assert(err, check.IsNil)
+	c.Assert(policies, check.IsNil)
+	config.Set("event:retention:policies", []interface{}{
+		map[interface{}]interface{}{"kind-name": "app.deploy", "days": 365},
+		map[interface{}]interface{}{"days": 30},
+	})
+	policies, err = loadPolicies()
+	c.Assert(err, check.IsNil)
+	c.Assert(policies, check.DeepEquals, []Policy{
+		{KindName: "app.deploy", Days: 365},
+		{Days: 30},
+	})
+	config.Set("event:retention:policies", []interface{}{
+		map[interface{}]interface{}{"kind-name": "app.deploy", "days": -1},
+	})
+	_, err = loadPolicies()
+	c.Assert(err, check.ErrorMatches, `invalid retention of -1 days for kind "app.deploy"`)
+}
+
+func (s *S) TestQueries(c *check.C) {
+	now := time.Date(2018, 6, 11, 15, 0, 0, 0, time.UTC)
+	a := newArchiver([]Policy{
+		{KindName: "app.deploy", Days: 365},
+		{KindName: "app.update.env.set", Days: 0},
+		{Days: 30},
+	})
+	c.Assert(a.queries(now), check.DeepEquals, map[string]bson.M{
+		"app.deploy": {
+			"running":   false,
+			"starttime": bson.M{"$lt": time.Date(2017, 6, 11, 15, 0, 0, 0, time.UTC)},
+			"kind.name": "app.deploy",
+		},
+		"": {
+			"running":   false,
+			"starttime": bson.M{"$lt": time.Date(2018, 5, 12, 15, 0, 0, 0, time.UTC)},
+			"kind.name": bson.M{"$nin": []string{"app.deploy", "app.update.env.set"}},
+		},
+	})
+	a = newArchiver([]Policy{{Days: 30}})
+	c.Assert(a.queries(now), check.DeepEquals, map[string]bson.M{
+		"": {
+			"running":   false,
+			"starttime": bson.M{"$lt": time.Date(2018, 5, 12, 15, 0, 0, 0, time.UTC)},
+		},
+	})
+}
+
+func (s *S) TestRunOnceArchivesExpiredEvents(c *check.C) {
+	day := 24 * time.Hour
+	oldHealing := s.newEvent(c, "healer", "app1", 40*day, true)
+	s.newEvent(c, "healer", "app2", 10*day, true)
+	oldOther := s.newEvent(c, "bindsyncer", "app3", 400*day, true)
+	s.newEvent(c, "autoscale", "app4", 1000*day, true)
+	s.newEvent(c, "healer", "app5", 40*day, false)
+	dir := c.MkDir()
+	a := newArchiver([]Policy{
+		{KindName: "healer", Days: 30},
+		{KindName: "autoscale", Days: 0},
+		{Days: 365},
+	})
+	a.archiveDir = dir
+	err := a.runOnce(time.Now().UTC())
+	c.Assert(err, check.IsNil)
+	expected := []string{oldHealing.UniqueID.Hex(), oldOther.UniqueID.Hex()}
+	sort.Strings(expected)
+	c.Assert(readArchives(c, dir), check.DeepEquals, expected)
+	evts, err := event.List(&event.Filter{Target: event.Target{Type: event.TargetTypeApp}})
+	c.Assert(err, check.IsNil)
+	var remaining []string
+	for _, evt := range evts {
+		remaining = append(remaining, evt.Target.Value)
+	}
+	sort.Strings(remaining)
+	c.Assert(remaining, check.DeepEquals, []string{"app2", "app4", "app5"})
+	evts, err = event.List(&event.Filter{KindNames: []string{EventKindRetention}})
+	c.Assert(err, check.IsNil)
+	c.Assert(evts, check.HasLen, 1)
+	c.Assert(evts[0].Running, check.Equals, false)
+	c.Assert(evts[0].Error, check.Equals, "")
+	var removed []map[string]interface{}
+	err = evts[0].EndData(&removed)
+	c.Assert(err, check.IsNil)
+	c.Assert(removed, check.HasLen, 2)
+}
+
+func (s *S) TestRunOnceWithoutArchiveDir(c *check.C) {
+	s.newEvent(c, "healer", "app1", 40*24*time.Hour, true)
+	a := newArchiver([]Policy{{Days: 30}})
+	err := a.runOnce(time.Now().UTC())
+	c.Assert(err, check.Equals, errArchiveDirNotSet)
+	evts, err := event.List(&event.Filter{Target: event.Target{Type: event.TargetTypeApp}})
+	c.Assert(err, check.IsNil)
+	c.Assert(evts, check.HasLen, 1)
+}
+
+func (s *S) TestRunOnceArchiveDirNotShared(c *check.C) {
+	s.newEvent(c, "healer", "app1", 40*24*time.Hour, true)
+	a := newArchiver([]Policy{{Days: 30}})
+	a.archiveDir = c.MkDir()
+	err := a.runOnce(time.Now().UTC())
+	c.Assert(err, check.IsNil)
+	id, err := ioutil.ReadFile(filepath.Join(a.archiveDir, archiveIDFile))
+	c.Assert(err, check.IsNil)
+	c.Assert(string(id), check.HasLen, 32)
+	s.newEvent(c, "healer", "app2", 40*24*time.Hour, true)
+	other := newArchiver([]Policy{{Days: 30}})
+	other.archiveDir = c.MkDir()
+	err = other.runOnce(time.Now().UTC())
+	c.Assert(err, check.ErrorMatches, `archive dir ".*" is not the one used by other tsuru API instances, it must be a volume shared by all of them`)
+	c.Assert(readArchives(c, other.archiveDir), check.IsNil)
+	evts, err := event.List(&event.Filter{Target: event.Target{Type: event.TargetTypeApp}})
+	c.Assert(err, check.IsNil)
+	c.Assert(evts, check.HasLen, 1)
+	err = ioutil.WriteFile(filepath.Join(other.archiveDir, archiveIDFile), id, archiveFileMode)
+	c.Assert(err, check.IsNil)
+	err = other.runOnce(time.Now().UTC())
+	c.Assert(err, check.IsNil)
+	evts, err = event.List(&event.Filter{Target: event.Target{Type: event.TargetTypeApp}})
+	c.Assert(err, check.IsNil)
+	c.Assert(evts, check.HasLen, 0)
+}
+
+func (s *S) TestInitializeRequiresArchiveDir(c *check.C) {
+	config.Set("event:retention:policies", []interface{}{
+		map[interface{}]interface{}{"days": 30},
+	})
+	err := Initialize()
+	c.Assert(err, check.Equals, errArchiveDirNotSet)
+	file := filepath.Join(c.MkDir(), "file")
+	err = ioutil.WriteFile(file, nil, archiveFileMode)
+	c.Assert(err, check.IsNil)
+	config.Set("event:retention:archive-dir", file)
+	err = Initialize()
+	c.Assert(err, check.ErrorMatches, `invalid event:retention:archive-dir: ".*" is not a directory`)
+}
+
+func (s *S) TestRunOnceNothingToRemove(c *check.C) {
+	s.newEvent(c, "healer", "app1", time.Hour, true)
+	dir := c.MkDir()
+	a := newArchiver([]Policy{{Days: 30}})
+	a.archiveDir = dir
+	err := a.runOnce(time.Now().UTC())
+	c.Assert(err, check.IsNil)
+	c.Assert(readArchives(c, dir), check.IsNil)
+	evts, err := event.All()
+	c.Assert(err, check.IsNil)
+	c.Assert(evts, check.HasLen, 1)
+}
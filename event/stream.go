@@ -0,0 +1,555 @@
+// Copyright 2018 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package event
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/globalsign/mgo"
+	"github.com/globalsign/mgo/bson"
+	"github.com/tsuru/tsuru/db"
+	"github.com/tsuru/tsuru/log"
+)
+
+type StreamMessageType string
+
+var (
+	StreamMessageTypeStart = StreamMessageType("start")
+	StreamMessageTypeLog   = StreamMessageType("log")
+	StreamMessageTypeDone  = StreamMessageType("done")
+	StreamMessageTypeAbort = StreamMessageType("abort")
+
+	// streamMessageTypeInit marks the message inserted to initialize an
+	// empty stream collection, it's never sent to listeners.
+	streamMessageTypeInit = StreamMessageType("init")
+)
+
+var (
+	streamPublishQueueSize = 1000
+	streamPublishBatchSize = 100
+	streamListenerBuffer   = 100
+	streamTailTimeout      = time.Second
+	streamRetryInterval    = 5 * time.Second
+	streamResumeSlack      = 1000
+
+	streamSubscribersRefresh = time.Second
+	streamSubscriberRenew    = 20 * time.Second
+	streamSubscriberTTL      = time.Minute
+
+	publisher = streamPublisher{
+		once: &sync.Once{},
+	}
+	streamHub = eventStreamHub{}
+)
+
+// StreamMessage is a notification about an event starting, logging, finishing
+// or being aborted. Messages are written to a capped collection by the API
+// instance running the event and tailed by every instance with listeners.
+type StreamMessage struct {
+	ID    bson.ObjectId `bson:"_id" json:"-"`
+	Type  StreamMessageType
+	Event StreamEvent
+	Log   string `json:",omitempty" bson:",omitempty"`
+}
+
+// StreamEvent holds the fields of an event sent in stream messages. EndTime
+// and Error are only set on done messages.
+type StreamEvent struct {
+	UniqueID     bson.ObjectId
+	Kind         Kind
+	Target       Target
+	ExtraTargets []ExtraTarget `json:",omitempty" bson:",omitempty"`
+	Owner        Owner
+	StartTime    time.Time
+	EndTime      time.Time `json:",omitempty" bson:",omitempty"`
+	Error        string    `json:",omitempty" bson:",omitempty"`
+	Running      bool
+	Allowed      AllowedPermission `json:"-"`
+}
+
+func newStreamMessage(msgType StreamMessageType, e *Event) StreamMessage {
+	msg := StreamMessage{
+		Type: msgType,
+		Event: StreamEvent{
+			UniqueID:     e.UniqueID,
+			Kind:         e.Kind,
+			Target:       e.Target,
+			ExtraTargets: e.ExtraTargets,
+			Owner:        e.Owner,
+			StartTime:    e.StartTime,
+			Running:      true,
+			Allowed:      e.Allowed,
+		},
+	}
+	if msgType == StreamMessageTypeDone {
+		msg.Event.EndTime = e.EndTime
+		msg.Event.Error = e.Error
+		msg.Event.Running = false
+	}
+	if msgType == StreamMessageTypeAbort {
+		msg.Event.Running = false
+	}
+	return msg
+}
+
+func (e *Event) publish(msgType StreamMessageType) {
+	if e.UniqueID == "" {
+		return
+	}
+	publisher.publish(newStreamMessage(msgType, e))
+}
+
+func (e *Event) publishLog(data string) {
+	if e.UniqueID == "" || data == "" {
+		return
+	}
+	msg := newStreamMessage(StreamMessageTypeLog, e)
+	msg.Log = data
+	publisher.publish(msg)
+}
+
+// matches reports whether the message must be sent to a listener using the
+// filter. Result filters only apply to done messages and the pending approval
+// filter is ignored.
+func (m *StreamMessage) matches(f *Filter) bool {
+	if f == nil {
+		return true
+	}
+	if f.PendingOnly || (m.Type != StreamMessageTypeDone && (f.ErrorOnly || f.SuccessOnly)) {
+		filter := *f
+		filter.PendingOnly = false
+		if m.Type != StreamMessageTypeDone {
+			filter.ErrorOnly = false
+			filter.SuccessOnly = false
+		}
+		f = &filter
+	}
+	evt := Event{eventData: eventData{
+		UniqueID:     m.Event.UniqueID,
+		Kind:         m.Event.Kind,
+		Target:       m.Event.Target,
+		ExtraTargets: m.Event.ExtraTargets,
+		Owner:        m.Event.Owner,
+		Error:        m.Event.Error,
+		Allowed:      m.Event.Allowed,
+	}}
+	return f.Matches(&evt)
+}
+
+// streamSubscriber is the target of the events streamed by a listener in
+// some API instance, renewed while the listener is open. An empty target
+// type or value matches any.
+type streamSubscriber struct {
+	ID      bson.ObjectId `bson:"_id"`
+	Target  Target
+	Updated time.Time
+}
+
+func (s *streamSubscriber) wants(msg *StreamMessage) bool {
+	targets := []Target{msg.Event.Target}
+	for _, et := range msg.Event.ExtraTargets {
+		targets = append(targets, et.Target)
+	}
+	for _, t := range targets {
+		if (s.Target.Type == "" || s.Target.Type == t.Type) &&
+			(s.Target.Value == "" || s.Target.Value == t.Value) {
+			return true
+		}
+	}
+	return false
+}
+
+// streamPublisher writes stream messages in batches, merging consecutive log
+// messages of the same event, so that events never block on the database.
+// Only messages about targets streamed by some API instance are written,
+// with the subscribers reloaded at most once every streamSubscribersRefresh.
+type streamPublisher struct {
+	once        *sync.Once
+	ch          chan StreamMessage
+	mu          sync.Mutex
+	subscribers []streamSubscriber
+	loaded      time.Time
+}
+
+func (p *streamPublisher) publish(msg StreamMessage) {
+	p.once.Do(func() {
+		p.ch = make(chan StreamMessage, streamPublishQueueSize)
+		go p.spin()
+	})
+	select {
+	case p.ch <- msg:
+	default:
+		log.Errorf("[events] [stream] queue full, dropping %s message of event %s", msg.Type, msg.Event.UniqueID.Hex())
+	}
+}
+
+func (p *streamPublisher) spin() {
+	for msg := range p.ch {
+		batch := []StreamMessage{msg}
+	drain:
+		for len(batch) < streamPublishBatchSize {
+			select {
+			case msg = <-p.ch:
+				last := &batch[len(batch)-1]
+				if msg.Type == StreamMessageTypeLog && last.Type == StreamMessageTypeLog &&
+					msg.Event.UniqueID == last.Event.UniqueID {
+					last.Log += msg.Log
+					continue
+				}
+				batch = append(batch, msg)
+			default:
+				break drain
+			}
+		}
+		batch = p.subscribed(batch)
+		if len(batch) == 0 {
+			continue
+		}
+		err := insertStreamMessages(batch)
+		if err != nil {
+			log.Errorf("[events] [stream] unable to publish %d messages: %s", len(batch), err)
+		}
+	}
+}
+
+// subscribed returns the messages wanted by some subscriber.
+func (p *streamPublisher) subscribed(msgs []StreamMessage) []StreamMessage {
+	subscribers, err := p.loadSubscribers()
+	if err != nil {
+		log.Errorf("[events] [stream] unable to load subscribers, publishing every message: %s", err)
+		return msgs
+	}
+	var wanted []StreamMessage
+	for i := range msgs {
+		for j := range subscribers {
+			if subscribers[j].wants(&msgs[i]) {
+				wanted = append(wanted, msgs[i])
+				break
+			}
+		}
+	}
+	return wanted
+}
+
+func (p *streamPublisher) loadSubscribers() ([]streamSubscriber, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if time.Since(p.loaded) < streamSubscribersRefresh {
+		return p.subscribers, nil
+	}
+	conn, err := db.Conn()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	var subscribers []streamSubscriber
+	err = conn.EventsStreamSubscribers().Find(bson.M{
+		"updated": bson.M{"$gt": time.Now().UTC().Add(-streamSubscriberTTL)},
+	}).All(&subscribers)
+	if err != nil {
+		return nil, err
+	}
+	p.subscribers = subscribers
+	p.loaded = time.Now()
+	return subscribers, nil
+}
+
+// invalidateSubscribers forces the subscribers to be reloaded before the next
+// batch, so that listeners in this instance receive messages right away.
+func (p *streamPublisher) invalidateSubscribers() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.loaded = time.Time{}
+}
+
+func insertStreamMessages(msgs []StreamMessage) error {
+	docs := make([]interface{}, len(msgs))
+	for i := range msgs {
+		msgs[i].ID = bson.NewObjectId()
+		docs[i] = msgs[i]
+	}
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	return conn.EventsStream().Insert(docs...)
+}
+
+// StreamListener receives the stream messages matching its filter.
+type StreamListener struct {
+	c          chan StreamMessage
+	filter     *Filter
+	subscriber streamSubscriber
+}
+
+// NewStreamListener returns a listener for messages about events matching
+// filter, starting with the events started or updated after the call. The
+// listener channel is closed if the listener falls behind.
+func NewStreamListener(filter *Filter) (*StreamListener, error) {
+	l := &StreamListener{
+		c:          make(chan StreamMessage, streamListenerBuffer),
+		filter:     filter,
+		subscriber: streamSubscriber{ID: bson.NewObjectId()},
+	}
+	if filter != nil {
+		l.subscriber.Target = filter.Target
+	}
+	err := addStreamSubscribers(l.subscriber)
+	if err != nil {
+		return nil, err
+	}
+	publisher.invalidateSubscribers()
+	err = streamHub.add(l)
+	if err != nil {
+		go removeStreamSubscriber(l.subscriber.ID)
+		return nil, err
+	}
+	return l, nil
+}
+
+func addStreamSubscribers(subscribers ...streamSubscriber) error {
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	coll := conn.EventsStreamSubscribers()
+	now := time.Now().UTC()
+	for _, s := range subscribers {
+		s.Updated = now
+		_, err = coll.UpsertId(s.ID, s)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func removeStreamSubscriber(id bson.ObjectId) {
+	conn, err := db.Conn()
+	if err != nil {
+		log.Errorf("[events] [stream] unable to remove subscriber: %s", err)
+		return
+	}
+	defer conn.Close()
+	err = conn.EventsStreamSubscribers().RemoveId(id)
+	if err != nil && err != mgo.ErrNotFound {
+		log.Errorf("[events] [stream] unable to remove subscriber: %s", err)
+	}
+}
+
+func (l *StreamListener) ListenChan() <-chan StreamMessage {
+	return l.c
+}
+
+func (l *StreamListener) Close() {
+	streamHub.remove(l)
+}
+
+// eventStreamHub tails the stream collection while there are listeners in
+// this API instance, dispatching each message to the matching listeners.
+type eventStreamHub struct {
+	mu        sync.Mutex
+	listeners map[*StreamListener]struct{}
+	stopCh    chan struct{}
+}
+
+func (h *eventStreamHub) add(l *StreamListener) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.stopCh == nil {
+		lastID, err := lastStreamMessageID()
+		if err != nil {
+			return err
+		}
+		h.stopCh = make(chan struct{})
+		go h.tail(lastID, h.stopCh)
+		go h.renewSubscribers(h.stopCh)
+	}
+	if h.listeners == nil {
+		h.listeners = make(map[*StreamListener]struct{})
+	}
+	h.listeners[l] = struct{}{}
+	return nil
+}
+
+func (h *eventStreamHub) remove(l *StreamListener) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.removeLocked(l)
+}
+
+func (h *eventStreamHub) removeLocked(l *StreamListener) {
+	if _, ok := h.listeners[l]; !ok {
+		return
+	}
+	delete(h.listeners, l)
+	close(l.c)
+	go removeStreamSubscriber(l.subscriber.ID)
+	if len(h.listeners) == 0 && h.stopCh != nil {
+		close(h.stopCh)
+		h.stopCh = nil
+	}
+}
+
+// renewSubscribers keeps the subscribers of the listeners in this instance
+// from expiring until stopCh is closed.
+func (h *eventStreamHub) renewSubscribers(stopCh chan struct{}) {
+	for {
+		select {
+		case <-stopCh:
+			return
+		case <-time.After(streamSubscriberRenew):
+		}
+		h.mu.Lock()
+		var subscribers []streamSubscriber
+		if h.stopCh == stopCh {
+			for l := range h.listeners {
+				subscribers = append(subscribers, l.subscriber)
+			}
+		}
+		h.mu.Unlock()
+		err := addStreamSubscribers(subscribers...)
+		if err != nil {
+			log.Errorf("[events] [stream] unable to renew subscribers: %s", err)
+		}
+	}
+}
+
+// dispatch sends msg to the matching listeners, returning false if the tail
+// identified by stopCh must stop.
+func (h *eventStreamHub) dispatch(stopCh chan struct{}, msg StreamMessage) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.stopCh != stopCh {
+		return false
+	}
+	for l := range h.listeners {
+		if !msg.matches(l.filter) {
+			continue
+		}
+		select {
+		case l.c <- msg:
+		default:
+			log.Errorf("[events] [stream] listener too slow, closing it")
+			h.removeLocked(l)
+		}
+	}
+	return h.stopCh == stopCh
+}
+
+func (h *eventStreamHub) tail(lastID bson.ObjectId, stopCh chan struct{}) {
+	for {
+		err := h.tailOnce(&lastID, stopCh)
+		if err == nil {
+			return
+		}
+		log.Errorf("[events] [stream] error tailing events: %s", err)
+		select {
+		case <-stopCh:
+			return
+		case <-time.After(streamRetryInterval):
+		}
+	}
+}
+
+// tailOnce tails the stream collection in insertion order until stopCh is
+// closed, returning errors other than a lost cursor position. Message ids are
+// created by every API instance and don't follow the insertion order, so the
+// messages up to lastID are skipped by scanning the collection from a few
+// messages before the end, or from its start if lastID isn't found there.
+func (h *eventStreamHub) tailOnce(lastID *bson.ObjectId, stopCh chan struct{}) error {
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	coll := conn.EventsStream()
+	skip := -1
+	for {
+		if skip != 0 {
+			skip, err = coll.Count()
+			if err != nil {
+				return err
+			}
+			skip -= streamResumeSlack
+			if skip < 0 {
+				skip = 0
+			}
+		}
+		found := false
+		iter := coll.Find(nil).Sort("$natural").Skip(skip).Tail(streamTailTimeout)
+		for {
+			var msg StreamMessage
+			for iter.Next(&msg) {
+				if !found {
+					found = msg.ID == *lastID
+					msg = StreamMessage{}
+					continue
+				}
+				*lastID = msg.ID
+				if msg.Type != streamMessageTypeInit && !h.dispatch(stopCh, msg) {
+					iter.Close()
+					return nil
+				}
+				msg = StreamMessage{}
+			}
+			select {
+			case <-stopCh:
+				iter.Close()
+				return nil
+			default:
+			}
+			if !iter.Timeout() {
+				break
+			}
+			if !found {
+				if skip > 0 {
+					break
+				}
+				log.Errorf("[events] [stream] stream position lost, messages may have been missed")
+				found = true
+			}
+		}
+		err = iter.Close()
+		if err != nil && !strings.Contains(err.Error(), "CappedPositionLost") {
+			return err
+		}
+		if !found && skip > 0 {
+			skip = 0
+			continue
+		}
+		skip = -1
+		select {
+		case <-stopCh:
+			return nil
+		case <-time.After(streamTailTimeout):
+		}
+	}
+}
+
+func lastStreamMessageID() (bson.ObjectId, error) {
+	conn, err := db.Conn()
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+	coll := conn.EventsStream()
+	var last StreamMessage
+	err = coll.Find(nil).Sort("-$natural").Limit(1).One(&last)
+	if err == mgo.ErrNotFound {
+		// Tail cursors do not block on empty collections, so the first
+		// listener initializes the collection.
+		last = StreamMessage{ID: bson.NewObjectId(), Type: streamMessageTypeInit}
+		err = coll.Insert(last)
+	}
+	if err != nil {
+		return "", err
+	}
+	return last.ID, nil
+}
@@ -0,0 +1,160 @@
+// Copyright 2018 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package event
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/globalsign/mgo/bson"
+	"github.com/tsuru/tsuru/db"
+	"github.com/tsuru/tsuru/permission"
+	"gopkg.in/check.v1"
+)
+
+func receiveStreamMessages(c *check.C, l *StreamListener, n int) []StreamMessage {
+	var msgs []StreamMessage
+	timeout := time.After(5 * time.Second)
+	for len(msgs) < n {
+		select {
+		case msg, ok := <-l.ListenChan():
+			c.Assert(ok, check.Equals, true)
+			msgs = append(msgs, msg)
+		case <-timeout:
+			c.Fatalf("timeout waiting for stream messages, received %d: %#v", len(msgs), msgs)
+		}
+	}
+	return msgs
+}
+
+func (s *S) TestStreamListener(c *check.C) {
+	l, err := NewStreamListener(&Filter{Target: Target{Type: "app", Value: "stream-app"}})
+	c.Assert(err, check.IsNil)
+	defer l.Close()
+	other, err := New(&Opts{
+		Target:  Target{Type: "app", Value: "other-app"},
+		Kind:    permission.PermAppDeploy,
+		Owner:   s.token,
+		Allowed: Allowed(permission.PermAppReadEvents),
+	})
+	c.Assert(err, check.IsNil)
+	err = other.Done(nil)
+	c.Assert(err, check.IsNil)
+	evt, err := New(&Opts{
+		Target:  Target{Type: "app", Value: "stream-app"},
+		Kind:    permission.PermAppDeploy,
+		Owner:   s.token,
+		Allowed: Allowed(permission.PermAppReadEvents),
+	})
+	c.Assert(err, check.IsNil)
+	msgs := receiveStreamMessages(c, l, 1)
+	c.Assert(msgs[0].Type, check.Equals, StreamMessageTypeStart)
+	c.Assert(msgs[0].Event.UniqueID, check.Equals, evt.UniqueID)
+	c.Assert(msgs[0].Event.Target, check.Equals, evt.Target)
+	c.Assert(msgs[0].Event.Kind.Name, check.Equals, "app.deploy")
+	c.Assert(msgs[0].Event.Running, check.Equals, true)
+	evt.Logf("building %s", "image")
+	msgs = receiveStreamMessages(c, l, 1)
+	c.Assert(msgs[0].Type, check.Equals, StreamMessageTypeLog)
+	c.Assert(msgs[0].Log, check.Equals, "building image\n")
+	err = evt.Done(errors.New("deploy failed"))
+	c.Assert(err, check.IsNil)
+	msgs = receiveStreamMessages(c, l, 1)
+	c.Assert(msgs[0].Type, check.Equals, StreamMessageTypeDone)
+	c.Assert(msgs[0].Event.UniqueID, check.Equals, evt.UniqueID)
+	c.Assert(msgs[0].Event.Error, check.Equals, "deploy failed")
+	c.Assert(msgs[0].Event.Running, check.Equals, false)
+	c.Assert(msgs[0].Event.EndTime.IsZero(), check.Equals, false)
+}
+
+func (s *S) TestStreamListenerClose(c *check.C) {
+	l, err := NewStreamListener(nil)
+	c.Assert(err, check.IsNil)
+	l.Close()
+	_, ok := <-l.ListenChan()
+	c.Assert(ok, check.Equals, false)
+	l.Close()
+	streamHub.mu.Lock()
+	defer streamHub.mu.Unlock()
+	c.Assert(streamHub.listeners, check.HasLen, 0)
+	c.Assert(streamHub.stopCh, check.IsNil)
+}
+
+func (s *S) TestStreamMessageMatches(c *check.C) {
+	evt := &Event{eventData: eventData{
+		Target:  Target{Type: "app", Value: "myapp"},
+		Kind:    Kind{Type: KindTypePermission, Name: "app.deploy"},
+		Owner:   Owner{Type: OwnerTypeUser, Name: "me@me.com"},
+		Allowed: Allowed(permission.PermAppReadEvents, permission.Context(permission.CtxTeam, "myteam")),
+		Error:   "deploy failed",
+	}}
+	start := newStreamMessage(StreamMessageTypeStart, evt)
+	done := newStreamMessage(StreamMessageTypeDone, evt)
+	tests := []struct {
+		filter *Filter
+		start  bool
+		done   bool
+	}{
+		{nil, true, true},
+		{&Filter{Target: Target{Type: "app", Value: "myapp"}}, true, true},
+		{&Filter{Target: Target{Type: "app", Value: "other"}}, false, false},
+		{&Filter{ErrorOnly: true}, true, true},
+		{&Filter{SuccessOnly: true}, true, false},
+		{&Filter{PendingOnly: true}, true, true},
+		{&Filter{Permissions: []permission.Permission{
+			{Scheme: permission.PermAppRead, Context: permission.Context(permission.CtxTeam, "myteam")},
+		}}, true, true},
+		{&Filter{Permissions: []permission.Permission{
+			{Scheme: permission.PermAppRead, Context: permission.Context(permission.CtxTeam, "otherteam")},
+		}}, false, false},
+	}
+	for i, tt := range tests {
+		c.Assert(start.matches(tt.filter), check.Equals, tt.start, check.Commentf("test %d", i))
+		c.Assert(done.matches(tt.filter), check.Equals, tt.done, check.Commentf("test %d", i))
+	}
+}
+
+func (s *S) TestStreamListenerMessagesWithOlderIDs(c *check.C) {
+	l, err := NewStreamListener(nil)
+	c.Assert(err, check.IsNil)
+	defer l.Close()
+	conn, err := db.Conn()
+	c.Assert(err, check.IsNil)
+	defer conn.Close()
+	msg := StreamMessage{
+		ID:    bson.NewObjectIdWithTime(time.Now().Add(-time.Hour)),
+		Type:  StreamMessageTypeStart,
+		Event: StreamEvent{UniqueID: bson.NewObjectId(), Target: Target{Type: "app", Value: "lagging-app"}},
+	}
+	err = conn.EventsStream().Insert(msg)
+	c.Assert(err, check.IsNil)
+	msgs := receiveStreamMessages(c, l, 1)
+	c.Assert(msgs[0].ID, check.Equals, msg.ID)
+	c.Assert(msgs[0].Event.Target, check.Equals, msg.Event.Target)
+}
+
+func (s *S) TestStreamPublisherSubscribed(c *check.C) {
+	p := streamPublisher{once: &sync.Once{}}
+	msgs := []StreamMessage{
+		{Type: StreamMessageTypeStart, Event: StreamEvent{Target: Target{Type: "app", Value: "app1"}}},
+		{Type: StreamMessageTypeLog, Event: StreamEvent{
+			Target:       Target{Type: "app", Value: "app2"},
+			ExtraTargets: []ExtraTarget{{Target: Target{Type: "pool", Value: "pool1"}}},
+		}},
+		{Type: StreamMessageTypeDone, Event: StreamEvent{Target: Target{Type: "node", Value: "node1"}}},
+	}
+	c.Assert(p.subscribed(msgs), check.HasLen, 0)
+	err := addStreamSubscribers(
+		streamSubscriber{ID: bson.NewObjectId(), Target: Target{Type: "app", Value: "app1"}},
+		streamSubscriber{ID: bson.NewObjectId(), Target: Target{Type: "pool"}},
+	)
+	c.Assert(err, check.IsNil)
+	p.invalidateSubscribers()
+	wanted := p.subscribed(msgs)
+	c.Assert(wanted, check.HasLen, 2)
+	c.Assert(wanted[0].Event.Target.Value, check.Equals, "app1")
+	c.Assert(wanted[1].Event.Target.Value, check.Equals, "app2")
+}
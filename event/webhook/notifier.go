@@ -0,0 +1,433 @@
+// Copyright 2018 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/globalsign/mgo"
+	"github.com/globalsign/mgo/bson"
+	"github.com/pkg/errors"
+	"github.com/tsuru/config"
+	"github.com/tsuru/tsuru/api/shutdown"
+	"github.com/tsuru/tsuru/db"
+	"github.com/tsuru/tsuru/event"
+	"github.com/tsuru/tsuru/log"
+)
+
+const (
+	TestEventKind = "webhook-test"
+
+	defaultMaxAttempts   = 5
+	defaultRetryInterval = 10 * time.Second
+	defaultWorkers       = 5
+	defaultPollInterval  = time.Second
+	claimTimeout         = 2 * time.Minute
+	queueSize            = 1000
+
+	headerEvent     = "X-Tsuru-Event"
+	headerDelivery  = "X-Tsuru-Delivery"
+	headerSignature = "X-Tsuru-Signature"
+)
+
+// Notifier delivers the events finished in this tsuru API instance to the
+// matching webhooks. Deliveries are stored before being sent and claimed by
+// the workers of any tsuru API instance, so pending retries survive restarts.
+// Failed deliveries are retried with an exponential backoff, starting at the
+// retry interval.
+type Notifier struct {
+	maxAttempts   int
+	retryInterval time.Duration
+	pollInterval  time.Duration
+	workers       int
+	events        chan *event.Event
+	deliveries    chan *delivery
+	wake          chan struct{}
+	stop          chan struct{}
+	wg            sync.WaitGroup
+	running       bool
+}
+
+// pendingDelivery is a delivery stored until it succeeds or runs out of
+// attempts. Claiming a delivery moves its next attempt forward by
+// claimTimeout, letting other instances send it if the claiming one dies.
+type pendingDelivery struct {
+	ID          string `bson:"_id"`
+	Webhook     string
+	Payload     Payload
+	Attempt     int
+	NextAttempt time.Time
+	Created     time.Time
+}
+
+type delivery struct {
+	id      string
+	hook    Webhook
+	payload *Payload
+	attempt int
+}
+
+func newNotifier() *Notifier {
+	maxAttempts, _ := config.GetInt("webhooks:max-attempts")
+	if maxAttempts <= 0 {
+		maxAttempts = defaultMaxAttempts
+	}
+	retryInterval := defaultRetryInterval
+	if seconds, _ := config.GetInt("webhooks:retry-interval"); seconds > 0 {
+		retryInterval = time.Duration(seconds) * time.Second
+	}
+	workers, _ := config.GetInt("webhooks:workers")
+	if workers <= 0 {
+		workers = defaultWorkers
+	}
+	return &Notifier{
+		maxAttempts:   maxAttempts,
+		retryInterval: retryInterval,
+		pollInterval:  defaultPollInterval,
+		workers:       workers,
+		events:        make(chan *event.Event, queueSize),
+		deliveries:    make(chan *delivery),
+		wake:          make(chan struct{}, 1),
+		stop:          make(chan struct{}),
+	}
+}
+
+func Initialize() error {
+	n := newNotifier()
+	n.start()
+	event.AddDoneListener(n.enqueue)
+	shutdown.Register(n)
+	return nil
+}
+
+func (n *Notifier) start() {
+	n.running = true
+	n.wg.Add(n.workers + 2)
+	go n.dispatch()
+	go n.poll()
+	for i := 0; i < n.workers; i++ {
+		go n.work()
+	}
+}
+
+func (n *Notifier) Shutdown(ctx context.Context) error {
+	if !n.running {
+		return nil
+	}
+	n.running = false
+	close(n.stop)
+	finished := make(chan struct{})
+	go func() {
+		n.wg.Wait()
+		close(finished)
+	}()
+	select {
+	case <-finished:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (n *Notifier) String() string {
+	return "webhooks notifier"
+}
+
+// enqueue is called when events are done, it must not block.
+func (n *Notifier) enqueue(evt *event.Event) {
+	evtCopy := *evt
+	select {
+	case n.events <- &evtCopy:
+	default:
+		log.Errorf("[webhooks] queue full, dropping notifications of event %s", evt.UniqueID.Hex())
+	}
+}
+
+func (n *Notifier) dispatch() {
+	defer n.wg.Done()
+	for {
+		select {
+		case <-n.stop:
+			return
+		case evt := <-n.events:
+			err := n.dispatchEvent(evt)
+			if err != nil {
+				log.Errorf("[webhooks] unable to dispatch event %s: %s", evt.UniqueID.Hex(), err)
+			}
+		}
+	}
+}
+
+// dispatchEvent stores a pending delivery for each webhook matching the
+// event, waking the poller to send them.
+func (n *Notifier) dispatchEvent(evt *event.Event) error {
+	hooks, err := List(nil)
+	if err != nil {
+		return err
+	}
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	now := time.Now().UTC()
+	for _, hook := range hooks {
+		if !hook.Matches(evt) {
+			continue
+		}
+		err = conn.WebhookPendingDeliveries().Insert(pendingDelivery{
+			ID:          bson.NewObjectId().Hex(),
+			Webhook:     hook.Name,
+			Payload:     *newPayload(&hook, evt),
+			Attempt:     1,
+			NextAttempt: now,
+			Created:     now,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	select {
+	case n.wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// poll sends the due pending deliveries to the workers every poll interval
+// or when woken by new deliveries.
+func (n *Notifier) poll() {
+	defer n.wg.Done()
+	ticker := time.NewTicker(n.pollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-n.stop:
+			return
+		case <-n.wake:
+		case <-ticker.C:
+		}
+		err := n.sendDue()
+		if err != nil {
+			log.Errorf("[webhooks] unable to claim pending deliveries: %s", err)
+		}
+	}
+}
+
+// sendDue claims the due deliveries one at a time, as workers become
+// available, until there are none left or the notifier is stopped.
+func (n *Notifier) sendDue() error {
+	for {
+		pending, err := claimPending()
+		if err != nil || pending == nil {
+			return err
+		}
+		hook, err := Get(pending.Webhook)
+		if err == ErrWebhookNotFound {
+			err = removePending(pending.ID)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		d := &delivery{
+			id:      pending.ID,
+			hook:    *hook,
+			payload: &pending.Payload,
+			attempt: pending.Attempt,
+		}
+		if !n.push(d) {
+			return nil
+		}
+	}
+}
+
+func claimPending() (*pendingDelivery, error) {
+	conn, err := db.Conn()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	now := time.Now().UTC()
+	var pending pendingDelivery
+	_, err = conn.WebhookPendingDeliveries().Find(bson.M{"nextattempt": bson.M{"$lte": now}}).Sort("nextattempt").Apply(mgo.Change{
+		Update:    bson.M{"$set": bson.M{"nextattempt": now.Add(claimTimeout)}},
+		ReturnNew: true,
+	}, &pending)
+	if err == mgo.ErrNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &pending, nil
+}
+
+func removePending(id string) error {
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	err = conn.WebhookPendingDeliveries().RemoveId(id)
+	if err == mgo.ErrNotFound {
+		return nil
+	}
+	return err
+}
+
+// push hands the delivery to a worker, returning false if the notifier is
+// stopped.
+func (n *Notifier) push(d *delivery) bool {
+	select {
+	case n.deliveries <- d:
+		return true
+	case <-n.stop:
+		return false
+	}
+}
+
+func (n *Notifier) work() {
+	defer n.wg.Done()
+	for {
+		select {
+		case <-n.stop:
+			return
+		case d := <-n.deliveries:
+			result := deliver(d)
+			err := n.finish(d, result.Error == "")
+			if err != nil {
+				log.Errorf("[webhooks] unable to update delivery %s to %q: %s", d.id, d.hook.Name, err)
+			}
+		}
+	}
+}
+
+// finish removes the delivery from the pending ones when it succeeds or runs
+// out of attempts, otherwise scheduling the next attempt.
+func (n *Notifier) finish(d *delivery, succeeded bool) error {
+	if succeeded || d.attempt >= n.maxAttempts {
+		return removePending(d.id)
+	}
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	wait := n.retryInterval * time.Duration(1<<uint(d.attempt-1))
+	err = conn.WebhookPendingDeliveries().UpdateId(d.id, bson.M{"$set": bson.M{
+		"attempt":     d.attempt + 1,
+		"nextattempt": time.Now().UTC().Add(wait),
+	}})
+	if err == mgo.ErrNotFound {
+		return nil
+	}
+	return err
+}
+
+// deliver sends the payload to the webhook, recording the attempt in the
+// delivery log.
+func deliver(d *delivery) *Delivery {
+	result := &Delivery{
+		ID:         bson.NewObjectId(),
+		DeliveryID: d.id,
+		Webhook:    d.hook.Name,
+		EventID:    d.payload.UniqueID,
+		EventKind:  d.payload.Kind.Name,
+		Attempt:    d.attempt,
+		Time:       time.Now().UTC(),
+	}
+	var err error
+	result.StatusCode, err = send(d)
+	result.Duration = time.Since(result.Time)
+	if err != nil {
+		result.Error = err.Error()
+	}
+	logErr := logDelivery(result)
+	if logErr != nil {
+		log.Errorf("[webhooks] unable to log delivery %s to %q: %s", d.id, d.hook.Name, logErr)
+	}
+	return result
+}
+
+func send(d *delivery) (int, error) {
+	body, err := d.hook.render(d.payload)
+	if err != nil {
+		return 0, errors.Wrap(err, "unable to render body")
+	}
+	if body == nil {
+		body, err = json.Marshal(d.payload)
+		if err != nil {
+			return 0, err
+		}
+	}
+	req, err := http.NewRequest(http.MethodPost, d.hook.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(headerEvent, d.payload.Kind.Name)
+	req.Header.Set(headerDelivery, d.id)
+	req.Header.Set(headerSignature, "sha256="+Sign(d.hook.Secret, body))
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		data, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+		return resp.StatusCode, errors.Errorf("invalid response status %d: %s", resp.StatusCode, data)
+	}
+	return resp.StatusCode, nil
+}
+
+// Sign returns the hex encoded HMAC-SHA256 of body using the webhook secret,
+// sent in the X-Tsuru-Signature header prefixed by "sha256=".
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func logDelivery(d *Delivery) error {
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	return conn.WebhookDeliveries().Insert(d)
+}
+
+// SendTest sends a test payload to the webhook once, returning the result of the
+// attempt.
+func SendTest(w *Webhook) *Delivery {
+	now := time.Now().UTC()
+	return deliver(&delivery{
+		id:   bson.NewObjectId().Hex(),
+		hook: *w,
+		payload: &Payload{
+			Webhook:   w.Name,
+			Kind:      event.Kind{Type: event.KindTypeInternal, Name: TestEventKind},
+			Target:    event.Target{Type: event.TargetTypeWebhook, Value: w.Name},
+			Owner:     event.Owner{Type: event.OwnerTypeInternal},
+			StartTime: now,
+			EndTime:   now,
+		},
+		attempt: 1,
+	})
+}
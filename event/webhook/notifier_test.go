@@ -0,0 +1,242 @@
+// Copyright 2018 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"time"
+
+	"github.com/globalsign/mgo/bson"
+	"github.com/tsuru/config"
+	"github.com/tsuru/tsuru/db"
+	"github.com/tsuru/tsuru/event"
+	"github.com/tsuru/tsuru/permission"
+	"gopkg.in/check.v1"
+)
+
+type receivedRequest struct {
+	header http.Header
+	body   []byte
+}
+
+type fakeReceiver struct {
+	sync.Mutex
+	requests []receivedRequest
+	failures int
+}
+
+func (f *fakeReceiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.Lock()
+	defer f.Unlock()
+	body, _ := ioutil.ReadAll(r.Body)
+	f.requests = append(f.requests, receivedRequest{header: r.Header, body: body})
+	if f.failures > 0 {
+		f.failures--
+		w.WriteHeader(http.StatusServiceUnavailable)
+		w.Write([]byte("try again"))
+	}
+}
+
+func (f *fakeReceiver) received() []receivedRequest {
+	f.Lock()
+	defer f.Unlock()
+	return append([]receivedRequest(nil), f.requests...)
+}
+
+func (s *S) TestSendTest(c *check.C) {
+	receiver := &fakeReceiver{}
+	srv := httptest.NewServer(receiver)
+	defer srv.Close()
+	w := Webhook{Name: "hook1", TeamOwner: "myteam", URL: srv.URL, Secret: "abc"}
+	err := Create(&w)
+	c.Assert(err, check.IsNil)
+	result := SendTest(&w)
+	c.Assert(result.Error, check.Equals, "")
+	c.Assert(result.StatusCode, check.Equals, http.StatusOK)
+	c.Assert(result.EventKind, check.Equals, TestEventKind)
+	requests := receiver.received()
+	c.Assert(requests, check.HasLen, 1)
+	req := requests[0]
+	c.Assert(req.header.Get("X-Tsuru-Event"), check.Equals, TestEventKind)
+	c.Assert(req.header.Get("X-Tsuru-Delivery"), check.Equals, result.DeliveryID)
+	c.Assert(req.header.Get("X-Tsuru-Signature"), check.Equals, "sha256="+Sign("abc", req.body))
+	var payload Payload
+	err = json.Unmarshal(req.body, &payload)
+	c.Assert(err, check.IsNil)
+	c.Assert(payload.Webhook, check.Equals, "hook1")
+	c.Assert(payload.Target, check.Equals, event.Target{Type: event.TargetTypeWebhook, Value: "hook1"})
+	deliveries, err := ListDeliveries("hook1")
+	c.Assert(err, check.IsNil)
+	c.Assert(deliveries, check.HasLen, 1)
+	c.Assert(deliveries[0].DeliveryID, check.Equals, result.DeliveryID)
+}
+
+func (s *S) TestSendTestFailure(c *check.C) {
+	receiver := &fakeReceiver{failures: 1}
+	srv := httptest.NewServer(receiver)
+	defer srv.Close()
+	w := Webhook{Name: "hook1", TeamOwner: "myteam", URL: srv.URL}
+	result := SendTest(&w)
+	c.Assert(result.StatusCode, check.Equals, http.StatusServiceUnavailable)
+	c.Assert(result.Error, check.Equals, "invalid response status 503: try again")
+}
+
+func (s *S) TestNotifierRetriesFailedDeliveries(c *check.C) {
+	receiver := &fakeReceiver{failures: 2}
+	srv := httptest.NewServer(receiver)
+	defer srv.Close()
+	err := Create(&Webhook{
+		Name:        "deploys",
+		TeamOwner:   "myteam",
+		URL:         srv.URL,
+		EventFilter: event.Filter{KindNames: []string{"app.deploy"}},
+	})
+	c.Assert(err, check.IsNil)
+	err = Create(&Webhook{Name: "others", TeamOwner: "otherteam", URL: srv.URL})
+	c.Assert(err, check.IsNil)
+	n := newNotifier()
+	n.retryInterval = 10 * time.Millisecond
+	n.pollInterval = 10 * time.Millisecond
+	n.start()
+	defer n.Shutdown(context.Background())
+	var evt event.Event
+	evt.UniqueID = bson.NewObjectId()
+	evt.Target = event.Target{Type: event.TargetTypeApp, Value: "myapp"}
+	evt.Kind = event.Kind{Type: event.KindTypePermission, Name: "app.deploy"}
+	evt.Allowed = event.Allowed(permission.PermAppReadEvents, permission.Context(permission.CtxTeam, "myteam"))
+	n.enqueue(&evt)
+	var deliveries []Delivery
+	timeout := time.After(5 * time.Second)
+	for len(deliveries) < 3 {
+		select {
+		case <-timeout:
+			c.Fatalf("timeout waiting for deliveries, got %d", len(deliveries))
+		case <-time.After(10 * time.Millisecond):
+		}
+		deliveries, err = ListDeliveries("deploys")
+		c.Assert(err, check.IsNil)
+	}
+	requests := receiver.received()
+	c.Assert(requests, check.HasLen, 3)
+	c.Assert(requests[0].header.Get("X-Tsuru-Delivery"), check.Equals, requests[2].header.Get("X-Tsuru-Delivery"))
+	var payload Payload
+	err = json.Unmarshal(requests[2].body, &payload)
+	c.Assert(err, check.IsNil)
+	c.Assert(payload.Webhook, check.Equals, "deploys")
+	c.Assert(payload.UniqueID, check.Equals, evt.UniqueID)
+	c.Assert(deliveries, check.HasLen, 3)
+	c.Assert(deliveries[0].Attempt, check.Equals, 3)
+	c.Assert(deliveries[0].Error, check.Equals, "")
+	c.Assert(deliveries[2].Attempt, check.Equals, 1)
+	c.Assert(deliveries[2].StatusCode, check.Equals, http.StatusServiceUnavailable)
+}
+
+func (s *S) TestNotifierRetriesFailedDeliveriesRemovesPending(c *check.C) {
+	receiver := &fakeReceiver{failures: 5}
+	srv := httptest.NewServer(receiver)
+	defer srv.Close()
+	err := Create(&Webhook{Name: "deploys", TeamOwner: "myteam", URL: srv.URL})
+	c.Assert(err, check.IsNil)
+	n := newNotifier()
+	n.maxAttempts = 2
+	n.retryInterval = 10 * time.Millisecond
+	n.pollInterval = 10 * time.Millisecond
+	n.start()
+	defer n.Shutdown(context.Background())
+	var evt event.Event
+	evt.UniqueID = bson.NewObjectId()
+	evt.Kind = event.Kind{Type: event.KindTypePermission, Name: "app.deploy"}
+	evt.Allowed = event.Allowed(permission.PermAppReadEvents, permission.Context(permission.CtxTeam, "myteam"))
+	n.enqueue(&evt)
+	conn, err := db.Conn()
+	c.Assert(err, check.IsNil)
+	defer conn.Close()
+	timeout := time.After(5 * time.Second)
+	for {
+		deliveries, err := ListDeliveries("deploys")
+		c.Assert(err, check.IsNil)
+		pending, err := conn.WebhookPendingDeliveries().Count()
+		c.Assert(err, check.IsNil)
+		if len(deliveries) == 2 && pending == 0 {
+			break
+		}
+		select {
+		case <-timeout:
+			c.Fatalf("timeout waiting for deliveries, got %d, %d pending", len(deliveries), pending)
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+	c.Assert(receiver.received(), check.HasLen, 2)
+}
+
+func (s *S) TestNotifierSendsStoredPendingDeliveries(c *check.C) {
+	receiver := &fakeReceiver{}
+	srv := httptest.NewServer(receiver)
+	defer srv.Close()
+	err := Create(&Webhook{Name: "deploys", TeamOwner: "myteam", URL: srv.URL})
+	c.Assert(err, check.IsNil)
+	conn, err := db.Conn()
+	c.Assert(err, check.IsNil)
+	defer conn.Close()
+	now := time.Now().UTC()
+	err = conn.WebhookPendingDeliveries().Insert(pendingDelivery{
+		ID:          "d1",
+		Webhook:     "deploys",
+		Payload:     Payload{Webhook: "deploys", Kind: event.Kind{Type: event.KindTypePermission, Name: "app.deploy"}},
+		Attempt:     2,
+		NextAttempt: now,
+		Created:     now,
+	})
+	c.Assert(err, check.IsNil)
+	err = conn.WebhookPendingDeliveries().Insert(pendingDelivery{
+		ID:          "d2",
+		Webhook:     "deploys",
+		Attempt:     1,
+		NextAttempt: now.Add(time.Hour),
+		Created:     now,
+	})
+	c.Assert(err, check.IsNil)
+	n := newNotifier()
+	n.pollInterval = 10 * time.Millisecond
+	n.start()
+	defer n.Shutdown(context.Background())
+	timeout := time.After(5 * time.Second)
+	for len(receiver.received()) < 1 {
+		select {
+		case <-timeout:
+			c.Fatal("timeout waiting for the pending delivery")
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+	requests := receiver.received()
+	c.Assert(requests, check.HasLen, 1)
+	c.Assert(requests[0].header.Get("X-Tsuru-Delivery"), check.Equals, "d1")
+	deliveries, err := ListDeliveries("deploys")
+	c.Assert(err, check.IsNil)
+	c.Assert(deliveries, check.HasLen, 1)
+	c.Assert(deliveries[0].Attempt, check.Equals, 2)
+	var pending []pendingDelivery
+	err = conn.WebhookPendingDeliveries().Find(nil).All(&pending)
+	c.Assert(err, check.IsNil)
+	c.Assert(pending, check.HasLen, 1)
+	c.Assert(pending[0].ID, check.Equals, "d2")
+}
+
+func (s *S) TestSendTestPrivateTarget(c *check.C) {
+	receiver := &fakeReceiver{}
+	srv := httptest.NewServer(receiver)
+	defer srv.Close()
+	config.Set("webhooks:allow-private-targets", false)
+	defer config.Set("webhooks:allow-private-targets", true)
+	w := Webhook{Name: "hook1", TeamOwner: "myteam", URL: srv.URL}
+	result := SendTest(&w)
+	c.Assert(result.Error, check.Matches, `.*connection to private address 127.0.0.1 not allowed`)
+	c.Assert(receiver.received(), check.HasLen, 0)
+}
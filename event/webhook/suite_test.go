@@ -0,0 +1,56 @@
+// Copyright 2018 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package webhook
+
+import (
+	"testing"
+
+	"github.com/tsuru/config"
+	"github.com/tsuru/tsuru/db"
+	"github.com/tsuru/tsuru/db/dbtest"
+	"github.com/tsuru/tsuru/servicemanager"
+	authTypes "github.com/tsuru/tsuru/types/auth"
+	"gopkg.in/check.v1"
+)
+
+type S struct{}
+
+var _ = check.Suite(&S{})
+
+func Test(t *testing.T) {
+	check.TestingT(t)
+}
+
+func (s *S) SetUpSuite(c *check.C) {
+	config.Set("database:url", "127.0.0.1:27017?maxPoolSize=100")
+	config.Set("database:name", "tsuru_webhook_tests")
+	config.Set("webhooks:allow-private-targets", true)
+}
+
+func (s *S) SetUpTest(c *check.C) {
+	conn, err := db.Conn()
+	c.Assert(err, check.IsNil)
+	defer conn.Close()
+	dbtest.ClearAllCollections(conn.Webhooks().Database)
+	teams := []authTypes.Team{{Name: "myteam"}, {Name: "otherteam"}}
+	servicemanager.Team = &authTypes.MockTeamService{
+		OnFindByName: func(name string) (*authTypes.Team, error) {
+			for _, t := range teams {
+				if name == t.Name {
+					return &t, nil
+				}
+			}
+			return nil, authTypes.ErrTeamNotFound
+		},
+	}
+}
+
+func (s *S) TearDownSuite(c *check.C) {
+	conn, err := db.Conn()
+	c.Assert(err, check.IsNil)
+	defer conn.Close()
+	conn.Webhooks().Database.DropDatabase()
+	config.Unset("webhooks:allow-private-targets")
+}
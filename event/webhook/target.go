@@ -0,0 +1,108 @@
+// Copyright 2018 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package webhook
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"syscall"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/tsuru/config"
+	tsuruErrors "github.com/tsuru/tsuru/errors"
+)
+
+// deniedNetworks are the loopback, private, shared and link-local networks,
+// which webhooks may only target when webhooks:allow-private-targets is set,
+// preventing webhook owners from making tsuru call internal services.
+var deniedNetworks []*net.IPNet
+
+func init() {
+	for _, cidr := range []string{
+		"0.0.0.0/8",
+		"10.0.0.0/8",
+		"100.64.0.0/10",
+		"127.0.0.0/8",
+		"169.254.0.0/16",
+		"172.16.0.0/12",
+		"192.168.0.0/16",
+		"::/128",
+		"::1/128",
+		"fc00::/7",
+		"fe80::/10",
+	} {
+		_, ipNet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		deniedNetworks = append(deniedNetworks, ipNet)
+	}
+}
+
+// client sends the deliveries, checking the address of each connection, as
+// the host of a webhook may resolve to other addresses after being validated.
+var client = &http.Client{
+	Transport: &http.Transport{
+		DialContext: (&net.Dialer{
+			Timeout: 5 * time.Second,
+			Control: checkDialAddress,
+		}).DialContext,
+		TLSHandshakeTimeout: 5 * time.Second,
+		MaxIdleConnsPerHost: -1,
+	},
+	Timeout: time.Minute,
+	CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	},
+}
+
+func allowPrivateTargets() bool {
+	allow, _ := config.GetBool("webhooks:allow-private-targets")
+	return allow
+}
+
+func deniedIP(ip net.IP) bool {
+	for _, ipNet := range deniedNetworks {
+		if ipNet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// validateTarget checks that the host of a webhook url doesn't resolve to a
+// denied address. Hosts not resolved yet are accepted, having their addresses
+// checked when connecting.
+func validateTarget(host string) error {
+	if allowPrivateTargets() {
+		return nil
+	}
+	ips, err := net.LookupIP(host)
+	if err != nil {
+		return nil
+	}
+	for _, ip := range ips {
+		if deniedIP(ip) {
+			return &tsuruErrors.ValidationError{Message: fmt.Sprintf("webhook host %q resolves to the private address %s, which is not allowed", host, ip)}
+		}
+	}
+	return nil
+}
+
+func checkDialAddress(network, address string, _ syscall.RawConn) error {
+	if allowPrivateTargets() {
+		return nil
+	}
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	if ip := net.ParseIP(host); ip != nil && deniedIP(ip) {
+		return errors.Errorf("connection to private address %s not allowed", ip)
+	}
+	return nil
+}
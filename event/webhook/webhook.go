@@ -0,0 +1,315 @@
+// Copyright 2018 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package webhook notifies URLs registered by teams about finished events,
+// sending signed JSON payloads and retrying failed deliveries.
+package webhook
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"text/template"
+	"time"
+
+	"github.com/globalsign/mgo"
+	"github.com/globalsign/mgo/bson"
+	"github.com/pkg/errors"
+	"github.com/tsuru/tsuru/db"
+	tsuruErrors "github.com/tsuru/tsuru/errors"
+	"github.com/tsuru/tsuru/event"
+	"github.com/tsuru/tsuru/permission"
+	"github.com/tsuru/tsuru/servicemanager"
+	authTypes "github.com/tsuru/tsuru/types/auth"
+	"github.com/tsuru/tsuru/validation"
+)
+
+const deliveryListLimit = 25
+
+var (
+	ErrWebhookNotFound      = errors.New("webhook not found")
+	ErrWebhookAlreadyExists = errors.New("webhook already exists")
+)
+
+// Webhook is an URL notified about the finished events matching its filter.
+// Only the target, kind, owner and result fields of the filter are used and
+// only events visible to the team owning the webhook are delivered.
+//
+// Body is an optional text/template rendered with the Payload, replacing the
+// default JSON payload, e.g. to send messages to chat services.
+type Webhook struct {
+	Name        string `bson:"_id"`
+	Description string
+	TeamOwner   string
+	URL         string
+	Secret      string `json:",omitempty"`
+	Body        string `json:",omitempty" bson:",omitempty"`
+	EventFilter event.Filter
+}
+
+// Delivery is an attempt to send an event to a webhook. All the attempts to
+// deliver the same event share the same DeliveryID.
+type Delivery struct {
+	ID         bson.ObjectId `bson:"_id"`
+	DeliveryID string
+	Webhook    string
+	EventID    bson.ObjectId `bson:",omitempty"`
+	EventKind  string
+	Attempt    int
+	Time       time.Time
+	Duration   time.Duration
+	StatusCode int
+	Error      string
+}
+
+// Payload is the data sent to webhooks about a finished event.
+type Payload struct {
+	Webhook      string
+	UniqueID     bson.ObjectId
+	Kind         event.Kind
+	Target       event.Target
+	ExtraTargets []event.Target `json:",omitempty"`
+	Owner        event.Owner
+	StartTime    time.Time
+	EndTime      time.Time
+	Error        string
+}
+
+func newPayload(w *Webhook, evt *event.Event) *Payload {
+	p := &Payload{
+		Webhook:   w.Name,
+		UniqueID:  evt.UniqueID,
+		Kind:      evt.Kind,
+		Target:    evt.Target,
+		Owner:     evt.Owner,
+		StartTime: evt.StartTime,
+		EndTime:   evt.EndTime,
+		Error:     evt.Error,
+	}
+	for _, et := range evt.ExtraTargets {
+		p.ExtraTargets = append(p.ExtraTargets, et.Target)
+	}
+	return p
+}
+
+func (w *Webhook) validate() error {
+	if !validation.ValidateName(w.Name) {
+		msg := "Invalid webhook name, webhook name should have at most 63 " +
+			"characters, containing only lower case letters, numbers or dashes, " +
+			"starting with a letter."
+		return &tsuruErrors.ValidationError{Message: msg}
+	}
+	u, err := url.Parse(w.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return &tsuruErrors.ValidationError{Message: fmt.Sprintf("invalid webhook url %q, it must be an absolute http or https url", w.URL)}
+	}
+	err = validateTarget(u.Hostname())
+	if err != nil {
+		return err
+	}
+	if w.EventFilter.ErrorOnly && w.EventFilter.SuccessOnly {
+		return &tsuruErrors.ValidationError{Message: "webhook filter cannot be both error only and success only"}
+	}
+	if w.Body != "" {
+		_, err = template.New(w.Name).Parse(w.Body)
+		if err != nil {
+			return &tsuruErrors.ValidationError{Message: fmt.Sprintf("invalid webhook body template: %s", err)}
+		}
+	}
+	_, err = servicemanager.Team.FindByName(w.TeamOwner)
+	if err == authTypes.ErrTeamNotFound {
+		return &tsuruErrors.ValidationError{Message: err.Error()}
+	}
+	return err
+}
+
+// pruneFilter keeps only the filter fields used when matching events.
+func (w *Webhook) pruneFilter() {
+	w.EventFilter = event.Filter{
+		Target:      w.EventFilter.Target,
+		KindType:    w.EventFilter.KindType,
+		KindNames:   w.EventFilter.KindNames,
+		OwnerType:   w.EventFilter.OwnerType,
+		OwnerName:   w.EventFilter.OwnerName,
+		ErrorOnly:   w.EventFilter.ErrorOnly,
+		SuccessOnly: w.EventFilter.SuccessOnly,
+	}
+}
+
+// Matches reports whether evt must be delivered to the webhook.
+func (w *Webhook) Matches(evt *event.Event) bool {
+	if !w.EventFilter.Matches(evt) {
+		return false
+	}
+	teamCtx := permission.Context(permission.CtxTeam, w.TeamOwner)
+	for _, ctx := range evt.Allowed.Contexts {
+		if ctx == teamCtx {
+			return true
+		}
+	}
+	return false
+}
+
+func (w *Webhook) render(p *Payload) ([]byte, error) {
+	if w.Body == "" {
+		return nil, nil
+	}
+	tmpl, err := template.New(w.Name).Parse(w.Body)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	err = tmpl.Execute(&buf, p)
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func generateSecret() (string, error) {
+	data := make([]byte, 20)
+	_, err := rand.Read(data)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(data), nil
+}
+
+// Create registers a new webhook, generating its secret when none is given.
+func Create(w *Webhook) error {
+	err := w.validate()
+	if err != nil {
+		return err
+	}
+	w.pruneFilter()
+	if w.Secret == "" {
+		w.Secret, err = generateSecret()
+		if err != nil {
+			return err
+		}
+	}
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	err = conn.Webhooks().Insert(w)
+	if mgo.IsDup(err) {
+		return ErrWebhookAlreadyExists
+	}
+	return err
+}
+
+// Update replaces the webhook with the same name, keeping its secret when
+// none is given.
+func Update(w *Webhook) error {
+	err := w.validate()
+	if err != nil {
+		return err
+	}
+	w.pruneFilter()
+	old, err := Get(w.Name)
+	if err != nil {
+		return err
+	}
+	if w.Secret == "" {
+		w.Secret = old.Secret
+	}
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	err = conn.Webhooks().UpdateId(w.Name, w)
+	if err == mgo.ErrNotFound {
+		return ErrWebhookNotFound
+	}
+	return err
+}
+
+// Delete removes the webhook, its pending deliveries and its delivery log.
+func Delete(name string) error {
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	err = conn.Webhooks().RemoveId(name)
+	if err == mgo.ErrNotFound {
+		return ErrWebhookNotFound
+	}
+	if err != nil {
+		return err
+	}
+	_, err = conn.WebhookPendingDeliveries().RemoveAll(bson.M{"webhook": name})
+	if err != nil {
+		return err
+	}
+	_, err = conn.WebhookDeliveries().RemoveAll(bson.M{"webhook": name})
+	return err
+}
+
+func Get(name string) (*Webhook, error) {
+	conn, err := db.Conn()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	var w Webhook
+	err = conn.Webhooks().FindId(name).One(&w)
+	if err == mgo.ErrNotFound {
+		return nil, ErrWebhookNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &w, nil
+}
+
+// List returns the webhooks owned by the given teams, a nil list of teams
+// returns all webhooks.
+func List(teams []string) ([]Webhook, error) {
+	query := bson.M{}
+	if teams != nil {
+		query["teamowner"] = bson.M{"$in": teams}
+	}
+	conn, err := db.Conn()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	var webhooks []Webhook
+	err = conn.Webhooks().Find(query).Sort("_id").All(&webhooks)
+	if err != nil {
+		return nil, err
+	}
+	return webhooks, nil
+}
+
+// ListDeliveries returns the most recent delivery attempts of the webhook.
+func ListDeliveries(name string) ([]Delivery, error) {
+	conn, err := db.Conn()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	var deliveries []Delivery
+	err = conn.WebhookDeliveries().Find(bson.M{"webhook": name}).Sort("-time").Limit(deliveryListLimit).All(&deliveries)
+	if err != nil {
+		return nil, err
+	}
+	return deliveries, nil
+}
+
+func RenameTeam(oldName, newName string) error {
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	_, err = conn.Webhooks().UpdateAll(bson.M{"teamowner": oldName}, bson.M{"$set": bson.M{"teamowner": newName}})
+	return err
+}
@@ -0,0 +1,170 @@
+// Copyright 2018 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package webhook
+
+import (
+	"time"
+
+	"github.com/globalsign/mgo/bson"
+	"github.com/tsuru/config"
+	"github.com/tsuru/tsuru/db"
+	tsuruErrors "github.com/tsuru/tsuru/errors"
+	"github.com/tsuru/tsuru/event"
+	"github.com/tsuru/tsuru/permission"
+	"gopkg.in/check.v1"
+)
+
+func (s *S) TestCreate(c *check.C) {
+	w := Webhook{
+		Name:      "deploys",
+		TeamOwner: "myteam",
+		URL:       "https://hooks.example.com/deploys",
+		EventFilter: event.Filter{
+			Target:    event.Target{Type: event.TargetTypeApp},
+			KindNames: []string{"app.deploy"},
+			Limit:     10,
+			Raw:       bson.M{"x": 1},
+		},
+	}
+	err := Create(&w)
+	c.Assert(err, check.IsNil)
+	c.Assert(w.Secret, check.HasLen, 40)
+	dbW, err := Get("deploys")
+	c.Assert(err, check.IsNil)
+	c.Assert(dbW.Secret, check.Equals, w.Secret)
+	c.Assert(dbW.EventFilter, check.DeepEquals, event.Filter{
+		Target:    event.Target{Type: event.TargetTypeApp},
+		KindNames: []string{"app.deploy"},
+	})
+	err = Create(&Webhook{Name: "deploys", TeamOwner: "myteam", URL: "http://other.example.com"})
+	c.Assert(err, check.Equals, ErrWebhookAlreadyExists)
+}
+
+func (s *S) TestCreateInvalid(c *check.C) {
+	tests := []struct {
+		w   Webhook
+		err string
+	}{
+		{Webhook{Name: "Invalid Name", TeamOwner: "myteam", URL: "http://a.com"}, `Invalid webhook name.*`},
+		{Webhook{Name: "hook", TeamOwner: "myteam", URL: "a.com/x"}, `invalid webhook url "a.com/x".*`},
+		{Webhook{Name: "hook", TeamOwner: "myteam", URL: "ftp://a.com"}, `invalid webhook url "ftp://a.com".*`},
+		{Webhook{Name: "hook", TeamOwner: "myteam", URL: "http://a.com", EventFilter: event.Filter{ErrorOnly: true, SuccessOnly: true}}, `webhook filter cannot be both error only and success only`},
+		{Webhook{Name: "hook", TeamOwner: "myteam", URL: "http://a.com", Body: "{{.Kind"}, `invalid webhook body template: .*`},
+		{Webhook{Name: "hook", TeamOwner: "noteam", URL: "http://a.com"}, `team not found`},
+		{Webhook{Name: "hook", TeamOwner: "myteam", URL: "http://127.0.0.1:8080"}, `webhook host "127.0.0.1" resolves to the private address 127.0.0.1, which is not allowed`},
+		{Webhook{Name: "hook", TeamOwner: "myteam", URL: "http://[::1]/x"}, `webhook host "::1" resolves to the private address ::1, which is not allowed`},
+		{Webhook{Name: "hook", TeamOwner: "myteam", URL: "http://169.254.169.254/latest"}, `webhook host "169.254.169.254" resolves to the private address 169.254.169.254, which is not allowed`},
+		{Webhook{Name: "hook", TeamOwner: "myteam", URL: "https://10.1.2.3"}, `webhook host "10.1.2.3" resolves to the private address 10.1.2.3, which is not allowed`},
+		{Webhook{Name: "hook", TeamOwner: "myteam", URL: "http://localhost:1234"}, `webhook host "localhost" resolves to the private address .*, which is not allowed`},
+	}
+	config.Set("webhooks:allow-private-targets", false)
+	defer config.Set("webhooks:allow-private-targets", true)
+	for _, tt := range tests {
+		err := Create(&tt.w)
+		c.Assert(err, check.FitsTypeOf, &tsuruErrors.ValidationError{})
+		c.Assert(err, check.ErrorMatches, tt.err)
+	}
+}
+
+func (s *S) TestUpdate(c *check.C) {
+	w := Webhook{Name: "deploys", TeamOwner: "myteam", URL: "http://a.com", Secret: "abc"}
+	err := Create(&w)
+	c.Assert(err, check.IsNil)
+	err = Update(&Webhook{Name: "deploys", TeamOwner: "otherteam", URL: "http://b.com", Description: "my hook"})
+	c.Assert(err, check.IsNil)
+	dbW, err := Get("deploys")
+	c.Assert(err, check.IsNil)
+	c.Assert(dbW, check.DeepEquals, &Webhook{
+		Name:        "deploys",
+		TeamOwner:   "otherteam",
+		URL:         "http://b.com",
+		Description: "my hook",
+		Secret:      "abc",
+	})
+	err = Update(&Webhook{Name: "other", TeamOwner: "myteam", URL: "http://b.com"})
+	c.Assert(err, check.Equals, ErrWebhookNotFound)
+}
+
+func (s *S) TestDelete(c *check.C) {
+	err := Create(&Webhook{Name: "deploys", TeamOwner: "myteam", URL: "http://a.com"})
+	c.Assert(err, check.IsNil)
+	err = logDelivery(&Delivery{ID: bson.NewObjectId(), Webhook: "deploys", Time: time.Now()})
+	c.Assert(err, check.IsNil)
+	conn, err := db.Conn()
+	c.Assert(err, check.IsNil)
+	defer conn.Close()
+	err = conn.WebhookPendingDeliveries().Insert(pendingDelivery{ID: "d1", Webhook: "deploys", Attempt: 1})
+	c.Assert(err, check.IsNil)
+	err = Delete("deploys")
+	c.Assert(err, check.IsNil)
+	_, err = Get("deploys")
+	c.Assert(err, check.Equals, ErrWebhookNotFound)
+	deliveries, err := ListDeliveries("deploys")
+	c.Assert(err, check.IsNil)
+	c.Assert(deliveries, check.HasLen, 0)
+	n, err := conn.WebhookPendingDeliveries().Count()
+	c.Assert(err, check.IsNil)
+	c.Assert(n, check.Equals, 0)
+	err = Delete("deploys")
+	c.Assert(err, check.Equals, ErrWebhookNotFound)
+}
+
+func (s *S) TestList(c *check.C) {
+	err := Create(&Webhook{Name: "hook1", TeamOwner: "myteam", URL: "http://a.com"})
+	c.Assert(err, check.IsNil)
+	err = Create(&Webhook{Name: "hook2", TeamOwner: "otherteam", URL: "http://a.com"})
+	c.Assert(err, check.IsNil)
+	hooks, err := List(nil)
+	c.Assert(err, check.IsNil)
+	c.Assert(hooks, check.HasLen, 2)
+	c.Assert(hooks[0].Name, check.Equals, "hook1")
+	c.Assert(hooks[1].Name, check.Equals, "hook2")
+	hooks, err = List([]string{"otherteam"})
+	c.Assert(err, check.IsNil)
+	c.Assert(hooks, check.HasLen, 1)
+	c.Assert(hooks[0].Name, check.Equals, "hook2")
+}
+
+func (s *S) TestRenameTeam(c *check.C) {
+	err := Create(&Webhook{Name: "hook1", TeamOwner: "myteam", URL: "http://a.com"})
+	c.Assert(err, check.IsNil)
+	err = RenameTeam("myteam", "newteam")
+	c.Assert(err, check.IsNil)
+	hook, err := Get("hook1")
+	c.Assert(err, check.IsNil)
+	c.Assert(hook.TeamOwner, check.Equals, "newteam")
+}
+
+func (s *S) TestWebhookMatches(c *check.C) {
+	var evt event.Event
+	evt.Target = event.Target{Type: event.TargetTypeApp, Value: "myapp"}
+	evt.Kind = event.Kind{Type: event.KindTypePermission, Name: "app.deploy"}
+	evt.Allowed = event.Allowed(permission.PermAppReadEvents,
+		permission.Context(permission.CtxApp, "myapp"),
+		permission.Context(permission.CtxTeam, "myteam"),
+	)
+	w := Webhook{TeamOwner: "myteam", EventFilter: event.Filter{KindNames: []string{"app.deploy"}}}
+	c.Assert(w.Matches(&evt), check.Equals, true)
+	w.EventFilter.ErrorOnly = true
+	c.Assert(w.Matches(&evt), check.Equals, false)
+	w.EventFilter.ErrorOnly = false
+	w.TeamOwner = "otherteam"
+	c.Assert(w.Matches(&evt), check.Equals, false)
+}
+
+func (s *S) TestWebhookRender(c *check.C) {
+	w := Webhook{Name: "slack", Body: `{"text": "{{.Kind.Name}} on {{.Target.Value}}{{if .Error}} failed{{end}}"}`}
+	body, err := w.render(&Payload{
+		Kind:   event.Kind{Name: "app.deploy"},
+		Target: event.Target{Type: event.TargetTypeApp, Value: "myapp"},
+		Error:  "boom",
+	})
+	c.Assert(err, check.IsNil)
+	c.Assert(string(body), check.Equals, `{"text": "app.deploy on myapp failed"}`)
+	w.Body = ""
+	body, err = w.render(&Payload{})
+	c.Assert(err, check.IsNil)
+	c.Assert(body, check.IsNil)
+}
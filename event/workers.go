@@ -57,8 +57,9 @@ func (l *eventCleaner) tryCleaning() error {
 	coll := conn.Events()
 	var allData []eventData
 	err = coll.Find(bson.M{
-		"running":        true,
-		"lockupdatetime": bson.M{"$lt": now.Add(-lockExpireTimeout)},
+		"running":              true,
+		"lockupdatetime":       bson.M{"$lt": now.Add(-lockExpireTimeout)},
+		"approvalinfo.pending": bson.M{"$ne": true},
 	}).All(&allData)
 	conn.Close()
 	if err != nil {
@@ -84,6 +85,14 @@ func (l *eventCleaner) spin() {
 		if err != nil {
 			log.Errorf("%v", err)
 		}
+		err = expireBlocks(time.Now())
+		if err != nil {
+			log.Errorf("[events] [block expiration] error expiring blocks: %v", err)
+		}
+		err = expireApprovals(time.Now().UTC())
+		if err != nil {
+			log.Errorf("[events] [approval expiration] error expiring approvals: %v", err)
+		}
 		select {
 		case <-l.stopCh:
 			return
@@ -24,6 +24,7 @@ function missing_handlers {
     okhandlers=$(cat <(echo "$okhandlers1") <(echo "$okhandlers2") <(echo "$okhandlers3") | sort | uniq)
 
     ignored=$(cat <<EOF
+github.com/tsuru/tsuru/api.acmeChallenge
 github.com/tsuru/tsuru/api.authScheme
 github.com/tsuru/tsuru/api.healthcheck
 github.com/tsuru/tsuru/api.index
@@ -11,15 +11,20 @@ var (
 	PermAll                              = PermissionRegistry.get("")                                    // [global]
 	PermApp                              = PermissionRegistry.get("app")                                 // [global app team pool]
 	PermAppAdmin                         = PermissionRegistry.get("app.admin")                           // [global app team pool]
+	PermAppAdminDeployApproval           = PermissionRegistry.get("app.admin.deploy-approval")           // [global app team pool]
 	PermAppAdminQuota                    = PermissionRegistry.get("app.admin.quota")                     // [global app team pool]
 	PermAppAdminRoutes                   = PermissionRegistry.get("app.admin.routes")                    // [global app team pool]
 	PermAppAdminUnlock                   = PermissionRegistry.get("app.admin.unlock")                    // [global app team pool]
+	PermAppApprove                       = PermissionRegistry.get("app.approve")                         // [global app team pool]
+	PermAppApproveDeploy                 = PermissionRegistry.get("app.approve.deploy")                  // [global app team pool]
 	PermAppBuild                         = PermissionRegistry.get("app.build")                           // [global app team pool]
 	PermAppCreate                        = PermissionRegistry.get("app.create")                          // [global team]
 	PermAppDelete                        = PermissionRegistry.get("app.delete")                          // [global app team pool]
 	PermAppDeploy                        = PermissionRegistry.get("app.deploy")                          // [global app team pool]
 	PermAppDeployArchiveUrl              = PermissionRegistry.get("app.deploy.archive-url")              // [global app team pool]
+	PermAppDeployBluegreen               = PermissionRegistry.get("app.deploy.bluegreen")                // [global app team pool]
 	PermAppDeployBuild                   = PermissionRegistry.get("app.deploy.build")                    // [global app team pool]
+	PermAppDeployCanary                  = PermissionRegistry.get("app.deploy.canary")                   // [global app team pool]
 	PermAppDeployGit                     = PermissionRegistry.get("app.deploy.git")                      // [global app team pool]
 	PermAppDeployImage                   = PermissionRegistry.get("app.deploy.image")                    // [global app team pool]
 	PermAppDeployRollback                = PermissionRegistry.get("app.deploy.rollback")                 // [global app team pool]
@@ -43,6 +48,9 @@ var (
 	PermAppUpdateCname                   = PermissionRegistry.get("app.update.cname")                    // [global app team pool]
 	PermAppUpdateCnameAdd                = PermissionRegistry.get("app.update.cname.add")                // [global app team pool]
 	PermAppUpdateCnameRemove             = PermissionRegistry.get("app.update.cname.remove")             // [global app team pool]
+	PermAppUpdateCron                    = PermissionRegistry.get("app.update.cron")                     // [global app team pool]
+	PermAppUpdateCronRemove              = PermissionRegistry.get("app.update.cron.remove")              // [global app team pool]
+	PermAppUpdateCronSet                 = PermissionRegistry.get("app.update.cron.set")                 // [global app team pool]
 	PermAppUpdateDeploy                  = PermissionRegistry.get("app.update.deploy")                   // [global app team pool]
 	PermAppUpdateDeployRollback          = PermissionRegistry.get("app.update.deploy.rollback")          // [global app team pool]
 	PermAppUpdateDescription             = PermissionRegistry.get("app.update.description")              // [global app team pool]
@@ -72,6 +80,7 @@ var (
 	PermAppUpdateUnbindVolume            = PermissionRegistry.get("app.update.unbind-volume")            // [global app team pool]
 	PermAppUpdateUnit                    = PermissionRegistry.get("app.update.unit")                     // [global app team pool]
 	PermAppUpdateUnitAdd                 = PermissionRegistry.get("app.update.unit.add")                 // [global app team pool]
+	PermAppUpdateUnitAutoscale           = PermissionRegistry.get("app.update.unit.autoscale")           // [global app team pool]
 	PermAppUpdateUnitRegister            = PermissionRegistry.get("app.update.unit.register")            // [global app team pool]
 	PermAppUpdateUnitRemove              = PermissionRegistry.get("app.update.unit.remove")              // [global app team pool]
 	PermAppUpdateUnitStatus              = PermissionRegistry.get("app.update.unit.status")              // [global app team pool]
@@ -82,6 +91,10 @@ var (
 	PermClusterReadEvents                = PermissionRegistry.get("cluster.read.events")                 // [global]
 	PermClusterUpdate                    = PermissionRegistry.get("cluster.update")                      // [global]
 	PermDebug                            = PermissionRegistry.get("debug")                               // [global]
+	PermEventArchive                     = PermissionRegistry.get("event-archive")                       // [global]
+	PermEventArchiveExport               = PermissionRegistry.get("event-archive.export")                // [global]
+	PermEventArchiveRead                 = PermissionRegistry.get("event-archive.read")                  // [global]
+	PermEventArchiveReadEvents           = PermissionRegistry.get("event-archive.read.events")           // [global]
 	PermEventBlock                       = PermissionRegistry.get("event-block")                         // [global]
 	PermEventBlockAdd                    = PermissionRegistry.get("event-block.add")                     // [global]
 	PermEventBlockRead                   = PermissionRegistry.get("event-block.read")                    // [global]
@@ -203,6 +216,7 @@ var (
 	PermTeamTokenRead                    = PermissionRegistry.get("team.token.read")                     // [global team]
 	PermTeamTokenUpdate                  = PermissionRegistry.get("team.token.update")                   // [global team]
 	PermTeamUpdate                       = PermissionRegistry.get("team.update")                         // [global team]
+	PermTeamUpdateQuota                  = PermissionRegistry.get("team.update.quota")                   // [global team]
 	PermUser                             = PermissionRegistry.get("user")                                // [global user]
 	PermUserCreate                       = PermissionRegistry.get("user.create")                         // [global]
 	PermUserDelete                       = PermissionRegistry.get("user.delete")                         // [global user]
@@ -224,4 +238,10 @@ var (
 	PermVolumeUpdate                     = PermissionRegistry.get("volume.update")                       // [global volume team pool]
 	PermVolumeUpdateBind                 = PermissionRegistry.get("volume.update.bind")                  // [global volume team pool]
 	PermVolumeUpdateUnbind               = PermissionRegistry.get("volume.update.unbind")                // [global volume team pool]
+	PermWebhook                          = PermissionRegistry.get("webhook")                             // [global team]
+	PermWebhookCreate                    = PermissionRegistry.get("webhook.create")                      // [global team]
+	PermWebhookDelete                    = PermissionRegistry.get("webhook.delete")                      // [global team]
+	PermWebhookRead                      = PermissionRegistry.get("webhook.read")                        // [global team]
+	PermWebhookReadEvents                = PermissionRegistry.get("webhook.read.events")                 // [global team]
+	PermWebhookUpdate                    = PermissionRegistry.get("webhook.update")                      // [global team]
 )
@@ -19,6 +19,9 @@ var PermissionRegistry = (&registry{}).addWithCtx(
 	"app.update.unit.remove",
 	"app.update.unit.register",
 	"app.update.unit.status",
+	"app.update.unit.autoscale",
+	"app.update.cron.set",
+	"app.update.cron.remove",
 	"app.update.env.set",
 	"app.update.env.unset",
 	"app.update.restart",
@@ -47,7 +50,9 @@ var PermissionRegistry = (&registry{}).addWithCtx(
 	"app.update.router.remove",
 	"app.deploy",
 	"app.deploy.archive-url",
+	"app.deploy.bluegreen",
 	"app.deploy.build",
+	"app.deploy.canary",
 	"app.deploy.git",
 	"app.deploy.image",
 	"app.deploy.rollback",
@@ -66,6 +71,8 @@ var PermissionRegistry = (&registry{}).addWithCtx(
 	"app.admin.unlock",
 	"app.admin.routes",
 	"app.admin.quota",
+	"app.admin.deploy-approval",
+	"app.approve.deploy",
 	"app.build",
 ).addWithCtx(
 	"node", []contextType{CtxPool},
@@ -101,6 +108,7 @@ var PermissionRegistry = (&registry{}).addWithCtx(
 	"team.read.events",
 	"team.delete",
 	"team.update",
+	"team.update.quota",
 	"team.token.read",
 	"team.token.create",
 	"team.token.delete",
@@ -207,6 +215,9 @@ var PermissionRegistry = (&registry{}).addWithCtx(
 	"event-block.read.events",
 	"event-block.add",
 	"event-block.remove",
+).add(
+	"event-archive.read.events",
+	"event-archive.export",
 ).add(
 	"cluster.read.events",
 	"cluster.create",
@@ -221,4 +232,12 @@ var PermissionRegistry = (&registry{}).addWithCtx(
 	"volume.update.bind",
 	"volume.update.unbind",
 	"volume.delete",
+).addWithCtx(
+	"webhook", []contextType{CtxTeam},
+).add(
+	"webhook.read",
+	"webhook.read.events",
+	"webhook.create",
+	"webhook.update",
+	"webhook.delete",
 )
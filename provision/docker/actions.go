@@ -37,6 +37,7 @@ type runContainerActionsArgs struct {
 	provisioner      *dockerProvisioner
 	exposedPort      string
 	event            *event.Event
+	shadow           bool
 }
 
 type containersToAdd struct {
@@ -45,16 +46,18 @@ type containersToAdd struct {
 }
 
 type changeUnitsPipelineArgs struct {
-	app         provision.App
-	writer      io.Writer
-	toAdd       map[string]*containersToAdd
-	toRemove    []container.Container
-	toHost      string
-	imageID     string
-	provisioner *dockerProvisioner
-	appDestroy  bool
-	exposedPort string
-	event       *event.Event
+	app          provision.App
+	writer       io.Writer
+	toAdd        map[string]*containersToAdd
+	toRemove     []container.Container
+	toHost       string
+	imageID      string
+	provisioner  *dockerProvisioner
+	appDestroy   bool
+	exposedPort  string
+	event        *event.Event
+	keepAppImage bool
+	shadow       bool
 }
 
 type callbackFunc func(*container.Container, chan *container.Container) error
@@ -135,6 +138,31 @@ func generateContainerName(appName string) string {
 	return appName + "-" + randomString()
 }
 
+// extraPortsForProcess returns the extra ports declared in the tsuru.yaml of
+// the image that must be exposed by the containers of the process.
+func extraPortsForProcess(imageID, process string) ([]string, error) {
+	yamlData, err := image.GetImageTsuruYamlData(imageID)
+	if err != nil {
+		return nil, err
+	}
+	if len(yamlData.Ports) == 0 {
+		return nil, nil
+	}
+	webProcessName, err := image.GetImageWebProcessName(imageID)
+	if err != nil {
+		return nil, err
+	}
+	err = provision.ValidatePorts(yamlData.Ports, webProcessName)
+	if err != nil {
+		return nil, err
+	}
+	var ports []string
+	for _, p := range provision.PortsForProcess(yamlData.Ports, process, webProcessName) {
+		ports = append(ports, p.String())
+	}
+	return ports, nil
+}
+
 var insertEmptyContainerInDB = action.Action{
 	Name: "insert-empty-container",
 	Forward: func(ctx action.FWContext) (action.Result, error) {
@@ -156,8 +184,16 @@ var insertEmptyContainerInDB = action.Action{
 				Image:         args.imageID,
 				BuildingImage: args.buildingImage,
 				ExposedPort:   args.exposedPort,
+				Shadow:        args.shadow,
 			},
 		}
+		if !args.isDeploy {
+			var err error
+			cont.ExtraPorts, err = extraPortsForProcess(args.imageID, args.processName)
+			if err != nil {
+				return nil, err
+			}
+		}
 		return &cont, nil
 	},
 }
@@ -269,6 +305,7 @@ var setNetworkInfo = action.Action{
 		}
 		c.IP = info.IP
 		c.HostPort = info.HTTPHostPort
+		c.ExtraHostPorts = info.ExtraHostPorts
 		return c, nil
 	},
 }
@@ -825,6 +862,9 @@ var updateAppImage = action.Action{
 		if err := checkCanceled(args.event); err != nil {
 			return nil, err
 		}
+		if args.keepAppImage {
+			return ctx.Previous, nil
+		}
 		currentImageName, _ := image.AppCurrentImageName(args.app.GetName())
 		if currentImageName != args.imageID {
 			err := image.AppendAppImageName(args.app.GetName(), args.imageID)
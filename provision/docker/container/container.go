@@ -142,6 +142,9 @@ func (c *Container) Create(args *CreateArgs) error {
 		exposedPorts = map[docker.Port]struct{}{
 			docker.Port(c.ExposedPort): {},
 		}
+		for _, port := range c.ExtraPorts {
+			exposedPorts[docker.Port(port)] = struct{}{}
+		}
 	}
 	var user string
 	if args.Building {
@@ -211,8 +214,9 @@ func (c *Container) addEnvsToConfig(args *CreateArgs, port string, cfg *docker.C
 }
 
 type NetworkInfo struct {
-	HTTPHostPort string
-	IP           string
+	HTTPHostPort   string
+	ExtraHostPorts map[string]string
+	IP             string
 }
 
 func (c *Container) NetworkInfo(client provision.BuilderDockerClient) (NetworkInfo, error) {
@@ -224,16 +228,28 @@ func (c *Container) NetworkInfo(client provision.BuilderDockerClient) (NetworkIn
 	if dockerContainer.NetworkSettings != nil {
 		netInfo.IP = dockerContainer.NetworkSettings.IPAddress
 		httpPort := docker.Port(c.ExposedPort)
-		for _, port := range dockerContainer.NetworkSettings.Ports[httpPort] {
-			if port.HostPort != "" && port.HostIP != "" {
-				netInfo.HTTPHostPort = port.HostPort
-				break
+		netInfo.HTTPHostPort = hostPort(dockerContainer.NetworkSettings.Ports[httpPort])
+		for _, port := range c.ExtraPorts {
+			if extraHostPort := hostPort(dockerContainer.NetworkSettings.Ports[docker.Port(port)]); extraHostPort != "" {
+				if netInfo.ExtraHostPorts == nil {
+					netInfo.ExtraHostPorts = make(map[string]string)
+				}
+				netInfo.ExtraHostPorts[port] = extraHostPort
 			}
 		}
 	}
 	return netInfo, err
 }
 
+func hostPort(bindings []docker.PortBinding) string {
+	for _, port := range bindings {
+		if port.HostPort != "" && port.HostIP != "" {
+			return port.HostPort
+		}
+	}
+	return ""
+}
+
 func (c *Container) ExpectedStatus() provision.Status {
 	if c.StatusBeforeError != "" {
 		return provision.Status(c.StatusBeforeError)
@@ -493,6 +509,9 @@ func (c *Container) hostConfig(app provision.App, isDeploy bool) (*docker.HostCo
 		hostConfig.PortBindings = map[docker.Port][]docker.PortBinding{
 			docker.Port(c.ExposedPort): {{HostIP: "", HostPort: ""}},
 		}
+		for _, port := range c.ExtraPorts {
+			hostConfig.PortBindings[docker.Port(port)] = []docker.PortBinding{{HostIP: "", HostPort: ""}}
+		}
 		pool := app.GetPool()
 		driver, opts, logErr := LogOpts(pool)
 		if logErr != nil {
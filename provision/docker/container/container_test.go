@@ -243,6 +243,44 @@ func (s *S) TestContainerCreateAllocatesPort(c *check.C) {
 	c.Assert(container.Config.ExposedPorts, check.DeepEquals, map[docker.Port]struct{}{"3000/tcp": {}})
 }
 
+func (s *S) TestContainerCreateExtraPorts(c *check.C) {
+	app := provisiontest.NewFakeApp("app-name", "brainfuck", 1)
+	routertest.FakeRouter.AddBackend(app)
+	defer routertest.FakeRouter.RemoveBackend(app.GetName())
+	img := "tsuru/brainfuck:latest"
+	s.cli.PullImage(docker.PullImageOptions{Repository: img}, docker.AuthConfiguration{})
+	cont := Container{Container: types.Container{
+		Name:        "myName",
+		AppName:     app.GetName(),
+		Type:        app.GetPlatform(),
+		Status:      "created",
+		ProcessName: "web",
+		ExposedPort: "3000/tcp",
+		ExtraPorts:  []string{"1883/tcp", "53/udp"},
+	}}
+	err := cont.Create(&CreateArgs{
+		App:      app,
+		Commands: []string{"docker", "run"},
+		Client:   s.cli,
+		ImageID:  img,
+	})
+	c.Assert(err, check.IsNil)
+	defer s.removeTestContainer(&cont)
+	dcli, _ := docker.NewClient(s.server.URL())
+	container, err := dcli.InspectContainer(cont.ID)
+	c.Assert(err, check.IsNil)
+	c.Assert(container.Config.ExposedPorts, check.DeepEquals, map[docker.Port]struct{}{
+		"3000/tcp": {},
+		"1883/tcp": {},
+		"53/udp":   {},
+	})
+	c.Assert(container.HostConfig.PortBindings, check.DeepEquals, map[docker.Port][]docker.PortBinding{
+		"3000/tcp": {{HostIP: "", HostPort: ""}},
+		"1883/tcp": {{HostIP: "", HostPort: ""}},
+		"53/udp":   {{HostIP: "", HostPort: ""}},
+	})
+}
+
 func (s *S) TestContainerCreateSecurityOptions(c *check.C) {
 	s.server.CustomHandler("/images/.*/json", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		response := docker.Image{
@@ -475,6 +513,37 @@ func (s *S) TestContainerNetworkInfo(c *check.C) {
 	c.Assert(info.HTTPHostPort, check.Equals, "")
 }
 
+func (s *S) TestContainerNetworkInfoExtraPorts(c *check.C) {
+	inspectOut := `{
+	"NetworkSettings": {
+		"IpAddress": "10.10.10.10",
+		"Ports": {
+			"8888/tcp": [{"HostIp": "0.0.0.0", "HostPort": "32768"}],
+			"1883/tcp": [{"HostIp": "0.0.0.0", "HostPort": "32769"}],
+			"53/udp": [{"HostIp": "", "HostPort": ""}]
+		}
+	}
+}`
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.Contains(r.URL.Path, "/containers/") {
+			w.Write([]byte(inspectOut))
+		}
+	}))
+	defer server.Close()
+	cliRaw, err := docker.NewClient(server.URL)
+	c.Assert(err, check.IsNil)
+	cli := &dockercommon.PullAndCreateClient{Client: cliRaw}
+	container := Container{Container: types.Container{
+		ID:          "c-01",
+		ExposedPort: "8888/tcp",
+		ExtraPorts:  []string{"1883/tcp", "53/udp"},
+	}}
+	info, err := container.NetworkInfo(cli)
+	c.Assert(err, check.IsNil)
+	c.Assert(info.HTTPHostPort, check.Equals, "32768")
+	c.Assert(info.ExtraHostPorts, check.DeepEquals, map[string]string{"1883/tcp": "32769"})
+}
+
 func (s *S) TestContainerSetStatus(c *check.C) {
 	update := time.Date(1989, 2, 2, 14, 59, 32, 0, time.UTC).In(time.UTC)
 	container := Container{Container: types.Container{ID: "something-300", LastStatusUpdate: update}}
@@ -82,6 +82,22 @@ func (p *dockerProvisioner) HandleMoveErrors(moveErrors chan error, writer io.Wr
 }
 
 func (p *dockerProvisioner) runReplaceUnitsPipeline(w io.Writer, a provision.App, toAdd map[string]*containersToAdd, toRemoveContainers []container.Container, imageID string, toHosts ...string) ([]container.Container, error) {
+	return p.replaceUnits(w, a, toAdd, toRemoveContainers, imageID, false, false, toHosts...)
+}
+
+// runCanaryUnitsPipeline replaces containers just like
+// runReplaceUnitsPipeline, but keeps the current image of the app unchanged.
+func (p *dockerProvisioner) runCanaryUnitsPipeline(w io.Writer, a provision.App, toAdd map[string]*containersToAdd, toRemoveContainers []container.Container, imageID string) ([]container.Container, error) {
+	return p.replaceUnits(w, a, toAdd, toRemoveContainers, imageID, true, false)
+}
+
+// runShadowUnitsPipeline replaces shadow containers of a blue/green deploy.
+// New containers are healthchecked but are not added to the app routes.
+func (p *dockerProvisioner) runShadowUnitsPipeline(w io.Writer, a provision.App, toAdd map[string]*containersToAdd, toRemoveContainers []container.Container, imageID string, toHosts ...string) ([]container.Container, error) {
+	return p.replaceUnits(w, a, toAdd, toRemoveContainers, imageID, true, true, toHosts...)
+}
+
+func (p *dockerProvisioner) replaceUnits(w io.Writer, a provision.App, toAdd map[string]*containersToAdd, toRemoveContainers []container.Container, imageID string, keepAppImage, shadow bool, toHosts ...string) ([]container.Container, error) {
 	var toHost string
 	if len(toHosts) > 0 {
 		toHost = toHosts[0]
@@ -95,15 +111,17 @@ func (p *dockerProvisioner) runReplaceUnitsPipeline(w io.Writer, a provision.App
 	}
 	evt, _ := w.(*event.Event)
 	args := changeUnitsPipelineArgs{
-		app:         a,
-		toAdd:       toAdd,
-		toRemove:    toRemoveContainers,
-		toHost:      toHost,
-		writer:      w,
-		imageID:     imageID,
-		provisioner: p,
-		event:       evt,
-		exposedPort: imageData.ExposedPort,
+		app:          a,
+		toAdd:        toAdd,
+		toRemove:     toRemoveContainers,
+		toHost:       toHost,
+		writer:       w,
+		imageID:      imageID,
+		provisioner:  p,
+		event:        evt,
+		exposedPort:  imageData.ExposedPort,
+		keepAppImage: keepAppImage,
+		shadow:       shadow,
 	}
 	var pipeline *action.Pipeline
 	if p.isDryMode {
@@ -111,6 +129,13 @@ func (p *dockerProvisioner) runReplaceUnitsPipeline(w io.Writer, a provision.App
 			&provisionAddUnitsToHost,
 			&provisionRemoveOldUnits,
 		)
+	} else if shadow {
+		pipeline = action.NewPipeline(
+			&provisionAddUnitsToHost,
+			&bindAndHealthcheck,
+			&provisionRemoveOldUnits,
+			&provisionUnbindOldUnits,
+		)
 	} else {
 		pipeline = action.NewPipeline(
 			&provisionAddUnitsToHost,
@@ -176,13 +201,16 @@ func (p *dockerProvisioner) MoveOneContainer(c container.Container, toHost strin
 		}
 		return container.Container{}
 	}
-	imageID, err := image.AppCurrentImageName(a.GetName())
-	if err != nil {
-		errCh <- &tsuruErrors.CompositeError{
-			Base:    err,
-			Message: fmt.Sprintf("error getting app %q image name for unit %s", c.AppName, c.ID),
+	imageID := c.Image
+	if !c.Shadow {
+		imageID, err = image.AppCurrentImageName(a.GetName())
+		if err != nil {
+			errCh <- &tsuruErrors.CompositeError{
+				Base:    err,
+				Message: fmt.Sprintf("error getting app %q image name for unit %s", c.AppName, c.ID),
+			}
+			return container.Container{}
 		}
-		return container.Container{}
 	}
 	var destHosts []string
 	var suffix string
@@ -201,7 +229,11 @@ func (p *dockerProvisioner) MoveOneContainer(c container.Container, toHost strin
 		evtClone.SetLogWriter(ioutil.Discard)
 		pipeWriter = &evtClone
 	}
-	addedContainers, err := p.runReplaceUnitsPipeline(pipeWriter, a, toAdd, []container.Container{c}, imageID, destHosts...)
+	replaceUnits := p.runReplaceUnitsPipeline
+	if c.Shadow {
+		replaceUnits = p.runShadowUnitsPipeline
+	}
+	addedContainers, err := replaceUnits(pipeWriter, a, toAdd, []container.Container{c}, imageID, destHosts...)
 	if err != nil {
 		errCh <- &tsuruErrors.CompositeError{
 			Base:    err,
@@ -117,6 +117,7 @@ func (p *dockerProvisioner) start(oldContainer *container.Container, app provisi
 		destinationHosts: destinationHosts,
 		provisioner:      p,
 		exposedPort:      exposedPort,
+		shadow:           oldContainer.Shadow,
 	}
 	err = container.RunPipelineWithRetry(pipeline, args)
 	if err != nil {
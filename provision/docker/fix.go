@@ -34,10 +34,11 @@ func (p *dockerProvisioner) fixContainer(container *container.Container, info co
 	}
 	container.IP = info.IP
 	container.HostPort = info.HTTPHostPort
+	container.ExtraHostPorts = info.ExtraHostPorts
 	coll := p.Collection()
 	defer coll.Close()
 	err := coll.Update(bson.M{"id": container.ID}, bson.M{
-		"$set": bson.M{"hostport": container.HostPort, "ip": container.IP},
+		"$set": bson.M{"hostport": container.HostPort, "ip": container.IP, "extrahostports": container.ExtraHostPorts},
 	})
 	rebuild.LockedRoutesRebuildOrEnqueue(container.AppName)
 	return err
@@ -0,0 +1,115 @@
+// Copyright 2018 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package docker
+
+import (
+	"sync"
+	"time"
+
+	"github.com/fsouza/go-dockerclient"
+	"github.com/pkg/errors"
+	"github.com/tsuru/docker-cluster/cluster"
+	"github.com/tsuru/tsuru/net"
+	"github.com/tsuru/tsuru/provision"
+	"github.com/tsuru/tsuru/provision/docker/container"
+)
+
+const statsTimeout = 10 * time.Second
+
+// UnitsMetrics collects the usage of each container of the app through the
+// stats API of the docker node running it. Containers whose usage can't be
+// collected are reported with their error instead of failing the whole
+// result.
+func (p *dockerProvisioner) UnitsMetrics(a provision.App) ([]provision.UnitMetric, error) {
+	containers, err := p.listContainersByApp(a.GetName())
+	if err != nil {
+		return nil, err
+	}
+	if len(containers) == 0 {
+		return nil, nil
+	}
+	nodes, err := p.Cluster().UnfilteredNodes()
+	if err != nil {
+		return nil, err
+	}
+	nodeMap := make(map[string]cluster.Node, len(nodes))
+	for _, n := range nodes {
+		nodeMap[net.URLToHost(n.Address)] = n
+	}
+	metrics := make([]provision.UnitMetric, len(containers))
+	var wg sync.WaitGroup
+	for i := range containers {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			metric, err := containerMetric(nodeMap, &containers[i])
+			if err != nil {
+				metrics[i] = provision.UnitMetric{
+					ID:      containers[i].ID,
+					Process: containers[i].ProcessName,
+					Error:   err.Error(),
+				}
+				return
+			}
+			metrics[i] = *metric
+		}(i)
+	}
+	wg.Wait()
+	return metrics, nil
+}
+
+func containerMetric(nodeMap map[string]cluster.Node, c *container.Container) (*provision.UnitMetric, error) {
+	node, ok := nodeMap[c.HostAddr]
+	if !ok {
+		return nil, errors.Errorf("node not found for container %q", c.ShortID())
+	}
+	client, err := node.Client()
+	if err != nil {
+		return nil, err
+	}
+	cont, err := client.InspectContainer(c.ID)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to inspect container %q", c.ShortID())
+	}
+	statsCh := make(chan *docker.Stats, 1)
+	err = client.Stats(docker.StatsOptions{
+		ID:      c.ID,
+		Stats:   statsCh,
+		Stream:  false,
+		Timeout: statsTimeout,
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to get stats for container %q", c.ShortID())
+	}
+	metric := provision.UnitMetric{
+		ID:       c.ID,
+		Process:  c.ProcessName,
+		Restarts: cont.RestartCount,
+	}
+	stats := <-statsCh
+	if stats == nil {
+		return &metric, nil
+	}
+	metric.CPU = cpuPercent(stats)
+	if stats.MemoryStats.Usage > stats.MemoryStats.Stats.Cache {
+		metric.Memory = int64(stats.MemoryStats.Usage - stats.MemoryStats.Stats.Cache)
+	}
+	for _, netStats := range stats.Networks {
+		metric.NetworkRx += int64(netStats.RxBytes)
+		metric.NetworkTx += int64(netStats.TxBytes)
+	}
+	return &metric, nil
+}
+
+// cpuPercent calculates the CPU usage between the two samples included in
+// the stats, the same way the docker CLI does.
+func cpuPercent(stats *docker.Stats) float64 {
+	cpuDelta := float64(stats.CPUStats.CPUUsage.TotalUsage) - float64(stats.PreCPUStats.CPUUsage.TotalUsage)
+	systemDelta := float64(stats.CPUStats.SystemCPUUsage) - float64(stats.PreCPUStats.SystemCPUUsage)
+	if cpuDelta <= 0 || systemDelta <= 0 {
+		return 0
+	}
+	return cpuDelta / systemDelta * float64(len(stats.CPUStats.CPUUsage.PercpuUsage)) * 100
+}
@@ -0,0 +1,76 @@
+// Copyright 2018 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package docker
+
+import (
+	"fmt"
+
+	"github.com/fsouza/go-dockerclient"
+	"github.com/globalsign/mgo/bson"
+	"github.com/tsuru/tsuru/provision"
+	"github.com/tsuru/tsuru/provision/provisiontest"
+	"gopkg.in/check.v1"
+)
+
+func (s *S) TestUnitsMetrics(c *check.C) {
+	a := provisiontest.NewFakeApp("myapp", "python", 1)
+	cont, err := s.newContainer(&newContainerOpts{AppName: a.GetName(), ProcessName: "web"}, nil)
+	c.Assert(err, check.IsNil)
+	defer s.removeTestContainer(cont)
+	s.server.PrepareStats(cont.ID, func(string) docker.Stats {
+		var stats docker.Stats
+		stats.CPUStats.CPUUsage.TotalUsage = 300
+		stats.CPUStats.CPUUsage.PercpuUsage = []uint64{150, 150}
+		stats.CPUStats.SystemCPUUsage = 2000
+		stats.PreCPUStats.CPUUsage.TotalUsage = 100
+		stats.PreCPUStats.SystemCPUUsage = 1000
+		stats.MemoryStats.Usage = 3072
+		stats.MemoryStats.Stats.Cache = 1024
+		stats.Networks = map[string]docker.NetworkStats{
+			"eth0": {RxBytes: 10, TxBytes: 20},
+			"eth1": {RxBytes: 1, TxBytes: 2},
+		}
+		return stats
+	})
+	metrics, err := s.p.UnitsMetrics(a)
+	c.Assert(err, check.IsNil)
+	c.Assert(metrics, check.DeepEquals, []provision.UnitMetric{
+		{ID: cont.ID, Process: "web", CPU: 40, Memory: 2048, NetworkRx: 11, NetworkTx: 22},
+	})
+}
+
+func (s *S) TestUnitsMetricsNoContainers(c *check.C) {
+	a := provisiontest.NewFakeApp("myapp", "python", 1)
+	metrics, err := s.p.UnitsMetrics(a)
+	c.Assert(err, check.IsNil)
+	c.Assert(metrics, check.IsNil)
+}
+
+func (s *S) TestUnitsMetricsUnitError(c *check.C) {
+	a := provisiontest.NewFakeApp("myapp", "python", 1)
+	cont1, err := s.newContainer(&newContainerOpts{AppName: a.GetName(), ProcessName: "web"}, nil)
+	c.Assert(err, check.IsNil)
+	defer s.removeTestContainer(cont1)
+	cont2, err := s.newContainer(&newContainerOpts{AppName: a.GetName(), ProcessName: "worker"}, nil)
+	c.Assert(err, check.IsNil)
+	defer s.removeTestContainer(cont2)
+	coll := s.p.Collection()
+	defer coll.Close()
+	err = coll.Update(bson.M{"id": cont2.ID}, bson.M{"$set": bson.M{"hostaddr": "unknown-node"}})
+	c.Assert(err, check.IsNil)
+	metrics, err := s.p.UnitsMetrics(a)
+	c.Assert(err, check.IsNil)
+	c.Assert(metrics, check.HasLen, 2)
+	metricsMap := map[string]provision.UnitMetric{}
+	for _, m := range metrics {
+		metricsMap[m.ID] = m
+	}
+	c.Assert(metricsMap[cont1.ID].Error, check.Equals, "")
+	c.Assert(metricsMap[cont2.ID], check.DeepEquals, provision.UnitMetric{
+		ID:      cont2.ID,
+		Process: "worker",
+		Error:   fmt.Sprintf("node not found for container %q", cont2.ShortID()),
+	})
+}
@@ -14,6 +14,7 @@ import (
 	"sync"
 	"time"
 
+	"github.com/globalsign/mgo/bson"
 	"github.com/pkg/errors"
 	"github.com/tsuru/config"
 	"github.com/tsuru/docker-cluster/cluster"
@@ -40,8 +41,11 @@ import (
 	"github.com/tsuru/tsuru/provision/dockercommon"
 	"github.com/tsuru/tsuru/provision/nodecontainer"
 	"github.com/tsuru/tsuru/queue"
+	"github.com/tsuru/tsuru/router"
 	_ "github.com/tsuru/tsuru/router/api"
+	_ "github.com/tsuru/tsuru/router/file"
 	_ "github.com/tsuru/tsuru/router/galeb"
+	_ "github.com/tsuru/tsuru/router/group"
 	_ "github.com/tsuru/tsuru/router/hipache"
 	_ "github.com/tsuru/tsuru/router/routertest"
 	_ "github.com/tsuru/tsuru/router/vulcand"
@@ -76,22 +80,27 @@ type dockerProvisioner struct {
 }
 
 var (
-	_ provision.Provisioner               = &dockerProvisioner{}
-	_ provision.RollbackableDeployer      = &dockerProvisioner{}
-	_ provision.ShellProvisioner          = &dockerProvisioner{}
-	_ provision.ExecutableProvisioner     = &dockerProvisioner{}
-	_ provision.SleepableProvisioner      = &dockerProvisioner{}
-	_ provision.MessageProvisioner        = &dockerProvisioner{}
-	_ provision.InitializableProvisioner  = &dockerProvisioner{}
-	_ provision.OptionalLogsProvisioner   = &dockerProvisioner{}
-	_ provision.UnitStatusProvisioner     = &dockerProvisioner{}
-	_ provision.NodeProvisioner           = &dockerProvisioner{}
-	_ provision.NodeRebalanceProvisioner  = &dockerProvisioner{}
-	_ provision.NodeContainerProvisioner  = &dockerProvisioner{}
-	_ provision.UnitFinderProvisioner     = &dockerProvisioner{}
-	_ provision.AppFilterProvisioner      = &dockerProvisioner{}
-	_ provision.BuilderDeploy             = &dockerProvisioner{}
-	_ provision.BuilderDeployDockerClient = &dockerProvisioner{}
+	_ provision.Provisioner                = &dockerProvisioner{}
+	_ provision.RollbackableDeployer       = &dockerProvisioner{}
+	_ provision.CanaryDeployer             = &dockerProvisioner{}
+	_ provision.BlueGreenDeployer          = &dockerProvisioner{}
+	_ provision.ProcessRoutableProvisioner = &dockerProvisioner{}
+	_ provision.PortRoutableProvisioner    = &dockerProvisioner{}
+	_ provision.ShellProvisioner           = &dockerProvisioner{}
+	_ provision.ExecutableProvisioner      = &dockerProvisioner{}
+	_ provision.SleepableProvisioner       = &dockerProvisioner{}
+	_ provision.MessageProvisioner         = &dockerProvisioner{}
+	_ provision.InitializableProvisioner   = &dockerProvisioner{}
+	_ provision.OptionalLogsProvisioner    = &dockerProvisioner{}
+	_ provision.UnitStatusProvisioner      = &dockerProvisioner{}
+	_ provision.NodeProvisioner            = &dockerProvisioner{}
+	_ provision.NodeRebalanceProvisioner   = &dockerProvisioner{}
+	_ provision.NodeContainerProvisioner   = &dockerProvisioner{}
+	_ provision.UnitFinderProvisioner      = &dockerProvisioner{}
+	_ provision.AppFilterProvisioner       = &dockerProvisioner{}
+	_ provision.BuilderDeploy              = &dockerProvisioner{}
+	_ provision.BuilderDeployDockerClient  = &dockerProvisioner{}
+	_ provision.MetricsProvisioner         = &dockerProvisioner{}
 )
 
 type hookHealer struct {
@@ -442,6 +451,302 @@ func (p *dockerProvisioner) deploy(a provision.App, imageID string, evt *event.E
 	return err
 }
 
+// DeployCanary replaces, in each process, a fraction of the containers with
+// containers running the new image. The current image of the app is only
+// changed when the canary is promoted.
+func (p *dockerProvisioner) DeployCanary(a provision.App, buildImageID string, opts provision.CanaryOptions, evt *event.Event) (string, error) {
+	imageID := buildImageID
+	if strings.HasSuffix(buildImageID, "-builder") {
+		var err error
+		imageID, err = p.deployPipeline(a, buildImageID, dockercommon.DeployCmds(a), evt)
+		if err != nil {
+			return "", err
+		}
+	}
+	err := p.deployCanary(a, imageID, opts.Weight, evt)
+	if err != nil {
+		gc.CleanImage(a.GetName(), imageID, true)
+		return "", err
+	}
+	return imageID, nil
+}
+
+func (p *dockerProvisioner) deployCanary(a provision.App, imageID string, weight int, evt *event.Event) error {
+	if err := checkCanceled(evt); err != nil {
+		return err
+	}
+	containers, err := p.listContainersByApp(a.GetName())
+	if err != nil {
+		return err
+	}
+	if len(containers) == 0 {
+		return errors.New("cannot start a canary deploy for an app without units")
+	}
+	imageData, err := image.GetImageMetaData(imageID)
+	if err != nil {
+		return err
+	}
+	byProcess := map[string][]container.Container{}
+	for _, c := range containers {
+		byProcess[c.ProcessName] = append(byProcess[c.ProcessName], c)
+	}
+	toAdd := map[string]*containersToAdd{}
+	var toRemove []container.Container
+	for processName := range imageData.Processes {
+		processContainers := byProcess[processName]
+		if len(processContainers) == 0 {
+			continue
+		}
+		count := (len(processContainers)*weight + 99) / 100
+		toAdd[processName] = &containersToAdd{Quantity: count}
+		toRemove = append(toRemove, processContainers[:count]...)
+	}
+	_, err = p.runCanaryUnitsPipeline(evt, a, toAdd, toRemove, imageID)
+	if err != nil {
+		return provision.ErrUnitStartup{Err: err}
+	}
+	return nil
+}
+
+// PromoteCanary replaces every container not running the canary image,
+// making the canary image the current image of the app.
+func (p *dockerProvisioner) PromoteCanary(a provision.App, canaryImage string, evt *event.Event) (string, error) {
+	containers, err := p.listContainersByApp(a.GetName())
+	if err != nil {
+		return "", err
+	}
+	imageData, err := image.GetImageMetaData(canaryImage)
+	if err != nil {
+		return "", err
+	}
+	toAdd := make(map[string]*containersToAdd, len(imageData.Processes))
+	for processName := range imageData.Processes {
+		toAdd[processName] = &containersToAdd{}
+	}
+	existing := map[string]bool{}
+	var toRemove []container.Container
+	for _, c := range containers {
+		existing[c.ProcessName] = true
+		if c.Image == canaryImage {
+			continue
+		}
+		toRemove = append(toRemove, c)
+		if ct, ok := toAdd[c.ProcessName]; ok {
+			ct.Quantity++
+		}
+	}
+	for processName, ct := range toAdd {
+		if !existing[processName] {
+			ct.Quantity = 1
+		}
+	}
+	_, err = p.runReplaceUnitsPipeline(evt, a, toAdd, toRemove, canaryImage)
+	if err != nil {
+		return "", provision.ErrUnitStartup{Err: err}
+	}
+	return canaryImage, nil
+}
+
+// AbortCanary replaces the containers running the canary image with
+// containers running the current image of the app.
+func (p *dockerProvisioner) AbortCanary(a provision.App, canaryImage string, evt *event.Event) error {
+	currentImage, err := image.AppCurrentImageName(a.GetName())
+	if err != nil {
+		return err
+	}
+	imageData, err := image.GetImageMetaData(currentImage)
+	if err != nil {
+		return err
+	}
+	containers, err := p.listContainersByApp(a.GetName())
+	if err != nil {
+		return err
+	}
+	toAdd := map[string]*containersToAdd{}
+	var toRemove []container.Container
+	for _, c := range containers {
+		if c.Image != canaryImage {
+			continue
+		}
+		toRemove = append(toRemove, c)
+		if _, ok := imageData.Processes[c.ProcessName]; !ok {
+			continue
+		}
+		if _, ok := toAdd[c.ProcessName]; !ok {
+			toAdd[c.ProcessName] = &containersToAdd{}
+		}
+		toAdd[c.ProcessName].Quantity++
+	}
+	if len(toRemove) > 0 {
+		_, err = p.runReplaceUnitsPipeline(evt, a, toAdd, toRemove, currentImage)
+		if err != nil {
+			return provision.ErrUnitStartup{Err: err}
+		}
+	}
+	gc.CleanImage(a.GetName(), canaryImage, true)
+	return nil
+}
+
+func (p *dockerProvisioner) CanaryRoutableAddresses(a provision.App, canaryImage string) ([]url.URL, error) {
+	webProcessName, err := image.GetImageWebProcessName(canaryImage)
+	if err != nil {
+		return nil, err
+	}
+	containers, err := p.listContainersByProcess(a.GetName(), webProcessName)
+	if err != nil {
+		return nil, err
+	}
+	var addrs []url.URL
+	for _, c := range containers {
+		if c.Image == canaryImage && c.ValidAddr() {
+			addrs = append(addrs, *c.Address())
+		}
+	}
+	return addrs, nil
+}
+
+// DeployShadow starts, for each process, as many containers as currently
+// running with the new image. Shadow containers are excluded from the units
+// of the app and from its routes until SwitchShadow is called.
+func (p *dockerProvisioner) DeployShadow(a provision.App, buildImageID string, evt *event.Event) (string, error) {
+	imageID := buildImageID
+	if strings.HasSuffix(buildImageID, "-builder") {
+		var err error
+		imageID, err = p.deployPipeline(a, buildImageID, dockercommon.DeployCmds(a), evt)
+		if err != nil {
+			return "", err
+		}
+	}
+	err := p.deployShadow(a, imageID, evt)
+	if err != nil {
+		gc.CleanImage(a.GetName(), imageID, true)
+		return "", err
+	}
+	return imageID, nil
+}
+
+func (p *dockerProvisioner) deployShadow(a provision.App, imageID string, evt *event.Event) error {
+	if err := checkCanceled(evt); err != nil {
+		return err
+	}
+	containers, err := p.listContainersByApp(a.GetName())
+	if err != nil {
+		return err
+	}
+	if len(containers) == 0 {
+		return errors.New("cannot start a blue/green deploy for an app without units")
+	}
+	oldShadow, err := p.listShadowContainersByApp(a.GetName())
+	if err != nil {
+		return err
+	}
+	imageData, err := image.GetImageMetaData(imageID)
+	if err != nil {
+		return err
+	}
+	toAdd := getContainersToAdd(imageData, containers)
+	_, err = p.runShadowUnitsPipeline(evt, a, toAdd, oldShadow, imageID)
+	if err != nil {
+		return provision.ErrUnitStartup{Err: err}
+	}
+	return nil
+}
+
+func (p *dockerProvisioner) ShadowRoutableAddresses(a provision.App) ([]url.URL, error) {
+	containers, err := p.listShadowContainersByApp(a.GetName())
+	if err != nil || len(containers) == 0 {
+		return nil, err
+	}
+	webProcessName, err := image.GetImageWebProcessName(containers[0].Image)
+	if err != nil {
+		return nil, err
+	}
+	var addrs []url.URL
+	for _, c := range containers {
+		if c.ProcessName == webProcessName && c.ValidAddr() {
+			addrs = append(addrs, *c.Address())
+		}
+	}
+	return addrs, nil
+}
+
+// SwitchShadow flags the current containers as shadow containers and the
+// shadow containers as current ones, updating the app image and the router
+// healthcheck to match the new current containers.
+func (p *dockerProvisioner) SwitchShadow(a provision.App, imageID string, evt *event.Event) error {
+	shadow, err := p.listShadowContainersByApp(a.GetName())
+	if err != nil {
+		return err
+	}
+	if len(shadow) == 0 {
+		return errors.Errorf("no shadow units found for app %q", a.GetName())
+	}
+	shadowIDs := make([]string, len(shadow))
+	for i, c := range shadow {
+		if c.Image != imageID {
+			return errors.Errorf("shadow unit %s is not running image %q", c.ShortID(), imageID)
+		}
+		shadowIDs[i] = c.ID
+	}
+	current, err := p.listContainersByApp(a.GetName())
+	if err != nil {
+		return err
+	}
+	currentIDs := make([]string, len(current))
+	for i, c := range current {
+		currentIDs[i] = c.ID
+	}
+	err = p.updateContainers(bson.M{"id": bson.M{"$in": currentIDs}}, bson.M{"$set": bson.M{"shadow": true}})
+	if err != nil {
+		return err
+	}
+	err = p.updateContainers(bson.M{"id": bson.M{"$in": shadowIDs}}, bson.M{"$unset": bson.M{"shadow": ""}})
+	if err != nil {
+		rollbackErr := p.updateContainers(bson.M{"id": bson.M{"$in": currentIDs}}, bson.M{"$unset": bson.M{"shadow": ""}})
+		if rollbackErr != nil {
+			log.Errorf("unable to restore units of app %q after failed shadow switch: %s", a.GetName(), rollbackErr)
+		}
+		return err
+	}
+	err = image.AppendAppImageName(a.GetName(), imageID)
+	if err != nil {
+		return errors.Wrap(err, "unable to save image name")
+	}
+	yamlData, err := image.GetImageTsuruYamlData(imageID)
+	if err != nil {
+		return err
+	}
+	hcData := yamlData.Healthcheck.ToRouterHC()
+	return runInRouters(a, func(r router.Router) error {
+		hcRouter, ok := r.(router.CustomHealthcheckRouter)
+		if !ok {
+			return nil
+		}
+		return hcRouter.SetHealthcheck(a.GetName(), hcData)
+	}, nil)
+}
+
+func (p *dockerProvisioner) RemoveShadow(a provision.App, evt *event.Event) error {
+	containers, err := p.listShadowContainersByApp(a.GetName())
+	if err != nil || len(containers) == 0 {
+		return err
+	}
+	fmt.Fprintf(evt, "\n---- Removing %d shadow %s ----\n", len(containers), pluralize("unit", len(containers)))
+	return runInContainers(containers, func(c *container.Container, _ chan *container.Container) error {
+		unit := c.AsUnit(a)
+		err := a.UnbindUnit(&unit)
+		if err != nil {
+			log.Errorf("Ignored error trying to unbind shadow container %q: %s", c.ID, err)
+		}
+		err = c.Remove(p.ClusterClient(), p.ActionLimiter())
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(evt, " ---> Removed shadow unit %s [%s]\n", c.ShortID(), c.ProcessName)
+		return nil
+	}, nil, true)
+}
+
 func setQuota(app provision.App, toAdd map[string]*containersToAdd) error {
 	var total int
 	for _, ct := range toAdd {
@@ -546,6 +851,7 @@ func addContainersWithHost(args *changeUnitsPipelineArgs) ([]container.Container
 				Container: types.Container{
 					ProcessName: processName,
 					Status:      cont.Status.String(),
+					Shadow:      args.shadow,
 				},
 			})
 		}
@@ -790,19 +1096,41 @@ func (p *dockerProvisioner) RoutableAddresses(app provision.App) ([]url.URL, err
 	if err != nil {
 		return nil, err
 	}
+	return p.ProcessRoutableAddresses(app, webProcessName)
+}
+
+func (p *dockerProvisioner) ProcessRoutableAddresses(app provision.App, process string) ([]url.URL, error) {
 	containers, err := p.listContainersByApp(app.GetName())
 	if err != nil {
 		return nil, err
 	}
 	addrs := make([]url.URL, 0, len(containers))
 	for _, container := range containers {
-		if container.ProcessName == webProcessName && container.ValidAddr() {
+		if container.ProcessName == process && container.ValidAddr() {
 			addrs = append(addrs, *container.Address())
 		}
 	}
 	return addrs, nil
 }
 
+func (p *dockerProvisioner) PortRoutableAddresses(app provision.App, port provision.AppPort) ([]url.URL, error) {
+	containers, err := p.listContainersByApp(app.GetName())
+	if err != nil {
+		return nil, err
+	}
+	var addrs []url.URL
+	for _, container := range containers {
+		hostPort := container.ExtraHostPorts[port.String()]
+		if container.ProcessName == port.Process && container.HostAddr != "" && hostPort != "" {
+			addrs = append(addrs, url.URL{
+				Scheme: port.GetProtocol(),
+				Host:   fmt.Sprintf("%s:%s", container.HostAddr, hostPort),
+			})
+		}
+	}
+	return addrs, nil
+}
+
 func (p *dockerProvisioner) RegisterUnit(a provision.App, unitId string, customData map[string]interface{}) error {
 	cont, err := p.GetContainer(unitId)
 	if err != nil {
@@ -2428,6 +2428,24 @@ func (s *S) TestProvisionerRoutableAddresses(c *check.C) {
 	})
 }
 
+func (s *S) TestProvisionerPortRoutableAddresses(c *check.C) {
+	fakeApp := provisiontest.NewFakeApp("my-fake-app", "python", 0)
+	coll := s.p.Collection()
+	defer coll.Close()
+	err := coll.Insert(
+		container.Container{Container: types.Container{ID: "c1", AppName: fakeApp.GetName(), ProcessName: "web", HostAddr: "10.0.0.1", HostPort: "32768", ExtraHostPorts: map[string]string{"1883/tcp": "32769"}}},
+		container.Container{Container: types.Container{ID: "c2", AppName: fakeApp.GetName(), ProcessName: "web", HostAddr: "10.0.0.2", HostPort: "32768"}},
+		container.Container{Container: types.Container{ID: "c3", AppName: fakeApp.GetName(), ProcessName: "worker", HostAddr: "10.0.0.3", ExtraHostPorts: map[string]string{"1883/tcp": "32770"}}},
+	)
+	c.Assert(err, check.IsNil)
+	addrs, err := s.p.PortRoutableAddresses(fakeApp, provision.AppPort{Name: "mqtt", Port: 1883, Process: "web"})
+	c.Assert(err, check.IsNil)
+	c.Assert(addrs, check.DeepEquals, []url.URL{{Scheme: "tcp", Host: "10.0.0.1:32769"}})
+	addrs, err = s.p.PortRoutableAddresses(fakeApp, provision.AppPort{Name: "dns", Port: 53, Protocol: "udp", Process: "web"})
+	c.Assert(err, check.IsNil)
+	c.Assert(addrs, check.IsNil)
+}
+
 func (s *S) TestProvisionerRoutableAddressesInvalidContainers(c *check.C) {
 	appName := "my-fake-app"
 	fakeApp := provisiontest.NewFakeApp(appName, "python", 0)
@@ -2458,6 +2476,92 @@ func (s *S) TestProvisionerRoutableAddressesInvalidContainers(c *check.C) {
 	})
 }
 
+func (s *S) TestProvisionerCanaryRoutableAddresses(c *check.C) {
+	appName := "my-fake-app"
+	fakeApp := provisiontest.NewFakeApp(appName, "python", 0)
+	err := image.AppendAppImageName(appName, "myimg")
+	c.Assert(err, check.IsNil)
+	err = newFakeImage(s.p, "myimg", nil)
+	c.Assert(err, check.IsNil)
+	err = newFakeImage(s.p, "mycanaryimg", nil)
+	c.Assert(err, check.IsNil)
+	_, err = addContainersWithHost(&changeUnitsPipelineArgs{
+		toAdd:       map[string]*containersToAdd{"web": {Quantity: 2}},
+		app:         fakeApp,
+		imageID:     "myimg",
+		provisioner: s.p,
+	})
+	c.Assert(err, check.IsNil)
+	canaryConts, err := addContainersWithHost(&changeUnitsPipelineArgs{
+		toAdd:       map[string]*containersToAdd{"web": {Quantity: 1}},
+		app:         fakeApp,
+		imageID:     "mycanaryimg",
+		provisioner: s.p,
+	})
+	c.Assert(err, check.IsNil)
+	routes, err := s.p.CanaryRoutableAddresses(fakeApp, "mycanaryimg")
+	c.Assert(err, check.IsNil)
+	c.Assert(routes, check.DeepEquals, []url.URL{
+		*canaryConts[0].Address(),
+	})
+	routes, err = s.p.RoutableAddresses(fakeApp)
+	c.Assert(err, check.IsNil)
+	c.Assert(routes, check.HasLen, 3)
+}
+
+func (s *S) TestProvisionerShadowRoutableAddressesAndSwitch(c *check.C) {
+	appName := "my-fake-app"
+	fakeApp := provisiontest.NewFakeApp(appName, "python", 0)
+	err := image.AppendAppImageName(appName, "myimg")
+	c.Assert(err, check.IsNil)
+	err = newFakeImage(s.p, "myimg", nil)
+	c.Assert(err, check.IsNil)
+	err = newFakeImage(s.p, "myshadowimg", nil)
+	c.Assert(err, check.IsNil)
+	conts, err := addContainersWithHost(&changeUnitsPipelineArgs{
+		toAdd:       map[string]*containersToAdd{"web": {Quantity: 2}},
+		app:         fakeApp,
+		imageID:     "myimg",
+		provisioner: s.p,
+	})
+	c.Assert(err, check.IsNil)
+	shadowConts, err := addContainersWithHost(&changeUnitsPipelineArgs{
+		toAdd:       map[string]*containersToAdd{"web": {Quantity: 1}},
+		app:         fakeApp,
+		imageID:     "myshadowimg",
+		provisioner: s.p,
+		shadow:      true,
+	})
+	c.Assert(err, check.IsNil)
+	c.Assert(shadowConts[0].Shadow, check.Equals, true)
+	routes, err := s.p.ShadowRoutableAddresses(fakeApp)
+	c.Assert(err, check.IsNil)
+	c.Assert(routes, check.DeepEquals, []url.URL{*shadowConts[0].Address()})
+	routes, err = s.p.RoutableAddresses(fakeApp)
+	c.Assert(err, check.IsNil)
+	c.Assert(routes, check.HasLen, 2)
+	evt, err := event.New(&event.Opts{
+		Target:  event.Target{Type: "app", Value: appName},
+		Kind:    permission.PermAppDeploy,
+		Owner:   s.token,
+		Allowed: event.Allowed(permission.PermApp),
+	})
+	c.Assert(err, check.IsNil)
+	err = s.p.SwitchShadow(fakeApp, "myimg", evt)
+	c.Assert(err, check.ErrorMatches, `shadow unit .* is not running image "myimg"`)
+	err = s.p.SwitchShadow(fakeApp, "myshadowimg", evt)
+	c.Assert(err, check.IsNil)
+	routes, err = s.p.RoutableAddresses(fakeApp)
+	c.Assert(err, check.IsNil)
+	c.Assert(routes, check.DeepEquals, []url.URL{*shadowConts[0].Address()})
+	routes, err = s.p.ShadowRoutableAddresses(fakeApp)
+	c.Assert(err, check.IsNil)
+	c.Assert(routes, check.HasLen, len(conts))
+	imgName, err := image.AppCurrentImageName(appName)
+	c.Assert(err, check.IsNil)
+	c.Assert(imgName, check.Equals, "myshadowimg")
+}
+
 func (s *S) TestFilterAppsByUnitStatus(c *check.C) {
 	app1 := provisiontest.NewFakeApp("app1", "python", 0)
 	app2 := provisiontest.NewFakeApp("app2", "python", 0)
@@ -71,7 +71,7 @@ func (p *dockerProvisioner) listRunningContainersByHost(address string) ([]conta
 }
 
 func (p *dockerProvisioner) listContainersByProcess(appName, processName string) ([]container.Container, error) {
-	query := bson.M{"appname": appName}
+	query := bson.M{"appname": appName, "shadow": bson.M{"$ne": true}}
 	if processName != "" {
 		query["processname"] = processName
 	}
@@ -79,7 +79,11 @@ func (p *dockerProvisioner) listContainersByProcess(appName, processName string)
 }
 
 func (p *dockerProvisioner) listContainersByApp(appName string) ([]container.Container, error) {
-	return p.ListContainers(bson.M{"appname": appName})
+	return p.ListContainers(bson.M{"appname": appName, "shadow": bson.M{"$ne": true}})
+}
+
+func (p *dockerProvisioner) listShadowContainersByApp(appName string) ([]container.Container, error) {
+	return p.ListContainers(bson.M{"appname": appName, "shadow": true})
 }
 
 func (p *dockerProvisioner) listContainersByAppAndHost(appNames, addresses []string) ([]container.Container, error) {
@@ -96,6 +100,7 @@ func (p *dockerProvisioner) listContainersByAppAndHost(appNames, addresses []str
 func (p *dockerProvisioner) listRunnableContainersByApp(appName string) ([]container.Container, error) {
 	return p.ListContainers(bson.M{
 		"appname": appName,
+		"shadow":  bson.M{"$ne": true},
 		"status": bson.M{
 			"$nin": []string{
 				provision.StatusCreated.String(),
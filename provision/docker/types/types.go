@@ -33,6 +33,9 @@ type Container struct {
 	LockedUntil             time.Time
 	Routable                bool `bson:"-"`
 	ExposedPort             string
+	ExtraPorts              []string          `bson:",omitempty"`
+	ExtraHostPorts          map[string]string `bson:",omitempty"`
+	Shadow                  bool              `bson:",omitempty"`
 }
 
 type DockerLogConfig struct {
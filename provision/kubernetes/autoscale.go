@@ -0,0 +1,133 @@
+// Copyright 2018 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package kubernetes
+
+import (
+	"github.com/pkg/errors"
+	"github.com/tsuru/config"
+	"github.com/tsuru/tsuru/provision"
+	"k8s.io/api/apps/v1beta2"
+	autoscaling "k8s.io/api/autoscaling/v2beta1"
+	apiv1 "k8s.io/api/core/v1"
+	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const defaultRequestsMetricName = "requests_per_second"
+
+func requestsMetricName() string {
+	name, _ := config.GetString("kubernetes:autoscale:requests-metric")
+	if name == "" {
+		return defaultRequestsMetricName
+	}
+	return name
+}
+
+// SetAutoScale creates or updates a HorizontalPodAutoscaler targeting the
+// deployment of the process. The requests target depends on the metric
+// configured in kubernetes:autoscale:requests-metric being available through
+// the custom metrics API of the cluster.
+func (p *kubernetesProvisioner) SetAutoScale(a provision.App, spec provision.AutoScaleSpec) error {
+	client, err := clusterForPool(a.GetPool())
+	if err != nil {
+		return err
+	}
+	labels, err := provision.ServiceLabels(provision.ServiceLabelsOpts{
+		App:     a,
+		Process: spec.Process,
+		ServiceLabelExtendedOpts: provision.ServiceLabelExtendedOpts{
+			Prefix:      tsuruLabelPrefix,
+			Provisioner: provisionerName,
+		},
+	})
+	if err != nil {
+		return err
+	}
+	var metrics []autoscaling.MetricSpec
+	if spec.TargetCPU > 0 {
+		target := int32(spec.TargetCPU)
+		metrics = append(metrics, autoscaling.MetricSpec{
+			Type: autoscaling.ResourceMetricSourceType,
+			Resource: &autoscaling.ResourceMetricSource{
+				Name:                     apiv1.ResourceCPU,
+				TargetAverageUtilization: &target,
+			},
+		})
+	}
+	if spec.TargetRequests > 0 {
+		metrics = append(metrics, autoscaling.MetricSpec{
+			Type: autoscaling.PodsMetricSourceType,
+			Pods: &autoscaling.PodsMetricSource{
+				MetricName:         requestsMetricName(),
+				TargetAverageValue: *resource.NewQuantity(int64(spec.TargetRequests), resource.DecimalSI),
+			},
+		})
+	}
+	minReplicas := int32(spec.MinUnits)
+	depName := deploymentNameForApp(a, spec.Process)
+	hpa := &autoscaling.HorizontalPodAutoscaler{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      depName,
+			Namespace: client.Namespace(),
+			Labels:    labels.ToLabels(),
+		},
+		Spec: autoscaling.HorizontalPodAutoscalerSpec{
+			ScaleTargetRef: autoscaling.CrossVersionObjectReference{
+				APIVersion: "apps/v1beta2",
+				Kind:       "Deployment",
+				Name:       depName,
+			},
+			MinReplicas: &minReplicas,
+			MaxReplicas: int32(spec.MaxUnits),
+			Metrics:     metrics,
+		},
+	}
+	existing, err := client.AutoscalingV2beta1().HorizontalPodAutoscalers(client.Namespace()).Get(depName, metav1.GetOptions{})
+	if err != nil {
+		if !k8sErrors.IsNotFound(err) {
+			return errors.WithStack(err)
+		}
+		_, err = client.AutoscalingV2beta1().HorizontalPodAutoscalers(client.Namespace()).Create(hpa)
+		return errors.WithStack(err)
+	}
+	hpa.ResourceVersion = existing.ResourceVersion
+	_, err = client.AutoscalingV2beta1().HorizontalPodAutoscalers(client.Namespace()).Update(hpa)
+	return errors.WithStack(err)
+}
+
+// autoScaledReplicas returns the current replicas of deployments scaled by a
+// HorizontalPodAutoscaler, so deploys and restarts don't reset the number of
+// units chosen by the autoscaler. Stopping and starting units still set the
+// replicas, as autoscalers ignore deployments without replicas.
+func autoScaledReplicas(client *ClusterClient, dep *v1beta2.Deployment, replicas int32) (int32, error) {
+	if replicas == 0 || dep.Spec.Replicas == nil || *dep.Spec.Replicas == 0 {
+		return replicas, nil
+	}
+	_, err := client.AutoscalingV2beta1().HorizontalPodAutoscalers(client.Namespace()).Get(dep.Name, metav1.GetOptions{})
+	if err != nil {
+		if k8sErrors.IsNotFound(err) {
+			return replicas, nil
+		}
+		return 0, errors.WithStack(err)
+	}
+	return *dep.Spec.Replicas, nil
+}
+
+func (p *kubernetesProvisioner) RemoveAutoScale(a provision.App, process string) error {
+	client, err := clusterForPool(a.GetPool())
+	if err != nil {
+		return err
+	}
+	return cleanupAutoScale(client, a, process)
+}
+
+func cleanupAutoScale(client *ClusterClient, a provision.App, process string) error {
+	err := client.AutoscalingV2beta1().HorizontalPodAutoscalers(client.Namespace()).Delete(deploymentNameForApp(a, process), &metav1.DeleteOptions{})
+	if err != nil && !k8sErrors.IsNotFound(err) {
+		return errors.WithStack(err)
+	}
+	return nil
+}
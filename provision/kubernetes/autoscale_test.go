@@ -0,0 +1,115 @@
+// Copyright 2018 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package kubernetes
+
+import (
+	"github.com/tsuru/tsuru/app/image"
+	"github.com/tsuru/tsuru/provision"
+	"github.com/tsuru/tsuru/provision/provisiontest"
+	"gopkg.in/check.v1"
+	autoscaling "k8s.io/api/autoscaling/v2beta1"
+	apiv1 "k8s.io/api/core/v1"
+	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func (s *S) TestSetAutoScale(c *check.C) {
+	s.mock.MockfakeNodes(c)
+	a := provisiontest.NewFakeApp("myapp", "python", 0)
+	err := s.p.SetAutoScale(a, provision.AutoScaleSpec{Process: "web", MinUnits: 1, MaxUnits: 5, TargetCPU: 70})
+	c.Assert(err, check.IsNil)
+	hpa, err := s.client.AutoscalingV2beta1().HorizontalPodAutoscalers(s.client.Namespace()).Get("myapp-web", metav1.GetOptions{})
+	c.Assert(err, check.IsNil)
+	one, seventy := int32(1), int32(70)
+	c.Assert(hpa.Spec, check.DeepEquals, autoscaling.HorizontalPodAutoscalerSpec{
+		ScaleTargetRef: autoscaling.CrossVersionObjectReference{
+			APIVersion: "apps/v1beta2",
+			Kind:       "Deployment",
+			Name:       "myapp-web",
+		},
+		MinReplicas: &one,
+		MaxReplicas: 5,
+		Metrics: []autoscaling.MetricSpec{
+			{
+				Type: autoscaling.ResourceMetricSourceType,
+				Resource: &autoscaling.ResourceMetricSource{
+					Name:                     apiv1.ResourceCPU,
+					TargetAverageUtilization: &seventy,
+				},
+			},
+		},
+	})
+	c.Assert(hpa.Labels["tsuru.io/app-name"], check.Equals, "myapp")
+	c.Assert(hpa.Labels["tsuru.io/app-process"], check.Equals, "web")
+	err = s.p.SetAutoScale(a, provision.AutoScaleSpec{Process: "web", MinUnits: 2, MaxUnits: 10, TargetRequests: 100})
+	c.Assert(err, check.IsNil)
+	hpa, err = s.client.AutoscalingV2beta1().HorizontalPodAutoscalers(s.client.Namespace()).Get("myapp-web", metav1.GetOptions{})
+	c.Assert(err, check.IsNil)
+	c.Assert(*hpa.Spec.MinReplicas, check.Equals, int32(2))
+	c.Assert(hpa.Spec.MaxReplicas, check.Equals, int32(10))
+	c.Assert(hpa.Spec.Metrics, check.DeepEquals, []autoscaling.MetricSpec{
+		{
+			Type: autoscaling.PodsMetricSourceType,
+			Pods: &autoscaling.PodsMetricSource{
+				MetricName:         "requests_per_second",
+				TargetAverageValue: *resource.NewQuantity(100, resource.DecimalSI),
+			},
+		},
+	})
+}
+
+func (s *S) TestRemoveAutoScale(c *check.C) {
+	s.mock.MockfakeNodes(c)
+	a := provisiontest.NewFakeApp("myapp", "python", 0)
+	err := s.p.SetAutoScale(a, provision.AutoScaleSpec{Process: "web", MinUnits: 1, MaxUnits: 5, TargetCPU: 70})
+	c.Assert(err, check.IsNil)
+	err = s.p.RemoveAutoScale(a, "web")
+	c.Assert(err, check.IsNil)
+	_, err = s.client.AutoscalingV2beta1().HorizontalPodAutoscalers(s.client.Namespace()).Get("myapp-web", metav1.GetOptions{})
+	c.Assert(k8sErrors.IsNotFound(err), check.Equals, true)
+	err = s.p.RemoveAutoScale(a, "web")
+	c.Assert(err, check.IsNil)
+}
+
+func (s *S) TestRestartKeepsAutoScaledReplicas(c *check.C) {
+	a, wait, rollback := s.mock.DefaultReactions(c)
+	defer rollback()
+	imgName := "myapp:v1"
+	err := image.SaveImageCustomData(imgName, map[string]interface{}{
+		"processes": map[string]interface{}{
+			"web": "python myapp.py",
+		},
+	})
+	c.Assert(err, check.IsNil)
+	err = image.AppendAppImageName(a.GetName(), imgName)
+	c.Assert(err, check.IsNil)
+	err = s.p.AddUnits(a, 1, "web", nil)
+	c.Assert(err, check.IsNil)
+	wait()
+	err = s.p.SetAutoScale(a, provision.AutoScaleSpec{Process: "web", MinUnits: 1, MaxUnits: 5, TargetCPU: 70})
+	c.Assert(err, check.IsNil)
+	deployments := s.client.AppsV1beta2().Deployments(s.client.Namespace())
+	dep, err := deployments.Get("myapp-web", metav1.GetOptions{})
+	c.Assert(err, check.IsNil)
+	scaled := int32(4)
+	dep.Spec.Replicas = &scaled
+	_, err = deployments.Update(dep)
+	c.Assert(err, check.IsNil)
+	err = s.p.Restart(a, "", nil)
+	c.Assert(err, check.IsNil)
+	wait()
+	dep, err = deployments.Get("myapp-web", metav1.GetOptions{})
+	c.Assert(err, check.IsNil)
+	c.Assert(*dep.Spec.Replicas, check.Equals, int32(4))
+	err = s.p.RemoveAutoScale(a, "web")
+	c.Assert(err, check.IsNil)
+	err = s.p.Restart(a, "", nil)
+	c.Assert(err, check.IsNil)
+	wait()
+	dep, err = deployments.Get("myapp-web", metav1.GetOptions{})
+	c.Assert(err, check.IsNil)
+	c.Assert(*dep.Spec.Replicas, check.Equals, int32(1))
+}
@@ -360,29 +360,49 @@ func createAppDeployment(client *ClusterClient, oldDeployment *v1beta2.Deploymen
 	if err != nil {
 		return nil, nil, nil, errors.WithStack(err)
 	}
+	if oldDeployment != nil && !labels.IsCanary() {
+		realReplicas, err = autoScaledReplicas(client, oldDeployment, realReplicas)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+	}
 	appEnvs := provision.EnvsForApp(a, process, false)
 	var envs []apiv1.EnvVar
 	for _, envData := range appEnvs {
 		envs = append(envs, apiv1.EnvVar{Name: envData.Name, Value: envData.Value})
 	}
-	depName := deploymentNameForApp(a, process)
+	depName := deploymentNameForLabels(a, process, labels)
 	tenRevs := int32(10)
 	webProcessName, err := image.GetImageWebProcessName(imageName)
 	if err != nil {
 		return nil, nil, nil, errors.WithStack(err)
 	}
 	portInt := getTargetPortForImage(imageName)
+	yamlData, err := image.GetImageTsuruYamlData(imageName)
+	if err != nil {
+		return nil, nil, nil, errors.WithStack(err)
+	}
 	var probe *apiv1.Probe
 	if process == webProcessName {
-		yamlData, errImg := image.GetImageTsuruYamlData(imageName)
-		if errImg != nil {
-			return nil, nil, nil, errors.WithStack(errImg)
-		}
 		probe, err = probeFromHC(yamlData.Healthcheck, portInt)
 		if err != nil {
 			return nil, nil, nil, err
 		}
 	}
+	err = provision.ValidatePorts(yamlData.Ports, webProcessName)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	containerPorts := []apiv1.ContainerPort{
+		{ContainerPort: int32(portInt)},
+	}
+	for _, p := range provision.PortsForProcess(yamlData.Ports, process, webProcessName) {
+		containerPorts = append(containerPorts, apiv1.ContainerPort{
+			Name:          p.Name,
+			ContainerPort: int32(p.Port),
+			Protocol:      portProtocol(p),
+		})
+	}
 	maxSurge := intstr.FromString("100%")
 	maxUnavailable := intstr.FromInt(0)
 	nodeSelector := provision.NodeLabels(provision.NodeLabelsOpts{
@@ -427,9 +447,7 @@ func createAppDeployment(client *ClusterClient, oldDeployment *v1beta2.Deploymen
 			},
 			Replicas:             &realReplicas,
 			RevisionHistoryLimit: &tenRevs,
-			Selector: &metav1.LabelSelector{
-				MatchLabels: labels.ToSelector(),
-			},
+			Selector:             deploymentSelector(labels),
 			Template: apiv1.PodTemplateSpec{
 				ObjectMeta: metav1.ObjectMeta{
 					Labels:      labels.ToLabels(),
@@ -458,9 +476,7 @@ func createAppDeployment(client *ClusterClient, oldDeployment *v1beta2.Deploymen
 								Requests: resourceRequests,
 							},
 							VolumeMounts: mounts,
-							Ports: []apiv1.ContainerPort{
-								{ContainerPort: int32(portInt)},
-							},
+							Ports:        containerPorts,
 						},
 					},
 				},
@@ -471,11 +487,41 @@ func createAppDeployment(client *ClusterClient, oldDeployment *v1beta2.Deploymen
 	if oldDeployment == nil {
 		newDep, err = client.AppsV1beta2().Deployments(client.Namespace()).Create(&deployment)
 	} else {
+		// Selectors can't be changed, deployments created before canary
+		// deploys keep their selector until migrated by the first canary.
+		deployment.Spec.Selector = oldDeployment.Spec.Selector
 		newDep, err = client.AppsV1beta2().Deployments(client.Namespace()).Update(&deployment)
 	}
 	return newDep, labels, annotations, errors.WithStack(err)
 }
 
+// deploymentSelector returns the selector of the deployment of the units with
+// labels. The canary label must be missing from the units of the main
+// deployment, so each deployment only manages its own units.
+func deploymentSelector(labels *provision.LabelSet) *metav1.LabelSelector {
+	selector := &metav1.LabelSelector{MatchLabels: labels.ToSelector()}
+	if !labels.IsCanary() {
+		selector.MatchExpressions = []metav1.LabelSelectorRequirement{
+			{Key: labels.IsCanaryKey(), Operator: metav1.LabelSelectorOpDoesNotExist},
+		}
+	}
+	return selector
+}
+
+// excludesCanary reports whether selector leaves out the units of canary
+// deploys.
+func excludesCanary(selector *metav1.LabelSelector, labels *provision.LabelSet) bool {
+	if selector == nil {
+		return false
+	}
+	for _, req := range selector.MatchExpressions {
+		if req.Key == labels.IsCanaryKey() && req.Operator == metav1.LabelSelectorOpDoesNotExist {
+			return true
+		}
+	}
+	return false
+}
+
 type serviceManager struct {
 	client *ClusterClient
 	writer io.Writer
@@ -489,6 +535,14 @@ func (m *serviceManager) RemoveService(a provision.App, process string) error {
 	if err != nil && !k8sErrors.IsNotFound(err) {
 		multiErrors.Add(err)
 	}
+	err = cleanupCanaryDeployment(m.client, a, process)
+	if err != nil {
+		multiErrors.Add(err)
+	}
+	err = cleanupAutoScale(m.client, a, process)
+	if err != nil {
+		multiErrors.Add(err)
+	}
 	depName := deploymentNameForApp(a, process)
 	err = m.client.CoreV1().Services(m.client.Namespace()).Delete(depName, &metav1.DeleteOptions{
 		PropagationPolicy: propagationPtr(metav1.DeletePropagationForeground),
@@ -694,7 +748,7 @@ func (m *serviceManager) DeployService(a provision.App, process string, labels *
 	if err != nil {
 		return err
 	}
-	depName := deploymentNameForApp(a, process)
+	depName := deploymentNameForLabels(a, process, labels)
 	dep, err := m.client.AppsV1beta2().Deployments(m.client.Namespace()).Get(depName, metav1.GetOptions{})
 	if err != nil {
 		if !k8sErrors.IsNotFound(err) {
@@ -724,8 +778,17 @@ func (m *serviceManager) DeployService(a provision.App, process string, labels *
 		}
 		return provision.ErrUnitStartup{Err: err}
 	}
+	if labels.IsCanary() {
+		// Canary units are reached through the services of the main
+		// deployment, which select them as well.
+		return nil
+	}
 	targetPort := getTargetPortForImage(img)
 	port, _ := strconv.Atoi(provision.WebProcessDefaultPort())
+	svcPorts, err := servicePortsForProcess(img, process, int32(port), targetPort)
+	if err != nil {
+		return err
+	}
 	_, err = m.client.CoreV1().Services(m.client.Namespace()).Create(&apiv1.Service{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:        depName,
@@ -735,17 +798,14 @@ func (m *serviceManager) DeployService(a provision.App, process string, labels *
 		},
 		Spec: apiv1.ServiceSpec{
 			Selector: labels.ToSelector(),
-			Ports: []apiv1.ServicePort{
-				{
-					Protocol:   "TCP",
-					Port:       int32(port),
-					TargetPort: intstr.FromInt(targetPort),
-				},
-			},
-			Type: apiv1.ServiceTypeNodePort,
+			Ports:    svcPorts,
+			Type:     apiv1.ServiceTypeNodePort,
 		},
 	})
-	if err != nil && !k8sErrors.IsAlreadyExists(err) {
+	if k8sErrors.IsAlreadyExists(err) {
+		err = updateServicePorts(m.client, depName, svcPorts)
+	}
+	if err != nil {
 		return err
 	}
 	labels.SetIsHeadlessService()
@@ -775,6 +835,79 @@ func (m *serviceManager) DeployService(a provision.App, process string, labels *
 	return nil
 }
 
+// servicePortsForProcess returns the ports of the node port service of a
+// process, the HTTP port followed by the extra ports declared in the
+// tsuru.yaml of the image. Ports are only named when there are extra ports.
+func servicePortsForProcess(img, process string, port int32, targetPort int) ([]apiv1.ServicePort, error) {
+	svcPorts := []apiv1.ServicePort{
+		{
+			Protocol:   "TCP",
+			Port:       port,
+			TargetPort: intstr.FromInt(targetPort),
+		},
+	}
+	yamlData, err := image.GetImageTsuruYamlData(img)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if len(yamlData.Ports) == 0 {
+		return svcPorts, nil
+	}
+	webProcessName, err := image.GetImageWebProcessName(img)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	for _, p := range provision.PortsForProcess(yamlData.Ports, process, webProcessName) {
+		svcPorts = append(svcPorts, apiv1.ServicePort{
+			Name:       p.Name,
+			Protocol:   portProtocol(p),
+			Port:       int32(p.Port),
+			TargetPort: intstr.FromInt(p.Port),
+		})
+	}
+	if len(svcPorts) > 1 {
+		svcPorts[0].Name = provision.WebPortName
+	}
+	return svcPorts, nil
+}
+
+// updateServicePorts updates the ports of an existing service when the
+// extra ports changed, keeping the node ports already allocated.
+func updateServicePorts(client *ClusterClient, srvName string, svcPorts []apiv1.ServicePort) error {
+	srv, err := client.CoreV1().Services(client.Namespace()).Get(srvName, metav1.GetOptions{})
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	nodePorts := make(map[string]int32, len(srv.Spec.Ports))
+	changed := len(srv.Spec.Ports) != len(svcPorts)
+	for i, p := range srv.Spec.Ports {
+		nodePorts[p.Name] = p.NodePort
+		if !changed && (p.Name != svcPorts[i].Name || p.Port != svcPorts[i].Port || p.Protocol != svcPorts[i].Protocol) {
+			changed = true
+		}
+	}
+	if !changed {
+		return nil
+	}
+	if len(srv.Spec.Ports) > 0 {
+		// The HTTP port is unnamed when there are no extra ports.
+		nodePorts[svcPorts[0].Name] = srv.Spec.Ports[0].NodePort
+	}
+	for i := range svcPorts {
+		svcPorts[i].NodePort = nodePorts[svcPorts[i].Name]
+	}
+	srv.Spec.Ports = svcPorts
+	_, err = client.CoreV1().Services(client.Namespace()).Update(srv)
+	return errors.WithStack(err)
+}
+
+func portProtocol(p provision.AppPort) apiv1.Protocol {
+	if p.TransportProtocol() == provision.PortProtocolUDP {
+		return apiv1.ProtocolUDP
+	}
+	return apiv1.ProtocolTCP
+}
+
 func getTargetPortForImage(imgName string) int {
 	port := provision.WebProcessDefaultPort()
 	imageData, _ := image.GetImageMetaData(imgName)
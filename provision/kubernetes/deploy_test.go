@@ -119,6 +119,9 @@ func (s *S) TestServiceManagerDeployService(c *check.C) {
 					"tsuru.io/is-build":        "false",
 					"tsuru.io/is-isolated-run": "false",
 				},
+				MatchExpressions: []metav1.LabelSelectorRequirement{
+					{Key: "tsuru.io/is-canary", Operator: metav1.LabelSelectorOpDoesNotExist},
+				},
 			},
 			Template: apiv1.PodTemplateSpec{
 				ObjectMeta: metav1.ObjectMeta{
@@ -330,6 +333,90 @@ func (s *S) TestServiceManagerDeployServiceCustomPort(c *check.C) {
 	})
 }
 
+func (s *S) TestServiceManagerDeployServiceWithPorts(c *check.C) {
+	waitDep := s.mock.DeploymentReactions(c)
+	defer waitDep()
+	m := serviceManager{client: s.clusterClient}
+	a := &app.App{Name: "myapp", TeamOwner: s.team.Name}
+	err := app.CreateApp(a, s.user)
+	c.Assert(err, check.IsNil)
+	err = image.SaveImageCustomData("myimg", map[string]interface{}{
+		"processes": map[string]interface{}{
+			"web":    "cm1",
+			"worker": "cmd2",
+		},
+		"ports": []provision.AppPort{
+			{Name: "mqtt", Port: 1883},
+			{Name: "dns", Port: 53, Protocol: "udp", Process: "worker"},
+		},
+	})
+	c.Assert(err, check.IsNil)
+	err = servicecommon.RunServicePipeline(&m, a, "myimg", servicecommon.ProcessSpec{
+		"web": servicecommon.ProcessState{Start: true},
+	})
+	c.Assert(err, check.IsNil)
+	dep, err := s.client.Clientset.AppsV1beta2().Deployments(s.client.Namespace()).Get("myapp-web", metav1.GetOptions{})
+	c.Assert(err, check.IsNil)
+	c.Assert(dep.Spec.Template.Spec.Containers[0].Ports, check.DeepEquals, []apiv1.ContainerPort{
+		{ContainerPort: 8888},
+		{Name: "mqtt", ContainerPort: 1883, Protocol: apiv1.ProtocolTCP},
+	})
+	srv, err := s.client.CoreV1().Services(s.client.Namespace()).Get("myapp-web", metav1.GetOptions{})
+	c.Assert(err, check.IsNil)
+	c.Assert(srv.Spec.Ports, check.DeepEquals, []apiv1.ServicePort{
+		{Name: "http", Protocol: "TCP", Port: 8888, TargetPort: intstr.FromInt(8888)},
+		{Name: "mqtt", Protocol: "TCP", Port: 1883, TargetPort: intstr.FromInt(1883)},
+	})
+	srv.Spec.Ports[0].NodePort = 30000
+	srv.Spec.Ports[1].NodePort = 30001
+	_, err = s.client.CoreV1().Services(s.client.Namespace()).Update(srv)
+	c.Assert(err, check.IsNil)
+	err = image.SaveImageCustomData("myimg2", map[string]interface{}{
+		"processes": map[string]interface{}{
+			"web":    "cm1",
+			"worker": "cmd2",
+		},
+		"ports": []provision.AppPort{
+			{Name: "mqtt", Port: 1883},
+			{Name: "api", Port: 9000, Protocol: "grpc"},
+		},
+	})
+	c.Assert(err, check.IsNil)
+	err = servicecommon.RunServicePipeline(&m, a, "myimg2", servicecommon.ProcessSpec{
+		"web": servicecommon.ProcessState{Start: true},
+	})
+	c.Assert(err, check.IsNil)
+	srv, err = s.client.CoreV1().Services(s.client.Namespace()).Get("myapp-web", metav1.GetOptions{})
+	c.Assert(err, check.IsNil)
+	c.Assert(srv.Spec.Ports, check.DeepEquals, []apiv1.ServicePort{
+		{Name: "http", Protocol: "TCP", Port: 8888, TargetPort: intstr.FromInt(8888), NodePort: 30000},
+		{Name: "mqtt", Protocol: "TCP", Port: 1883, TargetPort: intstr.FromInt(1883), NodePort: 30001},
+		{Name: "api", Protocol: "TCP", Port: 9000, TargetPort: intstr.FromInt(9000)},
+	})
+}
+
+func (s *S) TestServiceManagerDeployServiceInvalidPorts(c *check.C) {
+	waitDep := s.mock.DeploymentReactions(c)
+	defer waitDep()
+	m := serviceManager{client: s.clusterClient}
+	a := &app.App{Name: "myapp", TeamOwner: s.team.Name}
+	err := app.CreateApp(a, s.user)
+	c.Assert(err, check.IsNil)
+	err = image.SaveImageCustomData("myimg", map[string]interface{}{
+		"processes": map[string]interface{}{
+			"web": "cm1",
+		},
+		"ports": []provision.AppPort{
+			{Name: "mqtt", Port: 1883, Protocol: "sctp"},
+		},
+	})
+	c.Assert(err, check.IsNil)
+	err = servicecommon.RunServicePipeline(&m, a, "myimg", servicecommon.ProcessSpec{
+		"web": servicecommon.ProcessState{Start: true},
+	})
+	c.Assert(err, check.ErrorMatches, `.*invalid protocol "sctp" for port "mqtt", it must be tcp, udp or grpc`)
+}
+
 func (s *S) TestServiceManagerDeployServiceUpdateStates(c *check.C) {
 	waitDep := s.mock.DeploymentReactions(c)
 	defer waitDep()
@@ -56,6 +56,17 @@ func deploymentNameForApp(a provision.App, process string) string {
 	return fmt.Sprintf("%s-%s", name, process)
 }
 
+func canaryDeploymentNameForApp(a provision.App, process string) string {
+	return fmt.Sprintf("%s-canary", deploymentNameForApp(a, process))
+}
+
+func deploymentNameForLabels(a provision.App, process string, labels *provision.LabelSet) string {
+	if labels.IsCanary() {
+		return canaryDeploymentNameForApp(a, process)
+	}
+	return deploymentNameForApp(a, process)
+}
+
 func headlessServiceNameForApp(a provision.App, process string) string {
 	name := strings.ToLower(kubeNameRegex.ReplaceAllString(a.GetName(), "-"))
 	process = strings.ToLower(kubeNameRegex.ReplaceAllString(process, "-"))
@@ -134,6 +145,20 @@ func waitFor(timeout time.Duration, fn func() (bool, error), onTimeout func() er
 }
 
 func podsForAppProcess(client *ClusterClient, a provision.App, process string) (*apiv1.PodList, error) {
+	selector, err := podSelectorForAppProcess(a, process)
+	if err != nil {
+		return nil, err
+	}
+	podList, err := client.CoreV1().Pods(client.Namespace()).List(metav1.ListOptions{
+		LabelSelector: selector,
+	})
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return podList, nil
+}
+
+func podSelectorForAppProcess(a provision.App, process string) (string, error) {
 	labelOpts := provision.ServiceLabelsOpts{
 		App:     a,
 		Process: process,
@@ -144,7 +169,7 @@ func podsForAppProcess(client *ClusterClient, a provision.App, process string) (
 	}
 	l, err := provision.ServiceLabels(labelOpts)
 	if err != nil {
-		return nil, errors.WithStack(err)
+		return "", errors.WithStack(err)
 	}
 	var selector map[string]string
 	if process == "" {
@@ -152,13 +177,7 @@ func podsForAppProcess(client *ClusterClient, a provision.App, process string) (
 	} else {
 		selector = l.ToSelector()
 	}
-	podList, err := client.CoreV1().Pods(client.Namespace()).List(metav1.ListOptions{
-		LabelSelector: labels.SelectorFromSet(labels.Set(selector)).String(),
-	})
-	if err != nil {
-		return nil, errors.WithStack(err)
-	}
-	return podList, nil
+	return labels.SelectorFromSet(labels.Set(selector)).String(), nil
 }
 
 func allNewPodsRunning(client *ClusterClient, a provision.App, process string, generation int64) (bool, error) {
@@ -376,6 +395,17 @@ func cleanupDeployment(client *ClusterClient, a provision.App, process string) e
 	})
 }
 
+func cleanupCanaryDeployment(client *ClusterClient, a provision.App, process string) error {
+	depName := canaryDeploymentNameForApp(a, process)
+	err := client.AppsV1beta2().Deployments(client.Namespace()).Delete(depName, &metav1.DeleteOptions{
+		PropagationPolicy: propagationPtr(metav1.DeletePropagationForeground),
+	})
+	if err != nil && !k8sErrors.IsNotFound(err) {
+		return errors.WithStack(err)
+	}
+	return nil
+}
+
 func cleanupDaemonSet(client *ClusterClient, name, pool string) error {
 	dsName := daemonSetName(name, pool)
 	err := client.AppsV1beta2().DaemonSets(client.Namespace()).Delete(dsName, &metav1.DeleteOptions{
@@ -439,6 +469,24 @@ func getServicePort(client *ClusterClient, srvName string) (int32, error) {
 	return srv.Spec.Ports[0].NodePort, nil
 }
 
+// getServiceNamedPort returns the node port of the port with the given name
+// in the service, or zero if the service or the port doesn't exist.
+func getServiceNamedPort(client *ClusterClient, srvName, portName string) (int32, error) {
+	srv, err := client.CoreV1().Services(client.Namespace()).Get(srvName, metav1.GetOptions{})
+	if err != nil {
+		if k8sErrors.IsNotFound(err) {
+			return 0, nil
+		}
+		return 0, errors.WithStack(err)
+	}
+	for _, p := range srv.Spec.Ports {
+		if p.Name == portName {
+			return p.NodePort, nil
+		}
+	}
+	return 0, nil
+}
+
 func labelSetFromMeta(meta *metav1.ObjectMeta) *provision.LabelSet {
 	merged := make(map[string]string, len(meta.Labels)+len(meta.Annotations))
 	for k, v := range meta.Labels {
@@ -0,0 +1,652 @@
+// Copyright 2018 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package kubernetes
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/tsuru/config"
+	"github.com/tsuru/tsuru/router"
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/api/extensions/v1beta1"
+	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+const (
+	ingressRouterType       = "ingress"
+	ingressClassAnnotation  = "kubernetes.io/ingress.class"
+	ingressRouterNameLabel  = tsuruLabelPrefix + "router-name"
+	ingressBackendNameLabel = tsuruLabelPrefix + "router-backend"
+	ingressServicePortName  = "http"
+	ingressServicePort      = 80
+)
+
+func init() {
+	router.Register(ingressRouterType, createIngressRouter)
+}
+
+// ingressRouter is a router that programs Ingress resources in the cluster
+// where the app is running. Each backend is made of a Service without
+// selector, whose Endpoints are the routes of the backend, and of an Ingress
+// with one rule for the backend address and one rule for each cname.
+type ingressRouter struct {
+	routerName   string
+	domain       string
+	ingressClass string
+}
+
+var (
+	_ router.Router       = &ingressRouter{}
+	_ router.CNameRouter  = &ingressRouter{}
+	_ router.TLSRouter    = &ingressRouter{}
+	_ router.StatusRouter = &ingressRouter{}
+)
+
+func createIngressRouter(routerName, configPrefix string) (router.Router, error) {
+	domain, err := config.GetString(configPrefix + ":domain")
+	if err != nil {
+		return nil, err
+	}
+	ingressClass, _ := config.GetString(configPrefix + ":ingress-class")
+	return &ingressRouter{
+		routerName:   routerName,
+		domain:       domain,
+		ingressClass: ingressClass,
+	}, nil
+}
+
+func (r *ingressRouter) GetName() string {
+	return r.routerName
+}
+
+func (r *ingressRouter) resourceName(backend string) string {
+	name := strings.ToLower(kubeNameRegex.ReplaceAllString(backend, "-"))
+	routerName := strings.ToLower(kubeNameRegex.ReplaceAllString(r.routerName, "-"))
+	return fmt.Sprintf("%s-%s", name, routerName)
+}
+
+func (r *ingressRouter) secretName(backend, cname string) string {
+	cname = strings.ToLower(kubeNameRegex.ReplaceAllString(cname, "-"))
+	return fmt.Sprintf("%s-%s-tls", r.resourceName(backend), cname)
+}
+
+func (r *ingressRouter) backendHost(backend string) string {
+	return fmt.Sprintf("%s.%s", backend, r.domain)
+}
+
+func (r *ingressRouter) labels(backend string) map[string]string {
+	return map[string]string{
+		ingressRouterNameLabel:  r.routerName,
+		ingressBackendNameLabel: backend,
+	}
+}
+
+func (r *ingressRouter) ingressRule(backend, host string) v1beta1.IngressRule {
+	return v1beta1.IngressRule{
+		Host: host,
+		IngressRuleValue: v1beta1.IngressRuleValue{
+			HTTP: &v1beta1.HTTPIngressRuleValue{
+				Paths: []v1beta1.HTTPIngressPath{
+					{
+						Backend: v1beta1.IngressBackend{
+							ServiceName: r.resourceName(backend),
+							ServicePort: intstr.FromInt(ingressServicePort),
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+// backendCluster returns the cluster holding the resources of the backend,
+// looking for them in every cluster as only AddBackend receives the app.
+func (r *ingressRouter) backendCluster(backend string) (*ClusterClient, error) {
+	clients, err := allClusters()
+	if err != nil {
+		return nil, err
+	}
+	for _, client := range clients {
+		_, err = client.CoreV1().Services(client.Namespace()).Get(r.resourceName(backend), metav1.GetOptions{})
+		if err == nil {
+			return client, nil
+		}
+		if !k8sErrors.IsNotFound(err) {
+			return nil, err
+		}
+	}
+	return nil, router.ErrBackendNotFound
+}
+
+// backend returns the name of the backend currently associated with name,
+// which may differ after a swap, and the cluster holding its resources.
+func (r *ingressRouter) backend(name string) (string, *ClusterClient, error) {
+	usedName, err := router.Retrieve(name)
+	if err != nil {
+		return "", nil, err
+	}
+	client, err := r.backendCluster(usedName)
+	if err != nil {
+		return "", nil, err
+	}
+	return usedName, client, nil
+}
+
+func (r *ingressRouter) getIngress(client *ClusterClient, backend string) (*v1beta1.Ingress, error) {
+	ingress, err := client.ExtensionsV1beta1().Ingresses(client.Namespace()).Get(r.resourceName(backend), metav1.GetOptions{})
+	if err != nil {
+		if k8sErrors.IsNotFound(err) {
+			return nil, router.ErrBackendNotFound
+		}
+		return nil, err
+	}
+	return ingress, nil
+}
+
+func (r *ingressRouter) updateIngress(client *ClusterClient, ingress *v1beta1.Ingress) error {
+	_, err := client.ExtensionsV1beta1().Ingresses(client.Namespace()).Update(ingress)
+	return err
+}
+
+func (r *ingressRouter) AddBackend(app router.App) (err error) {
+	done := router.InstrumentRequest(r.routerName)
+	defer func() {
+		done(err)
+	}()
+	name := app.GetName()
+	client, err := clusterForPool(app.GetPool())
+	if err != nil {
+		return err
+	}
+	resourceName := r.resourceName(name)
+	ns := client.Namespace()
+	_, err = client.CoreV1().Services(ns).Get(resourceName, metav1.GetOptions{})
+	if err == nil {
+		return router.ErrBackendExists
+	}
+	if !k8sErrors.IsNotFound(err) {
+		return &router.RouterError{Err: err, Op: "add-backend"}
+	}
+	objMeta := metav1.ObjectMeta{
+		Name:      resourceName,
+		Namespace: ns,
+		Labels:    r.labels(name),
+	}
+	_, err = client.CoreV1().Services(ns).Create(&apiv1.Service{
+		ObjectMeta: objMeta,
+		Spec: apiv1.ServiceSpec{
+			Ports: []apiv1.ServicePort{
+				{Name: ingressServicePortName, Protocol: apiv1.ProtocolTCP, Port: ingressServicePort},
+			},
+			Type: apiv1.ServiceTypeClusterIP,
+		},
+	})
+	if err != nil {
+		return &router.RouterError{Err: err, Op: "add-backend"}
+	}
+	_, err = client.CoreV1().Endpoints(ns).Create(&apiv1.Endpoints{ObjectMeta: objMeta})
+	if err != nil {
+		client.CoreV1().Services(ns).Delete(resourceName, &metav1.DeleteOptions{})
+		return &router.RouterError{Err: err, Op: "add-backend"}
+	}
+	ingressMeta := objMeta
+	if r.ingressClass != "" {
+		ingressMeta.Annotations = map[string]string{ingressClassAnnotation: r.ingressClass}
+	}
+	_, err = client.ExtensionsV1beta1().Ingresses(ns).Create(&v1beta1.Ingress{
+		ObjectMeta: ingressMeta,
+		Spec: v1beta1.IngressSpec{
+			Rules: []v1beta1.IngressRule{r.ingressRule(name, r.backendHost(name))},
+		},
+	})
+	if err != nil {
+		client.CoreV1().Endpoints(ns).Delete(resourceName, &metav1.DeleteOptions{})
+		client.CoreV1().Services(ns).Delete(resourceName, &metav1.DeleteOptions{})
+		return &router.RouterError{Err: err, Op: "add-backend"}
+	}
+	return router.Store(name, name, ingressRouterType)
+}
+
+func (r *ingressRouter) RemoveBackend(name string) (err error) {
+	done := router.InstrumentRequest(r.routerName)
+	defer func() {
+		done(err)
+	}()
+	usedName, client, err := r.backend(name)
+	if err != nil {
+		return err
+	}
+	if usedName != name {
+		return router.ErrBackendSwapped
+	}
+	resourceName := r.resourceName(name)
+	ns := client.Namespace()
+	err = client.ExtensionsV1beta1().Ingresses(ns).Delete(resourceName, &metav1.DeleteOptions{})
+	if err != nil && !k8sErrors.IsNotFound(err) {
+		return &router.RouterError{Err: err, Op: "remove-backend"}
+	}
+	secrets, err := client.CoreV1().Secrets(ns).List(metav1.ListOptions{
+		LabelSelector: labels.SelectorFromSet(labels.Set(r.labels(name))).String(),
+	})
+	if err != nil {
+		return &router.RouterError{Err: err, Op: "remove-backend"}
+	}
+	for _, secret := range secrets.Items {
+		err = client.CoreV1().Secrets(ns).Delete(secret.Name, &metav1.DeleteOptions{})
+		if err != nil && !k8sErrors.IsNotFound(err) {
+			return &router.RouterError{Err: err, Op: "remove-backend"}
+		}
+	}
+	err = client.CoreV1().Endpoints(ns).Delete(resourceName, &metav1.DeleteOptions{})
+	if err != nil && !k8sErrors.IsNotFound(err) {
+		return &router.RouterError{Err: err, Op: "remove-backend"}
+	}
+	err = client.CoreV1().Services(ns).Delete(resourceName, &metav1.DeleteOptions{})
+	if err != nil && !k8sErrors.IsNotFound(err) {
+		return &router.RouterError{Err: err, Op: "remove-backend"}
+	}
+	return nil
+}
+
+// routeAddresses maps each port to the addresses of the routes using it,
+// Endpoints only accept IP addresses so routes must not use hostnames.
+func routeAddresses(routes []*url.URL) (map[int32][]string, error) {
+	ports := map[int32][]string{}
+	for _, route := range routes {
+		host, portStr, _ := net.SplitHostPort(routeHostPort(route))
+		if net.ParseIP(host) == nil {
+			return nil, errors.Errorf("invalid route %q: only IP addresses are supported", route.String())
+		}
+		port, err := strconv.Atoi(portStr)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid route %q", route.String())
+		}
+		ports[int32(port)] = append(ports[int32(port)], host)
+	}
+	return ports, nil
+}
+
+func (r *ingressRouter) setRoutes(client *ClusterClient, backend string, routes []*url.URL) error {
+	ports, err := routeAddresses(routes)
+	if err != nil {
+		return err
+	}
+	endpoints, err := client.CoreV1().Endpoints(client.Namespace()).Get(r.resourceName(backend), metav1.GetOptions{})
+	if err != nil {
+		if k8sErrors.IsNotFound(err) {
+			return router.ErrBackendNotFound
+		}
+		return err
+	}
+	portNumbers := make([]int, 0, len(ports))
+	for port := range ports {
+		portNumbers = append(portNumbers, int(port))
+	}
+	sort.Ints(portNumbers)
+	subsets := make([]apiv1.EndpointSubset, len(portNumbers))
+	for i, port := range portNumbers {
+		hosts := ports[int32(port)]
+		sort.Strings(hosts)
+		addrs := make([]apiv1.EndpointAddress, len(hosts))
+		for j, host := range hosts {
+			addrs[j] = apiv1.EndpointAddress{IP: host}
+		}
+		subsets[i] = apiv1.EndpointSubset{
+			Addresses: addrs,
+			Ports: []apiv1.EndpointPort{
+				{Name: ingressServicePortName, Port: int32(port), Protocol: apiv1.ProtocolTCP},
+			},
+		}
+	}
+	endpoints.Subsets = subsets
+	_, err = client.CoreV1().Endpoints(client.Namespace()).Update(endpoints)
+	return err
+}
+
+func (r *ingressRouter) routes(client *ClusterClient, backend string) ([]*url.URL, error) {
+	endpoints, err := client.CoreV1().Endpoints(client.Namespace()).Get(r.resourceName(backend), metav1.GetOptions{})
+	if err != nil {
+		if k8sErrors.IsNotFound(err) {
+			return nil, router.ErrBackendNotFound
+		}
+		return nil, err
+	}
+	var routes []*url.URL
+	for _, subset := range endpoints.Subsets {
+		for _, port := range subset.Ports {
+			for _, addr := range subset.Addresses {
+				routes = append(routes, &url.URL{
+					Scheme: router.HttpScheme,
+					Host:   net.JoinHostPort(addr.IP, strconv.Itoa(int(port.Port))),
+				})
+			}
+		}
+	}
+	return routes, nil
+}
+
+func (r *ingressRouter) AddRoutes(name string, addresses []*url.URL) (err error) {
+	done := router.InstrumentRequest(r.routerName)
+	defer func() {
+		done(err)
+	}()
+	usedName, client, err := r.backend(name)
+	if err != nil {
+		return err
+	}
+	current, err := r.routes(client, usedName)
+	if err != nil {
+		return err
+	}
+	routes := current
+	for _, addr := range addresses {
+		if !containsRoute(current, addr) {
+			routes = append(routes, addr)
+		}
+	}
+	err = r.setRoutes(client, usedName, routes)
+	if err != nil {
+		return &router.RouterError{Err: err, Op: "add-routes"}
+	}
+	return nil
+}
+
+func (r *ingressRouter) RemoveRoutes(name string, addresses []*url.URL) (err error) {
+	done := router.InstrumentRequest(r.routerName)
+	defer func() {
+		done(err)
+	}()
+	usedName, client, err := r.backend(name)
+	if err != nil {
+		return err
+	}
+	current, err := r.routes(client, usedName)
+	if err != nil {
+		return err
+	}
+	var routes []*url.URL
+	for _, route := range current {
+		if !containsRoute(addresses, route) {
+			routes = append(routes, route)
+		}
+	}
+	err = r.setRoutes(client, usedName, routes)
+	if err != nil {
+		return &router.RouterError{Err: err, Op: "remove-routes"}
+	}
+	return nil
+}
+
+func containsRoute(routes []*url.URL, route *url.URL) bool {
+	for _, r := range routes {
+		if routeHostPort(r) == routeHostPort(route) {
+			return true
+		}
+	}
+	return false
+}
+
+// routeHostPort returns the host of the route including the port, which
+// defaults to 80 when omitted.
+func routeHostPort(route *url.URL) string {
+	if route.Port() != "" {
+		return route.Host
+	}
+	return net.JoinHostPort(route.Hostname(), strconv.Itoa(ingressServicePort))
+}
+
+func (r *ingressRouter) Routes(name string) (routes []*url.URL, err error) {
+	done := router.InstrumentRequest(r.routerName)
+	defer func() {
+		done(err)
+	}()
+	usedName, client, err := r.backend(name)
+	if err != nil {
+		return nil, err
+	}
+	return r.routes(client, usedName)
+}
+
+func (r *ingressRouter) Addr(name string) (addr string, err error) {
+	done := router.InstrumentRequest(r.routerName)
+	defer func() {
+		done(err)
+	}()
+	usedName, client, err := r.backend(name)
+	if err != nil {
+		return "", err
+	}
+	_, err = r.getIngress(client, usedName)
+	if err != nil {
+		if err == router.ErrBackendNotFound {
+			return "", router.ErrRouteNotFound
+		}
+		return "", err
+	}
+	return r.backendHost(usedName), nil
+}
+
+func (r *ingressRouter) Swap(backend1, backend2 string, cnameOnly bool) (err error) {
+	done := router.InstrumentRequest(r.routerName)
+	defer func() {
+		done(err)
+	}()
+	return router.Swap(r, backend1, backend2, cnameOnly)
+}
+
+func (r *ingressRouter) SetCName(cname, name string) (err error) {
+	done := router.InstrumentRequest(r.routerName)
+	defer func() {
+		done(err)
+	}()
+	if !router.ValidCName(cname, r.domain) {
+		return router.ErrCNameNotAllowed
+	}
+	usedName, client, err := r.backend(name)
+	if err != nil {
+		return err
+	}
+	ingresses, err := client.ExtensionsV1beta1().Ingresses(client.Namespace()).List(metav1.ListOptions{
+		LabelSelector: labels.SelectorFromSet(labels.Set{ingressRouterNameLabel: r.routerName}).String(),
+	})
+	if err != nil {
+		return &router.RouterError{Err: err, Op: "set-cname"}
+	}
+	for _, ing := range ingresses.Items {
+		for _, rule := range ing.Spec.Rules {
+			if rule.Host == cname {
+				return router.ErrCNameExists
+			}
+		}
+	}
+	ingress, err := r.getIngress(client, usedName)
+	if err != nil {
+		return err
+	}
+	ingress.Spec.Rules = append(ingress.Spec.Rules, r.ingressRule(usedName, cname))
+	err = r.updateIngress(client, ingress)
+	if err != nil {
+		return &router.RouterError{Err: err, Op: "set-cname"}
+	}
+	return nil
+}
+
+func (r *ingressRouter) UnsetCName(cname, name string) (err error) {
+	done := router.InstrumentRequest(r.routerName)
+	defer func() {
+		done(err)
+	}()
+	usedName, client, err := r.backend(name)
+	if err != nil {
+		return err
+	}
+	ingress, err := r.getIngress(client, usedName)
+	if err != nil {
+		return err
+	}
+	for i, rule := range ingress.Spec.Rules {
+		if rule.Host == cname && cname != r.backendHost(usedName) {
+			ingress.Spec.Rules = append(ingress.Spec.Rules[:i], ingress.Spec.Rules[i+1:]...)
+			err = r.updateIngress(client, ingress)
+			if err != nil {
+				return &router.RouterError{Err: err, Op: "unset-cname"}
+			}
+			return nil
+		}
+	}
+	return router.ErrCNameNotFound
+}
+
+func (r *ingressRouter) CNames(name string) (urls []*url.URL, err error) {
+	done := router.InstrumentRequest(r.routerName)
+	defer func() {
+		done(err)
+	}()
+	usedName, client, err := r.backend(name)
+	if err != nil {
+		return nil, err
+	}
+	ingress, err := r.getIngress(client, usedName)
+	if err != nil {
+		return nil, err
+	}
+	urls = []*url.URL{}
+	for _, rule := range ingress.Spec.Rules {
+		if rule.Host != r.backendHost(usedName) {
+			urls = append(urls, &url.URL{Host: rule.Host})
+		}
+	}
+	return urls, nil
+}
+
+func (r *ingressRouter) AddCertificate(app router.App, cname, certificate, key string) (err error) {
+	done := router.InstrumentRequest(r.routerName)
+	defer func() {
+		done(err)
+	}()
+	usedName, client, err := r.backend(app.GetName())
+	if err != nil {
+		return err
+	}
+	ingress, err := r.getIngress(client, usedName)
+	if err != nil {
+		return err
+	}
+	secretName := r.secretName(usedName, cname)
+	secret := &apiv1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      secretName,
+			Namespace: client.Namespace(),
+			Labels:    r.labels(usedName),
+		},
+		Type: apiv1.SecretTypeTLS,
+		Data: map[string][]byte{
+			apiv1.TLSCertKey:       []byte(certificate),
+			apiv1.TLSPrivateKeyKey: []byte(key),
+		},
+	}
+	_, err = client.CoreV1().Secrets(client.Namespace()).Create(secret)
+	if k8sErrors.IsAlreadyExists(err) {
+		_, err = client.CoreV1().Secrets(client.Namespace()).Update(secret)
+	}
+	if err != nil {
+		return &router.RouterError{Err: err, Op: "add-certificate"}
+	}
+	for _, tls := range ingress.Spec.TLS {
+		if tls.SecretName == secretName {
+			return nil
+		}
+	}
+	ingress.Spec.TLS = append(ingress.Spec.TLS, v1beta1.IngressTLS{
+		Hosts:      []string{cname},
+		SecretName: secretName,
+	})
+	err = r.updateIngress(client, ingress)
+	if err != nil {
+		return &router.RouterError{Err: err, Op: "add-certificate"}
+	}
+	return nil
+}
+
+func (r *ingressRouter) RemoveCertificate(app router.App, cname string) (err error) {
+	done := router.InstrumentRequest(r.routerName)
+	defer func() {
+		done(err)
+	}()
+	usedName, client, err := r.backend(app.GetName())
+	if err != nil {
+		return err
+	}
+	ingress, err := r.getIngress(client, usedName)
+	if err != nil {
+		return err
+	}
+	secretName := r.secretName(usedName, cname)
+	for i, tls := range ingress.Spec.TLS {
+		if tls.SecretName == secretName {
+			ingress.Spec.TLS = append(ingress.Spec.TLS[:i], ingress.Spec.TLS[i+1:]...)
+			err = r.updateIngress(client, ingress)
+			if err != nil {
+				return &router.RouterError{Err: err, Op: "remove-certificate"}
+			}
+			break
+		}
+	}
+	err = client.CoreV1().Secrets(client.Namespace()).Delete(secretName, &metav1.DeleteOptions{})
+	if err != nil {
+		if k8sErrors.IsNotFound(err) {
+			return router.ErrCertificateNotFound
+		}
+		return &router.RouterError{Err: err, Op: "remove-certificate"}
+	}
+	return nil
+}
+
+func (r *ingressRouter) GetCertificate(app router.App, cname string) (certificate string, err error) {
+	done := router.InstrumentRequest(r.routerName)
+	defer func() {
+		done(err)
+	}()
+	usedName, client, err := r.backend(app.GetName())
+	if err != nil {
+		return "", err
+	}
+	secret, err := client.CoreV1().Secrets(client.Namespace()).Get(r.secretName(usedName, cname), metav1.GetOptions{})
+	if err != nil {
+		if k8sErrors.IsNotFound(err) {
+			return "", router.ErrCertificateNotFound
+		}
+		return "", &router.RouterError{Err: err, Op: "get-certificate"}
+	}
+	return string(secret.Data[apiv1.TLSCertKey]), nil
+}
+
+func (r *ingressRouter) GetBackendStatus(name string) (status router.BackendStatus, detail string, err error) {
+	done := router.InstrumentRequest(r.routerName)
+	defer func() {
+		done(err)
+	}()
+	usedName, client, err := r.backend(name)
+	if err != nil {
+		return "", "", err
+	}
+	ingress, err := r.getIngress(client, usedName)
+	if err != nil {
+		return "", "", err
+	}
+	if len(ingress.Status.LoadBalancer.Ingress) == 0 {
+		return router.BackendStatusNotReady, "waiting for ingress load balancer address", nil
+	}
+	return router.BackendStatusReady, "", nil
+}
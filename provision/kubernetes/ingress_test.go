@@ -0,0 +1,210 @@
+// Copyright 2018 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package kubernetes
+
+import (
+	"net/url"
+
+	"github.com/tsuru/config"
+	"github.com/tsuru/tsuru/router"
+	"github.com/tsuru/tsuru/router/routertest"
+	"gopkg.in/check.v1"
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/api/extensions/v1beta1"
+	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	ktesting "k8s.io/client-go/testing"
+)
+
+func init() {
+	base := &S{}
+	suite := &routertest.RouterSuite{
+		SetUpSuiteFunc:    base.SetUpSuite,
+		TearDownSuiteFunc: base.TearDownSuite,
+	}
+	suite.SetUpTestFunc = func(c *check.C) {
+		config.Set("routers:ingress:type", "ingress")
+		config.Set("routers:ingress:domain", "ingress.example.com")
+		base.SetUpTest(c)
+		base.client.PrependReactor("create", "ingresses", ingressLoadBalancerReaction)
+		r, err := router.Get("ingress")
+		c.Assert(err, check.IsNil)
+		suite.Router = r
+	}
+	check.Suite(suite)
+}
+
+func ingressLoadBalancerReaction(action ktesting.Action) (bool, runtime.Object, error) {
+	ingress := action.(ktesting.CreateAction).GetObject().(*v1beta1.Ingress)
+	ingress.Status.LoadBalancer.Ingress = []apiv1.LoadBalancerIngress{{IP: "192.168.99.1"}}
+	return false, nil, nil
+}
+
+func (s *S) newIngressRouter(c *check.C) *ingressRouter {
+	config.Set("routers:myingress:type", "ingress")
+	config.Set("routers:myingress:domain", "ingress.example.com")
+	config.Set("routers:myingress:ingress-class", "nginx")
+	r, err := router.Get("myingress")
+	c.Assert(err, check.IsNil)
+	return r.(*ingressRouter)
+}
+
+func (s *S) TestIngressRouterAddBackend(c *check.C) {
+	r := s.newIngressRouter(c)
+	err := r.AddBackend(routertest.FakeApp{Name: "myapp"})
+	c.Assert(err, check.IsNil)
+	ns := s.client.Namespace()
+	expectedLabels := map[string]string{
+		"tsuru.io/router-name":    "myingress",
+		"tsuru.io/router-backend": "myapp",
+	}
+	svc, err := s.client.CoreV1().Services(ns).Get("myapp-myingress", metav1.GetOptions{})
+	c.Assert(err, check.IsNil)
+	c.Assert(svc.Labels, check.DeepEquals, expectedLabels)
+	c.Assert(svc.Spec.Selector, check.IsNil)
+	c.Assert(svc.Spec.Ports, check.DeepEquals, []apiv1.ServicePort{
+		{Name: "http", Protocol: apiv1.ProtocolTCP, Port: 80},
+	})
+	endpoints, err := s.client.CoreV1().Endpoints(ns).Get("myapp-myingress", metav1.GetOptions{})
+	c.Assert(err, check.IsNil)
+	c.Assert(endpoints.Subsets, check.HasLen, 0)
+	ingress, err := s.client.ExtensionsV1beta1().Ingresses(ns).Get("myapp-myingress", metav1.GetOptions{})
+	c.Assert(err, check.IsNil)
+	c.Assert(ingress.Labels, check.DeepEquals, expectedLabels)
+	c.Assert(ingress.Annotations, check.DeepEquals, map[string]string{"kubernetes.io/ingress.class": "nginx"})
+	c.Assert(ingress.Spec.Rules, check.DeepEquals, []v1beta1.IngressRule{
+		{
+			Host: "myapp.ingress.example.com",
+			IngressRuleValue: v1beta1.IngressRuleValue{
+				HTTP: &v1beta1.HTTPIngressRuleValue{
+					Paths: []v1beta1.HTTPIngressPath{
+						{Backend: v1beta1.IngressBackend{ServiceName: "myapp-myingress", ServicePort: intstr.FromInt(80)}},
+					},
+				},
+			},
+		},
+	})
+	addr, err := r.Addr("myapp")
+	c.Assert(err, check.IsNil)
+	c.Assert(addr, check.Equals, "myapp.ingress.example.com")
+}
+
+func (s *S) TestIngressRouterAddRoutes(c *check.C) {
+	r := s.newIngressRouter(c)
+	err := r.AddBackend(routertest.FakeApp{Name: "myapp"})
+	c.Assert(err, check.IsNil)
+	addr1, _ := url.Parse("http://10.0.0.2:30001")
+	addr2, _ := url.Parse("http://10.0.0.1:30001")
+	addr3, _ := url.Parse("http://10.0.0.1")
+	err = r.AddRoutes("myapp", []*url.URL{addr1, addr2, addr3})
+	c.Assert(err, check.IsNil)
+	endpoints, err := s.client.CoreV1().Endpoints(s.client.Namespace()).Get("myapp-myingress", metav1.GetOptions{})
+	c.Assert(err, check.IsNil)
+	c.Assert(endpoints.Subsets, check.DeepEquals, []apiv1.EndpointSubset{
+		{
+			Addresses: []apiv1.EndpointAddress{{IP: "10.0.0.1"}},
+			Ports:     []apiv1.EndpointPort{{Name: "http", Port: 80, Protocol: apiv1.ProtocolTCP}},
+		},
+		{
+			Addresses: []apiv1.EndpointAddress{{IP: "10.0.0.1"}, {IP: "10.0.0.2"}},
+			Ports:     []apiv1.EndpointPort{{Name: "http", Port: 30001, Protocol: apiv1.ProtocolTCP}},
+		},
+	})
+	err = r.RemoveRoutes("myapp", []*url.URL{addr3, addr1})
+	c.Assert(err, check.IsNil)
+	routes, err := r.Routes("myapp")
+	c.Assert(err, check.IsNil)
+	c.Assert(routes, check.DeepEquals, []*url.URL{{Scheme: "http", Host: "10.0.0.1:30001"}})
+}
+
+func (s *S) TestIngressRouterAddRoutesInvalidAddress(c *check.C) {
+	r := s.newIngressRouter(c)
+	err := r.AddBackend(routertest.FakeApp{Name: "myapp"})
+	c.Assert(err, check.IsNil)
+	addr, _ := url.Parse("http://node1.example.com:30001")
+	err = r.AddRoutes("myapp", []*url.URL{addr})
+	c.Assert(err, check.ErrorMatches, `.*invalid route "http://node1.example.com:30001": only IP addresses are supported`)
+}
+
+func (s *S) TestIngressRouterCertificate(c *check.C) {
+	r := s.newIngressRouter(c)
+	a := routertest.FakeApp{Name: "myapp"}
+	err := r.AddBackend(a)
+	c.Assert(err, check.IsNil)
+	err = r.SetCName("myapp.io", "myapp")
+	c.Assert(err, check.IsNil)
+	err = r.AddCertificate(a, "myapp.io", "cert-data", "key-data")
+	c.Assert(err, check.IsNil)
+	ns := s.client.Namespace()
+	secret, err := s.client.CoreV1().Secrets(ns).Get("myapp-myingress-myapp.io-tls", metav1.GetOptions{})
+	c.Assert(err, check.IsNil)
+	c.Assert(secret.Type, check.Equals, apiv1.SecretTypeTLS)
+	c.Assert(secret.Data, check.DeepEquals, map[string][]byte{
+		"tls.crt": []byte("cert-data"),
+		"tls.key": []byte("key-data"),
+	})
+	ingress, err := s.client.ExtensionsV1beta1().Ingresses(ns).Get("myapp-myingress", metav1.GetOptions{})
+	c.Assert(err, check.IsNil)
+	c.Assert(ingress.Spec.TLS, check.DeepEquals, []v1beta1.IngressTLS{
+		{Hosts: []string{"myapp.io"}, SecretName: "myapp-myingress-myapp.io-tls"},
+	})
+	err = r.AddCertificate(a, "myapp.io", "new-cert-data", "new-key-data")
+	c.Assert(err, check.IsNil)
+	cert, err := r.GetCertificate(a, "myapp.io")
+	c.Assert(err, check.IsNil)
+	c.Assert(cert, check.Equals, "new-cert-data")
+	err = r.RemoveCertificate(a, "myapp.io")
+	c.Assert(err, check.IsNil)
+	ingress, err = s.client.ExtensionsV1beta1().Ingresses(ns).Get("myapp-myingress", metav1.GetOptions{})
+	c.Assert(err, check.IsNil)
+	c.Assert(ingress.Spec.TLS, check.HasLen, 0)
+	_, err = r.GetCertificate(a, "myapp.io")
+	c.Assert(err, check.Equals, router.ErrCertificateNotFound)
+	err = r.RemoveCertificate(a, "myapp.io")
+	c.Assert(err, check.Equals, router.ErrCertificateNotFound)
+}
+
+func (s *S) TestIngressRouterRemoveBackend(c *check.C) {
+	r := s.newIngressRouter(c)
+	a := routertest.FakeApp{Name: "myapp"}
+	err := r.AddBackend(a)
+	c.Assert(err, check.IsNil)
+	err = r.AddCertificate(a, "myapp.ingress.example.com", "cert-data", "key-data")
+	c.Assert(err, check.IsNil)
+	err = r.RemoveBackend("myapp")
+	c.Assert(err, check.IsNil)
+	ns := s.client.Namespace()
+	_, err = s.client.CoreV1().Services(ns).Get("myapp-myingress", metav1.GetOptions{})
+	c.Assert(k8sErrors.IsNotFound(err), check.Equals, true)
+	_, err = s.client.CoreV1().Endpoints(ns).Get("myapp-myingress", metav1.GetOptions{})
+	c.Assert(k8sErrors.IsNotFound(err), check.Equals, true)
+	_, err = s.client.ExtensionsV1beta1().Ingresses(ns).Get("myapp-myingress", metav1.GetOptions{})
+	c.Assert(k8sErrors.IsNotFound(err), check.Equals, true)
+	secrets, err := s.client.CoreV1().Secrets(ns).List(metav1.ListOptions{})
+	c.Assert(err, check.IsNil)
+	c.Assert(secrets.Items, check.HasLen, 0)
+}
+
+func (s *S) TestIngressRouterGetBackendStatus(c *check.C) {
+	r := s.newIngressRouter(c)
+	err := r.AddBackend(routertest.FakeApp{Name: "myapp"})
+	c.Assert(err, check.IsNil)
+	status, detail, err := r.GetBackendStatus("myapp")
+	c.Assert(err, check.IsNil)
+	c.Assert(status, check.Equals, router.BackendStatusNotReady)
+	c.Assert(detail, check.Equals, "waiting for ingress load balancer address")
+	ns := s.client.Namespace()
+	ingress, err := s.client.ExtensionsV1beta1().Ingresses(ns).Get("myapp-myingress", metav1.GetOptions{})
+	c.Assert(err, check.IsNil)
+	ingress.Status.LoadBalancer.Ingress = []apiv1.LoadBalancerIngress{{IP: "192.168.99.1"}}
+	_, err = s.client.ExtensionsV1beta1().Ingresses(ns).Update(ingress)
+	c.Assert(err, check.IsNil)
+	status, detail, err = r.GetBackendStatus("myapp")
+	c.Assert(err, check.IsNil)
+	c.Assert(status, check.Equals, router.BackendStatusReady)
+	c.Assert(detail, check.Equals, "")
+}
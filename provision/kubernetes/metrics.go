@@ -0,0 +1,137 @@
+// Copyright 2018 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package kubernetes
+
+import (
+	"encoding/json"
+
+	"github.com/pkg/errors"
+	"github.com/tsuru/tsuru/provision"
+	apiv1 "k8s.io/api/core/v1"
+	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/client-go/rest"
+)
+
+// podMetricsList mirrors the PodMetricsList type from the metrics.k8s.io
+// API group, only the fields used by tsuru are decoded.
+type podMetricsList struct {
+	Items []struct {
+		Metadata struct {
+			Name string `json:"name"`
+		} `json:"metadata"`
+		Containers []struct {
+			Usage map[apiv1.ResourceName]resource.Quantity `json:"usage"`
+		} `json:"containers"`
+	} `json:"items"`
+}
+
+// statsSummary mirrors the Summary type returned by the kubelet stats API,
+// only the network stats of pods are decoded.
+type statsSummary struct {
+	Pods []struct {
+		PodRef struct {
+			Name      string `json:"name"`
+			Namespace string `json:"namespace"`
+		} `json:"podRef"`
+		Network *struct {
+			RxBytes *uint64 `json:"rxBytes"`
+			TxBytes *uint64 `json:"txBytes"`
+		} `json:"network"`
+	} `json:"pods"`
+}
+
+// UnitsMetrics returns the CPU and memory usage of the app pods, taken from
+// the metrics API, along with the network usage reported by the kubelet of
+// each node. Usage is reported as zero when metrics-server is not installed
+// in the cluster.
+func (p *kubernetesProvisioner) UnitsMetrics(a provision.App) ([]provision.UnitMetric, error) {
+	client, err := clusterForPool(a.GetPool())
+	if err != nil {
+		return nil, err
+	}
+	pods, err := podsForAppProcess(client, a, "")
+	if err != nil {
+		return nil, err
+	}
+	if len(pods.Items) == 0 {
+		return nil, nil
+	}
+	restCli, err := rest.RESTClientFor(client.restConfig)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	selector, err := podSelectorForAppProcess(a, "")
+	if err != nil {
+		return nil, err
+	}
+	var usage podMetricsList
+	err = getRawJSON(restCli.Get().
+		AbsPath("/apis/metrics.k8s.io/v1beta1/namespaces", client.Namespace(), "pods").
+		Param("labelSelector", selector), &usage)
+	if err != nil {
+		return nil, err
+	}
+	metricsMap := make(map[string]*provision.UnitMetric, len(pods.Items))
+	metrics := make([]provision.UnitMetric, len(pods.Items))
+	nodeNames := map[string]struct{}{}
+	for i, pod := range pods.Items {
+		metrics[i] = provision.UnitMetric{
+			ID:      pod.Name,
+			Process: labelSetFromMeta(&pod.ObjectMeta).AppProcess(),
+		}
+		for _, status := range pod.Status.ContainerStatuses {
+			metrics[i].Restarts += int(status.RestartCount)
+		}
+		metricsMap[pod.Name] = &metrics[i]
+		if pod.Spec.NodeName != "" {
+			nodeNames[pod.Spec.NodeName] = struct{}{}
+		}
+	}
+	for _, item := range usage.Items {
+		m, ok := metricsMap[item.Metadata.Name]
+		if !ok {
+			continue
+		}
+		for _, container := range item.Containers {
+			cpu := container.Usage[apiv1.ResourceCPU]
+			memory := container.Usage[apiv1.ResourceMemory]
+			m.CPU += float64(cpu.MilliValue()) / 10
+			m.Memory += memory.Value()
+		}
+	}
+	for nodeName := range nodeNames {
+		var summary statsSummary
+		err = getRawJSON(restCli.Get().
+			AbsPath("/api/v1/nodes", nodeName, "proxy/stats/summary"), &summary)
+		if err != nil {
+			return nil, err
+		}
+		for _, podStats := range summary.Pods {
+			m, ok := metricsMap[podStats.PodRef.Name]
+			if !ok || podStats.PodRef.Namespace != client.Namespace() || podStats.Network == nil {
+				continue
+			}
+			if podStats.Network.RxBytes != nil {
+				m.NetworkRx = int64(*podStats.Network.RxBytes)
+			}
+			if podStats.Network.TxBytes != nil {
+				m.NetworkTx = int64(*podStats.Network.TxBytes)
+			}
+		}
+	}
+	return metrics, nil
+}
+
+func getRawJSON(req *rest.Request, result interface{}) error {
+	data, err := req.DoRaw()
+	if err != nil {
+		if k8sErrors.IsNotFound(err) {
+			return nil
+		}
+		return errors.WithStack(err)
+	}
+	return errors.WithStack(json.Unmarshal(data, result))
+}
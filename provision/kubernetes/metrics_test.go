@@ -0,0 +1,98 @@
+// Copyright 2018 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package kubernetes
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/tsuru/tsuru/provision"
+	"github.com/tsuru/tsuru/provision/provisiontest"
+	"gopkg.in/check.v1"
+	apiv1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func (s *S) createMetricsPods(c *check.C) {
+	for i, process := range []string{"web", "worker"} {
+		_, err := s.client.CoreV1().Pods(s.client.Namespace()).Create(&apiv1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      fmt.Sprintf("myapp-%s-pod", process),
+				Namespace: s.client.Namespace(),
+				Labels: map[string]string{
+					"tsuru.io/app-name":    "myapp",
+					"tsuru.io/app-process": process,
+				},
+			},
+			Spec: apiv1.PodSpec{NodeName: "n1"},
+			Status: apiv1.PodStatus{
+				ContainerStatuses: []apiv1.ContainerStatus{{RestartCount: int32(i * 2)}},
+			},
+		})
+		c.Assert(err, check.IsNil)
+	}
+}
+
+func (s *S) TestUnitsMetrics(c *check.C) {
+	var paths []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+		switch r.URL.Path {
+		case "/apis/metrics.k8s.io/v1beta1/namespaces/default/pods":
+			c.Assert(r.URL.Query().Get("labelSelector"), check.Equals, "tsuru.io/app-name=myapp")
+			w.Write([]byte(`{"items": [
+				{"metadata": {"name": "myapp-web-pod"}, "containers": [{"usage": {"cpu": "250m", "memory": "64Mi"}}]},
+				{"metadata": {"name": "myapp-worker-pod"}, "containers": [{"usage": {"cpu": "1", "memory": "1Ki"}}]},
+				{"metadata": {"name": "otherpod"}, "containers": [{"usage": {"cpu": "1", "memory": "1Ki"}}]}
+			]}`))
+		case "/api/v1/nodes/n1/proxy/stats/summary":
+			w.Write([]byte(`{"pods": [
+				{"podRef": {"name": "myapp-web-pod", "namespace": "default"}, "network": {"rxBytes": 100, "txBytes": 200}},
+				{"podRef": {"name": "myapp-worker-pod", "namespace": "other"}, "network": {"rxBytes": 1, "txBytes": 1}}
+			]}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+	s.mock.MockfakeNodes(c, srv.URL)
+	s.createMetricsPods(c)
+	a := provisiontest.NewFakeApp("myapp", "python", 0)
+	metrics, err := s.p.UnitsMetrics(a)
+	c.Assert(err, check.IsNil)
+	c.Assert(metrics, check.DeepEquals, []provision.UnitMetric{
+		{ID: "myapp-web-pod", Process: "web", CPU: 25, Memory: 64 * 1024 * 1024, NetworkRx: 100, NetworkTx: 200},
+		{ID: "myapp-worker-pod", Process: "worker", CPU: 100, Memory: 1024, Restarts: 2},
+	})
+	c.Assert(paths, check.DeepEquals, []string{
+		"/apis/metrics.k8s.io/v1beta1/namespaces/default/pods",
+		"/api/v1/nodes/n1/proxy/stats/summary",
+	})
+}
+
+func (s *S) TestUnitsMetricsWithoutMetricsAPI(c *check.C) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer srv.Close()
+	s.mock.MockfakeNodes(c, srv.URL)
+	s.createMetricsPods(c)
+	a := provisiontest.NewFakeApp("myapp", "python", 0)
+	metrics, err := s.p.UnitsMetrics(a)
+	c.Assert(err, check.IsNil)
+	c.Assert(metrics, check.DeepEquals, []provision.UnitMetric{
+		{ID: "myapp-web-pod", Process: "web"},
+		{ID: "myapp-worker-pod", Process: "worker", Restarts: 2},
+	})
+}
+
+func (s *S) TestUnitsMetricsNoPods(c *check.C) {
+	s.mock.MockfakeNodes(c)
+	a := provisiontest.NewFakeApp("myapp", "python", 0)
+	metrics, err := s.p.UnitsMetrics(a)
+	c.Assert(err, check.IsNil)
+	c.Assert(metrics, check.IsNil)
+}
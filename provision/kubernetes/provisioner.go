@@ -17,11 +17,13 @@ import (
 	"github.com/tsuru/tsuru/app/image"
 	tsuruErrors "github.com/tsuru/tsuru/errors"
 	"github.com/tsuru/tsuru/event"
+	"github.com/tsuru/tsuru/log"
 	tsuruNet "github.com/tsuru/tsuru/net"
 	"github.com/tsuru/tsuru/provision"
 	"github.com/tsuru/tsuru/provision/cluster"
 	"github.com/tsuru/tsuru/provision/servicecommon"
 	"github.com/tsuru/tsuru/set"
+	"k8s.io/api/apps/v1beta2"
 	apiv1 "k8s.io/api/core/v1"
 	policy "k8s.io/api/policy/v1beta1"
 	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
@@ -54,7 +56,12 @@ var (
 	_ provision.BuilderDeploy            = &kubernetesProvisioner{}
 	_ provision.BuilderDeployKubeClient  = &kubernetesProvisioner{}
 	// _ provision.InitializableProvisioner = &kubernetesProvisioner{}
-	_ provision.RollbackableDeployer = &kubernetesProvisioner{}
+	_ provision.RollbackableDeployer       = &kubernetesProvisioner{}
+	_ provision.CanaryDeployer             = &kubernetesProvisioner{}
+	_ provision.AutoScaleProvisioner       = &kubernetesProvisioner{}
+	_ provision.MetricsProvisioner         = &kubernetesProvisioner{}
+	_ provision.ProcessRoutableProvisioner = &kubernetesProvisioner{}
+	_ provision.PortRoutableProvisioner    = &kubernetesProvisioner{}
 	// _ provision.OptionalLogsProvisioner  = &kubernetesProvisioner{}
 	// _ provision.UnitStatusProvisioner    = &kubernetesProvisioner{}
 	// _ provision.NodeRebalanceProvisioner = &kubernetesProvisioner{}
@@ -357,11 +364,47 @@ func (p *kubernetesProvisioner) RoutableAddresses(a provision.App) ([]url.URL, e
 	if webProcessName == "" {
 		return nil, nil
 	}
-	srvName := deploymentNameForApp(a, webProcessName)
+	return p.processAddresses(client, a, webProcessName)
+}
+
+func (p *kubernetesProvisioner) ProcessRoutableAddresses(a provision.App, process string) ([]url.URL, error) {
+	client, err := clusterForPool(a.GetPool())
+	if err != nil {
+		return nil, err
+	}
+	return p.processAddresses(client, a, process)
+}
+
+// processAddresses returns the address of the node port service of the
+// process in every node of the pool of the app.
+func (p *kubernetesProvisioner) processAddresses(client *ClusterClient, a provision.App, process string) ([]url.URL, error) {
+	srvName := deploymentNameForApp(a, process)
 	pubPort, err := getServicePort(client, srvName)
 	if err != nil {
 		return nil, err
 	}
+	return p.poolAddresses(client, a, "http", pubPort)
+}
+
+// PortRoutableAddresses returns the address of the node port of an extra
+// port of the app in every node of the pool of the app.
+func (p *kubernetesProvisioner) PortRoutableAddresses(a provision.App, port provision.AppPort) ([]url.URL, error) {
+	client, err := clusterForPool(a.GetPool())
+	if err != nil {
+		return nil, err
+	}
+	srvName := deploymentNameForApp(a, port.Process)
+	nodePort, err := getServiceNamedPort(client, srvName, port.Name)
+	if err != nil {
+		return nil, err
+	}
+	if nodePort == 0 {
+		return nil, nil
+	}
+	return p.poolAddresses(client, a, port.GetProtocol(), nodePort)
+}
+
+func (p *kubernetesProvisioner) poolAddresses(client *ClusterClient, a provision.App, scheme string, port int32) ([]url.URL, error) {
 	nodeSelector := provision.NodeLabels(provision.NodeLabelsOpts{
 		Pool:   a.GetPool(),
 		Prefix: tsuruLabelPrefix,
@@ -376,8 +419,8 @@ func (p *kubernetesProvisioner) RoutableAddresses(a provision.App) ([]url.URL, e
 	for i, n := range nodes.Items {
 		wrapper := kubernetesNodeWrapper{node: &n, prov: p}
 		addrs[i] = url.URL{
-			Scheme: "http",
-			Host:   fmt.Sprintf("%s:%d", wrapper.Address(), pubPort),
+			Scheme: scheme,
+			Host:   fmt.Sprintf("%s:%d", wrapper.Address(), port),
 		}
 	}
 	return addrs, nil
@@ -649,32 +692,9 @@ func (p *kubernetesProvisioner) Deploy(a provision.App, buildImageID string, evt
 	if err != nil {
 		return "", err
 	}
-	newImage := buildImageID
-	if strings.HasSuffix(buildImageID, "-builder") {
-		newImage, err = image.AppNewImageName(a.GetName())
-		if err != nil {
-			return "", err
-		}
-		var deployPodName string
-		deployPodName, err = deployPodNameForApp(a)
-		if err != nil {
-			return "", err
-		}
-		defer cleanupPod(client, deployPodName)
-		params := createPodParams{
-			app:               a,
-			client:            client,
-			podName:           deployPodName,
-			sourceImage:       buildImageID,
-			destinationImages: []string{newImage},
-			attachOutput:      evt,
-			attachInput:       strings.NewReader("."),
-			inputFile:         "/dev/null",
-		}
-		err = createDeployPod(params)
-		if err != nil {
-			return "", err
-		}
+	newImage, err := deployImageFromBuild(client, a, buildImageID, evt)
+	if err != nil {
+		return "", err
 	}
 	manager := &serviceManager{
 		client: client,
@@ -687,6 +707,36 @@ func (p *kubernetesProvisioner) Deploy(a provision.App, buildImageID string, evt
 	return newImage, nil
 }
 
+func deployImageFromBuild(client *ClusterClient, a provision.App, buildImageID string, evt *event.Event) (string, error) {
+	if !strings.HasSuffix(buildImageID, "-builder") {
+		return buildImageID, nil
+	}
+	newImage, err := image.AppNewImageName(a.GetName())
+	if err != nil {
+		return "", err
+	}
+	deployPodName, err := deployPodNameForApp(a)
+	if err != nil {
+		return "", err
+	}
+	defer cleanupPod(client, deployPodName)
+	params := createPodParams{
+		app:               a,
+		client:            client,
+		podName:           deployPodName,
+		sourceImage:       buildImageID,
+		destinationImages: []string{newImage},
+		attachOutput:      evt,
+		attachInput:       strings.NewReader("."),
+		inputFile:         "/dev/null",
+	}
+	err = createDeployPod(params)
+	if err != nil {
+		return "", err
+	}
+	return newImage, nil
+}
+
 func (p *kubernetesProvisioner) Rollback(a provision.App, imageID string, evt *event.Event) (string, error) {
 	client, err := clusterForPool(a.GetPool())
 	if err != nil {
@@ -714,6 +764,197 @@ func (p *kubernetesProvisioner) Rollback(a provision.App, imageID string, evt *e
 	return imageID, nil
 }
 
+// DeployCanary creates, for each process already running, a deployment with
+// the new image and a fraction of the process replicas. The main deployment is
+// scaled down by the same number of replicas, the main service selects the
+// units of both deployments, splitting traffic by unit count.
+func (p *kubernetesProvisioner) DeployCanary(a provision.App, buildImageID string, opts provision.CanaryOptions, evt *event.Event) (string, error) {
+	client, err := clusterForPool(a.GetPool())
+	if err != nil {
+		return "", err
+	}
+	newImage, err := deployImageFromBuild(client, a, buildImageID, evt)
+	if err != nil {
+		return "", err
+	}
+	imgData, err := image.GetImageMetaData(newImage)
+	if err != nil {
+		return "", err
+	}
+	manager := &serviceManager{
+		client: client,
+		writer: evt,
+	}
+	var deployed []string
+	for processName := range imgData.Processes {
+		err = deployCanaryProcess(manager, a, processName, newImage, opts.Weight)
+		if err != nil {
+			break
+		}
+		deployed = append(deployed, processName)
+	}
+	if err != nil {
+		for _, processName := range deployed {
+			if rollbackErr := removeCanaryProcess(client, a, processName); rollbackErr != nil {
+				log.Errorf("error rolling back canary for %s[%s]: %+v", a.GetName(), processName, rollbackErr)
+			}
+		}
+		return "", err
+	}
+	return newImage, nil
+}
+
+func deployCanaryProcess(m *serviceManager, a provision.App, processName, img string, weight int) error {
+	depName := deploymentNameForApp(a, processName)
+	dep, err := m.client.AppsV1beta2().Deployments(m.client.Namespace()).Get(depName, metav1.GetOptions{})
+	if err != nil {
+		if k8sErrors.IsNotFound(err) {
+			fmt.Fprintf(m.writer, " ---> Skipping canary for new process %q\n", processName)
+			return nil
+		}
+		return errors.WithStack(err)
+	}
+	if dep.Spec.Replicas == nil || *dep.Spec.Replicas == 0 {
+		return nil
+	}
+	dep, err = excludeCanaryFromSelector(m, dep)
+	if err != nil {
+		return err
+	}
+	replicas := int(*dep.Spec.Replicas)
+	canaryReplicas := (replicas*weight + 99) / 100
+	labels, err := provision.ServiceLabels(provision.ServiceLabelsOpts{
+		App:      a,
+		Process:  processName,
+		Replicas: canaryReplicas,
+	})
+	if err != nil {
+		return err
+	}
+	labels.SetIsCanary()
+	fmt.Fprintf(m.writer, "\n---- Starting %d canary units [%s] ----\n", canaryReplicas, processName)
+	err = m.DeployService(a, processName, labels, canaryReplicas, img)
+	if err != nil {
+		return err
+	}
+	mainReplicas := int32(replicas - canaryReplicas)
+	dep.Spec.Replicas = &mainReplicas
+	_, err = m.client.AppsV1beta2().Deployments(m.client.Namespace()).Update(dep)
+	return errors.WithStack(err)
+}
+
+// excludeCanaryFromSelector recreates deployments whose selector would also
+// match the units of canary deploys, as selectors can't be updated. The
+// deployment is removed leaving its replica sets and units running, the new
+// deployment adopts them.
+func excludeCanaryFromSelector(m *serviceManager, dep *v1beta2.Deployment) (*v1beta2.Deployment, error) {
+	labels := labelSetFromMeta(&dep.Spec.Template.ObjectMeta)
+	if excludesCanary(dep.Spec.Selector, labels) {
+		return dep, nil
+	}
+	fmt.Fprintf(m.writer, " ---> Updating selector of deployment %s to leave canary units out\n", dep.Name)
+	deployments := m.client.AppsV1beta2().Deployments(m.client.Namespace())
+	err := deployments.Delete(dep.Name, &metav1.DeleteOptions{
+		PropagationPolicy: propagationPtr(metav1.DeletePropagationOrphan),
+	})
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	newDep := v1beta2.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        dep.Name,
+			Namespace:   dep.Namespace,
+			Labels:      dep.Labels,
+			Annotations: dep.Annotations,
+		},
+		Spec: dep.Spec,
+	}
+	newDep.Spec.Selector = &metav1.LabelSelector{
+		MatchLabels: dep.Spec.Selector.MatchLabels,
+		MatchExpressions: append(dep.Spec.Selector.MatchExpressions, metav1.LabelSelectorRequirement{
+			Key:      labels.IsCanaryKey(),
+			Operator: metav1.LabelSelectorOpDoesNotExist,
+		}),
+	}
+	created, err := deployments.Create(&newDep)
+	return created, errors.WithStack(err)
+}
+
+func removeCanaryProcess(client *ClusterClient, a provision.App, processName string) error {
+	err := cleanupCanaryDeployment(client, a, processName)
+	if err != nil {
+		return err
+	}
+	depName := deploymentNameForApp(a, processName)
+	dep, err := client.AppsV1beta2().Deployments(client.Namespace()).Get(depName, metav1.GetOptions{})
+	if err != nil {
+		if k8sErrors.IsNotFound(err) {
+			return nil
+		}
+		return errors.WithStack(err)
+	}
+	labels := labelSetFromMeta(&dep.Spec.Template.ObjectMeta)
+	if labels.IsStopped() {
+		return nil
+	}
+	replicas := int32(labels.AppReplicas())
+	dep.Spec.Replicas = &replicas
+	_, err = client.AppsV1beta2().Deployments(client.Namespace()).Update(dep)
+	return errors.WithStack(err)
+}
+
+func (p *kubernetesProvisioner) PromoteCanary(a provision.App, canaryImage string, evt *event.Event) (string, error) {
+	client, err := clusterForPool(a.GetPool())
+	if err != nil {
+		return "", err
+	}
+	manager := &serviceManager{
+		client: client,
+		writer: evt,
+	}
+	err = servicecommon.RunServicePipeline(manager, a, canaryImage, nil)
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	imgData, err := image.GetImageMetaData(canaryImage)
+	if err != nil {
+		return "", err
+	}
+	for processName := range imgData.Processes {
+		err = cleanupCanaryDeployment(client, a, processName)
+		if err != nil {
+			return "", err
+		}
+	}
+	return canaryImage, nil
+}
+
+func (p *kubernetesProvisioner) AbortCanary(a provision.App, canaryImage string, evt *event.Event) error {
+	client, err := clusterForPool(a.GetPool())
+	if err != nil {
+		return err
+	}
+	imgData, err := image.GetImageMetaData(canaryImage)
+	if err != nil {
+		return err
+	}
+	multiErrors := tsuruErrors.NewMultiError()
+	for processName := range imgData.Processes {
+		fmt.Fprintf(evt, " ---> Removing canary units [%s]\n", processName)
+		err = removeCanaryProcess(client, a, processName)
+		if err != nil {
+			multiErrors.Add(err)
+		}
+	}
+	return multiErrors.ToError()
+}
+
+// CanaryRoutableAddresses always returns an empty list as canary units are
+// reached through the same node ports as the other units of the app.
+func (p *kubernetesProvisioner) CanaryRoutableAddresses(a provision.App, canaryImage string) ([]url.URL, error) {
+	return nil, nil
+}
+
 func (p *kubernetesProvisioner) UpgradeNodeContainer(name string, pool string, writer io.Writer) error {
 	m := nodeContainerManager{}
 	return servicecommon.UpgradeNodeContainer(&m, name, pool, writer)
@@ -28,6 +28,7 @@ import (
 	"gopkg.in/check.v1"
 	"k8s.io/api/apps/v1beta2"
 	apiv1 "k8s.io/api/core/v1"
+	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	ktesting "k8s.io/client-go/testing"
@@ -763,6 +764,34 @@ func (s *S) TestProvisionerDestroyNothingToDo(c *check.C) {
 	c.Assert(err, check.IsNil)
 }
 
+func (s *S) TestProvisionerPortRoutableAddresses(c *check.C) {
+	s.mock.MockfakeNodes(c)
+	a := provisiontest.NewFakeApp("myapp", "python", 0)
+	_, err := s.client.CoreV1().Services(s.client.Namespace()).Create(&apiv1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "myapp-web",
+			Namespace: s.client.Namespace(),
+		},
+		Spec: apiv1.ServiceSpec{
+			Ports: []apiv1.ServicePort{
+				{Name: "http", Protocol: "TCP", Port: 8888, NodePort: 30000},
+				{Name: "dns", Protocol: "UDP", Port: 53, NodePort: 30001},
+			},
+			Type: apiv1.ServiceTypeNodePort,
+		},
+	})
+	c.Assert(err, check.IsNil)
+	addrs, err := s.p.PortRoutableAddresses(a, provision.AppPort{Name: "dns", Port: 53, Protocol: "udp", Process: "web"})
+	c.Assert(err, check.IsNil)
+	c.Assert(addrs, check.DeepEquals, []url.URL{
+		{Scheme: "udp", Host: "192.168.99.1:30001"},
+		{Scheme: "udp", Host: "192.168.99.2:30001"},
+	})
+	addrs, err = s.p.PortRoutableAddresses(a, provision.AppPort{Name: "mqtt", Port: 1883, Process: "web"})
+	c.Assert(err, check.IsNil)
+	c.Assert(addrs, check.IsNil)
+}
+
 func (s *S) TestProvisionerRoutableAddresses(c *check.C) {
 	a, wait, rollback := s.mock.DefaultReactions(c)
 	defer rollback()
@@ -902,6 +931,98 @@ func (s *S) TestRollback(c *check.C) {
 	c.Assert(units, check.HasLen, 1)
 }
 
+func (s *S) TestDeployCanaryAndAbort(c *check.C) {
+	a, wait, rollback := s.mock.DefaultReactions(c)
+	defer rollback()
+	evt, err := event.New(&event.Opts{
+		Target:  event.Target{Type: event.TargetTypeApp, Value: a.GetName()},
+		Kind:    permission.PermAppDeploy,
+		Owner:   s.token,
+		Allowed: event.Allowed(permission.PermAppDeploy),
+	})
+	c.Assert(err, check.IsNil)
+	customData := map[string]interface{}{
+		"processes": map[string]interface{}{
+			"web": "run mycmd arg1",
+		},
+	}
+	err = image.SaveImageCustomData("tsuru/app-myapp:v1", customData)
+	c.Assert(err, check.IsNil)
+	_, err = s.p.Deploy(a, "tsuru/app-myapp:v1", evt)
+	c.Assert(err, check.IsNil)
+	wait()
+	err = s.p.AddUnits(a, 3, "web", nil)
+	c.Assert(err, check.IsNil)
+	wait()
+	err = image.SaveImageCustomData("tsuru/app-myapp:v2", customData)
+	c.Assert(err, check.IsNil)
+	img, err := s.p.DeployCanary(a, "tsuru/app-myapp:v2", provision.CanaryOptions{Weight: 25}, evt)
+	c.Assert(err, check.IsNil, check.Commentf("%+v", err))
+	c.Assert(img, check.Equals, "tsuru/app-myapp:v2")
+	wait()
+	dep, err := s.client.AppsV1beta2().Deployments(s.client.Namespace()).Get("myapp-web", metav1.GetOptions{})
+	c.Assert(err, check.IsNil)
+	c.Assert(*dep.Spec.Replicas, check.Equals, int32(3))
+	c.Assert(dep.Spec.Selector.MatchExpressions, check.DeepEquals, []metav1.LabelSelectorRequirement{
+		{Key: "tsuru.io/is-canary", Operator: metav1.LabelSelectorOpDoesNotExist},
+	})
+	canaryDep, err := s.client.AppsV1beta2().Deployments(s.client.Namespace()).Get("myapp-web-canary", metav1.GetOptions{})
+	c.Assert(err, check.IsNil)
+	c.Assert(*canaryDep.Spec.Replicas, check.Equals, int32(1))
+	c.Assert(canaryDep.Spec.Template.Spec.Containers[0].Image, check.Equals, "tsuru/app-myapp:v2")
+	c.Assert(canaryDep.Spec.Selector.MatchLabels["tsuru.io/is-canary"], check.Equals, "true")
+	c.Assert(canaryDep.Spec.Selector.MatchExpressions, check.HasLen, 0)
+	err = s.p.AbortCanary(a, "tsuru/app-myapp:v2", evt)
+	c.Assert(err, check.IsNil)
+	dep, err = s.client.AppsV1beta2().Deployments(s.client.Namespace()).Get("myapp-web", metav1.GetOptions{})
+	c.Assert(err, check.IsNil)
+	c.Assert(*dep.Spec.Replicas, check.Equals, int32(4))
+	_, err = s.client.AppsV1beta2().Deployments(s.client.Namespace()).Get("myapp-web-canary", metav1.GetOptions{})
+	c.Assert(k8sErrors.IsNotFound(err), check.Equals, true)
+}
+
+func (s *S) TestDeployCanaryUpdatesMainSelector(c *check.C) {
+	a, wait, rollback := s.mock.DefaultReactions(c)
+	defer rollback()
+	evt, err := event.New(&event.Opts{
+		Target:  event.Target{Type: event.TargetTypeApp, Value: a.GetName()},
+		Kind:    permission.PermAppDeploy,
+		Owner:   s.token,
+		Allowed: event.Allowed(permission.PermAppDeploy),
+	})
+	c.Assert(err, check.IsNil)
+	customData := map[string]interface{}{
+		"processes": map[string]interface{}{
+			"web": "run mycmd arg1",
+		},
+	}
+	err = image.SaveImageCustomData("tsuru/app-myapp:v1", customData)
+	c.Assert(err, check.IsNil)
+	_, err = s.p.Deploy(a, "tsuru/app-myapp:v1", evt)
+	c.Assert(err, check.IsNil)
+	wait()
+	deployments := s.client.AppsV1beta2().Deployments(s.client.Namespace())
+	dep, err := deployments.Get("myapp-web", metav1.GetOptions{})
+	c.Assert(err, check.IsNil)
+	dep.Spec.Selector.MatchExpressions = nil
+	_, err = deployments.Update(dep)
+	c.Assert(err, check.IsNil)
+	err = image.SaveImageCustomData("tsuru/app-myapp:v2", customData)
+	c.Assert(err, check.IsNil)
+	buf := &bytes.Buffer{}
+	m := &serviceManager{client: s.clusterClient, writer: buf}
+	err = deployCanaryProcess(m, a, "web", "tsuru/app-myapp:v2", 50)
+	c.Assert(err, check.IsNil)
+	wait()
+	c.Assert(buf.String(), check.Matches, `(?s).*Updating selector of deployment myapp-web to leave canary units out.*`)
+	dep, err = deployments.Get("myapp-web", metav1.GetOptions{})
+	c.Assert(err, check.IsNil)
+	c.Assert(dep.Spec.Selector.MatchExpressions, check.DeepEquals, []metav1.LabelSelectorRequirement{
+		{Key: "tsuru.io/is-canary", Operator: metav1.LabelSelectorOpDoesNotExist},
+	})
+	c.Assert(dep.Spec.Selector.MatchLabels["tsuru.io/app-name"], check.Equals, "myapp")
+}
+
 func (s *S) TestDeployBuilderImageWithRegistryAuth(c *check.C) {
 	config.Set("docker:registry", "registry.example.com")
 	defer config.Unset("docker:registry")
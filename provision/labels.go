@@ -23,6 +23,7 @@ var (
 	labelIsNodeContainer   = "is-node-container"
 	labelIsService         = "is-service"
 	labelIsHeadlessService = "is-headless-service"
+	labelIsCanary          = "is-canary"
 
 	labelAppName            = "app-name"
 	labelAppProcess         = "app-process"
@@ -65,7 +66,13 @@ func (s *LabelSet) ToLabels() map[string]string {
 }
 
 func (s *LabelSet) ToSelector() map[string]string {
-	return withPrefix(subMap(s.Labels, labelAppName, labelAppProcess, labelIsBuild, labelIsIsolatedRun), s.Prefix)
+	return withPrefix(subMap(s.Labels, labelAppName, labelAppProcess, labelIsBuild, labelIsIsolatedRun, labelIsCanary), s.Prefix)
+}
+
+// IsCanaryKey returns the key of the label set in the units of canary
+// deploys, missing from the other units of the app.
+func (s *LabelSet) IsCanaryKey() string {
+	return s.Prefix + labelIsCanary
 }
 
 func (s *LabelSet) ToAppSelector() map[string]string {
@@ -196,6 +203,10 @@ func (s *LabelSet) IsIsolatedRun() bool {
 	return s.getBoolLabel(labelIsIsolatedRun)
 }
 
+func (s *LabelSet) IsCanary() bool {
+	return s.getBoolLabel(labelIsCanary)
+}
+
 func (s *LabelSet) SetRestarts(count int) {
 	s.addLabel(labelRestarts, strconv.Itoa(count))
 }
@@ -216,6 +227,10 @@ func (s *LabelSet) SetIsHeadlessService() {
 	s.addLabel(labelIsHeadlessService, strconv.FormatBool(true))
 }
 
+func (s *LabelSet) SetIsCanary() {
+	s.addLabel(labelIsCanary, strconv.FormatBool(true))
+}
+
 func (s *LabelSet) SetBuildImage(image string) {
 	s.addLabel(labelBuildImage, image)
 }
@@ -43,6 +43,24 @@ func (s *S) TestLabelSetSelectors(c *check.C) {
 	})
 }
 
+func (s *S) TestLabelSetCanarySelector(c *check.C) {
+	ls := provision.LabelSet{
+		Labels: map[string]string{
+			"app-name":    "app",
+			"app-process": "proc",
+		},
+		Prefix: "tsuru.io/",
+	}
+	c.Assert(ls.IsCanary(), check.Equals, false)
+	ls.SetIsCanary()
+	c.Assert(ls.IsCanary(), check.Equals, true)
+	c.Assert(ls.ToSelector(), check.DeepEquals, map[string]string{
+		"tsuru.io/app-name":    "app",
+		"tsuru.io/app-process": "proc",
+		"tsuru.io/is-canary":   "true",
+	})
+}
+
 func (s *S) TestProcessLabels(c *check.C) {
 	config.Set("routers:fake:type", "fake")
 	defer config.Unset("routers")
@@ -0,0 +1,253 @@
+// Copyright 2018 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pool
+
+import (
+	"fmt"
+
+	"github.com/globalsign/mgo"
+	"github.com/globalsign/mgo/bson"
+	"github.com/tsuru/tsuru/db"
+	tsuruErrors "github.com/tsuru/tsuru/errors"
+	"github.com/tsuru/tsuru/quota"
+)
+
+var ErrInvalidOvercommit = &tsuruErrors.ValidationError{Message: "overcommit ratio must be greater than or equal to 1"}
+
+// Capacity describes the maximum amount of plan memory and CPU shares the
+// units of apps in a pool may add up to. A zero maximum means the resource is
+// unlimited. The overcommit ratio multiplies both maximums, allowing plans to
+// reserve more than the pool actually has, a zero ratio is the same as 1.
+type Capacity struct {
+	MaxMemory  int64   `json:"maxMemory"`
+	MaxCPU     int64   `json:"maxCPU"`
+	Overcommit float64 `json:"overcommit"`
+}
+
+// CapacityUsage is the resources reserved by the units of apps in a pool,
+// along with the resources still available considering the overcommit
+// ratio. An available value of -1 means unlimited.
+type CapacityUsage struct {
+	UsedMemory      int64 `json:"usedMemory"`
+	UsedCPU         int64 `json:"usedCPU"`
+	AvailableMemory int64 `json:"availableMemory"`
+	AvailableCPU    int64 `json:"availableCPU"`
+}
+
+// CapacityExceededError is returned when adding units or changing plans
+// would make the apps in a pool reserve more than the pool capacity.
+type CapacityExceededError struct {
+	quota.QuotaExceededError
+	Pool     string
+	Resource string
+}
+
+func (err *CapacityExceededError) Error() string {
+	return fmt.Sprintf("Pool %q capacity exceeded for %s. Available: %d. Requested: %d.", err.Pool, err.Resource, err.Available, err.Requested)
+}
+
+func (c Capacity) validate() error {
+	if c.Overcommit != 0 && c.Overcommit < 1 {
+		return ErrInvalidOvercommit
+	}
+	if c.MaxMemory < 0 || c.MaxCPU < 0 {
+		return &tsuruErrors.ValidationError{Message: "pool capacity cannot be negative"}
+	}
+	return nil
+}
+
+func (c Capacity) effective(max int64) int64 {
+	if max == 0 {
+		return -1
+	}
+	if c.Overcommit <= 1 {
+		return max
+	}
+	return int64(float64(max) * c.Overcommit)
+}
+
+// capacityUsed holds the memory and CPU shares reserved by the units of apps
+// in a pool. It's stored in the pool document and updated atomically as units
+// are reserved and released.
+type capacityUsed struct {
+	Memory int64
+	CPU    int64
+}
+
+// calculateCapacityUsed sums the resources used by the apps in each of the
+// given pools with a single aggregation.
+func calculateCapacityUsed(conn *db.Storage, names []string) (map[string]capacityUsed, error) {
+	var results []struct {
+		Pool   string `bson:"_id"`
+		Memory int64
+		CPU    int64
+	}
+	err := conn.Apps().Pipe([]bson.M{
+		{"$match": bson.M{"pool": bson.M{"$in": names}}},
+		{"$group": bson.M{
+			"_id":    "$pool",
+			"memory": bson.M{"$sum": bson.M{"$multiply": []interface{}{"$plan.memory", "$quota.inuse"}}},
+			"cpu":    bson.M{"$sum": bson.M{"$multiply": []interface{}{"$plan.cpushare", "$quota.inuse"}}},
+		}},
+	}).All(&results)
+	if err != nil {
+		return nil, err
+	}
+	used := make(map[string]capacityUsed, len(results))
+	for _, r := range results {
+		used[r.Pool] = capacityUsed{Memory: r.Memory, CPU: r.CPU}
+	}
+	return used, nil
+}
+
+// initCapacityUsed starts tracking the resources used in the pools still not
+// tracking them, calculating their usage from the apps in the pools.
+func initCapacityUsed(conn *db.Storage, pools []Pool) error {
+	var names []string
+	for _, p := range pools {
+		if p.Used == nil {
+			names = append(names, p.Name)
+		}
+	}
+	if len(names) == 0 {
+		return nil
+	}
+	used, err := calculateCapacityUsed(conn, names)
+	if err != nil {
+		return err
+	}
+	for i := range pools {
+		if pools[i].Used != nil {
+			continue
+		}
+		poolUsed := used[pools[i].Name]
+		err = conn.Pools().Update(
+			bson.M{"_id": pools[i].Name, "used": bson.M{"$exists": false}},
+			bson.M{"$set": bson.M{"used": poolUsed}},
+		)
+		if err != nil && err != mgo.ErrNotFound {
+			return err
+		}
+		if err == mgo.ErrNotFound {
+			var current Pool
+			err = conn.Pools().FindId(pools[i].Name).Select(bson.M{"used": 1}).One(&current)
+			if err != nil {
+				return err
+			}
+			poolUsed = *current.Used
+		}
+		pools[i].Used = &poolUsed
+	}
+	return nil
+}
+
+// CapacityUsage returns the memory and CPU shares reserved by the units of
+// all apps in the pool.
+func (p *Pool) CapacityUsage() (*CapacityUsage, error) {
+	if p.Used == nil {
+		conn, err := db.Conn()
+		if err != nil {
+			return nil, err
+		}
+		defer conn.Close()
+		pools := []Pool{*p}
+		err = initCapacityUsed(conn, pools)
+		if err != nil {
+			return nil, err
+		}
+		p.Used = pools[0].Used
+	}
+	return &CapacityUsage{
+		UsedMemory:      p.Used.Memory,
+		UsedCPU:         p.Used.CPU,
+		AvailableMemory: available(p.Capacity.effective(p.Capacity.MaxMemory), p.Used.Memory),
+		AvailableCPU:    available(p.Capacity.effective(p.Capacity.MaxCPU), p.Used.CPU),
+	}, nil
+}
+
+func available(limit, used int64) int64 {
+	if limit < 0 {
+		return -1
+	}
+	if used > limit {
+		return 0
+	}
+	return limit - used
+}
+
+// ReserveCapacity atomically reserves the given amount of memory and CPU
+// shares in the pool, returning a CapacityExceededError when the pool can't
+// accommodate them. Negative amounts are released without any check. Unknown
+// pools have no capacity to enforce.
+func ReserveCapacity(name string, memory, cpu int64) error {
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	for {
+		var p Pool
+		err = conn.Pools().FindId(name).One(&p)
+		if err == mgo.ErrNotFound {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		usage, err := p.CapacityUsage()
+		if err != nil {
+			return err
+		}
+		query := bson.M{"_id": name}
+		for _, item := range []struct {
+			resource  string
+			field     string
+			used      int64
+			available int64
+			requested int64
+		}{
+			{"memory", "used.memory", usage.UsedMemory, usage.AvailableMemory, memory},
+			{"cpu", "used.cpu", usage.UsedCPU, usage.AvailableCPU, cpu},
+		} {
+			if item.available < 0 || item.requested <= 0 {
+				continue
+			}
+			if item.requested > item.available {
+				return &CapacityExceededError{
+					QuotaExceededError: quota.QuotaExceededError{
+						Available: uint(item.available),
+						Requested: uint(item.requested),
+					},
+					Pool:     name,
+					Resource: item.resource,
+				}
+			}
+			query[item.field] = bson.M{"$lte": item.used + item.available - item.requested}
+		}
+		err = conn.Pools().Update(query, bson.M{"$inc": bson.M{"used.memory": memory, "used.cpu": cpu}})
+		if err != mgo.ErrNotFound {
+			return err
+		}
+	}
+}
+
+// ReleaseCapacity releases the given amount of memory and CPU shares from the
+// pool. Pools not tracking their usage yet are left untouched, their usage is
+// calculated from the remaining apps when needed.
+func ReleaseCapacity(name string, memory, cpu int64) error {
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	err = conn.Pools().Update(
+		bson.M{"_id": name, "used": bson.M{"$exists": true}},
+		bson.M{"$inc": bson.M{"used.memory": -memory, "used.cpu": -cpu}},
+	)
+	if err == mgo.ErrNotFound {
+		return nil
+	}
+	return err
+}
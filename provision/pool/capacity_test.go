@@ -0,0 +1,154 @@
+// Copyright 2018 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pool
+
+import (
+	"sync"
+
+	"github.com/globalsign/mgo/bson"
+	"github.com/tsuru/tsuru/quota"
+	"gopkg.in/check.v1"
+)
+
+func (s *S) addCapacityApp(c *check.C, name, pool string, memory, cpu int64, units int) {
+	err := s.storage.Apps().Insert(bson.M{
+		"name":  name,
+		"pool":  pool,
+		"plan":  bson.M{"memory": memory, "cpushare": cpu},
+		"quota": quota.Quota{Limit: -1, InUse: units},
+	})
+	c.Assert(err, check.IsNil)
+}
+
+func (s *S) TestAddPoolWithCapacity(c *check.C) {
+	err := AddPool(AddPoolOptions{Name: "pool1", MaxMemory: 4096, MaxCPU: 200, Overcommit: 1.5})
+	c.Assert(err, check.IsNil)
+	p, err := GetPoolByName("pool1")
+	c.Assert(err, check.IsNil)
+	c.Assert(p.Capacity, check.DeepEquals, Capacity{MaxMemory: 4096, MaxCPU: 200, Overcommit: 1.5})
+}
+
+func (s *S) TestAddPoolWithInvalidCapacity(c *check.C) {
+	err := AddPool(AddPoolOptions{Name: "pool1", MaxMemory: 4096, Overcommit: 0.5})
+	c.Assert(err, check.Equals, ErrInvalidOvercommit)
+	err = AddPool(AddPoolOptions{Name: "pool1", MaxMemory: -1})
+	c.Assert(err, check.ErrorMatches, "pool capacity cannot be negative")
+	_, err = GetPoolByName("pool1")
+	c.Assert(err, check.Equals, ErrPoolNotFound)
+}
+
+func (s *S) TestPoolUpdateCapacity(c *check.C) {
+	err := AddPool(AddPoolOptions{Name: "pool1", MaxMemory: 4096})
+	c.Assert(err, check.IsNil)
+	maxCPU, overcommit := int64(100), 2.0
+	err = PoolUpdate("pool1", UpdatePoolOptions{MaxCPU: &maxCPU, Overcommit: &overcommit})
+	c.Assert(err, check.IsNil)
+	p, err := GetPoolByName("pool1")
+	c.Assert(err, check.IsNil)
+	c.Assert(p.Capacity, check.DeepEquals, Capacity{MaxMemory: 4096, MaxCPU: 100, Overcommit: 2})
+	overcommit = 0.9
+	err = PoolUpdate("pool1", UpdatePoolOptions{Overcommit: &overcommit})
+	c.Assert(err, check.Equals, ErrInvalidOvercommit)
+}
+
+func (s *S) TestCapacityUsage(c *check.C) {
+	err := AddPool(AddPoolOptions{Name: "pool1", MaxMemory: 4096, Overcommit: 1.5})
+	c.Assert(err, check.IsNil)
+	s.addCapacityApp(c, "app1", "pool1", 1024, 100, 2)
+	s.addCapacityApp(c, "app2", "pool1", 512, 50, 1)
+	s.addCapacityApp(c, "app3", "pool2", 1024, 100, 10)
+	p, err := GetPoolByName("pool1")
+	c.Assert(err, check.IsNil)
+	usage, err := p.CapacityUsage()
+	c.Assert(err, check.IsNil)
+	c.Assert(usage, check.DeepEquals, &CapacityUsage{
+		UsedMemory:      2560,
+		UsedCPU:         250,
+		AvailableMemory: 3584,
+		AvailableCPU:    -1,
+	})
+}
+
+func (s *S) TestReserveCapacity(c *check.C) {
+	err := AddPool(AddPoolOptions{Name: "pool1", MaxMemory: 4096, MaxCPU: 300})
+	c.Assert(err, check.IsNil)
+	s.addCapacityApp(c, "app1", "pool1", 1024, 100, 2)
+	err = ReserveCapacity("pool1", 2048, 100)
+	c.Assert(err, check.IsNil)
+	err = ReserveCapacity("pool1", 1024, 0)
+	c.Assert(err, check.DeepEquals, &CapacityExceededError{
+		QuotaExceededError: quota.QuotaExceededError{Available: 0, Requested: 1024},
+		Pool:               "pool1",
+		Resource:           "memory",
+	})
+	c.Assert(err, check.ErrorMatches, `Pool "pool1" capacity exceeded for memory. Available: 0. Requested: 1024.`)
+	err = ReleaseCapacity("pool1", 2048, 100)
+	c.Assert(err, check.IsNil)
+	err = ReserveCapacity("pool1", 1024, 200)
+	c.Assert(err, check.ErrorMatches, `Pool "pool1" capacity exceeded for cpu. Available: 100. Requested: 200.`)
+	p, err := GetPoolByName("pool1")
+	c.Assert(err, check.IsNil)
+	c.Assert(p.Used, check.DeepEquals, &capacityUsed{Memory: 2048, CPU: 200})
+}
+
+func (s *S) TestReserveCapacityConcurrent(c *check.C) {
+	err := AddPool(AddPoolOptions{Name: "pool1", MaxMemory: 5120})
+	c.Assert(err, check.IsNil)
+	var wg sync.WaitGroup
+	errs := make(chan error, 20)
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- ReserveCapacity("pool1", 1024, 100)
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	var reserved int
+	for err := range errs {
+		if err == nil {
+			reserved++
+			continue
+		}
+		c.Assert(err, check.FitsTypeOf, &CapacityExceededError{})
+	}
+	c.Assert(reserved, check.Equals, 5)
+	p, err := GetPoolByName("pool1")
+	c.Assert(err, check.IsNil)
+	c.Assert(p.Used, check.DeepEquals, &capacityUsed{Memory: 5120, CPU: 500})
+}
+
+func (s *S) TestReserveCapacityUnlimited(c *check.C) {
+	err := AddPool(AddPoolOptions{Name: "pool1"})
+	c.Assert(err, check.IsNil)
+	s.addCapacityApp(c, "app1", "pool1", 1024, 100, 2)
+	err = ReserveCapacity("pool1", 1<<40, 1<<20)
+	c.Assert(err, check.IsNil)
+	err = ReserveCapacity("unknown", 1<<40, 1<<20)
+	c.Assert(err, check.IsNil)
+}
+
+func (s *S) TestListPoolsInitializesCapacityUsed(c *check.C) {
+	err := AddPool(AddPoolOptions{Name: "pool1"})
+	c.Assert(err, check.IsNil)
+	err = AddPool(AddPoolOptions{Name: "pool2"})
+	c.Assert(err, check.IsNil)
+	s.addCapacityApp(c, "app1", "pool1", 1024, 100, 2)
+	s.addCapacityApp(c, "app2", "pool1", 512, 50, 1)
+	pools, err := ListPools("pool1", "pool2")
+	c.Assert(err, check.IsNil)
+	c.Assert(pools, check.HasLen, 2)
+	for _, p := range pools {
+		var expected capacityUsed
+		if p.Name == "pool1" {
+			expected = capacityUsed{Memory: 2560, CPU: 250}
+		}
+		c.Assert(p.Used, check.DeepEquals, &expected)
+		dbPool, err := GetPoolByName(p.Name)
+		c.Assert(err, check.IsNil)
+		c.Assert(dbPool.Used, check.DeepEquals, &expected)
+	}
+}
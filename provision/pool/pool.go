@@ -35,23 +35,34 @@ var (
 )
 
 type Pool struct {
-	Name        string `bson:"_id"`
-	Default     bool
-	Provisioner string
+	Name           string `bson:"_id"`
+	Default        bool
+	Provisioner    string
+	Capacity       Capacity      `bson:",omitempty"`
+	DeployApproval bool          `bson:",omitempty"`
+	Used           *capacityUsed `bson:",omitempty"`
 }
 
 type AddPoolOptions struct {
-	Name        string
-	Public      bool
-	Default     bool
-	Force       bool
-	Provisioner string
+	Name           string
+	Public         bool
+	Default        bool
+	Force          bool
+	Provisioner    string
+	MaxMemory      int64
+	MaxCPU         int64
+	Overcommit     float64
+	DeployApproval bool
 }
 
 type UpdatePoolOptions struct {
-	Default *bool
-	Public  *bool
-	Force   bool
+	Default        *bool
+	Public         *bool
+	Force          bool
+	MaxMemory      *int64
+	MaxCPU         *int64
+	Overcommit     *float64
+	DeployApproval *bool
 }
 
 func (p *Pool) GetProvisioner() (provision.Provisioner, error) {
@@ -240,6 +251,13 @@ func (p *Pool) MarshalJSON() ([]byte, error) {
 	result["provisioner"] = p.Provisioner
 	result["teams"] = resolvedConstraints[ConstraintTypeTeam]
 	result["allowed"] = resolvedConstraints
+	usage, err := p.CapacityUsage()
+	if err != nil {
+		return nil, err
+	}
+	result["capacity"] = p.Capacity
+	result["usage"] = usage
+	result["deployApproval"] = p.DeployApproval
 	return json.Marshal(&result)
 }
 
@@ -253,11 +271,21 @@ func (p *Pool) validate() error {
 			"starting with a letter."
 		return &tsuruErrors.ValidationError{Message: msg}
 	}
-	return nil
+	return p.Capacity.validate()
 }
 
 func AddPool(opts AddPoolOptions) error {
-	pool := Pool{Name: opts.Name, Default: opts.Default, Provisioner: opts.Provisioner}
+	pool := Pool{
+		Name:        opts.Name,
+		Default:     opts.Default,
+		Provisioner: opts.Provisioner,
+		Capacity: Capacity{
+			MaxMemory:  opts.MaxMemory,
+			MaxCPU:     opts.MaxCPU,
+			Overcommit: opts.Overcommit,
+		},
+		DeployApproval: opts.DeployApproval,
+	}
 	if err := pool.validate(); err != nil {
 		return err
 	}
@@ -421,6 +449,10 @@ func listPools(query bson.M) ([]Pool, error) {
 	if err != nil {
 		return nil, err
 	}
+	err = initCapacityUsed(conn, pools)
+	if err != nil {
+		return nil, err
+	}
 	return pools, nil
 }
 
@@ -482,20 +514,39 @@ func PoolUpdate(name string, opts UpdatePoolOptions) error {
 		return err
 	}
 	defer conn.Close()
-	_, err = GetPoolByName(name)
+	p, err := GetPoolByName(name)
 	if err != nil {
 		return err
 	}
+	query := bson.M{}
+	if opts.MaxMemory != nil || opts.MaxCPU != nil || opts.Overcommit != nil {
+		if opts.MaxMemory != nil {
+			p.Capacity.MaxMemory = *opts.MaxMemory
+		}
+		if opts.MaxCPU != nil {
+			p.Capacity.MaxCPU = *opts.MaxCPU
+		}
+		if opts.Overcommit != nil {
+			p.Capacity.Overcommit = *opts.Overcommit
+		}
+		err = p.Capacity.validate()
+		if err != nil {
+			return err
+		}
+		query["capacity"] = p.Capacity
+	}
 	if opts.Default != nil && *opts.Default {
 		err = changeDefaultPool(opts.Force)
 		if err != nil {
 			return err
 		}
 	}
-	query := bson.M{}
 	if opts.Default != nil {
 		query["default"] = *opts.Default
 	}
+	if opts.DeployApproval != nil {
+		query["deployapproval"] = *opts.DeployApproval
+	}
 	if (opts.Public != nil && *opts.Public) || (opts.Default != nil && *opts.Default) {
 		errConstraint := SetPoolConstraint(&PoolConstraint{PoolExpr: name, Field: ConstraintTypeTeam, Values: []string{"*"}})
 		if errConstraint != nil {
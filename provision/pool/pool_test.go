@@ -386,6 +386,19 @@ func (s *S) TestPoolUpdateToDefault(c *check.C) {
 	c.Assert(p.Default, check.Equals, true)
 }
 
+func (s *S) TestPoolUpdateDeployApproval(c *check.C) {
+	err := AddPool(AddPoolOptions{Name: "pool1", DeployApproval: true})
+	c.Assert(err, check.IsNil)
+	p, err := GetPoolByName("pool1")
+	c.Assert(err, check.IsNil)
+	c.Assert(p.DeployApproval, check.Equals, true)
+	err = PoolUpdate("pool1", UpdatePoolOptions{DeployApproval: boolPtr(false)})
+	c.Assert(err, check.IsNil)
+	p, err = GetPoolByName("pool1")
+	c.Assert(err, check.IsNil)
+	c.Assert(p.DeployApproval, check.Equals, false)
+}
+
 func (s *S) TestPoolUpdateForceToDefault(c *check.C) {
 	err := AddPool(AddPoolOptions{Name: "pool1", Public: false, Default: true})
 	c.Assert(err, check.IsNil)
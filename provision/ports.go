@@ -0,0 +1,121 @@
+// Copyright 2018 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package provision
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+
+	tsuruErrors "github.com/tsuru/tsuru/errors"
+)
+
+const (
+	PortProtocolTCP  = "tcp"
+	PortProtocolUDP  = "udp"
+	PortProtocolGRPC = "grpc"
+
+	// WebPortName is the name of the HTTP port of the web process, it can't
+	// be used by the extra ports of an app.
+	WebPortName = "http"
+)
+
+var portNameRegexp = regexp.MustCompile(`^[a-z]([a-z0-9-]{0,13}[a-z0-9])?$`)
+
+// AppPort is an extra port exposed by the units of a process, besides the
+// HTTP port of the web process. An empty Process means the web process and an
+// empty Protocol means PortProtocolTCP. gRPC ports are exposed as TCP ports,
+// the protocol is only a hint to the routers.
+type AppPort struct {
+	Name     string `json:"name"`
+	Port     int    `json:"port"`
+	Protocol string `json:"protocol" bson:",omitempty"`
+	Process  string `json:"process" bson:",omitempty"`
+}
+
+// PortRoutableProvisioner is a provisioner able to route TCP and UDP traffic
+// to the extra ports declared by apps.
+type PortRoutableProvisioner interface {
+	// PortRoutableAddresses returns the addresses used to access the given
+	// port in the units of an app.
+	PortRoutableAddresses(App, AppPort) ([]url.URL, error)
+}
+
+// GetProtocol returns the protocol of the port, defaulting to
+// PortProtocolTCP.
+func (p AppPort) GetProtocol() string {
+	if p.Protocol == "" {
+		return PortProtocolTCP
+	}
+	return p.Protocol
+}
+
+// TransportProtocol returns the transport protocol used to expose the port,
+// either PortProtocolTCP or PortProtocolUDP.
+func (p AppPort) TransportProtocol() string {
+	if p.GetProtocol() == PortProtocolUDP {
+		return PortProtocolUDP
+	}
+	return PortProtocolTCP
+}
+
+// String returns the port in the format used by docker, e.g. 1883/tcp.
+func (p AppPort) String() string {
+	return fmt.Sprintf("%d/%s", p.Port, p.TransportProtocol())
+}
+
+// ValidatePorts checks the ports declared by an app, names must be unique and
+// valid as names of ports in kubernetes services. Ports with no process are
+// exposed by webProcess, the name of the web process of the app.
+func ValidatePorts(ports []AppPort, webProcess string) error {
+	names := make(map[string]struct{}, len(ports))
+	exposed := make(map[string]struct{}, len(ports))
+	for _, p := range ports {
+		if !portNameRegexp.MatchString(p.Name) {
+			return &tsuruErrors.ValidationError{Message: fmt.Sprintf("invalid port name %q, it must contain up to 15 lowercase letters, numbers or dashes, starting with a letter", p.Name)}
+		}
+		if p.Name == WebPortName {
+			return &tsuruErrors.ValidationError{Message: fmt.Sprintf("port name %q is reserved for the web process", WebPortName)}
+		}
+		if _, ok := names[p.Name]; ok {
+			return &tsuruErrors.ValidationError{Message: fmt.Sprintf("port name %q is used more than once", p.Name)}
+		}
+		names[p.Name] = struct{}{}
+		if p.Port < 1 || p.Port > 65535 {
+			return &tsuruErrors.ValidationError{Message: fmt.Sprintf("invalid number for port %q, it must be between 1 and 65535", p.Name)}
+		}
+		switch p.GetProtocol() {
+		case PortProtocolTCP, PortProtocolUDP, PortProtocolGRPC:
+		default:
+			return &tsuruErrors.ValidationError{Message: fmt.Sprintf("invalid protocol %q for port %q, it must be tcp, udp or grpc", p.Protocol, p.Name)}
+		}
+		process := p.Process
+		if process == "" {
+			process = webProcess
+		}
+		key := process + " " + p.String()
+		if _, ok := exposed[key]; ok {
+			return &tsuruErrors.ValidationError{Message: fmt.Sprintf("port %s is declared more than once", p.String())}
+		}
+		exposed[key] = struct{}{}
+	}
+	return nil
+}
+
+// PortsForProcess returns the ports exposed by the units of process, webProcess
+// is the name of the web process of the app.
+func PortsForProcess(ports []AppPort, process, webProcess string) []AppPort {
+	var result []AppPort
+	for _, p := range ports {
+		portProcess := p.Process
+		if portProcess == "" {
+			portProcess = webProcess
+		}
+		if portProcess == process {
+			result = append(result, p)
+		}
+	}
+	return result
+}
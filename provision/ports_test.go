@@ -0,0 +1,72 @@
+// Copyright 2018 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package provision_test
+
+import (
+	tsuruErrors "github.com/tsuru/tsuru/errors"
+	"github.com/tsuru/tsuru/provision"
+	"gopkg.in/check.v1"
+)
+
+func (s *S) TestAppPortString(c *check.C) {
+	c.Assert(provision.AppPort{Name: "mqtt", Port: 1883}.String(), check.Equals, "1883/tcp")
+	c.Assert(provision.AppPort{Name: "dns", Port: 53, Protocol: "udp"}.String(), check.Equals, "53/udp")
+	c.Assert(provision.AppPort{Name: "api", Port: 9000, Protocol: "grpc"}.String(), check.Equals, "9000/tcp")
+}
+
+func (s *S) TestValidatePorts(c *check.C) {
+	err := provision.ValidatePorts([]provision.AppPort{
+		{Name: "mqtt", Port: 1883},
+		{Name: "dns", Port: 53, Protocol: "udp"},
+		{Name: "dns-tcp", Port: 53, Protocol: "tcp"},
+		{Name: "api", Port: 9000, Protocol: "grpc", Process: "api"},
+	}, "web")
+	c.Assert(err, check.IsNil)
+	tests := []struct {
+		ports []provision.AppPort
+		err   string
+	}{
+		{[]provision.AppPort{{Name: "", Port: 1883}}, `invalid port name "".*`},
+		{[]provision.AppPort{{Name: "MQTT", Port: 1883}}, `invalid port name "MQTT".*`},
+		{[]provision.AppPort{{Name: "mqtt-", Port: 1883}}, `invalid port name "mqtt-".*`},
+		{[]provision.AppPort{{Name: "a-very-long-port-name", Port: 1883}}, `invalid port name "a-very-long-port-name".*`},
+		{[]provision.AppPort{{Name: "http", Port: 1883}}, `port name "http" is reserved for the web process`},
+		{[]provision.AppPort{{Name: "mqtt", Port: 1883}, {Name: "mqtt", Port: 1884}}, `port name "mqtt" is used more than once`},
+		{[]provision.AppPort{{Name: "mqtt", Port: 0}}, `invalid number for port "mqtt", it must be between 1 and 65535`},
+		{[]provision.AppPort{{Name: "mqtt", Port: 65536}}, `invalid number for port "mqtt", it must be between 1 and 65535`},
+		{[]provision.AppPort{{Name: "mqtt", Port: 1883, Protocol: "sctp"}}, `invalid protocol "sctp" for port "mqtt", it must be tcp, udp or grpc`},
+		{[]provision.AppPort{{Name: "mqtt", Port: 1883}, {Name: "api", Port: 1883, Protocol: "grpc"}}, `port 1883/tcp is declared more than once`},
+		{[]provision.AppPort{{Name: "mqtt", Port: 1883}, {Name: "api", Port: 1883, Process: "web"}}, `port 1883/tcp is declared more than once`},
+	}
+	for _, tt := range tests {
+		err = provision.ValidatePorts(tt.ports, "web")
+		c.Assert(err, check.FitsTypeOf, &tsuruErrors.ValidationError{})
+		c.Assert(err, check.ErrorMatches, tt.err)
+	}
+}
+
+func (s *S) TestValidatePortsOtherWebProcess(c *check.C) {
+	err := provision.ValidatePorts([]provision.AppPort{
+		{Name: "mqtt", Port: 1883},
+		{Name: "mqtt-web", Port: 1883, Process: "web"},
+	}, "server")
+	c.Assert(err, check.IsNil)
+	err = provision.ValidatePorts([]provision.AppPort{
+		{Name: "mqtt", Port: 1883},
+		{Name: "mqtt-server", Port: 1883, Process: "server"},
+	}, "server")
+	c.Assert(err, check.ErrorMatches, `port 1883/tcp is declared more than once`)
+}
+
+func (s *S) TestPortsForProcess(c *check.C) {
+	ports := []provision.AppPort{
+		{Name: "mqtt", Port: 1883},
+		{Name: "api", Port: 9000, Protocol: "grpc", Process: "api"},
+		{Name: "metrics", Port: 9100, Process: "web"},
+	}
+	c.Assert(provision.PortsForProcess(ports, "web", "web"), check.DeepEquals, []provision.AppPort{ports[0], ports[2]})
+	c.Assert(provision.PortsForProcess(ports, "api", "web"), check.DeepEquals, []provision.AppPort{ports[1]})
+	c.Assert(provision.PortsForProcess(ports, "worker", "web"), check.IsNil)
+}
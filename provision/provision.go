@@ -259,6 +259,105 @@ type RollbackableDeployer interface {
 	Rollback(App, string, *event.Event) (string, error)
 }
 
+// CanaryOptions holds the parameters of a canary deploy.
+type CanaryOptions struct {
+	// Weight is the percentage of units of each process that will run the
+	// canary image.
+	Weight int
+}
+
+// CanaryDeployer is a provisioner able to keep two image versions of an app
+// running at the same time. DeployCanary starts units with the new image
+// alongside the current ones, PromoteCanary moves every unit to the canary
+// image and AbortCanary removes the canary units.
+type CanaryDeployer interface {
+	DeployCanary(App, string, CanaryOptions, *event.Event) (string, error)
+	PromoteCanary(App, string, *event.Event) (string, error)
+	AbortCanary(App, string, *event.Event) error
+
+	// CanaryRoutableAddresses returns the subset of the routable addresses
+	// of the app that point to units running the canary image. Provisioners
+	// where canary units share the address of the other units return an
+	// empty list.
+	CanaryRoutableAddresses(App, string) ([]url.URL, error)
+}
+
+// BlueGreenDeployer is a provisioner able to keep, besides the units serving
+// an app, a shadow set of units running another image. Shadow units are not
+// part of the routable addresses of the app until SwitchShadow is called.
+type BlueGreenDeployer interface {
+	// DeployShadow starts a shadow set of units running the image, with the
+	// same number of units per process of the current set, replacing any
+	// previous shadow units. Web units must pass the healthcheck defined in
+	// tsuru.yaml before DeployShadow returns.
+	DeployShadow(App, string, *event.Event) (string, error)
+
+	// ShadowRoutableAddresses returns the addresses of the shadow web units.
+	ShadowRoutableAddresses(App) ([]url.URL, error)
+
+	// SwitchShadow exchanges the shadow and the current set of units, making
+	// the image of the shadow units the current image of the app.
+	SwitchShadow(App, string, *event.Event) error
+
+	// RemoveShadow destroys the shadow units of the app.
+	RemoveShadow(App, *event.Event) error
+}
+
+// ProcessRoutableProvisioner is a provisioner able to route requests to the
+// units of any process of an app, not only to the web process.
+type ProcessRoutableProvisioner interface {
+	// ProcessRoutableAddresses returns the addresses used to access the
+	// units of the given process of an app.
+	ProcessRoutableAddresses(App, string) ([]url.URL, error)
+}
+
+// AutoScaleSpec describes the horizontal scaling of the units of an app
+// process. At least one target must be set, TargetCPU is the average CPU
+// usage, in percent, and TargetRequests the average number of requests per
+// second handled by each unit.
+type AutoScaleSpec struct {
+	Process        string `json:"process"`
+	MinUnits       uint   `json:"minUnits"`
+	MaxUnits       uint   `json:"maxUnits"`
+	TargetCPU      uint   `json:"targetCPU,omitempty"`
+	TargetRequests uint   `json:"targetRequests,omitempty"`
+}
+
+// AutoScaleProvisioner is a provisioner able to scale the units of app
+// processes by itself. Apps running on provisioners not implementing this
+// interface are scaled by tsuru based on the metrics reported by units.
+type AutoScaleProvisioner interface {
+	// SetAutoScale creates or replaces the autoscaling of a process.
+	SetAutoScale(App, AutoScaleSpec) error
+
+	// RemoveAutoScale removes the autoscaling of the given process, keeping
+	// the current number of units.
+	RemoveAutoScale(App, string) error
+}
+
+// UnitMetric holds the resource usage of a single unit. CPU is the usage in
+// percent of one CPU core, Memory is measured in bytes, NetworkRx and
+// NetworkTx are the bytes received and transmitted by the unit since it
+// started and Restarts is the number of times the unit was restarted. Error
+// is set when the metrics of the unit couldn't be collected, leaving the
+// other fields empty.
+type UnitMetric struct {
+	ID        string  `json:"id"`
+	Process   string  `json:"process"`
+	CPU       float64 `json:"cpu"`
+	Memory    int64   `json:"memory"`
+	NetworkRx int64   `json:"networkRx"`
+	NetworkTx int64   `json:"networkTx"`
+	Restarts  int     `json:"restarts"`
+	Error     string  `json:"error,omitempty"`
+}
+
+// MetricsProvisioner is a provisioner able to report the current resource
+// usage of the units of an app.
+type MetricsProvisioner interface {
+	UnitsMetrics(App) ([]UnitMetric, error)
+}
+
 type BuilderDockerClient interface {
 	PullAndCreateContainer(opts docker.CreateContainerOptions, w io.Writer) (*docker.Container, string, error)
 	RemoveContainer(opts docker.RemoveContainerOptions) error
@@ -580,6 +679,10 @@ type UnitStatusData struct {
 	ID     string
 	Name   string
 	Status Status
+	// CPU is the CPU usage of the unit, in percent.
+	CPU float64
+	// Requests is the number of requests per second handled by the unit.
+	Requests float64
 }
 
 type NodeCheckResult struct {
@@ -674,6 +777,24 @@ func (e *Error) Error() string {
 type TsuruYamlData struct {
 	Hooks       TsuruYamlHooks       `bson:",omitempty"`
 	Healthcheck TsuruYamlHealthcheck `bson:",omitempty"`
+	Cron        []CronJob            `bson:",omitempty"`
+	Ports       []AppPort            `bson:",omitempty"`
+}
+
+const (
+	CronConcurrencyForbid = "forbid"
+	CronConcurrencyAllow  = "allow"
+)
+
+// CronJob is a command run periodically in an isolated unit of an app. The
+// ConcurrencyPolicy defines whether a run may start while the previous one
+// is still running, it must be either CronConcurrencyForbid, the default,
+// or CronConcurrencyAllow.
+type CronJob struct {
+	Name              string `json:"name"`
+	Schedule          string `json:"schedule"`
+	Command           string `json:"command"`
+	ConcurrencyPolicy string `json:"concurrency_policy" yaml:"concurrency_policy" bson:"concurrency_policy,omitempty"`
 }
 
 type TsuruYamlHooks struct {
@@ -32,10 +32,14 @@ var (
 	errNotProvisioned         = &provision.Error{Reason: "App is not provisioned."}
 	uniqueIpCounter     int32 = 0
 
-	_ provision.NodeProvisioner = &FakeProvisioner{}
-	_ provision.Provisioner     = &FakeProvisioner{}
-	_ provision.App             = &FakeApp{}
-	_ bind.App                  = &FakeApp{}
+	_ provision.NodeProvisioner            = &FakeProvisioner{}
+	_ provision.Provisioner                = &FakeProvisioner{}
+	_ provision.CanaryDeployer             = &FakeProvisioner{}
+	_ provision.BlueGreenDeployer          = &FakeProvisioner{}
+	_ provision.ProcessRoutableProvisioner = &FakeProvisioner{}
+	_ provision.PortRoutableProvisioner    = &FakeProvisioner{}
+	_ provision.App                        = &FakeApp{}
+	_ bind.App                             = &FakeApp{}
 )
 
 const fakeAppImage = "app-image"
@@ -899,6 +903,168 @@ func (p *FakeProvisioner) Rollback(app provision.App, img string, evt *event.Eve
 	return img, nil
 }
 
+// Canary returns the image and weight of the canary deploy running for the
+// given app.
+func (p *FakeProvisioner) Canary(app provision.App) (string, int) {
+	p.mut.RLock()
+	defer p.mut.RUnlock()
+	pApp := p.apps[app.GetName()]
+	return pApp.canaryImage, pApp.canaryWeight
+}
+
+func (p *FakeProvisioner) DeployCanary(app provision.App, img string, opts provision.CanaryOptions, evt *event.Event) (string, error) {
+	if err := p.getError("DeployCanary"); err != nil {
+		return "", err
+	}
+	p.mut.Lock()
+	defer p.mut.Unlock()
+	pApp, ok := p.apps[app.GetName()]
+	if !ok {
+		return "", errNotProvisioned
+	}
+	pApp.canaryImage = img
+	pApp.canaryWeight = opts.Weight
+	evt.Write([]byte("Canary deploy called"))
+	p.apps[app.GetName()] = pApp
+	return img, nil
+}
+
+func (p *FakeProvisioner) PromoteCanary(app provision.App, img string, evt *event.Event) (string, error) {
+	if err := p.getError("PromoteCanary"); err != nil {
+		return "", err
+	}
+	p.mut.Lock()
+	defer p.mut.Unlock()
+	pApp, ok := p.apps[app.GetName()]
+	if !ok {
+		return "", errNotProvisioned
+	}
+	pApp.image = img
+	pApp.canaryImage = ""
+	pApp.canaryWeight = 0
+	evt.Write([]byte("Promote canary called"))
+	p.apps[app.GetName()] = pApp
+	return img, nil
+}
+
+func (p *FakeProvisioner) AbortCanary(app provision.App, img string, evt *event.Event) error {
+	if err := p.getError("AbortCanary"); err != nil {
+		return err
+	}
+	p.mut.Lock()
+	defer p.mut.Unlock()
+	pApp, ok := p.apps[app.GetName()]
+	if !ok {
+		return errNotProvisioned
+	}
+	pApp.canaryImage = ""
+	pApp.canaryWeight = 0
+	evt.Write([]byte("Abort canary called"))
+	p.apps[app.GetName()] = pApp
+	return nil
+}
+
+// CanaryRoutableAddresses considers the first units of the app, in the
+// proportion of the canary weight, as the ones running the canary image.
+func (p *FakeProvisioner) CanaryRoutableAddresses(app provision.App, img string) ([]url.URL, error) {
+	p.mut.Lock()
+	defer p.mut.Unlock()
+	pApp := p.apps[app.GetName()]
+	if pApp.canaryImage == "" || pApp.canaryImage != img {
+		return nil, nil
+	}
+	count := (len(pApp.units)*pApp.canaryWeight + 99) / 100
+	addrs := make([]url.URL, count)
+	for i := range addrs {
+		addrs[i] = *pApp.units[i].Address
+	}
+	return addrs, nil
+}
+
+// Shadow returns the shadow units of the given app and the image they are
+// running.
+func (p *FakeProvisioner) Shadow(app provision.App) ([]provision.Unit, string) {
+	p.mut.RLock()
+	defer p.mut.RUnlock()
+	pApp := p.apps[app.GetName()]
+	return pApp.shadowUnits, pApp.shadowImage
+}
+
+func (p *FakeProvisioner) DeployShadow(app provision.App, img string, evt *event.Event) (string, error) {
+	if err := p.getError("DeployShadow"); err != nil {
+		return "", err
+	}
+	p.mut.Lock()
+	defer p.mut.Unlock()
+	pApp, ok := p.apps[app.GetName()]
+	if !ok {
+		return "", errNotProvisioned
+	}
+	pApp.shadowUnits = make([]provision.Unit, len(pApp.units))
+	for i, unit := range pApp.units {
+		val := atomic.AddInt32(&uniqueIpCounter, 1)
+		unit.ID = fmt.Sprintf("%s-%d", app.GetName(), pApp.unitLen)
+		unit.IP = fmt.Sprintf("10.10.10.%d", val)
+		unit.Address = &url.URL{
+			Scheme: "http",
+			Host:   fmt.Sprintf("%s:%d", unit.IP, val),
+		}
+		pApp.shadowUnits[i] = unit
+		pApp.unitLen++
+	}
+	pApp.shadowImage = img
+	evt.Write([]byte("Shadow deploy called"))
+	p.apps[app.GetName()] = pApp
+	return img, nil
+}
+
+func (p *FakeProvisioner) ShadowRoutableAddresses(app provision.App) ([]url.URL, error) {
+	p.mut.Lock()
+	defer p.mut.Unlock()
+	units := p.apps[app.GetName()].shadowUnits
+	addrs := make([]url.URL, len(units))
+	for i := range units {
+		addrs[i] = *units[i].Address
+	}
+	return addrs, nil
+}
+
+func (p *FakeProvisioner) SwitchShadow(app provision.App, img string, evt *event.Event) error {
+	if err := p.getError("SwitchShadow"); err != nil {
+		return err
+	}
+	p.mut.Lock()
+	defer p.mut.Unlock()
+	pApp, ok := p.apps[app.GetName()]
+	if !ok {
+		return errNotProvisioned
+	}
+	if pApp.shadowImage != img {
+		return errors.Errorf("shadow units are not running image %q", img)
+	}
+	pApp.units, pApp.shadowUnits = pApp.shadowUnits, pApp.units
+	pApp.image, pApp.shadowImage = pApp.shadowImage, pApp.image
+	evt.Write([]byte("Switch shadow called"))
+	p.apps[app.GetName()] = pApp
+	return nil
+}
+
+func (p *FakeProvisioner) RemoveShadow(app provision.App, evt *event.Event) error {
+	if err := p.getError("RemoveShadow"); err != nil {
+		return err
+	}
+	p.mut.Lock()
+	defer p.mut.Unlock()
+	pApp, ok := p.apps[app.GetName()]
+	if !ok {
+		return errNotProvisioned
+	}
+	pApp.shadowUnits = nil
+	pApp.shadowImage = ""
+	p.apps[app.GetName()] = pApp
+	return nil
+}
+
 func (p *FakeProvisioner) Rebuild(app provision.App, evt *event.Event) (string, error) {
 	if err := p.getError("Rebuild"); err != nil {
 		return "", err
@@ -1231,6 +1397,33 @@ func (p *FakeProvisioner) RoutableAddresses(app provision.App) ([]url.URL, error
 	return addrs, nil
 }
 
+func (p *FakeProvisioner) ProcessRoutableAddresses(app provision.App, process string) ([]url.URL, error) {
+	p.mut.Lock()
+	defer p.mut.Unlock()
+	var addrs []url.URL
+	for _, u := range p.apps[app.GetName()].units {
+		if u.ProcessName == process {
+			addrs = append(addrs, *u.Address)
+		}
+	}
+	return addrs, nil
+}
+
+func (p *FakeProvisioner) PortRoutableAddresses(app provision.App, port provision.AppPort) ([]url.URL, error) {
+	p.mut.Lock()
+	defer p.mut.Unlock()
+	var addrs []url.URL
+	for _, u := range p.apps[app.GetName()].units {
+		if u.ProcessName == port.Process {
+			addrs = append(addrs, url.URL{
+				Scheme: port.GetProtocol(),
+				Host:   fmt.Sprintf("%s:%d", u.Address.Hostname(), port.Port),
+			})
+		}
+	}
+	return addrs, nil
+}
+
 func (p *FakeProvisioner) SetUnitStatus(unit provision.Unit, status provision.Status) error {
 	p.mut.Lock()
 	defer p.mut.Unlock()
@@ -1350,6 +1543,44 @@ func (p *FakeProvisioner) Sleep(app provision.App, process string) error {
 	return nil
 }
 
+// SetUnitMetric defines the metric reported by UnitsMetrics for the unit
+// with the same ID.
+func (p *FakeProvisioner) SetUnitMetric(app provision.App, metric provision.UnitMetric) error {
+	p.mut.Lock()
+	defer p.mut.Unlock()
+	pApp, ok := p.apps[app.GetName()]
+	if !ok {
+		return errNotProvisioned
+	}
+	if pApp.metrics == nil {
+		pApp.metrics = make(map[string]provision.UnitMetric)
+	}
+	pApp.metrics[metric.ID] = metric
+	p.apps[app.GetName()] = pApp
+	return nil
+}
+
+func (p *FakeProvisioner) UnitsMetrics(app provision.App) ([]provision.UnitMetric, error) {
+	if err := p.getError("UnitsMetrics"); err != nil {
+		return nil, err
+	}
+	p.mut.RLock()
+	defer p.mut.RUnlock()
+	pApp, ok := p.apps[app.GetName()]
+	if !ok {
+		return nil, errNotProvisioned
+	}
+	metrics := make([]provision.UnitMetric, len(pApp.units))
+	for i, u := range pApp.units {
+		metric, ok := pApp.metrics[u.ID]
+		if !ok {
+			metric = provision.UnitMetric{ID: u.ID, Process: u.ProcessName}
+		}
+		metrics[i] = metric
+	}
+	return metrics, nil
+}
+
 func (p *FakeProvisioner) RegisterUnit(a provision.App, unitId string, customData map[string]interface{}) error {
 	p.mut.Lock()
 	defer p.mut.Unlock()
@@ -1480,16 +1711,21 @@ func (p *PipelineErrorFakeProvisioner) DeployPipeline() *action.Pipeline {
 }
 
 type provisionedApp struct {
-	units       []provision.Unit
-	app         provision.App
-	restarts    map[string]int
-	starts      map[string]int
-	stops       map[string]int
-	sleeps      map[string]int
-	lastArchive string
-	lastFile    io.ReadCloser
-	cnames      []string
-	unitLen     int
-	lastData    map[string]interface{}
-	image       string
+	units        []provision.Unit
+	app          provision.App
+	restarts     map[string]int
+	starts       map[string]int
+	stops        map[string]int
+	sleeps       map[string]int
+	lastArchive  string
+	lastFile     io.ReadCloser
+	cnames       []string
+	unitLen      int
+	lastData     map[string]interface{}
+	image        string
+	canaryImage  string
+	canaryWeight int
+	shadowUnits  []provision.Unit
+	shadowImage  string
+	metrics      map[string]provision.UnitMetric
 }
@@ -653,6 +653,25 @@ func (s *S) TestSleep(c *check.C) {
 	c.Assert(p.Sleeps(app, ""), check.Equals, 1)
 }
 
+func (s *S) TestUnitsMetrics(c *check.C) {
+	app := NewFakeApp("kid-gloves", "rush", 1)
+	p := NewFakeProvisioner()
+	p.Provision(app)
+	err := p.AddUnits(app, 2, "web", nil)
+	c.Assert(err, check.IsNil)
+	units := p.GetUnits(app)
+	err = p.SetUnitMetric(app, provision.UnitMetric{ID: units[1].ID, Process: "web", CPU: 10, Restarts: 3})
+	c.Assert(err, check.IsNil)
+	metrics, err := p.UnitsMetrics(app)
+	c.Assert(err, check.IsNil)
+	c.Assert(metrics, check.DeepEquals, []provision.UnitMetric{
+		{ID: units[0].ID, Process: "web"},
+		{ID: units[1].ID, Process: "web", CPU: 10, Restarts: 3},
+	})
+	_, err = p.UnitsMetrics(NewFakeApp("pride", "shaman", 1))
+	c.Assert(err, check.Equals, errNotProvisioned)
+}
+
 func (s *S) TestRestartNotProvisioned(c *check.C) {
 	app := NewFakeApp("kid-gloves", "rush", 1)
 	p := NewFakeProvisioner()
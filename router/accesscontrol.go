@@ -0,0 +1,128 @@
+// Copyright 2018 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package router
+
+import (
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	OptRateLimit      = "rate-limit"
+	OptRateLimitBurst = "rate-limit-burst"
+	OptAllowCIDRs     = "allow-cidrs"
+	OptDenyCIDRs      = "deny-cidrs"
+)
+
+// AccessControlOptsSchema holds the app router options used to configure
+// access control in routers implementing AccessControlRouter.
+var AccessControlOptsSchema = OptsSchema{
+	OptRateLimit: {
+		Description: "maximum number of requests per second accepted from each client address",
+		Validate:    validatePositiveInt,
+	},
+	OptRateLimitBurst: {
+		Description: "number of requests above the rate limit accepted in bursts",
+		Validate:    validatePositiveInt,
+	},
+	OptAllowCIDRs: {
+		Description: "comma separated list of networks allowed to access the app, all others are denied",
+		Validate:    validateCIDRs,
+	},
+	OptDenyCIDRs: {
+		Description: "comma separated list of networks denied to access the app",
+		Validate:    validateCIDRs,
+	},
+}
+
+// AccessControl holds the rules applied by a router to the requests sent to a
+// backend. Deny rules take precedence over allow rules and an empty allow list
+// allows every address.
+type AccessControl struct {
+	RateLimit      int      `json:"rateLimit,omitempty"`
+	RateLimitBurst int      `json:"rateLimitBurst,omitempty"`
+	Allow          []string `json:"allow,omitempty"`
+	Deny           []string `json:"deny,omitempty"`
+}
+
+// Empty returns whether ac has no rules.
+func (ac AccessControl) Empty() bool {
+	return ac.RateLimit == 0 && len(ac.Allow) == 0 && len(ac.Deny) == 0
+}
+
+// AccessControlRouter is a router able to limit the rate of requests and
+// filter the client addresses allowed to reach a backend.
+type AccessControlRouter interface {
+	SetAccessControl(name string, ac AccessControl) error
+	GetAccessControl(name string) (AccessControl, error)
+}
+
+// AccessControlFromOpts builds the access control rules from the app router
+// options, returning an error if any of the options is invalid.
+func AccessControlFromOpts(opts map[string]string) (AccessControl, error) {
+	var ac AccessControl
+	err := AccessControlOptsSchema.validate(opts, false)
+	if err != nil {
+		return ac, err
+	}
+	ac.RateLimit, _ = strconv.Atoi(opts[OptRateLimit])
+	ac.RateLimitBurst, _ = strconv.Atoi(opts[OptRateLimitBurst])
+	ac.Allow = splitCIDRs(opts[OptAllowCIDRs])
+	ac.Deny = splitCIDRs(opts[OptDenyCIDRs])
+	if ac.RateLimitBurst > 0 && ac.RateLimit == 0 {
+		return ac, &ErrInvalidOpt{Opt: OptRateLimitBurst, Reason: "requires " + OptRateLimit}
+	}
+	return ac, nil
+}
+
+func validatePositiveInt(value string) error {
+	n, err := strconv.Atoi(value)
+	if err != nil || n <= 0 {
+		return errors.New("must be a positive integer")
+	}
+	return nil
+}
+
+func validateCIDRs(value string) error {
+	cidrs := splitCIDRs(value)
+	if len(cidrs) == 0 {
+		return errors.New("must not be empty")
+	}
+	for _, cidr := range cidrs {
+		_, _, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return errors.Errorf("invalid network %q", cidr)
+		}
+	}
+	return nil
+}
+
+func splitCIDRs(value string) []string {
+	var cidrs []string
+	for _, cidr := range strings.Split(value, ",") {
+		cidr = strings.TrimSpace(cidr)
+		if cidr != "" {
+			cidrs = append(cidrs, cidr)
+		}
+	}
+	return cidrs
+}
+
+// SetAccessControlFromOpts applies the access control rules in the app router
+// options to the backend, when r implements AccessControlRouter.
+func SetAccessControlFromOpts(r Router, name string, opts map[string]string) error {
+	acRouter, ok := r.(AccessControlRouter)
+	if !ok {
+		return nil
+	}
+	ac, err := AccessControlFromOpts(opts)
+	if err != nil {
+		return err
+	}
+	return acRouter.SetAccessControl(name, ac)
+}
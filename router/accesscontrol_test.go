@@ -0,0 +1,119 @@
+// Copyright 2018 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package router
+
+import (
+	"gopkg.in/check.v1"
+)
+
+type namedTestRouter struct {
+	Router
+	name string
+}
+
+func (r *namedTestRouter) GetName() string {
+	return r.name
+}
+
+type optsTestRouter struct {
+	namedTestRouter
+	schema OptsSchema
+}
+
+func (r *optsTestRouter) OptsSchema() OptsSchema {
+	return r.schema
+}
+
+type accessControlTestRouter struct {
+	Router
+	rules map[string]AccessControl
+}
+
+func (r *accessControlTestRouter) GetName() string {
+	return "ac-router"
+}
+
+func (r *accessControlTestRouter) SetAccessControl(name string, ac AccessControl) error {
+	r.rules[name] = ac
+	return nil
+}
+
+func (r *accessControlTestRouter) GetAccessControl(name string) (AccessControl, error) {
+	return r.rules[name], nil
+}
+
+func (s *S) TestAccessControlFromOpts(c *check.C) {
+	ac, err := AccessControlFromOpts(map[string]string{
+		"rate-limit":       "10",
+		"rate-limit-burst": "20",
+		"allow-cidrs":      "10.0.0.0/8, 192.168.0.0/16",
+		"deny-cidrs":       "10.1.0.0/16",
+		"other":            "value",
+	})
+	c.Assert(err, check.IsNil)
+	c.Assert(ac, check.DeepEquals, AccessControl{
+		RateLimit:      10,
+		RateLimitBurst: 20,
+		Allow:          []string{"10.0.0.0/8", "192.168.0.0/16"},
+		Deny:           []string{"10.1.0.0/16"},
+	})
+	ac, err = AccessControlFromOpts(nil)
+	c.Assert(err, check.IsNil)
+	c.Assert(ac.Empty(), check.Equals, true)
+}
+
+func (s *S) TestAccessControlFromOptsInvalid(c *check.C) {
+	tests := []struct {
+		opts map[string]string
+		err  string
+	}{
+		{map[string]string{"rate-limit": "x"}, `invalid router option "rate-limit": must be a positive integer`},
+		{map[string]string{"rate-limit": "-1"}, `invalid router option "rate-limit": must be a positive integer`},
+		{map[string]string{"rate-limit-burst": "10"}, `invalid router option "rate-limit-burst": requires rate-limit`},
+		{map[string]string{"allow-cidrs": "10.0.0.1"}, `invalid router option "allow-cidrs": invalid network "10.0.0.1"`},
+		{map[string]string{"deny-cidrs": " , "}, `invalid router option "deny-cidrs": must not be empty`},
+	}
+	for _, tt := range tests {
+		_, err := AccessControlFromOpts(tt.opts)
+		c.Check(err, check.ErrorMatches, tt.err)
+	}
+}
+
+func (s *S) TestValidateOpts(c *check.C) {
+	err := ValidateOpts(&namedTestRouter{name: "free"}, map[string]string{"anything": "value"})
+	c.Assert(err, check.IsNil)
+	r := &optsTestRouter{namedTestRouter: namedTestRouter{name: "strict"}, schema: OptsSchema{"known": {}}}
+	err = ValidateOpts(r, map[string]string{"known": "value"})
+	c.Assert(err, check.IsNil)
+	err = ValidateOpts(r, map[string]string{"anything": "value"})
+	c.Assert(err, check.ErrorMatches, `invalid option "anything" for router "strict": unknown option`)
+	r = &optsTestRouter{namedTestRouter: namedTestRouter{name: "nil-schema"}}
+	err = ValidateOpts(r, map[string]string{"anything": "value"})
+	c.Assert(err, check.IsNil)
+}
+
+func (s *S) TestValidateOptsAccessControlNotSupported(c *check.C) {
+	err := ValidateOpts(&namedTestRouter{name: "free"}, map[string]string{"rate-limit": "10"})
+	c.Assert(err, check.ErrorMatches, `invalid option "rate-limit" for router "free": access control is not supported`)
+}
+
+func (s *S) TestValidateOptsAccessControl(c *check.C) {
+	r := &accessControlTestRouter{}
+	err := ValidateOpts(r, map[string]string{"rate-limit": "10", "other": "value"})
+	c.Assert(err, check.IsNil)
+	err = ValidateOpts(r, map[string]string{"deny-cidrs": "invalid"})
+	c.Assert(err, check.ErrorMatches, `invalid option "deny-cidrs" for router "ac-router": invalid network "invalid"`)
+}
+
+func (s *S) TestSetAccessControlFromOpts(c *check.C) {
+	r := &accessControlTestRouter{rules: map[string]AccessControl{}}
+	err := SetAccessControlFromOpts(r, "myapp", map[string]string{"allow-cidrs": "10.0.0.0/8"})
+	c.Assert(err, check.IsNil)
+	c.Assert(r.rules, check.DeepEquals, map[string]AccessControl{
+		"myapp": {Allow: []string{"10.0.0.0/8"}},
+	})
+	err = SetAccessControlFromOpts(&namedTestRouter{}, "myapp", map[string]string{"allow-cidrs": "10.0.0.0/8"})
+	c.Assert(err, check.IsNil)
+}
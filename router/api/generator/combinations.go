@@ -16,11 +16,13 @@ import (
 )
 
 var capMap = map[string][]string{
-	"cname":       {"router.CNameRouter", "apiRouterWithCnameSupport"},
-	"tls":         {"router.TLSRouter", "apiRouterWithTLSSupport"},
-	"healthcheck": {"router.CustomHealthcheckRouter", "apiRouterWithHealthcheckSupport"},
-	"info":        {"router.InfoRouter", "apiRouterWithInfo"},
-	"status":      {"router.StatusRouter", "apiRouterWithStatus"},
+	"batch":          {"router.MultiBatchRouter", "apiRouterWithBatch"},
+	"cname":          {"router.CNameRouter", "apiRouterWithCnameSupport"},
+	"tls":            {"router.TLSRouter", "apiRouterWithTLSSupport"},
+	"healthcheck":    {"router.CustomHealthcheckRouter", "apiRouterWithHealthcheckSupport"},
+	"info":           {"router.InfoRouter", "apiRouterWithInfo"},
+	"status":         {"router.StatusRouter", "apiRouterWithStatus"},
+	"access-control": {"router.AccessControlRouter", "apiRouterWithAccessControl"},
 }
 
 var fileTpl = `// AUTOMATICALLY GENERATED FILE - DO NOT EDIT!
@@ -54,10 +56,12 @@ func toSupportedInterface(base *apiRouter, supports map[capability]bool) router.
 		return &struct {
 			router.Router
 			router.OptsRouter
+			router.OptsSchemaRouter
 		{{ range $element -}}
 			{{ index (index $capMap (index $caps .)) 0 }}
 		{{ end -}}
 		}{
+			base,
 			base,
 			base,
 			{{ range $element -}}
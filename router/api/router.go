@@ -12,8 +12,10 @@ import (
 	"io/ioutil"
 	"net/http"
 	"net/url"
-
+	"regexp"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/pkg/errors"
 	"github.com/tsuru/config"
@@ -28,14 +30,17 @@ const routerType = "api"
 
 var (
 	_ router.OptsRouter              = &apiRouter{}
+	_ router.OptsSchemaRouter        = &apiRouter{}
 	_ router.Router                  = &apiRouter{}
 	_ router.MessageRouter           = &apiRouter{}
 	_ router.HealthChecker           = &apiRouter{}
+	_ router.MultiBatchRouter        = &apiRouterWithBatch{}
 	_ router.TLSRouter               = &apiRouterWithTLSSupport{}
 	_ router.CNameRouter             = &apiRouterWithCnameSupport{}
 	_ router.CustomHealthcheckRouter = &apiRouterWithHealthcheckSupport{}
 	_ router.InfoRouter              = &apiRouterWithInfo{}
 	_ router.StatusRouter            = &apiRouterWithStatus{}
+	_ router.AccessControlRouter     = &apiRouterWithAccessControl{}
 )
 
 type apiRouter struct {
@@ -44,6 +49,7 @@ type apiRouter struct {
 	headers    map[string]string
 	client     *http.Client
 	debug      bool
+	optsSchema router.OptsSchema
 }
 
 type apiRouterWithCnameSupport struct{ *apiRouter }
@@ -56,6 +62,10 @@ type apiRouterWithInfo struct{ *apiRouter }
 
 type apiRouterWithStatus struct{ *apiRouter }
 
+type apiRouterWithAccessControl struct{ *apiRouter }
+
+type apiRouterWithBatch struct{ *apiRouter }
+
 type routesReq struct {
 	Addresses []string `json:"addresses"`
 }
@@ -74,6 +84,13 @@ type certData struct {
 	Key         string `json:"key"`
 }
 
+type multiRoutesResp struct {
+	Backends map[string]struct {
+		Addresses []string `json:"addresses"`
+		Version   string   `json:"version"`
+	} `json:"backends"`
+}
+
 type backendResp struct {
 	Address string `json:"address"`
 }
@@ -86,13 +103,37 @@ type statusResp struct {
 type capability string
 
 var (
-	capCName       = capability("cname")
-	capTLS         = capability("tls")
-	capHealthcheck = capability("healthcheck")
-	capInfo        = capability("info")
-	capStatus      = capability("status")
+	capCName         = capability("cname")
+	capTLS           = capability("tls")
+	capHealthcheck   = capability("healthcheck")
+	capInfo          = capability("info")
+	capStatus        = capability("status")
+	capAccessControl = capability("access-control")
+	capBatch         = capability("batch")
+
+	allCaps = []capability{capCName, capTLS, capHealthcheck, capInfo, capStatus, capAccessControl}
+)
 
-	allCaps = []capability{capCName, capTLS, capHealthcheck, capInfo, capStatus}
+// Keys in the response of the info endpoint used to negotiate the version of
+// the protocol. Routers speaking the second version return "2" as the
+// api-version and a comma separated list of capabilities.
+const (
+	infoAPIVersion   = "api-version"
+	infoCapabilities = "capabilities"
+)
+
+// negotiationTTL is how long the capabilities negotiated with a router are
+// reused by router.Get before being negotiated again.
+var negotiationTTL = time.Minute
+
+type negotiation struct {
+	supports map[capability]bool
+	expires  time.Time
+}
+
+var (
+	negotiationsMu sync.Mutex
+	negotiations   = map[string]negotiation{}
 )
 
 func init() {
@@ -121,22 +162,115 @@ func createRouter(routerName, configPrefix string) (router.Router, error) {
 			headerMap[k] = v
 		}
 	}
+	optsSchema, err := optsSchemaFromConfig(configPrefix + ":opts")
+	if err != nil {
+		return nil, err
+	}
 	baseRouter := &apiRouter{
 		routerName: routerName,
 		endpoint:   endpoint,
 		client:     net.Dial5Full60ClientNoKeepAlive,
 		debug:      debug,
 		headers:    headerMap,
+		optsSchema: optsSchema,
+	}
+	return toSupportedInterface(baseRouter, baseRouter.capabilities()), nil
+}
+
+// capabilities returns the capabilities of the router, negotiating them only
+// when the last successful negotiation with its endpoint is older than
+// negotiationTTL.
+func (r *apiRouter) capabilities() map[capability]bool {
+	key := r.routerName + "\x00" + r.endpoint
+	negotiationsMu.Lock()
+	cached, ok := negotiations[key]
+	negotiationsMu.Unlock()
+	if ok && time.Now().Before(cached.expires) {
+		return cached.supports
+	}
+	supports, err := r.negotiate()
+	if err != nil {
+		log.Errorf("failed to negotiate capabilities with router %q: %s", r.routerName, err)
+		return supports
+	}
+	negotiationsMu.Lock()
+	negotiations[key] = negotiation{supports: supports, expires: time.Now().Add(negotiationTTL)}
+	negotiationsMu.Unlock()
+	return supports
+}
+
+func resetNegotiations() {
+	negotiationsMu.Lock()
+	defer negotiationsMu.Unlock()
+	negotiations = map[string]negotiation{}
+}
+
+// optsSchemaFromConfig reads the options accepted by the router backends,
+// each one with a description and an optional regular expression the values
+// must match. It returns a nil schema, accepting any option, when no options
+// are configured.
+func optsSchemaFromConfig(key string) (router.OptsSchema, error) {
+	data, _ := config.Get(key)
+	if data == nil {
+		return nil, nil
+	}
+	opts, ok := data.(map[interface{}]interface{})
+	if !ok {
+		return nil, errors.Errorf("invalid opts configuration: %v", data)
+	}
+	schema := make(router.OptsSchema, len(opts))
+	for name := range opts {
+		name, ok := name.(string)
+		if !ok {
+			return nil, errors.Errorf("invalid opts configuration: %v", data)
+		}
+		description, _ := config.GetString(key + ":" + name + ":description")
+		opt := router.OptSchema{Description: description}
+		pattern, _ := config.GetString(key + ":" + name + ":pattern")
+		if pattern != "" {
+			re, err := regexp.Compile(pattern)
+			if err != nil {
+				return nil, errors.Wrapf(err, "invalid pattern for opt %q", name)
+			}
+			opt.Validate = func(value string) error {
+				if !re.MatchString(value) {
+					return errors.Errorf("must match %q", pattern)
+				}
+				return nil
+			}
+		}
+		schema[name] = opt
 	}
+	return schema, nil
+}
+
+// negotiate asks the router for the version of the protocol and its
+// capabilities through the info endpoint. Routers speaking the second version
+// support the batch endpoints. Routers not reporting a version speak the
+// first version of the protocol, having each capability checked in the
+// support endpoint. The error reports capabilities that couldn't be checked.
+func (r *apiRouter) negotiate() (map[capability]bool, error) {
 	supports := map[capability]bool{}
+	info, err := r.info()
+	if err == nil && info[infoAPIVersion] == "2" {
+		supports[capInfo] = true
+		supports[capBatch] = true
+		for _, cap := range strings.Split(info[infoCapabilities], ",") {
+			if cap = strings.TrimSpace(cap); cap != "" {
+				supports[capability(cap)] = true
+			}
+		}
+		return supports, nil
+	}
+	var lastErr error
 	for _, cap := range allCaps {
 		var err error
-		supports[cap], err = baseRouter.checkSupports(string(cap))
+		supports[cap], err = r.checkSupports(string(cap))
 		if err != nil {
-			log.Errorf("failed to fetch %q support from router %q: %s", cap, routerName, err)
+			lastErr = err
 		}
 	}
-	return toSupportedInterface(baseRouter, supports), nil
+	return supports, lastErr
 }
 
 func (r *apiRouter) GetName() string {
@@ -147,6 +281,12 @@ func (r *apiRouter) AddBackend(app router.App) (err error) {
 	return r.AddBackendOpts(app, nil)
 }
 
+// OptsSchema returns the options configured for the router, or nil if none
+// are configured.
+func (r *apiRouter) OptsSchema() router.OptsSchema {
+	return r.optsSchema
+}
+
 func (r *apiRouter) AddBackendOpts(app router.App, opts map[string]string) error {
 	err := r.doBackendOpts(app, http.MethodPost, opts)
 	if err != nil {
@@ -234,12 +374,16 @@ func (r *apiRouter) Routes(name string) (result []*url.URL, err error) {
 	if err != nil {
 		return nil, err
 	}
+	return parseRoutes(data)
+}
+
+func parseRoutes(data []byte) ([]*url.URL, error) {
 	req := &routesReq{}
-	err = json.Unmarshal(data, req)
+	err := json.Unmarshal(data, req)
 	if err != nil {
 		return nil, err
 	}
-	result = []*url.URL{}
+	result := []*url.URL{}
 	for _, addr := range req.Addresses {
 		u, err := url.Parse(addr)
 		if err != nil {
@@ -250,6 +394,104 @@ func (r *apiRouter) Routes(name string) (result []*url.URL, err error) {
 	return result, nil
 }
 
+// VersionedRoutes returns the routes of the backend and their version, the
+// ETag of the routes in the router.
+func (r *apiRouterWithBatch) VersionedRoutes(name string) ([]*url.URL, string, error) {
+	backendName, err := router.Retrieve(name)
+	if err != nil {
+		return nil, "", err
+	}
+	path := fmt.Sprintf("v2/backend/%s/routes", backendName)
+	data, header, statusCode, err := r.doRequest(http.MethodGet, path, nil, nil)
+	if statusCode == http.StatusNotFound {
+		return nil, "", router.ErrBackendNotFound
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	routes, err := parseRoutes(data)
+	if err != nil {
+		return nil, "", err
+	}
+	return routes, header.Get("ETag"), nil
+}
+
+// SetRoutes replaces the routes of the backend with a single request, sending
+// the version in the If-Match header.
+func (r *apiRouterWithBatch) SetRoutes(name string, addresses []*url.URL, version string) error {
+	backendName, err := router.Retrieve(name)
+	if err != nil {
+		return err
+	}
+	req := &routesReq{Addresses: make([]string, len(addresses))}
+	for i := range addresses {
+		req.Addresses[i] = addresses[i].String()
+	}
+	data, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+	var headers map[string]string
+	if version != "" {
+		headers = map[string]string{"If-Match": version}
+	}
+	path := fmt.Sprintf("v2/backend/%s/routes", backendName)
+	_, _, statusCode, err := r.doRequest(http.MethodPut, path, bytes.NewReader(data), headers)
+	switch statusCode {
+	case http.StatusNotFound:
+		return router.ErrBackendNotFound
+	case http.StatusPreconditionFailed:
+		return router.ErrRoutesVersionConflict
+	}
+	return err
+}
+
+// VersionedRoutesMulti returns the routes of many backends with a single
+// request, keyed by the given names.
+func (r *apiRouterWithBatch) VersionedRoutesMulti(names []string) (map[string]router.VersionedRoutes, error) {
+	query := url.Values{}
+	backendNames := make(map[string]string, len(names))
+	for _, name := range names {
+		backendName, err := router.Retrieve(name)
+		if err == router.ErrBackendNotFound {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		backendNames[backendName] = name
+		query.Add("backend", backendName)
+	}
+	result := make(map[string]router.VersionedRoutes, len(backendNames))
+	if len(backendNames) == 0 {
+		return result, nil
+	}
+	data, _, err := r.do(http.MethodGet, "v2/routes?"+query.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	var resp multiRoutesResp
+	err = json.Unmarshal(data, &resp)
+	if err != nil {
+		return nil, err
+	}
+	for backendName, backend := range resp.Backends {
+		name, ok := backendNames[backendName]
+		if !ok {
+			continue
+		}
+		routes := make([]*url.URL, len(backend.Addresses))
+		for i, addr := range backend.Addresses {
+			routes[i], err = url.Parse(addr)
+			if err != nil {
+				return nil, errors.Errorf("failed to parse url %s: %s", addr, err)
+			}
+		}
+		result[name] = router.VersionedRoutes{Routes: routes, Version: backend.Version}
+	}
+	return result, nil
+}
+
 func (r *apiRouter) Addr(name string) (addr string, err error) {
 	backendName, err := router.Retrieve(name)
 	if err != nil {
@@ -312,7 +554,12 @@ func (r *apiRouter) checkSupports(feature string) (bool, error) {
 	return false, errors.Errorf("failed to check support for %s: %s - %s - %d", feature, err, data, statusCode)
 }
 
-func (r *apiRouter) do(method, path string, body io.Reader) (data []byte, code int, err error) {
+func (r *apiRouter) do(method, path string, body io.Reader) ([]byte, int, error) {
+	data, _, code, err := r.doRequest(method, path, body, nil)
+	return data, code, err
+}
+
+func (r *apiRouter) doRequest(method, path string, body io.Reader, reqHeaders map[string]string) (data []byte, header http.Header, code int, err error) {
 	done := router.InstrumentRequest(r.routerName)
 	defer func() {
 		done(err)
@@ -320,12 +567,15 @@ func (r *apiRouter) do(method, path string, body io.Reader) (data []byte, code i
 	url := fmt.Sprintf("%s/%s", strings.TrimRight(r.endpoint, "/"), strings.TrimLeft(path, "/"))
 	req, err := http.NewRequest(method, url, body)
 	if err != nil {
-		return nil, 0, err
+		return nil, nil, 0, err
 	}
 	req.Header.Set("Content-Type", "application/json")
 	for k, v := range r.headers {
 		req.Header.Set(k, v)
 	}
+	for k, v := range reqHeaders {
+		req.Header.Set(k, v)
+	}
 	resp, err := r.client.Do(req)
 	if r.debug {
 		bodyData, _ := ioutil.ReadAll(body)
@@ -335,18 +585,18 @@ func (r *apiRouter) do(method, path string, body io.Reader) (data []byte, code i
 		log.Debugf("%s %s %s %s: %d", r.routerName, method, url, string(bodyData), code)
 	}
 	if err != nil {
-		return nil, 0, err
+		return nil, nil, 0, err
 	}
 	defer resp.Body.Close()
 	code = resp.StatusCode
 	data, err = ioutil.ReadAll(resp.Body)
 	if err != nil {
-		return data, code, errors.Errorf("failed to read response body for %s: %s", url, err)
+		return data, resp.Header, code, errors.Errorf("failed to read response body for %s: %s", url, err)
 	}
 	if resp.StatusCode >= 300 {
-		return data, code, errors.Errorf("failed to request %s - %d - %s", url, code, data)
+		return data, resp.Header, code, errors.Errorf("failed to request %s - %d - %s", url, code, data)
 	}
-	return data, code, nil
+	return data, resp.Header, code, nil
 }
 
 func (r *apiRouterWithCnameSupport) SetCName(cname, name string) error {
@@ -458,6 +708,10 @@ func (r *apiRouterWithHealthcheckSupport) SetHealthcheck(name string, data route
 }
 
 func (r *apiRouterWithInfo) GetInfo() (map[string]string, error) {
+	return r.info()
+}
+
+func (r *apiRouter) info() (map[string]string, error) {
 	data, _, err := r.do(http.MethodGet, "info", nil)
 	if err != nil {
 		return nil, err
@@ -487,6 +741,39 @@ func (r *apiRouterWithStatus) GetBackendStatus(name string) (router.BackendStatu
 	return status.Status, status.Detail, nil
 }
 
+func (r *apiRouterWithAccessControl) SetAccessControl(name string, ac router.AccessControl) error {
+	backendName, err := router.Retrieve(name)
+	if err != nil {
+		return err
+	}
+	b, err := json.Marshal(ac)
+	if err != nil {
+		return err
+	}
+	_, code, err := r.do(http.MethodPut, fmt.Sprintf("backend/%s/access-control", backendName), bytes.NewReader(b))
+	if code == http.StatusNotFound {
+		return router.ErrBackendNotFound
+	}
+	return err
+}
+
+func (r *apiRouterWithAccessControl) GetAccessControl(name string) (router.AccessControl, error) {
+	var ac router.AccessControl
+	backendName, err := router.Retrieve(name)
+	if err != nil {
+		return ac, err
+	}
+	data, code, err := r.do(http.MethodGet, fmt.Sprintf("backend/%s/access-control", backendName), nil)
+	if code == http.StatusNotFound {
+		return ac, router.ErrBackendNotFound
+	}
+	if err != nil {
+		return ac, err
+	}
+	err = json.Unmarshal(data, &ac)
+	return ac, err
+}
+
 func addDefaultOpts(app router.App, opts map[string]string) map[string]interface{} {
 	mergedOpts := make(map[string]interface{})
 	for k, v := range opts {
@@ -9,12 +9,10 @@ import (
 	"fmt"
 	"net"
 	"net/http"
-	"strings"
-	"testing"
-
 	"net/url"
-
 	"sort"
+	"strings"
+	"testing"
 
 	"github.com/gorilla/mux"
 	"github.com/tsuru/config"
@@ -41,6 +39,7 @@ func init() {
 	suite := &routertest.RouterSuite{}
 	var r *fakeRouterAPI
 	suite.SetUpTestFunc = func(c *check.C) {
+		resetNegotiations()
 		r = newFakeRouter(c)
 		r.router.HandleFunc("/support/{feature}", func(http.ResponseWriter, *http.Request) {
 		})
@@ -63,6 +62,7 @@ func init() {
 }
 
 func (s *S) SetUpTest(c *check.C) {
+	resetNegotiations()
 	s.apiRouter = newFakeRouter(c)
 	s.apiRouter.certificates = make(map[string]certData)
 	s.testRouter = &apiRouter{
@@ -350,14 +350,34 @@ func (s *S) TestHealcheckBackendNotFound(c *check.C) {
 	c.Assert(err, check.DeepEquals, router.ErrBackendNotFound)
 }
 
+func (s *S) TestSetAccessControl(c *check.C) {
+	acRouter := &apiRouterWithAccessControl{s.testRouter}
+	ac := router.AccessControl{RateLimit: 10, Allow: []string{"10.0.0.0/8"}}
+	err := acRouter.SetAccessControl("mybackend", ac)
+	c.Assert(err, check.IsNil)
+	c.Assert(s.apiRouter.backends["mybackend"].accessControl, check.DeepEquals, ac)
+	result, err := acRouter.GetAccessControl("mybackend")
+	c.Assert(err, check.IsNil)
+	c.Assert(result, check.DeepEquals, ac)
+}
+
+func (s *S) TestAccessControlBackendNotFound(c *check.C) {
+	acRouter := &apiRouterWithAccessControl{s.testRouter}
+	err := acRouter.SetAccessControl("invalid", router.AccessControl{RateLimit: 10})
+	c.Assert(err, check.Equals, router.ErrBackendNotFound)
+	_, err = acRouter.GetAccessControl("invalid")
+	c.Assert(err, check.Equals, router.ErrBackendNotFound)
+}
+
 func (s *S) TestCreateRouterSupport(c *check.C) {
 	tt := []struct {
-		features    map[string]bool
-		expectCname bool
-		expectTLS   bool
-		expectHC    bool
+		features            map[string]bool
+		expectCname         bool
+		expectTLS           bool
+		expectHC            bool
+		expectAccessControl bool
 	}{
-		{nil, false, false, false},
+		{nil, false, false, false, false},
 		{features: map[string]bool{"cname": true}, expectCname: true},
 		{features: map[string]bool{"tls": true}, expectTLS: true},
 		{features: map[string]bool{"healthcheck": true}, expectHC: true},
@@ -365,6 +385,8 @@ func (s *S) TestCreateRouterSupport(c *check.C) {
 		{features: map[string]bool{"cname": true, "tls": true, "healthcheck": true}, expectCname: true, expectTLS: true, expectHC: true},
 		{features: map[string]bool{"cname": true, "healthcheck": true}, expectCname: true, expectHC: true},
 		{features: map[string]bool{"tls": true, "healthcheck": true}, expectTLS: true, expectHC: true},
+		{features: map[string]bool{"access-control": true}, expectAccessControl: true},
+		{features: map[string]bool{"cname": true, "access-control": true}, expectCname: true, expectAccessControl: true},
 	}
 	var i int
 	s.apiRouter.router.HandleFunc("/support/{name}", func(w http.ResponseWriter, r *http.Request) {
@@ -381,6 +403,7 @@ func (s *S) TestCreateRouterSupport(c *check.C) {
 		w.WriteHeader(http.StatusNotFound)
 	})
 	for i = range tt {
+		resetNegotiations()
 		comment := check.Commentf("case %d: %v", i, tt[i])
 		r, err := createRouter("myrouter", "routers:apirouter")
 		c.Assert(err, check.IsNil, comment)
@@ -390,6 +413,8 @@ func (s *S) TestCreateRouterSupport(c *check.C) {
 		c.Assert(ok, check.Equals, tt[i].expectTLS, comment)
 		_, ok = r.(router.CustomHealthcheckRouter)
 		c.Assert(ok, check.Equals, tt[i].expectHC, comment)
+		_, ok = r.(router.AccessControlRouter)
+		c.Assert(ok, check.Equals, tt[i].expectAccessControl, comment)
 	}
 }
 
@@ -407,11 +432,140 @@ func (s *S) TestCreateCustomHeaders(c *check.C) {
 	_, code, err := r.(*struct {
 		router.Router
 		router.OptsRouter
+		router.OptsSchemaRouter
 	}).Router.(*apiRouter).do(http.MethodGet, "/custom", nil)
 	c.Assert(code, check.DeepEquals, http.StatusOK)
 	c.Assert(err, check.IsNil)
 }
 
+func (s *S) TestCreateRouterOptsSchema(c *check.C) {
+	config.Set("routers:apirouter:opts", map[interface{}]interface{}{
+		"tier": map[interface{}]interface{}{
+			"description": "size of the balancer",
+			"pattern":     "^(small|large)$",
+		},
+		"domain": map[interface{}]interface{}{},
+	})
+	defer config.Unset("routers:apirouter:opts")
+	r, err := createRouter("apirouter", "routers:apirouter")
+	c.Assert(err, check.IsNil)
+	schemaRouter, ok := r.(router.OptsSchemaRouter)
+	c.Assert(ok, check.Equals, true)
+	schema := schemaRouter.OptsSchema()
+	c.Assert(schema, check.HasLen, 2)
+	c.Assert(schema["tier"].Description, check.Equals, "size of the balancer")
+	err = router.ValidateOpts(r, map[string]string{"tier": "small", "domain": "a.io"})
+	c.Assert(err, check.IsNil)
+	err = router.ValidateOpts(r, map[string]string{"tier": "medium"})
+	c.Assert(err, check.ErrorMatches, `invalid option "tier" for router "apirouter": must match "\^\(small\|large\)\$"`)
+	err = router.ValidateOpts(r, map[string]string{"other": "value"})
+	c.Assert(err, check.ErrorMatches, `invalid option "other" for router "apirouter": unknown option`)
+}
+
+func (s *S) TestCreateRouterWithoutOptsSchema(c *check.C) {
+	r, err := createRouter("apirouter", "routers:apirouter")
+	c.Assert(err, check.IsNil)
+	err = router.ValidateOpts(r, map[string]string{"anything": "value"})
+	c.Assert(err, check.IsNil)
+}
+
+func (s *S) TestCreateRouterInvalidOptsSchema(c *check.C) {
+	config.Set("routers:apirouter:opts", map[interface{}]interface{}{
+		"tier": map[interface{}]interface{}{"pattern": "("},
+	})
+	defer config.Unset("routers:apirouter:opts")
+	_, err := createRouter("apirouter", "routers:apirouter")
+	c.Assert(err, check.ErrorMatches, `invalid pattern for opt "tier": .*`)
+}
+
+func (s *S) TestCreateRouterNegotiatesV2(c *check.C) {
+	s.apiRouter.info = map[string]string{"api-version": "2", "capabilities": "cname, tls"}
+	var supportCalls int
+	s.apiRouter.router.HandleFunc("/support/{feature}", func(w http.ResponseWriter, r *http.Request) {
+		supportCalls++
+	})
+	r, err := createRouter("myrouter", "routers:apirouter")
+	c.Assert(err, check.IsNil)
+	c.Assert(supportCalls, check.Equals, 0)
+	_, ok := r.(router.CNameRouter)
+	c.Assert(ok, check.Equals, true)
+	_, ok = r.(router.TLSRouter)
+	c.Assert(ok, check.Equals, true)
+	_, ok = r.(router.InfoRouter)
+	c.Assert(ok, check.Equals, true)
+	_, ok = r.(router.CustomHealthcheckRouter)
+	c.Assert(ok, check.Equals, false)
+	_, ok = r.(router.StatusRouter)
+	c.Assert(ok, check.Equals, false)
+	_, ok = r.(router.MultiBatchRouter)
+	c.Assert(ok, check.Equals, true)
+}
+
+func (s *S) TestCreateRouterV1NotBatch(c *check.C) {
+	r, err := createRouter("myrouter", "routers:apirouter")
+	c.Assert(err, check.IsNil)
+	_, ok := r.(router.BatchRouter)
+	c.Assert(ok, check.Equals, false)
+}
+
+func (s *S) TestCreateRouterCachesNegotiation(c *check.C) {
+	s.apiRouter.info = map[string]string{"api-version": "2"}
+	r, err := createRouter("myrouter", "routers:apirouter")
+	c.Assert(err, check.IsNil)
+	_, ok := r.(router.BatchRouter)
+	c.Assert(ok, check.Equals, true)
+	r, err = createRouter("myrouter", "routers:apirouter")
+	c.Assert(err, check.IsNil)
+	_, ok = r.(router.BatchRouter)
+	c.Assert(ok, check.Equals, true)
+	c.Assert(s.apiRouter.infoCalls, check.Equals, 1)
+	resetNegotiations()
+	_, err = createRouter("myrouter", "routers:apirouter")
+	c.Assert(err, check.IsNil)
+	c.Assert(s.apiRouter.infoCalls, check.Equals, 2)
+}
+
+func (s *S) TestVersionedRoutesV2(c *check.C) {
+	batchRouter := &apiRouterWithBatch{s.testRouter}
+	routes, version, err := batchRouter.VersionedRoutes("mybackend")
+	c.Assert(err, check.IsNil)
+	c.Assert(routes, check.HasLen, 2)
+	c.Assert(version, check.Equals, `"2-http://127.0.0.1:32876,http://127.0.0.1:32678"`)
+	_, _, err = batchRouter.VersionedRoutes("invalid")
+	c.Assert(err, check.Equals, router.ErrBackendNotFound)
+}
+
+func (s *S) TestSetRoutesV2(c *check.C) {
+	batchRouter := &apiRouterWithBatch{s.testRouter}
+	_, version, err := batchRouter.VersionedRoutes("mybackend")
+	c.Assert(err, check.IsNil)
+	addr, err := url.Parse("http://127.0.0.1:1234")
+	c.Assert(err, check.IsNil)
+	err = batchRouter.SetRoutes("mybackend", []*url.URL{addr}, version)
+	c.Assert(err, check.IsNil)
+	c.Assert(s.apiRouter.backends["mybackend"].addresses, check.DeepEquals, []string{"http://127.0.0.1:1234"})
+	err = batchRouter.SetRoutes("mybackend", nil, version)
+	c.Assert(err, check.Equals, router.ErrRoutesVersionConflict)
+	c.Assert(s.apiRouter.backends["mybackend"].addresses, check.DeepEquals, []string{"http://127.0.0.1:1234"})
+	err = batchRouter.SetRoutes("mybackend", nil, "")
+	c.Assert(err, check.IsNil)
+	c.Assert(s.apiRouter.backends["mybackend"].addresses, check.HasLen, 0)
+}
+
+func (s *S) TestVersionedRoutesMulti(c *check.C) {
+	batchRouter := &apiRouterWithBatch{s.testRouter}
+	err := router.Store("other", "other", "api")
+	c.Assert(err, check.IsNil)
+	s.apiRouter.backends["other"] = &backend{addresses: []string{"http://127.0.0.1:1234"}}
+	routes, err := batchRouter.VersionedRoutesMulti([]string{"mybackend", "other", "missing"})
+	c.Assert(err, check.IsNil)
+	c.Assert(routes, check.HasLen, 2)
+	c.Assert(routes["mybackend"].Routes, check.HasLen, 2)
+	c.Assert(routes["mybackend"].Version, check.Equals, `"2-http://127.0.0.1:32876,http://127.0.0.1:32678"`)
+	c.Assert(routes["other"].Routes[0].String(), check.Equals, "http://127.0.0.1:1234")
+	c.Assert(routes["other"].Version, check.Equals, `"1-http://127.0.0.1:1234"`)
+}
+
 func newFakeRouter(c *check.C) *fakeRouterAPI {
 	api := &fakeRouterAPI{}
 	r := mux.NewRouter()
@@ -431,7 +585,12 @@ func newFakeRouter(c *check.C) *fakeRouterAPI {
 	r.HandleFunc("/backend/{name}/certificate/{cname}", api.addCertificate).Methods(http.MethodPut)
 	r.HandleFunc("/backend/{name}/certificate/{cname}", api.removeCertificate).Methods(http.MethodDelete)
 	r.HandleFunc("/backend/{name}/status", api.getStatusBackend).Methods(http.MethodGet)
+	r.HandleFunc("/backend/{name}/access-control", api.getAccessControl).Methods(http.MethodGet)
+	r.HandleFunc("/backend/{name}/access-control", api.setAccessControl).Methods(http.MethodPut)
 	r.HandleFunc("/info", api.getInfo).Methods(http.MethodGet)
+	r.HandleFunc("/v2/backend/{name}/routes", api.getRoutesV2).Methods(http.MethodGet)
+	r.HandleFunc("/v2/backend/{name}/routes", api.setRoutesV2).Methods(http.MethodPut)
+	r.HandleFunc("/v2/routes", api.getRoutesMulti).Methods(http.MethodGet)
 
 	listener, err := net.Listen("tcp", "127.0.0.1:0")
 	c.Assert(err, check.IsNil)
@@ -443,13 +602,14 @@ func newFakeRouter(c *check.C) *fakeRouterAPI {
 }
 
 type backend struct {
-	addr        string
-	addresses   []string
-	cnames      []string
-	swapWith    string
-	cnameOnly   bool
-	healthcheck router.HealthcheckData
-	opts        map[string]interface{}
+	addr          string
+	addresses     []string
+	cnames        []string
+	swapWith      string
+	cnameOnly     bool
+	healthcheck   router.HealthcheckData
+	accessControl router.AccessControl
+	opts          map[string]interface{}
 }
 
 type fakeRouterAPI struct {
@@ -458,13 +618,73 @@ type fakeRouterAPI struct {
 	certificates map[string]certData
 	endpoint     string
 	router       *mux.Router
+	info         map[string]string
+	infoCalls    int
 }
 
 func (f *fakeRouterAPI) getInfo(w http.ResponseWriter, r *http.Request) {
+	f.infoCalls++
 	w.Header().Set("Content-Type", "application/json")
+	if f.info != nil {
+		json.NewEncoder(w).Encode(f.info)
+		return
+	}
 	w.Write([]byte(`{"just": "proper"}`))
 }
 
+func fakeRoutesETag(addresses []string) string {
+	return fmt.Sprintf(`"%d-%s"`, len(addresses), strings.Join(addresses, ","))
+}
+
+func (f *fakeRouterAPI) getRoutesV2(w http.ResponseWriter, r *http.Request) {
+	backend, ok := f.backends[mux.Vars(r)["name"]]
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	w.Header().Set("ETag", fakeRoutesETag(backend.addresses))
+	json.NewEncoder(w).Encode(&routesReq{Addresses: backend.addresses})
+}
+
+func (f *fakeRouterAPI) getRoutesMulti(w http.ResponseWriter, r *http.Request) {
+	resp := multiRoutesResp{Backends: map[string]struct {
+		Addresses []string `json:"addresses"`
+		Version   string   `json:"version"`
+	}{}}
+	for _, name := range r.URL.Query()["backend"] {
+		backend, ok := f.backends[name]
+		if !ok {
+			continue
+		}
+		b := resp.Backends[name]
+		b.Addresses = backend.addresses
+		b.Version = fakeRoutesETag(backend.addresses)
+		resp.Backends[name] = b
+	}
+	json.NewEncoder(w).Encode(&resp)
+}
+
+func (f *fakeRouterAPI) setRoutesV2(w http.ResponseWriter, r *http.Request) {
+	backend, ok := f.backends[mux.Vars(r)["name"]]
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	ifMatch := r.Header.Get("If-Match")
+	if ifMatch != "" && ifMatch != fakeRoutesETag(backend.addresses) {
+		w.WriteHeader(http.StatusPreconditionFailed)
+		return
+	}
+	req := &routesReq{}
+	err := json.NewDecoder(r.Body).Decode(req)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	backend.addresses = req.Addresses
+	w.Header().Set("ETag", fakeRoutesETag(backend.addresses))
+}
+
 func (f *fakeRouterAPI) getStatusBackend(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	w.Write([]byte(`{"status": "ready", "detail": "anaander"}`))
@@ -743,6 +963,26 @@ func (f *fakeRouterAPI) setHealthcheck(w http.ResponseWriter, r *http.Request) {
 	b.healthcheck = hc
 }
 
+func (f *fakeRouterAPI) getAccessControl(w http.ResponseWriter, r *http.Request) {
+	b, ok := f.backends[mux.Vars(r)["name"]]
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	json.NewEncoder(w).Encode(b.accessControl)
+}
+
+func (f *fakeRouterAPI) setAccessControl(w http.ResponseWriter, r *http.Request) {
+	b, ok := f.backends[mux.Vars(r)["name"]]
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	var ac router.AccessControl
+	json.NewDecoder(r.Body).Decode(&ac)
+	b.accessControl = ac
+}
+
 func (f *fakeRouterAPI) stop() {
 	f.listener.Close()
 }
@@ -12,428 +12,2277 @@ import (
 )
 
 func toSupportedInterface(base *apiRouter, supports map[capability]bool) router.Router {
+	apiRouterWithAccessControlInst := &apiRouterWithAccessControl{base}
+	apiRouterWithBatchInst := &apiRouterWithBatch{base}
 	apiRouterWithCnameSupportInst := &apiRouterWithCnameSupport{base}
 	apiRouterWithHealthcheckSupportInst := &apiRouterWithHealthcheckSupport{base}
 	apiRouterWithInfoInst := &apiRouterWithInfo{base}
 	apiRouterWithStatusInst := &apiRouterWithStatus{base}
 	apiRouterWithTLSSupportInst := &apiRouterWithTLSSupport{base}
 
-	if !supports["cname"] && !supports["healthcheck"] && !supports["info"] && !supports["status"] && !supports["tls"] {
+	if !supports["access-control"] && !supports["batch"] && !supports["cname"] && !supports["healthcheck"] && !supports["info"] && !supports["status"] && !supports["tls"] {
 		return &struct {
 			router.Router
 			router.OptsRouter
+			router.OptsSchemaRouter
 		}{
 			base,
 			base,
+			base,
+		}
+	}
+	if supports["access-control"] && !supports["batch"] && !supports["cname"] && !supports["healthcheck"] && !supports["info"] && !supports["status"] && !supports["tls"] {
+		return &struct {
+			router.Router
+			router.OptsRouter
+			router.OptsSchemaRouter
+			router.AccessControlRouter
+		}{
+			base,
+			base,
+			base,
+			apiRouterWithAccessControlInst,
+		}
+	}
+	if !supports["access-control"] && supports["batch"] && !supports["cname"] && !supports["healthcheck"] && !supports["info"] && !supports["status"] && !supports["tls"] {
+		return &struct {
+			router.Router
+			router.OptsRouter
+			router.OptsSchemaRouter
+			router.MultiBatchRouter
+		}{
+			base,
+			base,
+			base,
+			apiRouterWithBatchInst,
+		}
+	}
+	if supports["access-control"] && supports["batch"] && !supports["cname"] && !supports["healthcheck"] && !supports["info"] && !supports["status"] && !supports["tls"] {
+		return &struct {
+			router.Router
+			router.OptsRouter
+			router.OptsSchemaRouter
+			router.AccessControlRouter
+			router.MultiBatchRouter
+		}{
+			base,
+			base,
+			base,
+			apiRouterWithAccessControlInst,
+			apiRouterWithBatchInst,
+		}
+	}
+	if !supports["access-control"] && !supports["batch"] && supports["cname"] && !supports["healthcheck"] && !supports["info"] && !supports["status"] && !supports["tls"] {
+		return &struct {
+			router.Router
+			router.OptsRouter
+			router.OptsSchemaRouter
+			router.CNameRouter
+		}{
+			base,
+			base,
+			base,
+			apiRouterWithCnameSupportInst,
+		}
+	}
+	if supports["access-control"] && !supports["batch"] && supports["cname"] && !supports["healthcheck"] && !supports["info"] && !supports["status"] && !supports["tls"] {
+		return &struct {
+			router.Router
+			router.OptsRouter
+			router.OptsSchemaRouter
+			router.AccessControlRouter
+			router.CNameRouter
+		}{
+			base,
+			base,
+			base,
+			apiRouterWithAccessControlInst,
+			apiRouterWithCnameSupportInst,
+		}
+	}
+	if !supports["access-control"] && supports["batch"] && supports["cname"] && !supports["healthcheck"] && !supports["info"] && !supports["status"] && !supports["tls"] {
+		return &struct {
+			router.Router
+			router.OptsRouter
+			router.OptsSchemaRouter
+			router.MultiBatchRouter
+			router.CNameRouter
+		}{
+			base,
+			base,
+			base,
+			apiRouterWithBatchInst,
+			apiRouterWithCnameSupportInst,
+		}
+	}
+	if supports["access-control"] && supports["batch"] && supports["cname"] && !supports["healthcheck"] && !supports["info"] && !supports["status"] && !supports["tls"] {
+		return &struct {
+			router.Router
+			router.OptsRouter
+			router.OptsSchemaRouter
+			router.AccessControlRouter
+			router.MultiBatchRouter
+			router.CNameRouter
+		}{
+			base,
+			base,
+			base,
+			apiRouterWithAccessControlInst,
+			apiRouterWithBatchInst,
+			apiRouterWithCnameSupportInst,
+		}
+	}
+	if !supports["access-control"] && !supports["batch"] && !supports["cname"] && supports["healthcheck"] && !supports["info"] && !supports["status"] && !supports["tls"] {
+		return &struct {
+			router.Router
+			router.OptsRouter
+			router.OptsSchemaRouter
+			router.CustomHealthcheckRouter
+		}{
+			base,
+			base,
+			base,
+			apiRouterWithHealthcheckSupportInst,
+		}
+	}
+	if supports["access-control"] && !supports["batch"] && !supports["cname"] && supports["healthcheck"] && !supports["info"] && !supports["status"] && !supports["tls"] {
+		return &struct {
+			router.Router
+			router.OptsRouter
+			router.OptsSchemaRouter
+			router.AccessControlRouter
+			router.CustomHealthcheckRouter
+		}{
+			base,
+			base,
+			base,
+			apiRouterWithAccessControlInst,
+			apiRouterWithHealthcheckSupportInst,
+		}
+	}
+	if !supports["access-control"] && supports["batch"] && !supports["cname"] && supports["healthcheck"] && !supports["info"] && !supports["status"] && !supports["tls"] {
+		return &struct {
+			router.Router
+			router.OptsRouter
+			router.OptsSchemaRouter
+			router.MultiBatchRouter
+			router.CustomHealthcheckRouter
+		}{
+			base,
+			base,
+			base,
+			apiRouterWithBatchInst,
+			apiRouterWithHealthcheckSupportInst,
+		}
+	}
+	if supports["access-control"] && supports["batch"] && !supports["cname"] && supports["healthcheck"] && !supports["info"] && !supports["status"] && !supports["tls"] {
+		return &struct {
+			router.Router
+			router.OptsRouter
+			router.OptsSchemaRouter
+			router.AccessControlRouter
+			router.MultiBatchRouter
+			router.CustomHealthcheckRouter
+		}{
+			base,
+			base,
+			base,
+			apiRouterWithAccessControlInst,
+			apiRouterWithBatchInst,
+			apiRouterWithHealthcheckSupportInst,
+		}
+	}
+	if !supports["access-control"] && !supports["batch"] && supports["cname"] && supports["healthcheck"] && !supports["info"] && !supports["status"] && !supports["tls"] {
+		return &struct {
+			router.Router
+			router.OptsRouter
+			router.OptsSchemaRouter
+			router.CNameRouter
+			router.CustomHealthcheckRouter
+		}{
+			base,
+			base,
+			base,
+			apiRouterWithCnameSupportInst,
+			apiRouterWithHealthcheckSupportInst,
+		}
+	}
+	if supports["access-control"] && !supports["batch"] && supports["cname"] && supports["healthcheck"] && !supports["info"] && !supports["status"] && !supports["tls"] {
+		return &struct {
+			router.Router
+			router.OptsRouter
+			router.OptsSchemaRouter
+			router.AccessControlRouter
+			router.CNameRouter
+			router.CustomHealthcheckRouter
+		}{
+			base,
+			base,
+			base,
+			apiRouterWithAccessControlInst,
+			apiRouterWithCnameSupportInst,
+			apiRouterWithHealthcheckSupportInst,
+		}
+	}
+	if !supports["access-control"] && supports["batch"] && supports["cname"] && supports["healthcheck"] && !supports["info"] && !supports["status"] && !supports["tls"] {
+		return &struct {
+			router.Router
+			router.OptsRouter
+			router.OptsSchemaRouter
+			router.MultiBatchRouter
+			router.CNameRouter
+			router.CustomHealthcheckRouter
+		}{
+			base,
+			base,
+			base,
+			apiRouterWithBatchInst,
+			apiRouterWithCnameSupportInst,
+			apiRouterWithHealthcheckSupportInst,
+		}
+	}
+	if supports["access-control"] && supports["batch"] && supports["cname"] && supports["healthcheck"] && !supports["info"] && !supports["status"] && !supports["tls"] {
+		return &struct {
+			router.Router
+			router.OptsRouter
+			router.OptsSchemaRouter
+			router.AccessControlRouter
+			router.MultiBatchRouter
+			router.CNameRouter
+			router.CustomHealthcheckRouter
+		}{
+			base,
+			base,
+			base,
+			apiRouterWithAccessControlInst,
+			apiRouterWithBatchInst,
+			apiRouterWithCnameSupportInst,
+			apiRouterWithHealthcheckSupportInst,
+		}
+	}
+	if !supports["access-control"] && !supports["batch"] && !supports["cname"] && !supports["healthcheck"] && supports["info"] && !supports["status"] && !supports["tls"] {
+		return &struct {
+			router.Router
+			router.OptsRouter
+			router.OptsSchemaRouter
+			router.InfoRouter
+		}{
+			base,
+			base,
+			base,
+			apiRouterWithInfoInst,
+		}
+	}
+	if supports["access-control"] && !supports["batch"] && !supports["cname"] && !supports["healthcheck"] && supports["info"] && !supports["status"] && !supports["tls"] {
+		return &struct {
+			router.Router
+			router.OptsRouter
+			router.OptsSchemaRouter
+			router.AccessControlRouter
+			router.InfoRouter
+		}{
+			base,
+			base,
+			base,
+			apiRouterWithAccessControlInst,
+			apiRouterWithInfoInst,
+		}
+	}
+	if !supports["access-control"] && supports["batch"] && !supports["cname"] && !supports["healthcheck"] && supports["info"] && !supports["status"] && !supports["tls"] {
+		return &struct {
+			router.Router
+			router.OptsRouter
+			router.OptsSchemaRouter
+			router.MultiBatchRouter
+			router.InfoRouter
+		}{
+			base,
+			base,
+			base,
+			apiRouterWithBatchInst,
+			apiRouterWithInfoInst,
+		}
+	}
+	if supports["access-control"] && supports["batch"] && !supports["cname"] && !supports["healthcheck"] && supports["info"] && !supports["status"] && !supports["tls"] {
+		return &struct {
+			router.Router
+			router.OptsRouter
+			router.OptsSchemaRouter
+			router.AccessControlRouter
+			router.MultiBatchRouter
+			router.InfoRouter
+		}{
+			base,
+			base,
+			base,
+			apiRouterWithAccessControlInst,
+			apiRouterWithBatchInst,
+			apiRouterWithInfoInst,
+		}
+	}
+	if !supports["access-control"] && !supports["batch"] && supports["cname"] && !supports["healthcheck"] && supports["info"] && !supports["status"] && !supports["tls"] {
+		return &struct {
+			router.Router
+			router.OptsRouter
+			router.OptsSchemaRouter
+			router.CNameRouter
+			router.InfoRouter
+		}{
+			base,
+			base,
+			base,
+			apiRouterWithCnameSupportInst,
+			apiRouterWithInfoInst,
+		}
+	}
+	if supports["access-control"] && !supports["batch"] && supports["cname"] && !supports["healthcheck"] && supports["info"] && !supports["status"] && !supports["tls"] {
+		return &struct {
+			router.Router
+			router.OptsRouter
+			router.OptsSchemaRouter
+			router.AccessControlRouter
+			router.CNameRouter
+			router.InfoRouter
+		}{
+			base,
+			base,
+			base,
+			apiRouterWithAccessControlInst,
+			apiRouterWithCnameSupportInst,
+			apiRouterWithInfoInst,
+		}
+	}
+	if !supports["access-control"] && supports["batch"] && supports["cname"] && !supports["healthcheck"] && supports["info"] && !supports["status"] && !supports["tls"] {
+		return &struct {
+			router.Router
+			router.OptsRouter
+			router.OptsSchemaRouter
+			router.MultiBatchRouter
+			router.CNameRouter
+			router.InfoRouter
+		}{
+			base,
+			base,
+			base,
+			apiRouterWithBatchInst,
+			apiRouterWithCnameSupportInst,
+			apiRouterWithInfoInst,
+		}
+	}
+	if supports["access-control"] && supports["batch"] && supports["cname"] && !supports["healthcheck"] && supports["info"] && !supports["status"] && !supports["tls"] {
+		return &struct {
+			router.Router
+			router.OptsRouter
+			router.OptsSchemaRouter
+			router.AccessControlRouter
+			router.MultiBatchRouter
+			router.CNameRouter
+			router.InfoRouter
+		}{
+			base,
+			base,
+			base,
+			apiRouterWithAccessControlInst,
+			apiRouterWithBatchInst,
+			apiRouterWithCnameSupportInst,
+			apiRouterWithInfoInst,
+		}
+	}
+	if !supports["access-control"] && !supports["batch"] && !supports["cname"] && supports["healthcheck"] && supports["info"] && !supports["status"] && !supports["tls"] {
+		return &struct {
+			router.Router
+			router.OptsRouter
+			router.OptsSchemaRouter
+			router.CustomHealthcheckRouter
+			router.InfoRouter
+		}{
+			base,
+			base,
+			base,
+			apiRouterWithHealthcheckSupportInst,
+			apiRouterWithInfoInst,
+		}
+	}
+	if supports["access-control"] && !supports["batch"] && !supports["cname"] && supports["healthcheck"] && supports["info"] && !supports["status"] && !supports["tls"] {
+		return &struct {
+			router.Router
+			router.OptsRouter
+			router.OptsSchemaRouter
+			router.AccessControlRouter
+			router.CustomHealthcheckRouter
+			router.InfoRouter
+		}{
+			base,
+			base,
+			base,
+			apiRouterWithAccessControlInst,
+			apiRouterWithHealthcheckSupportInst,
+			apiRouterWithInfoInst,
+		}
+	}
+	if !supports["access-control"] && supports["batch"] && !supports["cname"] && supports["healthcheck"] && supports["info"] && !supports["status"] && !supports["tls"] {
+		return &struct {
+			router.Router
+			router.OptsRouter
+			router.OptsSchemaRouter
+			router.MultiBatchRouter
+			router.CustomHealthcheckRouter
+			router.InfoRouter
+		}{
+			base,
+			base,
+			base,
+			apiRouterWithBatchInst,
+			apiRouterWithHealthcheckSupportInst,
+			apiRouterWithInfoInst,
+		}
+	}
+	if supports["access-control"] && supports["batch"] && !supports["cname"] && supports["healthcheck"] && supports["info"] && !supports["status"] && !supports["tls"] {
+		return &struct {
+			router.Router
+			router.OptsRouter
+			router.OptsSchemaRouter
+			router.AccessControlRouter
+			router.MultiBatchRouter
+			router.CustomHealthcheckRouter
+			router.InfoRouter
+		}{
+			base,
+			base,
+			base,
+			apiRouterWithAccessControlInst,
+			apiRouterWithBatchInst,
+			apiRouterWithHealthcheckSupportInst,
+			apiRouterWithInfoInst,
+		}
+	}
+	if !supports["access-control"] && !supports["batch"] && supports["cname"] && supports["healthcheck"] && supports["info"] && !supports["status"] && !supports["tls"] {
+		return &struct {
+			router.Router
+			router.OptsRouter
+			router.OptsSchemaRouter
+			router.CNameRouter
+			router.CustomHealthcheckRouter
+			router.InfoRouter
+		}{
+			base,
+			base,
+			base,
+			apiRouterWithCnameSupportInst,
+			apiRouterWithHealthcheckSupportInst,
+			apiRouterWithInfoInst,
+		}
+	}
+	if supports["access-control"] && !supports["batch"] && supports["cname"] && supports["healthcheck"] && supports["info"] && !supports["status"] && !supports["tls"] {
+		return &struct {
+			router.Router
+			router.OptsRouter
+			router.OptsSchemaRouter
+			router.AccessControlRouter
+			router.CNameRouter
+			router.CustomHealthcheckRouter
+			router.InfoRouter
+		}{
+			base,
+			base,
+			base,
+			apiRouterWithAccessControlInst,
+			apiRouterWithCnameSupportInst,
+			apiRouterWithHealthcheckSupportInst,
+			apiRouterWithInfoInst,
+		}
+	}
+	if !supports["access-control"] && supports["batch"] && supports["cname"] && supports["healthcheck"] && supports["info"] && !supports["status"] && !supports["tls"] {
+		return &struct {
+			router.Router
+			router.OptsRouter
+			router.OptsSchemaRouter
+			router.MultiBatchRouter
+			router.CNameRouter
+			router.CustomHealthcheckRouter
+			router.InfoRouter
+		}{
+			base,
+			base,
+			base,
+			apiRouterWithBatchInst,
+			apiRouterWithCnameSupportInst,
+			apiRouterWithHealthcheckSupportInst,
+			apiRouterWithInfoInst,
+		}
+	}
+	if supports["access-control"] && supports["batch"] && supports["cname"] && supports["healthcheck"] && supports["info"] && !supports["status"] && !supports["tls"] {
+		return &struct {
+			router.Router
+			router.OptsRouter
+			router.OptsSchemaRouter
+			router.AccessControlRouter
+			router.MultiBatchRouter
+			router.CNameRouter
+			router.CustomHealthcheckRouter
+			router.InfoRouter
+		}{
+			base,
+			base,
+			base,
+			apiRouterWithAccessControlInst,
+			apiRouterWithBatchInst,
+			apiRouterWithCnameSupportInst,
+			apiRouterWithHealthcheckSupportInst,
+			apiRouterWithInfoInst,
+		}
+	}
+	if !supports["access-control"] && !supports["batch"] && !supports["cname"] && !supports["healthcheck"] && !supports["info"] && supports["status"] && !supports["tls"] {
+		return &struct {
+			router.Router
+			router.OptsRouter
+			router.OptsSchemaRouter
+			router.StatusRouter
+		}{
+			base,
+			base,
+			base,
+			apiRouterWithStatusInst,
+		}
+	}
+	if supports["access-control"] && !supports["batch"] && !supports["cname"] && !supports["healthcheck"] && !supports["info"] && supports["status"] && !supports["tls"] {
+		return &struct {
+			router.Router
+			router.OptsRouter
+			router.OptsSchemaRouter
+			router.AccessControlRouter
+			router.StatusRouter
+		}{
+			base,
+			base,
+			base,
+			apiRouterWithAccessControlInst,
+			apiRouterWithStatusInst,
+		}
+	}
+	if !supports["access-control"] && supports["batch"] && !supports["cname"] && !supports["healthcheck"] && !supports["info"] && supports["status"] && !supports["tls"] {
+		return &struct {
+			router.Router
+			router.OptsRouter
+			router.OptsSchemaRouter
+			router.MultiBatchRouter
+			router.StatusRouter
+		}{
+			base,
+			base,
+			base,
+			apiRouterWithBatchInst,
+			apiRouterWithStatusInst,
+		}
+	}
+	if supports["access-control"] && supports["batch"] && !supports["cname"] && !supports["healthcheck"] && !supports["info"] && supports["status"] && !supports["tls"] {
+		return &struct {
+			router.Router
+			router.OptsRouter
+			router.OptsSchemaRouter
+			router.AccessControlRouter
+			router.MultiBatchRouter
+			router.StatusRouter
+		}{
+			base,
+			base,
+			base,
+			apiRouterWithAccessControlInst,
+			apiRouterWithBatchInst,
+			apiRouterWithStatusInst,
+		}
+	}
+	if !supports["access-control"] && !supports["batch"] && supports["cname"] && !supports["healthcheck"] && !supports["info"] && supports["status"] && !supports["tls"] {
+		return &struct {
+			router.Router
+			router.OptsRouter
+			router.OptsSchemaRouter
+			router.CNameRouter
+			router.StatusRouter
+		}{
+			base,
+			base,
+			base,
+			apiRouterWithCnameSupportInst,
+			apiRouterWithStatusInst,
+		}
+	}
+	if supports["access-control"] && !supports["batch"] && supports["cname"] && !supports["healthcheck"] && !supports["info"] && supports["status"] && !supports["tls"] {
+		return &struct {
+			router.Router
+			router.OptsRouter
+			router.OptsSchemaRouter
+			router.AccessControlRouter
+			router.CNameRouter
+			router.StatusRouter
+		}{
+			base,
+			base,
+			base,
+			apiRouterWithAccessControlInst,
+			apiRouterWithCnameSupportInst,
+			apiRouterWithStatusInst,
+		}
+	}
+	if !supports["access-control"] && supports["batch"] && supports["cname"] && !supports["healthcheck"] && !supports["info"] && supports["status"] && !supports["tls"] {
+		return &struct {
+			router.Router
+			router.OptsRouter
+			router.OptsSchemaRouter
+			router.MultiBatchRouter
+			router.CNameRouter
+			router.StatusRouter
+		}{
+			base,
+			base,
+			base,
+			apiRouterWithBatchInst,
+			apiRouterWithCnameSupportInst,
+			apiRouterWithStatusInst,
+		}
+	}
+	if supports["access-control"] && supports["batch"] && supports["cname"] && !supports["healthcheck"] && !supports["info"] && supports["status"] && !supports["tls"] {
+		return &struct {
+			router.Router
+			router.OptsRouter
+			router.OptsSchemaRouter
+			router.AccessControlRouter
+			router.MultiBatchRouter
+			router.CNameRouter
+			router.StatusRouter
+		}{
+			base,
+			base,
+			base,
+			apiRouterWithAccessControlInst,
+			apiRouterWithBatchInst,
+			apiRouterWithCnameSupportInst,
+			apiRouterWithStatusInst,
+		}
+	}
+	if !supports["access-control"] && !supports["batch"] && !supports["cname"] && supports["healthcheck"] && !supports["info"] && supports["status"] && !supports["tls"] {
+		return &struct {
+			router.Router
+			router.OptsRouter
+			router.OptsSchemaRouter
+			router.CustomHealthcheckRouter
+			router.StatusRouter
+		}{
+			base,
+			base,
+			base,
+			apiRouterWithHealthcheckSupportInst,
+			apiRouterWithStatusInst,
+		}
+	}
+	if supports["access-control"] && !supports["batch"] && !supports["cname"] && supports["healthcheck"] && !supports["info"] && supports["status"] && !supports["tls"] {
+		return &struct {
+			router.Router
+			router.OptsRouter
+			router.OptsSchemaRouter
+			router.AccessControlRouter
+			router.CustomHealthcheckRouter
+			router.StatusRouter
+		}{
+			base,
+			base,
+			base,
+			apiRouterWithAccessControlInst,
+			apiRouterWithHealthcheckSupportInst,
+			apiRouterWithStatusInst,
+		}
+	}
+	if !supports["access-control"] && supports["batch"] && !supports["cname"] && supports["healthcheck"] && !supports["info"] && supports["status"] && !supports["tls"] {
+		return &struct {
+			router.Router
+			router.OptsRouter
+			router.OptsSchemaRouter
+			router.MultiBatchRouter
+			router.CustomHealthcheckRouter
+			router.StatusRouter
+		}{
+			base,
+			base,
+			base,
+			apiRouterWithBatchInst,
+			apiRouterWithHealthcheckSupportInst,
+			apiRouterWithStatusInst,
+		}
+	}
+	if supports["access-control"] && supports["batch"] && !supports["cname"] && supports["healthcheck"] && !supports["info"] && supports["status"] && !supports["tls"] {
+		return &struct {
+			router.Router
+			router.OptsRouter
+			router.OptsSchemaRouter
+			router.AccessControlRouter
+			router.MultiBatchRouter
+			router.CustomHealthcheckRouter
+			router.StatusRouter
+		}{
+			base,
+			base,
+			base,
+			apiRouterWithAccessControlInst,
+			apiRouterWithBatchInst,
+			apiRouterWithHealthcheckSupportInst,
+			apiRouterWithStatusInst,
+		}
+	}
+	if !supports["access-control"] && !supports["batch"] && supports["cname"] && supports["healthcheck"] && !supports["info"] && supports["status"] && !supports["tls"] {
+		return &struct {
+			router.Router
+			router.OptsRouter
+			router.OptsSchemaRouter
+			router.CNameRouter
+			router.CustomHealthcheckRouter
+			router.StatusRouter
+		}{
+			base,
+			base,
+			base,
+			apiRouterWithCnameSupportInst,
+			apiRouterWithHealthcheckSupportInst,
+			apiRouterWithStatusInst,
+		}
+	}
+	if supports["access-control"] && !supports["batch"] && supports["cname"] && supports["healthcheck"] && !supports["info"] && supports["status"] && !supports["tls"] {
+		return &struct {
+			router.Router
+			router.OptsRouter
+			router.OptsSchemaRouter
+			router.AccessControlRouter
+			router.CNameRouter
+			router.CustomHealthcheckRouter
+			router.StatusRouter
+		}{
+			base,
+			base,
+			base,
+			apiRouterWithAccessControlInst,
+			apiRouterWithCnameSupportInst,
+			apiRouterWithHealthcheckSupportInst,
+			apiRouterWithStatusInst,
+		}
+	}
+	if !supports["access-control"] && supports["batch"] && supports["cname"] && supports["healthcheck"] && !supports["info"] && supports["status"] && !supports["tls"] {
+		return &struct {
+			router.Router
+			router.OptsRouter
+			router.OptsSchemaRouter
+			router.MultiBatchRouter
+			router.CNameRouter
+			router.CustomHealthcheckRouter
+			router.StatusRouter
+		}{
+			base,
+			base,
+			base,
+			apiRouterWithBatchInst,
+			apiRouterWithCnameSupportInst,
+			apiRouterWithHealthcheckSupportInst,
+			apiRouterWithStatusInst,
+		}
+	}
+	if supports["access-control"] && supports["batch"] && supports["cname"] && supports["healthcheck"] && !supports["info"] && supports["status"] && !supports["tls"] {
+		return &struct {
+			router.Router
+			router.OptsRouter
+			router.OptsSchemaRouter
+			router.AccessControlRouter
+			router.MultiBatchRouter
+			router.CNameRouter
+			router.CustomHealthcheckRouter
+			router.StatusRouter
+		}{
+			base,
+			base,
+			base,
+			apiRouterWithAccessControlInst,
+			apiRouterWithBatchInst,
+			apiRouterWithCnameSupportInst,
+			apiRouterWithHealthcheckSupportInst,
+			apiRouterWithStatusInst,
+		}
+	}
+	if !supports["access-control"] && !supports["batch"] && !supports["cname"] && !supports["healthcheck"] && supports["info"] && supports["status"] && !supports["tls"] {
+		return &struct {
+			router.Router
+			router.OptsRouter
+			router.OptsSchemaRouter
+			router.InfoRouter
+			router.StatusRouter
+		}{
+			base,
+			base,
+			base,
+			apiRouterWithInfoInst,
+			apiRouterWithStatusInst,
+		}
+	}
+	if supports["access-control"] && !supports["batch"] && !supports["cname"] && !supports["healthcheck"] && supports["info"] && supports["status"] && !supports["tls"] {
+		return &struct {
+			router.Router
+			router.OptsRouter
+			router.OptsSchemaRouter
+			router.AccessControlRouter
+			router.InfoRouter
+			router.StatusRouter
+		}{
+			base,
+			base,
+			base,
+			apiRouterWithAccessControlInst,
+			apiRouterWithInfoInst,
+			apiRouterWithStatusInst,
+		}
+	}
+	if !supports["access-control"] && supports["batch"] && !supports["cname"] && !supports["healthcheck"] && supports["info"] && supports["status"] && !supports["tls"] {
+		return &struct {
+			router.Router
+			router.OptsRouter
+			router.OptsSchemaRouter
+			router.MultiBatchRouter
+			router.InfoRouter
+			router.StatusRouter
+		}{
+			base,
+			base,
+			base,
+			apiRouterWithBatchInst,
+			apiRouterWithInfoInst,
+			apiRouterWithStatusInst,
+		}
+	}
+	if supports["access-control"] && supports["batch"] && !supports["cname"] && !supports["healthcheck"] && supports["info"] && supports["status"] && !supports["tls"] {
+		return &struct {
+			router.Router
+			router.OptsRouter
+			router.OptsSchemaRouter
+			router.AccessControlRouter
+			router.MultiBatchRouter
+			router.InfoRouter
+			router.StatusRouter
+		}{
+			base,
+			base,
+			base,
+			apiRouterWithAccessControlInst,
+			apiRouterWithBatchInst,
+			apiRouterWithInfoInst,
+			apiRouterWithStatusInst,
+		}
+	}
+	if !supports["access-control"] && !supports["batch"] && supports["cname"] && !supports["healthcheck"] && supports["info"] && supports["status"] && !supports["tls"] {
+		return &struct {
+			router.Router
+			router.OptsRouter
+			router.OptsSchemaRouter
+			router.CNameRouter
+			router.InfoRouter
+			router.StatusRouter
+		}{
+			base,
+			base,
+			base,
+			apiRouterWithCnameSupportInst,
+			apiRouterWithInfoInst,
+			apiRouterWithStatusInst,
+		}
+	}
+	if supports["access-control"] && !supports["batch"] && supports["cname"] && !supports["healthcheck"] && supports["info"] && supports["status"] && !supports["tls"] {
+		return &struct {
+			router.Router
+			router.OptsRouter
+			router.OptsSchemaRouter
+			router.AccessControlRouter
+			router.CNameRouter
+			router.InfoRouter
+			router.StatusRouter
+		}{
+			base,
+			base,
+			base,
+			apiRouterWithAccessControlInst,
+			apiRouterWithCnameSupportInst,
+			apiRouterWithInfoInst,
+			apiRouterWithStatusInst,
+		}
+	}
+	if !supports["access-control"] && supports["batch"] && supports["cname"] && !supports["healthcheck"] && supports["info"] && supports["status"] && !supports["tls"] {
+		return &struct {
+			router.Router
+			router.OptsRouter
+			router.OptsSchemaRouter
+			router.MultiBatchRouter
+			router.CNameRouter
+			router.InfoRouter
+			router.StatusRouter
+		}{
+			base,
+			base,
+			base,
+			apiRouterWithBatchInst,
+			apiRouterWithCnameSupportInst,
+			apiRouterWithInfoInst,
+			apiRouterWithStatusInst,
+		}
+	}
+	if supports["access-control"] && supports["batch"] && supports["cname"] && !supports["healthcheck"] && supports["info"] && supports["status"] && !supports["tls"] {
+		return &struct {
+			router.Router
+			router.OptsRouter
+			router.OptsSchemaRouter
+			router.AccessControlRouter
+			router.MultiBatchRouter
+			router.CNameRouter
+			router.InfoRouter
+			router.StatusRouter
+		}{
+			base,
+			base,
+			base,
+			apiRouterWithAccessControlInst,
+			apiRouterWithBatchInst,
+			apiRouterWithCnameSupportInst,
+			apiRouterWithInfoInst,
+			apiRouterWithStatusInst,
+		}
+	}
+	if !supports["access-control"] && !supports["batch"] && !supports["cname"] && supports["healthcheck"] && supports["info"] && supports["status"] && !supports["tls"] {
+		return &struct {
+			router.Router
+			router.OptsRouter
+			router.OptsSchemaRouter
+			router.CustomHealthcheckRouter
+			router.InfoRouter
+			router.StatusRouter
+		}{
+			base,
+			base,
+			base,
+			apiRouterWithHealthcheckSupportInst,
+			apiRouterWithInfoInst,
+			apiRouterWithStatusInst,
+		}
+	}
+	if supports["access-control"] && !supports["batch"] && !supports["cname"] && supports["healthcheck"] && supports["info"] && supports["status"] && !supports["tls"] {
+		return &struct {
+			router.Router
+			router.OptsRouter
+			router.OptsSchemaRouter
+			router.AccessControlRouter
+			router.CustomHealthcheckRouter
+			router.InfoRouter
+			router.StatusRouter
+		}{
+			base,
+			base,
+			base,
+			apiRouterWithAccessControlInst,
+			apiRouterWithHealthcheckSupportInst,
+			apiRouterWithInfoInst,
+			apiRouterWithStatusInst,
+		}
+	}
+	if !supports["access-control"] && supports["batch"] && !supports["cname"] && supports["healthcheck"] && supports["info"] && supports["status"] && !supports["tls"] {
+		return &struct {
+			router.Router
+			router.OptsRouter
+			router.OptsSchemaRouter
+			router.MultiBatchRouter
+			router.CustomHealthcheckRouter
+			router.InfoRouter
+			router.StatusRouter
+		}{
+			base,
+			base,
+			base,
+			apiRouterWithBatchInst,
+			apiRouterWithHealthcheckSupportInst,
+			apiRouterWithInfoInst,
+			apiRouterWithStatusInst,
+		}
+	}
+	if supports["access-control"] && supports["batch"] && !supports["cname"] && supports["healthcheck"] && supports["info"] && supports["status"] && !supports["tls"] {
+		return &struct {
+			router.Router
+			router.OptsRouter
+			router.OptsSchemaRouter
+			router.AccessControlRouter
+			router.MultiBatchRouter
+			router.CustomHealthcheckRouter
+			router.InfoRouter
+			router.StatusRouter
+		}{
+			base,
+			base,
+			base,
+			apiRouterWithAccessControlInst,
+			apiRouterWithBatchInst,
+			apiRouterWithHealthcheckSupportInst,
+			apiRouterWithInfoInst,
+			apiRouterWithStatusInst,
+		}
+	}
+	if !supports["access-control"] && !supports["batch"] && supports["cname"] && supports["healthcheck"] && supports["info"] && supports["status"] && !supports["tls"] {
+		return &struct {
+			router.Router
+			router.OptsRouter
+			router.OptsSchemaRouter
+			router.CNameRouter
+			router.CustomHealthcheckRouter
+			router.InfoRouter
+			router.StatusRouter
+		}{
+			base,
+			base,
+			base,
+			apiRouterWithCnameSupportInst,
+			apiRouterWithHealthcheckSupportInst,
+			apiRouterWithInfoInst,
+			apiRouterWithStatusInst,
+		}
+	}
+	if supports["access-control"] && !supports["batch"] && supports["cname"] && supports["healthcheck"] && supports["info"] && supports["status"] && !supports["tls"] {
+		return &struct {
+			router.Router
+			router.OptsRouter
+			router.OptsSchemaRouter
+			router.AccessControlRouter
+			router.CNameRouter
+			router.CustomHealthcheckRouter
+			router.InfoRouter
+			router.StatusRouter
+		}{
+			base,
+			base,
+			base,
+			apiRouterWithAccessControlInst,
+			apiRouterWithCnameSupportInst,
+			apiRouterWithHealthcheckSupportInst,
+			apiRouterWithInfoInst,
+			apiRouterWithStatusInst,
+		}
+	}
+	if !supports["access-control"] && supports["batch"] && supports["cname"] && supports["healthcheck"] && supports["info"] && supports["status"] && !supports["tls"] {
+		return &struct {
+			router.Router
+			router.OptsRouter
+			router.OptsSchemaRouter
+			router.MultiBatchRouter
+			router.CNameRouter
+			router.CustomHealthcheckRouter
+			router.InfoRouter
+			router.StatusRouter
+		}{
+			base,
+			base,
+			base,
+			apiRouterWithBatchInst,
+			apiRouterWithCnameSupportInst,
+			apiRouterWithHealthcheckSupportInst,
+			apiRouterWithInfoInst,
+			apiRouterWithStatusInst,
+		}
+	}
+	if supports["access-control"] && supports["batch"] && supports["cname"] && supports["healthcheck"] && supports["info"] && supports["status"] && !supports["tls"] {
+		return &struct {
+			router.Router
+			router.OptsRouter
+			router.OptsSchemaRouter
+			router.AccessControlRouter
+			router.MultiBatchRouter
+			router.CNameRouter
+			router.CustomHealthcheckRouter
+			router.InfoRouter
+			router.StatusRouter
+		}{
+			base,
+			base,
+			base,
+			apiRouterWithAccessControlInst,
+			apiRouterWithBatchInst,
+			apiRouterWithCnameSupportInst,
+			apiRouterWithHealthcheckSupportInst,
+			apiRouterWithInfoInst,
+			apiRouterWithStatusInst,
+		}
+	}
+	if !supports["access-control"] && !supports["batch"] && !supports["cname"] && !supports["healthcheck"] && !supports["info"] && !supports["status"] && supports["tls"] {
+		return &struct {
+			router.Router
+			router.OptsRouter
+			router.OptsSchemaRouter
+			router.TLSRouter
+		}{
+			base,
+			base,
+			base,
+			apiRouterWithTLSSupportInst,
+		}
+	}
+	if supports["access-control"] && !supports["batch"] && !supports["cname"] && !supports["healthcheck"] && !supports["info"] && !supports["status"] && supports["tls"] {
+		return &struct {
+			router.Router
+			router.OptsRouter
+			router.OptsSchemaRouter
+			router.AccessControlRouter
+			router.TLSRouter
+		}{
+			base,
+			base,
+			base,
+			apiRouterWithAccessControlInst,
+			apiRouterWithTLSSupportInst,
+		}
+	}
+	if !supports["access-control"] && supports["batch"] && !supports["cname"] && !supports["healthcheck"] && !supports["info"] && !supports["status"] && supports["tls"] {
+		return &struct {
+			router.Router
+			router.OptsRouter
+			router.OptsSchemaRouter
+			router.MultiBatchRouter
+			router.TLSRouter
+		}{
+			base,
+			base,
+			base,
+			apiRouterWithBatchInst,
+			apiRouterWithTLSSupportInst,
+		}
+	}
+	if supports["access-control"] && supports["batch"] && !supports["cname"] && !supports["healthcheck"] && !supports["info"] && !supports["status"] && supports["tls"] {
+		return &struct {
+			router.Router
+			router.OptsRouter
+			router.OptsSchemaRouter
+			router.AccessControlRouter
+			router.MultiBatchRouter
+			router.TLSRouter
+		}{
+			base,
+			base,
+			base,
+			apiRouterWithAccessControlInst,
+			apiRouterWithBatchInst,
+			apiRouterWithTLSSupportInst,
+		}
+	}
+	if !supports["access-control"] && !supports["batch"] && supports["cname"] && !supports["healthcheck"] && !supports["info"] && !supports["status"] && supports["tls"] {
+		return &struct {
+			router.Router
+			router.OptsRouter
+			router.OptsSchemaRouter
+			router.CNameRouter
+			router.TLSRouter
+		}{
+			base,
+			base,
+			base,
+			apiRouterWithCnameSupportInst,
+			apiRouterWithTLSSupportInst,
+		}
+	}
+	if supports["access-control"] && !supports["batch"] && supports["cname"] && !supports["healthcheck"] && !supports["info"] && !supports["status"] && supports["tls"] {
+		return &struct {
+			router.Router
+			router.OptsRouter
+			router.OptsSchemaRouter
+			router.AccessControlRouter
+			router.CNameRouter
+			router.TLSRouter
+		}{
+			base,
+			base,
+			base,
+			apiRouterWithAccessControlInst,
+			apiRouterWithCnameSupportInst,
+			apiRouterWithTLSSupportInst,
+		}
+	}
+	if !supports["access-control"] && supports["batch"] && supports["cname"] && !supports["healthcheck"] && !supports["info"] && !supports["status"] && supports["tls"] {
+		return &struct {
+			router.Router
+			router.OptsRouter
+			router.OptsSchemaRouter
+			router.MultiBatchRouter
+			router.CNameRouter
+			router.TLSRouter
+		}{
+			base,
+			base,
+			base,
+			apiRouterWithBatchInst,
+			apiRouterWithCnameSupportInst,
+			apiRouterWithTLSSupportInst,
+		}
+	}
+	if supports["access-control"] && supports["batch"] && supports["cname"] && !supports["healthcheck"] && !supports["info"] && !supports["status"] && supports["tls"] {
+		return &struct {
+			router.Router
+			router.OptsRouter
+			router.OptsSchemaRouter
+			router.AccessControlRouter
+			router.MultiBatchRouter
+			router.CNameRouter
+			router.TLSRouter
+		}{
+			base,
+			base,
+			base,
+			apiRouterWithAccessControlInst,
+			apiRouterWithBatchInst,
+			apiRouterWithCnameSupportInst,
+			apiRouterWithTLSSupportInst,
+		}
+	}
+	if !supports["access-control"] && !supports["batch"] && !supports["cname"] && supports["healthcheck"] && !supports["info"] && !supports["status"] && supports["tls"] {
+		return &struct {
+			router.Router
+			router.OptsRouter
+			router.OptsSchemaRouter
+			router.CustomHealthcheckRouter
+			router.TLSRouter
+		}{
+			base,
+			base,
+			base,
+			apiRouterWithHealthcheckSupportInst,
+			apiRouterWithTLSSupportInst,
+		}
+	}
+	if supports["access-control"] && !supports["batch"] && !supports["cname"] && supports["healthcheck"] && !supports["info"] && !supports["status"] && supports["tls"] {
+		return &struct {
+			router.Router
+			router.OptsRouter
+			router.OptsSchemaRouter
+			router.AccessControlRouter
+			router.CustomHealthcheckRouter
+			router.TLSRouter
+		}{
+			base,
+			base,
+			base,
+			apiRouterWithAccessControlInst,
+			apiRouterWithHealthcheckSupportInst,
+			apiRouterWithTLSSupportInst,
+		}
+	}
+	if !supports["access-control"] && supports["batch"] && !supports["cname"] && supports["healthcheck"] && !supports["info"] && !supports["status"] && supports["tls"] {
+		return &struct {
+			router.Router
+			router.OptsRouter
+			router.OptsSchemaRouter
+			router.MultiBatchRouter
+			router.CustomHealthcheckRouter
+			router.TLSRouter
+		}{
+			base,
+			base,
+			base,
+			apiRouterWithBatchInst,
+			apiRouterWithHealthcheckSupportInst,
+			apiRouterWithTLSSupportInst,
+		}
+	}
+	if supports["access-control"] && supports["batch"] && !supports["cname"] && supports["healthcheck"] && !supports["info"] && !supports["status"] && supports["tls"] {
+		return &struct {
+			router.Router
+			router.OptsRouter
+			router.OptsSchemaRouter
+			router.AccessControlRouter
+			router.MultiBatchRouter
+			router.CustomHealthcheckRouter
+			router.TLSRouter
+		}{
+			base,
+			base,
+			base,
+			apiRouterWithAccessControlInst,
+			apiRouterWithBatchInst,
+			apiRouterWithHealthcheckSupportInst,
+			apiRouterWithTLSSupportInst,
+		}
+	}
+	if !supports["access-control"] && !supports["batch"] && supports["cname"] && supports["healthcheck"] && !supports["info"] && !supports["status"] && supports["tls"] {
+		return &struct {
+			router.Router
+			router.OptsRouter
+			router.OptsSchemaRouter
+			router.CNameRouter
+			router.CustomHealthcheckRouter
+			router.TLSRouter
+		}{
+			base,
+			base,
+			base,
+			apiRouterWithCnameSupportInst,
+			apiRouterWithHealthcheckSupportInst,
+			apiRouterWithTLSSupportInst,
+		}
+	}
+	if supports["access-control"] && !supports["batch"] && supports["cname"] && supports["healthcheck"] && !supports["info"] && !supports["status"] && supports["tls"] {
+		return &struct {
+			router.Router
+			router.OptsRouter
+			router.OptsSchemaRouter
+			router.AccessControlRouter
+			router.CNameRouter
+			router.CustomHealthcheckRouter
+			router.TLSRouter
+		}{
+			base,
+			base,
+			base,
+			apiRouterWithAccessControlInst,
+			apiRouterWithCnameSupportInst,
+			apiRouterWithHealthcheckSupportInst,
+			apiRouterWithTLSSupportInst,
+		}
+	}
+	if !supports["access-control"] && supports["batch"] && supports["cname"] && supports["healthcheck"] && !supports["info"] && !supports["status"] && supports["tls"] {
+		return &struct {
+			router.Router
+			router.OptsRouter
+			router.OptsSchemaRouter
+			router.MultiBatchRouter
+			router.CNameRouter
+			router.CustomHealthcheckRouter
+			router.TLSRouter
+		}{
+			base,
+			base,
+			base,
+			apiRouterWithBatchInst,
+			apiRouterWithCnameSupportInst,
+			apiRouterWithHealthcheckSupportInst,
+			apiRouterWithTLSSupportInst,
+		}
+	}
+	if supports["access-control"] && supports["batch"] && supports["cname"] && supports["healthcheck"] && !supports["info"] && !supports["status"] && supports["tls"] {
+		return &struct {
+			router.Router
+			router.OptsRouter
+			router.OptsSchemaRouter
+			router.AccessControlRouter
+			router.MultiBatchRouter
+			router.CNameRouter
+			router.CustomHealthcheckRouter
+			router.TLSRouter
+		}{
+			base,
+			base,
+			base,
+			apiRouterWithAccessControlInst,
+			apiRouterWithBatchInst,
+			apiRouterWithCnameSupportInst,
+			apiRouterWithHealthcheckSupportInst,
+			apiRouterWithTLSSupportInst,
+		}
+	}
+	if !supports["access-control"] && !supports["batch"] && !supports["cname"] && !supports["healthcheck"] && supports["info"] && !supports["status"] && supports["tls"] {
+		return &struct {
+			router.Router
+			router.OptsRouter
+			router.OptsSchemaRouter
+			router.InfoRouter
+			router.TLSRouter
+		}{
+			base,
+			base,
+			base,
+			apiRouterWithInfoInst,
+			apiRouterWithTLSSupportInst,
+		}
+	}
+	if supports["access-control"] && !supports["batch"] && !supports["cname"] && !supports["healthcheck"] && supports["info"] && !supports["status"] && supports["tls"] {
+		return &struct {
+			router.Router
+			router.OptsRouter
+			router.OptsSchemaRouter
+			router.AccessControlRouter
+			router.InfoRouter
+			router.TLSRouter
+		}{
+			base,
+			base,
+			base,
+			apiRouterWithAccessControlInst,
+			apiRouterWithInfoInst,
+			apiRouterWithTLSSupportInst,
+		}
+	}
+	if !supports["access-control"] && supports["batch"] && !supports["cname"] && !supports["healthcheck"] && supports["info"] && !supports["status"] && supports["tls"] {
+		return &struct {
+			router.Router
+			router.OptsRouter
+			router.OptsSchemaRouter
+			router.MultiBatchRouter
+			router.InfoRouter
+			router.TLSRouter
+		}{
+			base,
+			base,
+			base,
+			apiRouterWithBatchInst,
+			apiRouterWithInfoInst,
+			apiRouterWithTLSSupportInst,
+		}
+	}
+	if supports["access-control"] && supports["batch"] && !supports["cname"] && !supports["healthcheck"] && supports["info"] && !supports["status"] && supports["tls"] {
+		return &struct {
+			router.Router
+			router.OptsRouter
+			router.OptsSchemaRouter
+			router.AccessControlRouter
+			router.MultiBatchRouter
+			router.InfoRouter
+			router.TLSRouter
+		}{
+			base,
+			base,
+			base,
+			apiRouterWithAccessControlInst,
+			apiRouterWithBatchInst,
+			apiRouterWithInfoInst,
+			apiRouterWithTLSSupportInst,
+		}
+	}
+	if !supports["access-control"] && !supports["batch"] && supports["cname"] && !supports["healthcheck"] && supports["info"] && !supports["status"] && supports["tls"] {
+		return &struct {
+			router.Router
+			router.OptsRouter
+			router.OptsSchemaRouter
+			router.CNameRouter
+			router.InfoRouter
+			router.TLSRouter
+		}{
+			base,
+			base,
+			base,
+			apiRouterWithCnameSupportInst,
+			apiRouterWithInfoInst,
+			apiRouterWithTLSSupportInst,
+		}
+	}
+	if supports["access-control"] && !supports["batch"] && supports["cname"] && !supports["healthcheck"] && supports["info"] && !supports["status"] && supports["tls"] {
+		return &struct {
+			router.Router
+			router.OptsRouter
+			router.OptsSchemaRouter
+			router.AccessControlRouter
+			router.CNameRouter
+			router.InfoRouter
+			router.TLSRouter
+		}{
+			base,
+			base,
+			base,
+			apiRouterWithAccessControlInst,
+			apiRouterWithCnameSupportInst,
+			apiRouterWithInfoInst,
+			apiRouterWithTLSSupportInst,
+		}
+	}
+	if !supports["access-control"] && supports["batch"] && supports["cname"] && !supports["healthcheck"] && supports["info"] && !supports["status"] && supports["tls"] {
+		return &struct {
+			router.Router
+			router.OptsRouter
+			router.OptsSchemaRouter
+			router.MultiBatchRouter
+			router.CNameRouter
+			router.InfoRouter
+			router.TLSRouter
+		}{
+			base,
+			base,
+			base,
+			apiRouterWithBatchInst,
+			apiRouterWithCnameSupportInst,
+			apiRouterWithInfoInst,
+			apiRouterWithTLSSupportInst,
+		}
+	}
+	if supports["access-control"] && supports["batch"] && supports["cname"] && !supports["healthcheck"] && supports["info"] && !supports["status"] && supports["tls"] {
+		return &struct {
+			router.Router
+			router.OptsRouter
+			router.OptsSchemaRouter
+			router.AccessControlRouter
+			router.MultiBatchRouter
+			router.CNameRouter
+			router.InfoRouter
+			router.TLSRouter
+		}{
+			base,
+			base,
+			base,
+			apiRouterWithAccessControlInst,
+			apiRouterWithBatchInst,
+			apiRouterWithCnameSupportInst,
+			apiRouterWithInfoInst,
+			apiRouterWithTLSSupportInst,
+		}
+	}
+	if !supports["access-control"] && !supports["batch"] && !supports["cname"] && supports["healthcheck"] && supports["info"] && !supports["status"] && supports["tls"] {
+		return &struct {
+			router.Router
+			router.OptsRouter
+			router.OptsSchemaRouter
+			router.CustomHealthcheckRouter
+			router.InfoRouter
+			router.TLSRouter
+		}{
+			base,
+			base,
+			base,
+			apiRouterWithHealthcheckSupportInst,
+			apiRouterWithInfoInst,
+			apiRouterWithTLSSupportInst,
+		}
+	}
+	if supports["access-control"] && !supports["batch"] && !supports["cname"] && supports["healthcheck"] && supports["info"] && !supports["status"] && supports["tls"] {
+		return &struct {
+			router.Router
+			router.OptsRouter
+			router.OptsSchemaRouter
+			router.AccessControlRouter
+			router.CustomHealthcheckRouter
+			router.InfoRouter
+			router.TLSRouter
+		}{
+			base,
+			base,
+			base,
+			apiRouterWithAccessControlInst,
+			apiRouterWithHealthcheckSupportInst,
+			apiRouterWithInfoInst,
+			apiRouterWithTLSSupportInst,
+		}
+	}
+	if !supports["access-control"] && supports["batch"] && !supports["cname"] && supports["healthcheck"] && supports["info"] && !supports["status"] && supports["tls"] {
+		return &struct {
+			router.Router
+			router.OptsRouter
+			router.OptsSchemaRouter
+			router.MultiBatchRouter
+			router.CustomHealthcheckRouter
+			router.InfoRouter
+			router.TLSRouter
+		}{
+			base,
+			base,
+			base,
+			apiRouterWithBatchInst,
+			apiRouterWithHealthcheckSupportInst,
+			apiRouterWithInfoInst,
+			apiRouterWithTLSSupportInst,
+		}
+	}
+	if supports["access-control"] && supports["batch"] && !supports["cname"] && supports["healthcheck"] && supports["info"] && !supports["status"] && supports["tls"] {
+		return &struct {
+			router.Router
+			router.OptsRouter
+			router.OptsSchemaRouter
+			router.AccessControlRouter
+			router.MultiBatchRouter
+			router.CustomHealthcheckRouter
+			router.InfoRouter
+			router.TLSRouter
+		}{
+			base,
+			base,
+			base,
+			apiRouterWithAccessControlInst,
+			apiRouterWithBatchInst,
+			apiRouterWithHealthcheckSupportInst,
+			apiRouterWithInfoInst,
+			apiRouterWithTLSSupportInst,
 		}
 	}
-	if supports["cname"] && !supports["healthcheck"] && !supports["info"] && !supports["status"] && !supports["tls"] {
+	if !supports["access-control"] && !supports["batch"] && supports["cname"] && supports["healthcheck"] && supports["info"] && !supports["status"] && supports["tls"] {
 		return &struct {
 			router.Router
 			router.OptsRouter
+			router.OptsSchemaRouter
 			router.CNameRouter
+			router.CustomHealthcheckRouter
+			router.InfoRouter
+			router.TLSRouter
 		}{
+			base,
 			base,
 			base,
 			apiRouterWithCnameSupportInst,
+			apiRouterWithHealthcheckSupportInst,
+			apiRouterWithInfoInst,
+			apiRouterWithTLSSupportInst,
 		}
 	}
-	if !supports["cname"] && supports["healthcheck"] && !supports["info"] && !supports["status"] && !supports["tls"] {
+	if supports["access-control"] && !supports["batch"] && supports["cname"] && supports["healthcheck"] && supports["info"] && !supports["status"] && supports["tls"] {
 		return &struct {
 			router.Router
 			router.OptsRouter
+			router.OptsSchemaRouter
+			router.AccessControlRouter
+			router.CNameRouter
 			router.CustomHealthcheckRouter
+			router.InfoRouter
+			router.TLSRouter
 		}{
 			base,
 			base,
+			base,
+			apiRouterWithAccessControlInst,
+			apiRouterWithCnameSupportInst,
 			apiRouterWithHealthcheckSupportInst,
+			apiRouterWithInfoInst,
+			apiRouterWithTLSSupportInst,
 		}
 	}
-	if supports["cname"] && supports["healthcheck"] && !supports["info"] && !supports["status"] && !supports["tls"] {
+	if !supports["access-control"] && supports["batch"] && supports["cname"] && supports["healthcheck"] && supports["info"] && !supports["status"] && supports["tls"] {
 		return &struct {
 			router.Router
 			router.OptsRouter
+			router.OptsSchemaRouter
+			router.MultiBatchRouter
 			router.CNameRouter
 			router.CustomHealthcheckRouter
+			router.InfoRouter
+			router.TLSRouter
 		}{
 			base,
 			base,
+			base,
+			apiRouterWithBatchInst,
 			apiRouterWithCnameSupportInst,
 			apiRouterWithHealthcheckSupportInst,
+			apiRouterWithInfoInst,
+			apiRouterWithTLSSupportInst,
 		}
 	}
-	if !supports["cname"] && !supports["healthcheck"] && supports["info"] && !supports["status"] && !supports["tls"] {
+	if supports["access-control"] && supports["batch"] && supports["cname"] && supports["healthcheck"] && supports["info"] && !supports["status"] && supports["tls"] {
 		return &struct {
 			router.Router
 			router.OptsRouter
+			router.OptsSchemaRouter
+			router.AccessControlRouter
+			router.MultiBatchRouter
+			router.CNameRouter
+			router.CustomHealthcheckRouter
 			router.InfoRouter
+			router.TLSRouter
 		}{
 			base,
 			base,
+			base,
+			apiRouterWithAccessControlInst,
+			apiRouterWithBatchInst,
+			apiRouterWithCnameSupportInst,
+			apiRouterWithHealthcheckSupportInst,
 			apiRouterWithInfoInst,
+			apiRouterWithTLSSupportInst,
 		}
 	}
-	if supports["cname"] && !supports["healthcheck"] && supports["info"] && !supports["status"] && !supports["tls"] {
+	if !supports["access-control"] && !supports["batch"] && !supports["cname"] && !supports["healthcheck"] && !supports["info"] && supports["status"] && supports["tls"] {
 		return &struct {
 			router.Router
 			router.OptsRouter
-			router.CNameRouter
-			router.InfoRouter
+			router.OptsSchemaRouter
+			router.StatusRouter
+			router.TLSRouter
 		}{
 			base,
 			base,
-			apiRouterWithCnameSupportInst,
-			apiRouterWithInfoInst,
+			base,
+			apiRouterWithStatusInst,
+			apiRouterWithTLSSupportInst,
 		}
 	}
-	if !supports["cname"] && supports["healthcheck"] && supports["info"] && !supports["status"] && !supports["tls"] {
+	if supports["access-control"] && !supports["batch"] && !supports["cname"] && !supports["healthcheck"] && !supports["info"] && supports["status"] && supports["tls"] {
 		return &struct {
 			router.Router
 			router.OptsRouter
-			router.CustomHealthcheckRouter
-			router.InfoRouter
+			router.OptsSchemaRouter
+			router.AccessControlRouter
+			router.StatusRouter
+			router.TLSRouter
 		}{
 			base,
 			base,
-			apiRouterWithHealthcheckSupportInst,
-			apiRouterWithInfoInst,
+			base,
+			apiRouterWithAccessControlInst,
+			apiRouterWithStatusInst,
+			apiRouterWithTLSSupportInst,
 		}
 	}
-	if supports["cname"] && supports["healthcheck"] && supports["info"] && !supports["status"] && !supports["tls"] {
+	if !supports["access-control"] && supports["batch"] && !supports["cname"] && !supports["healthcheck"] && !supports["info"] && supports["status"] && supports["tls"] {
 		return &struct {
 			router.Router
 			router.OptsRouter
-			router.CNameRouter
-			router.CustomHealthcheckRouter
-			router.InfoRouter
+			router.OptsSchemaRouter
+			router.MultiBatchRouter
+			router.StatusRouter
+			router.TLSRouter
 		}{
 			base,
 			base,
-			apiRouterWithCnameSupportInst,
-			apiRouterWithHealthcheckSupportInst,
-			apiRouterWithInfoInst,
+			base,
+			apiRouterWithBatchInst,
+			apiRouterWithStatusInst,
+			apiRouterWithTLSSupportInst,
+		}
+	}
+	if supports["access-control"] && supports["batch"] && !supports["cname"] && !supports["healthcheck"] && !supports["info"] && supports["status"] && supports["tls"] {
+		return &struct {
+			router.Router
+			router.OptsRouter
+			router.OptsSchemaRouter
+			router.AccessControlRouter
+			router.MultiBatchRouter
+			router.StatusRouter
+			router.TLSRouter
+		}{
+			base,
+			base,
+			base,
+			apiRouterWithAccessControlInst,
+			apiRouterWithBatchInst,
+			apiRouterWithStatusInst,
+			apiRouterWithTLSSupportInst,
 		}
 	}
-	if !supports["cname"] && !supports["healthcheck"] && !supports["info"] && supports["status"] && !supports["tls"] {
+	if !supports["access-control"] && !supports["batch"] && supports["cname"] && !supports["healthcheck"] && !supports["info"] && supports["status"] && supports["tls"] {
 		return &struct {
 			router.Router
 			router.OptsRouter
+			router.OptsSchemaRouter
+			router.CNameRouter
 			router.StatusRouter
+			router.TLSRouter
 		}{
 			base,
 			base,
+			base,
+			apiRouterWithCnameSupportInst,
 			apiRouterWithStatusInst,
+			apiRouterWithTLSSupportInst,
 		}
 	}
-	if supports["cname"] && !supports["healthcheck"] && !supports["info"] && supports["status"] && !supports["tls"] {
+	if supports["access-control"] && !supports["batch"] && supports["cname"] && !supports["healthcheck"] && !supports["info"] && supports["status"] && supports["tls"] {
 		return &struct {
 			router.Router
 			router.OptsRouter
+			router.OptsSchemaRouter
+			router.AccessControlRouter
 			router.CNameRouter
 			router.StatusRouter
+			router.TLSRouter
 		}{
 			base,
 			base,
+			base,
+			apiRouterWithAccessControlInst,
 			apiRouterWithCnameSupportInst,
 			apiRouterWithStatusInst,
+			apiRouterWithTLSSupportInst,
 		}
 	}
-	if !supports["cname"] && supports["healthcheck"] && !supports["info"] && supports["status"] && !supports["tls"] {
+	if !supports["access-control"] && supports["batch"] && supports["cname"] && !supports["healthcheck"] && !supports["info"] && supports["status"] && supports["tls"] {
 		return &struct {
 			router.Router
 			router.OptsRouter
-			router.CustomHealthcheckRouter
+			router.OptsSchemaRouter
+			router.MultiBatchRouter
+			router.CNameRouter
 			router.StatusRouter
+			router.TLSRouter
 		}{
 			base,
 			base,
-			apiRouterWithHealthcheckSupportInst,
+			base,
+			apiRouterWithBatchInst,
+			apiRouterWithCnameSupportInst,
 			apiRouterWithStatusInst,
+			apiRouterWithTLSSupportInst,
 		}
 	}
-	if supports["cname"] && supports["healthcheck"] && !supports["info"] && supports["status"] && !supports["tls"] {
+	if supports["access-control"] && supports["batch"] && supports["cname"] && !supports["healthcheck"] && !supports["info"] && supports["status"] && supports["tls"] {
 		return &struct {
 			router.Router
 			router.OptsRouter
+			router.OptsSchemaRouter
+			router.AccessControlRouter
+			router.MultiBatchRouter
 			router.CNameRouter
-			router.CustomHealthcheckRouter
 			router.StatusRouter
+			router.TLSRouter
 		}{
 			base,
 			base,
+			base,
+			apiRouterWithAccessControlInst,
+			apiRouterWithBatchInst,
 			apiRouterWithCnameSupportInst,
-			apiRouterWithHealthcheckSupportInst,
 			apiRouterWithStatusInst,
+			apiRouterWithTLSSupportInst,
 		}
 	}
-	if !supports["cname"] && !supports["healthcheck"] && supports["info"] && supports["status"] && !supports["tls"] {
+	if !supports["access-control"] && !supports["batch"] && !supports["cname"] && supports["healthcheck"] && !supports["info"] && supports["status"] && supports["tls"] {
 		return &struct {
 			router.Router
 			router.OptsRouter
-			router.InfoRouter
+			router.OptsSchemaRouter
+			router.CustomHealthcheckRouter
 			router.StatusRouter
+			router.TLSRouter
 		}{
 			base,
 			base,
-			apiRouterWithInfoInst,
+			base,
+			apiRouterWithHealthcheckSupportInst,
 			apiRouterWithStatusInst,
+			apiRouterWithTLSSupportInst,
 		}
 	}
-	if supports["cname"] && !supports["healthcheck"] && supports["info"] && supports["status"] && !supports["tls"] {
+	if supports["access-control"] && !supports["batch"] && !supports["cname"] && supports["healthcheck"] && !supports["info"] && supports["status"] && supports["tls"] {
 		return &struct {
 			router.Router
 			router.OptsRouter
-			router.CNameRouter
-			router.InfoRouter
+			router.OptsSchemaRouter
+			router.AccessControlRouter
+			router.CustomHealthcheckRouter
 			router.StatusRouter
+			router.TLSRouter
 		}{
 			base,
 			base,
-			apiRouterWithCnameSupportInst,
-			apiRouterWithInfoInst,
+			base,
+			apiRouterWithAccessControlInst,
+			apiRouterWithHealthcheckSupportInst,
 			apiRouterWithStatusInst,
+			apiRouterWithTLSSupportInst,
 		}
 	}
-	if !supports["cname"] && supports["healthcheck"] && supports["info"] && supports["status"] && !supports["tls"] {
+	if !supports["access-control"] && supports["batch"] && !supports["cname"] && supports["healthcheck"] && !supports["info"] && supports["status"] && supports["tls"] {
 		return &struct {
 			router.Router
 			router.OptsRouter
+			router.OptsSchemaRouter
+			router.MultiBatchRouter
 			router.CustomHealthcheckRouter
-			router.InfoRouter
 			router.StatusRouter
+			router.TLSRouter
 		}{
 			base,
 			base,
+			base,
+			apiRouterWithBatchInst,
 			apiRouterWithHealthcheckSupportInst,
-			apiRouterWithInfoInst,
 			apiRouterWithStatusInst,
+			apiRouterWithTLSSupportInst,
 		}
 	}
-	if supports["cname"] && supports["healthcheck"] && supports["info"] && supports["status"] && !supports["tls"] {
+	if supports["access-control"] && supports["batch"] && !supports["cname"] && supports["healthcheck"] && !supports["info"] && supports["status"] && supports["tls"] {
 		return &struct {
 			router.Router
 			router.OptsRouter
-			router.CNameRouter
+			router.OptsSchemaRouter
+			router.AccessControlRouter
+			router.MultiBatchRouter
 			router.CustomHealthcheckRouter
-			router.InfoRouter
 			router.StatusRouter
+			router.TLSRouter
 		}{
 			base,
 			base,
-			apiRouterWithCnameSupportInst,
+			base,
+			apiRouterWithAccessControlInst,
+			apiRouterWithBatchInst,
 			apiRouterWithHealthcheckSupportInst,
-			apiRouterWithInfoInst,
 			apiRouterWithStatusInst,
+			apiRouterWithTLSSupportInst,
 		}
 	}
-	if !supports["cname"] && !supports["healthcheck"] && !supports["info"] && !supports["status"] && supports["tls"] {
+	if !supports["access-control"] && !supports["batch"] && supports["cname"] && supports["healthcheck"] && !supports["info"] && supports["status"] && supports["tls"] {
 		return &struct {
 			router.Router
 			router.OptsRouter
+			router.OptsSchemaRouter
+			router.CNameRouter
+			router.CustomHealthcheckRouter
+			router.StatusRouter
 			router.TLSRouter
 		}{
 			base,
 			base,
+			base,
+			apiRouterWithCnameSupportInst,
+			apiRouterWithHealthcheckSupportInst,
+			apiRouterWithStatusInst,
 			apiRouterWithTLSSupportInst,
 		}
 	}
-	if supports["cname"] && !supports["healthcheck"] && !supports["info"] && !supports["status"] && supports["tls"] {
+	if supports["access-control"] && !supports["batch"] && supports["cname"] && supports["healthcheck"] && !supports["info"] && supports["status"] && supports["tls"] {
 		return &struct {
 			router.Router
 			router.OptsRouter
+			router.OptsSchemaRouter
+			router.AccessControlRouter
 			router.CNameRouter
+			router.CustomHealthcheckRouter
+			router.StatusRouter
 			router.TLSRouter
 		}{
 			base,
 			base,
+			base,
+			apiRouterWithAccessControlInst,
 			apiRouterWithCnameSupportInst,
+			apiRouterWithHealthcheckSupportInst,
+			apiRouterWithStatusInst,
 			apiRouterWithTLSSupportInst,
 		}
 	}
-	if !supports["cname"] && supports["healthcheck"] && !supports["info"] && !supports["status"] && supports["tls"] {
+	if !supports["access-control"] && supports["batch"] && supports["cname"] && supports["healthcheck"] && !supports["info"] && supports["status"] && supports["tls"] {
 		return &struct {
 			router.Router
 			router.OptsRouter
+			router.OptsSchemaRouter
+			router.MultiBatchRouter
+			router.CNameRouter
 			router.CustomHealthcheckRouter
+			router.StatusRouter
 			router.TLSRouter
 		}{
 			base,
 			base,
+			base,
+			apiRouterWithBatchInst,
+			apiRouterWithCnameSupportInst,
 			apiRouterWithHealthcheckSupportInst,
+			apiRouterWithStatusInst,
 			apiRouterWithTLSSupportInst,
 		}
 	}
-	if supports["cname"] && supports["healthcheck"] && !supports["info"] && !supports["status"] && supports["tls"] {
+	if supports["access-control"] && supports["batch"] && supports["cname"] && supports["healthcheck"] && !supports["info"] && supports["status"] && supports["tls"] {
 		return &struct {
 			router.Router
 			router.OptsRouter
+			router.OptsSchemaRouter
+			router.AccessControlRouter
+			router.MultiBatchRouter
 			router.CNameRouter
 			router.CustomHealthcheckRouter
+			router.StatusRouter
 			router.TLSRouter
 		}{
 			base,
 			base,
+			base,
+			apiRouterWithAccessControlInst,
+			apiRouterWithBatchInst,
 			apiRouterWithCnameSupportInst,
 			apiRouterWithHealthcheckSupportInst,
+			apiRouterWithStatusInst,
 			apiRouterWithTLSSupportInst,
 		}
 	}
-	if !supports["cname"] && !supports["healthcheck"] && supports["info"] && !supports["status"] && supports["tls"] {
+	if !supports["access-control"] && !supports["batch"] && !supports["cname"] && !supports["healthcheck"] && supports["info"] && supports["status"] && supports["tls"] {
 		return &struct {
 			router.Router
 			router.OptsRouter
+			router.OptsSchemaRouter
 			router.InfoRouter
+			router.StatusRouter
 			router.TLSRouter
 		}{
+			base,
 			base,
 			base,
 			apiRouterWithInfoInst,
+			apiRouterWithStatusInst,
 			apiRouterWithTLSSupportInst,
 		}
 	}
-	if supports["cname"] && !supports["healthcheck"] && supports["info"] && !supports["status"] && supports["tls"] {
+	if supports["access-control"] && !supports["batch"] && !supports["cname"] && !supports["healthcheck"] && supports["info"] && supports["status"] && supports["tls"] {
 		return &struct {
 			router.Router
 			router.OptsRouter
-			router.CNameRouter
+			router.OptsSchemaRouter
+			router.AccessControlRouter
 			router.InfoRouter
+			router.StatusRouter
 			router.TLSRouter
 		}{
 			base,
 			base,
-			apiRouterWithCnameSupportInst,
+			base,
+			apiRouterWithAccessControlInst,
 			apiRouterWithInfoInst,
+			apiRouterWithStatusInst,
 			apiRouterWithTLSSupportInst,
 		}
 	}
-	if !supports["cname"] && supports["healthcheck"] && supports["info"] && !supports["status"] && supports["tls"] {
+	if !supports["access-control"] && supports["batch"] && !supports["cname"] && !supports["healthcheck"] && supports["info"] && supports["status"] && supports["tls"] {
 		return &struct {
 			router.Router
 			router.OptsRouter
-			router.CustomHealthcheckRouter
+			router.OptsSchemaRouter
+			router.MultiBatchRouter
 			router.InfoRouter
+			router.StatusRouter
 			router.TLSRouter
 		}{
 			base,
 			base,
-			apiRouterWithHealthcheckSupportInst,
+			base,
+			apiRouterWithBatchInst,
+			apiRouterWithInfoInst,
+			apiRouterWithStatusInst,
+			apiRouterWithTLSSupportInst,
+		}
+	}
+	if supports["access-control"] && supports["batch"] && !supports["cname"] && !supports["healthcheck"] && supports["info"] && supports["status"] && supports["tls"] {
+		return &struct {
+			router.Router
+			router.OptsRouter
+			router.OptsSchemaRouter
+			router.AccessControlRouter
+			router.MultiBatchRouter
+			router.InfoRouter
+			router.StatusRouter
+			router.TLSRouter
+		}{
+			base,
+			base,
+			base,
+			apiRouterWithAccessControlInst,
+			apiRouterWithBatchInst,
 			apiRouterWithInfoInst,
+			apiRouterWithStatusInst,
 			apiRouterWithTLSSupportInst,
 		}
 	}
-	if supports["cname"] && supports["healthcheck"] && supports["info"] && !supports["status"] && supports["tls"] {
+	if !supports["access-control"] && !supports["batch"] && supports["cname"] && !supports["healthcheck"] && supports["info"] && supports["status"] && supports["tls"] {
 		return &struct {
 			router.Router
 			router.OptsRouter
+			router.OptsSchemaRouter
 			router.CNameRouter
-			router.CustomHealthcheckRouter
 			router.InfoRouter
+			router.StatusRouter
 			router.TLSRouter
 		}{
+			base,
 			base,
 			base,
 			apiRouterWithCnameSupportInst,
-			apiRouterWithHealthcheckSupportInst,
 			apiRouterWithInfoInst,
+			apiRouterWithStatusInst,
+			apiRouterWithTLSSupportInst,
+		}
+	}
+	if supports["access-control"] && !supports["batch"] && supports["cname"] && !supports["healthcheck"] && supports["info"] && supports["status"] && supports["tls"] {
+		return &struct {
+			router.Router
+			router.OptsRouter
+			router.OptsSchemaRouter
+			router.AccessControlRouter
+			router.CNameRouter
+			router.InfoRouter
+			router.StatusRouter
+			router.TLSRouter
+		}{
+			base,
+			base,
+			base,
+			apiRouterWithAccessControlInst,
+			apiRouterWithCnameSupportInst,
+			apiRouterWithInfoInst,
+			apiRouterWithStatusInst,
 			apiRouterWithTLSSupportInst,
 		}
 	}
-	if !supports["cname"] && !supports["healthcheck"] && !supports["info"] && supports["status"] && supports["tls"] {
+	if !supports["access-control"] && supports["batch"] && supports["cname"] && !supports["healthcheck"] && supports["info"] && supports["status"] && supports["tls"] {
 		return &struct {
 			router.Router
 			router.OptsRouter
+			router.OptsSchemaRouter
+			router.MultiBatchRouter
+			router.CNameRouter
+			router.InfoRouter
 			router.StatusRouter
 			router.TLSRouter
 		}{
 			base,
 			base,
+			base,
+			apiRouterWithBatchInst,
+			apiRouterWithCnameSupportInst,
+			apiRouterWithInfoInst,
 			apiRouterWithStatusInst,
 			apiRouterWithTLSSupportInst,
 		}
 	}
-	if supports["cname"] && !supports["healthcheck"] && !supports["info"] && supports["status"] && supports["tls"] {
+	if supports["access-control"] && supports["batch"] && supports["cname"] && !supports["healthcheck"] && supports["info"] && supports["status"] && supports["tls"] {
 		return &struct {
 			router.Router
 			router.OptsRouter
+			router.OptsSchemaRouter
+			router.AccessControlRouter
+			router.MultiBatchRouter
 			router.CNameRouter
+			router.InfoRouter
 			router.StatusRouter
 			router.TLSRouter
 		}{
 			base,
 			base,
+			base,
+			apiRouterWithAccessControlInst,
+			apiRouterWithBatchInst,
 			apiRouterWithCnameSupportInst,
+			apiRouterWithInfoInst,
 			apiRouterWithStatusInst,
 			apiRouterWithTLSSupportInst,
 		}
 	}
-	if !supports["cname"] && supports["healthcheck"] && !supports["info"] && supports["status"] && supports["tls"] {
+	if !supports["access-control"] && !supports["batch"] && !supports["cname"] && supports["healthcheck"] && supports["info"] && supports["status"] && supports["tls"] {
 		return &struct {
 			router.Router
 			router.OptsRouter
+			router.OptsSchemaRouter
 			router.CustomHealthcheckRouter
+			router.InfoRouter
 			router.StatusRouter
 			router.TLSRouter
 		}{
+			base,
 			base,
 			base,
 			apiRouterWithHealthcheckSupportInst,
+			apiRouterWithInfoInst,
 			apiRouterWithStatusInst,
 			apiRouterWithTLSSupportInst,
 		}
 	}
-	if supports["cname"] && supports["healthcheck"] && !supports["info"] && supports["status"] && supports["tls"] {
+	if supports["access-control"] && !supports["batch"] && !supports["cname"] && supports["healthcheck"] && supports["info"] && supports["status"] && supports["tls"] {
 		return &struct {
 			router.Router
 			router.OptsRouter
-			router.CNameRouter
+			router.OptsSchemaRouter
+			router.AccessControlRouter
 			router.CustomHealthcheckRouter
+			router.InfoRouter
 			router.StatusRouter
 			router.TLSRouter
 		}{
 			base,
 			base,
-			apiRouterWithCnameSupportInst,
+			base,
+			apiRouterWithAccessControlInst,
+			apiRouterWithHealthcheckSupportInst,
+			apiRouterWithInfoInst,
+			apiRouterWithStatusInst,
+			apiRouterWithTLSSupportInst,
+		}
+	}
+	if !supports["access-control"] && supports["batch"] && !supports["cname"] && supports["healthcheck"] && supports["info"] && supports["status"] && supports["tls"] {
+		return &struct {
+			router.Router
+			router.OptsRouter
+			router.OptsSchemaRouter
+			router.MultiBatchRouter
+			router.CustomHealthcheckRouter
+			router.InfoRouter
+			router.StatusRouter
+			router.TLSRouter
+		}{
+			base,
+			base,
+			base,
+			apiRouterWithBatchInst,
+			apiRouterWithHealthcheckSupportInst,
+			apiRouterWithInfoInst,
+			apiRouterWithStatusInst,
+			apiRouterWithTLSSupportInst,
+		}
+	}
+	if supports["access-control"] && supports["batch"] && !supports["cname"] && supports["healthcheck"] && supports["info"] && supports["status"] && supports["tls"] {
+		return &struct {
+			router.Router
+			router.OptsRouter
+			router.OptsSchemaRouter
+			router.AccessControlRouter
+			router.MultiBatchRouter
+			router.CustomHealthcheckRouter
+			router.InfoRouter
+			router.StatusRouter
+			router.TLSRouter
+		}{
+			base,
+			base,
+			base,
+			apiRouterWithAccessControlInst,
+			apiRouterWithBatchInst,
 			apiRouterWithHealthcheckSupportInst,
+			apiRouterWithInfoInst,
 			apiRouterWithStatusInst,
 			apiRouterWithTLSSupportInst,
 		}
 	}
-	if !supports["cname"] && !supports["healthcheck"] && supports["info"] && supports["status"] && supports["tls"] {
+	if !supports["access-control"] && !supports["batch"] && supports["cname"] && supports["healthcheck"] && supports["info"] && supports["status"] && supports["tls"] {
 		return &struct {
 			router.Router
 			router.OptsRouter
+			router.OptsSchemaRouter
+			router.CNameRouter
+			router.CustomHealthcheckRouter
 			router.InfoRouter
 			router.StatusRouter
 			router.TLSRouter
 		}{
 			base,
 			base,
+			base,
+			apiRouterWithCnameSupportInst,
+			apiRouterWithHealthcheckSupportInst,
 			apiRouterWithInfoInst,
 			apiRouterWithStatusInst,
 			apiRouterWithTLSSupportInst,
 		}
 	}
-	if supports["cname"] && !supports["healthcheck"] && supports["info"] && supports["status"] && supports["tls"] {
+	if supports["access-control"] && !supports["batch"] && supports["cname"] && supports["healthcheck"] && supports["info"] && supports["status"] && supports["tls"] {
 		return &struct {
 			router.Router
 			router.OptsRouter
+			router.OptsSchemaRouter
+			router.AccessControlRouter
 			router.CNameRouter
+			router.CustomHealthcheckRouter
 			router.InfoRouter
 			router.StatusRouter
 			router.TLSRouter
 		}{
 			base,
 			base,
+			base,
+			apiRouterWithAccessControlInst,
 			apiRouterWithCnameSupportInst,
+			apiRouterWithHealthcheckSupportInst,
 			apiRouterWithInfoInst,
 			apiRouterWithStatusInst,
 			apiRouterWithTLSSupportInst,
 		}
 	}
-	if !supports["cname"] && supports["healthcheck"] && supports["info"] && supports["status"] && supports["tls"] {
+	if !supports["access-control"] && supports["batch"] && supports["cname"] && supports["healthcheck"] && supports["info"] && supports["status"] && supports["tls"] {
 		return &struct {
 			router.Router
 			router.OptsRouter
+			router.OptsSchemaRouter
+			router.MultiBatchRouter
+			router.CNameRouter
 			router.CustomHealthcheckRouter
 			router.InfoRouter
 			router.StatusRouter
@@ -441,16 +2290,22 @@ func toSupportedInterface(base *apiRouter, supports map[capability]bool) router.
 		}{
 			base,
 			base,
+			base,
+			apiRouterWithBatchInst,
+			apiRouterWithCnameSupportInst,
 			apiRouterWithHealthcheckSupportInst,
 			apiRouterWithInfoInst,
 			apiRouterWithStatusInst,
 			apiRouterWithTLSSupportInst,
 		}
 	}
-	if supports["cname"] && supports["healthcheck"] && supports["info"] && supports["status"] && supports["tls"] {
+	if supports["access-control"] && supports["batch"] && supports["cname"] && supports["healthcheck"] && supports["info"] && supports["status"] && supports["tls"] {
 		return &struct {
 			router.Router
 			router.OptsRouter
+			router.OptsSchemaRouter
+			router.AccessControlRouter
+			router.MultiBatchRouter
 			router.CNameRouter
 			router.CustomHealthcheckRouter
 			router.InfoRouter
@@ -459,6 +2314,9 @@ func toSupportedInterface(base *apiRouter, supports map[capability]bool) router.
 		}{
 			base,
 			base,
+			base,
+			apiRouterWithAccessControlInst,
+			apiRouterWithBatchInst,
 			apiRouterWithCnameSupportInst,
 			apiRouterWithHealthcheckSupportInst,
 			apiRouterWithInfoInst,
@@ -0,0 +1,192 @@
+// Copyright 2018 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package file
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/globalsign/mgo/bson"
+	"github.com/pkg/errors"
+	"github.com/tsuru/tsuru/router"
+)
+
+// l4FileRouter is a file router that also routes TCP traffic to the extra
+// ports of apps, each one listening on a port taken from the port range of
+// the router. Only HAProxy routers with a port range are l4FileRouters, nginx
+// would require the routes in a stream block, outside the http block
+// including the configuration file.
+type l4FileRouter struct {
+	*fileRouter
+}
+
+var _ router.L4Router = &l4FileRouter{}
+
+type portRange struct {
+	min, max int
+}
+
+func parsePortRange(value string) (portRange, error) {
+	parts := strings.SplitN(value, "-", 2)
+	if len(parts) != 2 {
+		return portRange{}, errors.Errorf("invalid port range %q, it must be in the format <min>-<max>", value)
+	}
+	min, minErr := strconv.Atoi(strings.TrimSpace(parts[0]))
+	max, maxErr := strconv.Atoi(strings.TrimSpace(parts[1]))
+	if minErr != nil || maxErr != nil || min < 1 || max > 65535 || min > max {
+		return portRange{}, errors.Errorf("invalid port range %q, it must be in the format <min>-<max>", value)
+	}
+	return portRange{min: min, max: max}, nil
+}
+
+type templatePort struct {
+	ID         string
+	Name       string
+	ListenPort int
+	Routes     []templateRoute
+}
+
+func (r *l4FileRouter) address(name string, listenPort int) string {
+	return fmt.Sprintf("%s:%d", r.backendHost(name), listenPort)
+}
+
+// AddPortRoutes adds routes to the port of the backend, creating it with the
+// first free port of the range when it doesn't exist. UDP ports are not
+// supported by HAProxy, gRPC ones are routed as TCP.
+func (r *l4FileRouter) AddPortRoutes(name string, port router.L4Port, addresses []*url.URL) (err error) {
+	done := router.InstrumentRequest(r.routerName)
+	defer func() {
+		done(err)
+	}()
+	if port.Protocol == "udp" {
+		return errors.Errorf("router %q does not support udp ports", r.routerName)
+	}
+	usedName, err := router.Retrieve(name)
+	if err != nil {
+		return err
+	}
+	routes := make([]string, len(addresses))
+	for i, addr := range addresses {
+		routes[i] = addr.String()
+	}
+	update := bson.M{
+		"$addToSet": bson.M{"ports.$.routes": bson.M{"$each": routes}},
+		"$set":      bson.M{"ports.$.protocol": port.Protocol},
+	}
+	err = r.updateBackend(usedName, bson.M{"ports.name": port.Name}, update, router.ErrPortNotFound)
+	if err == router.ErrPortNotFound {
+		err = r.addPort(usedName, backendPort{Name: port.Name, Protocol: port.Protocol, Routes: routes})
+	}
+	if err != nil {
+		return err
+	}
+	return r.changed("add-port-routes")
+}
+
+// addPort adds the port to the backend, listening on the first port of the
+// range not used by other backends. The port is chosen holding the render
+// lock, shared by every tsuru instance.
+func (r *l4FileRouter) addPort(name string, port backendPort) error {
+	unlock, err := r.lockRender()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	backends, err := r.listBackends()
+	if err != nil {
+		return err
+	}
+	used := map[int]bool{}
+	for _, b := range backends {
+		for _, p := range b.Ports {
+			used[p.ListenPort] = true
+		}
+	}
+	for listenPort := r.portRange.min; listenPort <= r.portRange.max; listenPort++ {
+		if !used[listenPort] {
+			port.ListenPort = listenPort
+			break
+		}
+	}
+	if port.ListenPort == 0 {
+		return errors.Errorf("no free port left in the range of router %q", r.routerName)
+	}
+	update := bson.M{"$push": bson.M{"ports": port}}
+	return r.updateBackend(name, bson.M{"ports.name": bson.M{"$ne": port.Name}}, update, router.ErrBackendNotFound)
+}
+
+func (r *l4FileRouter) RemovePortRoutes(name, portName string, addresses []*url.URL) (err error) {
+	done := router.InstrumentRequest(r.routerName)
+	defer func() {
+		done(err)
+	}()
+	usedName, err := router.Retrieve(name)
+	if err != nil {
+		return err
+	}
+	routes := make([]string, len(addresses))
+	for i, addr := range addresses {
+		routes[i] = addr.String()
+	}
+	update := bson.M{"$pullAll": bson.M{"ports.$.routes": routes}}
+	err = r.updateBackend(usedName, bson.M{"ports.name": portName}, update, router.ErrPortNotFound)
+	if err != nil {
+		return err
+	}
+	return r.changed("remove-port-routes")
+}
+
+func (r *l4FileRouter) RemovePort(name, portName string) (err error) {
+	done := router.InstrumentRequest(r.routerName)
+	defer func() {
+		done(err)
+	}()
+	usedName, err := router.Retrieve(name)
+	if err != nil {
+		return err
+	}
+	update := bson.M{"$pull": bson.M{"ports": bson.M{"name": portName}}}
+	err = r.updateBackend(usedName, bson.M{"ports.name": portName}, update, router.ErrPortNotFound)
+	if err != nil {
+		return err
+	}
+	return r.changed("remove-port")
+}
+
+func (r *l4FileRouter) PortRoutes(name string) (ports []router.L4Route, err error) {
+	done := router.InstrumentRequest(r.routerName)
+	defer func() {
+		done(err)
+	}()
+	usedName, err := router.Retrieve(name)
+	if err != nil {
+		return nil, err
+	}
+	b, err := r.findBackend(usedName)
+	if err != nil {
+		return nil, err
+	}
+	ports = make([]router.L4Route, len(b.Ports))
+	for i, p := range b.Ports {
+		ports[i] = router.L4Route{
+			L4Port:  router.L4Port{Name: p.Name, Protocol: p.Protocol},
+			Address: r.address(usedName, p.ListenPort),
+			Routes:  make([]*url.URL, len(p.Routes)),
+		}
+		for j, route := range p.Routes {
+			ports[i].Routes[j], err = url.Parse(route)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	sort.Slice(ports, func(i, j int) bool {
+		return ports[i].Name < ports[j].Name
+	})
+	return ports, nil
+}
@@ -0,0 +1,999 @@
+// Copyright 2018 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package file provides a router implementation that renders the routes of
+// every backend in a configuration file, using a template, and reloads the
+// proxy reading it. Backends, routes, cnames and certificates are kept in
+// tsuru's database, along with a revision incremented on each change. The
+// whole file is rendered again when the revision changes, changes made while
+// rendering being rendered together by the next render.
+//
+// Every tsuru instance renders the file when it starts and keeps it in sync
+// with the changes made by other instances, polling the revision. Renders
+// hold a lock shared by all instances, so the file may also be kept in a
+// volume shared by them.
+//
+// It does not provide any exported type, in order to use the router, you must
+// import this package and get the router instance using the function
+// router.Get.
+//
+// In order to use this router, you need to define the "routers:<name>:type =
+// nginx" or "routers:<name>:type = haproxy" in your config. HAProxy routers
+// with a "routers:<name>:port-range" also route TCP traffic to the extra ports
+// of apps.
+package file
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/globalsign/mgo"
+	"github.com/globalsign/mgo/bson"
+	"github.com/pkg/errors"
+	"github.com/tsuru/config"
+	"github.com/tsuru/tsuru/router"
+)
+
+var (
+	templates = map[string]string{
+		"nginx":   nginxTemplate,
+		"haproxy": haproxyTemplate,
+	}
+
+	renderStatesMu sync.Mutex
+	renderStates   = map[string]*renderState{}
+)
+
+const defaultSyncInterval = 10 * time.Second
+
+var (
+	_ router.CNameRouter         = &fileRouter{}
+	_ router.TLSRouter           = &fileRouter{}
+	_ router.AccessControlRouter = &fileRouter{}
+	_ router.OptsSchemaRouter    = &fileRouter{}
+	_ router.PathRouter          = &fileRouter{}
+	_ router.WeightedRouter      = &fileRouter{}
+	_ router.SyncRouter          = &fileRouter{}
+)
+
+func init() {
+	for routerType := range templates {
+		router.Register(routerType, createRouter)
+	}
+}
+
+type fileRouter struct {
+	routerName      string
+	routerType      string
+	domain          string
+	configFile      string
+	certificatesDir string
+	reloadCommand   string
+	checkCommand    string
+	syncInterval    time.Duration
+	portRange       portRange
+	template        *template.Template
+}
+
+func createRouter(routerName, configPrefix string) (router.Router, error) {
+	routerType, err := config.GetString(configPrefix + ":type")
+	if err != nil {
+		return nil, err
+	}
+	domain, err := config.GetString(configPrefix + ":domain")
+	if err != nil {
+		return nil, err
+	}
+	configFile, err := config.GetString(configPrefix + ":config-file")
+	if err != nil {
+		return nil, err
+	}
+	certificatesDir, _ := config.GetString(configPrefix + ":certificates-dir")
+	if certificatesDir == "" {
+		certificatesDir = filepath.Join(filepath.Dir(configFile), "certificates")
+	}
+	reloadCommand, _ := config.GetString(configPrefix + ":reload-command")
+	checkCommand, _ := config.GetString(configPrefix + ":check-command")
+	syncInterval := defaultSyncInterval
+	if seconds, _ := config.GetInt(configPrefix + ":sync-interval"); seconds > 0 {
+		syncInterval = time.Duration(seconds) * time.Second
+	}
+	tplContent := templates[routerType]
+	if tplFile, _ := config.GetString(configPrefix + ":template"); tplFile != "" {
+		data, err := ioutil.ReadFile(tplFile)
+		if err != nil {
+			return nil, errors.Wrapf(err, "unable to read template for router %q", routerName)
+		}
+		tplContent = string(data)
+	}
+	tpl, err := template.New(routerName).Parse(tplContent)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid template for router %q", routerName)
+	}
+	r := &fileRouter{
+		routerName:      routerName,
+		routerType:      routerType,
+		domain:          domain,
+		configFile:      configFile,
+		certificatesDir: certificatesDir,
+		reloadCommand:   reloadCommand,
+		checkCommand:    checkCommand,
+		syncInterval:    syncInterval,
+		template:        tpl,
+	}
+	rawPortRange, _ := config.GetString(configPrefix + ":port-range")
+	if rawPortRange == "" {
+		return r, nil
+	}
+	if routerType != "haproxy" {
+		return nil, errors.Errorf("port-range is only supported by haproxy routers, router %q is %s", routerName, routerType)
+	}
+	r.portRange, err = parsePortRange(rawPortRange)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid config for router %q", routerName)
+	}
+	return &l4FileRouter{fileRouter: r}, nil
+}
+
+func (r *fileRouter) GetName() string {
+	return r.routerName
+}
+
+func (r *fileRouter) backendHost(name string) string {
+	return fmt.Sprintf("%s.%s", name, r.domain)
+}
+
+func (r *fileRouter) certificateFile(cname string) string {
+	return filepath.Join(r.certificatesDir, cname+".pem")
+}
+
+type templateData struct {
+	Backends        []templateBackend
+	CertificatesDir string
+	HasCertificates bool
+}
+
+type templateBackend struct {
+	ID            string
+	Name          string
+	Hosts         []templateHost
+	Routes        []templateRoute
+	Paths         []templatePath
+	Ports         []templatePort
+	AccessControl router.AccessControl
+}
+
+type templatePath struct {
+	ID     string
+	Path   string
+	Routes []templateRoute
+}
+
+// templateRoute is an address receiving requests. Weight is zero unless the
+// traffic of the backend is split between groups of routes.
+type templateRoute struct {
+	Host   string
+	Weight int
+}
+
+func (r templateRoute) String() string {
+	return r.Host
+}
+
+// MaxRequestRate returns the number of requests per second accepted from a
+// client address, including the burst.
+func (b templateBackend) MaxRequestRate() int {
+	return b.AccessControl.RateLimit + b.AccessControl.RateLimitBurst
+}
+
+type templateHost struct {
+	Name        string
+	Certificate string
+}
+
+func (r *fileRouter) templateData(backends []backend) (*templateData, error) {
+	data := templateData{CertificatesDir: r.certificatesDir}
+	for _, b := range backends {
+		certs := map[string]string{}
+		for _, cert := range b.Certificates {
+			certs[cert.CName] = r.certificateFile(cert.CName)
+			data.HasCertificates = true
+		}
+		tplBackend := templateBackend{
+			ID:            "tsuru_" + strings.Replace(b.Name, "-", "_", -1),
+			Name:          b.Name,
+			AccessControl: b.AccessControl,
+		}
+		for _, host := range append([]string{r.backendHost(b.Name)}, b.CNames...) {
+			tplBackend.Hosts = append(tplBackend.Hosts, templateHost{Name: host, Certificate: certs[host]})
+		}
+		var err error
+		tplBackend.Routes, err = weightedRoutes(b)
+		if err != nil {
+			return nil, err
+		}
+		for i, p := range b.Paths {
+			tplPath := templatePath{ID: fmt.Sprintf("%s_path%d", tplBackend.ID, i), Path: p.Path}
+			tplPath.Routes, err = routesHosts(p.Routes)
+			if err != nil {
+				return nil, err
+			}
+			tplBackend.Paths = append(tplBackend.Paths, tplPath)
+		}
+		// Longer paths come first, proxies matching rules in order, like
+		// HAProxy, must try them before the shorter ones.
+		sort.SliceStable(tplBackend.Paths, func(i, j int) bool {
+			return len(tplBackend.Paths[i].Path) > len(tplBackend.Paths[j].Path)
+		})
+		for _, p := range b.Ports {
+			tplPort := templatePort{
+				ID:         fmt.Sprintf("%s_port_%s", tplBackend.ID, strings.Replace(p.Name, "-", "_", -1)),
+				Name:       p.Name,
+				ListenPort: p.ListenPort,
+			}
+			tplPort.Routes, err = routesHosts(p.Routes)
+			if err != nil {
+				return nil, err
+			}
+			tplBackend.Ports = append(tplBackend.Ports, tplPort)
+		}
+		sort.Slice(tplBackend.Ports, func(i, j int) bool {
+			return tplBackend.Ports[i].Name < tplBackend.Ports[j].Name
+		})
+		data.Backends = append(data.Backends, tplBackend)
+	}
+	return &data, nil
+}
+
+func routesHosts(routes []string) ([]templateRoute, error) {
+	var hosts []templateRoute
+	for _, route := range routes {
+		u, err := url.Parse(route)
+		if err != nil {
+			return nil, err
+		}
+		hosts = append(hosts, templateRoute{Host: u.Host})
+	}
+	return hosts, nil
+}
+
+// maxRouteWeight is the highest server weight accepted by HAProxy.
+const maxRouteWeight = 256
+
+// weightedRoutes returns the routes of the backend with the weight of each
+// one, so that the weighted routes, together, receive the weight percent of
+// the requests. Routes in a group receiving no requests are left out.
+func weightedRoutes(b backend) ([]templateRoute, error) {
+	routes, err := routesHosts(b.Routes)
+	if err != nil || len(b.WeightedRoutes) == 0 {
+		return routes, err
+	}
+	weighted := map[string]bool{}
+	for _, route := range b.WeightedRoutes {
+		weighted[route] = true
+	}
+	var inGroup int
+	for _, route := range b.Routes {
+		if weighted[route] {
+			inGroup++
+		}
+	}
+	outGroup := len(b.Routes) - inGroup
+	if inGroup == 0 || outGroup == 0 {
+		return routes, nil
+	}
+	groupWeight, otherWeight := b.Weight*outGroup, (100-b.Weight)*inGroup
+	if d := gcd(groupWeight, otherWeight); d > 1 {
+		groupWeight, otherWeight = groupWeight/d, otherWeight/d
+	}
+	if max := maxInt(groupWeight, otherWeight); max > maxRouteWeight {
+		groupWeight = scaleWeight(groupWeight, max)
+		otherWeight = scaleWeight(otherWeight, max)
+	}
+	var result []templateRoute
+	for i, route := range b.Routes {
+		routes[i].Weight = otherWeight
+		if weighted[route] {
+			routes[i].Weight = groupWeight
+		}
+		if routes[i].Weight > 0 {
+			result = append(result, routes[i])
+		}
+	}
+	return result, nil
+}
+
+func scaleWeight(weight, max int) int {
+	if weight == 0 {
+		return 0
+	}
+	scaled := (weight*maxRouteWeight + max/2) / max
+	if scaled == 0 {
+		return 1
+	}
+	return scaled
+}
+
+func gcd(a, b int) int {
+	for b != 0 {
+		a, b = b, a%b
+	}
+	return a
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+// writeCertificates writes each certificate and its key to a single PEM file,
+// a format accepted by both nginx and HAProxy. Files already holding the same
+// content are left untouched. The returned function restores the files
+// changed, it's a no-op when no file was changed.
+func (r *fileRouter) writeCertificates(backends []backend) (restore func(), err error) {
+	previous := map[string][]byte{}
+	restore = func() {
+		for path, content := range previous {
+			if content == nil {
+				os.Remove(path)
+			} else {
+				ioutil.WriteFile(path, content, 0600)
+			}
+		}
+	}
+	defer func() {
+		if err != nil {
+			restore()
+		}
+	}()
+	for _, b := range backends {
+		for _, cert := range b.Certificates {
+			err = os.MkdirAll(r.certificatesDir, 0700)
+			if err != nil {
+				return nil, err
+			}
+			path := r.certificateFile(cert.CName)
+			content := []byte(strings.TrimSpace(cert.Certificate) + "\n" + strings.TrimSpace(cert.Key) + "\n")
+			current, readErr := ioutil.ReadFile(path)
+			if readErr == nil && bytes.Equal(current, content) {
+				continue
+			}
+			previous[path] = current
+			err = ioutil.WriteFile(path, content, 0600)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	if len(previous) == 0 {
+		return nil, nil
+	}
+	return restore, nil
+}
+
+func runCommand(command string, args ...string) error {
+	parts := append(strings.Fields(command), args...)
+	out, err := exec.Command(parts[0], parts[1:]...).CombinedOutput()
+	if err != nil {
+		return errors.Errorf("error running %q: %v: %s", strings.Join(parts, " "), err, bytes.TrimSpace(out))
+	}
+	return nil
+}
+
+// renderState is the revision last rendered to a configuration file by this
+// tsuru instance.
+type renderState struct {
+	sync.Mutex
+	rendered bool
+	revision int64
+}
+
+func (r *fileRouter) renderState() *renderState {
+	renderStatesMu.Lock()
+	defer renderStatesMu.Unlock()
+	state := renderStates[r.configFile]
+	if state == nil {
+		state = &renderState{}
+		renderStates[r.configFile] = state
+	}
+	return state
+}
+
+// changed records a change to the backends of the router and renders it.
+func (r *fileRouter) changed(op string) error {
+	revision, err := r.bumpRevision()
+	if err == nil {
+		err = r.render(revision)
+	}
+	return r.renderError(op, err)
+}
+
+// render writes the configuration file with every backend of the router and
+// reloads the proxy, unless the file was already rendered with the given
+// revision, or a newer one, by this instance. The file is written to a
+// temporary path, checked and then renamed, so the proxy never reads a
+// partial or invalid file. Certificates are restored when the check fails.
+func (r *fileRouter) render(revision int64) error {
+	state := r.renderState()
+	state.Lock()
+	defer state.Unlock()
+	if state.rendered && state.revision >= revision {
+		return nil
+	}
+	unlock, err := r.lockRender()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	revision, err = r.currentRevision()
+	if err != nil {
+		return err
+	}
+	backends, err := r.listBackends()
+	if err != nil {
+		return err
+	}
+	data, err := r.templateData(backends)
+	if err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	err = r.template.Execute(&buf, data)
+	if err != nil {
+		return errors.Wrap(err, "unable to render template")
+	}
+	restoreCertificates, err := r.writeCertificates(backends)
+	if err != nil {
+		return errors.Wrap(err, "unable to write certificates")
+	}
+	if restoreCertificates == nil && state.rendered {
+		current, readErr := ioutil.ReadFile(r.configFile)
+		if readErr == nil && bytes.Equal(current, buf.Bytes()) {
+			state.revision = revision
+			return nil
+		}
+	}
+	err = r.writeConfigFile(buf.Bytes())
+	if err != nil {
+		if restoreCertificates != nil {
+			restoreCertificates()
+		}
+		return err
+	}
+	if r.reloadCommand != "" {
+		err = runCommand(r.reloadCommand)
+		if err != nil {
+			// The file is already replaced, the next render must not skip
+			// reloading the proxy because the content didn't change.
+			state.rendered = false
+			return err
+		}
+	}
+	state.rendered = true
+	state.revision = revision
+	return nil
+}
+
+// writeConfigFile replaces the configuration file with content, after
+// checking it with the check command.
+func (r *fileRouter) writeConfigFile(content []byte) error {
+	tmpFile, err := ioutil.TempFile(filepath.Dir(r.configFile), filepath.Base(r.configFile)+".")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmpFile.Name())
+	_, err = tmpFile.Write(content)
+	if err == nil {
+		err = tmpFile.Chmod(0644)
+	}
+	if closeErr := tmpFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	if r.checkCommand != "" {
+		err = runCommand(r.checkCommand, tmpFile.Name())
+		if err != nil {
+			return err
+		}
+	}
+	return os.Rename(tmpFile.Name(), r.configFile)
+}
+
+func (r *fileRouter) renderError(op string, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &router.RouterError{Op: op, Err: err}
+}
+
+func (r *fileRouter) AddBackend(app router.App) (err error) {
+	done := router.InstrumentRequest(r.routerName)
+	defer func() {
+		done(err)
+	}()
+	name := app.GetName()
+	coll, err := backendsCollection()
+	if err != nil {
+		return err
+	}
+	defer coll.Close()
+	err = coll.Insert(backend{Router: r.routerName, Name: name})
+	if err != nil {
+		if mgo.IsDup(err) {
+			return router.ErrBackendExists
+		}
+		return err
+	}
+	err = router.Store(name, name, r.routerType)
+	if err != nil {
+		return err
+	}
+	return r.changed("add-backend")
+}
+
+func (r *fileRouter) RemoveBackend(name string) (err error) {
+	done := router.InstrumentRequest(r.routerName)
+	defer func() {
+		done(err)
+	}()
+	usedName, err := router.Retrieve(name)
+	if err != nil {
+		return err
+	}
+	if usedName != name {
+		return router.ErrBackendSwapped
+	}
+	b, err := r.findBackend(name)
+	if err != nil {
+		return err
+	}
+	coll, err := backendsCollection()
+	if err != nil {
+		return err
+	}
+	defer coll.Close()
+	err = coll.Remove(r.backendQuery(name))
+	if err != nil {
+		if err == mgo.ErrNotFound {
+			return router.ErrBackendNotFound
+		}
+		return err
+	}
+	err = r.changed("remove-backend")
+	if err != nil {
+		return err
+	}
+	for _, cert := range b.Certificates {
+		os.Remove(r.certificateFile(cert.CName))
+	}
+	return nil
+}
+
+func (r *fileRouter) AddRoutes(name string, addresses []*url.URL) (err error) {
+	done := router.InstrumentRequest(r.routerName)
+	defer func() {
+		done(err)
+	}()
+	usedName, err := router.Retrieve(name)
+	if err != nil {
+		return err
+	}
+	routes := make([]string, len(addresses))
+	for i, addr := range addresses {
+		routes[i] = addr.String()
+	}
+	update := bson.M{"$addToSet": bson.M{"routes": bson.M{"$each": routes}}}
+	err = r.updateBackend(usedName, nil, update, router.ErrBackendNotFound)
+	if err != nil {
+		return err
+	}
+	return r.changed("add-routes")
+}
+
+func (r *fileRouter) RemoveRoutes(name string, addresses []*url.URL) (err error) {
+	done := router.InstrumentRequest(r.routerName)
+	defer func() {
+		done(err)
+	}()
+	usedName, err := router.Retrieve(name)
+	if err != nil {
+		return err
+	}
+	routes := make([]string, len(addresses))
+	for i, addr := range addresses {
+		routes[i] = addr.String()
+	}
+	update := bson.M{"$pullAll": bson.M{"routes": routes, "weightedroutes": routes}}
+	err = r.updateBackend(usedName, nil, update, router.ErrBackendNotFound)
+	if err != nil {
+		return err
+	}
+	return r.changed("remove-routes")
+}
+
+func (r *fileRouter) Routes(name string) (routes []*url.URL, err error) {
+	done := router.InstrumentRequest(r.routerName)
+	defer func() {
+		done(err)
+	}()
+	usedName, err := router.Retrieve(name)
+	if err != nil {
+		return nil, err
+	}
+	b, err := r.findBackend(usedName)
+	if err != nil {
+		return nil, err
+	}
+	routes = make([]*url.URL, len(b.Routes))
+	for i, route := range b.Routes {
+		routes[i], err = url.Parse(route)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return routes, nil
+}
+
+func (r *fileRouter) Addr(name string) (addr string, err error) {
+	done := router.InstrumentRequest(r.routerName)
+	defer func() {
+		done(err)
+	}()
+	usedName, err := router.Retrieve(name)
+	if err != nil {
+		return "", err
+	}
+	_, err = r.findBackend(usedName)
+	if err != nil {
+		if err == router.ErrBackendNotFound {
+			return "", router.ErrRouteNotFound
+		}
+		return "", err
+	}
+	return r.backendHost(usedName), nil
+}
+
+func (r *fileRouter) Swap(backend1, backend2 string, cnameOnly bool) (err error) {
+	done := router.InstrumentRequest(r.routerName)
+	defer func() {
+		done(err)
+	}()
+	return router.Swap(r, backend1, backend2, cnameOnly)
+}
+
+func (r *fileRouter) SetCName(cname, name string) (err error) {
+	done := router.InstrumentRequest(r.routerName)
+	defer func() {
+		done(err)
+	}()
+	if !router.ValidCName(cname, r.domain) {
+		return router.ErrCNameNotAllowed
+	}
+	usedName, err := router.Retrieve(name)
+	if err != nil {
+		return err
+	}
+	coll, err := backendsCollection()
+	if err != nil {
+		return err
+	}
+	defer coll.Close()
+	n, err := coll.Find(bson.M{"router": r.routerName, "cnames": cname}).Count()
+	if err != nil {
+		return err
+	}
+	if n > 0 {
+		return router.ErrCNameExists
+	}
+	update := bson.M{"$addToSet": bson.M{"cnames": cname}}
+	err = r.updateBackend(usedName, nil, update, router.ErrBackendNotFound)
+	if err != nil {
+		return err
+	}
+	return r.changed("set-cname")
+}
+
+func (r *fileRouter) UnsetCName(cname, name string) (err error) {
+	done := router.InstrumentRequest(r.routerName)
+	defer func() {
+		done(err)
+	}()
+	usedName, err := router.Retrieve(name)
+	if err != nil {
+		return err
+	}
+	update := bson.M{"$pull": bson.M{"cnames": cname}}
+	err = r.updateBackend(usedName, bson.M{"cnames": cname}, update, router.ErrCNameNotFound)
+	if err != nil {
+		return err
+	}
+	return r.changed("unset-cname")
+}
+
+func (r *fileRouter) CNames(name string) (urls []*url.URL, err error) {
+	done := router.InstrumentRequest(r.routerName)
+	defer func() {
+		done(err)
+	}()
+	usedName, err := router.Retrieve(name)
+	if err != nil {
+		return nil, err
+	}
+	b, err := r.findBackend(usedName)
+	if err != nil {
+		return nil, err
+	}
+	urls = make([]*url.URL, len(b.CNames))
+	for i, cname := range b.CNames {
+		urls[i] = &url.URL{Host: cname}
+	}
+	return urls, nil
+}
+
+func (r *fileRouter) AddCertificate(app router.App, cname, certificate, key string) (err error) {
+	done := router.InstrumentRequest(r.routerName)
+	defer func() {
+		done(err)
+	}()
+	usedName, err := router.Retrieve(app.GetName())
+	if err != nil {
+		return err
+	}
+	update := bson.M{"$pull": bson.M{"certificates": bson.M{"cname": cname}}}
+	err = r.updateBackend(usedName, nil, update, router.ErrBackendNotFound)
+	if err != nil {
+		return err
+	}
+	update = bson.M{"$push": bson.M{"certificates": backendCertificate{CName: cname, Certificate: certificate, Key: key}}}
+	err = r.updateBackend(usedName, nil, update, router.ErrBackendNotFound)
+	if err != nil {
+		return err
+	}
+	return r.changed("add-certificate")
+}
+
+func (r *fileRouter) RemoveCertificate(app router.App, cname string) (err error) {
+	done := router.InstrumentRequest(r.routerName)
+	defer func() {
+		done(err)
+	}()
+	usedName, err := router.Retrieve(app.GetName())
+	if err != nil {
+		return err
+	}
+	update := bson.M{"$pull": bson.M{"certificates": bson.M{"cname": cname}}}
+	err = r.updateBackend(usedName, bson.M{"certificates.cname": cname}, update, router.ErrCertificateNotFound)
+	if err != nil {
+		return err
+	}
+	err = r.changed("remove-certificate")
+	if err != nil {
+		return err
+	}
+	err = os.Remove(r.certificateFile(cname))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+func (r *fileRouter) GetCertificate(app router.App, cname string) (cert string, err error) {
+	done := router.InstrumentRequest(r.routerName)
+	defer func() {
+		done(err)
+	}()
+	usedName, err := router.Retrieve(app.GetName())
+	if err != nil {
+		return "", err
+	}
+	b, err := r.findBackend(usedName)
+	if err != nil {
+		return "", err
+	}
+	for _, c := range b.Certificates {
+		if c.CName == cname {
+			return c.Certificate, nil
+		}
+	}
+	return "", router.ErrCertificateNotFound
+}
+
+func (r *fileRouter) SetAccessControl(name string, ac router.AccessControl) (err error) {
+	done := router.InstrumentRequest(r.routerName)
+	defer func() {
+		done(err)
+	}()
+	usedName, err := router.Retrieve(name)
+	if err != nil {
+		return err
+	}
+	update := bson.M{"$set": bson.M{"accesscontrol": ac}}
+	err = r.updateBackend(usedName, nil, update, router.ErrBackendNotFound)
+	if err != nil {
+		return err
+	}
+	return r.changed("set-access-control")
+}
+
+// OptsSchema returns an empty schema, as backends in the file router accept
+// no options besides the access control ones.
+func (r *fileRouter) OptsSchema() router.OptsSchema {
+	return router.OptsSchema{}
+}
+
+func (r *fileRouter) GetAccessControl(name string) (ac router.AccessControl, err error) {
+	done := router.InstrumentRequest(r.routerName)
+	defer func() {
+		done(err)
+	}()
+	usedName, err := router.Retrieve(name)
+	if err != nil {
+		return ac, err
+	}
+	b, err := r.findBackend(usedName)
+	if err != nil {
+		return ac, err
+	}
+	return b.AccessControl, nil
+}
+
+func (r *fileRouter) AddPathRoutes(name, path string, addresses []*url.URL) (err error) {
+	done := router.InstrumentRequest(r.routerName)
+	defer func() {
+		done(err)
+	}()
+	usedName, err := router.Retrieve(name)
+	if err != nil {
+		return err
+	}
+	routes := make([]string, len(addresses))
+	for i, addr := range addresses {
+		routes[i] = addr.String()
+	}
+	update := bson.M{"$addToSet": bson.M{"paths.$.routes": bson.M{"$each": routes}}}
+	err = r.updateBackend(usedName, bson.M{"paths.path": path}, update, router.ErrPathNotFound)
+	if err == router.ErrPathNotFound {
+		update = bson.M{"$push": bson.M{"paths": backendPath{Path: path, Routes: routes}}}
+		err = r.updateBackend(usedName, bson.M{"paths.path": bson.M{"$ne": path}}, update, router.ErrBackendNotFound)
+	}
+	if err != nil {
+		return err
+	}
+	return r.changed("add-path-routes")
+}
+
+func (r *fileRouter) RemovePathRoutes(name, path string, addresses []*url.URL) (err error) {
+	done := router.InstrumentRequest(r.routerName)
+	defer func() {
+		done(err)
+	}()
+	usedName, err := router.Retrieve(name)
+	if err != nil {
+		return err
+	}
+	routes := make([]string, len(addresses))
+	for i, addr := range addresses {
+		routes[i] = addr.String()
+	}
+	update := bson.M{"$pullAll": bson.M{"paths.$.routes": routes}}
+	err = r.updateBackend(usedName, bson.M{"paths.path": path}, update, router.ErrPathNotFound)
+	if err != nil {
+		return err
+	}
+	return r.changed("remove-path-routes")
+}
+
+func (r *fileRouter) RemovePath(name, path string) (err error) {
+	done := router.InstrumentRequest(r.routerName)
+	defer func() {
+		done(err)
+	}()
+	usedName, err := router.Retrieve(name)
+	if err != nil {
+		return err
+	}
+	update := bson.M{"$pull": bson.M{"paths": bson.M{"path": path}}}
+	err = r.updateBackend(usedName, bson.M{"paths.path": path}, update, router.ErrPathNotFound)
+	if err != nil {
+		return err
+	}
+	return r.changed("remove-path")
+}
+
+func (r *fileRouter) PathRoutes(name string) (paths map[string][]*url.URL, err error) {
+	done := router.InstrumentRequest(r.routerName)
+	defer func() {
+		done(err)
+	}()
+	usedName, err := router.Retrieve(name)
+	if err != nil {
+		return nil, err
+	}
+	b, err := r.findBackend(usedName)
+	if err != nil {
+		return nil, err
+	}
+	paths = make(map[string][]*url.URL, len(b.Paths))
+	for _, p := range b.Paths {
+		routes := make([]*url.URL, len(p.Routes))
+		for i, route := range p.Routes {
+			routes[i], err = url.Parse(route)
+			if err != nil {
+				return nil, err
+			}
+		}
+		paths[p.Path] = routes
+	}
+	return paths, nil
+}
+
+func (r *fileRouter) SetRoutesWeight(name string, addresses []*url.URL, weight int) (err error) {
+	done := router.InstrumentRequest(r.routerName)
+	defer func() {
+		done(err)
+	}()
+	if weight < 0 || weight > 100 {
+		return errors.Errorf("invalid weight %d, it must be between 0 and 100", weight)
+	}
+	usedName, err := router.Retrieve(name)
+	if err != nil {
+		return err
+	}
+	b, err := r.findBackend(usedName)
+	if err != nil {
+		return err
+	}
+	existing := map[string]bool{}
+	for _, route := range b.Routes {
+		existing[route] = true
+	}
+	routes := make([]string, len(addresses))
+	for i, addr := range addresses {
+		routes[i] = addr.String()
+		if !existing[routes[i]] {
+			return errors.Errorf("route %s not found in backend %s", routes[i], usedName)
+		}
+	}
+	update := bson.M{"$set": bson.M{"weightedroutes": routes, "weight": weight}}
+	err = r.updateBackend(usedName, nil, update, router.ErrBackendNotFound)
+	if err != nil {
+		return err
+	}
+	return r.changed("set-routes-weight")
+}
+
+func (r *fileRouter) RemoveRoutesWeight(name string) (err error) {
+	done := router.InstrumentRequest(r.routerName)
+	defer func() {
+		done(err)
+	}()
+	usedName, err := router.Retrieve(name)
+	if err != nil {
+		return err
+	}
+	update := bson.M{"$unset": bson.M{"weightedroutes": "", "weight": ""}}
+	err = r.updateBackend(usedName, nil, update, router.ErrBackendNotFound)
+	if err != nil {
+		return err
+	}
+	return r.changed("remove-routes-weight")
+}
+
+func (r *fileRouter) StartupMessage() (string, error) {
+	return fmt.Sprintf("%s router %q writing routes to %q.", r.routerType, r.domain, r.configFile), nil
+}
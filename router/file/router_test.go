@@ -0,0 +1,653 @@
+// Copyright 2018 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package file
+
+import (
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/globalsign/mgo/bson"
+	"github.com/tsuru/config"
+	"github.com/tsuru/tsuru/db"
+	"github.com/tsuru/tsuru/db/dbtest"
+	"github.com/tsuru/tsuru/router"
+	"github.com/tsuru/tsuru/router/routertest"
+	"gopkg.in/check.v1"
+)
+
+func Test(t *testing.T) {
+	check.TestingT(t)
+}
+
+type S struct {
+	conn *db.Storage
+	dir  string
+}
+
+var _ = check.Suite(&S{})
+
+func init() {
+	base := &S{}
+	suite := &routertest.RouterSuite{
+		SetUpSuiteFunc:   base.SetUpSuite,
+		TearDownTestFunc: base.TearDownTest,
+	}
+	suite.SetUpTestFunc = func(c *check.C) {
+		config.Set("database:name", "router_generic_file_tests")
+		base.SetUpTest(c)
+		r, err := router.Get("nginx")
+		c.Assert(err, check.IsNil)
+		suite.Router = r
+	}
+	check.Suite(suite)
+}
+
+func (s *S) SetUpSuite(c *check.C) {
+	config.Set("log:disable-syslog", true)
+	config.Set("database:url", "127.0.0.1:27017?maxPoolSize=100")
+	config.Set("database:name", "router_file_tests")
+}
+
+func (s *S) SetUpTest(c *check.C) {
+	var err error
+	s.conn, err = db.Conn()
+	c.Assert(err, check.IsNil)
+	dbtest.ClearAllCollections(s.conn.Apps().Database)
+	s.dir = c.MkDir()
+	for _, routerType := range []string{"nginx", "haproxy"} {
+		config.Set("routers:"+routerType+":type", routerType)
+		config.Set("routers:"+routerType+":domain", routerType+".example.com")
+		config.Set("routers:"+routerType+":config-file", filepath.Join(s.dir, routerType+".conf"))
+		config.Set("routers:"+routerType+":reload-command", "touch "+filepath.Join(s.dir, routerType+".reloaded"))
+	}
+}
+
+func (s *S) TearDownTest(c *check.C) {
+	for _, routerType := range []string{"nginx", "haproxy"} {
+		config.Unset("routers:" + routerType + ":template")
+		config.Unset("routers:" + routerType + ":check-command")
+		config.Unset("routers:" + routerType + ":port-range")
+	}
+	s.conn.Close()
+}
+
+func (s *S) TearDownSuite(c *check.C) {
+	conn, err := db.Conn()
+	c.Assert(err, check.IsNil)
+	defer conn.Close()
+	conn.Apps().Database.DropDatabase()
+}
+
+func (s *S) readFile(c *check.C, name string) string {
+	data, err := ioutil.ReadFile(filepath.Join(s.dir, name))
+	c.Assert(err, check.IsNil)
+	return string(data)
+}
+
+func (s *S) addBackend(c *check.C, r router.Router, name string, routes ...string) {
+	err := r.AddBackend(routertest.FakeApp{Name: name})
+	c.Assert(err, check.IsNil)
+	var addrs []*url.URL
+	for _, route := range routes {
+		addr, err := url.Parse(route)
+		c.Assert(err, check.IsNil)
+		addrs = append(addrs, addr)
+	}
+	err = r.AddRoutes(name, addrs)
+	c.Assert(err, check.IsNil)
+}
+
+func (s *S) TestRenderNginx(c *check.C) {
+	r, err := router.Get("nginx")
+	c.Assert(err, check.IsNil)
+	s.addBackend(c, r, "myapp", "http://10.0.0.1:8080", "http://10.0.0.2:8080")
+	s.addBackend(c, r, "other-app")
+	err = r.(router.CNameRouter).SetCName("myapp.io", "myapp")
+	c.Assert(err, check.IsNil)
+	err = r.(router.TLSRouter).AddCertificate(routertest.FakeApp{Name: "myapp"}, "myapp.io", "CERT", "KEY")
+	c.Assert(err, check.IsNil)
+	certFile := filepath.Join(s.dir, "certificates", "myapp.io.pem")
+	c.Assert(s.readFile(c, "nginx.conf"), check.Equals, `# This file is generated by tsuru, do not edit it.
+
+upstream tsuru_myapp {
+    server 10.0.0.1:8080;
+    server 10.0.0.2:8080;
+}
+
+server {
+    listen 80;
+    server_name myapp.nginx.example.com;
+    location / {
+        proxy_set_header Host $host;
+        proxy_set_header X-Forwarded-For $proxy_add_x_forwarded_for;
+        proxy_pass http://tsuru_myapp;
+    }
+}
+
+server {
+    listen 80;
+    listen 443 ssl;
+    ssl_certificate `+certFile+`;
+    ssl_certificate_key `+certFile+`;
+    server_name myapp.io;
+    location / {
+        proxy_set_header Host $host;
+        proxy_set_header X-Forwarded-For $proxy_add_x_forwarded_for;
+        proxy_pass http://tsuru_myapp;
+    }
+}
+
+server {
+    listen 80;
+    server_name other-app.nginx.example.com;
+    location / {
+        return 503;
+    }
+}
+`)
+	c.Assert(s.readFile(c, "certificates/myapp.io.pem"), check.Equals, "CERT\nKEY\n")
+	_, err = os.Stat(filepath.Join(s.dir, "nginx.reloaded"))
+	c.Assert(err, check.IsNil)
+}
+
+func (s *S) TestRenderHAProxy(c *check.C) {
+	r, err := router.Get("haproxy")
+	c.Assert(err, check.IsNil)
+	s.addBackend(c, r, "myapp", "http://10.0.0.1:8080", "http://10.0.0.2:8080")
+	err = r.(router.CNameRouter).SetCName("myapp.io", "myapp")
+	c.Assert(err, check.IsNil)
+	err = r.(router.TLSRouter).AddCertificate(routertest.FakeApp{Name: "myapp"}, "myapp.io", "CERT", "KEY")
+	c.Assert(err, check.IsNil)
+	c.Assert(s.readFile(c, "haproxy.conf"), check.Equals, `# This file is generated by tsuru, do not edit it.
+
+frontend tsuru
+    mode http
+    bind *:80
+    bind *:443 ssl crt `+filepath.Join(s.dir, "certificates")+`
+    use_backend tsuru_myapp if { hdr(host) -i myapp.haproxy.example.com }
+    use_backend tsuru_myapp if { hdr(host) -i myapp.io }
+
+backend tsuru_myapp
+    mode http
+    server route0 10.0.0.1:8080
+    server route1 10.0.0.2:8080
+`)
+}
+
+func (s *S) TestRenderCustomTemplate(c *check.C) {
+	tplFile := filepath.Join(s.dir, "custom.tpl")
+	err := ioutil.WriteFile(tplFile, []byte(`{{range .Backends}}{{.Name}}:{{range .Routes}} {{.}}{{end}}
+{{end}}`), 0644)
+	c.Assert(err, check.IsNil)
+	config.Set("routers:nginx:template", tplFile)
+	r, err := router.Get("nginx")
+	c.Assert(err, check.IsNil)
+	s.addBackend(c, r, "myapp", "http://10.0.0.1:8080")
+	s.addBackend(c, r, "other", "http://10.0.0.2:8080")
+	c.Assert(s.readFile(c, "nginx.conf"), check.Equals, "myapp: 10.0.0.1:8080\nother: 10.0.0.2:8080\n")
+}
+
+func (s *S) TestRenderCheckCommandFailure(c *check.C) {
+	r, err := router.Get("nginx")
+	c.Assert(err, check.IsNil)
+	s.addBackend(c, r, "myapp", "http://10.0.0.1:8080")
+	original := s.readFile(c, "nginx.conf")
+	config.Set("routers:nginx:check-command", "false")
+	r, err = router.Get("nginx")
+	c.Assert(err, check.IsNil)
+	addr, _ := url.Parse("http://10.0.0.2:8080")
+	err = r.AddRoutes("myapp", []*url.URL{addr})
+	c.Assert(err, check.ErrorMatches, `\[router add-routes\] error running "false .*nginx.conf.*": exit status 1: `)
+	c.Assert(s.readFile(c, "nginx.conf"), check.Equals, original)
+	files, err := filepath.Glob(filepath.Join(s.dir, "nginx.conf.*"))
+	c.Assert(err, check.IsNil)
+	c.Assert(files, check.HasLen, 0)
+}
+
+func (s *S) TestRemoveCertificate(c *check.C) {
+	r, err := router.Get("nginx")
+	c.Assert(err, check.IsNil)
+	a := routertest.FakeApp{Name: "myapp"}
+	s.addBackend(c, r, a.Name)
+	tlsRouter := r.(router.TLSRouter)
+	err = tlsRouter.AddCertificate(a, "myapp.nginx.example.com", "CERT", "KEY")
+	c.Assert(err, check.IsNil)
+	cert, err := tlsRouter.GetCertificate(a, "myapp.nginx.example.com")
+	c.Assert(err, check.IsNil)
+	c.Assert(cert, check.Equals, "CERT")
+	err = tlsRouter.RemoveCertificate(a, "myapp.nginx.example.com")
+	c.Assert(err, check.IsNil)
+	_, err = os.Stat(filepath.Join(s.dir, "certificates", "myapp.nginx.example.com.pem"))
+	c.Assert(os.IsNotExist(err), check.Equals, true)
+	_, err = tlsRouter.GetCertificate(a, "myapp.nginx.example.com")
+	c.Assert(err, check.Equals, router.ErrCertificateNotFound)
+	err = tlsRouter.RemoveCertificate(a, "myapp.nginx.example.com")
+	c.Assert(err, check.Equals, router.ErrCertificateNotFound)
+}
+
+func (s *S) TestRenderNginxAccessControl(c *check.C) {
+	r, err := router.Get("nginx")
+	c.Assert(err, check.IsNil)
+	s.addBackend(c, r, "myapp", "http://10.0.0.1:8080")
+	ac := router.AccessControl{
+		RateLimit:      10,
+		RateLimitBurst: 5,
+		Allow:          []string{"10.0.0.0/8"},
+		Deny:           []string{"10.1.0.0/16"},
+	}
+	err = r.(router.AccessControlRouter).SetAccessControl("myapp", ac)
+	c.Assert(err, check.IsNil)
+	c.Assert(s.readFile(c, "nginx.conf"), check.Equals, `# This file is generated by tsuru, do not edit it.
+
+limit_req_zone $binary_remote_addr zone=tsuru_myapp:10m rate=10r/s;
+
+upstream tsuru_myapp {
+    server 10.0.0.1:8080;
+}
+
+server {
+    listen 80;
+    server_name myapp.nginx.example.com;
+    location / {
+        limit_req zone=tsuru_myapp burst=5 nodelay;
+        limit_req_status 429;
+        deny 10.1.0.0/16;
+        allow 10.0.0.0/8;
+        deny all;
+        proxy_set_header Host $host;
+        proxy_set_header X-Forwarded-For $proxy_add_x_forwarded_for;
+        proxy_pass http://tsuru_myapp;
+    }
+}
+`)
+	result, err := r.(router.AccessControlRouter).GetAccessControl("myapp")
+	c.Assert(err, check.IsNil)
+	c.Assert(result, check.DeepEquals, ac)
+}
+
+func (s *S) TestValidateOpts(c *check.C) {
+	r, err := router.Get("nginx")
+	c.Assert(err, check.IsNil)
+	err = router.ValidateOpts(r, map[string]string{"rate-limit": "10", "allow-cidrs": "10.0.0.0/8"})
+	c.Assert(err, check.IsNil)
+	err = router.ValidateOpts(r, map[string]string{"other": "value"})
+	c.Assert(err, check.ErrorMatches, `invalid option "other" for router "nginx": unknown option`)
+}
+
+func (s *S) TestRenderHAProxyAccessControl(c *check.C) {
+	r, err := router.Get("haproxy")
+	c.Assert(err, check.IsNil)
+	s.addBackend(c, r, "myapp", "http://10.0.0.1:8080")
+	err = r.(router.AccessControlRouter).SetAccessControl("myapp", router.AccessControl{
+		RateLimit:      10,
+		RateLimitBurst: 5,
+		Allow:          []string{"10.0.0.0/8", "192.168.0.0/16"},
+		Deny:           []string{"10.1.0.0/16"},
+	})
+	c.Assert(err, check.IsNil)
+	c.Assert(s.readFile(c, "haproxy.conf"), check.Equals, `# This file is generated by tsuru, do not edit it.
+
+frontend tsuru
+    mode http
+    bind *:80
+    use_backend tsuru_myapp if { hdr(host) -i myapp.haproxy.example.com }
+
+backend tsuru_myapp
+    mode http
+    stick-table type ip size 100k expire 10s store http_req_rate(1s)
+    http-request deny if { src 10.1.0.0/16 }
+    http-request deny if !{ src 10.0.0.0/8 192.168.0.0/16 }
+    http-request track-sc0 src table tsuru_myapp
+    http-request deny deny_status 429 if { sc_http_req_rate(0) gt 15 }
+    server route0 10.0.0.1:8080
+`)
+}
+
+func (s *S) TestAccessControlBackendNotFound(c *check.C) {
+	r, err := router.Get("nginx")
+	c.Assert(err, check.IsNil)
+	acRouter := r.(router.AccessControlRouter)
+	err = acRouter.SetAccessControl("myapp", router.AccessControl{RateLimit: 10})
+	c.Assert(err, check.Equals, router.ErrBackendNotFound)
+	_, err = acRouter.GetAccessControl("myapp")
+	c.Assert(err, check.Equals, router.ErrBackendNotFound)
+}
+
+func (s *S) TestRenderNginxPaths(c *check.C) {
+	r, err := router.Get("nginx")
+	c.Assert(err, check.IsNil)
+	s.addBackend(c, r, "myapp", "http://10.0.0.1:8080")
+	pathRouter := r.(router.PathRouter)
+	addr, err := url.Parse("http://10.0.0.2:8080")
+	c.Assert(err, check.IsNil)
+	err = pathRouter.AddPathRoutes("myapp", "/api", []*url.URL{addr})
+	c.Assert(err, check.IsNil)
+	err = pathRouter.AddPathRoutes("myapp", "/static", nil)
+	c.Assert(err, check.IsNil)
+	c.Assert(s.readFile(c, "nginx.conf"), check.Equals, `# This file is generated by tsuru, do not edit it.
+
+upstream tsuru_myapp {
+    server 10.0.0.1:8080;
+}
+
+upstream tsuru_myapp_path0 {
+    server 10.0.0.2:8080;
+}
+
+server {
+    listen 80;
+    server_name myapp.nginx.example.com;
+    location / {
+        proxy_set_header Host $host;
+        proxy_set_header X-Forwarded-For $proxy_add_x_forwarded_for;
+        proxy_pass http://tsuru_myapp;
+    }
+    location /static {
+        return 503;
+    }
+    location /api {
+        proxy_set_header Host $host;
+        proxy_set_header X-Forwarded-For $proxy_add_x_forwarded_for;
+        proxy_pass http://tsuru_myapp_path0;
+    }
+}
+`)
+}
+
+func (s *S) TestRenderHAProxyPaths(c *check.C) {
+	r, err := router.Get("haproxy")
+	c.Assert(err, check.IsNil)
+	s.addBackend(c, r, "myapp", "http://10.0.0.1:8080")
+	pathRouter := r.(router.PathRouter)
+	addr, err := url.Parse("http://10.0.0.2:8080")
+	c.Assert(err, check.IsNil)
+	err = pathRouter.AddPathRoutes("myapp", "/api", []*url.URL{addr})
+	c.Assert(err, check.IsNil)
+	err = pathRouter.AddPathRoutes("myapp", "/api/v2", []*url.URL{addr})
+	c.Assert(err, check.IsNil)
+	c.Assert(s.readFile(c, "haproxy.conf"), check.Equals, `# This file is generated by tsuru, do not edit it.
+
+frontend tsuru
+    mode http
+    bind *:80
+    use_backend tsuru_myapp_path1 if { hdr(host) -i myapp.haproxy.example.com } { path_beg /api/v2 }
+    use_backend tsuru_myapp_path0 if { hdr(host) -i myapp.haproxy.example.com } { path_beg /api }
+    use_backend tsuru_myapp if { hdr(host) -i myapp.haproxy.example.com }
+
+backend tsuru_myapp
+    mode http
+    server route0 10.0.0.1:8080
+
+backend tsuru_myapp_path1
+    mode http
+    server route0 10.0.0.2:8080
+
+backend tsuru_myapp_path0
+    mode http
+    server route0 10.0.0.2:8080
+`)
+	err = pathRouter.RemovePath("myapp", "/api/v2")
+	c.Assert(err, check.IsNil)
+	paths, err := pathRouter.PathRoutes("myapp")
+	c.Assert(err, check.IsNil)
+	c.Assert(paths, check.DeepEquals, map[string][]*url.URL{"/api": {addr}})
+}
+
+func (s *S) TestRenderNginxWeights(c *check.C) {
+	r, err := router.Get("nginx")
+	c.Assert(err, check.IsNil)
+	s.addBackend(c, r, "myapp", "http://10.0.0.1:8080", "http://10.0.0.2:8080", "http://10.0.0.3:8080")
+	weightedRouter := r.(router.WeightedRouter)
+	addr, err := url.Parse("http://10.0.0.3:8080")
+	c.Assert(err, check.IsNil)
+	err = weightedRouter.SetRoutesWeight("myapp", []*url.URL{addr}, 20)
+	c.Assert(err, check.IsNil)
+	c.Assert(s.readFile(c, "nginx.conf"), check.Matches, `(?s).*upstream tsuru_myapp {
+    server 10.0.0.1:8080 weight=2;
+    server 10.0.0.2:8080 weight=2;
+    server 10.0.0.3:8080 weight=1;
+}.*`)
+	err = weightedRouter.RemoveRoutesWeight("myapp")
+	c.Assert(err, check.IsNil)
+	c.Assert(s.readFile(c, "nginx.conf"), check.Matches, `(?s).*upstream tsuru_myapp {
+    server 10.0.0.1:8080;
+    server 10.0.0.2:8080;
+    server 10.0.0.3:8080;
+}.*`)
+}
+
+func (s *S) TestRenderHAProxyWeights(c *check.C) {
+	r, err := router.Get("haproxy")
+	c.Assert(err, check.IsNil)
+	s.addBackend(c, r, "myapp", "http://10.0.0.1:8080", "http://10.0.0.2:8080")
+	addr, err := url.Parse("http://10.0.0.2:8080")
+	c.Assert(err, check.IsNil)
+	err = r.(router.WeightedRouter).SetRoutesWeight("myapp", []*url.URL{addr}, 10)
+	c.Assert(err, check.IsNil)
+	c.Assert(s.readFile(c, "haproxy.conf"), check.Equals, `# This file is generated by tsuru, do not edit it.
+
+frontend tsuru
+    mode http
+    bind *:80
+    use_backend tsuru_myapp if { hdr(host) -i myapp.haproxy.example.com }
+
+backend tsuru_myapp
+    mode http
+    server route0 10.0.0.1:8080 weight 9
+    server route1 10.0.0.2:8080 weight 1
+`)
+	err = r.RemoveRoutes("myapp", []*url.URL{addr})
+	c.Assert(err, check.IsNil)
+	b, err := r.(*fileRouter).findBackend("myapp")
+	c.Assert(err, check.IsNil)
+	c.Assert(b.WeightedRoutes, check.HasLen, 0)
+}
+
+func (s *S) TestSetRoutesWeightRouteNotFound(c *check.C) {
+	r, err := router.Get("nginx")
+	c.Assert(err, check.IsNil)
+	s.addBackend(c, r, "myapp", "http://10.0.0.1:8080")
+	addr, err := url.Parse("http://10.0.0.2:8080")
+	c.Assert(err, check.IsNil)
+	err = r.(router.WeightedRouter).SetRoutesWeight("myapp", []*url.URL{addr}, 10)
+	c.Assert(err, check.ErrorMatches, `route http://10.0.0.2:8080 not found in backend myapp`)
+	err = r.(router.WeightedRouter).SetRoutesWeight("myapp", nil, 101)
+	c.Assert(err, check.ErrorMatches, `invalid weight 101, it must be between 0 and 100`)
+}
+
+func (s *S) TestWeightedRoutesScaled(c *check.C) {
+	b := backend{
+		Routes:         []string{"http://a:1", "http://b:1", "http://c:1", "http://d:1", "http://e:1", "http://f:1", "http://g:1"},
+		WeightedRoutes: []string{"http://g:1"},
+		Weight:         51,
+	}
+	routes, err := weightedRoutes(b)
+	c.Assert(err, check.IsNil)
+	c.Assert(routes, check.HasLen, 7)
+	c.Assert(routes[0], check.Equals, templateRoute{Host: "a:1", Weight: 41})
+	c.Assert(routes[6], check.Equals, templateRoute{Host: "g:1", Weight: 256})
+	b.Weight = 0
+	routes, err = weightedRoutes(b)
+	c.Assert(err, check.IsNil)
+	c.Assert(routes, check.HasLen, 6)
+	c.Assert(routes[0], check.Equals, templateRoute{Host: "a:1", Weight: 1})
+}
+
+func (s *S) TestRenderCheckCommandFailureRestoresCertificates(c *check.C) {
+	r, err := router.Get("nginx")
+	c.Assert(err, check.IsNil)
+	a := routertest.FakeApp{Name: "myapp"}
+	s.addBackend(c, r, a.Name, "http://10.0.0.1:8080")
+	err = r.(router.TLSRouter).AddCertificate(a, "myapp.nginx.example.com", "CERT", "KEY")
+	c.Assert(err, check.IsNil)
+	config.Set("routers:nginx:check-command", "false")
+	r, err = router.Get("nginx")
+	c.Assert(err, check.IsNil)
+	err = r.(router.TLSRouter).AddCertificate(a, "myapp.nginx.example.com", "NEWCERT", "NEWKEY")
+	c.Assert(err, check.NotNil)
+	err = r.(router.TLSRouter).AddCertificate(a, "other.nginx.example.com", "CERT", "KEY")
+	c.Assert(err, check.NotNil)
+	c.Assert(s.readFile(c, filepath.Join("certificates", "myapp.nginx.example.com.pem")), check.Equals, "CERT\nKEY\n")
+	_, err = os.Stat(filepath.Join(s.dir, "certificates", "other.nginx.example.com.pem"))
+	c.Assert(os.IsNotExist(err), check.Equals, true)
+}
+
+func (s *S) TestRenderUnchangedSkipsReload(c *check.C) {
+	r, err := router.Get("nginx")
+	c.Assert(err, check.IsNil)
+	s.addBackend(c, r, "myapp", "http://10.0.0.1:8080")
+	reloaded := filepath.Join(s.dir, "nginx.reloaded")
+	err = os.Remove(reloaded)
+	c.Assert(err, check.IsNil)
+	fileRouter := r.(*fileRouter)
+	revision, err := fileRouter.bumpRevision()
+	c.Assert(err, check.IsNil)
+	err = fileRouter.render(revision)
+	c.Assert(err, check.IsNil)
+	_, err = os.Stat(reloaded)
+	c.Assert(os.IsNotExist(err), check.Equals, true)
+}
+
+func (s *S) TestSyncRendersChangesFromOtherInstances(c *check.C) {
+	r, err := router.Get("nginx")
+	c.Assert(err, check.IsNil)
+	s.addBackend(c, r, "myapp", "http://10.0.0.1:8080")
+	coll, err := backendsCollection()
+	c.Assert(err, check.IsNil)
+	defer coll.Close()
+	err = coll.Insert(backend{Router: "nginx", Name: "other", Routes: []string{"http://10.0.0.2:8080"}})
+	c.Assert(err, check.IsNil)
+	fileRouter := r.(*fileRouter)
+	fileSyncer := &syncer{router: fileRouter}
+	fileSyncer.sync()
+	c.Assert(s.readFile(c, "nginx.conf"), check.Not(check.Matches), `(?s).*10\.0\.0\.2:8080.*`)
+	_, err = fileRouter.bumpRevision()
+	c.Assert(err, check.IsNil)
+	fileSyncer.sync()
+	c.Assert(s.readFile(c, "nginx.conf"), check.Matches, `(?s).*10\.0\.0\.2:8080.*`)
+}
+
+func (s *S) TestLockRender(c *check.C) {
+	r, err := router.Get("nginx")
+	c.Assert(err, check.IsNil)
+	fileRouter := r.(*fileRouter)
+	unlock, err := fileRouter.lockRender()
+	c.Assert(err, check.IsNil)
+	coll, err := stateCollection()
+	c.Assert(err, check.IsNil)
+	defer coll.Close()
+	var state routerState
+	err = coll.FindId("nginx").One(&state)
+	c.Assert(err, check.IsNil)
+	c.Assert(state.LockedBy, check.Not(check.Equals), "")
+	unlock()
+	err = coll.FindId("nginx").One(&state)
+	c.Assert(err, check.IsNil)
+	c.Assert(state.LockedBy, check.Equals, "")
+	err = coll.UpdateId("nginx", bson.M{"$set": bson.M{"lockedby": "other", "lockeduntil": time.Now().Add(-time.Second)}})
+	c.Assert(err, check.IsNil)
+	unlock, err = fileRouter.lockRender()
+	c.Assert(err, check.IsNil)
+	unlock()
+}
+
+func (s *S) TestRenderHAProxyPorts(c *check.C) {
+	config.Set("routers:haproxy:port-range", "10000-10001")
+	r, err := router.Get("haproxy")
+	c.Assert(err, check.IsNil)
+	s.addBackend(c, r, "myapp")
+	s.addBackend(c, r, "other-app")
+	l4Router, ok := r.(router.L4Router)
+	c.Assert(ok, check.Equals, true)
+	addr1, err := url.Parse("tcp://10.0.0.1:1883")
+	c.Assert(err, check.IsNil)
+	addr2, err := url.Parse("tcp://10.0.0.2:1883")
+	c.Assert(err, check.IsNil)
+	err = l4Router.AddPortRoutes("myapp", router.L4Port{Name: "mqtt", Protocol: "tcp"}, []*url.URL{addr1, addr2})
+	c.Assert(err, check.IsNil)
+	err = r.(router.AccessControlRouter).SetAccessControl("other-app", router.AccessControl{Allow: []string{"10.0.0.0/8"}})
+	c.Assert(err, check.IsNil)
+	err = l4Router.AddPortRoutes("other-app", router.L4Port{Name: "grpc-api", Protocol: "grpc"}, []*url.URL{addr1})
+	c.Assert(err, check.IsNil)
+	c.Assert(s.readFile(c, "haproxy.conf"), check.Equals, `# This file is generated by tsuru, do not edit it.
+
+frontend tsuru
+    mode http
+    bind *:80
+    use_backend tsuru_myapp if { hdr(host) -i myapp.haproxy.example.com }
+    use_backend tsuru_other_app if { hdr(host) -i other-app.haproxy.example.com }
+
+backend tsuru_myapp
+    mode http
+
+backend tsuru_other_app
+    mode http
+    http-request deny if !{ src 10.0.0.0/8 }
+
+frontend tsuru_myapp_port_mqtt
+    mode tcp
+    bind *:10000
+    default_backend tsuru_myapp_port_mqtt
+
+backend tsuru_myapp_port_mqtt
+    mode tcp
+    server route0 10.0.0.1:1883
+    server route1 10.0.0.2:1883
+
+frontend tsuru_other_app_port_grpc_api
+    mode tcp
+    bind *:10001
+    tcp-request connection reject if !{ src 10.0.0.0/8 }
+    default_backend tsuru_other_app_port_grpc_api
+
+backend tsuru_other_app_port_grpc_api
+    mode tcp
+    server route0 10.0.0.1:1883
+`)
+	ports, err := l4Router.PortRoutes("myapp")
+	c.Assert(err, check.IsNil)
+	c.Assert(ports, check.DeepEquals, []router.L4Route{{
+		L4Port:  router.L4Port{Name: "mqtt", Protocol: "tcp"},
+		Address: "myapp.haproxy.example.com:10000",
+		Routes:  []*url.URL{addr1, addr2},
+	}})
+	err = l4Router.AddPortRoutes("myapp", router.L4Port{Name: "amqp", Protocol: "tcp"}, nil)
+	c.Assert(err, check.ErrorMatches, `.*no free port left in the range of router "haproxy"`)
+	err = l4Router.RemovePort("other-app", "grpc-api")
+	c.Assert(err, check.IsNil)
+	err = l4Router.AddPortRoutes("myapp", router.L4Port{Name: "amqp", Protocol: "tcp"}, nil)
+	c.Assert(err, check.IsNil)
+	ports, err = l4Router.PortRoutes("myapp")
+	c.Assert(err, check.IsNil)
+	c.Assert(ports, check.HasLen, 2)
+	c.Assert(ports[0].Name, check.Equals, "amqp")
+	c.Assert(ports[0].Address, check.Equals, "myapp.haproxy.example.com:10001")
+}
+
+func (s *S) TestAddPortRoutesUDP(c *check.C) {
+	config.Set("routers:haproxy:port-range", "10000-10999")
+	r, err := router.Get("haproxy")
+	c.Assert(err, check.IsNil)
+	s.addBackend(c, r, "myapp")
+	err = r.(router.L4Router).AddPortRoutes("myapp", router.L4Port{Name: "dns", Protocol: "udp"}, nil)
+	c.Assert(err, check.ErrorMatches, `router "haproxy" does not support udp ports`)
+}
+
+func (s *S) TestCreateRouterPortRange(c *check.C) {
+	r, err := router.Get("haproxy")
+	c.Assert(err, check.IsNil)
+	_, ok := r.(router.L4Router)
+	c.Assert(ok, check.Equals, false)
+	config.Set("routers:haproxy:port-range", "10000")
+	_, err = router.Get("haproxy")
+	c.Assert(err, check.ErrorMatches, `invalid config for router "haproxy": invalid port range "10000".*`)
+	config.Set("routers:nginx:port-range", "10000-10999")
+	_, err = router.Get("nginx")
+	c.Assert(err, check.ErrorMatches, `port-range is only supported by haproxy routers, router "nginx" is nginx`)
+}
@@ -0,0 +1,219 @@
+// Copyright 2018 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package file
+
+import (
+	"time"
+
+	"github.com/globalsign/mgo"
+	"github.com/globalsign/mgo/bson"
+	"github.com/pkg/errors"
+	"github.com/tsuru/tsuru/db"
+	"github.com/tsuru/tsuru/db/storage"
+	"github.com/tsuru/tsuru/log"
+	"github.com/tsuru/tsuru/router"
+)
+
+type backend struct {
+	Router        string
+	Name          string
+	Routes        []string
+	CNames        []string
+	Certificates  []backendCertificate
+	AccessControl router.AccessControl
+	Paths         []backendPath
+	// WeightedRoutes receive Weight percent of the requests sent to Routes,
+	// the other routes receiving the rest.
+	WeightedRoutes []string
+	Weight         int
+	Ports          []backendPort
+}
+
+type backendPath struct {
+	Path   string
+	Routes []string
+}
+
+// backendPort is an extra port of the backend, routed at the transport level
+// from ListenPort in the router.
+type backendPort struct {
+	Name       string
+	Protocol   string
+	ListenPort int
+	Routes     []string
+}
+
+type backendCertificate struct {
+	CName       string
+	Certificate string
+	Key         string
+}
+
+func backendsCollection() (*storage.Collection, error) {
+	conn, err := db.Conn()
+	if err != nil {
+		return nil, err
+	}
+	coll := conn.Collection("file_router_backends")
+	err = coll.EnsureIndex(mgo.Index{Key: []string{"router", "name"}, Unique: true})
+	if err != nil {
+		coll.Close()
+		return nil, errors.Wrap(err, "could not create index on db.file_router_backends")
+	}
+	return coll, nil
+}
+
+func (r *fileRouter) backendQuery(name string) bson.M {
+	return bson.M{"router": r.routerName, "name": name}
+}
+
+func (r *fileRouter) findBackend(name string) (*backend, error) {
+	coll, err := backendsCollection()
+	if err != nil {
+		return nil, err
+	}
+	defer coll.Close()
+	var b backend
+	err = coll.Find(r.backendQuery(name)).One(&b)
+	if err != nil {
+		if err == mgo.ErrNotFound {
+			return nil, router.ErrBackendNotFound
+		}
+		return nil, err
+	}
+	return &b, nil
+}
+
+func (r *fileRouter) listBackends() ([]backend, error) {
+	coll, err := backendsCollection()
+	if err != nil {
+		return nil, err
+	}
+	defer coll.Close()
+	var backends []backend
+	err = coll.Find(bson.M{"router": r.routerName}).Sort("name").All(&backends)
+	return backends, err
+}
+
+// updateBackend applies update to the backend matching name and the extra
+// query fields, returning notFoundErr when no backend matches.
+func (r *fileRouter) updateBackend(name string, query, update bson.M, notFoundErr error) error {
+	coll, err := backendsCollection()
+	if err != nil {
+		return err
+	}
+	defer coll.Close()
+	q := r.backendQuery(name)
+	for k, v := range query {
+		q[k] = v
+	}
+	err = coll.Update(q, update)
+	if err == mgo.ErrNotFound {
+		return notFoundErr
+	}
+	return err
+}
+
+// routerState holds the revision of the backends of a router, incremented on
+// each change, and the lock held while rendering its configuration file.
+type routerState struct {
+	Router      string `bson:"_id"`
+	Revision    int64
+	LockedBy    string    `bson:",omitempty"`
+	LockedUntil time.Time `bson:",omitempty"`
+}
+
+func stateCollection() (*storage.Collection, error) {
+	conn, err := db.Conn()
+	if err != nil {
+		return nil, err
+	}
+	return conn.Collection("file_router_state"), nil
+}
+
+// bumpRevision increments the revision of the router, returning the new one.
+func (r *fileRouter) bumpRevision() (int64, error) {
+	coll, err := stateCollection()
+	if err != nil {
+		return 0, err
+	}
+	defer coll.Close()
+	var state routerState
+	_, err = coll.FindId(r.routerName).Apply(mgo.Change{
+		Update:    bson.M{"$inc": bson.M{"revision": 1}},
+		Upsert:    true,
+		ReturnNew: true,
+	}, &state)
+	return state.Revision, err
+}
+
+func (r *fileRouter) currentRevision() (int64, error) {
+	coll, err := stateCollection()
+	if err != nil {
+		return 0, err
+	}
+	defer coll.Close()
+	var state routerState
+	err = coll.FindId(r.routerName).One(&state)
+	if err == mgo.ErrNotFound {
+		return 0, nil
+	}
+	return state.Revision, err
+}
+
+const (
+	renderLockTimeout = time.Minute
+	renderLockRetry   = 100 * time.Millisecond
+)
+
+// lockRender acquires the lock of the router, shared by every tsuru instance,
+// waiting up to renderLockTimeout for it. Locks not released, by instances
+// stopped while rendering, expire after renderLockTimeout.
+func (r *fileRouter) lockRender() (unlock func(), err error) {
+	coll, err := stateCollection()
+	if err != nil {
+		return nil, err
+	}
+	defer coll.Close()
+	_, err = coll.Upsert(bson.M{"_id": r.routerName}, bson.M{"$setOnInsert": bson.M{"revision": 0}})
+	if err != nil && !mgo.IsDup(err) {
+		return nil, err
+	}
+	id := bson.NewObjectId().Hex()
+	deadline := time.Now().Add(renderLockTimeout)
+	for {
+		now := time.Now().UTC()
+		err = coll.Update(bson.M{
+			"_id": r.routerName,
+			"$or": []bson.M{
+				{"lockeduntil": bson.M{"$exists": false}},
+				{"lockeduntil": bson.M{"$lt": now}},
+			},
+		}, bson.M{"$set": bson.M{"lockedby": id, "lockeduntil": now.Add(renderLockTimeout)}})
+		if err == nil {
+			break
+		}
+		if err != mgo.ErrNotFound {
+			return nil, err
+		}
+		if now.After(deadline) {
+			return nil, errors.Errorf("timeout waiting for the lock of router %q", r.routerName)
+		}
+		time.Sleep(renderLockRetry)
+	}
+	return func() {
+		coll, err := stateCollection()
+		if err == nil {
+			defer coll.Close()
+			err = coll.Update(
+				bson.M{"_id": r.routerName, "lockedby": id},
+				bson.M{"$unset": bson.M{"lockedby": "", "lockeduntil": ""}},
+			)
+		}
+		if err != nil {
+			log.Errorf("[router %s] unable to release lock: %s", r.routerName, err)
+		}
+	}, nil
+}
@@ -0,0 +1,78 @@
+// Copyright 2018 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package file
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/tsuru/tsuru/api/shutdown"
+	"github.com/tsuru/tsuru/log"
+)
+
+var (
+	syncersMu sync.Mutex
+	syncers   = map[string]*syncer{}
+)
+
+// syncer renders the configuration file of a router when its revision is
+// changed by other tsuru instances.
+type syncer struct {
+	router *fileRouter
+	done   chan bool
+}
+
+// StartSync renders the configuration file and starts keeping it in sync
+// with the backends stored in the database. It's called once, when tsuru
+// starts, failures rendering the file are logged and retried later.
+func (r *fileRouter) StartSync() error {
+	syncersMu.Lock()
+	defer syncersMu.Unlock()
+	if _, ok := syncers[r.routerName]; ok {
+		return nil
+	}
+	s := &syncer{router: r, done: make(chan bool)}
+	syncers[r.routerName] = s
+	s.sync()
+	go s.run()
+	shutdown.Register(s)
+	return nil
+}
+
+func (s *syncer) run() {
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-time.After(s.router.syncInterval):
+		}
+		s.sync()
+	}
+}
+
+func (s *syncer) sync() {
+	revision, err := s.router.currentRevision()
+	if err == nil {
+		err = s.router.render(revision)
+	}
+	if err != nil {
+		log.Errorf("[router %s] unable to sync configuration file: %s", s.router.routerName, err)
+	}
+}
+
+func (s *syncer) Shutdown(ctx context.Context) error {
+	select {
+	case s.done <- true:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (s *syncer) String() string {
+	return fmt.Sprintf("router %s sync", s.router.routerName)
+}
@@ -0,0 +1,157 @@
+// Copyright 2018 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package file
+
+const nginxTemplate = `# This file is generated by tsuru, do not edit it.
+{{- range $b := .Backends}}
+{{- if $b.AccessControl.RateLimit}}
+
+limit_req_zone $binary_remote_addr zone={{$b.ID}}:10m rate={{$b.AccessControl.RateLimit}}r/s;
+{{- end}}
+{{- if $b.Routes}}
+
+upstream {{$b.ID}} {
+{{- range $b.Routes}}
+    server {{.Host}}{{if .Weight}} weight={{.Weight}}{{end}};
+{{- end}}
+}
+{{- end}}
+{{- range $b.Paths}}
+{{- if .Routes}}
+
+upstream {{.ID}} {
+{{- range .Routes}}
+    server {{.Host}};
+{{- end}}
+}
+{{- end}}
+{{- end}}
+{{- range $b.Hosts}}
+
+server {
+    listen 80;
+{{- if .Certificate}}
+    listen 443 ssl;
+    ssl_certificate {{.Certificate}};
+    ssl_certificate_key {{.Certificate}};
+{{- end}}
+    server_name {{.Name}};
+    location / {
+{{- template "access-control" $b}}
+{{- if $b.Routes}}
+        proxy_set_header Host $host;
+        proxy_set_header X-Forwarded-For $proxy_add_x_forwarded_for;
+        proxy_pass http://{{$b.ID}};
+{{- else}}
+        return 503;
+{{- end}}
+    }
+{{- range $b.Paths}}
+    location {{.Path}} {
+{{- template "access-control" $b}}
+{{- if .Routes}}
+        proxy_set_header Host $host;
+        proxy_set_header X-Forwarded-For $proxy_add_x_forwarded_for;
+        proxy_pass http://{{.ID}};
+{{- else}}
+        return 503;
+{{- end}}
+    }
+{{- end}}
+}
+{{- end}}
+{{- end}}
+{{define "access-control"}}
+{{- with .AccessControl}}
+{{- if .RateLimit}}
+        limit_req zone={{$.ID}}{{if .RateLimitBurst}} burst={{.RateLimitBurst}} nodelay{{end}};
+        limit_req_status 429;
+{{- end}}
+{{- range .Deny}}
+        deny {{.}};
+{{- end}}
+{{- range .Allow}}
+        allow {{.}};
+{{- end}}
+{{- if .Allow}}
+        deny all;
+{{- end}}
+{{- end}}
+{{- end}}`
+
+const haproxyTemplate = `# This file is generated by tsuru, do not edit it.
+
+frontend tsuru
+    mode http
+    bind *:80
+{{- if .HasCertificates}}
+    bind *:443 ssl crt {{.CertificatesDir}}
+{{- end}}
+{{- range $b := .Backends}}
+{{- range $h := $b.Hosts}}
+{{- range $b.Paths}}
+    use_backend {{.ID}} if { hdr(host) -i {{$h.Name}} } { path_beg {{.Path}} }
+{{- end}}
+    use_backend {{$b.ID}} if { hdr(host) -i {{$h.Name}} }
+{{- end}}
+{{- end}}
+{{- range $b := .Backends}}
+
+backend {{$b.ID}}
+    mode http
+{{- if $b.AccessControl.RateLimit}}
+    stick-table type ip size 100k expire 10s store http_req_rate(1s)
+{{- end}}
+{{- template "access-control" $b}}
+{{- range $i, $route := $b.Routes}}
+    server route{{$i}} {{$route.Host}}{{if $route.Weight}} weight {{$route.Weight}}{{end}}
+{{- end}}
+{{- range $b.Paths}}
+
+backend {{.ID}}
+    mode http
+{{- template "access-control" $b}}
+{{- range $i, $route := .Routes}}
+    server route{{$i}} {{$route.Host}}
+{{- end}}
+{{- end}}
+{{- end}}
+{{- range $b := .Backends}}
+{{- range $p := $b.Ports}}
+
+frontend {{$p.ID}}
+    mode tcp
+    bind *:{{$p.ListenPort}}
+{{- with $b.AccessControl}}
+{{- if .Deny}}
+    tcp-request connection reject if { src{{range .Deny}} {{.}}{{end}} }
+{{- end}}
+{{- if .Allow}}
+    tcp-request connection reject if !{ src{{range .Allow}} {{.}}{{end}} }
+{{- end}}
+{{- end}}
+    default_backend {{$p.ID}}
+
+backend {{$p.ID}}
+    mode tcp
+{{- range $i, $route := $p.Routes}}
+    server route{{$i}} {{$route.Host}}
+{{- end}}
+{{- end}}
+{{- end}}
+{{define "access-control"}}
+{{- with .AccessControl}}
+{{- if .Deny}}
+    http-request deny if { src{{range .Deny}} {{.}}{{end}} }
+{{- end}}
+{{- if .Allow}}
+    http-request deny if !{ src{{range .Allow}} {{.}}{{end}} }
+{{- end}}
+{{- if .RateLimit}}
+    http-request track-sc0 src table {{$.ID}}
+    http-request deny deny_status 429 if { sc_http_req_rate(0) gt {{$.MaxRequestRate}} }
+{{- end}}
+{{- end}}
+{{- end}}`
@@ -550,6 +550,18 @@ func (c *GalebClient) FindVirtualHostsByRule(ruleName string) ([]VirtualHost, er
 	return rspObj.Embedded.VirtualHosts, nil
 }
 
+// RuleExists returns whether a rule with the given name exists.
+func (c *GalebClient) RuleExists(ruleName string) (bool, error) {
+	_, err := c.findItemByName("rule", ruleName)
+	if _, ok := err.(ErrItemNotFound); ok {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
 func (c *GalebClient) Healthcheck() error {
 	rsp, err := c.doRequest("GET", "/healthcheck", nil)
 	if err != nil {
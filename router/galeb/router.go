@@ -288,6 +288,13 @@ func (r *galebRouter) Addr(name string) (addr string, err error) {
 	if err != nil {
 		return "", err
 	}
+	exists, err := r.client.RuleExists(r.ruleName(backendName))
+	if err != nil {
+		return "", err
+	}
+	if !exists {
+		return "", router.ErrRouteNotFound
+	}
 	return r.virtualHostName(backendName), nil
 }
 
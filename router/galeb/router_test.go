@@ -20,6 +20,7 @@ import (
 	"github.com/tsuru/config"
 	"github.com/tsuru/tsuru/db"
 	"github.com/tsuru/tsuru/db/dbtest"
+	"github.com/tsuru/tsuru/router"
 	galebClient "github.com/tsuru/tsuru/router/galeb/client"
 	"github.com/tsuru/tsuru/router/routertest"
 	"gopkg.in/check.v1"
@@ -418,3 +419,22 @@ func (s *S) TestAddBackendPartialFailure(c *check.C) {
 	c.Check(fakeServer.rules, check.DeepEquals, map[string]interface{}{})
 	c.Check(fakeServer.ruleVh, check.DeepEquals, map[string][]string{})
 }
+
+func (s *S) TestAddrBackendRemovedFromGaleb(c *check.C) {
+	fakeServer, err := NewFakeGalebServer()
+	c.Assert(err, check.IsNil)
+	server := httptest.NewServer(fakeServer)
+	defer server.Close()
+	config.Set("routers:galeb:api-url", server.URL+"/api")
+	gRouter, err := createRouter("galeb", "routers:galeb")
+	c.Assert(err, check.IsNil)
+	err = router.Store("backend1", "backend1", "galeb")
+	c.Assert(err, check.IsNil)
+	_, err = gRouter.Addr("backend1")
+	c.Assert(err, check.Equals, router.ErrRouteNotFound)
+	err = gRouter.AddBackend(routertest.FakeApp{Name: "backend2"})
+	c.Assert(err, check.IsNil)
+	addr, err := gRouter.Addr("backend2")
+	c.Assert(err, check.IsNil)
+	c.Assert(addr, check.Equals, "backend2.galeb.com")
+}
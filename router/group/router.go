@@ -0,0 +1,744 @@
+// Copyright 2018 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package group provides a router implementation that groups other routers,
+// one of them being the primary and the others secondaries. Changes to
+// backends, routes, cnames and certificates are mirrored to every member of
+// the group, while the address of a backend is the one in the primary router,
+// failing over to the healthy secondary with the highest weight when the
+// primary is down.
+//
+// It does not provide any exported type, in order to use the router, you must
+// import this package and get the router instance using the function
+// router.Get.
+//
+// In order to use this router, you need to define the "routers:<name>:type =
+// group" in your config, along with the name of the primary router in
+// "routers:<name>:primary" and the list of secondary routers in
+// "routers:<name>:secondaries", each one with a name and an optional weight.
+// The health of the members is cached for "routers:<name>:health-check-interval"
+// seconds, 10 by default.
+package group
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/tsuru/config"
+	tsuruErrors "github.com/tsuru/tsuru/errors"
+	"github.com/tsuru/tsuru/log"
+	"github.com/tsuru/tsuru/router"
+)
+
+const (
+	routerType = "group"
+
+	defaultHealthCheckInterval = 10 * time.Second
+)
+
+func init() {
+	router.Register(routerType, createRouter)
+}
+
+type member struct {
+	name   string
+	weight int
+}
+
+type groupRouter struct {
+	routerName string
+	// members holds the primary router followed by the secondaries, sorted
+	// by weight.
+	members             []member
+	healthCheckInterval time.Duration
+}
+
+var (
+	_ router.Router                  = &groupRouter{}
+	_ router.OptsRouter              = &groupRouter{}
+	_ router.CNameRouter             = &groupRouter{}
+	_ router.TLSRouter               = &groupRouter{}
+	_ router.CustomHealthcheckRouter = &groupRouter{}
+	_ router.AccessControlRouter     = &groupRouter{}
+	_ router.HealthChecker           = &groupRouter{}
+	_ router.StatusRouter            = &groupRouter{}
+	_ router.InfoRouter              = &groupRouter{}
+	_ router.PathRouter              = &groupRouter{}
+	_ router.L4Router                = &groupRouter{}
+	_ router.BatchRouter             = &groupRouter{}
+	_ router.WeightedRouter          = &groupRouter{}
+)
+
+func createRouter(routerName, configPrefix string) (router.Router, error) {
+	primary, err := config.GetString(configPrefix + ":primary")
+	if err != nil {
+		return nil, err
+	}
+	data, err := config.Get(configPrefix + ":secondaries")
+	if err != nil {
+		return nil, err
+	}
+	rawSecondaries, _ := data.([]interface{})
+	if len(rawSecondaries) == 0 {
+		return nil, errors.Errorf("router group %q must have at least one secondary router", routerName)
+	}
+	secondaries := make([]member, len(rawSecondaries))
+	for i, raw := range rawSecondaries {
+		secondaries[i], err = parseMember(raw)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid secondary router in group %q", routerName)
+		}
+	}
+	sort.SliceStable(secondaries, func(i, j int) bool {
+		return secondaries[i].weight > secondaries[j].weight
+	})
+	members := append([]member{{name: primary}}, secondaries...)
+	names := make(map[string]struct{}, len(members))
+	for _, m := range members {
+		if m.name == routerName {
+			return nil, errors.Errorf("router group %q cannot be a member of itself", routerName)
+		}
+		if _, ok := names[m.name]; ok {
+			return nil, errors.Errorf("router %q is a member of group %q more than once", m.name, routerName)
+		}
+		names[m.name] = struct{}{}
+	}
+	interval := defaultHealthCheckInterval
+	if seconds, _ := config.GetInt(configPrefix + ":health-check-interval"); seconds > 0 {
+		interval = time.Duration(seconds) * time.Second
+	}
+	return &groupRouter{routerName: routerName, members: members, healthCheckInterval: interval}, nil
+}
+
+func parseMember(raw interface{}) (member, error) {
+	switch v := raw.(type) {
+	case string:
+		return member{name: v}, nil
+	case map[interface{}]interface{}:
+		m := member{}
+		m.name, _ = v["name"].(string)
+		if m.name == "" {
+			return m, errors.New("name is required")
+		}
+		switch weight := v["weight"].(type) {
+		case int:
+			m.weight = weight
+		case float64:
+			m.weight = int(weight)
+		case nil:
+		default:
+			return m, errors.Errorf("invalid weight %v", weight)
+		}
+		return m, nil
+	}
+	return member{}, errors.Errorf("invalid member %v", raw)
+}
+
+type memberRouter struct {
+	member
+	router.Router
+}
+
+func (r *groupRouter) GetName() string {
+	return r.routerName
+}
+
+func (r *groupRouter) routers() ([]memberRouter, error) {
+	routers := make([]memberRouter, len(r.members))
+	for i, m := range r.members {
+		memberR, err := router.Get(m.name)
+		if err != nil {
+			return nil, errors.Wrapf(err, "unable to get router %q in group %q", m.name, r.routerName)
+		}
+		routers[i] = memberRouter{member: m, Router: memberR}
+	}
+	return routers, nil
+}
+
+type healthEntry struct {
+	err     error
+	expires time.Time
+}
+
+// healthCache holds the results of checkUp for each member router and
+// backend, avoiding health checks in every call to the group.
+var healthCache = struct {
+	sync.Mutex
+	entries   map[string]healthEntry
+	lastPrune time.Time
+}{entries: map[string]healthEntry{}}
+
+func resetHealthCache() {
+	healthCache.Lock()
+	defer healthCache.Unlock()
+	healthCache.entries = map[string]healthEntry{}
+}
+
+// checkUp returns the cached result of checkUp for the member router and
+// backend, checking it again once the health check interval has passed.
+func (r *groupRouter) checkUp(m memberRouter, name string) error {
+	key := m.name + "\x00" + name
+	now := time.Now()
+	healthCache.Lock()
+	entry, ok := healthCache.entries[key]
+	healthCache.Unlock()
+	if ok && now.Before(entry.expires) {
+		return entry.err
+	}
+	err := checkUp(m, name)
+	healthCache.Lock()
+	defer healthCache.Unlock()
+	healthCache.entries[key] = healthEntry{err: err, expires: now.Add(r.healthCheckInterval)}
+	if now.Sub(healthCache.lastPrune) > r.healthCheckInterval {
+		for k, e := range healthCache.entries {
+			if !now.Before(e.expires) {
+				delete(healthCache.entries, k)
+			}
+		}
+		healthCache.lastPrune = now
+	}
+	return err
+}
+
+// checkUp returns an error if the member router is down or, when name is not
+// empty, if the backend is not ready in the member router.
+func checkUp(m memberRouter, name string) error {
+	if hcRouter, ok := m.Router.(router.HealthChecker); ok {
+		err := hcRouter.HealthCheck()
+		if err != nil {
+			return err
+		}
+	}
+	if name == "" {
+		return nil
+	}
+	if statusRouter, ok := m.Router.(router.StatusRouter); ok {
+		status, detail, err := statusRouter.GetBackendStatus(name)
+		if err != nil {
+			return err
+		}
+		if status != router.BackendStatusReady {
+			return errors.Errorf("backend %s: %s", status, detail)
+		}
+	}
+	return nil
+}
+
+// active returns the member serving the requests to the backend: the primary
+// router, unless it's down, or the up secondary with the highest weight. The
+// primary is returned when every member is down.
+func (r *groupRouter) active(routers []memberRouter, name string) memberRouter {
+	for i, m := range routers {
+		err := r.checkUp(m, name)
+		if err == nil {
+			if i > 0 {
+				log.Errorf("[router group %s] primary router %q is down for %q, using %q", r.routerName, routers[0].name, name, m.name)
+			}
+			return m
+		}
+	}
+	return routers[0]
+}
+
+// mirror runs fn in every member of the group, starting with the active one.
+// The error returned by the active member is returned as is. Errors in other
+// members are ignored if they are listed in ignoredErrs or if the member is
+// down, being fixed later by a routes rebuild.
+func (r *groupRouter) mirror(name string, fn func(router.Router) error, ignoredErrs ...error) error {
+	return r.mirrorActive(name, func(memberR router.Router, _ bool) error {
+		return fn(memberR)
+	}, ignoredErrs...)
+}
+
+// mirrorActive works like mirror, also telling fn whether the member is the
+// active one.
+func (r *groupRouter) mirrorActive(name string, fn func(memberR router.Router, active bool) error, ignoredErrs ...error) error {
+	routers, err := r.routers()
+	if err != nil {
+		return err
+	}
+	return r.mirrorFrom(routers, r.active(routers, name), fn, ignoredErrs)
+}
+
+// mirrorSupported works like mirror, running fn only in the members for which
+// supported returns true, starting with the active member or, if it doesn't
+// support the operation, with the first member supporting it. It fails when
+// no member supports the operation.
+func (r *groupRouter) mirrorSupported(name string, supported func(router.Router) bool, fn func(router.Router) error, ignoredErrs ...error) error {
+	routers, err := r.routers()
+	if err != nil {
+		return err
+	}
+	lead, err := r.supportingMember(routers, r.active(routers, name), supported)
+	if err != nil {
+		return err
+	}
+	return r.mirrorFrom(routers, lead, func(memberR router.Router, _ bool) error {
+		if !supported(memberR) {
+			return nil
+		}
+		return fn(memberR)
+	}, ignoredErrs)
+}
+
+func (r *groupRouter) mirrorFrom(routers []memberRouter, lead memberRouter, fn func(memberR router.Router, lead bool) error, ignoredErrs []error) error {
+	leadErr := fn(lead.Router, true)
+	multi := tsuruErrors.NewMultiError()
+	for _, m := range routers {
+		if m.name == lead.name {
+			continue
+		}
+		err := fn(m.Router, false)
+		if err == nil || isIgnored(err, ignoredErrs) {
+			continue
+		}
+		if upErr := r.checkUp(m, ""); upErr != nil {
+			log.Errorf("[router group %s] ignoring error in router %q, which is down (%s): %s", r.routerName, m.name, upErr, err)
+			continue
+		}
+		multi.Add(errors.Wrapf(err, "error in router %q", m.name))
+	}
+	if leadErr != nil {
+		return leadErr
+	}
+	return multi.ToError()
+}
+
+// supportingMember returns the active member, if it supports the operation,
+// or the first member supporting it.
+func (r *groupRouter) supportingMember(routers []memberRouter, active memberRouter, supported func(router.Router) bool) (memberRouter, error) {
+	if supported(active.Router) {
+		return active, nil
+	}
+	for _, m := range routers {
+		if supported(m.Router) {
+			return m, nil
+		}
+	}
+	return memberRouter{}, errUnsupported{group: r.routerName}
+}
+
+type errUnsupported struct {
+	group string
+}
+
+func (e errUnsupported) Error() string {
+	return fmt.Sprintf("no router in group %q supports this operation", e.group)
+}
+
+func isIgnored(err error, ignoredErrs []error) bool {
+	for _, ignored := range ignoredErrs {
+		if errors.Cause(err) == ignored {
+			return true
+		}
+	}
+	return false
+}
+
+func isWeightedRouter(r router.Router) bool {
+	_, ok := r.(router.WeightedRouter)
+	return ok
+}
+
+func isPathRouter(r router.Router) bool {
+	_, ok := r.(router.PathRouter)
+	return ok
+}
+
+func isL4Router(r router.Router) bool {
+	_, ok := r.(router.L4Router)
+	return ok
+}
+
+// reader returns the member used to read the state of the backend: the active
+// member, if it supports the operation, or the first member supporting it.
+func (r *groupRouter) reader(name string, supported func(router.Router) bool) (router.Router, error) {
+	routers, err := r.routers()
+	if err != nil {
+		return nil, err
+	}
+	m, err := r.supportingMember(routers, r.active(routers, name), supported)
+	if err != nil {
+		return nil, err
+	}
+	return m.Router, nil
+}
+
+func (r *groupRouter) AddBackend(app router.App) error {
+	err := r.mirror(app.GetName(), func(memberR router.Router) error {
+		return memberR.AddBackend(app)
+	}, router.ErrBackendExists)
+	if err != nil {
+		return err
+	}
+	return router.Store(app.GetName(), app.GetName(), routerType)
+}
+
+func (r *groupRouter) AddBackendOpts(app router.App, opts map[string]string) error {
+	err := r.mirror(app.GetName(), func(memberR router.Router) error {
+		if optsRouter, ok := memberR.(router.OptsRouter); ok {
+			return optsRouter.AddBackendOpts(app, opts)
+		}
+		return memberR.AddBackend(app)
+	}, router.ErrBackendExists)
+	if err != nil {
+		return err
+	}
+	return router.Store(app.GetName(), app.GetName(), routerType)
+}
+
+func (r *groupRouter) UpdateBackendOpts(app router.App, opts map[string]string) error {
+	return r.mirror(app.GetName(), func(memberR router.Router) error {
+		if optsRouter, ok := memberR.(router.OptsRouter); ok {
+			return optsRouter.UpdateBackendOpts(app, opts)
+		}
+		return nil
+	})
+}
+
+func (r *groupRouter) RemoveBackend(name string) error {
+	return r.mirror(name, func(memberR router.Router) error {
+		return memberR.RemoveBackend(name)
+	}, router.ErrBackendNotFound)
+}
+
+func (r *groupRouter) AddRoutes(name string, addresses []*url.URL) error {
+	return r.mirror(name, func(memberR router.Router) error {
+		return memberR.AddRoutes(name, addresses)
+	})
+}
+
+func (r *groupRouter) RemoveRoutes(name string, addresses []*url.URL) error {
+	return r.mirror(name, func(memberR router.Router) error {
+		return memberR.RemoveRoutes(name, addresses)
+	}, router.ErrRouteNotFound)
+}
+
+func (r *groupRouter) Routes(name string) ([]*url.URL, error) {
+	memberR, err := r.reader(name, func(router.Router) bool { return true })
+	if err != nil {
+		return nil, err
+	}
+	return memberR.Routes(name)
+}
+
+// Addr returns the address of the backend in the active member, which is the
+// primary router unless it's down.
+func (r *groupRouter) Addr(name string) (string, error) {
+	memberR, err := r.reader(name, func(router.Router) bool { return true })
+	if err != nil {
+		return "", err
+	}
+	return memberR.Addr(name)
+}
+
+// Swap swaps the backends in the primary router, which also swaps the names
+// of the backends shared by all routers, and only exchanges the routes of the
+// backends in the secondaries.
+func (r *groupRouter) Swap(backend1, backend2 string, cnameOnly bool) error {
+	routers, err := r.routers()
+	if err != nil {
+		return err
+	}
+	err = routers[0].Swap(backend1, backend2, cnameOnly)
+	if err != nil {
+		return err
+	}
+	for _, m := range routers[1:] {
+		if cnameOnly {
+			err = m.Swap(backend1, backend2, cnameOnly)
+		} else {
+			err = router.SwapRoutes(m.Router, backend1, backend2)
+		}
+		if err != nil {
+			return errors.Wrapf(err, "error in router %q", m.name)
+		}
+	}
+	return nil
+}
+
+func (r *groupRouter) SetCName(cname, name string) error {
+	return r.mirror(name, func(memberR router.Router) error {
+		if cnameRouter, ok := memberR.(router.CNameRouter); ok {
+			return cnameRouter.SetCName(cname, name)
+		}
+		return nil
+	}, router.ErrCNameExists)
+}
+
+func (r *groupRouter) UnsetCName(cname, name string) error {
+	return r.mirror(name, func(memberR router.Router) error {
+		if cnameRouter, ok := memberR.(router.CNameRouter); ok {
+			return cnameRouter.UnsetCName(cname, name)
+		}
+		return nil
+	}, router.ErrCNameNotFound)
+}
+
+func (r *groupRouter) CNames(name string) ([]*url.URL, error) {
+	memberR, err := r.reader(name, func(memberR router.Router) bool {
+		_, ok := memberR.(router.CNameRouter)
+		return ok
+	})
+	if err != nil {
+		return nil, err
+	}
+	return memberR.(router.CNameRouter).CNames(name)
+}
+
+func (r *groupRouter) AddCertificate(app router.App, cname, certificate, key string) error {
+	return r.mirror(app.GetName(), func(memberR router.Router) error {
+		if tlsRouter, ok := memberR.(router.TLSRouter); ok {
+			return tlsRouter.AddCertificate(app, cname, certificate, key)
+		}
+		return nil
+	})
+}
+
+func (r *groupRouter) RemoveCertificate(app router.App, cname string) error {
+	return r.mirror(app.GetName(), func(memberR router.Router) error {
+		if tlsRouter, ok := memberR.(router.TLSRouter); ok {
+			return tlsRouter.RemoveCertificate(app, cname)
+		}
+		return nil
+	}, router.ErrCertificateNotFound)
+}
+
+func (r *groupRouter) GetCertificate(app router.App, cname string) (string, error) {
+	memberR, err := r.reader(app.GetName(), func(memberR router.Router) bool {
+		_, ok := memberR.(router.TLSRouter)
+		return ok
+	})
+	if err != nil {
+		return "", err
+	}
+	return memberR.(router.TLSRouter).GetCertificate(app, cname)
+}
+
+func (r *groupRouter) SetHealthcheck(name string, data router.HealthcheckData) error {
+	return r.mirror(name, func(memberR router.Router) error {
+		if hcRouter, ok := memberR.(router.CustomHealthcheckRouter); ok {
+			return hcRouter.SetHealthcheck(name, data)
+		}
+		return nil
+	})
+}
+
+func (r *groupRouter) SetAccessControl(name string, ac router.AccessControl) error {
+	return r.mirror(name, func(memberR router.Router) error {
+		if acRouter, ok := memberR.(router.AccessControlRouter); ok {
+			return acRouter.SetAccessControl(name, ac)
+		}
+		return nil
+	})
+}
+
+func (r *groupRouter) GetAccessControl(name string) (router.AccessControl, error) {
+	memberR, err := r.reader(name, func(memberR router.Router) bool {
+		_, ok := memberR.(router.AccessControlRouter)
+		return ok
+	})
+	if err != nil {
+		return router.AccessControl{}, err
+	}
+	return memberR.(router.AccessControlRouter).GetAccessControl(name)
+}
+
+func (r *groupRouter) SetRoutesWeight(name string, addresses []*url.URL, weight int) error {
+	return r.mirrorSupported(name, isWeightedRouter, func(memberR router.Router) error {
+		return memberR.(router.WeightedRouter).SetRoutesWeight(name, addresses, weight)
+	})
+}
+
+func (r *groupRouter) RemoveRoutesWeight(name string) error {
+	return r.mirrorSupported(name, isWeightedRouter, func(memberR router.Router) error {
+		return memberR.(router.WeightedRouter).RemoveRoutesWeight(name)
+	})
+}
+
+func (r *groupRouter) AddPathRoutes(name, path string, addresses []*url.URL) error {
+	return r.mirrorSupported(name, isPathRouter, func(memberR router.Router) error {
+		return memberR.(router.PathRouter).AddPathRoutes(name, path, addresses)
+	})
+}
+
+func (r *groupRouter) RemovePathRoutes(name, path string, addresses []*url.URL) error {
+	return r.mirrorSupported(name, isPathRouter, func(memberR router.Router) error {
+		return memberR.(router.PathRouter).RemovePathRoutes(name, path, addresses)
+	}, router.ErrPathNotFound)
+}
+
+func (r *groupRouter) RemovePath(name, path string) error {
+	return r.mirrorSupported(name, isPathRouter, func(memberR router.Router) error {
+		return memberR.(router.PathRouter).RemovePath(name, path)
+	}, router.ErrPathNotFound)
+}
+
+// PathRoutes returns no paths when no member supports them, as routes
+// rebuilds read the paths of every PathRouter.
+func (r *groupRouter) PathRoutes(name string) (map[string][]*url.URL, error) {
+	memberR, err := r.reader(name, isPathRouter)
+	if _, ok := err.(errUnsupported); ok {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return memberR.(router.PathRouter).PathRoutes(name)
+}
+
+func (r *groupRouter) AddPortRoutes(name string, port router.L4Port, addresses []*url.URL) error {
+	return r.mirrorSupported(name, isL4Router, func(memberR router.Router) error {
+		return memberR.(router.L4Router).AddPortRoutes(name, port, addresses)
+	})
+}
+
+func (r *groupRouter) RemovePortRoutes(name, portName string, addresses []*url.URL) error {
+	return r.mirrorSupported(name, isL4Router, func(memberR router.Router) error {
+		return memberR.(router.L4Router).RemovePortRoutes(name, portName, addresses)
+	}, router.ErrPortNotFound)
+}
+
+func (r *groupRouter) RemovePort(name, portName string) error {
+	return r.mirrorSupported(name, isL4Router, func(memberR router.Router) error {
+		return memberR.(router.L4Router).RemovePort(name, portName)
+	}, router.ErrPortNotFound)
+}
+
+// PortRoutes returns the ports of the backend in the active member, whose
+// addresses are the ones serving the requests, or no ports when no member
+// supports them.
+func (r *groupRouter) PortRoutes(name string) ([]router.L4Route, error) {
+	memberR, err := r.reader(name, isL4Router)
+	if _, ok := err.(errUnsupported); ok {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return memberR.(router.L4Router).PortRoutes(name)
+}
+
+// VersionedRoutes returns the routes of the backend in the active member,
+// along with their version in this member, if it's a BatchRouter.
+func (r *groupRouter) VersionedRoutes(name string) ([]*url.URL, string, error) {
+	memberR, err := r.reader(name, func(router.Router) bool { return true })
+	if err != nil {
+		return nil, "", err
+	}
+	if batchRouter, ok := memberR.(router.BatchRouter); ok {
+		return batchRouter.VersionedRoutes(name)
+	}
+	routes, err := memberR.Routes(name)
+	return routes, "", err
+}
+
+// SetRoutes replaces the routes of the backend in every member, checking the
+// version only in the active member, where it was read by VersionedRoutes.
+// Members that are not a BatchRouter get the routes added and removed.
+func (r *groupRouter) SetRoutes(name string, addresses []*url.URL, version string) error {
+	return r.mirrorActive(name, func(memberR router.Router, active bool) error {
+		if batchRouter, ok := memberR.(router.BatchRouter); ok {
+			if !active {
+				return batchRouter.SetRoutes(name, addresses, "")
+			}
+			return batchRouter.SetRoutes(name, addresses, version)
+		}
+		return setRoutes(memberR, name, addresses)
+	})
+}
+
+func setRoutes(r router.Router, name string, addresses []*url.URL) error {
+	oldRoutes, err := r.Routes(name)
+	if err != nil {
+		return err
+	}
+	existing := make(map[string]struct{}, len(oldRoutes))
+	for _, route := range oldRoutes {
+		existing[route.Host] = struct{}{}
+	}
+	keep := make(map[string]struct{}, len(addresses))
+	var toAdd []*url.URL
+	for _, addr := range addresses {
+		keep[addr.Host] = struct{}{}
+		if _, ok := existing[addr.Host]; !ok {
+			toAdd = append(toAdd, addr)
+		}
+	}
+	var toRemove []*url.URL
+	for _, route := range oldRoutes {
+		if _, ok := keep[route.Host]; !ok {
+			toRemove = append(toRemove, route)
+		}
+	}
+	err = r.AddRoutes(name, toAdd)
+	if err != nil {
+		return err
+	}
+	return r.RemoveRoutes(name, toRemove)
+}
+
+// HealthCheck returns an error only when every member of the group is down,
+// as requests are still served by the secondaries when the primary is down.
+func (r *groupRouter) HealthCheck() error {
+	routers, err := r.routers()
+	if err != nil {
+		return err
+	}
+	multi := tsuruErrors.NewMultiError()
+	for _, m := range routers {
+		err = r.checkUp(m, "")
+		if err == nil {
+			return nil
+		}
+		multi.Add(errors.Wrapf(err, "router %q is down", m.name))
+	}
+	return multi.ToError()
+}
+
+func (r *groupRouter) GetBackendStatus(name string) (router.BackendStatus, string, error) {
+	routers, err := r.routers()
+	if err != nil {
+		return "", "", err
+	}
+	active := r.active(routers, name)
+	status, detail := router.BackendStatusReady, ""
+	if statusRouter, ok := active.Router.(router.StatusRouter); ok {
+		status, detail, err = statusRouter.GetBackendStatus(name)
+		if err != nil {
+			return "", "", err
+		}
+	}
+	if active.name != routers[0].name {
+		failover := fmt.Sprintf("primary router %q is down, using %q", routers[0].name, active.name)
+		if detail != "" {
+			failover += ": " + detail
+		}
+		detail = failover
+	}
+	return status, detail, nil
+}
+
+func (r *groupRouter) GetInfo() (map[string]string, error) {
+	routers, err := r.routers()
+	if err != nil {
+		return nil, err
+	}
+	info := map[string]string{
+		"primary": routers[0].name,
+		"active":  r.active(routers, "").name,
+	}
+	for _, m := range routers {
+		status := "up"
+		if err = r.checkUp(m, ""); err != nil {
+			status = fmt.Sprintf("down: %s", err)
+		}
+		info[fmt.Sprintf("router %s (weight %d)", m.name, m.weight)] = status
+	}
+	return info, nil
+}
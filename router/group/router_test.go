@@ -0,0 +1,277 @@
+// Copyright 2018 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package group
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/globalsign/mgo/bson"
+	"github.com/pkg/errors"
+	"github.com/tsuru/config"
+	"github.com/tsuru/tsuru/db"
+	"github.com/tsuru/tsuru/db/dbtest"
+	"github.com/tsuru/tsuru/router"
+	"github.com/tsuru/tsuru/router/routertest"
+	"gopkg.in/check.v1"
+)
+
+func Test(t *testing.T) {
+	check.TestingT(t)
+}
+
+type S struct {
+	conn *db.Storage
+}
+
+var _ = check.Suite(&S{})
+
+func init() {
+	base := &S{}
+	suite := &routertest.RouterSuite{
+		SetUpSuiteFunc:   base.SetUpSuite,
+		TearDownTestFunc: base.TearDownTest,
+	}
+	suite.SetUpTestFunc = func(c *check.C) {
+		config.Set("database:name", "router_generic_group_tests")
+		base.SetUpTest(c)
+		config.Set("routers:fake-batch:type", "fake-batch")
+		config.Set("routers:fake-path:type", "fake-path")
+		config.Set("routers:fake-l4:type", "fake-l4")
+		config.Set("routers:mygroup:primary", "fake-batch")
+		config.Set("routers:mygroup:secondaries", []interface{}{"fake-status", "fake-path", "fake-l4"})
+		routertest.BatchRouter.Reset()
+		routertest.PathRouter.Reset()
+		routertest.L4Router.Reset()
+		r, err := router.Get("mygroup")
+		c.Assert(err, check.IsNil)
+		suite.Router = r
+	}
+	check.Suite(suite)
+}
+
+func (s *S) SetUpSuite(c *check.C) {
+	config.Set("log:disable-syslog", true)
+	config.Set("database:url", "127.0.0.1:27017?maxPoolSize=100")
+	config.Set("database:name", "router_group_tests")
+}
+
+func (s *S) SetUpTest(c *check.C) {
+	var err error
+	s.conn, err = db.Conn()
+	c.Assert(err, check.IsNil)
+	dbtest.ClearAllCollections(s.conn.Apps().Database)
+	config.Set("routers:fake-hc:type", "fake-hc")
+	config.Set("routers:fake-tls:type", "fake-tls")
+	config.Set("routers:fake-status:type", "fake-status")
+	config.Set("routers:mygroup:type", "group")
+	config.Set("routers:mygroup:primary", "fake-hc")
+	config.Set("routers:mygroup:secondaries", []interface{}{
+		map[interface{}]interface{}{"name": "fake-tls", "weight": 1},
+		map[interface{}]interface{}{"name": "fake-status", "weight": 5},
+	})
+	routertest.HCRouter.Reset()
+	routertest.HCRouter.SetErr(nil)
+	routertest.TLSRouter.Reset()
+	routertest.StatusRouter.Reset()
+	resetHealthCache()
+}
+
+func (s *S) TearDownTest(c *check.C) {
+	config.Unset("routers")
+	s.conn.Close()
+}
+
+func (s *S) TestCreateRouter(c *check.C) {
+	r, err := router.Get("mygroup")
+	c.Assert(err, check.IsNil)
+	c.Assert(r.(*groupRouter).members, check.DeepEquals, []member{
+		{name: "fake-hc"},
+		{name: "fake-status", weight: 5},
+		{name: "fake-tls", weight: 1},
+	})
+}
+
+func (s *S) TestCreateRouterInvalid(c *check.C) {
+	config.Unset("routers:mygroup:secondaries")
+	_, err := router.Get("mygroup")
+	c.Assert(err, check.NotNil)
+	config.Set("routers:mygroup:secondaries", []interface{}{})
+	_, err = router.Get("mygroup")
+	c.Assert(err, check.ErrorMatches, `router group "mygroup" must have at least one secondary router`)
+	config.Set("routers:mygroup:secondaries", []interface{}{"mygroup"})
+	_, err = router.Get("mygroup")
+	c.Assert(err, check.ErrorMatches, `router group "mygroup" cannot be a member of itself`)
+	config.Set("routers:mygroup:secondaries", []interface{}{"fake-hc"})
+	_, err = router.Get("mygroup")
+	c.Assert(err, check.ErrorMatches, `router "fake-hc" is a member of group "mygroup" more than once`)
+	config.Set("routers:mygroup:secondaries", []interface{}{map[interface{}]interface{}{"weight": 1}})
+	_, err = router.Get("mygroup")
+	c.Assert(err, check.ErrorMatches, `invalid secondary router in group "mygroup": name is required`)
+}
+
+func (s *S) TestMirrorChanges(c *check.C) {
+	r, err := router.Get("mygroup")
+	c.Assert(err, check.IsNil)
+	app := routertest.FakeApp{Name: "myapp"}
+	err = r.AddBackend(app)
+	c.Assert(err, check.IsNil)
+	addr, _ := url.Parse("http://10.0.0.1:8080")
+	err = r.AddRoutes("myapp", []*url.URL{addr})
+	c.Assert(err, check.IsNil)
+	err = r.(router.CNameRouter).SetCName("myapp.io", "myapp")
+	c.Assert(err, check.IsNil)
+	err = r.(router.TLSRouter).AddCertificate(app, "myapp.io", "cert", "key")
+	c.Assert(err, check.IsNil)
+	c.Assert(routertest.HCRouter.HasRoute("myapp", "10.0.0.1:8080"), check.Equals, true)
+	c.Assert(routertest.TLSRouter.HasRoute("myapp", "10.0.0.1:8080"), check.Equals, true)
+	c.Assert(routertest.StatusRouter.HasRoute("myapp", "10.0.0.1:8080"), check.Equals, true)
+	c.Assert(routertest.HCRouter.HasCNameFor("myapp", "myapp.io"), check.Equals, true)
+	c.Assert(routertest.TLSRouter.HasCNameFor("myapp", "myapp.io"), check.Equals, true)
+	c.Assert(routertest.TLSRouter.Certs["myapp.io"], check.Equals, "cert")
+	cert, err := r.(router.TLSRouter).GetCertificate(app, "myapp.io")
+	c.Assert(err, check.IsNil)
+	c.Assert(cert, check.Equals, "cert")
+	err = r.AddBackend(app)
+	c.Assert(err, check.Equals, router.ErrBackendExists)
+}
+
+func (s *S) TestMirrorIgnoresErrorsInDownSecondary(c *check.C) {
+	config.Set("routers:mygroup:primary", "fake-tls")
+	config.Set("routers:mygroup:secondaries", []interface{}{"fake-hc"})
+	r, err := router.Get("mygroup")
+	c.Assert(err, check.IsNil)
+	err = r.AddBackend(routertest.FakeApp{Name: "myapp"})
+	c.Assert(err, check.IsNil)
+	addr, _ := url.Parse("http://10.0.0.1:8080")
+	routertest.HCRouter.FailForIp(addr.String())
+	defer routertest.HCRouter.RemoveFailForIp(addr.String())
+	err = r.AddRoutes("myapp", []*url.URL{addr})
+	c.Assert(err, check.ErrorMatches, `(?s).*error in router "fake-hc": Forced failure.*`)
+	routertest.HCRouter.SetErr(errors.New("router down"))
+	resetHealthCache()
+	err = r.AddRoutes("myapp", []*url.URL{addr})
+	c.Assert(err, check.IsNil)
+	c.Assert(routertest.TLSRouter.HasRoute("myapp", "10.0.0.1:8080"), check.Equals, true)
+}
+
+func (s *S) TestAddrFailover(c *check.C) {
+	r, err := router.Get("mygroup")
+	c.Assert(err, check.IsNil)
+	err = r.AddBackend(routertest.FakeApp{Name: "myapp"})
+	c.Assert(err, check.IsNil)
+	addr, err := r.Addr("myapp")
+	c.Assert(err, check.IsNil)
+	c.Assert(addr, check.Equals, "myapp.fakehcrouter.com")
+	routertest.HCRouter.SetErr(errors.New("router down"))
+	resetHealthCache()
+	addr, err = r.Addr("myapp")
+	c.Assert(err, check.IsNil)
+	c.Assert(addr, check.Equals, "myapp.fakerouter.com")
+	status, detail, err := r.(router.StatusRouter).GetBackendStatus("myapp")
+	c.Assert(err, check.IsNil)
+	c.Assert(status, check.Equals, router.BackendStatusReady)
+	c.Assert(detail, check.Equals, `primary router "fake-hc" is down, using "fake-status"`)
+	routertest.StatusRouter.Status = router.BackendStatusNotReady
+	resetHealthCache()
+	addr, err = r.Addr("myapp")
+	c.Assert(err, check.IsNil)
+	c.Assert(addr, check.Equals, "myapp.faketlsrouter.com")
+}
+
+func (s *S) TestHealthCheck(c *check.C) {
+	r, err := router.Get("mygroup")
+	c.Assert(err, check.IsNil)
+	hcRouter := r.(router.HealthChecker)
+	c.Assert(hcRouter.HealthCheck(), check.IsNil)
+	routertest.HCRouter.SetErr(errors.New("router down"))
+	resetHealthCache()
+	c.Assert(hcRouter.HealthCheck(), check.IsNil)
+	info, err := r.(router.InfoRouter).GetInfo()
+	c.Assert(err, check.IsNil)
+	c.Assert(info, check.DeepEquals, map[string]string{
+		"primary":                       "fake-hc",
+		"active":                        "fake-status",
+		"router fake-hc (weight 0)":     "down: router down",
+		"router fake-status (weight 5)": "up",
+		"router fake-tls (weight 1)":    "up",
+	})
+}
+
+func (s *S) TestHealthCached(c *check.C) {
+	config.Set("routers:mygroup:health-check-interval", 60)
+	r, err := router.Get("mygroup")
+	c.Assert(err, check.IsNil)
+	err = r.AddBackend(routertest.FakeApp{Name: "myapp"})
+	c.Assert(err, check.IsNil)
+	addr, err := r.Addr("myapp")
+	c.Assert(err, check.IsNil)
+	c.Assert(addr, check.Equals, "myapp.fakehcrouter.com")
+	routertest.HCRouter.SetErr(errors.New("router down"))
+	addr, err = r.Addr("myapp")
+	c.Assert(err, check.IsNil)
+	c.Assert(addr, check.Equals, "myapp.fakehcrouter.com")
+	resetHealthCache()
+	addr, err = r.Addr("myapp")
+	c.Assert(err, check.IsNil)
+	c.Assert(addr, check.Equals, "myapp.fakerouter.com")
+}
+
+func (s *S) TestAddBackendStoresGroupKind(c *check.C) {
+	r, err := router.Get("mygroup")
+	c.Assert(err, check.IsNil)
+	err = r.AddBackend(routertest.FakeApp{Name: "myapp"})
+	c.Assert(err, check.IsNil)
+	var entry struct{ Kind string }
+	err = s.conn.Collection("routers").Find(bson.M{"app": "myapp"}).One(&entry)
+	c.Assert(err, check.IsNil)
+	c.Assert(entry.Kind, check.Equals, "group")
+}
+
+func (s *S) TestForwardOptionalInterfaces(c *check.C) {
+	config.Set("routers:fake-path:type", "fake-path")
+	config.Set("routers:fake-weighted:type", "fake-weighted")
+	config.Set("routers:mygroup:secondaries", []interface{}{"fake-path", "fake-weighted"})
+	routertest.PathRouter.Reset()
+	routertest.WeightedRouter.Reset()
+	r, err := router.Get("mygroup")
+	c.Assert(err, check.IsNil)
+	err = r.AddBackend(routertest.FakeApp{Name: "myapp"})
+	c.Assert(err, check.IsNil)
+	addr, _ := url.Parse("http://10.0.0.1:8080")
+	err = r.(router.PathRouter).AddPathRoutes("myapp", "/api", []*url.URL{addr})
+	c.Assert(err, check.IsNil)
+	paths, err := r.(router.PathRouter).PathRoutes("myapp")
+	c.Assert(err, check.IsNil)
+	c.Assert(paths, check.HasLen, 1)
+	c.Assert(paths["/api"], routertest.HostEquals, []*url.URL{addr})
+	err = r.(router.PathRouter).RemovePath("myapp", "/static")
+	c.Assert(err, check.Equals, router.ErrPathNotFound)
+	err = r.AddRoutes("myapp", []*url.URL{addr})
+	c.Assert(err, check.IsNil)
+	err = r.(router.WeightedRouter).SetRoutesWeight("myapp", []*url.URL{addr}, 10)
+	c.Assert(err, check.IsNil)
+	c.Assert(routertest.WeightedRouter.Weights["myapp"], check.DeepEquals, routertest.RoutesWeight{
+		Routes: []string{"10.0.0.1:8080"},
+		Weight: 10,
+	})
+	err = r.(router.BatchRouter).SetRoutes("myapp", nil, "")
+	c.Assert(err, check.IsNil)
+	c.Assert(routertest.HCRouter.HasRoute("myapp", "10.0.0.1:8080"), check.Equals, false)
+	c.Assert(routertest.WeightedRouter.HasRoute("myapp", "10.0.0.1:8080"), check.Equals, false)
+}
+
+func (s *S) TestUnsupportedOperation(c *check.C) {
+	r, err := router.Get("mygroup")
+	c.Assert(err, check.IsNil)
+	err = r.AddBackend(routertest.FakeApp{Name: "myapp"})
+	c.Assert(err, check.IsNil)
+	addr, _ := url.Parse("tcp://10.0.0.1:1883")
+	err = r.(router.L4Router).AddPortRoutes("myapp", router.L4Port{Name: "mqtt", Protocol: "tcp"}, []*url.URL{addr})
+	c.Assert(err, check.ErrorMatches, `no router in group "mygroup" supports this operation`)
+	ports, err := r.(router.L4Router).PortRoutes("myapp")
+	c.Assert(err, check.IsNil)
+	c.Assert(ports, check.HasLen, 0)
+}
@@ -0,0 +1,96 @@
+// Copyright 2018 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package router
+
+import "fmt"
+
+// OptSchema describes an option accepted in the app router options.
+type OptSchema struct {
+	Description string
+	Validate    func(value string) error
+}
+
+// OptsSchema maps the names of the options accepted by a router to their
+// schemas.
+type OptsSchema map[string]OptSchema
+
+// OptsSchemaRouter is a router declaring the options accepted by its
+// backends. Options not declared in the schema are rejected, unless the
+// router returns a nil schema, accepting any option.
+type OptsSchemaRouter interface {
+	OptsSchema() OptsSchema
+}
+
+type ErrInvalidOpt struct {
+	Router string
+	Opt    string
+	Reason string
+}
+
+func (e *ErrInvalidOpt) Error() string {
+	if e.Router == "" {
+		return fmt.Sprintf("invalid router option %q: %s", e.Opt, e.Reason)
+	}
+	return fmt.Sprintf("invalid option %q for router %q: %s", e.Opt, e.Router, e.Reason)
+}
+
+func (s OptsSchema) validate(opts map[string]string, strict bool) error {
+	for name, value := range opts {
+		opt, ok := s[name]
+		if !ok {
+			if strict {
+				return &ErrInvalidOpt{Opt: name, Reason: "unknown option"}
+			}
+			continue
+		}
+		if opt.Validate == nil {
+			continue
+		}
+		if err := opt.Validate(value); err != nil {
+			return &ErrInvalidOpt{Opt: name, Reason: err.Error()}
+		}
+	}
+	return nil
+}
+
+// ValidateOpts checks the app router options against the schemas supported
+// by r. Access control options are only accepted by routers implementing
+// AccessControlRouter, other options are only checked when r implements
+// OptsSchemaRouter.
+func ValidateOpts(r Router, opts map[string]string) error {
+	err := validateOpts(r, opts)
+	if invalidErr, ok := err.(*ErrInvalidOpt); ok {
+		invalidErr.Router = r.GetName()
+	}
+	return err
+}
+
+func validateOpts(r Router, opts map[string]string) error {
+	schema := OptsSchema{}
+	strict := false
+	if schemaRouter, ok := r.(OptsSchemaRouter); ok {
+		routerSchema := schemaRouter.OptsSchema()
+		strict = routerSchema != nil
+		for name, opt := range routerSchema {
+			schema[name] = opt
+		}
+	}
+	if _, ok := r.(AccessControlRouter); ok {
+		for name, opt := range AccessControlOptsSchema {
+			schema[name] = opt
+		}
+		_, err := AccessControlFromOpts(opts)
+		if err != nil {
+			return err
+		}
+	} else {
+		for name := range opts {
+			if _, isAccessControl := AccessControlOptsSchema[name]; isAccessControl {
+				return &ErrInvalidOpt{Opt: name, Reason: "access control is not supported"}
+			}
+		}
+	}
+	return schema.validate(opts, strict)
+}
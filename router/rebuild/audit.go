@@ -0,0 +1,310 @@
+// Copyright 2018 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package rebuild
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/tsuru/config"
+	"github.com/tsuru/tsuru/api/shutdown"
+	"github.com/tsuru/tsuru/event"
+	"github.com/tsuru/tsuru/log"
+	"github.com/tsuru/tsuru/permission"
+)
+
+const (
+	EventKindRouterDrift = "router-drift"
+	EventKindRoutesAudit = "routes-audit"
+)
+
+var (
+	driftApps = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "tsuru_router_drift_apps",
+		Help: "The number of apps whose state in the router differs from the expected one.",
+	}, []string{"router"})
+
+	driftItems = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "tsuru_router_drift_items",
+		Help: "The number of routes, cnames, certificates and backends differing from the expected ones in the router.",
+	}, []string{"router", "kind"})
+)
+
+func init() {
+	prometheus.MustRegister(driftApps, driftItems)
+}
+
+// Auditor periodically compares the state of the routers with the expected
+// state of every app, using RebuildRoutes in DRY mode, and reports the
+// differences found as metrics and events without fixing them. Each run holds
+// a global event lock, so only one tsuru instance audits the routers at a
+// time, and stores the drift already reported in the end data of this event.
+type Auditor struct {
+	lister   func() ([]RebuildApp, error)
+	interval time.Duration
+	done     chan bool
+	running  bool
+}
+
+func NewAuditor(lister func() ([]RebuildApp, error), interval time.Duration) *Auditor {
+	return &Auditor{
+		lister:   lister,
+		interval: interval,
+		done:     make(chan bool),
+	}
+}
+
+// InitializeAuditor starts the auditor if routes-audit:interval is set,
+// using lister to get the apps to be audited.
+func InitializeAuditor(lister func() ([]RebuildApp, error)) error {
+	seconds, _ := config.GetInt("routes-audit:interval")
+	if seconds <= 0 {
+		return nil
+	}
+	a := NewAuditor(lister, time.Duration(seconds)*time.Second)
+	shutdown.Register(a)
+	a.running = true
+	go a.run()
+	return nil
+}
+
+func (a *Auditor) run() {
+	for {
+		select {
+		case <-a.done:
+			return
+		case <-time.After(a.interval):
+		}
+		err := a.RunOnce()
+		if err != nil {
+			log.Errorf("[routes-audit] %s", err)
+		}
+	}
+}
+
+func (a *Auditor) Shutdown(ctx context.Context) error {
+	if !a.running {
+		return nil
+	}
+	a.running = false
+	select {
+	case a.done <- true:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (a *Auditor) String() string {
+	return "routes auditor"
+}
+
+// RunOnce checks the routers of all apps once, updating the drift metrics and
+// creating events for apps with new differences.
+func (a *Auditor) RunOnce() (retErr error) {
+	defer func() {
+		if rec := recover(); rec != nil {
+			retErr = errors.Errorf("recovered panic, we can never stop! panic: %v", rec)
+		}
+	}()
+	evt, err := event.NewInternal(&event.Opts{
+		Target:       event.Target{Type: event.TargetTypeGlobal, Value: EventKindRoutesAudit},
+		InternalKind: EventKindRoutesAudit,
+		Allowed:      event.Allowed(permission.PermAppReadEvents),
+	})
+	if err != nil {
+		if _, ok := err.(event.ErrEventLocked); ok {
+			log.Debugf("[routes-audit] skipping run, event locked")
+			return nil
+		}
+		return errors.Wrap(err, "error creating routes audit event")
+	}
+	reported, err := lastReported()
+	if err != nil {
+		evt.Abort()
+		return err
+	}
+	changed := false
+	defer func() {
+		if !changed && retErr == nil {
+			evt.Abort()
+			return
+		}
+		evt.DoneCustomData(retErr, reported)
+	}()
+	apps, err := a.lister()
+	if err != nil {
+		return errors.Wrap(err, "error listing apps")
+	}
+	appsCount := make(map[string]int)
+	itemsCount := make(map[string]map[string]int)
+	prefetched := prefetchRoutes(apps)
+	for _, app := range apps {
+		results, err := dryRebuildRoutes(app, prefetched)
+		if err != nil {
+			log.Errorf("[routes-audit] error checking routes of app %q: %s", app.GetName(), err)
+			continue
+		}
+		drift := make(map[string]RebuildRoutesResult)
+		for routerName, result := range results {
+			if _, ok := itemsCount[routerName]; !ok {
+				appsCount[routerName] = 0
+				itemsCount[routerName] = make(map[string]int)
+			}
+			if !result.HasDrift() {
+				continue
+			}
+			drift[routerName] = result
+			appsCount[routerName]++
+			for kind, count := range driftCounts(result) {
+				itemsCount[routerName][kind] += count
+			}
+		}
+		if report(app, drift, reported) {
+			changed = true
+		}
+	}
+	driftApps.Reset()
+	driftItems.Reset()
+	for routerName, count := range appsCount {
+		driftApps.WithLabelValues(routerName).Set(float64(count))
+		for _, kind := range []string{"added", "removed", "cnames", "certificates", "backends"} {
+			driftItems.WithLabelValues(routerName, kind).Set(float64(itemsCount[routerName][kind]))
+		}
+	}
+	return nil
+}
+
+// lastReported returns the signatures of the drift reported for each app, as
+// stored by the last successful run.
+func lastReported() (map[string]string, error) {
+	running := false
+	evts, err := event.List(&event.Filter{
+		KindNames:   []string{EventKindRoutesAudit},
+		Running:     &running,
+		SuccessOnly: true,
+		Limit:       1,
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "error reading last routes audit")
+	}
+	reported := make(map[string]string)
+	if len(evts) == 0 {
+		return reported, nil
+	}
+	err = evts[0].EndData(&reported)
+	if err != nil {
+		return nil, errors.Wrap(err, "error reading last routes audit")
+	}
+	return reported, nil
+}
+
+// report creates an event for the drift found in the routers of the app,
+// unless the same drift was already reported by a previous run, returning
+// whether reported was changed.
+func report(app RebuildApp, drift map[string]RebuildRoutesResult, reported map[string]string) bool {
+	if len(drift) == 0 {
+		_, ok := reported[app.GetName()]
+		delete(reported, app.GetName())
+		return ok
+	}
+	signature := driftSignature(drift)
+	if reported[app.GetName()] == signature {
+		return false
+	}
+	evt, err := event.NewInternal(&event.Opts{
+		Target:       event.Target{Type: event.TargetTypeApp, Value: app.GetName()},
+		InternalKind: EventKindRouterDrift,
+		CustomData:   drift,
+		DisableLock:  true,
+		Allowed: event.Allowed(permission.PermAppReadEvents, append(permission.Contexts(permission.CtxTeam, app.GetTeamsName()),
+			permission.Context(permission.CtxApp, app.GetName()),
+			permission.Context(permission.CtxPool, app.GetPool()),
+		)...),
+	})
+	if err != nil {
+		log.Errorf("[routes-audit] unable to create event for app %q: %s", app.GetName(), err)
+		return false
+	}
+	for routerName, result := range drift {
+		fmt.Fprintf(evt, "router %q of app %q differs from the expected state: %s\n", routerName, app.GetName(), driftSummary(result))
+	}
+	err = evt.Done(nil)
+	if err != nil {
+		log.Errorf("[routes-audit] unable to finish event for app %q: %s", app.GetName(), err)
+		return false
+	}
+	reported[app.GetName()] = signature
+	return true
+}
+
+func driftCounts(result RebuildRoutesResult) map[string]int {
+	counts := map[string]int{
+		"added":        len(result.Added),
+		"removed":      len(result.Removed),
+		"cnames":       len(result.MissingCNames),
+		"certificates": len(result.MissingCertificates),
+	}
+	if result.MissingBackend {
+		counts["backends"] = 1
+	}
+	for _, pathResult := range result.Paths {
+		counts["added"] += len(pathResult.Added)
+		counts["removed"] += len(pathResult.Removed)
+	}
+	for _, portResult := range result.Ports {
+		counts["added"] += len(portResult.Added)
+		counts["removed"] += len(portResult.Removed)
+	}
+	return counts
+}
+
+func driftSummary(result RebuildRoutesResult) string {
+	counts := driftCounts(result)
+	return fmt.Sprintf("%d routes missing, %d unexpected routes, %d cnames missing, %d certificates missing, backend missing: %v",
+		counts["added"], counts["removed"], counts["cnames"], counts["certificates"], result.MissingBackend)
+}
+
+// driftSignature returns a string identifying the drift regardless of the
+// order of the routes in the results.
+func driftSignature(drift map[string]RebuildRoutesResult) string {
+	var items []string
+	for routerName, result := range drift {
+		items = append(items, resultItems(routerName, result)...)
+		for path, pathResult := range result.Paths {
+			items = append(items, resultItems(routerName+path, pathResult)...)
+		}
+		for port, portResult := range result.Ports {
+			items = append(items, resultItems(routerName+" port "+port, portResult)...)
+		}
+	}
+	sort.Strings(items)
+	return strings.Join(items, "\n")
+}
+
+func resultItems(prefix string, result RebuildRoutesResult) []string {
+	var items []string
+	for _, r := range result.Added {
+		items = append(items, prefix+" added "+r)
+	}
+	for _, r := range result.Removed {
+		items = append(items, prefix+" removed "+r)
+	}
+	for _, cname := range result.MissingCNames {
+		items = append(items, prefix+" cname "+cname)
+	}
+	for _, cert := range result.MissingCertificates {
+		items = append(items, prefix+" certificate "+cert)
+	}
+	if result.MissingBackend {
+		items = append(items, prefix+" backend")
+	}
+	return items
+}
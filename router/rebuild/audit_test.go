@@ -0,0 +1,169 @@
+// Copyright 2018 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package rebuild_test
+
+import (
+	"net/url"
+	"time"
+
+	"github.com/globalsign/mgo/bson"
+	"github.com/tsuru/config"
+	"github.com/tsuru/tsuru/app"
+	"github.com/tsuru/tsuru/event"
+	"github.com/tsuru/tsuru/event/eventtest"
+	"github.com/tsuru/tsuru/permission"
+	"github.com/tsuru/tsuru/provision/provisiontest"
+	"github.com/tsuru/tsuru/router/rebuild"
+	"github.com/tsuru/tsuru/router/routertest"
+	"gopkg.in/check.v1"
+)
+
+func (s *S) auditorApps(c *check.C) func() ([]rebuild.RebuildApp, error) {
+	return func() ([]rebuild.RebuildApp, error) {
+		apps, err := app.List(nil)
+		c.Assert(err, check.IsNil)
+		result := make([]rebuild.RebuildApp, len(apps))
+		for i := range apps {
+			result[i] = &apps[i]
+		}
+		return result, nil
+	}
+}
+
+func (s *S) TestAuditorRunOnce(c *check.C) {
+	a := app.App{Name: "my-test-app", TeamOwner: s.team.Name}
+	err := app.CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	err = provisiontest.ProvisionerInstance.AddUnits(&a, 1, "web", nil)
+	c.Assert(err, check.IsNil)
+	units, err := a.Units()
+	c.Assert(err, check.IsNil)
+	err = routertest.FakeRouter.RemoveRoutes(a.Name, []*url.URL{units[0].Address})
+	c.Assert(err, check.IsNil)
+	auditor := rebuild.NewAuditor(s.auditorApps(c), time.Minute)
+	err = auditor.RunOnce()
+	c.Assert(err, check.IsNil)
+	c.Assert(eventtest.EventDesc{
+		Target: event.Target{Type: event.TargetTypeApp, Value: a.Name},
+		Kind:   rebuild.EventKindRouterDrift,
+		StartCustomData: map[string]interface{}{
+			"fake.added": []string{units[0].Address.String()},
+		},
+		LogMatches: `router "fake" of app "my-test-app" differs from the expected state: 1 routes missing`,
+	}, eventtest.HasEvent)
+	c.Assert(routertest.FakeRouter.HasRoute(a.Name, units[0].Address.String()), check.Equals, false)
+	err = auditor.RunOnce()
+	c.Assert(err, check.IsNil)
+	n, err := s.conn.Events().Find(bson.M{"kind.name": rebuild.EventKindRouterDrift}).Count()
+	c.Assert(err, check.IsNil)
+	c.Assert(n, check.Equals, 1)
+}
+
+func (s *S) TestAuditorRunOnceNoDrift(c *check.C) {
+	a := app.App{Name: "my-test-app", TeamOwner: s.team.Name}
+	err := app.CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	err = provisiontest.ProvisionerInstance.AddUnits(&a, 1, "web", nil)
+	c.Assert(err, check.IsNil)
+	auditor := rebuild.NewAuditor(s.auditorApps(c), time.Minute)
+	err = auditor.RunOnce()
+	c.Assert(err, check.IsNil)
+	n, err := s.conn.Events().Find(bson.M{"kind.name": rebuild.EventKindRouterDrift}).Count()
+	c.Assert(err, check.IsNil)
+	c.Assert(n, check.Equals, 0)
+}
+
+func (s *S) TestAuditorRunOnceMultiBatchRouter(c *check.C) {
+	config.Set("routers:fake-batch:type", "fake-batch")
+	defer config.Unset("routers:fake-batch")
+	routertest.BatchRouter.Reset()
+	a := app.App{Name: "my-test-app", TeamOwner: s.team.Name, Router: "fake-batch"}
+	err := app.CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	err = provisiontest.ProvisionerInstance.AddUnits(&a, 1, "web", nil)
+	c.Assert(err, check.IsNil)
+	units, err := a.Units()
+	c.Assert(err, check.IsNil)
+	err = routertest.BatchRouter.RemoveRoutes(a.Name, []*url.URL{units[0].Address})
+	c.Assert(err, check.IsNil)
+	auditor := rebuild.NewAuditor(s.auditorApps(c), time.Minute)
+	err = auditor.RunOnce()
+	c.Assert(err, check.IsNil)
+	c.Assert(routertest.BatchRouter.MultiCalls, check.Equals, 1)
+	c.Assert(eventtest.EventDesc{
+		Target: event.Target{Type: event.TargetTypeApp, Value: a.Name},
+		Kind:   rebuild.EventKindRouterDrift,
+		StartCustomData: map[string]interface{}{
+			"fake-batch.added": []string{units[0].Address.String()},
+		},
+		LogMatches: `router "fake-batch" of app "my-test-app" differs from the expected state: 1 routes missing`,
+	}, eventtest.HasEvent)
+}
+
+func (s *S) TestAuditorRunOnceMultiBatchRouterFailure(c *check.C) {
+	config.Set("routers:fake-batch:type", "fake-batch")
+	defer config.Unset("routers:fake-batch")
+	routertest.BatchRouter.Reset()
+	a := app.App{Name: "my-test-app", TeamOwner: s.team.Name, Router: "fake-batch"}
+	err := app.CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	err = provisiontest.ProvisionerInstance.AddUnits(&a, 1, "web", nil)
+	c.Assert(err, check.IsNil)
+	units, err := a.Units()
+	c.Assert(err, check.IsNil)
+	err = routertest.BatchRouter.RemoveRoutes(a.Name, []*url.URL{units[0].Address})
+	c.Assert(err, check.IsNil)
+	routertest.BatchRouter.MultiRoutesFail = true
+	auditor := rebuild.NewAuditor(s.auditorApps(c), time.Minute)
+	err = auditor.RunOnce()
+	c.Assert(err, check.IsNil)
+	c.Assert(routertest.BatchRouter.MultiCalls, check.Equals, 1)
+	n, err := s.conn.Events().Find(bson.M{"kind.name": rebuild.EventKindRouterDrift}).Count()
+	c.Assert(err, check.IsNil)
+	c.Assert(n, check.Equals, 1)
+}
+
+func (s *S) TestAuditorRunOnceReportedByOtherInstance(c *check.C) {
+	a := app.App{Name: "my-test-app", TeamOwner: s.team.Name}
+	err := app.CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	err = provisiontest.ProvisionerInstance.AddUnits(&a, 1, "web", nil)
+	c.Assert(err, check.IsNil)
+	units, err := a.Units()
+	c.Assert(err, check.IsNil)
+	err = routertest.FakeRouter.RemoveRoutes(a.Name, []*url.URL{units[0].Address})
+	c.Assert(err, check.IsNil)
+	err = rebuild.NewAuditor(s.auditorApps(c), time.Minute).RunOnce()
+	c.Assert(err, check.IsNil)
+	err = rebuild.NewAuditor(s.auditorApps(c), time.Minute).RunOnce()
+	c.Assert(err, check.IsNil)
+	n, err := s.conn.Events().Find(bson.M{"kind.name": rebuild.EventKindRouterDrift}).Count()
+	c.Assert(err, check.IsNil)
+	c.Assert(n, check.Equals, 1)
+}
+
+func (s *S) TestAuditorRunOnceLocked(c *check.C) {
+	a := app.App{Name: "my-test-app", TeamOwner: s.team.Name}
+	err := app.CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	err = provisiontest.ProvisionerInstance.AddUnits(&a, 1, "web", nil)
+	c.Assert(err, check.IsNil)
+	units, err := a.Units()
+	c.Assert(err, check.IsNil)
+	err = routertest.FakeRouter.RemoveRoutes(a.Name, []*url.URL{units[0].Address})
+	c.Assert(err, check.IsNil)
+	evt, err := event.NewInternal(&event.Opts{
+		Target:       event.Target{Type: event.TargetTypeGlobal, Value: rebuild.EventKindRoutesAudit},
+		InternalKind: rebuild.EventKindRoutesAudit,
+		Allowed:      event.Allowed(permission.PermAppReadEvents),
+	})
+	c.Assert(err, check.IsNil)
+	defer evt.Abort()
+	err = rebuild.NewAuditor(s.auditorApps(c), time.Minute).RunOnce()
+	c.Assert(err, check.IsNil)
+	n, err := s.conn.Events().Find(bson.M{"kind.name": rebuild.EventKindRouterDrift}).Count()
+	c.Assert(err, check.IsNil)
+	c.Assert(n, check.Equals, 0)
+}
@@ -9,21 +9,47 @@ import (
 	"strings"
 
 	"github.com/tsuru/tsuru/log"
+	"github.com/tsuru/tsuru/provision"
 	"github.com/tsuru/tsuru/router"
 	appTypes "github.com/tsuru/tsuru/types/app"
 )
 
+// maxBatchAttempts is the number of times the routes of an app are read and
+// replaced in routers supporting batch operations, when they change
+// concurrently.
+const maxBatchAttempts = 3
+
 type RebuildRoutesResult struct {
 	Added   []string
 	Removed []string
+	Paths   map[string]RebuildRoutesResult `json:",omitempty"`
+	Ports   map[string]RebuildRoutesResult `json:",omitempty"`
+
+	// The fields below are only filled in DRY mode, reporting what is
+	// missing in the router without fixing it.
+	MissingBackend      bool     `json:",omitempty"`
+	MissingCNames       []string `json:",omitempty"`
+	MissingCertificates []string `json:",omitempty"`
+}
+
+// HasDrift returns whether the state of the router differs from the
+// expected state of the app.
+func (r *RebuildRoutesResult) HasDrift() bool {
+	return len(r.Added) > 0 || len(r.Removed) > 0 || len(r.Paths) > 0 || len(r.Ports) > 0 || r.MissingBackend ||
+		len(r.MissingCNames) > 0 || len(r.MissingCertificates) > 0
 }
 
 type RebuildApp interface {
 	router.App
 	GetCname() []string
+	GetCertificateNames() []string
 	GetRouters() []appTypes.AppRouter
 	GetHealthcheckData() (router.HealthcheckData, error)
 	RoutableAddresses() ([]url.URL, error)
+	GetProcessRoutes() []appTypes.ProcessRoute
+	ProcessRoutableAddresses(string) ([]url.URL, error)
+	GetPorts() ([]provision.AppPort, error)
+	PortRoutableAddresses(provision.AppPort) ([]url.URL, error)
 	InternalLock(string) (bool, error)
 	Unlock()
 }
@@ -46,6 +72,9 @@ func rebuildRoutesInRouter(app RebuildApp, dry bool, appRouter appTypes.AppRoute
 	if err != nil {
 		return nil, err
 	}
+	if dry {
+		return dryRebuildRoutesInRouter(app, r, nil)
+	}
 	if optsRouter, ok := r.(router.OptsRouter); ok {
 		err = optsRouter.AddBackendOpts(app, appRouter.Opts)
 	} else {
@@ -72,17 +101,271 @@ func rebuildRoutesInRouter(app RebuildApp, dry bool, appRouter appTypes.AppRoute
 			return nil, errHc
 		}
 	}
+	err = router.SetAccessControlFromOpts(r, app.GetName(), appRouter.Opts)
+	if err != nil {
+		return nil, err
+	}
+	var result RebuildRoutesResult
+	if batchRouter, ok := r.(router.BatchRouter); ok {
+		result, err = rebuildBatchRoutes(app, batchRouter)
+	} else {
+		result, err = rebuildRoutes(app, r)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if pathRouter, ok := r.(router.PathRouter); ok {
+		result.Paths, err = rebuildPathRoutes(app, false, pathRouter)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if l4Router, ok := r.(router.L4Router); ok {
+		result.Ports, err = rebuildPortRoutes(app, false, l4Router)
+		if err != nil {
+			return nil, err
+		}
+	}
+	log.Debugf("[rebuild-routes] routes added for app %q: %s", app.GetName(), strings.Join(result.Added, ", "))
+	log.Debugf("[rebuild-routes] routes removed for app %q: %s", app.GetName(), strings.Join(result.Removed, ", "))
+	return &result, nil
+}
+
+func rebuildRoutes(app RebuildApp, r router.Router) (RebuildRoutesResult, error) {
 	oldRoutes, err := r.Routes(app.GetName())
+	if err != nil {
+		return RebuildRoutesResult{}, err
+	}
+	log.Debugf("[rebuild-routes] old routes for app %q: %v", app.GetName(), oldRoutes)
+	addresses, err := app.RoutableAddresses()
+	if err != nil {
+		return RebuildRoutesResult{}, err
+	}
+	log.Debugf("[rebuild-routes] addresses for app %q: %v", app.GetName(), addresses)
+	toAdd, toRemove, result := diffRoutes(oldRoutes, addresses)
+	err = r.AddRoutes(app.GetName(), toAdd)
+	if err != nil {
+		return RebuildRoutesResult{}, err
+	}
+	err = r.RemoveRoutes(app.GetName(), toRemove)
+	if err != nil {
+		return RebuildRoutesResult{}, err
+	}
+	return result, nil
+}
+
+// rebuildBatchRoutes replaces the routes of the app in a single operation,
+// reading the routes again when they are changed concurrently.
+func rebuildBatchRoutes(app RebuildApp, r router.BatchRouter) (RebuildRoutesResult, error) {
+	for attempt := 1; ; attempt++ {
+		oldRoutes, version, err := r.VersionedRoutes(app.GetName())
+		if err != nil {
+			return RebuildRoutesResult{}, err
+		}
+		log.Debugf("[rebuild-routes] old routes for app %q (version %q): %v", app.GetName(), version, oldRoutes)
+		addresses, err := app.RoutableAddresses()
+		if err != nil {
+			return RebuildRoutesResult{}, err
+		}
+		log.Debugf("[rebuild-routes] addresses for app %q: %v", app.GetName(), addresses)
+		toAdd, toRemove, result := diffRoutes(oldRoutes, addresses)
+		if len(toAdd) == 0 && len(toRemove) == 0 {
+			return result, nil
+		}
+		routes := make([]*url.URL, len(addresses))
+		for i := range addresses {
+			routes[i] = &addresses[i]
+		}
+		err = r.SetRoutes(app.GetName(), routes, version)
+		if err == router.ErrRoutesVersionConflict && attempt < maxBatchAttempts {
+			log.Debugf("[rebuild-routes] routes of app %q changed concurrently, retrying", app.GetName())
+			continue
+		}
+		if err != nil {
+			return RebuildRoutesResult{}, err
+		}
+		return result, nil
+	}
+}
+
+// multiRoutesChunk is the number of backends whose routes are read at once
+// from routers implementing router.MultiBatchRouter.
+const multiRoutesChunk = 100
+
+// prefetchRoutes reads the routes of the apps from each router able to read
+// the routes of many backends at once, keyed by router and app name. Routers
+// failing are left out, the routes of each app being read individually.
+func prefetchRoutes(apps []RebuildApp) map[string]map[string]router.VersionedRoutes {
+	names := make(map[string][]string)
+	for _, app := range apps {
+		for _, appRouter := range app.GetRouters() {
+			names[appRouter.Name] = append(names[appRouter.Name], app.GetName())
+		}
+	}
+	prefetched := make(map[string]map[string]router.VersionedRoutes)
+	for routerName, appNames := range names {
+		r, err := router.Get(routerName)
+		if err != nil {
+			continue
+		}
+		multiRouter, ok := r.(router.MultiBatchRouter)
+		if !ok {
+			continue
+		}
+		routes, err := prefetchRouterRoutes(multiRouter, appNames)
+		if err != nil {
+			log.Errorf("[rebuild-routes] unable to read routes of many apps in router %q: %s", routerName, err)
+			continue
+		}
+		prefetched[routerName] = routes
+	}
+	return prefetched
+}
+
+func prefetchRouterRoutes(r router.MultiBatchRouter, names []string) (map[string]router.VersionedRoutes, error) {
+	result := make(map[string]router.VersionedRoutes, len(names))
+	for start := 0; start < len(names); start += multiRoutesChunk {
+		end := start + multiRoutesChunk
+		if end > len(names) {
+			end = len(names)
+		}
+		routes, err := r.VersionedRoutesMulti(names[start:end])
+		if err != nil {
+			return nil, err
+		}
+		for name, versioned := range routes {
+			result[name] = versioned
+		}
+	}
+	return result, nil
+}
+
+// dryRebuildRoutes works like RebuildRoutes in DRY mode, using the routes in
+// prefetched, as returned by prefetchRoutes, for the routers present there.
+func dryRebuildRoutes(app RebuildApp, prefetched map[string]map[string]router.VersionedRoutes) (map[string]RebuildRoutesResult, error) {
+	result := make(map[string]RebuildRoutesResult)
+	for _, appRouter := range app.GetRouters() {
+		r, err := router.Get(appRouter.Name)
+		if err != nil {
+			return nil, err
+		}
+		resultInRouter, err := dryRebuildRoutesInRouter(app, r, prefetched[appRouter.Name])
+		if err != nil {
+			return nil, err
+		}
+		result[appRouter.Name] = *resultInRouter
+	}
+	return result, nil
+}
+
+// dryRebuildRoutesInRouter compares the router with the app without changing
+// anything, also reporting a missing backend and missing cnames and
+// certificates. When prefetched is not nil, the routes of the app are taken
+// from it, the backend being missing when the app is not there.
+func dryRebuildRoutesInRouter(app RebuildApp, r router.Router, prefetched map[string]router.VersionedRoutes) (*RebuildRoutesResult, error) {
+	var result RebuildRoutesResult
+	var oldRoutes []*url.URL
+	var err error
+	if prefetched != nil {
+		versioned, ok := prefetched[app.GetName()]
+		result.MissingBackend = !ok
+		oldRoutes = versioned.Routes
+	} else {
+		_, err = r.Addr(app.GetName())
+		if err == router.ErrBackendNotFound || err == router.ErrRouteNotFound {
+			result.MissingBackend = true
+		} else if err != nil {
+			return nil, err
+		}
+		if !result.MissingBackend {
+			oldRoutes, err = r.Routes(app.GetName())
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	if !result.MissingBackend {
+		result.MissingCNames, err = missingCNames(app, r)
+		if err != nil {
+			return nil, err
+		}
+	} else if _, ok := r.(router.CNameRouter); ok {
+		result.MissingCNames = app.GetCname()
+	}
+	result.MissingCertificates, err = missingCertificates(app, r, result.MissingBackend)
 	if err != nil {
 		return nil, err
 	}
 	log.Debugf("[rebuild-routes] old routes for app %q: %v", app.GetName(), oldRoutes)
-	expectedMap := make(map[string]*url.URL)
 	addresses, err := app.RoutableAddresses()
 	if err != nil {
 		return nil, err
 	}
 	log.Debugf("[rebuild-routes] addresses for app %q: %v", app.GetName(), addresses)
+	_, _, routesResult := diffRoutes(oldRoutes, addresses)
+	result.Added, result.Removed = routesResult.Added, routesResult.Removed
+	if pathRouter, ok := r.(router.PathRouter); ok && !result.MissingBackend {
+		result.Paths, err = rebuildPathRoutes(app, true, pathRouter)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if l4Router, ok := r.(router.L4Router); ok && !result.MissingBackend {
+		result.Ports, err = rebuildPortRoutes(app, true, l4Router)
+		if err != nil {
+			return nil, err
+		}
+	}
+	log.Debugf("[rebuild-routes] nothing to do. DRY mode for app: %q", app.GetName())
+	return &result, nil
+}
+
+func missingCNames(app RebuildApp, r router.Router) ([]string, error) {
+	cnameRouter, ok := r.(router.CNameRouter)
+	if !ok {
+		return nil, nil
+	}
+	cnames, err := cnameRouter.CNames(app.GetName())
+	if err != nil {
+		return nil, err
+	}
+	existing := make(map[string]struct{}, len(cnames))
+	for _, cname := range cnames {
+		existing[cname.Host] = struct{}{}
+	}
+	var missing []string
+	for _, cname := range app.GetCname() {
+		if _, ok := existing[cname]; !ok {
+			missing = append(missing, cname)
+		}
+	}
+	return missing, nil
+}
+
+func missingCertificates(app RebuildApp, r router.Router, missingBackend bool) ([]string, error) {
+	tlsRouter, ok := r.(router.TLSRouter)
+	if !ok {
+		return nil, nil
+	}
+	if missingBackend {
+		return app.GetCertificateNames(), nil
+	}
+	var missing []string
+	for _, name := range app.GetCertificateNames() {
+		_, err := tlsRouter.GetCertificate(app, name)
+		if err == router.ErrCertificateNotFound {
+			missing = append(missing, name)
+		} else if err != nil {
+			return nil, err
+		}
+	}
+	return missing, nil
+}
+
+// diffRoutes returns the addresses missing in the current routes and the
+// routes not matching any of the addresses.
+func diffRoutes(oldRoutes []*url.URL, addresses []url.URL) ([]*url.URL, []*url.URL, RebuildRoutesResult) {
+	expectedMap := make(map[string]*url.URL)
 	for i, addr := range addresses {
 		expectedMap[addr.Host] = &addresses[i]
 	}
@@ -103,19 +386,124 @@ func rebuildRoutesInRouter(app RebuildApp, dry bool, appRouter appTypes.AppRoute
 	for _, toRemoveURL := range toRemove {
 		result.Removed = append(result.Removed, toRemoveURL.String())
 	}
-	if dry {
-		log.Debugf("[rebuild-routes] nothing to do. DRY mode for app: %q", app.GetName())
-		return &result, nil
+	return toAdd, toRemove, result
+}
+
+// rebuildPathRoutes makes the paths in the router match the process routes
+// of the app, removing paths no longer routed to a process.
+func rebuildPathRoutes(app RebuildApp, dry bool, r router.PathRouter) (map[string]RebuildRoutesResult, error) {
+	oldPaths, err := r.PathRoutes(app.GetName())
+	if err != nil {
+		return nil, err
 	}
-	err = r.AddRoutes(app.GetName(), toAdd)
+	results := make(map[string]RebuildRoutesResult)
+	for _, route := range app.GetProcessRoutes() {
+		addresses, err := app.ProcessRoutableAddresses(route.Process)
+		if err != nil {
+			return nil, err
+		}
+		oldRoutes, exists := oldPaths[route.Path]
+		delete(oldPaths, route.Path)
+		toAdd, toRemove, result := diffRoutes(oldRoutes, addresses)
+		if len(toAdd) > 0 || len(toRemove) > 0 {
+			results[route.Path] = result
+		}
+		if dry {
+			continue
+		}
+		if len(toAdd) > 0 || !exists {
+			err = r.AddPathRoutes(app.GetName(), route.Path, toAdd)
+			if err != nil {
+				return nil, err
+			}
+		}
+		if len(toRemove) > 0 {
+			err = r.RemovePathRoutes(app.GetName(), route.Path, toRemove)
+			if err != nil {
+				return nil, err
+			}
+		}
+		log.Debugf("[rebuild-routes] routes added for path %q of app %q: %s", route.Path, app.GetName(), strings.Join(result.Added, ", "))
+		log.Debugf("[rebuild-routes] routes removed for path %q of app %q: %s", route.Path, app.GetName(), strings.Join(result.Removed, ", "))
+	}
+	for path, oldRoutes := range oldPaths {
+		_, _, result := diffRoutes(oldRoutes, nil)
+		results[path] = result
+		if dry {
+			continue
+		}
+		err = r.RemovePath(app.GetName(), path)
+		if err != nil && err != router.ErrPathNotFound {
+			return nil, err
+		}
+		log.Debugf("[rebuild-routes] path %q removed for app %q", path, app.GetName())
+	}
+	if len(results) == 0 {
+		return nil, nil
+	}
+	return results, nil
+}
+
+// rebuildPortRoutes makes the ports in the router match the extra ports of
+// the app, removing ports no longer declared by the app.
+func rebuildPortRoutes(app RebuildApp, dry bool, r router.L4Router) (map[string]RebuildRoutesResult, error) {
+	routes, err := r.PortRoutes(app.GetName())
 	if err != nil {
 		return nil, err
 	}
-	err = r.RemoveRoutes(app.GetName(), toRemove)
+	oldPorts := make(map[string]router.L4Route, len(routes))
+	for _, route := range routes {
+		oldPorts[route.Name] = route
+	}
+	ports, err := app.GetPorts()
 	if err != nil {
 		return nil, err
 	}
-	log.Debugf("[rebuild-routes] routes added for app %q: %s", app.GetName(), strings.Join(result.Added, ", "))
-	log.Debugf("[rebuild-routes] routes removed for app %q: %s", app.GetName(), strings.Join(result.Removed, ", "))
-	return &result, nil
+	results := make(map[string]RebuildRoutesResult)
+	for _, port := range ports {
+		addresses, err := app.PortRoutableAddresses(port)
+		if err != nil {
+			return nil, err
+		}
+		l4Port := router.L4Port{Name: port.Name, Protocol: port.GetProtocol()}
+		oldPort, exists := oldPorts[port.Name]
+		delete(oldPorts, port.Name)
+		toAdd, toRemove, result := diffRoutes(oldPort.Routes, addresses)
+		if len(toAdd) > 0 || len(toRemove) > 0 {
+			results[port.Name] = result
+		}
+		if dry {
+			continue
+		}
+		if len(toAdd) > 0 || !exists || oldPort.L4Port != l4Port {
+			err = r.AddPortRoutes(app.GetName(), l4Port, toAdd)
+			if err != nil {
+				return nil, err
+			}
+		}
+		if len(toRemove) > 0 {
+			err = r.RemovePortRoutes(app.GetName(), port.Name, toRemove)
+			if err != nil {
+				return nil, err
+			}
+		}
+		log.Debugf("[rebuild-routes] routes added for port %q of app %q: %s", port.Name, app.GetName(), strings.Join(result.Added, ", "))
+		log.Debugf("[rebuild-routes] routes removed for port %q of app %q: %s", port.Name, app.GetName(), strings.Join(result.Removed, ", "))
+	}
+	for name, oldPort := range oldPorts {
+		_, _, result := diffRoutes(oldPort.Routes, nil)
+		results[name] = result
+		if dry {
+			continue
+		}
+		err = r.RemovePort(app.GetName(), name)
+		if err != nil && err != router.ErrPortNotFound {
+			return nil, err
+		}
+		log.Debugf("[rebuild-routes] port %q removed for app %q", name, app.GetName())
+	}
+	if len(results) == 0 {
+		return nil, nil
+	}
+	return results, nil
 }
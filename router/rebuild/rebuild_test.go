@@ -9,12 +9,15 @@ import (
 	"net/url"
 	"sort"
 
+	"github.com/tsuru/config"
 	"github.com/tsuru/tsuru/app"
 	"github.com/tsuru/tsuru/app/image"
+	"github.com/tsuru/tsuru/provision"
 	"github.com/tsuru/tsuru/provision/provisiontest"
 	"github.com/tsuru/tsuru/router"
 	"github.com/tsuru/tsuru/router/rebuild"
 	"github.com/tsuru/tsuru/router/routertest"
+	appTypes "github.com/tsuru/tsuru/types/app"
 	"gopkg.in/check.v1"
 )
 
@@ -70,6 +73,63 @@ func (s *S) TestRebuildRoutesDRY(c *check.C) {
 	c.Assert(routertest.FakeRouter.HasRoute(a.Name, units[2].Address.String()), check.Equals, false)
 }
 
+func (s *S) TestRebuildRoutesDRYMissingCNames(c *check.C) {
+	a := app.App{Name: "my-test-app", TeamOwner: s.team.Name}
+	err := app.CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	err = a.AddCName("my.cname.com", "other.cname.com")
+	c.Assert(err, check.IsNil)
+	err = routertest.FakeRouter.UnsetCName("my.cname.com", a.Name)
+	c.Assert(err, check.IsNil)
+	changes, err := rebuild.RebuildRoutes(&a, true)
+	c.Assert(err, check.IsNil)
+	c.Assert(changes, check.DeepEquals, map[string]rebuild.RebuildRoutesResult{
+		"fake": {MissingCNames: []string{"my.cname.com"}},
+	})
+	c.Assert(routertest.FakeRouter.HasCName("my.cname.com"), check.Equals, false)
+}
+
+func (s *S) TestRebuildRoutesDRYMissingBackend(c *check.C) {
+	a := app.App{Name: "my-test-app", TeamOwner: s.team.Name}
+	err := app.CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	err = provisiontest.ProvisionerInstance.AddUnits(&a, 1, "web", nil)
+	c.Assert(err, check.IsNil)
+	units, err := a.Units()
+	c.Assert(err, check.IsNil)
+	err = a.AddCName("my.cname.com")
+	c.Assert(err, check.IsNil)
+	err = routertest.FakeRouter.RemoveBackend(a.Name)
+	c.Assert(err, check.IsNil)
+	changes, err := rebuild.RebuildRoutes(&a, true)
+	c.Assert(err, check.IsNil)
+	c.Assert(changes, check.DeepEquals, map[string]rebuild.RebuildRoutesResult{
+		"fake": {
+			Added:          []string{units[0].Address.String()},
+			MissingBackend: true,
+			MissingCNames:  []string{"my.cname.com"},
+		},
+	})
+	c.Assert(routertest.FakeRouter.HasBackend(a.Name), check.Equals, false)
+}
+
+func (s *S) TestRebuildRoutesDRYMissingCertificates(c *check.C) {
+	config.Set("routers:fake-tls:type", "fake-tls")
+	defer config.Unset("routers:fake-tls")
+	routertest.TLSRouter.Reset()
+	a := app.App{Name: "my-test-app", TeamOwner: s.team.Name, Router: "fake-tls"}
+	err := app.CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	a.Certificates = []app.CertificateInfo{{Name: "my.cname.com"}, {Name: "other.cname.com"}}
+	err = routertest.TLSRouter.AddCertificate(&a, "other.cname.com", "cert", "key")
+	c.Assert(err, check.IsNil)
+	changes, err := rebuild.RebuildRoutes(&a, true)
+	c.Assert(err, check.IsNil)
+	c.Assert(changes, check.DeepEquals, map[string]rebuild.RebuildRoutesResult{
+		"fake-tls": {MissingCertificates: []string{"my.cname.com"}},
+	})
+}
+
 func (s *S) TestRebuildRoutesTCPRoutes(c *check.C) {
 	a := app.App{Name: "my-test-app", TeamOwner: s.team.Name}
 	err := app.CreateApp(&a, s.user)
@@ -104,6 +164,40 @@ func (l URLList) Len() int           { return len(l) }
 func (l URLList) Swap(i, j int)      { l[i], l[j] = l[j], l[i] }
 func (l URLList) Less(i, j int) bool { return l[i].String() < l[j].String() }
 
+func (s *S) TestRebuildRoutesBatchRouter(c *check.C) {
+	config.Set("routers:fake-batch:type", "fake-batch")
+	defer config.Unset("routers:fake-batch")
+	routertest.BatchRouter.Reset()
+	a := app.App{Name: "my-test-app", TeamOwner: s.team.Name, Router: "fake-batch"}
+	err := app.CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	err = provisiontest.ProvisionerInstance.AddUnits(&a, 2, "web", nil)
+	c.Assert(err, check.IsNil)
+	units, err := a.Units()
+	c.Assert(err, check.IsNil)
+	routertest.BatchRouter.RemoveRoutes(a.Name, []*url.URL{units[1].Address})
+	routertest.BatchRouter.AddRoutes(a.Name, []*url.URL{{Scheme: "http", Host: "invalid:1234"}})
+	routertest.BatchRouter.Conflicts = 1
+	changes, err := rebuild.RebuildRoutes(&a, false)
+	c.Assert(err, check.IsNil)
+	c.Assert(changes, check.DeepEquals, map[string]rebuild.RebuildRoutesResult{
+		"fake-batch": {
+			Added:   []string{units[1].Address.String()},
+			Removed: []string{"http://invalid:1234"},
+		},
+	})
+	c.Assert(routertest.BatchRouter.SetRoutesCalls, check.Equals, 2)
+	routes, err := routertest.BatchRouter.Routes(a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(routes, check.HasLen, 2)
+	c.Assert(routertest.BatchRouter.HasRoute(a.Name, units[0].Address.String()), check.Equals, true)
+	c.Assert(routertest.BatchRouter.HasRoute(a.Name, units[1].Address.String()), check.Equals, true)
+	changes, err = rebuild.RebuildRoutes(&a, false)
+	c.Assert(err, check.IsNil)
+	c.Assert(changes["fake-batch"], check.DeepEquals, rebuild.RebuildRoutesResult{})
+	c.Assert(routertest.BatchRouter.SetRoutesCalls, check.Equals, 2)
+}
+
 func (s *S) TestRebuildRoutesAfterSwap(c *check.C) {
 	a1 := app.App{Name: "my-test-app-1", TeamOwner: s.team.Name}
 	err := app.CreateApp(&a1, s.user)
@@ -257,3 +351,93 @@ func (s *S) TestRebuildRoutesSetsHealthcheck(c *check.C) {
 	}
 	c.Assert(routertest.FakeRouter.GetHealthcheck("my-test-app"), check.DeepEquals, expected)
 }
+
+func (s *S) TestRebuildRoutesPathRoutes(c *check.C) {
+	config.Set("routers:fake-path:type", "fake-path")
+	defer config.Unset("routers:fake-path")
+	routertest.PathRouter.Reset()
+	a := app.App{Name: "my-test-app", TeamOwner: s.team.Name, Router: "fake-path"}
+	err := app.CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	err = provisiontest.ProvisionerInstance.AddUnits(&a, 1, "web", nil)
+	c.Assert(err, check.IsNil)
+	err = provisiontest.ProvisionerInstance.AddUnits(&a, 1, "api", nil)
+	c.Assert(err, check.IsNil)
+	apiAddrs, err := a.ProcessRoutableAddresses("api")
+	c.Assert(err, check.IsNil)
+	c.Assert(apiAddrs, check.HasLen, 1)
+	err = routertest.PathRouter.AddPathRoutes(a.Name, "/old", []*url.URL{{Scheme: "http", Host: "invalid:1234"}})
+	c.Assert(err, check.IsNil)
+	a.ProcessRoutes = []appTypes.ProcessRoute{
+		{Path: "/api", Process: "api"},
+		{Path: "/worker", Process: "worker"},
+	}
+	changes, err := rebuild.RebuildRoutes(&a, true)
+	c.Assert(err, check.IsNil)
+	expectedPaths := map[string]rebuild.RebuildRoutesResult{
+		"/api": {Added: []string{apiAddrs[0].String()}},
+		"/old": {Removed: []string{"http://invalid:1234"}},
+	}
+	c.Assert(changes["fake-path"].Paths, check.DeepEquals, expectedPaths)
+	c.Assert(routertest.PathRouter.Paths[a.Name], check.DeepEquals, map[string][]string{"/old": {"invalid:1234"}})
+	changes, err = rebuild.RebuildRoutes(&a, false)
+	c.Assert(err, check.IsNil)
+	c.Assert(changes["fake-path"].Paths, check.DeepEquals, expectedPaths)
+	c.Assert(routertest.PathRouter.Paths[a.Name], check.DeepEquals, map[string][]string{
+		"/api":    {apiAddrs[0].Host},
+		"/worker": {},
+	})
+	changes, err = rebuild.RebuildRoutes(&a, false)
+	c.Assert(err, check.IsNil)
+	c.Assert(changes["fake-path"].Paths, check.IsNil)
+}
+
+func (s *S) TestRebuildRoutesPortRoutes(c *check.C) {
+	config.Set("routers:fake-l4:type", "fake-l4")
+	defer config.Unset("routers:fake-l4")
+	routertest.L4Router.Reset()
+	a := app.App{Name: "my-test-app", TeamOwner: s.team.Name, Router: "fake-l4"}
+	err := app.CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	err = image.SaveImageCustomData("registry.somewhere/tsuru/app-my-test-app:v1", map[string]interface{}{
+		"processes": map[string]interface{}{"web": "./web", "api": "./api"},
+		"ports": []provision.AppPort{
+			{Name: "mqtt", Port: 1883},
+			{Name: "grpc", Port: 9000, Protocol: "grpc", Process: "api"},
+		},
+	})
+	c.Assert(err, check.IsNil)
+	err = image.AppendAppImageName(a.Name, "registry.somewhere/tsuru/app-my-test-app:v1")
+	c.Assert(err, check.IsNil)
+	err = provisiontest.ProvisionerInstance.AddUnits(&a, 1, "web", nil)
+	c.Assert(err, check.IsNil)
+	err = provisiontest.ProvisionerInstance.AddUnits(&a, 1, "api", nil)
+	c.Assert(err, check.IsNil)
+	webAddrs, err := a.ProcessRoutableAddresses("web")
+	c.Assert(err, check.IsNil)
+	apiAddrs, err := a.ProcessRoutableAddresses("api")
+	c.Assert(err, check.IsNil)
+	mqttAddr := "tcp://" + webAddrs[0].Hostname() + ":1883"
+	grpcAddr := "grpc://" + apiAddrs[0].Hostname() + ":9000"
+	err = routertest.L4Router.AddPortRoutes(a.Name, router.L4Port{Name: "old", Protocol: "udp"}, []*url.URL{{Scheme: "udp", Host: "invalid:53"}})
+	c.Assert(err, check.IsNil)
+	changes, err := rebuild.RebuildRoutes(&a, true)
+	c.Assert(err, check.IsNil)
+	expectedPorts := map[string]rebuild.RebuildRoutesResult{
+		"mqtt": {Added: []string{mqttAddr}},
+		"grpc": {Added: []string{grpcAddr}},
+		"old":  {Removed: []string{"udp://invalid:53"}},
+	}
+	c.Assert(changes["fake-l4"].Ports, check.DeepEquals, expectedPorts)
+	c.Assert(routertest.L4Router.Ports[a.Name], check.HasLen, 1)
+	changes, err = rebuild.RebuildRoutes(&a, false)
+	c.Assert(err, check.IsNil)
+	c.Assert(changes["fake-l4"].Ports, check.DeepEquals, expectedPorts)
+	c.Assert(routertest.L4Router.Ports[a.Name], check.DeepEquals, map[string]*routertest.FakeL4Port{
+		"mqtt": {Protocol: "tcp", Routes: []string{webAddrs[0].Hostname() + ":1883"}},
+		"grpc": {Protocol: "grpc", Routes: []string{apiAddrs[0].Hostname() + ":9000"}},
+	})
+	changes, err = rebuild.RebuildRoutes(&a, false)
+	c.Assert(err, check.IsNil)
+	c.Assert(changes["fake-l4"].Ports, check.IsNil)
+}
@@ -32,6 +32,9 @@ var (
 	ErrCNameNotFound         = errors.New("CName not found")
 	ErrCNameNotAllowed       = errors.New("CName as router subdomain not allowed")
 	ErrCertificateNotFound   = errors.New("Certificate not found")
+	ErrPathNotFound          = errors.New("Path not found")
+	ErrPortNotFound          = errors.New("Port not found")
+	ErrRoutesVersionConflict = errors.New("Routes changed since they were read")
 	ErrDefaultRouterNotFound = errors.New("No default router found")
 )
 
@@ -143,6 +146,13 @@ type MessageRouter interface {
 	StartupMessage() (string, error)
 }
 
+// SyncRouter is implemented by routers keeping a local copy of the routes,
+// StartSync is called once, when tsuru starts, and keeps the copy up to date
+// with the changes made by other tsuru instances.
+type SyncRouter interface {
+	StartSync() error
+}
+
 type CustomHealthcheckRouter interface {
 	SetHealthcheck(name string, data HealthcheckData) error
 }
@@ -156,6 +166,79 @@ type OptsRouter interface {
 	UpdateBackendOpts(app App, opts map[string]string) error
 }
 
+// WeightedRouter is a router able to split the traffic of a backend between
+// two groups of routes. The addresses passed to SetRoutesWeight must already
+// be routes of the backend and will receive weight percent of the requests,
+// the remaining routes receiving the rest.
+type WeightedRouter interface {
+	SetRoutesWeight(name string, addresses []*url.URL, weight int) error
+	RemoveRoutesWeight(name string) error
+}
+
+// PathRouter is a router able to send the requests whose path starts with a
+// prefix to routes other than the ones added with AddRoutes. When more than
+// one path matches a request, the longest one is used.
+type PathRouter interface {
+	AddPathRoutes(name, path string, addresses []*url.URL) error
+	RemovePathRoutes(name, path string, addresses []*url.URL) error
+	RemovePath(name, path string) error
+
+	// PathRoutes returns the routes of each path of a backend.
+	PathRoutes(name string) (map[string][]*url.URL, error)
+}
+
+// BatchRouter is a router able to replace all routes of a backend in a
+// single operation. The version returned by VersionedRoutes allows optimistic
+// concurrency: SetRoutes fails with ErrRoutesVersionConflict when the routes
+// changed since they were read. An empty version skips the check.
+type BatchRouter interface {
+	VersionedRoutes(name string) ([]*url.URL, string, error)
+	SetRoutes(name string, addresses []*url.URL, version string) error
+}
+
+// VersionedRoutes are the routes of a backend along with their version.
+type VersionedRoutes struct {
+	Routes  []*url.URL
+	Version string
+}
+
+// MultiBatchRouter is a BatchRouter able to read the routes of many backends
+// in a single operation.
+type MultiBatchRouter interface {
+	BatchRouter
+
+	// VersionedRoutesMulti returns the routes of each backend, keyed by the
+	// given names. Backends not found are left out.
+	VersionedRoutesMulti(names []string) (map[string]VersionedRoutes, error)
+}
+
+// L4Port identifies a port of a backend routed at the transport level.
+// Protocol is either tcp, udp or grpc.
+type L4Port struct {
+	Name     string
+	Protocol string
+}
+
+// L4Route describes a port of a backend in the router, Address is the
+// public address assigned by the router to the port.
+type L4Route struct {
+	L4Port
+	Address string
+	Routes  []*url.URL
+}
+
+// L4Router is a router able to route TCP and UDP traffic to ports other
+// than the HTTP port of the web process of an app. Each port gets its own
+// public address.
+type L4Router interface {
+	AddPortRoutes(name string, port L4Port, addresses []*url.URL) error
+	RemovePortRoutes(name, portName string, addresses []*url.URL) error
+	RemovePort(name, portName string) error
+
+	// PortRoutes returns the ports of a backend, sorted by name.
+	PortRoutes(name string) ([]L4Route, error)
+}
+
 // TLSRouter is a router that supports adding and removing
 // certificates for a given cname
 type TLSRouter interface {
@@ -326,7 +409,11 @@ func swapCnames(r Router, backend1, backend2 string) error {
 	return nil
 }
 
-func swapBackends(r Router, backend1, backend2 string) error {
+// SwapRoutes exchanges the routes of two backends without changing the
+// backend associated with each name, unlike Swap. New routes are added before
+// the old ones are removed, so both backends keep serving requests during the
+// exchange.
+func SwapRoutes(r Router, backend1, backend2 string) error {
 	routes1, err := r.Routes(backend1)
 	if err != nil {
 		return err
@@ -347,12 +434,15 @@ func swapBackends(r Router, backend1, backend2 string) error {
 	if err != nil {
 		return err
 	}
-	err = r.RemoveRoutes(backend2, routes2)
+	return r.RemoveRoutes(backend2, routes2)
+}
+
+func swapBackends(r Router, backend1, backend2 string) error {
+	err := SwapRoutes(r, backend1, backend2)
 	if err != nil {
 		return err
 	}
 	return swapBackendName(backend1, backend2)
-
 }
 
 func Swap(r Router, backend1, backend2 string, cnameOnly bool) error {
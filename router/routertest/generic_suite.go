@@ -629,3 +629,155 @@ func (s *RouterSuite) TestGetStatus(c *check.C) {
 	err = s.Router.RemoveBackend(testBackend1)
 	c.Assert(err, check.IsNil)
 }
+
+func (s *RouterSuite) TestPathRoutes(c *check.C) {
+	pathRouter, ok := s.Router.(router.PathRouter)
+	if !ok {
+		c.Skip(fmt.Sprintf("%T does not implement PathRouter", s.Router))
+	}
+	err := s.Router.AddBackend(FakeApp{Name: testBackend1})
+	c.Assert(err, check.IsNil)
+	addr1, err := url.Parse("http://10.10.10.10:8080")
+	c.Assert(err, check.IsNil)
+	addr2, err := url.Parse("http://10.10.10.11:8080")
+	c.Assert(err, check.IsNil)
+	err = s.Router.AddRoutes(testBackend1, []*url.URL{addr1})
+	c.Assert(err, check.IsNil)
+	err = pathRouter.AddPathRoutes(testBackend1, "/api", []*url.URL{addr2})
+	c.Assert(err, check.IsNil)
+	err = pathRouter.AddPathRoutes(testBackend1, "/api", []*url.URL{addr1, addr2})
+	c.Assert(err, check.IsNil)
+	err = pathRouter.AddPathRoutes(testBackend1, "/static", nil)
+	c.Assert(err, check.IsNil)
+	paths, err := pathRouter.PathRoutes(testBackend1)
+	c.Assert(err, check.IsNil)
+	c.Assert(paths, check.HasLen, 2)
+	sort.Sort(URLList(paths["/api"]))
+	c.Assert(paths["/api"], HostEquals, []*url.URL{addr1, addr2})
+	c.Assert(paths["/static"], HostEquals, []*url.URL{})
+	routes, err := s.Router.Routes(testBackend1)
+	c.Assert(err, check.IsNil)
+	c.Assert(routes, HostEquals, []*url.URL{addr1})
+	err = pathRouter.RemovePathRoutes(testBackend1, "/api", []*url.URL{addr1})
+	c.Assert(err, check.IsNil)
+	err = pathRouter.RemovePath(testBackend1, "/static")
+	c.Assert(err, check.IsNil)
+	paths, err = pathRouter.PathRoutes(testBackend1)
+	c.Assert(err, check.IsNil)
+	c.Assert(paths, check.HasLen, 1)
+	c.Assert(paths["/api"], HostEquals, []*url.URL{addr2})
+	err = s.Router.RemoveBackend(testBackend1)
+	c.Assert(err, check.IsNil)
+}
+
+func (s *RouterSuite) TestPathNotFound(c *check.C) {
+	pathRouter, ok := s.Router.(router.PathRouter)
+	if !ok {
+		c.Skip(fmt.Sprintf("%T does not implement PathRouter", s.Router))
+	}
+	err := s.Router.AddBackend(FakeApp{Name: testBackend1})
+	c.Assert(err, check.IsNil)
+	addr1, err := url.Parse("http://10.10.10.10:8080")
+	c.Assert(err, check.IsNil)
+	err = pathRouter.RemovePathRoutes(testBackend1, "/api", []*url.URL{addr1})
+	c.Assert(err, check.Equals, router.ErrPathNotFound)
+	err = pathRouter.RemovePath(testBackend1, "/api")
+	c.Assert(err, check.Equals, router.ErrPathNotFound)
+	err = s.Router.RemoveBackend(testBackend1)
+	c.Assert(err, check.IsNil)
+}
+
+func (s *RouterSuite) TestPortRoutes(c *check.C) {
+	l4Router, ok := s.Router.(router.L4Router)
+	if !ok {
+		c.Skip(fmt.Sprintf("%T does not implement L4Router", s.Router))
+	}
+	err := s.Router.AddBackend(FakeApp{Name: testBackend1})
+	c.Assert(err, check.IsNil)
+	addr1, err := url.Parse("tcp://10.10.10.10:1883")
+	c.Assert(err, check.IsNil)
+	addr2, err := url.Parse("tcp://10.10.10.11:1883")
+	c.Assert(err, check.IsNil)
+	mqtt := router.L4Port{Name: "mqtt", Protocol: "tcp"}
+	err = l4Router.AddPortRoutes(testBackend1, mqtt, []*url.URL{addr1})
+	c.Assert(err, check.IsNil)
+	err = l4Router.AddPortRoutes(testBackend1, mqtt, []*url.URL{addr1, addr2})
+	c.Assert(err, check.IsNil)
+	err = l4Router.AddPortRoutes(testBackend1, router.L4Port{Name: "dns", Protocol: "udp"}, nil)
+	c.Assert(err, check.IsNil)
+	ports, err := l4Router.PortRoutes(testBackend1)
+	c.Assert(err, check.IsNil)
+	c.Assert(ports, check.HasLen, 2)
+	c.Assert(ports[0].L4Port, check.DeepEquals, router.L4Port{Name: "dns", Protocol: "udp"})
+	c.Assert(ports[0].Routes, HostEquals, []*url.URL{})
+	c.Assert(ports[1].L4Port, check.DeepEquals, mqtt)
+	c.Assert(ports[1].Address, check.Not(check.Equals), "")
+	sort.Sort(URLList(ports[1].Routes))
+	c.Assert(ports[1].Routes, HostEquals, []*url.URL{addr1, addr2})
+	routes, err := s.Router.Routes(testBackend1)
+	c.Assert(err, check.IsNil)
+	c.Assert(routes, HostEquals, []*url.URL{})
+	err = l4Router.RemovePortRoutes(testBackend1, "mqtt", []*url.URL{addr1})
+	c.Assert(err, check.IsNil)
+	err = l4Router.RemovePort(testBackend1, "dns")
+	c.Assert(err, check.IsNil)
+	ports, err = l4Router.PortRoutes(testBackend1)
+	c.Assert(err, check.IsNil)
+	c.Assert(ports, check.HasLen, 1)
+	c.Assert(ports[0].Routes, HostEquals, []*url.URL{addr2})
+	err = s.Router.RemoveBackend(testBackend1)
+	c.Assert(err, check.IsNil)
+}
+
+func (s *RouterSuite) TestPortNotFound(c *check.C) {
+	l4Router, ok := s.Router.(router.L4Router)
+	if !ok {
+		c.Skip(fmt.Sprintf("%T does not implement L4Router", s.Router))
+	}
+	err := s.Router.AddBackend(FakeApp{Name: testBackend1})
+	c.Assert(err, check.IsNil)
+	addr1, err := url.Parse("tcp://10.10.10.10:1883")
+	c.Assert(err, check.IsNil)
+	err = l4Router.RemovePortRoutes(testBackend1, "mqtt", []*url.URL{addr1})
+	c.Assert(err, check.Equals, router.ErrPortNotFound)
+	err = l4Router.RemovePort(testBackend1, "mqtt")
+	c.Assert(err, check.Equals, router.ErrPortNotFound)
+	err = s.Router.RemoveBackend(testBackend1)
+	c.Assert(err, check.IsNil)
+}
+
+func (s *RouterSuite) TestSetRoutes(c *check.C) {
+	batchRouter, ok := s.Router.(router.BatchRouter)
+	if !ok {
+		c.Skip(fmt.Sprintf("%T does not implement BatchRouter", s.Router))
+	}
+	err := s.Router.AddBackend(FakeApp{Name: testBackend1})
+	c.Assert(err, check.IsNil)
+	addr1, err := url.Parse("http://10.10.10.10:8080")
+	c.Assert(err, check.IsNil)
+	addr2, err := url.Parse("http://10.10.10.11:8080")
+	c.Assert(err, check.IsNil)
+	addr3, err := url.Parse("http://10.10.10.12:8080")
+	c.Assert(err, check.IsNil)
+	err = s.Router.AddRoutes(testBackend1, []*url.URL{addr1, addr2})
+	c.Assert(err, check.IsNil)
+	routes, version, err := batchRouter.VersionedRoutes(testBackend1)
+	c.Assert(err, check.IsNil)
+	sort.Sort(URLList(routes))
+	c.Assert(routes, HostEquals, []*url.URL{addr1, addr2})
+	err = batchRouter.SetRoutes(testBackend1, []*url.URL{addr2, addr3}, version)
+	c.Assert(err, check.IsNil)
+	routes, err = s.Router.Routes(testBackend1)
+	c.Assert(err, check.IsNil)
+	sort.Sort(URLList(routes))
+	c.Assert(routes, HostEquals, []*url.URL{addr2, addr3})
+	err = batchRouter.SetRoutes(testBackend1, []*url.URL{addr1}, version)
+	c.Assert(err, check.Equals, router.ErrRoutesVersionConflict)
+	err = batchRouter.SetRoutes(testBackend1, []*url.URL{addr1}, "")
+	c.Assert(err, check.IsNil)
+	routes, err = s.Router.Routes(testBackend1)
+	c.Assert(err, check.IsNil)
+	c.Assert(routes, HostEquals, []*url.URL{addr1})
+	err = s.Router.RemoveBackend(testBackend1)
+	c.Assert(err, check.IsNil)
+}
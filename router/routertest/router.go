@@ -7,6 +7,7 @@ package routertest
 import (
 	"fmt"
 	"net/url"
+	"sort"
 	"strings"
 	"sync"
 
@@ -39,6 +40,28 @@ var TLSRouter = tlsRouter{
 	Keys:       make(map[string]string),
 }
 
+var WeightedRouter = weightedRouter{
+	fakeRouter: newFakeRouter(),
+	Weights:    make(map[string]RoutesWeight),
+}
+
+var AccessControlRouter = accessControlRouter{
+	fakeRouter: newFakeRouter(),
+	Rules:      make(map[string]router.AccessControl),
+}
+
+var PathRouter = pathRouter{
+	fakeRouter: newFakeRouter(),
+	Paths:      make(map[string]map[string][]string),
+}
+
+var L4Router = l4Router{
+	fakeRouter: newFakeRouter(),
+	Ports:      make(map[string]map[string]*FakeL4Port),
+}
+
+var BatchRouter = batchRouter{fakeRouter: newFakeRouter()}
+
 var ErrForcedFailure = errors.New("Forced failure")
 
 func init() {
@@ -48,6 +71,11 @@ func init() {
 	router.Register("fake-opts", createOptsRouter)
 	router.Register("fake-info", createInfoRouter)
 	router.Register("fake-status", createStatusRouter)
+	router.Register("fake-weighted", createWeightedRouter)
+	router.Register("fake-access-control", createAccessControlRouter)
+	router.Register("fake-path", createPathRouter)
+	router.Register("fake-l4", createL4Router)
+	router.Register("fake-batch", createBatchRouter)
 }
 
 func createRouter(name, prefix string) (router.Router, error) {
@@ -74,6 +102,26 @@ func createStatusRouter(name, prefix string) (router.Router, error) {
 	return &StatusRouter, nil
 }
 
+func createWeightedRouter(name, prefix string) (router.Router, error) {
+	return &WeightedRouter, nil
+}
+
+func createAccessControlRouter(name, prefix string) (router.Router, error) {
+	return &AccessControlRouter, nil
+}
+
+func createPathRouter(name, prefix string) (router.Router, error) {
+	return &PathRouter, nil
+}
+
+func createL4Router(name, prefix string) (router.Router, error) {
+	return &L4Router, nil
+}
+
+func createBatchRouter(name, prefix string) (router.Router, error) {
+	return &BatchRouter, nil
+}
+
 func newFakeRouter() fakeRouter {
 	return fakeRouter{cnames: make(map[string]string), backends: make(map[string][]string), failuresByIp: make(map[string]bool), healthcheck: make(map[string]router.HealthcheckData), mutex: &sync.Mutex{}}
 }
@@ -507,3 +555,407 @@ func (r *statusRouter) Reset() {
 	r.Status = router.BackendStatusReady
 	r.StatusDetail = ""
 }
+
+type RoutesWeight struct {
+	Routes []string
+	Weight int
+}
+
+type weightedRouter struct {
+	fakeRouter
+	Weights map[string]RoutesWeight
+}
+
+var _ router.WeightedRouter = &weightedRouter{}
+
+func (r *weightedRouter) SetRoutesWeight(name string, addresses []*url.URL, weight int) error {
+	backendName, err := router.Retrieve(name)
+	if err != nil {
+		return err
+	}
+	if weight < 0 || weight > 100 {
+		return errors.Errorf("invalid weight %d", weight)
+	}
+	routes := make([]string, len(addresses))
+	for i, addr := range addresses {
+		if !r.HasRoute(backendName, addr.String()) {
+			return errors.Errorf("route %s not found in backend %s", addr, backendName)
+		}
+		routes[i] = addr.Host
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.Weights[backendName] = RoutesWeight{Routes: routes, Weight: weight}
+	return nil
+}
+
+func (r *weightedRouter) RemoveRoutesWeight(name string) error {
+	backendName, err := router.Retrieve(name)
+	if err != nil {
+		return err
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	delete(r.Weights, backendName)
+	return nil
+}
+
+func (r *weightedRouter) Reset() {
+	r.fakeRouter.Reset()
+	r.Weights = make(map[string]RoutesWeight)
+}
+
+type accessControlRouter struct {
+	fakeRouter
+	Rules map[string]router.AccessControl
+}
+
+var _ router.AccessControlRouter = &accessControlRouter{}
+
+func (r *accessControlRouter) SetAccessControl(name string, ac router.AccessControl) error {
+	r.mutex.Lock()
+	failed := r.failuresByIp["access-control:"+name]
+	r.mutex.Unlock()
+	if failed {
+		return ErrForcedFailure
+	}
+	backendName, err := router.Retrieve(name)
+	if err != nil {
+		return err
+	}
+	if !r.HasBackend(backendName) {
+		return router.ErrBackendNotFound
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.Rules[backendName] = ac
+	return nil
+}
+
+func (r *accessControlRouter) GetAccessControl(name string) (router.AccessControl, error) {
+	backendName, err := router.Retrieve(name)
+	if err != nil {
+		return router.AccessControl{}, err
+	}
+	if !r.HasBackend(backendName) {
+		return router.AccessControl{}, router.ErrBackendNotFound
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.Rules[backendName], nil
+}
+
+func (r *accessControlRouter) Reset() {
+	r.fakeRouter.Reset()
+	r.Rules = make(map[string]router.AccessControl)
+}
+
+type pathRouter struct {
+	fakeRouter
+	Paths map[string]map[string][]string
+}
+
+var _ router.PathRouter = &pathRouter{}
+
+func (r *pathRouter) AddPathRoutes(name, path string, addresses []*url.URL) error {
+	backendName, err := router.Retrieve(name)
+	if err != nil {
+		return err
+	}
+	if !r.HasBackend(backendName) {
+		return router.ErrBackendNotFound
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	for _, addr := range addresses {
+		if r.failuresByIp[addr.Host] {
+			return ErrForcedFailure
+		}
+	}
+	if r.Paths[backendName] == nil {
+		r.Paths[backendName] = make(map[string][]string)
+	}
+	routes := r.Paths[backendName][path]
+	if routes == nil {
+		routes = []string{}
+	}
+addresses:
+	for _, addr := range addresses {
+		for i := range routes {
+			if routes[i] == addr.Host {
+				continue addresses
+			}
+		}
+		routes = append(routes, addr.Host)
+	}
+	r.Paths[backendName][path] = routes
+	return nil
+}
+
+func (r *pathRouter) RemovePathRoutes(name, path string, addresses []*url.URL) error {
+	backendName, err := router.Retrieve(name)
+	if err != nil {
+		return err
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	routes, ok := r.Paths[backendName][path]
+	if !ok {
+		return router.ErrPathNotFound
+	}
+	for _, addr := range addresses {
+		for i := range routes {
+			if routes[i] == addr.Host {
+				routes = append(routes[:i], routes[i+1:]...)
+				break
+			}
+		}
+	}
+	r.Paths[backendName][path] = routes
+	return nil
+}
+
+func (r *pathRouter) RemovePath(name, path string) error {
+	backendName, err := router.Retrieve(name)
+	if err != nil {
+		return err
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if _, ok := r.Paths[backendName][path]; !ok {
+		return router.ErrPathNotFound
+	}
+	delete(r.Paths[backendName], path)
+	return nil
+}
+
+func (r *pathRouter) PathRoutes(name string) (map[string][]*url.URL, error) {
+	backendName, err := router.Retrieve(name)
+	if err != nil {
+		return nil, err
+	}
+	if !r.HasBackend(backendName) {
+		return nil, router.ErrBackendNotFound
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	result := make(map[string][]*url.URL)
+	for path, routes := range r.Paths[backendName] {
+		result[path] = make([]*url.URL, len(routes))
+		for i, route := range routes {
+			result[path][i] = &url.URL{Scheme: router.HttpScheme, Host: route}
+		}
+	}
+	return result, nil
+}
+
+func (r *pathRouter) Reset() {
+	r.fakeRouter.Reset()
+	r.Paths = make(map[string]map[string][]string)
+}
+
+// FakeL4Port is a port of a backend in the fake L4 router, Routes holds the
+// hosts of the routes.
+type FakeL4Port struct {
+	Protocol string
+	Routes   []string
+}
+
+type l4Router struct {
+	fakeRouter
+	Ports map[string]map[string]*FakeL4Port
+}
+
+var _ router.L4Router = &l4Router{}
+
+func (r *l4Router) AddPortRoutes(name string, port router.L4Port, addresses []*url.URL) error {
+	backendName, err := router.Retrieve(name)
+	if err != nil {
+		return err
+	}
+	if !r.HasBackend(backendName) {
+		return router.ErrBackendNotFound
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	for _, addr := range addresses {
+		if r.failuresByIp[addr.Host] {
+			return ErrForcedFailure
+		}
+	}
+	if r.Ports[backendName] == nil {
+		r.Ports[backendName] = make(map[string]*FakeL4Port)
+	}
+	p := r.Ports[backendName][port.Name]
+	if p == nil {
+		p = &FakeL4Port{Routes: []string{}}
+		r.Ports[backendName][port.Name] = p
+	}
+	p.Protocol = port.Protocol
+addresses:
+	for _, addr := range addresses {
+		for i := range p.Routes {
+			if p.Routes[i] == addr.Host {
+				continue addresses
+			}
+		}
+		p.Routes = append(p.Routes, addr.Host)
+	}
+	return nil
+}
+
+func (r *l4Router) RemovePortRoutes(name, portName string, addresses []*url.URL) error {
+	backendName, err := router.Retrieve(name)
+	if err != nil {
+		return err
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	p, ok := r.Ports[backendName][portName]
+	if !ok {
+		return router.ErrPortNotFound
+	}
+	for _, addr := range addresses {
+		for i := range p.Routes {
+			if p.Routes[i] == addr.Host {
+				p.Routes = append(p.Routes[:i], p.Routes[i+1:]...)
+				break
+			}
+		}
+	}
+	return nil
+}
+
+func (r *l4Router) RemovePort(name, portName string) error {
+	backendName, err := router.Retrieve(name)
+	if err != nil {
+		return err
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if _, ok := r.Ports[backendName][portName]; !ok {
+		return router.ErrPortNotFound
+	}
+	delete(r.Ports[backendName], portName)
+	return nil
+}
+
+func (r *l4Router) PortRoutes(name string) ([]router.L4Route, error) {
+	backendName, err := router.Retrieve(name)
+	if err != nil {
+		return nil, err
+	}
+	if !r.HasBackend(backendName) {
+		return nil, router.ErrBackendNotFound
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	result := make([]router.L4Route, 0, len(r.Ports[backendName]))
+	for portName, p := range r.Ports[backendName] {
+		route := router.L4Route{
+			L4Port:  router.L4Port{Name: portName, Protocol: p.Protocol},
+			Address: fmt.Sprintf("%s-%s.fakerouter.com", backendName, portName),
+			Routes:  make([]*url.URL, len(p.Routes)),
+		}
+		for i, host := range p.Routes {
+			route.Routes[i] = &url.URL{Scheme: p.Protocol, Host: host}
+		}
+		result = append(result, route)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Name < result[j].Name
+	})
+	return result, nil
+}
+
+func (r *l4Router) Reset() {
+	r.fakeRouter.Reset()
+	r.Ports = make(map[string]map[string]*FakeL4Port)
+}
+
+// batchRouter is a fake MultiBatchRouter whose versions are the sorted hosts
+// of the routes. Conflicts is the number of calls to SetRoutes that will fail
+// with ErrRoutesVersionConflict, simulating concurrent changes.
+type batchRouter struct {
+	fakeRouter
+	Conflicts       int
+	SetRoutesCalls  int
+	MultiCalls      int
+	MultiRoutesFail bool
+}
+
+var _ router.MultiBatchRouter = &batchRouter{}
+
+func (r *batchRouter) VersionedRoutes(name string) ([]*url.URL, string, error) {
+	routes, err := r.Routes(name)
+	if err != nil {
+		return nil, "", err
+	}
+	return routes, fakeRoutesVersion(routes), nil
+}
+
+func (r *batchRouter) SetRoutes(name string, addresses []*url.URL, version string) error {
+	routes, err := r.Routes(name)
+	if err != nil {
+		return err
+	}
+	r.mutex.Lock()
+	r.SetRoutesCalls++
+	if r.Conflicts > 0 {
+		r.Conflicts--
+		r.mutex.Unlock()
+		return router.ErrRoutesVersionConflict
+	}
+	r.mutex.Unlock()
+	if version != "" && version != fakeRoutesVersion(routes) {
+		return router.ErrRoutesVersionConflict
+	}
+	err = r.RemoveRoutes(name, routes)
+	if err != nil {
+		return err
+	}
+	return r.AddRoutes(name, addresses)
+}
+
+func (r *batchRouter) VersionedRoutesMulti(names []string) (map[string]router.VersionedRoutes, error) {
+	r.mutex.Lock()
+	r.MultiCalls++
+	fail := r.MultiRoutesFail
+	r.mutex.Unlock()
+	if fail {
+		return nil, errors.New("multi routes failure")
+	}
+	result := make(map[string]router.VersionedRoutes)
+	for _, name := range names {
+		backendName, err := router.Retrieve(name)
+		if err == router.ErrBackendNotFound || (err == nil && !r.HasBackend(backendName)) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		routes, err := r.Routes(name)
+		if err != nil {
+			return nil, err
+		}
+		result[name] = router.VersionedRoutes{Routes: routes, Version: fakeRoutesVersion(routes)}
+	}
+	return result, nil
+}
+
+func (r *batchRouter) Reset() {
+	r.fakeRouter.Reset()
+	r.Conflicts = 0
+	r.SetRoutesCalls = 0
+	r.MultiCalls = 0
+	r.MultiRoutesFail = false
+}
+
+func fakeRoutesVersion(routes []*url.URL) string {
+	hosts := make([]string, len(routes))
+	for i := range routes {
+		hosts[i] = routes[i].Host
+	}
+	sort.Strings(hosts)
+	return strings.Join(hosts, ",")
+}
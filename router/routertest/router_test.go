@@ -37,6 +37,36 @@ func init() {
 		suite.Router = &r
 	}
 	check.Suite(suite)
+	pathSuite := &RouterSuite{
+		SetUpSuiteFunc:   base.SetUpSuite,
+		TearDownTestFunc: base.TearDownTest,
+	}
+	pathSuite.SetUpTestFunc = func(c *check.C) {
+		config.Set("database:name", "router_generic_fake_tests")
+		base.SetUpTest(c)
+		pathSuite.Router = &pathRouter{fakeRouter: newFakeRouter(), Paths: make(map[string]map[string][]string)}
+	}
+	check.Suite(pathSuite)
+	l4Suite := &RouterSuite{
+		SetUpSuiteFunc:   base.SetUpSuite,
+		TearDownTestFunc: base.TearDownTest,
+	}
+	l4Suite.SetUpTestFunc = func(c *check.C) {
+		config.Set("database:name", "router_generic_fake_tests")
+		base.SetUpTest(c)
+		l4Suite.Router = &l4Router{fakeRouter: newFakeRouter(), Ports: make(map[string]map[string]*FakeL4Port)}
+	}
+	check.Suite(l4Suite)
+	batchSuite := &RouterSuite{
+		SetUpSuiteFunc:   base.SetUpSuite,
+		TearDownTestFunc: base.TearDownTest,
+	}
+	batchSuite.SetUpTestFunc = func(c *check.C) {
+		config.Set("database:name", "router_generic_fake_tests")
+		base.SetUpTest(c)
+		batchSuite.Router = &batchRouter{fakeRouter: newFakeRouter()}
+	}
+	check.Suite(batchSuite)
 }
 
 func (s *S) SetUpSuite(c *check.C) {
@@ -249,6 +279,39 @@ func (s *S) TestSwap(c *check.C) {
 	c.Assert(addr, check.Equals, "b1.fakerouter.com")
 }
 
+func (s *S) TestSwapRoutes(c *check.C) {
+	instance1 := s.localhost
+	instance2, _ := url.Parse("http://127.0.0.2")
+	backend1 := "b1"
+	backend2 := "b2"
+	r := newFakeRouter()
+	err := r.AddBackend(FakeApp{Name: backend1})
+	c.Assert(err, check.IsNil)
+	err = r.AddRoutes(backend1, []*url.URL{instance1})
+	c.Assert(err, check.IsNil)
+	err = r.AddBackend(FakeApp{Name: backend2})
+	c.Assert(err, check.IsNil)
+	err = r.AddRoutes(backend2, []*url.URL{instance2})
+	c.Assert(err, check.IsNil)
+	err = router.SwapRoutes(&r, backend1, backend2)
+	c.Assert(err, check.IsNil)
+	routes, err := r.Routes(backend1)
+	c.Assert(err, check.IsNil)
+	c.Assert(routes, check.DeepEquals, []*url.URL{instance2})
+	routes, err = r.Routes(backend2)
+	c.Assert(err, check.IsNil)
+	c.Assert(routes, check.DeepEquals, []*url.URL{instance1})
+	retrieved1, err := router.Retrieve(backend1)
+	c.Assert(err, check.IsNil)
+	c.Assert(retrieved1, check.Equals, backend1)
+	retrieved2, err := router.Retrieve(backend2)
+	c.Assert(err, check.IsNil)
+	c.Assert(retrieved2, check.Equals, backend2)
+	addr, err := r.Addr(backend1)
+	c.Assert(err, check.IsNil)
+	c.Assert(addr, check.Equals, "b1.fakerouter.com")
+}
+
 func (s *S) TestAddCertificate(c *check.C) {
 	r := TLSRouter
 	err := r.AddCertificate(FakeApp{Name: "myapp"}, "example.com", "cert", "key")
@@ -311,3 +374,25 @@ func (s *S) TestUpdateBackendOpts(c *check.C) {
 	c.Assert(err, check.IsNil)
 	c.Assert(r.Opts["myapp"], check.DeepEquals, map[string]string{"opt1": "val1"})
 }
+
+func (s *S) TestSetRoutesWeight(c *check.C) {
+	r := weightedRouter{fakeRouter: newFakeRouter(), Weights: make(map[string]RoutesWeight)}
+	err := r.AddBackend(FakeApp{Name: "myapp"})
+	c.Assert(err, check.IsNil)
+	err = r.AddRoutes("myapp", []*url.URL{s.localhost})
+	c.Assert(err, check.IsNil)
+	err = r.SetRoutesWeight("myapp", []*url.URL{s.localhost}, 30)
+	c.Assert(err, check.IsNil)
+	c.Assert(r.Weights["myapp"], check.DeepEquals, RoutesWeight{Routes: []string{s.localhost.Host}, Weight: 30})
+	err = r.RemoveRoutesWeight("myapp")
+	c.Assert(err, check.IsNil)
+	c.Assert(r.Weights, check.HasLen, 0)
+}
+
+func (s *S) TestSetRoutesWeightRouteNotFound(c *check.C) {
+	r := weightedRouter{fakeRouter: newFakeRouter(), Weights: make(map[string]RoutesWeight)}
+	err := r.AddBackend(FakeApp{Name: "myapp"})
+	c.Assert(err, check.IsNil)
+	err = r.SetRoutesWeight("myapp", []*url.URL{s.localhost}, 30)
+	c.Assert(err, check.ErrorMatches, "route .* not found in backend myapp")
+}
@@ -10,6 +10,7 @@ import (
 )
 
 var (
+	AppLog    app.AppLogService
 	Cache     app.CacheService
 	Plan      app.PlanService
 	Platform  app.PlatformService
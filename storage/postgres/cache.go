@@ -0,0 +1,87 @@
+// Copyright 2018 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package postgres
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/pkg/errors"
+	"github.com/tsuru/tsuru/types/app"
+)
+
+type cacheStorage struct{}
+
+var _ app.CacheStorage = &cacheStorage{}
+
+// notExpired filters out entries past their expiration. Expired rows are
+// removed lazily by Put, there's no TTL index to rely on like in MongoDB.
+const notExpired = `(expire_at IS NULL OR expire_at > now())`
+
+func scanCacheEntry(row scanner) (app.CacheEntry, error) {
+	var entry app.CacheEntry
+	var expireAt pq.NullTime
+	err := row.Scan(&entry.Key, &entry.Value, &expireAt)
+	if expireAt.Valid {
+		entry.ExpireAt = expireAt.Time
+	}
+	return entry, err
+}
+
+func nullTime(t time.Time) pq.NullTime {
+	return pq.NullTime{Time: t, Valid: !t.IsZero()}
+}
+
+func (s *cacheStorage) GetAll(keys ...string) ([]app.CacheEntry, error) {
+	db, err := conn()
+	if err != nil {
+		return nil, err
+	}
+	rows, err := db.Query(`SELECT key, value, expire_at FROM cache WHERE key = ANY($1) AND `+notExpired, pq.Array(keys))
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	defer rows.Close()
+	entries := []app.CacheEntry{}
+	for rows.Next() {
+		entry, err := scanCacheEntry(rows)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		entries = append(entries, entry)
+	}
+	return entries, errors.WithStack(rows.Err())
+}
+
+func (s *cacheStorage) Get(key string) (app.CacheEntry, error) {
+	db, err := conn()
+	if err != nil {
+		return app.CacheEntry{}, err
+	}
+	entry, err := scanCacheEntry(db.QueryRow(`SELECT key, value, expire_at FROM cache WHERE key = $1 AND `+notExpired, key))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return app.CacheEntry{}, app.ErrEntryNotFound
+		}
+		return app.CacheEntry{}, errors.WithStack(err)
+	}
+	return entry, nil
+}
+
+func (s *cacheStorage) Put(entry app.CacheEntry) error {
+	db, err := conn()
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec(`DELETE FROM cache WHERE expire_at <= now()`)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	_, err = db.Exec(`INSERT INTO cache (key, value, expire_at) VALUES ($1, $2, $3)
+		ON CONFLICT (key) DO UPDATE SET value = EXCLUDED.value, expire_at = EXCLUDED.expire_at`,
+		entry.Key, entry.Value, nullTime(entry.ExpireAt))
+	return errors.WithStack(err)
+}
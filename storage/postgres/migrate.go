@@ -0,0 +1,109 @@
+// Copyright 2018 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package postgres
+
+import (
+	"database/sql"
+
+	"github.com/pkg/errors"
+)
+
+// migrationsLockID is the advisory lock key used while applying migrations.
+const migrationsLockID = 0x7473757275
+
+// migrations holds the schema changes in the order they must be applied.
+// Entries must never be changed or removed once released, new changes go
+// at the end of the list.
+var migrations = []string{
+	`CREATE TABLE teams (
+		name          TEXT PRIMARY KEY,
+		creating_user TEXT NOT NULL DEFAULT ''
+	)`,
+	`CREATE TABLE platforms (
+		name     TEXT PRIMARY KEY,
+		disabled BOOLEAN NOT NULL DEFAULT FALSE
+	)`,
+	`CREATE TABLE plans (
+		name       TEXT PRIMARY KEY,
+		memory     BIGINT NOT NULL DEFAULT 0,
+		swap       BIGINT NOT NULL DEFAULT 0,
+		cpu_share  INTEGER NOT NULL DEFAULT 0,
+		is_default BOOLEAN NOT NULL DEFAULT FALSE
+	)`,
+	`CREATE TABLE cache (
+		key       TEXT PRIMARY KEY,
+		value     TEXT NOT NULL DEFAULT '',
+		expire_at TIMESTAMP WITH TIME ZONE
+	)`,
+	`CREATE TABLE team_tokens (
+		token         TEXT NOT NULL UNIQUE,
+		token_id      TEXT NOT NULL UNIQUE,
+		description   TEXT NOT NULL DEFAULT '',
+		created_at    TIMESTAMP WITH TIME ZONE,
+		expires_at    TIMESTAMP WITH TIME ZONE,
+		last_access   TIMESTAMP WITH TIME ZONE,
+		creator_email TEXT NOT NULL DEFAULT '',
+		team          TEXT NOT NULL DEFAULT '',
+		roles         TEXT
+	)`,
+	`CREATE INDEX team_tokens_team_idx ON team_tokens (team)`,
+}
+
+// migrate applies the pending migrations, each one in its own transaction,
+// recording the applied versions in the schema_migrations table. An advisory
+// lock is held while applying a migration so that concurrent API instances
+// starting together don't race on the schema.
+func migrate(db *sql.DB) error {
+	_, err := db.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (version INTEGER PRIMARY KEY)`)
+	if err != nil && !isUniqueViolation(err) {
+		return errors.Wrap(err, "unable to create schema_migrations table")
+	}
+	var current int
+	err = db.QueryRow(`SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&current)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	for i := current; i < len(migrations); i++ {
+		version := i + 1
+		err = applyMigration(db, version, migrations[i])
+		if err != nil {
+			return errors.Wrapf(err, "unable to apply migration %d", version)
+		}
+	}
+	return nil
+}
+
+func applyMigration(db *sql.DB, version int, stmt string) (err error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+	_, err = tx.Exec(`SELECT pg_advisory_xact_lock($1)`, migrationsLockID)
+	if err != nil {
+		return err
+	}
+	var applied bool
+	err = tx.QueryRow(`SELECT EXISTS(SELECT 1 FROM schema_migrations WHERE version = $1)`, version).Scan(&applied)
+	if err != nil {
+		return err
+	}
+	if applied {
+		return tx.Commit()
+	}
+	_, err = tx.Exec(stmt)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`INSERT INTO schema_migrations (version) VALUES ($1)`, version)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
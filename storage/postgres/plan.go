@@ -0,0 +1,125 @@
+// Copyright 2018 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package postgres
+
+import (
+	"database/sql"
+
+	"github.com/pkg/errors"
+	"github.com/tsuru/tsuru/types/app"
+)
+
+var _ app.PlanStorage = &PlanStorage{}
+
+type PlanStorage struct{}
+
+const planColumns = `name, memory, swap, cpu_share, is_default`
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanPlan(row scanner) (app.Plan, error) {
+	var p app.Plan
+	err := row.Scan(&p.Name, &p.Memory, &p.Swap, &p.CpuShare, &p.Default)
+	return p, err
+}
+
+func (s *PlanStorage) Insert(p app.Plan) (err error) {
+	db, err := conn()
+	if err != nil {
+		return err
+	}
+	tx, err := db.Begin()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+	if p.Default {
+		_, err = tx.Exec(`UPDATE plans SET is_default = FALSE WHERE is_default`)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+	}
+	_, err = tx.Exec(`INSERT INTO plans (`+planColumns+`) VALUES ($1, $2, $3, $4, $5)`,
+		p.Name, p.Memory, p.Swap, p.CpuShare, p.Default)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return app.ErrPlanAlreadyExists
+		}
+		return errors.WithStack(err)
+	}
+	return errors.WithStack(tx.Commit())
+}
+
+func (s *PlanStorage) FindAll() ([]app.Plan, error) {
+	return s.findByQuery(`ORDER BY name`)
+}
+
+func (s *PlanStorage) FindDefault() (*app.Plan, error) {
+	plans, err := s.findByQuery(`WHERE is_default`)
+	if err != nil {
+		return nil, err
+	}
+	if len(plans) > 1 {
+		return nil, app.ErrPlanDefaultAmbiguous
+	}
+	if len(plans) == 0 {
+		return nil, app.ErrPlanDefaultNotFound
+	}
+	return &plans[0], nil
+}
+
+func (s *PlanStorage) findByQuery(where string, args ...interface{}) ([]app.Plan, error) {
+	db, err := conn()
+	if err != nil {
+		return nil, err
+	}
+	rows, err := db.Query(`SELECT `+planColumns+` FROM plans `+where, args...)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	defer rows.Close()
+	plans := []app.Plan{}
+	for rows.Next() {
+		p, err := scanPlan(rows)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		plans = append(plans, p)
+	}
+	return plans, errors.WithStack(rows.Err())
+}
+
+func (s *PlanStorage) FindByName(name string) (*app.Plan, error) {
+	db, err := conn()
+	if err != nil {
+		return nil, err
+	}
+	p, err := scanPlan(db.QueryRow(`SELECT `+planColumns+` FROM plans WHERE name = $1`, name))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, app.ErrPlanNotFound
+		}
+		return nil, errors.WithStack(err)
+	}
+	return &p, nil
+}
+
+func (s *PlanStorage) Delete(p app.Plan) error {
+	db, err := conn()
+	if err != nil {
+		return err
+	}
+	result, err := db.Exec(`DELETE FROM plans WHERE name = $1`, p.Name)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	return checkAffected(result, app.ErrPlanNotFound)
+}
@@ -0,0 +1,98 @@
+// Copyright 2018 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package postgres
+
+import (
+	"database/sql"
+
+	"github.com/pkg/errors"
+	"github.com/tsuru/tsuru/types/app"
+)
+
+var _ app.PlatformStorage = &PlatformStorage{}
+
+type PlatformStorage struct{}
+
+func (s *PlatformStorage) Insert(p app.Platform) error {
+	db, err := conn()
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec(`INSERT INTO platforms (name, disabled) VALUES ($1, $2)`, p.Name, p.Disabled)
+	if isUniqueViolation(err) {
+		return app.ErrDuplicatePlatform
+	}
+	return errors.WithStack(err)
+}
+
+func (s *PlatformStorage) FindByName(name string) (*app.Platform, error) {
+	db, err := conn()
+	if err != nil {
+		return nil, err
+	}
+	var p app.Platform
+	err = db.QueryRow(`SELECT name, disabled FROM platforms WHERE name = $1`, name).Scan(&p.Name, &p.Disabled)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, app.ErrPlatformNotFound
+		}
+		return nil, errors.WithStack(err)
+	}
+	return &p, nil
+}
+
+func (s *PlatformStorage) FindAll() ([]app.Platform, error) {
+	return s.findByQuery(`ORDER BY name`)
+}
+
+func (s *PlatformStorage) FindEnabled() ([]app.Platform, error) {
+	return s.findByQuery(`WHERE NOT disabled ORDER BY name`)
+}
+
+func (s *PlatformStorage) findByQuery(where string, args ...interface{}) ([]app.Platform, error) {
+	db, err := conn()
+	if err != nil {
+		return nil, err
+	}
+	rows, err := db.Query(`SELECT name, disabled FROM platforms `+where, args...)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	defer rows.Close()
+	platforms := []app.Platform{}
+	for rows.Next() {
+		var p app.Platform
+		err = rows.Scan(&p.Name, &p.Disabled)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		platforms = append(platforms, p)
+	}
+	return platforms, errors.WithStack(rows.Err())
+}
+
+func (s *PlatformStorage) Update(p app.Platform) error {
+	db, err := conn()
+	if err != nil {
+		return err
+	}
+	result, err := db.Exec(`UPDATE platforms SET disabled = $2 WHERE name = $1`, p.Name, p.Disabled)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	return checkAffected(result, app.ErrPlatformNotFound)
+}
+
+func (s *PlatformStorage) Delete(p app.Platform) error {
+	db, err := conn()
+	if err != nil {
+		return err
+	}
+	result, err := db.Exec(`DELETE FROM platforms WHERE name = $1`, p.Name)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	return checkAffected(result, app.ErrPlatformNotFound)
+}
@@ -0,0 +1,15 @@
+// Copyright 2018 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package postgres
+
+import (
+	"github.com/tsuru/tsuru/storage/storagetest"
+	"gopkg.in/check.v1"
+)
+
+var _ = check.Suite(&storagetest.PlatformSuite{
+	PlatformStorage: &PlatformStorage{},
+	SuiteHooks:      &postgresBaseTest{},
+})
@@ -0,0 +1,90 @@
+// Copyright 2018 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package postgres provides a storage.DbDriver backed by PostgreSQL. It's
+// selected by setting database:driver to "postgres" and connects to the
+// database pointed by database:postgres:url.
+package postgres
+
+import (
+	"database/sql"
+	"sync"
+
+	"github.com/lib/pq"
+	"github.com/pkg/errors"
+	"github.com/tsuru/config"
+	"github.com/tsuru/tsuru/storage"
+)
+
+const (
+	DefaultDatabaseURL = "postgres://127.0.0.1:5432/tsuru?sslmode=disable"
+
+	uniqueViolation = pq.ErrorCode("23505")
+)
+
+var (
+	dbLock sync.Mutex
+	dbConn *sql.DB
+	dbURL  string
+)
+
+func init() {
+	postgresDriver := storage.DbDriver{
+		TeamStorage:      &TeamStorage{},
+		PlatformStorage:  &PlatformStorage{},
+		PlanStorage:      &PlanStorage{},
+		CacheStorage:     &cacheStorage{},
+		TeamTokenStorage: &teamTokenStorage{},
+	}
+	storage.RegisterDbDriver("postgres", postgresDriver)
+}
+
+func databaseURL() string {
+	url, _ := config.GetString("database:postgres:url")
+	if url == "" {
+		url = DefaultDatabaseURL
+	}
+	return url
+}
+
+// conn returns the shared connection pool, opening it and applying pending
+// schema migrations on first use or whenever the configured url changes.
+func conn() (*sql.DB, error) {
+	dbLock.Lock()
+	defer dbLock.Unlock()
+	url := databaseURL()
+	if dbConn != nil && dbURL == url {
+		return dbConn, nil
+	}
+	db, err := sql.Open("postgres", url)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	err = migrate(db)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	if dbConn != nil {
+		dbConn.Close()
+	}
+	dbConn, dbURL = db, url
+	return dbConn, nil
+}
+
+func isUniqueViolation(err error) bool {
+	pqErr, ok := err.(*pq.Error)
+	return ok && pqErr.Code == uniqueViolation
+}
+
+func checkAffected(result sql.Result, notFound error) error {
+	n, err := result.RowsAffected()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if n == 0 {
+		return notFound
+	}
+	return nil
+}
@@ -0,0 +1,66 @@
+// Copyright 2018 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package postgres
+
+import (
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/tsuru/config"
+	"gopkg.in/check.v1"
+)
+
+func Test(t *testing.T) { check.TestingT(t) }
+
+type postgresBaseTest struct{}
+
+// SetUpSuite points the suites to the database in TSURU_POSTGRES_TEST_URL,
+// e.g. postgres://postgres@127.0.0.1:5432/tsuru_storage_postgres_test?sslmode=disable,
+// skipping them when it is not set or not reachable.
+func (t *postgresBaseTest) SetUpSuite(c *check.C) {
+	url := os.Getenv("TSURU_POSTGRES_TEST_URL")
+	if url == "" {
+		c.Skip("TSURU_POSTGRES_TEST_URL is not set")
+	}
+	config.Set("database:postgres:url", url)
+	db, err := conn()
+	if err == nil {
+		err = db.Ping()
+	}
+	if err != nil {
+		c.Skip(fmt.Sprintf("postgres at TSURU_POSTGRES_TEST_URL is not available: %v", err))
+	}
+}
+
+func (t *postgresBaseTest) SetUpTest(c *check.C) {
+	db, err := conn()
+	c.Assert(err, check.IsNil)
+	_, err = db.Exec(`TRUNCATE teams, platforms, plans, cache, team_tokens`)
+	c.Assert(err, check.IsNil)
+}
+
+func (t *postgresBaseTest) TearDownSuite(c *check.C) {
+}
+
+func (t *postgresBaseTest) TearDownTest(c *check.C) {
+}
+
+type S struct {
+	postgresBaseTest
+}
+
+var _ = check.Suite(&S{})
+
+func (s *S) TestMigrateIsIdempotent(c *check.C) {
+	db, err := conn()
+	c.Assert(err, check.IsNil)
+	err = migrate(db)
+	c.Assert(err, check.IsNil)
+	var version int
+	err = db.QueryRow(`SELECT MAX(version) FROM schema_migrations`).Scan(&version)
+	c.Assert(err, check.IsNil)
+	c.Assert(version, check.Equals, len(migrations))
+}
@@ -0,0 +1,89 @@
+// Copyright 2018 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package postgres
+
+import (
+	"database/sql"
+
+	"github.com/lib/pq"
+	"github.com/pkg/errors"
+	"github.com/tsuru/tsuru/types/auth"
+)
+
+type TeamStorage struct{}
+
+var _ auth.TeamStorage = &TeamStorage{}
+
+const teamColumns = `name, creating_user`
+
+func (s *TeamStorage) Insert(t auth.Team) error {
+	db, err := conn()
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec(`INSERT INTO teams (`+teamColumns+`) VALUES ($1, $2)`, t.Name, t.CreatingUser)
+	if isUniqueViolation(err) {
+		return auth.ErrTeamAlreadyExists
+	}
+	return errors.WithStack(err)
+}
+
+func (s *TeamStorage) FindAll() ([]auth.Team, error) {
+	return s.findByQuery(`ORDER BY name`)
+}
+
+func (s *TeamStorage) FindByName(name string) (*auth.Team, error) {
+	db, err := conn()
+	if err != nil {
+		return nil, err
+	}
+	var t auth.Team
+	err = db.QueryRow(`SELECT `+teamColumns+` FROM teams WHERE name = $1`, name).Scan(&t.Name, &t.CreatingUser)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, auth.ErrTeamNotFound
+		}
+		return nil, errors.WithStack(err)
+	}
+	return &t, nil
+}
+
+func (s *TeamStorage) FindByNames(names []string) ([]auth.Team, error) {
+	return s.findByQuery(`WHERE name = ANY($1) ORDER BY name`, pq.Array(names))
+}
+
+func (s *TeamStorage) findByQuery(where string, args ...interface{}) ([]auth.Team, error) {
+	db, err := conn()
+	if err != nil {
+		return nil, err
+	}
+	rows, err := db.Query(`SELECT `+teamColumns+` FROM teams `+where, args...)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	defer rows.Close()
+	teams := []auth.Team{}
+	for rows.Next() {
+		var t auth.Team
+		err = rows.Scan(&t.Name, &t.CreatingUser)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		teams = append(teams, t)
+	}
+	return teams, errors.WithStack(rows.Err())
+}
+
+func (s *TeamStorage) Delete(t auth.Team) error {
+	db, err := conn()
+	if err != nil {
+		return err
+	}
+	result, err := db.Exec(`DELETE FROM teams WHERE name = $1`, t.Name)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	return checkAffected(result, auth.ErrTeamNotFound)
+}
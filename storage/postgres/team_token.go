@@ -0,0 +1,160 @@
+// Copyright 2018 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package postgres
+
+import (
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/pkg/errors"
+	"github.com/tsuru/tsuru/types/auth"
+)
+
+type teamTokenStorage struct{}
+
+var _ auth.TeamTokenStorage = &teamTokenStorage{}
+
+const teamTokenColumns = `token, token_id, description, created_at, expires_at, last_access, creator_email, team, roles`
+
+func scanTeamToken(row scanner) (auth.TeamToken, error) {
+	var t auth.TeamToken
+	var createdAt, expiresAt, lastAccess pq.NullTime
+	var roles sql.NullString
+	err := row.Scan(&t.Token, &t.TokenID, &t.Description, &createdAt, &expiresAt, &lastAccess, &t.CreatorEmail, &t.Team, &roles)
+	if err != nil {
+		return t, err
+	}
+	t.CreatedAt = createdAt.Time
+	t.ExpiresAt = expiresAt.Time
+	t.LastAccess = lastAccess.Time
+	if roles.Valid {
+		err = json.Unmarshal([]byte(roles.String), &t.Roles)
+	}
+	return t, err
+}
+
+func teamTokenValues(t auth.TeamToken) ([]interface{}, error) {
+	var roles sql.NullString
+	if len(t.Roles) > 0 {
+		data, err := json.Marshal(t.Roles)
+		if err != nil {
+			return nil, err
+		}
+		roles = sql.NullString{String: string(data), Valid: true}
+	}
+	return []interface{}{
+		t.Token, t.TokenID, t.Description, nullTime(t.CreatedAt), nullTime(t.ExpiresAt),
+		nullTime(t.LastAccess), t.CreatorEmail, t.Team, roles,
+	}, nil
+}
+
+func (s *teamTokenStorage) Insert(t auth.TeamToken) error {
+	db, err := conn()
+	if err != nil {
+		return err
+	}
+	values, err := teamTokenValues(t)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	_, err = db.Exec(`INSERT INTO team_tokens (`+teamTokenColumns+`) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`, values...)
+	if isUniqueViolation(err) {
+		return auth.ErrTeamTokenAlreadyExists
+	}
+	return errors.WithStack(err)
+}
+
+func (s *teamTokenStorage) findOne(where string, args ...interface{}) (*auth.TeamToken, error) {
+	results, err := s.findByQuery(where, args...)
+	if err != nil {
+		return nil, err
+	}
+	if len(results) == 0 {
+		return nil, auth.ErrTeamTokenNotFound
+	}
+	return &results[0], nil
+}
+
+func (s *teamTokenStorage) FindByToken(token string) (*auth.TeamToken, error) {
+	return s.findOne(`WHERE token = $1`, token)
+}
+
+func (s *teamTokenStorage) FindByTokenID(tokenID string) (*auth.TeamToken, error) {
+	return s.findOne(`WHERE token_id = $1`, tokenID)
+}
+
+func (s *teamTokenStorage) FindByTeams(teamNames []string) ([]auth.TeamToken, error) {
+	if teamNames == nil {
+		return s.findByQuery(``)
+	}
+	return s.findByQuery(`WHERE team = ANY($1)`, pq.Array(teamNames))
+}
+
+func (s *teamTokenStorage) findByQuery(where string, args ...interface{}) ([]auth.TeamToken, error) {
+	db, err := conn()
+	if err != nil {
+		return nil, err
+	}
+	rows, err := db.Query(`SELECT `+teamTokenColumns+` FROM team_tokens `+where, args...)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	defer rows.Close()
+	tokens := []auth.TeamToken{}
+	for rows.Next() {
+		t, err := scanTeamToken(rows)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		tokens = append(tokens, t)
+	}
+	return tokens, errors.WithStack(rows.Err())
+}
+
+func (s *teamTokenStorage) UpdateLastAccess(token string) error {
+	db, err := conn()
+	if err != nil {
+		return err
+	}
+	result, err := db.Exec(`UPDATE team_tokens SET last_access = $2 WHERE token = $1`, token, time.Now().UTC())
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	return checkAffected(result, auth.ErrTeamTokenNotFound)
+}
+
+func (s *teamTokenStorage) Update(token auth.TeamToken) error {
+	db, err := conn()
+	if err != nil {
+		return err
+	}
+	values, err := teamTokenValues(token)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	result, err := db.Exec(`UPDATE team_tokens SET (`+teamTokenColumns+`) = ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		WHERE token_id = $2`, values...)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return auth.ErrTeamTokenAlreadyExists
+		}
+		return errors.WithStack(err)
+	}
+	return checkAffected(result, auth.ErrTeamTokenNotFound)
+}
+
+func (s *teamTokenStorage) Delete(token string) error {
+	db, err := conn()
+	if err != nil {
+		return err
+	}
+	result, err := db.Exec(`DELETE FROM team_tokens WHERE token_id = $1`, token)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	return checkAffected(result, auth.ErrTeamTokenNotFound)
+}
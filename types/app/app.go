@@ -12,3 +12,10 @@ type AppRouter struct {
 	Status       string            `json:"status,omitempty" bson:"-"`
 	StatusDetail string            `json:"status-detail,omitempty" bson:"-"`
 }
+
+// ProcessRoute sends the requests whose path starts with Path to the units of
+// Process, instead of the units of the web process.
+type ProcessRoute struct {
+	Path    string `json:"path"`
+	Process string `json:"process"`
+}
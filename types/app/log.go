@@ -0,0 +1,73 @@
+// Copyright 2018 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package app
+
+import (
+	"errors"
+	"time"
+
+	"github.com/globalsign/mgo/bson"
+)
+
+var ErrInvalidLogCursor = errors.New("invalid log cursor")
+
+// Applog represents a log entry.
+type Applog struct {
+	MongoID bson.ObjectId `bson:"_id,omitempty" json:"-"`
+	Date    time.Time
+	Message string
+	Source  string
+	AppName string
+	Unit    string
+	// Cursor identifies the entry in the service it was listed from, it may
+	// be used as ListLogArgs.Before to page through older entries.
+	Cursor string `bson:"-" json:",omitempty"`
+}
+
+// ListLogArgs filters the log entries of an app. Limit is the maximum number
+// of entries returned, the most recent ones are kept. When InvertFilter is
+// set only entries not matching Source and Unit are returned.
+//
+// Since and Until restrict the entries to the [Since, Until) interval, zero
+// values are unbounded. Query is a regular expression, in Go syntax, matched
+// against the message. Before is the Cursor of an entry returned in a
+// previous call, only older entries are returned.
+type ListLogArgs struct {
+	AppName      string
+	Source       string
+	Unit         string
+	Limit        int
+	InvertFilter bool
+	Since        time.Time
+	Until        time.Time
+	Query        string
+	Before       string
+}
+
+// LogWatcher streams the log entries added to an app after it was created.
+type LogWatcher interface {
+	ListenChan() <-chan Applog
+	Close()
+}
+
+// AppLogService stores and retrieves the log entries of apps.
+type AppLogService interface {
+	// Enqueue adds the entry, possibly asynchronously, it's used for the
+	// high volume of entries sent by the units of apps.
+	Enqueue(entry *Applog) error
+
+	// Add stores the message, split by lines, before returning.
+	Add(appName, message, source, unit string) error
+
+	// List returns the entries matching args, sorted by date.
+	List(args ListLogArgs) ([]Applog, error)
+
+	// Watch returns a LogWatcher for new entries matching the source and
+	// unit, empty values match any source or unit.
+	Watch(appName, source, unit string) (LogWatcher, error)
+
+	// Remove deletes all entries of the app.
+	Remove(appName string) error
+}